@@ -0,0 +1,37 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// gcpkms-benchdiff compares two runs of Go benchmarks, e.g. of the benchmarks
+// of package gcpkms before and after a change.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/benchdiff"
+)
+
+func main() {
+	c := &benchdiff.Command{
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if err := c.Run(os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "gcpkms-benchdiff: %v\n", err)
+		os.Exit(1)
+	}
+}
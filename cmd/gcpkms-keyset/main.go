@@ -0,0 +1,39 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// gcpkms-keyset creates, rotates and inspects Tink keysets encrypted with a
+// GCP Cloud KMS key.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/keysetcli"
+)
+
+func main() {
+	c := &keysetcli.Command{
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if err := c.Run(context.Background(), os.Args[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "gcpkms-keyset: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Package cdk adapts Cloud KMS keys to the Go CDK secrets.Keeper API.
+//
+// It is a separate package so that users of package gcpkms do not depend on
+// the Go CDK.
+package cdk
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/secrets"
+	"gocloud.dev/secrets/driver"
+)
+
+// OpenKeeper returns a secrets.Keeper that encrypts and decrypts with the
+// Cloud KMS key with URI keyURI, e.g.
+// 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k'. opts configure
+// the underlying gcpkms.Client.
+//
+// Requests are bound to the contexts passed to the Keeper, and decryptions
+// verify the CRC32C checksums of the request and response. ErrorAs supports
+// *googleapi.Error, *gcpkms.KMSError and *gcpkms.KeyVersionStateError.
+func OpenKeeper(ctx context.Context, keyURI string, opts ...gcpkms.Option) (*secrets.Keeper, error) {
+	k, err := openKeeper(ctx, keyURI, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return secrets.NewKeeper(k), nil
+}
+
+func openKeeper(ctx context.Context, keyURI string, opts ...gcpkms.Option) (*keeper, error) {
+	client, err := gcpkms.NewClient(ctx, keyURI, opts...)
+	if err != nil {
+		return nil, err
+	}
+	a, err := client.GetAEAD(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	return &keeper{client: client, aead: a.(*gcpkms.AEAD)}, nil
+}
+
+// keeper implements driver.Keeper.
+type keeper struct {
+	client *gcpkms.Client
+	aead   *gcpkms.AEAD
+}
+
+var _ driver.Keeper = (*keeper)(nil)
+
+// Encrypt implements driver.Keeper.Encrypt.
+func (k *keeper) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	return k.aead.EncryptWithContext(ctx, plaintext, nil)
+}
+
+// Decrypt implements driver.Keeper.Decrypt.
+func (k *keeper) Decrypt(ctx context.Context, ciphertext []byte) ([]byte, error) {
+	res, err := k.aead.DecryptWithMetadata(ctx, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+	return res.Plaintext, nil
+}
+
+// Close implements driver.Keeper.Close.
+func (k *keeper) Close() error {
+	return k.client.Close()
+}
+
+// ErrorAs implements driver.Keeper.ErrorAs.
+func (k *keeper) ErrorAs(err error, i interface{}) bool {
+	switch p := i.(type) {
+	case **googleapi.Error:
+		return errors.As(err, p)
+	case **gcpkms.KMSError:
+		return errors.As(err, p)
+	case **gcpkms.KeyVersionStateError:
+		return errors.As(err, p)
+	default:
+		return false
+	}
+}
+
+// ErrorCode implements driver.Keeper.ErrorCode.
+func (k *keeper) ErrorCode(err error) gcerrors.ErrorCode {
+	return errorCode(err)
+}
+
+// errorCode maps errors returned by Cloud KMS to Go CDK error codes.
+func errorCode(err error) gcerrors.ErrorCode {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return gcerrors.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return gcerrors.DeadlineExceeded
+	}
+	var stateErr *gcpkms.KeyVersionStateError
+	if errors.As(err, &stateErr) {
+		return gcerrors.FailedPrecondition
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return gcerrors.Unknown
+	}
+	switch apiErr.Code {
+	case http.StatusBadRequest:
+		return gcerrors.InvalidArgument
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return gcerrors.PermissionDenied
+	case http.StatusNotFound:
+		return gcerrors.NotFound
+	case http.StatusConflict:
+		return gcerrors.AlreadyExists
+	case http.StatusPreconditionFailed:
+		return gcerrors.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return gcerrors.ResourceExhausted
+	case http.StatusNotImplemented:
+		return gcerrors.Unimplemented
+	case http.StatusGatewayTimeout:
+		return gcerrors.DeadlineExceeded
+	}
+	if apiErr.Code >= http.StatusInternalServerError {
+		return gcerrors.Internal
+	}
+	return gcerrors.Unknown
+}
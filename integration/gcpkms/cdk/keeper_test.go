@@ -0,0 +1,183 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package cdk
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"gocloud.dev/gcerrors"
+	"gocloud.dev/secrets"
+	"gocloud.dev/secrets/driver"
+	"gocloud.dev/secrets/drivertest"
+)
+
+const (
+	keyName1 = "projects/p/locations/global/keyRings/r/cryptoKeys/k1"
+	keyName2 = "projects/p/locations/global/keyRings/r/cryptoKeys/k2"
+)
+
+type harness struct {
+	srv *fakekms.Server
+}
+
+func newHarness(ctx context.Context, t *testing.T) (drivertest.Harness, error) {
+	srv := fakekms.NewServer()
+	for _, name := range []string{keyName1, keyName2} {
+		if err := srv.CreateKey(name); err != nil {
+			srv.Close()
+			return nil, err
+		}
+	}
+	return &harness{srv: srv}, nil
+}
+
+func (h *harness) MakeDriver(ctx context.Context) (driver.Keeper, driver.Keeper, error) {
+	opts := []gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(h.srv.ClientOptions()...), gcpkms.WithInsecureTransport()}
+	k1, err := openKeeper(ctx, "gcp-kms://"+keyName1, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	k2, err := openKeeper(ctx, "gcp-kms://"+keyName2, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return k1, k2, nil
+}
+
+func (h *harness) Close() {
+	h.srv.Close()
+}
+
+// verifyAs checks that the errors of malformed ciphertexts expose the
+// *googleapi.Error returned by Cloud KMS.
+type verifyAs struct{}
+
+func (verifyAs) Name() string {
+	return "verify As"
+}
+
+func (verifyAs) ErrorCheck(k *secrets.Keeper, err error) error {
+	var apiErr *googleapi.Error
+	if !k.ErrorAs(err, &apiErr) {
+		return fmt.Errorf("k.ErrorAs(%v, *googleapi.Error) = false, want true", err)
+	}
+	if apiErr.Code != http.StatusBadRequest {
+		return fmt.Errorf("apiErr.Code = %d, want %d", apiErr.Code, http.StatusBadRequest)
+	}
+	if got := gcerrors.Code(err); got != gcerrors.InvalidArgument {
+		return fmt.Errorf("gcerrors.Code(%v) = %v, want %v", err, got, gcerrors.InvalidArgument)
+	}
+	return nil
+}
+
+func TestConformance(t *testing.T) {
+	drivertest.RunConformanceTests(t, newHarness, []drivertest.AsTest{verifyAs{}})
+}
+
+func TestOpenKeeper(t *testing.T) {
+	srv := fakekms.NewServer()
+	defer srv.Close()
+	if err := srv.CreateKey(keyName1); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	ctx := context.Background()
+	k, err := OpenKeeper(ctx, "gcp-kms://"+keyName1, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("OpenKeeper() err = %v, want nil", err)
+	}
+	defer k.Close()
+	ciphertext, err := k.Encrypt(ctx, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("k.Encrypt() err = %v, want nil", err)
+	}
+	if got, err := k.Decrypt(ctx, ciphertext); err != nil || string(got) != "plaintext" {
+		t.Errorf("k.Decrypt() = %q, %v, want %q, nil", got, err, "plaintext")
+	}
+
+	if err := srv.SetVersionState(keyName1, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	_, err = k.Decrypt(ctx, ciphertext)
+	var stateErr *gcpkms.KeyVersionStateError
+	if !k.ErrorAs(err, &stateErr) {
+		t.Errorf("k.ErrorAs(%v, *gcpkms.KeyVersionStateError) = false, want true", err)
+	}
+	if got := gcerrors.Code(err); got != gcerrors.FailedPrecondition {
+		t.Errorf("gcerrors.Code(%v) = %v, want %v", err, got, gcerrors.FailedPrecondition)
+	}
+}
+
+func TestOpenKeeperHonorsContextDeadline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	k, err := OpenKeeper(ctx, "gcp-kms://"+keyName1, gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("OpenKeeper() err = %v, want nil", err)
+	}
+	defer k.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = k.Encrypt(ctx, []byte("plaintext"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("k.Encrypt() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := gcerrors.Code(err); got != gcerrors.DeadlineExceeded {
+		t.Errorf("gcerrors.Code(%v) = %v, want %v", err, got, gcerrors.DeadlineExceeded)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want gcerrors.ErrorCode
+	}{
+		{err: errors.New("unknown"), want: gcerrors.Unknown},
+		{err: context.Canceled, want: gcerrors.Canceled},
+		{err: fmt.Errorf("wrapped: %w", context.DeadlineExceeded), want: gcerrors.DeadlineExceeded},
+		{err: &gcpkms.KeyVersionStateError{Err: gcpkms.ErrKeyVersionDisabled}, want: gcerrors.FailedPrecondition},
+		{err: &googleapi.Error{Code: http.StatusBadRequest}, want: gcerrors.InvalidArgument},
+		{err: &googleapi.Error{Code: http.StatusUnauthorized}, want: gcerrors.PermissionDenied},
+		{err: &googleapi.Error{Code: http.StatusForbidden}, want: gcerrors.PermissionDenied},
+		{err: &googleapi.Error{Code: http.StatusNotFound}, want: gcerrors.NotFound},
+		{err: &googleapi.Error{Code: http.StatusConflict}, want: gcerrors.AlreadyExists},
+		{err: &googleapi.Error{Code: http.StatusTooManyRequests}, want: gcerrors.ResourceExhausted},
+		{err: &googleapi.Error{Code: http.StatusNotImplemented}, want: gcerrors.Unimplemented},
+		{err: &googleapi.Error{Code: http.StatusServiceUnavailable}, want: gcerrors.Internal},
+		{err: &googleapi.Error{Code: http.StatusGatewayTimeout}, want: gcerrors.DeadlineExceeded},
+	} {
+		if got := errorCode(tc.err); got != tc.want {
+			t.Errorf("errorCode(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+}
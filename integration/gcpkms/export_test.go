@@ -0,0 +1,55 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+// WithBaseTransport lets the external tests talk to TLS test servers.
+var WithBaseTransport = withBaseTransport
+
+// WithCredentialsPollInterval lets the external tests know by how much to
+// advance the fake clock for the credentials file to be polled.
+var WithCredentialsPollInterval = withCredentialsPollInterval
+
+// WithDownscopedTokenSource lets the external tests record the token source
+// of WithDownscopedCredentials without the Security Token Service.
+var WithDownscopedTokenSource = withDownscopedTokenSource
+
+// FakeClock, NewFakeClock and WithClock let the external tests control the
+// time of a client, e.g. to trigger its background polling without waiting.
+type FakeClock = fakeClock
+
+var (
+	NewFakeClock = newFakeClock
+	WithClock    = withClock
+)
+
+// JWSAlgorithm lets the external tests check the algorithms SignJWSDetached
+// rejects, which the fake server cannot create keys for.
+var JWSAlgorithm = jwsAlgorithm
+
+// HTTPSignatureAlgorithm lets the external tests check the algorithms
+// SignHTTPRequest rejects.
+var HTTPSignatureAlgorithm = httpSignatureAlgorithm
+
+// COSEAlgorithm lets the external tests check the algorithms SignCOSE
+// rejects, which the fake server cannot create keys for.
+var COSEAlgorithm = coseAlgorithm
+
+// WaitForStalenessChecks waits until the checks of WithRotationStalenessCheck
+// that were started by uses of the primitives of c have finished.
+func WaitForStalenessChecks(c *Client) {
+	c.staleness.running.Wait()
+}
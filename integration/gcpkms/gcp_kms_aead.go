@@ -17,54 +17,462 @@
 package gcpkms
 
 import (
+	"context"
 	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
 
 	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
 	"github.com/tink-crypto/tink-go/v2/tink"
 )
 
-// gcpAEAD represents a GCP KMS service to a particular URI.
-type gcpAEAD struct {
-	keyURI string
-	kms    cloudkms.Service
+var (
+	// encryptRequests and decryptRequests hold request structs for reuse.
+	// They are cleared before being put back, so that the pools do not
+	// retain plaintexts.
+	encryptRequests = sync.Pool{New: func() any { return new(cloudkms.EncryptRequest) }}
+	decryptRequests = sync.Pool{New: func() any { return new(cloudkms.DecryptRequest) }}
+)
+
+// AEAD represents a GCP KMS service to a particular URI. It is safe for
+// concurrent use.
+//
+// The primitives returned by Client.GetAEAD are of type *AEAD.
+//
+// Ciphertexts are the raw ciphertexts returned by the Cloud KMS Encrypt
+// method, and associated data is sent as its additional authenticated data,
+// where nil and empty are equivalent. They are therefore compatible with
+// `gcloud kms encrypt` and `gcloud kms decrypt` with binary ciphertext files,
+// the Cloud KMS AEADs of Tink in other languages, and the REST API, whose
+// ciphertext field holds the ciphertext in base64, unless WithKeyURIBinding is
+// used.
+//
+// With WithLargePayloadEnvelope, plaintexts larger than 64 KiB are encrypted
+// with envelope encryption instead, and their ciphertexts have the format
+//
+//	"GLPE" || 0x01 || len(encrypted DEK) (4 bytes, big-endian) ||
+//	encrypted DEK || payload
+//
+// where everything following the version is a ciphertext of the envelope AEAD
+// returned by aead.NewKMSEnvelopeAEAD2, whose encrypted DEK is a Cloud KMS
+// ciphertext as above. The header is authenticated as part of the payload's
+// associated data.
+type AEAD struct {
+	keyURI  string
+	kms     cloudkms.Service
+	invoker *invoker
+	// decrypts is nil if decrypt deduplication is disabled.
+	decrypts *decryptGroup
+	timeouts *callTimeouts
+	// bindKeyURI is true if the key URI is bound into the associated data.
+	bindKeyURI bool
+	// largePayloadDEK is nil unless WithLargePayloadEnvelope is used.
+	largePayloadDEK *tinkpb.KeyTemplate
+	// cache is nil unless WithDecryptCache is used. It is shared by the
+	// primitives of the client.
+	cache *decryptCache
+	// deks is nil unless WithDEKCache is used. It is shared by the
+	// primitives of the client.
+	deks *dekCache
+	// staleness is nil unless WithRotationStalenessCheck is used.
+	staleness *stalenessChecker
+	// copyInputs is true if Encrypt copies its inputs before using them, as
+	// documented in WithInputCopying.
+	copyInputs bool
+	// protectionLevel is the protection level of the key, as a string. It is
+	// learned from the first response.
+	protectionLevel atomic.Value
+}
+
+var _ tink.AEAD = (*AEAD)(nil)
+
+// EncryptResult holds the ciphertext and metadata of a Cloud KMS encryption.
+type EncryptResult struct {
+	Ciphertext []byte
+	// KeyVersion is the resource name of the key version that was used,
+	// e.g. "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+	KeyVersion string
+	// ProtectionLevel is the protection level of the key version that was
+	// used, e.g. "SOFTWARE", "HSM", "EXTERNAL" or "EXTERNAL_VPC".
+	ProtectionLevel string
 }
 
-var _ tink.AEAD = (*gcpAEAD)(nil)
+// DecryptResult holds the plaintext and metadata of a Cloud KMS decryption.
+type DecryptResult struct {
+	Plaintext []byte
+	// ProtectionLevel is the protection level of the key version that was
+	// used, e.g. "SOFTWARE", "HSM", "EXTERNAL" or "EXTERNAL_VPC".
+	ProtectionLevel string
+	// UsedPrimary is true if the primary key version was used.
+	UsedPrimary bool
+	// PlaintextChecksumVerified is true if Cloud KMS returned a CRC32C
+	// checksum of the plaintext and it matched the received plaintext.
+	PlaintextChecksumVerified bool
+	// Offline is true if Cloud KMS was unreachable and the DEK of the
+	// envelope ciphertext was kept with WithOfflineDecryptFallback.
+	Offline bool
+}
 
 // newGCPAEAD returns a new GCP KMS service.
-func newGCPAEAD(keyURI string, kms *cloudkms.Service) tink.AEAD {
-	return &gcpAEAD{
-		keyURI: keyURI,
-		kms:    *kms,
+func newGCPAEAD(keyURI string, kms *cloudkms.Service, invoker *invoker, decrypts *decryptGroup, timeouts *callTimeouts, bindKeyURI bool) *AEAD {
+	return &AEAD{
+		keyURI:     keyURI,
+		kms:        *kms,
+		invoker:    invoker,
+		decrypts:   decrypts,
+		timeouts:   timeouts,
+		bindKeyURI: bindKeyURI,
+	}
+}
+
+// boundAssociatedData returns the associated data sent to Cloud KMS for
+// associatedData, as documented in WithKeyURIBinding.
+func (a *AEAD) boundAssociatedData(associatedData []byte) []byte {
+	if !a.bindKeyURI {
+		return associatedData
+	}
+	uri := gcpPrefix + a.keyURI
+	bound := make([]byte, 0, len(associatedData)+len(uri)+4)
+	bound = append(bound, associatedData...)
+	bound = append(bound, uri...)
+	return binary.BigEndian.AppendUint32(bound, uint32(len(uri)))
+}
+
+// withTimeout returns ctx with the deadline configured for method and the
+// protection level of the key.
+func (a *AEAD) withTimeout(ctx context.Context, method Method) (context.Context, context.CancelFunc) {
+	level, _ := a.protectionLevel.Load().(string)
+	return a.timeouts.withTimeout(ctx, method, level)
+}
+
+// learnProtectionLevel records the protection level reported by Cloud KMS.
+func (a *AEAD) learnProtectionLevel(level string) {
+	if level != "" {
+		a.protectionLevel.Store(level)
 	}
 }
 
 // Encrypt encrypts the plaintext with associatedData.
-func (a *gcpAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+func (a *AEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return a.EncryptWithContext(context.Background(), plaintext, associatedData)
+}
 
-	req := &cloudkms.EncryptRequest{
-		Plaintext:                   base64.URLEncoding.EncodeToString(plaintext),
-		AdditionalAuthenticatedData: base64.URLEncoding.EncodeToString(associatedData),
+// EncryptWithContext is like Encrypt, but the request to Cloud KMS is bound
+// to ctx.
+func (a *AEAD) EncryptWithContext(ctx context.Context, plaintext, associatedData []byte) ([]byte, error) {
+	return a.EncryptInto(ctx, nil, plaintext, associatedData)
+}
+
+// EncryptWithMetadata encrypts plaintext with associatedData and returns the
+// ciphertext together with the metadata reported by Cloud KMS. The request
+// is bound to ctx. For envelope ciphertexts of WithLargePayloadEnvelope, the
+// metadata is that of the encryption of the DEK.
+func (a *AEAD) EncryptWithMetadata(ctx context.Context, plaintext, associatedData []byte) (*EncryptResult, error) {
+	res, _, err := a.seal(ctx, nil, plaintext, associatedData, false)
+	if err != nil {
+		return nil, err
 	}
-	resp, err := a.kms.Projects.Locations.KeyRings.CryptoKeys.Encrypt(a.keyURI, req).Do()
+	return &res, nil
+}
+
+// EncryptInto is like EncryptWithContext, but appends the ciphertext to dst
+// and returns the extended slice, like the append-style APIs of the standard
+// library. A new slice is only allocated if the capacity of dst is
+// insufficient, so callers can reuse a buffer across calls.
+//
+// dst may overlap plaintext or associatedData, e.g. plaintext[:0] reuses the
+// storage of plaintext, since they are encoded into the request before the
+// ciphertext is written. The capacity of dst beyond its length may be
+// overwritten even if an error is returned.
+func (a *AEAD) EncryptInto(ctx context.Context, dst, plaintext, associatedData []byte) ([]byte, error) {
+	res, _, err := a.seal(ctx, dst, plaintext, associatedData, false)
 	if err != nil {
 		return nil, err
 	}
+	return res.Ciphertext, nil
+}
+
+// EncryptWithChecksum encrypts plaintext with associatedData and returns the
+// ciphertext together with the CRC32C checksum of the ciphertext computed by
+// Cloud KMS, e.g. to store it along with the ciphertext and detect
+// corruption at rest with VerifyStoredChecksum before decrypting. The
+// request is bound to ctx.
+//
+// The checksums of plaintext and associatedData are sent along with the
+// request, and the returned checksum is verified against the received
+// ciphertext. For envelope ciphertexts of WithLargePayloadEnvelope, this
+// applies to the encryption of the DEK, and the checksum of the ciphertext is
+// computed locally.
+func (a *AEAD) EncryptWithChecksum(ctx context.Context, plaintext, associatedData []byte) (ciphertext []byte, crc32c int64, err error) {
+	res, crc32c, err := a.seal(ctx, nil, plaintext, associatedData, true)
+	if err != nil {
+		return nil, 0, err
+	}
+	return res.Ciphertext, crc32c, nil
+}
+
+// encrypt encrypts plaintext with associatedData and appends the ciphertext
+// to dst. If checksums is true, the CRC32C checksums of the request and
+// response are verified, and the checksum of the ciphertext is returned.
+func (a *AEAD) encrypt(ctx context.Context, dst, plaintext, associatedData []byte, checksums bool) (EncryptResult, int64, error) {
+	associatedData = a.boundAssociatedData(associatedData)
+	req := encryptRequests.Get().(*cloudkms.EncryptRequest)
+	*req = cloudkms.EncryptRequest{
+		Plaintext:                   base64.StdEncoding.EncodeToString(plaintext),
+		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(associatedData),
+	}
+	if checksums {
+		SetEncryptRequestChecksums(req, plaintext, associatedData)
+	}
+	defer func() {
+		*req = cloudkms.EncryptRequest{}
+		encryptRequests.Put(req)
+	}()
+	ctx, cancel := a.withTimeout(ctx, MethodEncrypt)
+	defer cancel()
+	start := a.invoker.clock.Now()
+	var resp *cloudkms.EncryptResponse
+	err := a.invoker.callNewKey(ctx, MethodEncrypt, a.keyURI, func(ctx context.Context) error {
+		var err error
+		resp, err = a.kms.Projects.Locations.KeyRings.CryptoKeys.Encrypt(a.keyURI, req).Context(ctx).Do()
+		return err
+	})
+	a.invoker.finished("Encrypt", a.keyURI, start, err)
+	if err != nil {
+		return EncryptResult{}, 0, keyVersionStateError(ctx, &a.kms, err)
+	}
+	a.invoker.succeeded("Encrypt", a.keyURI, resp.ServerResponse)
+	a.learnProtectionLevel(resp.ProtectionLevel)
+	if a.staleness != nil {
+		a.staleness.used(a.keyURI)
+	}
+	if a.deks != nil {
+		// Cloud KMS encrypts with the primary version, so a cached DEK
+		// encrypted by another version is stale.
+		a.deks.observePrimary(a.keyURI, resp.Name)
+	}
 
-	return base64.StdEncoding.DecodeString(resp.Ciphertext)
+	ciphertext, err := appendBase64(dst, resp.Ciphertext)
+	if err != nil {
+		return EncryptResult{}, 0, err
+	}
+	if checksums {
+		if !resp.VerifiedPlaintextCrc32c || !resp.VerifiedAdditionalAuthenticatedDataCrc32c {
+			return EncryptResult{}, 0, errors.New("encrypt request corrupted in transit: checksums not verified")
+		}
+		// A missing checksum reads as zero, so it only verifies if the
+		// checksum of the ciphertext is zero.
+		if err := VerifyCRC32C(ciphertext[len(dst):], wrapperspb.Int64(resp.CiphertextCrc32c)); err != nil {
+			return EncryptResult{}, 0, fmt.Errorf("encrypt response corrupted in transit: ciphertext: %w", err)
+		}
+	}
+	return EncryptResult{
+		Ciphertext:      ciphertext,
+		KeyVersion:      resp.Name,
+		ProtectionLevel: resp.ProtectionLevel,
+	}, resp.CiphertextCrc32c, nil
 }
 
 // Decrypt decrypts ciphertext with with associatedData.
-func (a *gcpAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+func (a *AEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return a.DecryptInto(context.Background(), nil, ciphertext, associatedData)
+}
+
+// DecryptWithMetadata decrypts ciphertext with associatedData and returns the
+// plaintext together with the metadata reported by Cloud KMS.
+//
+// The CRC32C checksums of ciphertext and associatedData are sent along with
+// the request, and the checksum of the plaintext in the response is verified.
+// For envelope ciphertexts of WithLargePayloadEnvelope, this applies to the
+// decryption of the DEK, and so does the metadata. With WithDecryptCache,
+// cached results are returned with the metadata of the call that cached them.
+func (a *AEAD) DecryptWithMetadata(ctx context.Context, ciphertext, associatedData []byte) (*DecryptResult, error) {
+	if a.cache != nil {
+		res, err := a.decryptCached(ctx, nil, ciphertext, associatedData)
+		if err != nil {
+			return nil, err
+		}
+		return &res, nil
+	}
+	return a.decryptWithMetadata(ctx, ciphertext, associatedData)
+}
+
+// decryptWithMetadata implements DecryptWithMetadata without the decrypt
+// cache.
+func (a *AEAD) decryptWithMetadata(ctx context.Context, ciphertext, associatedData []byte) (*DecryptResult, error) {
+	if res, ok, err := a.openLargePayload(ctx, nil, ciphertext, associatedData); ok {
+		if err != nil {
+			return nil, err
+		}
+		return &res, nil
+	}
+	associatedData = a.boundAssociatedData(associatedData)
+	if a.decrypts == nil {
+		res, err := a.decryptPooled(ctx, nil, ciphertext, associatedData)
+		if err != nil {
+			return nil, err
+		}
+		return &res, nil
+	}
+	return a.decryptShared(ctx, ciphertext, associatedData)
+}
+
+// DecryptInto is like Decrypt, but the request to Cloud KMS is bound to ctx,
+// and the plaintext is appended to dst, like the append-style APIs of the
+// standard library. It returns the extended slice. A new slice is only
+// allocated if the capacity of dst is insufficient, so callers can reuse a
+// buffer across calls.
+//
+// dst may overlap ciphertext or associatedData, e.g. ciphertext[:0] reuses
+// the storage of ciphertext, since they are encoded into the request before
+// the plaintext is written. The capacity of dst beyond its length may be
+// overwritten even if an error is returned.
+func (a *AEAD) DecryptInto(ctx context.Context, dst, ciphertext, associatedData []byte) ([]byte, error) {
+	if a.cache != nil {
+		res, err := a.decryptCached(ctx, dst, ciphertext, associatedData)
+		if err != nil {
+			return nil, err
+		}
+		return res.Plaintext, nil
+	}
+	if res, ok, err := a.openLargePayload(ctx, dst, ciphertext, associatedData); ok {
+		if err != nil {
+			return nil, err
+		}
+		return res.Plaintext, nil
+	}
+	associatedData = a.boundAssociatedData(associatedData)
+	if a.decrypts == nil {
+		res, err := a.decryptPooled(ctx, dst, ciphertext, associatedData)
+		if err != nil {
+			return nil, err
+		}
+		return res.Plaintext, nil
+	}
+	// The plaintext of a shared call is shared by its callers, so it is
+	// copied.
+	res, err := a.decryptShared(ctx, ciphertext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+	return append(dst, res.Plaintext...), nil
+}
+
+// decryptPooled decrypts ciphertext with associatedData, which must already
+// be bound, with a pooled request, and appends the plaintext to dst.
+func (a *AEAD) decryptPooled(ctx context.Context, dst, ciphertext, associatedData []byte) (DecryptResult, error) {
+	req := decryptRequests.Get().(*cloudkms.DecryptRequest)
+	*req = newDecryptRequest(ciphertext, associatedData)
+	defer func() {
+		*req = cloudkms.DecryptRequest{}
+		decryptRequests.Put(req)
+	}()
+	return a.decrypt(ctx, dst, req)
+}
+
+// decryptShared decrypts ciphertext with associatedData, which must already
+// be bound, sharing the request with concurrent identical calls.
+func (a *AEAD) decryptShared(ctx context.Context, ciphertext, associatedData []byte) (*DecryptResult, error) {
+	// The shared call may outlive this one, so it only uses req, which does
+	// not alias the caller's slices and is not reused.
+	req := newDecryptRequest(ciphertext, associatedData)
+	return a.decrypts.do(ctx, decryptKey(a.keyURI, ciphertext, associatedData), func(ctx context.Context) (*DecryptResult, error) {
+		res, err := a.decrypt(ctx, nil, &req)
+		if err != nil {
+			return nil, err
+		}
+		return &res, nil
+	})
+}
+
+// newDecryptRequest returns a request to decrypt ciphertext with
+// associatedData, along with their CRC32C checksums. The checksums are
+// computed once and sent again by retries.
+func newDecryptRequest(ciphertext, associatedData []byte) cloudkms.DecryptRequest {
+	req := cloudkms.DecryptRequest{
+		Ciphertext:                  base64.StdEncoding.EncodeToString(ciphertext),
+		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(associatedData),
+	}
+	SetDecryptRequestChecksums(&req, ciphertext, associatedData)
+	return req
+}
+
+// decodeBase64 decodes a bytes field of a Cloud KMS response. Requests use
+// standard base64 with padding, but like the protobuf JSON mapping, decoding
+// also accepts URL-safe base64 and missing padding, which proxies and
+// emulators may return.
+func decodeBase64(s string) ([]byte, error) {
+	return appendBase64(nil, s)
+}
 
-	req := &cloudkms.DecryptRequest{
-		Ciphertext:                  base64.URLEncoding.EncodeToString(ciphertext),
-		AdditionalAuthenticatedData: base64.URLEncoding.EncodeToString(associatedData),
+// appendBase64 is like decodeBase64, but appends the decoded bytes to dst,
+// and only allocates if the capacity of dst is insufficient.
+func appendBase64(dst []byte, s string) ([]byte, error) {
+	enc := base64.StdEncoding
+	if strings.ContainsAny(s, "-_") {
+		enc = base64.URLEncoding
 	}
-	resp, err := a.kms.Projects.Locations.KeyRings.CryptoKeys.Decrypt(a.keyURI, req).Do()
+	if len(s)%4 != 0 {
+		enc = enc.WithPadding(base64.NoPadding)
+	}
+	n := enc.DecodedLen(len(s))
+	if cap(dst)-len(dst) < n {
+		grown := make([]byte, len(dst), len(dst)+n)
+		copy(grown, dst)
+		dst = grown
+	}
+	m, err := enc.Decode(dst[len(dst):len(dst)+n], []byte(s))
 	if err != nil {
 		return nil, err
 	}
-	return base64.StdEncoding.DecodeString(resp.Plaintext)
+	return dst[:len(dst)+m], nil
+}
+
+// decrypt sends req and appends the plaintext to dst.
+func (a *AEAD) decrypt(ctx context.Context, dst []byte, req *cloudkms.DecryptRequest) (DecryptResult, error) {
+	ctx, cancel := a.withTimeout(ctx, MethodDecrypt)
+	defer cancel()
+	start := a.invoker.clock.Now()
+	var resp *cloudkms.DecryptResponse
+	err := a.invoker.call(ctx, MethodDecrypt, func(ctx context.Context) error {
+		var err error
+		resp, err = hedge(ctx, a.invoker, func(ctx context.Context) (*cloudkms.DecryptResponse, error) {
+			return a.kms.Projects.Locations.KeyRings.CryptoKeys.Decrypt(a.keyURI, req).Context(ctx).Do()
+		})
+		return err
+	})
+	a.invoker.finished("Decrypt", a.keyURI, start, err)
+	if err != nil {
+		if a.bindKeyURI && isInvalidArgument(err) {
+			return DecryptResult{}, fmt.Errorf("%w (key URI binding is enabled: the ciphertext may have been encrypted without it, or for another key URI)", err)
+		}
+		return DecryptResult{}, keyVersionStateError(ctx, &a.kms, err)
+	}
+	a.invoker.succeeded("Decrypt", a.keyURI, resp.ServerResponse)
+	a.learnProtectionLevel(resp.ProtectionLevel)
+	if a.staleness != nil {
+		a.staleness.used(a.keyURI)
+	}
+	plaintext, err := appendBase64(dst, resp.Plaintext)
+	if err != nil {
+		return DecryptResult{}, err
+	}
+	err = VerifyCRC32C(plaintext[len(dst):], optionalChecksum(resp.PlaintextCrc32c))
+	if err != nil && !errors.Is(err, ErrChecksumMissing) {
+		return DecryptResult{}, fmt.Errorf("decrypt response corrupted in transit: plaintext: %w", err)
+	}
+	verified := err == nil
+	return DecryptResult{
+		Plaintext:                 plaintext,
+		ProtectionLevel:           resp.ProtectionLevel,
+		UsedPrimary:               resp.UsedPrimary,
+		PlaintextChecksumVerified: verified,
+	}, nil
 }
@@ -0,0 +1,940 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+func newFakeAEAD(t testing.TB, srv *fakekms.Server, opts ...gcpkms.Option) *gcpkms.AEAD {
+	t.Helper()
+	opts = append([]gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return a.(*gcpkms.AEAD)
+}
+
+func TestAEADEncryptDecrypt(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	ciphertext, err := a.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	got, err := a.Decrypt(ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("a.Decrypt() = %q, want %q", got, plaintext)
+	}
+	if _, err := a.Decrypt(ciphertext, []byte("invalid associatedData")); err == nil {
+		t.Error("a.Decrypt() with invalid associatedData err = nil, want error")
+	}
+}
+
+func TestEncryptWithMetadata(t *testing.T) {
+	srv := newFakeServer(t)
+	if err := srv.SetProtectionLevel(fakeKeyName, "HSM"); err != nil {
+		t.Fatalf("srv.SetProtectionLevel() err = %v, want nil", err)
+	}
+	if _, err := srv.AddVersion(fakeKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	a := newFakeAEAD(t, srv)
+	res, err := a.EncryptWithMetadata(context.Background(), []byte("plaintext"), []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("a.EncryptWithMetadata() err = %v, want nil", err)
+	}
+	if want := fakeKeyName + "/cryptoKeyVersions/2"; res.KeyVersion != want {
+		t.Errorf("res.KeyVersion = %q, want %q", res.KeyVersion, want)
+	}
+	if res.ProtectionLevel != "HSM" {
+		t.Errorf("res.ProtectionLevel = %q, want %q", res.ProtectionLevel, "HSM")
+	}
+	got, err := a.Decrypt(res.Ciphertext, []byte("associatedData"))
+	if err != nil || string(got) != "plaintext" {
+		t.Errorf("a.Decrypt() = %q, %v, want %q, nil", got, err, "plaintext")
+	}
+}
+
+func TestEncryptWithChecksum(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	ciphertext, crc, err := a.EncryptWithChecksum(context.Background(), []byte("plaintext"), []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("a.EncryptWithChecksum() err = %v, want nil", err)
+	}
+	if want := int64(crc32.Checksum(ciphertext, crc32.MakeTable(crc32.Castagnoli))); crc != want {
+		t.Errorf("a.EncryptWithChecksum() checksum = %d, want %d", crc, want)
+	}
+	if err := gcpkms.VerifyStoredChecksum(ciphertext, crc); err != nil {
+		t.Errorf("gcpkms.VerifyStoredChecksum() err = %v, want nil", err)
+	}
+	corrupted := bytes.Clone(ciphertext)
+	corrupted[len(corrupted)-1] ^= 1
+	if err := gcpkms.VerifyStoredChecksum(corrupted, crc); !errors.Is(err, gcpkms.ErrChecksumMismatch) {
+		t.Errorf("gcpkms.VerifyStoredChecksum() of corrupted ciphertext err = %v, want %v", err, gcpkms.ErrChecksumMismatch)
+	}
+	got, err := a.Decrypt(ciphertext, []byte("associatedData"))
+	if err != nil || string(got) != "plaintext" {
+		t.Errorf("a.Decrypt() = %q, %v, want %q, nil", got, err, "plaintext")
+	}
+}
+
+func TestEncryptWithChecksumRejectsCorruptedResponses(t *testing.T) {
+	ciphertext := []byte("ciphertext")
+	for _, tc := range []struct {
+		name string
+		resp *cloudkms.EncryptResponse
+	}{
+		{
+			name: "ciphertext checksum mismatch",
+			resp: &cloudkms.EncryptResponse{
+				CiphertextCrc32c:                          gcpkms.ComputeCRC32C(ciphertext) + 1,
+				VerifiedPlaintextCrc32c:                   true,
+				VerifiedAdditionalAuthenticatedDataCrc32c: true,
+			},
+		},
+		{
+			name: "ciphertext checksum missing",
+			resp: &cloudkms.EncryptResponse{
+				VerifiedPlaintextCrc32c:                   true,
+				VerifiedAdditionalAuthenticatedDataCrc32c: true,
+			},
+		},
+		{
+			name: "plaintext checksum not verified",
+			resp: &cloudkms.EncryptResponse{
+				CiphertextCrc32c: gcpkms.ComputeCRC32C(ciphertext),
+				VerifiedAdditionalAuthenticatedDataCrc32c: true,
+			},
+		},
+		{
+			name: "associated data checksum not verified",
+			resp: &cloudkms.EncryptResponse{
+				CiphertextCrc32c:        gcpkms.ComputeCRC32C(ciphertext),
+				VerifiedPlaintextCrc32c: true,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tc.resp.Name = fakeKeyName + "/cryptoKeyVersions/1"
+				tc.resp.Ciphertext = base64.StdEncoding.EncodeToString(ciphertext)
+				json.NewEncoder(w).Encode(tc.resp)
+			}))
+			defer srv.Close()
+			client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+				gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport())
+			if err != nil {
+				t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+			}
+			a, err := client.GetAEAD(fakeKeyURI)
+			if err != nil {
+				t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+			}
+			if _, _, err := a.(*gcpkms.AEAD).EncryptWithChecksum(context.Background(), []byte("plaintext"), nil); err == nil {
+				t.Error("a.EncryptWithChecksum() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestDecryptWithMetadata(t *testing.T) {
+	for _, protectionLevel := range []string{"SOFTWARE", "HSM", "EXTERNAL"} {
+		t.Run(protectionLevel, func(t *testing.T) {
+			srv := newFakeServer(t)
+			if err := srv.SetProtectionLevel(fakeKeyName, protectionLevel); err != nil {
+				t.Fatalf("srv.SetProtectionLevel() err = %v, want nil", err)
+			}
+			a := newFakeAEAD(t, srv)
+			plaintext := []byte("plaintext")
+			associatedData := []byte("associatedData")
+			ciphertext, err := a.Encrypt(plaintext, associatedData)
+			if err != nil {
+				t.Fatalf("a.Encrypt() err = %v, want nil", err)
+			}
+			got, err := a.DecryptWithMetadata(context.Background(), ciphertext, associatedData)
+			if err != nil {
+				t.Fatalf("a.DecryptWithMetadata() err = %v, want nil", err)
+			}
+			want := &gcpkms.DecryptResult{
+				Plaintext:                 plaintext,
+				ProtectionLevel:           protectionLevel,
+				UsedPrimary:               true,
+				PlaintextChecksumVerified: true,
+			}
+			if !bytes.Equal(got.Plaintext, want.Plaintext) || got.ProtectionLevel != want.ProtectionLevel ||
+				got.UsedPrimary != want.UsedPrimary || got.PlaintextChecksumVerified != want.PlaintextChecksumVerified {
+				t.Errorf("a.DecryptWithMetadata() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestDecryptWithMetadataRejectsCorruptedPlaintext(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&cloudkms.DecryptResponse{
+			Plaintext:       base64.StdEncoding.EncodeToString([]byte("plaintexT")),
+			PlaintextCrc32c: 0x1234,
+			ProtectionLevel: "EXTERNAL",
+		})
+	}))
+	defer srv.Close()
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.(*gcpkms.AEAD).DecryptWithMetadata(context.Background(), []byte("ciphertext"), nil); err == nil {
+		t.Error("a.DecryptWithMetadata() err = nil, want error")
+	}
+}
+
+func TestDecryptWithMetadataRespectsContext(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.DecryptWithMetadata(ctx, ciphertext, nil); err == nil {
+		t.Error("a.DecryptWithMetadata() with canceled context err = nil, want error")
+	}
+}
+
+func TestAEADWithDecryptDeduplication(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv, gcpkms.WithDecryptDeduplication())
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	ciphertext, err := a.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := a.Decrypt(ciphertext, associatedData)
+			if err != nil {
+				t.Errorf("a.Decrypt() err = %v, want nil", err)
+				return
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("a.Decrypt() = %q, want %q", got, plaintext)
+			}
+		}()
+	}
+	wg.Wait()
+	if _, err := a.Decrypt(ciphertext, []byte("invalid associatedData")); err == nil {
+		t.Error("a.Decrypt() with invalid associatedData err = nil, want error")
+	}
+}
+
+func TestAEADWithKeyURIBinding(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv, gcpkms.WithKeyURIBinding())
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	ciphertext, err := a.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	got, err := a.Decrypt(ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("a.Decrypt() = %q, want %q", got, plaintext)
+	}
+
+	// The associated data sent to Cloud KMS is documented in WithKeyURIBinding.
+	boundAssociatedData := append([]byte("associatedData"), fakeKeyURI...)
+	boundAssociatedData = binary.BigEndian.AppendUint32(boundAssociatedData, uint32(len(fakeKeyURI)))
+	unbound := newFakeAEAD(t, srv)
+	got, err = unbound.Decrypt(ciphertext, boundAssociatedData)
+	if err != nil {
+		t.Fatalf("unbound.Decrypt() with bound associated data err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("unbound.Decrypt() with bound associated data = %q, want %q", got, plaintext)
+	}
+	if _, err := unbound.Decrypt(ciphertext, associatedData); err == nil {
+		t.Error("unbound.Decrypt() err = nil, want error")
+	}
+}
+
+func TestAEADWithKeyURIBindingRejectsUnboundCiphertexts(t *testing.T) {
+	srv := newFakeServer(t)
+	ciphertext, err := newFakeAEAD(t, srv).Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	a := newFakeAEAD(t, srv, gcpkms.WithKeyURIBinding())
+	_, err = a.Decrypt(ciphertext, nil)
+	if err == nil {
+		t.Fatal("a.Decrypt() err = nil, want error")
+	}
+	if !strings.Contains(err.Error(), "key URI binding is enabled") {
+		t.Errorf("a.Decrypt() err = %v, want error mentioning key URI binding", err)
+	}
+	var kmsErr *gcpkms.KMSError
+	if !errors.As(err, &kmsErr) {
+		t.Errorf("a.Decrypt() err = %v, want *gcpkms.KMSError", err)
+	}
+}
+
+func TestAEADWithKeyURIBindingUsesCanonicalKeyURI(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv, gcpkms.WithKeyURIBinding())
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	uppercaseURI := "GCP-KMS://" + fakeKeyName
+	client, err := gcpkms.NewClient(context.Background(), uppercaseURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithKeyURIBinding())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	b, err := client.GetAEAD(uppercaseURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := b.Decrypt(ciphertext, nil); err != nil {
+		t.Errorf("b.Decrypt() err = %v, want nil", err)
+	}
+}
+
+// newSlowServer returns a server that answers Decrypt requests for a key with
+// the given protection level. All but the first request take delay.
+func newSlowServer(t *testing.T, protectionLevel string, delay time.Duration) *httptest.Server {
+	t.Helper()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		json.NewEncoder(w).Encode(&cloudkms.DecryptResponse{
+			Plaintext:       base64.StdEncoding.EncodeToString([]byte("plaintext")),
+			ProtectionLevel: protectionLevel,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProtectionLevelTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		protectionLevel string
+		wantErr         bool
+	}{
+		{protectionLevel: "SOFTWARE", wantErr: true},
+		{protectionLevel: "EXTERNAL", wantErr: false},
+		{protectionLevel: "EXTERNAL_VPC", wantErr: false},
+	} {
+		t.Run(tc.protectionLevel, func(t *testing.T) {
+			srv := newSlowServer(t, tc.protectionLevel, 200*time.Millisecond)
+			client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+				gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport(),
+				gcpkms.WithCallTimeout(50*time.Millisecond),
+				gcpkms.WithProtectionLevelTimeout("EXTERNAL", 5*time.Second),
+				gcpkms.WithProtectionLevelTimeout("EXTERNAL_VPC", 5*time.Second))
+			if err != nil {
+				t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+			}
+			a, err := client.GetAEAD(fakeKeyURI)
+			if err != nil {
+				t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+			}
+			// The first response teaches the AEAD the protection level.
+			if _, err := a.Decrypt([]byte("ciphertext"), nil); err != nil {
+				t.Fatalf("a.Decrypt() err = %v, want nil", err)
+			}
+			_, err = a.Decrypt([]byte("ciphertext"), nil)
+			if tc.wantErr && !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("a.Decrypt() err = %v, want %v", err, context.DeadlineExceeded)
+			}
+			if !tc.wantErr && err != nil {
+				t.Errorf("a.Decrypt() err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestMethodTimeout(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv,
+		gcpkms.WithCallTimeout(50*time.Millisecond),
+		gcpkms.WithMethodTimeout(gcpkms.MethodDecrypt, 5*time.Second))
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	srv.SetLatency(func(string) time.Duration { return 200 * time.Millisecond })
+
+	// Decrypt has its own deadline, while Encrypt falls back to the call
+	// timeout.
+	if _, err := a.Decrypt(ciphertext, nil); err != nil {
+		t.Errorf("a.Decrypt() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a.Encrypt() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// advancingTransport advances clock by delay during every request but the
+// first, as if they took that long.
+type advancingTransport struct {
+	clock    *gcpkms.FakeClock
+	delay    time.Duration
+	requests atomic.Int32
+}
+
+func (tr *advancingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if tr.requests.Add(1) > 1 {
+		tr.clock.Advance(tr.delay)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestSlowCallThreshold(t *testing.T) {
+	srv := newSlowServer(t, "SOFTWARE", 0)
+	clock := gcpkms.NewFakeClock()
+	calls := make(chan gcpkms.SlowCallInfo, 2)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport(),
+		gcpkms.WithBaseTransport(&advancingTransport{clock: clock, delay: 200 * time.Millisecond}), gcpkms.WithClock(clock),
+		gcpkms.WithSlowCallThreshold(100*time.Millisecond, func(info gcpkms.SlowCallInfo) {
+			calls <- info
+		}))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	// Only the second request is slow.
+	for n := 0; n < 2; n++ {
+		if _, err := a.Decrypt([]byte("ciphertext"), nil); err != nil {
+			t.Fatalf("a.Decrypt() err = %v, want nil", err)
+		}
+	}
+	select {
+	case info := <-calls:
+		if info.Method != "Decrypt" || info.KeyName != fakeKeyName || info.Err != nil {
+			t.Errorf("info = %+v, want a successful Decrypt with %q", info, fakeKeyName)
+		}
+		if info.Duration != 200*time.Millisecond {
+			t.Errorf("info.Duration = %v, want %v", info.Duration, 200*time.Millisecond)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("slow-call hook not called")
+	}
+	select {
+	case info := <-calls:
+		t.Errorf("slow-call hook called for %+v, want a single call", info)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+// logWriter sends every log line to a channel.
+type logWriter chan string
+
+func (w logWriter) Write(p []byte) (int, error) {
+	w <- string(p)
+	return len(p), nil
+}
+
+func TestSlowCallThresholdRecoversPanics(t *testing.T) {
+	srv := newSlowServer(t, "SOFTWARE", 0)
+	logs := make(logWriter, 1)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport(),
+		gcpkms.WithLogger(log.New(logs, "", 0)),
+		gcpkms.WithSlowCallThreshold(time.Nanosecond, func(gcpkms.SlowCallInfo) {
+			panic("hook failed")
+		}))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt([]byte("ciphertext"), nil); err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	select {
+	case line := <-logs:
+		if !strings.Contains(line, "hook failed") {
+			t.Errorf("logged %q, want the panic value", line)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("panic of the slow-call hook not logged")
+	}
+}
+
+// concurrencyTransport delays requests until release is closed, or by delay
+// if release is nil, and records the maximum number of requests in flight.
+type concurrencyTransport struct {
+	delay   time.Duration
+	release chan struct{}
+
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (tr *concurrencyTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	n := atomic.AddInt32(&tr.inFlight, 1)
+	defer atomic.AddInt32(&tr.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&tr.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&tr.maxInFlight, max, n) {
+			break
+		}
+	}
+	if tr.release != nil {
+		<-tr.release
+	} else {
+		time.Sleep(tr.delay)
+	}
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func newConcurrencyLimitedAEAD(t *testing.T, tr *concurrencyTransport, n int) (*gcpkms.Client, *gcpkms.AEAD) {
+	t.Helper()
+	srv := newFakeServer(t)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL()+"/"), option.WithHTTPClient(&http.Client{Transport: tr})), gcpkms.WithInsecureTransport(),
+		gcpkms.WithMaxConcurrentCalls(n))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return client, a.(*gcpkms.AEAD)
+}
+
+func TestWithMaxConcurrentCalls(t *testing.T) {
+	const limit = 3
+	tr := &concurrencyTransport{delay: 10 * time.Millisecond}
+	client, a := newConcurrencyLimitedAEAD(t, tr, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+				t.Errorf("a.Encrypt() err = %v, want nil", err)
+			}
+			if got := client.InFlightCalls(); got > limit {
+				t.Errorf("client.InFlightCalls() = %d, want at most %d", got, limit)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := atomic.LoadInt32(&tr.maxInFlight); got > limit {
+		t.Errorf("maximum number of requests in flight = %d, want at most %d", got, limit)
+	}
+	if got := client.InFlightCalls(); got != 0 {
+		t.Errorf("client.InFlightCalls() = %d, want 0", got)
+	}
+}
+
+func TestWithMaxConcurrentCallsRespectsContext(t *testing.T) {
+	tr := &concurrencyTransport{release: make(chan struct{})}
+	client, a := newConcurrencyLimitedAEAD(t, tr, 1)
+	done := make(chan error)
+	go func() {
+		_, err := a.Encrypt([]byte("plaintext"), nil)
+		done <- err
+	}()
+	for client.InFlightCalls() != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.EncryptWithContext(ctx, []byte("plaintext"), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a.EncryptWithContext() while the limit is reached err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	close(tr.release)
+	if err := <-done; err != nil {
+		t.Errorf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got := atomic.LoadInt32(&tr.maxInFlight); got != 1 {
+		t.Errorf("maximum number of requests in flight = %d, want 1", got)
+	}
+}
+
+func TestWithMaxConcurrentCallsRejectsInvalidLimits(t *testing.T) {
+	if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithMaxConcurrentCalls(0)); err == nil {
+		t.Error("gcpkms.NewClient() with WithMaxConcurrentCalls(0) err = nil, want error")
+	}
+}
+
+// newHedgingServer returns a server whose first request blocks until it is
+// canceled, which closes canceled, and whose other requests reply at once.
+func newHedgingServer(t *testing.T, canceled chan<- struct{}) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The server only notices that the client went away once the body
+		// has been read.
+		io.Copy(io.Discard, r.Body)
+		if atomic.AddInt32(&requests, 1) == 1 {
+			<-r.Context().Done()
+			close(canceled)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ":encrypt") {
+			json.NewEncoder(w).Encode(&cloudkms.EncryptResponse{
+				Ciphertext: base64.StdEncoding.EncodeToString([]byte("ciphertext")),
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(&cloudkms.DecryptResponse{
+			Plaintext:       base64.StdEncoding.EncodeToString([]byte("plaintext")),
+			PlaintextCrc32c: gcpkms.ComputeCRC32C([]byte("plaintext")),
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func newHedgingAEAD(t *testing.T, srv *httptest.Server, opts ...gcpkms.Option) (*gcpkms.Client, *gcpkms.AEAD) {
+	t.Helper()
+	opts = append([]gcpkms.Option{
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport(),
+		gcpkms.WithHedging(10*time.Millisecond, 2),
+	}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return client, a.(*gcpkms.AEAD)
+}
+
+func TestWithHedging(t *testing.T) {
+	canceled := make(chan struct{})
+	srv, requests := newHedgingServer(t, canceled)
+	clock := gcpkms.NewFakeClock()
+	client, a := newHedgingAEAD(t, srv, gcpkms.WithClock(clock))
+
+	var res *gcpkms.DecryptResult
+	errs := make(chan error, 1)
+	go func() {
+		var err error
+		res, err = a.DecryptWithMetadata(context.Background(), []byte("ciphertext"), nil)
+		errs <- err
+	}()
+	// The first request hangs, so the request is hedged once the hedge delay
+	// has elapsed. The second hedge is never due.
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Millisecond)
+	if err := <-errs; err != nil {
+		t.Fatalf("a.DecryptWithMetadata() err = %v, want nil", err)
+	}
+	if got, want := string(res.Plaintext), "plaintext"; got != want {
+		t.Errorf("res.Plaintext = %q, want %q", got, want)
+	}
+	if !res.PlaintextChecksumVerified {
+		t.Error("res.PlaintextChecksumVerified = false, want true")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(5 * time.Second):
+		t.Error("the slow request was not canceled")
+	}
+	if got := atomic.LoadInt32(requests); got != 2 {
+		t.Errorf("number of requests = %d, want 2", got)
+	}
+	if got := client.HedgedRequests(); got != 1 {
+		t.Errorf("client.HedgedRequests() = %d, want 1", got)
+	}
+	if got := client.InFlightCalls(); got != 0 {
+		t.Errorf("client.InFlightCalls() = %d, want 0", got)
+	}
+}
+
+func TestWithHedgingSkipsHedgesAtConcurrencyLimit(t *testing.T) {
+	canceled := make(chan struct{})
+	srv, requests := newHedgingServer(t, canceled)
+	clock := gcpkms.NewFakeClock()
+	client, a := newHedgingAEAD(t, srv, gcpkms.WithMaxConcurrentCalls(1), gcpkms.WithClock(clock))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 1)
+	go func() {
+		_, err := a.DecryptWithMetadata(ctx, []byte("ciphertext"), nil)
+		errs <- err
+	}()
+	// Once the timer is armed again, the first hedge has been skipped.
+	clock.BlockUntil(1)
+	clock.Advance(10 * time.Millisecond)
+	clock.BlockUntil(1)
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt32(requests) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("a.DecryptWithMetadata() err = %v, want %v", err, context.Canceled)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("number of requests = %d, want 1", got)
+	}
+	if got := client.HedgedRequests(); got != 0 {
+		t.Errorf("client.HedgedRequests() = %d, want 0", got)
+	}
+}
+
+func TestWithHedgingDoesNotHedgeEncrypt(t *testing.T) {
+	canceled := make(chan struct{})
+	srv, requests := newHedgingServer(t, canceled)
+	client, a := newHedgingAEAD(t, srv)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := a.EncryptWithContext(ctx, []byte("plaintext"), nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("a.EncryptWithContext() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("number of requests = %d, want 1", got)
+	}
+	if got := client.HedgedRequests(); got != 0 {
+		t.Errorf("client.HedgedRequests() = %d, want 0", got)
+	}
+}
+
+func TestWithHedgingAgainstDelayedFakeKMS(t *testing.T) {
+	srv := newFakeServer(t)
+	ciphertext, err := newFakeAEAD(t, srv).Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	// The first request hangs until the hedged request has answered and it
+	// is canceled.
+	faults := fakekms.NewFaultInjector()
+	faults.Inject("Decrypt", fakeKeyName, fakekms.Fault{Delay: time.Hour})
+	srv.SetFaultInjector(faults)
+	a := newFakeAEAD(t, srv, gcpkms.WithHedging(10*time.Millisecond, 2))
+
+	plaintext, err := a.Decrypt(ciphertext, nil)
+	if err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if got, want := string(plaintext), "plaintext"; got != want {
+		t.Errorf("a.Decrypt() = %q, want %q", got, want)
+	}
+	if got := srv.CallCount("Decrypt"); got != 2 {
+		t.Errorf("Decrypt called %d times, want 2", got)
+	}
+}
+
+func TestEncryptWithChecksumDetectsInjectedFaults(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		fault   fakekms.Fault
+		wantErr string
+	}{
+		{name: "corrupted ciphertext checksum", fault: fakekms.Fault{CorruptChecksums: true}, wantErr: "ciphertext"},
+		{name: "request checksums not verified", fault: fakekms.Fault{FlipVerified: true}, wantErr: "checksums not verified"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			faults := fakekms.NewFaultInjector()
+			faults.Inject("Encrypt", fakeKeyName, tc.fault)
+			srv.SetFaultInjector(faults)
+			a := newFakeAEAD(t, srv)
+			if _, _, err := a.EncryptWithChecksum(context.Background(), []byte("plaintext"), nil); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("a.EncryptWithChecksum() err = %v, want an error about %q", err, tc.wantErr)
+			}
+			if _, _, err := a.EncryptWithChecksum(context.Background(), []byte("plaintext"), nil); err != nil {
+				t.Errorf("a.EncryptWithChecksum() once the fault is consumed err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestWithHedgingRejectsInvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		delay     time.Duration
+		maxHedges int
+	}{
+		{name: "zero delay", delay: 0, maxHedges: 1},
+		{name: "negative delay", delay: -time.Second, maxHedges: 1},
+		{name: "zero hedges", delay: time.Millisecond, maxHedges: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithHedging(tc.delay, tc.maxHedges)); err == nil {
+				t.Errorf("gcpkms.NewClient() with WithHedging(%v, %d) err = nil, want error", tc.delay, tc.maxHedges)
+			}
+		})
+	}
+}
+
+func TestAEADEncryptIntoDecryptInto(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "default"},
+		{name: "decrypt deduplication", opts: []gcpkms.Option{gcpkms.WithDecryptDeduplication()}},
+		{name: "key URI binding", opts: []gcpkms.Option{gcpkms.WithKeyURIBinding()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := newFakeAEAD(t, newFakeServer(t), tc.opts...)
+			ctx := context.Background()
+			plaintext := []byte("plaintext")
+			associatedData := []byte("associatedData")
+			prefix := []byte("prefix")
+
+			for _, dstCap := range []int{len(prefix), 1024} {
+				dst := make([]byte, len(prefix), dstCap)
+				copy(dst, prefix)
+				ciphertext, err := a.EncryptInto(ctx, dst, plaintext, associatedData)
+				if err != nil {
+					t.Fatalf("a.EncryptInto() err = %v, want nil", err)
+				}
+				if !bytes.HasPrefix(ciphertext, prefix) {
+					t.Fatalf("a.EncryptInto() = %q, want prefix %q", ciphertext, prefix)
+				}
+				// The buffer is only replaced if its capacity is insufficient.
+				if reused := &ciphertext[0] == &dst[0]; reused != (dstCap > len(prefix)) {
+					t.Errorf("a.EncryptInto() reused dst = %v, want %v", reused, dstCap > len(prefix))
+				}
+
+				dst = make([]byte, len(prefix), dstCap)
+				copy(dst, prefix)
+				got, err := a.DecryptInto(ctx, dst, ciphertext[len(prefix):], associatedData)
+				if err != nil {
+					t.Fatalf("a.DecryptInto() err = %v, want nil", err)
+				}
+				if want := append(append([]byte{}, prefix...), plaintext...); !bytes.Equal(got, want) {
+					t.Errorf("a.DecryptInto() = %q, want %q", got, want)
+				}
+				if reused := &got[0] == &dst[0]; reused != (dstCap > len(prefix)) {
+					t.Errorf("a.DecryptInto() reused dst = %v, want %v", reused, dstCap > len(prefix))
+				}
+			}
+
+			ciphertext, err := a.EncryptInto(ctx, nil, plaintext, associatedData)
+			if err != nil {
+				t.Fatalf("a.EncryptInto(nil) err = %v, want nil", err)
+			}
+			got, err := a.DecryptInto(ctx, nil, ciphertext, associatedData)
+			if err != nil {
+				t.Fatalf("a.DecryptInto(nil) err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("a.DecryptInto(nil) = %q, want %q", got, plaintext)
+			}
+			if _, err := a.DecryptInto(ctx, nil, ciphertext, []byte("other")); err == nil {
+				t.Error("a.DecryptInto() with other associated data err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestAEADEncryptIntoDecryptIntoAliasing(t *testing.T) {
+	a := newFakeAEAD(t, newFakeServer(t))
+	ctx := context.Background()
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+
+	// Encrypt in place, in a buffer large enough for the ciphertext.
+	buf := make([]byte, len(plaintext), 1024)
+	copy(buf, plaintext)
+	ciphertext, err := a.EncryptInto(ctx, buf[:0], buf, associatedData)
+	if err != nil {
+		t.Fatalf("a.EncryptInto() err = %v, want nil", err)
+	}
+	if &ciphertext[0] != &buf[0] {
+		t.Error("a.EncryptInto() did not reuse the storage of plaintext")
+	}
+	// Decrypt in place, over the ciphertext.
+	got, err := a.DecryptInto(ctx, ciphertext[:0], ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("a.DecryptInto() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("a.DecryptInto() = %q, want %q", got, plaintext)
+	}
+	// Decrypt over the associated data.
+	ciphertext, err = a.EncryptWithContext(ctx, plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.EncryptWithContext() err = %v, want nil", err)
+	}
+	aad := append(make([]byte, 0, 1024), associatedData...)
+	got, err = a.DecryptInto(ctx, aad[:0], ciphertext, aad)
+	if err != nil {
+		t.Fatalf("a.DecryptInto() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("a.DecryptInto() = %q, want %q", got, plaintext)
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"crypto"
+	"crypto/elliptic"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	commonpb "github.com/tink-crypto/tink-go/v2/proto/common_go_proto"
+	ecdsapb "github.com/tink-crypto/tink-go/v2/proto/ecdsa_go_proto"
+	ed25519pb "github.com/tink-crypto/tink-go/v2/proto/ed25519_go_proto"
+	rsassapkcs1pb "github.com/tink-crypto/tink-go/v2/proto/rsa_ssa_pkcs1_go_proto"
+	rsassapsspb "github.com/tink-crypto/tink-go/v2/proto/rsa_ssa_pss_go_proto"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+const (
+	ecdsaPrivateKeyTypeURL       = "type.googleapis.com/google.crypto.tink.EcdsaPrivateKey"
+	ed25519PrivateKeyTypeURL     = "type.googleapis.com/google.crypto.tink.Ed25519PrivateKey"
+	rsaSSAPKCS1PrivateKeyTypeURL = "type.googleapis.com/google.crypto.tink.RsaSsaPkcs1PrivateKey"
+	rsaSSAPSSPrivateKeyTypeURL   = "type.googleapis.com/google.crypto.tink.RsaSsaPssPrivateKey"
+)
+
+// rsaF4 is the public exponent of Cloud KMS RSA keys, 65537, big-endian.
+var rsaF4 = []byte{0x01, 0x00, 0x01}
+
+// notRepresentableReasons explains why the Cloud KMS algorithms that are not
+// in signAlgorithms have no Tink key template.
+var notRepresentableReasons = map[string]string{
+	"CRYPTO_KEY_VERSION_ALGORITHM_UNSPECIFIED": "the algorithm is unspecified",
+	"GOOGLE_SYMMETRIC_ENCRYPTION":              "the key material never leaves Cloud KMS, use the AEAD returned by Client.GetAEAD",
+	"EXTERNAL_SYMMETRIC_ENCRYPTION":            "the key material is held by an external key manager",
+	"AES_128_GCM":                              "raw Cloud KMS ciphertexts have no Tink key type",
+	"AES_256_GCM":                              "raw Cloud KMS ciphertexts have no Tink key type",
+	"AES_128_CBC":                              "Tink does not support AES-CBC",
+	"AES_256_CBC":                              "Tink does not support AES-CBC",
+	"AES_128_CTR":                              "Tink does not support unauthenticated AES-CTR",
+	"AES_256_CTR":                              "Tink does not support unauthenticated AES-CTR",
+	"RSA_SIGN_RAW_PKCS1_2048":                  "Tink does not support RSA PKCS #1 v1.5 signatures without a hash function",
+	"RSA_SIGN_RAW_PKCS1_3072":                  "Tink does not support RSA PKCS #1 v1.5 signatures without a hash function",
+	"RSA_SIGN_RAW_PKCS1_4096":                  "Tink does not support RSA PKCS #1 v1.5 signatures without a hash function",
+	"RSA_DECRYPT_OAEP_2048_SHA256":             "Tink has no RSA-OAEP key type",
+	"RSA_DECRYPT_OAEP_3072_SHA256":             "Tink has no RSA-OAEP key type",
+	"RSA_DECRYPT_OAEP_4096_SHA256":             "Tink has no RSA-OAEP key type",
+	"RSA_DECRYPT_OAEP_4096_SHA512":             "Tink has no RSA-OAEP key type",
+	"RSA_DECRYPT_OAEP_2048_SHA1":               "Tink has no RSA-OAEP key type",
+	"RSA_DECRYPT_OAEP_3072_SHA1":               "Tink has no RSA-OAEP key type",
+	"RSA_DECRYPT_OAEP_4096_SHA1":               "Tink has no RSA-OAEP key type",
+	"EC_SIGN_SECP256K1_SHA256":                 "Tink does not support the secp256k1 curve",
+	"HMAC_SHA1":                                "the key material never leaves Cloud KMS, use the PRF returned by NewKMSPRF",
+	"HMAC_SHA224":                              "the key material never leaves Cloud KMS, use the PRF returned by NewKMSPRF",
+	"HMAC_SHA256":                              "the key material never leaves Cloud KMS, use the PRF returned by NewKMSPRF",
+	"HMAC_SHA384":                              "the key material never leaves Cloud KMS, use the PRF returned by NewKMSPRF",
+	"HMAC_SHA512":                              "the key material never leaves Cloud KMS, use the PRF returned by NewKMSPRF",
+}
+
+// AlgorithmNotRepresentableError is returned by TinkKeyTemplateForAlgorithm
+// for Cloud KMS algorithms that have no equivalent Tink key template.
+type AlgorithmNotRepresentableError struct {
+	// Algorithm is the Cloud KMS algorithm, e.g. "RSA_DECRYPT_OAEP_2048_SHA256".
+	Algorithm string
+	// Reason explains why the algorithm cannot be represented.
+	Reason string
+}
+
+func (e *AlgorithmNotRepresentableError) Error() string {
+	return fmt.Sprintf("gcpkms: algorithm %s cannot be represented in Tink: %s", e.Algorithm, e.Reason)
+}
+
+// TinkKeyTemplateForAlgorithm returns the Tink key template whose keys have
+// the parameters of the Cloud KMS algorithm, e.g. "EC_SIGN_P256_SHA256", so
+// that public keys of Cloud KMS key versions can be mirrored into Tink
+// keysets. ECDSA templates use DER signatures, as Cloud KMS does, and all
+// templates use the RAW output prefix, since Cloud KMS signatures have no
+// Tink prefix.
+//
+// The asymmetric signing algorithms supported by this package are mapped.
+// For all other algorithms, it returns an *AlgorithmNotRepresentableError.
+func TinkKeyTemplateForAlgorithm(algorithm string) (*tinkpb.KeyTemplate, error) {
+	alg, ok := signAlgorithms[algorithm]
+	if !ok {
+		reason, ok := notRepresentableReasons[algorithm]
+		if !ok {
+			reason = "unknown algorithm"
+		}
+		return nil, &AlgorithmNotRepresentableError{Algorithm: algorithm, Reason: reason}
+	}
+	var hash commonpb.HashType
+	if !alg.ed25519 {
+		var err error
+		if hash, err = tinkHashType(alg.hash); err != nil {
+			return nil, err
+		}
+	}
+	var typeURL string
+	var format proto.Message
+	switch {
+	case alg.ed25519:
+		typeURL = ed25519PrivateKeyTypeURL
+		format = &ed25519pb.Ed25519KeyFormat{}
+	case alg.curve != nil:
+		curve, err := tinkCurveType(alg.curve)
+		if err != nil {
+			return nil, err
+		}
+		typeURL = ecdsaPrivateKeyTypeURL
+		format = &ecdsapb.EcdsaKeyFormat{
+			Params: &ecdsapb.EcdsaParams{
+				HashType: hash,
+				Curve:    curve,
+				Encoding: ecdsapb.EcdsaSignatureEncoding_DER,
+			},
+		}
+	case alg.pss:
+		typeURL = rsaSSAPSSPrivateKeyTypeURL
+		format = &rsassapsspb.RsaSsaPssKeyFormat{
+			Params: &rsassapsspb.RsaSsaPssParams{
+				SigHash:    hash,
+				Mgf1Hash:   hash,
+				SaltLength: int32(alg.hash.Size()),
+			},
+			ModulusSizeInBits: uint32(alg.rsaBits),
+			PublicExponent:    rsaF4,
+		}
+	default:
+		typeURL = rsaSSAPKCS1PrivateKeyTypeURL
+		format = &rsassapkcs1pb.RsaSsaPkcs1KeyFormat{
+			Params:            &rsassapkcs1pb.RsaSsaPkcs1Params{HashType: hash},
+			ModulusSizeInBits: uint32(alg.rsaBits),
+			PublicExponent:    rsaF4,
+		}
+	}
+	value, err := proto.Marshal(format)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling key format for %s failed: %v", algorithm, err)
+	}
+	return &tinkpb.KeyTemplate{
+		TypeUrl:          typeURL,
+		Value:            value,
+		OutputPrefixType: tinkpb.OutputPrefixType_RAW,
+	}, nil
+}
+
+func tinkHashType(h crypto.Hash) (commonpb.HashType, error) {
+	switch h {
+	case crypto.SHA256:
+		return commonpb.HashType_SHA256, nil
+	case crypto.SHA384:
+		return commonpb.HashType_SHA384, nil
+	case crypto.SHA512:
+		return commonpb.HashType_SHA512, nil
+	default:
+		return commonpb.HashType_UNKNOWN_HASH, fmt.Errorf("unsupported hash function %v", h)
+	}
+}
+
+func tinkCurveType(c elliptic.Curve) (commonpb.EllipticCurveType, error) {
+	switch c {
+	case elliptic.P256():
+		return commonpb.EllipticCurveType_NIST_P256, nil
+	case elliptic.P384():
+		return commonpb.EllipticCurveType_NIST_P384, nil
+	default:
+		return commonpb.EllipticCurveType_UNKNOWN_CURVE, fmt.Errorf("unsupported curve %s", c.Params().Name)
+	}
+}
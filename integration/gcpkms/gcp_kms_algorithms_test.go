@@ -0,0 +1,168 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	commonpb "github.com/tink-crypto/tink-go/v2/proto/common_go_proto"
+	ecdsapb "github.com/tink-crypto/tink-go/v2/proto/ecdsa_go_proto"
+	ed25519pb "github.com/tink-crypto/tink-go/v2/proto/ed25519_go_proto"
+	rsassapkcs1pb "github.com/tink-crypto/tink-go/v2/proto/rsa_ssa_pkcs1_go_proto"
+	rsassapsspb "github.com/tink-crypto/tink-go/v2/proto/rsa_ssa_pss_go_proto"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"github.com/tink-crypto/tink-go/v2/signature"
+)
+
+func ecdsaFormat(hash commonpb.HashType, curve commonpb.EllipticCurveType) proto.Message {
+	return &ecdsapb.EcdsaKeyFormat{
+		Params: &ecdsapb.EcdsaParams{HashType: hash, Curve: curve, Encoding: ecdsapb.EcdsaSignatureEncoding_DER},
+	}
+}
+
+func pkcs1Format(hash commonpb.HashType, bits uint32) proto.Message {
+	return &rsassapkcs1pb.RsaSsaPkcs1KeyFormat{
+		Params:            &rsassapkcs1pb.RsaSsaPkcs1Params{HashType: hash},
+		ModulusSizeInBits: bits,
+		PublicExponent:    []byte{0x01, 0x00, 0x01},
+	}
+}
+
+func pssFormat(hash commonpb.HashType, saltLength int32, bits uint32) proto.Message {
+	return &rsassapsspb.RsaSsaPssKeyFormat{
+		Params:            &rsassapsspb.RsaSsaPssParams{SigHash: hash, Mgf1Hash: hash, SaltLength: saltLength},
+		ModulusSizeInBits: bits,
+		PublicExponent:    []byte{0x01, 0x00, 0x01},
+	}
+}
+
+// TestTinkKeyTemplateForAlgorithm covers every CryptoKeyVersionAlgorithm of
+// the Cloud KMS API.
+func TestTinkKeyTemplateForAlgorithm(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		// format is the expected key format, or nil if the algorithm cannot
+		// be represented.
+		format proto.Message
+	}{
+		{algorithm: "CRYPTO_KEY_VERSION_ALGORITHM_UNSPECIFIED"},
+		{algorithm: "GOOGLE_SYMMETRIC_ENCRYPTION"},
+		{algorithm: "AES_128_GCM"},
+		{algorithm: "AES_256_GCM"},
+		{algorithm: "AES_128_CBC"},
+		{algorithm: "AES_256_CBC"},
+		{algorithm: "AES_128_CTR"},
+		{algorithm: "AES_256_CTR"},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", format: pssFormat(commonpb.HashType_SHA256, 32, 2048)},
+		{algorithm: "RSA_SIGN_PSS_3072_SHA256", format: pssFormat(commonpb.HashType_SHA256, 32, 3072)},
+		{algorithm: "RSA_SIGN_PSS_4096_SHA256", format: pssFormat(commonpb.HashType_SHA256, 32, 4096)},
+		{algorithm: "RSA_SIGN_PSS_4096_SHA512", format: pssFormat(commonpb.HashType_SHA512, 64, 4096)},
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", format: pkcs1Format(commonpb.HashType_SHA256, 2048)},
+		{algorithm: "RSA_SIGN_PKCS1_3072_SHA256", format: pkcs1Format(commonpb.HashType_SHA256, 3072)},
+		{algorithm: "RSA_SIGN_PKCS1_4096_SHA256", format: pkcs1Format(commonpb.HashType_SHA256, 4096)},
+		{algorithm: "RSA_SIGN_PKCS1_4096_SHA512", format: pkcs1Format(commonpb.HashType_SHA512, 4096)},
+		{algorithm: "RSA_SIGN_RAW_PKCS1_2048"},
+		{algorithm: "RSA_SIGN_RAW_PKCS1_3072"},
+		{algorithm: "RSA_SIGN_RAW_PKCS1_4096"},
+		{algorithm: "RSA_DECRYPT_OAEP_2048_SHA256"},
+		{algorithm: "RSA_DECRYPT_OAEP_3072_SHA256"},
+		{algorithm: "RSA_DECRYPT_OAEP_4096_SHA256"},
+		{algorithm: "RSA_DECRYPT_OAEP_4096_SHA512"},
+		{algorithm: "RSA_DECRYPT_OAEP_2048_SHA1"},
+		{algorithm: "RSA_DECRYPT_OAEP_3072_SHA1"},
+		{algorithm: "RSA_DECRYPT_OAEP_4096_SHA1"},
+		{algorithm: "EC_SIGN_P256_SHA256", format: ecdsaFormat(commonpb.HashType_SHA256, commonpb.EllipticCurveType_NIST_P256)},
+		{algorithm: "EC_SIGN_P384_SHA384", format: ecdsaFormat(commonpb.HashType_SHA384, commonpb.EllipticCurveType_NIST_P384)},
+		{algorithm: "EC_SIGN_SECP256K1_SHA256"},
+		{algorithm: "EC_SIGN_ED25519", format: &ed25519pb.Ed25519KeyFormat{}},
+		{algorithm: "HMAC_SHA256"},
+		{algorithm: "HMAC_SHA1"},
+		{algorithm: "HMAC_SHA384"},
+		{algorithm: "HMAC_SHA512"},
+		{algorithm: "HMAC_SHA224"},
+		{algorithm: "EXTERNAL_SYMMETRIC_ENCRYPTION"},
+		{algorithm: "ML_DSA_65"},
+		{algorithm: ""},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			template, err := gcpkms.TinkKeyTemplateForAlgorithm(tc.algorithm)
+			if tc.format == nil {
+				var notRepresentable *gcpkms.AlgorithmNotRepresentableError
+				if !errors.As(err, &notRepresentable) {
+					t.Fatalf("gcpkms.TinkKeyTemplateForAlgorithm() err = %v, want *gcpkms.AlgorithmNotRepresentableError", err)
+				}
+				if notRepresentable.Algorithm != tc.algorithm || notRepresentable.Reason == "" {
+					t.Errorf("gcpkms.TinkKeyTemplateForAlgorithm() err = %+v, want Algorithm %q and a reason", notRepresentable, tc.algorithm)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("gcpkms.TinkKeyTemplateForAlgorithm() err = %v, want nil", err)
+			}
+			if template.GetOutputPrefixType() != tinkpb.OutputPrefixType_RAW {
+				t.Errorf("OutputPrefixType = %v, want RAW", template.GetOutputPrefixType())
+			}
+			got := tc.format.ProtoReflect().New().Interface()
+			if err := proto.Unmarshal(template.GetValue(), got); err != nil {
+				t.Fatalf("proto.Unmarshal() err = %v, want nil", err)
+			}
+			if !proto.Equal(got, tc.format) {
+				t.Errorf("key format = %v, want %v", got, tc.format)
+			}
+		})
+	}
+}
+
+func TestTinkKeyTemplateForAlgorithmIsAcceptedByTink(t *testing.T) {
+	// Larger RSA keys are skipped, since generating them is slow.
+	for _, algorithm := range []string{"EC_SIGN_ED25519", "EC_SIGN_P256_SHA256", "EC_SIGN_P384_SHA384", "RSA_SIGN_PKCS1_2048_SHA256", "RSA_SIGN_PSS_2048_SHA256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			template, err := gcpkms.TinkKeyTemplateForAlgorithm(algorithm)
+			if err != nil {
+				t.Fatalf("gcpkms.TinkKeyTemplateForAlgorithm() err = %v, want nil", err)
+			}
+			handle, err := keyset.NewHandle(template)
+			if err != nil {
+				t.Fatalf("keyset.NewHandle() err = %v, want nil", err)
+			}
+			signer, err := signature.NewSigner(handle)
+			if err != nil {
+				t.Fatalf("signature.NewSigner() err = %v, want nil", err)
+			}
+			public, err := handle.Public()
+			if err != nil {
+				t.Fatalf("handle.Public() err = %v, want nil", err)
+			}
+			verifier, err := signature.NewVerifier(public)
+			if err != nil {
+				t.Fatalf("signature.NewVerifier() err = %v, want nil", err)
+			}
+			data := []byte("data")
+			sig, err := signer.Sign(data)
+			if err != nil {
+				t.Fatalf("signer.Sign() err = %v, want nil", err)
+			}
+			if err := verifier.Verify(sig, data); err != nil {
+				t.Errorf("verifier.Verify() err = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"google.golang.org/api/googleapi"
+)
+
+var keyHandleRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyHandles/[^/]+$`)
+
+// ErrKeyHandleNotProvisioned is returned when a key URI names an Autokey key
+// handle whose crypto key has not been provisioned yet.
+var ErrKeyHandleNotProvisioned = errors.New("gcpkms: Autokey has not finished provisioning the key handle")
+
+// keyHandle is the subset of the Cloud KMS KeyHandle resource that is needed
+// to resolve it.
+type keyHandle struct {
+	Name   string `json:"name"`
+	KMSKey string `json:"kmsKey"`
+}
+
+// isKeyHandle returns true if name is the resource name of an Autokey key
+// handle, i.e. "projects/*/locations/*/keyHandles/*".
+func isKeyHandle(name string) bool {
+	return keyHandleRegex.MatchString(name)
+}
+
+// resolveKeyHandle returns the name of the crypto key that Autokey
+// provisioned for the key handle with the given name. Resolutions are cached
+// for the lifetime of the client, since a key handle never changes its key.
+func (c *Client) resolveKeyHandle(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	key, ok := c.keyHandles[name]
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	var kh keyHandle
+	err := c.invoker.call(ctx, MethodGetKeyHandle, func(ctx context.Context) error {
+		return c.getKeyHandle(ctx, name, &kh)
+	})
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s: %v", ErrKeyHandleNotProvisioned, name, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolving key handle %s failed: %w", name, err)
+	}
+	if kh.KMSKey == "" {
+		return "", fmt.Errorf("%w: %s", ErrKeyHandleNotProvisioned, name)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keyHandles[name] = kh.KMSKey
+	return kh.KMSKey, nil
+}
+
+// getKeyHandle calls the GetKeyHandle method of the Autokey API, which
+// cloudkms.Service does not provide.
+func (c *Client) getKeyHandle(ctx context.Context, name string, kh *keyHandle) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleapi.ResolveRelative(c.endpoint, "v1/"+name), nil)
+	if err != nil {
+		return err
+	}
+	q := req.URL.Query()
+	q.Set("alt", "json")
+	q.Set("prettyPrint", "false")
+	req.URL.RawQuery = q.Encode()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer googleapi.CloseBody(resp)
+	if err := googleapi.CheckResponse(resp); err != nil {
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(kh)
+}
@@ -0,0 +1,87 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+const keyHandleName = "projects/p/locations/global/keyHandles/h"
+
+func TestGetAEADResolvesKeyHandle(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.CreateKeyHandle(keyHandleName, fakeKeyName)
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithoutPrimitiveCache())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	handleAEAD, err := client.GetAEAD("gcp-kms://" + keyHandleName)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	// The resolution is cached.
+	if _, err := client.GetAEAD("gcp-kms://" + keyHandleName); err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("GetKeyHandle"); got != 1 {
+		t.Errorf("GetKeyHandle called %d times, want 1", got)
+	}
+
+	keyAEAD, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	plaintext := []byte("plaintext")
+	ciphertext, err := handleAEAD.Encrypt(plaintext, nil)
+	if err != nil {
+		t.Fatalf("handleAEAD.Encrypt() err = %v, want nil", err)
+	}
+	got, err := keyAEAD.Decrypt(ciphertext, nil)
+	if err != nil {
+		t.Fatalf("keyAEAD.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("keyAEAD.Decrypt() = %q, want %q", got, plaintext)
+	}
+}
+
+func TestGetAEADWithUnprovisionedKeyHandle(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.CreateKeyHandle(keyHandleName, "")
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	for _, name := range []string{keyHandleName, "projects/p/locations/global/keyHandles/unknown"} {
+		if _, err := client.GetAEAD("gcp-kms://" + name); !errors.Is(err, gcpkms.ErrKeyHandleNotProvisioned) {
+			t.Errorf("client.GetAEAD(%q) err = %v, want %v", name, err, gcpkms.ErrKeyHandleNotProvisioned)
+		}
+	}
+
+	// Once provisioned, the key handle can be used.
+	srv.CreateKeyHandle(keyHandleName, fakeKeyName)
+	if _, err := client.GetAEAD("gcp-kms://" + keyHandleName); err != nil {
+		t.Errorf("client.GetAEAD() err = %v, want nil", err)
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// GetAEADs returns the primitives of the Cloud KMS keys with the given URIs,
+// by URI. The primitives share a single client configured with opts, and
+// thus its connection to Cloud KMS, which makes this much cheaper than
+// calling NewClient and GetAEAD for each URI.
+//
+// All URIs are validated before the client is created, and the errors of all
+// invalid URIs are returned together. With WithEagerValidation, the crypto
+// keys are also fetched from Cloud KMS, and the errors of all unusable keys
+// are returned together.
+func GetAEADs(ctx context.Context, keyURIs []string, opts ...Option) (map[string]*AEAD, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	// uris holds the distinct URIs in order, so that errors are reported
+	// deterministically.
+	var uris []string
+	seen := make(map[string]bool, len(keyURIs))
+	var errs []error
+	for _, keyURI := range keyURIs {
+		if seen[keyURI] {
+			continue
+		}
+		seen[keyURI] = true
+		if _, err := keyNameFromURI(keyURI); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", keyURI, err))
+			continue
+		}
+		uris = append(uris, keyURI)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	client, err := NewClient(ctx, gcpPrefix, opts...)
+	if err != nil {
+		return nil, err
+	}
+	aeads := make(map[string]*AEAD, len(uris))
+	for _, keyURI := range uris {
+		a, err := client.GetAEAD(keyURI)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", keyURI, err))
+			continue
+		}
+		aeads[keyURI] = a.(*AEAD)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	if cfg.eagerValidationConcurrency > 0 {
+		if err := client.validateKeys(ctx, uris, aeads, cfg.eagerValidationConcurrency); err != nil {
+			return nil, err
+		}
+	}
+	return aeads, nil
+}
+
+// validateKeys fetches the crypto keys of the primitives in aeads for the
+// given URIs, with at most concurrency concurrent requests, and returns the
+// errors of all keys that do not exist or are not ENCRYPT_DECRYPT keys, in
+// the order of keyURIs.
+func (c *Client) validateKeys(ctx context.Context, keyURIs []string, aeads map[string]*AEAD, concurrency int) error {
+	results := make([]error, len(keyURIs))
+	forEach(len(keyURIs), concurrency, func(j int) {
+		if err := c.validateKey(ctx, aeads[keyURIs[j]].keyURI); err != nil {
+			results[j] = fmt.Errorf("%s: %w", keyURIs[j], err)
+		}
+	})
+	return errors.Join(results...)
+}
+
+// forEach calls fn with every index in [0, n), with at most concurrency
+// concurrent calls, and returns once all calls have returned.
+func forEach(n, concurrency int, fn func(i int)) {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				fn(j)
+			}
+		}()
+	}
+	for j := 0; j < n; j++ {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// validateKey checks that the crypto key with the given name exists and is
+// an ENCRYPT_DECRYPT key.
+func (c *Client) validateKey(ctx context.Context, name string) error {
+	var purpose string
+	err := c.invoker.call(ctx, MethodGetCryptoKey, func(ctx context.Context) error {
+		key, err := c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		purpose = key.Purpose
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if purpose != "ENCRYPT_DECRYPT" {
+		return fmt.Errorf("crypto key %s has purpose %s, want ENCRYPT_DECRYPT", name, purpose)
+	}
+	return nil
+}
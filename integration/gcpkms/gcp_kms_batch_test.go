@@ -0,0 +1,164 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+// newBatchServer returns a fake server with n keys and their URIs.
+func newBatchServer(t *testing.T, n int) (*fakekms.Server, []string) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	var keyURIs []string
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("projects/p/locations/global/keyRings/r/cryptoKeys/k%d", i)
+		if err := srv.CreateKey(name); err != nil {
+			t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+		}
+		keyURIs = append(keyURIs, "gcp-kms://"+name)
+	}
+	return srv, keyURIs
+}
+
+func TestGetAEADs(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 10)
+	aeads, err := gcpkms.GetAEADs(context.Background(), keyURIs, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.GetAEADs() err = %v, want nil", err)
+	}
+	if len(aeads) != len(keyURIs) {
+		t.Fatalf("len(gcpkms.GetAEADs()) = %d, want %d", len(aeads), len(keyURIs))
+	}
+	plaintext := []byte("plaintext")
+	ciphertexts := make(map[string][]byte)
+	for _, keyURI := range keyURIs {
+		ciphertext, err := aeads[keyURI].Encrypt(plaintext, nil)
+		if err != nil {
+			t.Fatalf("aeads[%q].Encrypt() err = %v, want nil", keyURI, err)
+		}
+		ciphertexts[keyURI] = ciphertext
+	}
+	for _, keyURI := range keyURIs {
+		got, err := aeads[keyURI].Decrypt(ciphertexts[keyURI], nil)
+		if err != nil {
+			t.Fatalf("aeads[%q].Decrypt() err = %v, want nil", keyURI, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("aeads[%q].Decrypt() = %q, want %q", keyURI, got, plaintext)
+		}
+	}
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("srv.Connections() = %d, want 1", got)
+	}
+}
+
+func TestGetAEADsNormalizesScheme(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 1)
+	uppercase := "GCP-KMS://" + strings.TrimPrefix(keyURIs[0], "gcp-kms://")
+	aeads, err := gcpkms.GetAEADs(context.Background(), []string{keyURIs[0], uppercase, keyURIs[0]}, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.GetAEADs() err = %v, want nil", err)
+	}
+	if len(aeads) != 2 {
+		t.Fatalf("len(gcpkms.GetAEADs()) = %d, want 2", len(aeads))
+	}
+	ciphertext, err := aeads[uppercase].Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("aeads[%q].Encrypt() err = %v, want nil", uppercase, err)
+	}
+	if _, err := aeads[keyURIs[0]].Decrypt(ciphertext, nil); err != nil {
+		t.Errorf("aeads[%q].Decrypt() err = %v, want nil", keyURIs[0], err)
+	}
+}
+
+func TestGetAEADsReportsAllInvalidURIs(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 1)
+	invalid := []string{
+		"aws-kms://arn:aws:kms:us-east-1:123456789012:key/k",
+		"gcp-kms://projects/p/locations/global/keyRings/r",
+		"gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+	}
+	_, err := gcpkms.GetAEADs(context.Background(), append(keyURIs, invalid...), gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err == nil {
+		t.Fatal("gcpkms.GetAEADs() err = nil, want error")
+	}
+	for _, keyURI := range invalid {
+		if !strings.Contains(err.Error(), keyURI) {
+			t.Errorf("gcpkms.GetAEADs() err = %v, want error mentioning %q", err, keyURI)
+		}
+	}
+	if got := srv.Connections(); got != 0 {
+		t.Errorf("srv.Connections() = %d, want 0", got)
+	}
+}
+
+func TestGetAEADsWithEagerValidation(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 5)
+	aeads, err := gcpkms.GetAEADs(context.Background(), keyURIs,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithEagerValidation(2))
+	if err != nil {
+		t.Fatalf("gcpkms.GetAEADs() err = %v, want nil", err)
+	}
+	if len(aeads) != len(keyURIs) {
+		t.Errorf("len(gcpkms.GetAEADs()) = %d, want %d", len(aeads), len(keyURIs))
+	}
+	if got := srv.CallCount("GetCryptoKey"); got != len(keyURIs) {
+		t.Errorf("srv.CallCount(\"GetCryptoKey\") = %d, want %d", got, len(keyURIs))
+	}
+}
+
+func TestGetAEADsWithEagerValidationReportsAllUnusableKeys(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 3)
+	const signingKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/signing"
+	if err := srv.CreateSigningKey(signingKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	unusable := []string{
+		"gcp-kms://" + signingKeyName,
+		"gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/missing",
+	}
+	_, err := gcpkms.GetAEADs(context.Background(), append(keyURIs, unusable...),
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithEagerValidation(2))
+	if err == nil {
+		t.Fatal("gcpkms.GetAEADs() err = nil, want error")
+	}
+	for _, keyURI := range unusable {
+		if !strings.Contains(err.Error(), keyURI) {
+			t.Errorf("gcpkms.GetAEADs() err = %v, want error mentioning %q", err, keyURI)
+		}
+	}
+	for _, keyURI := range keyURIs {
+		if strings.Contains(err.Error(), keyURI+":") {
+			t.Errorf("gcpkms.GetAEADs() err = %v, want no error for %q", err, keyURI)
+		}
+	}
+}
+
+func TestWithEagerValidationRejectsInvalidConcurrency(t *testing.T) {
+	if _, err := gcpkms.GetAEADs(context.Background(), nil, gcpkms.WithEagerValidation(0)); err == nil {
+		t.Error("gcpkms.GetAEADs() with WithEagerValidation(0) err = nil, want error")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// The benchmarks run against the fake server, so they measure the overhead of
+// this package and of the HTTP round trip on the loopback interface, not the
+// latency of Cloud KMS. Use cmd/gcpkms-benchdiff to compare two runs.
+
+// benchmarkSizes are the plaintext sizes of the AEAD benchmarks. Cloud KMS
+// accepts plaintexts of up to 64 KiB.
+var benchmarkSizes = []int{64, 1024, 64 * 1024}
+
+// envelopeBenchmarkSizes are the plaintext sizes of the envelope benchmarks,
+// whose cost grows with the plaintext but not the Cloud KMS request.
+var envelopeBenchmarkSizes = []int{1024, 1024 * 1024}
+
+func sizeName(size int) string {
+	switch {
+	case size >= 1024*1024:
+		return fmt.Sprintf("%dMiB", size/(1024*1024))
+	case size >= 1024:
+		return fmt.Sprintf("%dKiB", size/1024)
+	default:
+		return fmt.Sprintf("%dB", size)
+	}
+}
+
+func BenchmarkAEADEncrypt(b *testing.B) {
+	a := newFakeAEAD(b, newFakeServer(b))
+	associatedData := []byte("associatedData")
+	for _, size := range benchmarkSizes {
+		b.Run(sizeName(size), func(b *testing.B) {
+			plaintext := bytes.Repeat([]byte("p"), size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := a.EncryptWithContext(context.Background(), plaintext, associatedData); err != nil {
+					b.Fatalf("a.EncryptWithContext() err = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkAEADDecrypt(b *testing.B) {
+	a := newFakeAEAD(b, newFakeServer(b))
+	associatedData := []byte("associatedData")
+	for _, size := range benchmarkSizes {
+		b.Run(sizeName(size), func(b *testing.B) {
+			ciphertext, err := a.EncryptWithContext(context.Background(), bytes.Repeat([]byte("p"), size), associatedData)
+			if err != nil {
+				b.Fatalf("a.EncryptWithContext() err = %v, want nil", err)
+			}
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := a.DecryptWithMetadata(context.Background(), ciphertext, associatedData); err != nil {
+					b.Fatalf("a.DecryptWithMetadata() err = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAEADEncryptInto is like BenchmarkAEADEncrypt, but reuses the
+// ciphertext buffer.
+func BenchmarkAEADEncryptInto(b *testing.B) {
+	a := newFakeAEAD(b, newFakeServer(b))
+	associatedData := []byte("associatedData")
+	for _, size := range benchmarkSizes {
+		b.Run(sizeName(size), func(b *testing.B) {
+			plaintext := bytes.Repeat([]byte("p"), size)
+			var buf []byte
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				var err error
+				if buf, err = a.EncryptInto(context.Background(), buf[:0], plaintext, associatedData); err != nil {
+					b.Fatalf("a.EncryptInto() err = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAEADDecryptInto is like BenchmarkAEADDecrypt, but reuses the
+// plaintext buffer.
+func BenchmarkAEADDecryptInto(b *testing.B) {
+	a := newFakeAEAD(b, newFakeServer(b))
+	associatedData := []byte("associatedData")
+	for _, size := range benchmarkSizes {
+		b.Run(sizeName(size), func(b *testing.B) {
+			ciphertext, err := a.EncryptWithContext(context.Background(), bytes.Repeat([]byte("p"), size), associatedData)
+			if err != nil {
+				b.Fatalf("a.EncryptWithContext() err = %v, want nil", err)
+			}
+			var buf []byte
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if buf, err = a.DecryptInto(context.Background(), buf[:0], ciphertext, associatedData); err != nil {
+					b.Fatalf("a.DecryptInto() err = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkAEADDecryptWithLatency decrypts against a server that answers
+// every tenth request after 20ms and the others after 1ms, with and without
+// hedging.
+func BenchmarkAEADDecryptWithLatency(b *testing.B) {
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "NoHedging"},
+		{name: "Hedging", opts: []gcpkms.Option{gcpkms.WithHedging(2*time.Millisecond, 1)}},
+	} {
+		b.Run(tc.name, func(b *testing.B) {
+			srv := newFakeServer(b)
+			a := newFakeAEAD(b, srv, tc.opts...)
+			associatedData := []byte("associatedData")
+			ciphertext, err := a.EncryptWithContext(context.Background(), []byte("plaintext"), associatedData)
+			if err != nil {
+				b.Fatalf("a.EncryptWithContext() err = %v, want nil", err)
+			}
+			var calls atomic.Int64
+			srv.SetLatency(func(string) time.Duration {
+				if calls.Add(1)%10 == 0 {
+					return 20 * time.Millisecond
+				}
+				return time.Millisecond
+			})
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := a.DecryptWithMetadata(context.Background(), ciphertext, associatedData); err != nil {
+					b.Fatalf("a.DecryptWithMetadata() err = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSignWithContext(b *testing.B) {
+	ctx := context.Background()
+	_, kms := newFakeSigningKey(b, "EC_SIGN_P256_SHA256")
+	data := bytes.Repeat([]byte("d"), 1024)
+
+	b.Run("Digest", func(b *testing.B) {
+		s, err := gcpkms.NewSigner(ctx, versionName(1), kms)
+		if err != nil {
+			b.Fatalf("gcpkms.NewSigner() err = %v, want nil", err)
+		}
+		digest := sha256.Sum256(data)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			if _, err := s.SignWithContext(ctx, digest[:], s.SignerOpts()); err != nil {
+				b.Fatalf("s.SignWithContext() err = %v, want nil", err)
+			}
+		}
+	})
+
+	// Data mode hashes the data locally before signing the digest.
+	b.Run("Data", func(b *testing.B) {
+		m, err := gcpkms.NewMultiSigner(ctx, []gcpkms.SigningVersion{{Name: versionName(1)}}, kms)
+		if err != nil {
+			b.Fatalf("gcpkms.NewMultiSigner() err = %v, want nil", err)
+		}
+		b.SetBytes(int64(len(data)))
+		b.ReportAllocs()
+		b.ResetTimer()
+		for n := 0; n < b.N; n++ {
+			if _, err := m.SignAllWithContext(ctx, data); err != nil {
+				b.Fatalf("m.SignAllWithContext() err = %v, want nil", err)
+			}
+		}
+	})
+}
+
+func BenchmarkEnvelopeEncrypt(b *testing.B) {
+	_, client, _ := newMultiKEKClients(b)
+	e := newMultiKEKEnvelope(b, fakeKeyURI, client)
+	associatedData := []byte("associatedData")
+	for _, size := range envelopeBenchmarkSizes {
+		b.Run(sizeName(size), func(b *testing.B) {
+			plaintext := bytes.Repeat([]byte("p"), size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := e.Encrypt(plaintext, associatedData); err != nil {
+					b.Fatalf("e.Encrypt() err = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkEnvelopeDecrypt(b *testing.B) {
+	_, client, _ := newMultiKEKClients(b)
+	e := newMultiKEKEnvelope(b, fakeKeyURI, client)
+	associatedData := []byte("associatedData")
+	for _, size := range envelopeBenchmarkSizes {
+		b.Run(sizeName(size), func(b *testing.B) {
+			ciphertext, err := e.Encrypt(bytes.Repeat([]byte("p"), size), associatedData)
+			if err != nil {
+				b.Fatalf("e.Encrypt() err = %v, want nil", err)
+			}
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if _, err := e.Decrypt(ciphertext, associatedData); err != nil {
+					b.Fatalf("e.Decrypt() err = %v, want nil", err)
+				}
+			}
+		})
+	}
+}
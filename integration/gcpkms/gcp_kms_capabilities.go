@@ -0,0 +1,65 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import "fmt"
+
+// Transport identifies how a Client sends requests to Cloud KMS.
+type Transport int
+
+const (
+	// TransportREST sends the requests as JSON over HTTP.
+	TransportREST Transport = iota + 1
+)
+
+// String returns the name of the transport, e.g. "REST".
+func (t Transport) String() string {
+	switch t {
+	case TransportREST:
+		return "REST"
+	default:
+		return fmt.Sprintf("Transport(%d)", int(t))
+	}
+}
+
+// Capabilities describes the primitives that a Client can provide, so that
+// code configuring clients generically does not need to try each of them.
+type Capabilities struct {
+	// SupportsAEADWithContext is true if the primitives returned by GetAEAD
+	// bind their requests to a context, with EncryptWithContext and
+	// DecryptWithMetadata.
+	SupportsAEADWithContext bool
+	// SupportsSigner is true if GetSigner returns signers for asymmetric
+	// signing key versions.
+	SupportsSigner bool
+	// SupportsMAC is true if the client returns primitives for Cloud KMS MAC
+	// keys. It is false since such primitives are created with NewKMSPRF.
+	SupportsMAC bool
+	// ActiveTransport is the transport used by the client.
+	ActiveTransport Transport
+}
+
+// Capabilities returns the capabilities of the client. They do not depend on
+// whether the client is closed.
+func (c *Client) Capabilities() Capabilities {
+	return Capabilities{
+		SupportsAEADWithContext: true,
+		SupportsSigner:          true,
+		SupportsMAC:             false,
+		ActiveTransport:         TransportREST,
+	}
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/prf"
+)
+
+// capabilityProbes attempt to use each capability of Capabilities, and return
+// nil if the client provides it.
+var capabilityProbes = map[string]func(*gcpkms.Client) error{
+	"SupportsAEADWithContext": func(client *gcpkms.Client) error {
+		primitive, err := client.GetAEAD(fakeKeyURI)
+		if err != nil {
+			return err
+		}
+		a, ok := primitive.(interface {
+			EncryptWithContext(ctx context.Context, plaintext, associatedData []byte) ([]byte, error)
+			DecryptWithMetadata(ctx context.Context, ciphertext, associatedData []byte) (*gcpkms.DecryptResult, error)
+		})
+		if !ok {
+			return errors.New("GetAEAD() does not return an AEAD with context")
+		}
+		ciphertext, err := a.EncryptWithContext(context.Background(), []byte("plaintext"), []byte("ad"))
+		if err != nil {
+			return err
+		}
+		res, err := a.DecryptWithMetadata(context.Background(), ciphertext, []byte("ad"))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(res.Plaintext, []byte("plaintext")) {
+			return errors.New("DecryptWithMetadata() returned the wrong plaintext")
+		}
+		return nil
+	},
+	"SupportsSigner": func(client *gcpkms.Client) error {
+		s, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1))
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte("message"))
+		_, err = s.Sign(nil, digest[:], s.SignerOpts())
+		return err
+	},
+	"SupportsMAC": func(client *gcpkms.Client) error {
+		// The client provides MAC primitives once it has a method returning
+		// them, which then needs to be called here.
+		if _, ok := any(client).(interface {
+			GetPRF(ctx context.Context, keyURI string) (prf.PRF, error)
+		}); ok {
+			return errors.New("GetPRF() is not probed")
+		}
+		return errors.New("the client has no method returning MAC primitives")
+	},
+}
+
+func TestCapabilitiesAgreeWithClient(t *testing.T) {
+	srv := newStressServer(t)
+	client := newStressClient(t, srv)
+	caps := client.Capabilities()
+	v := reflect.ValueOf(caps)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type.Kind() != reflect.Bool {
+			continue
+		}
+		t.Run(field.Name, func(t *testing.T) {
+			probe, ok := capabilityProbes[field.Name]
+			if !ok {
+				t.Fatalf("capability %s has no probe", field.Name)
+			}
+			err := probe(client)
+			if supported := v.Field(i).Bool(); supported != (err == nil) {
+				t.Errorf("Capabilities().%s = %v, but probe err = %v", field.Name, supported, err)
+			}
+		})
+	}
+}
+
+func TestCapabilitiesActiveTransport(t *testing.T) {
+	client := newStressClient(t, newFakeServer(t))
+	if got, want := client.Capabilities().ActiveTransport, gcpkms.TransportREST; got != want {
+		t.Errorf("Capabilities().ActiveTransport = %v, want %v", got, want)
+	}
+}
+
+func TestCapabilitiesAfterClose(t *testing.T) {
+	client := newStressClient(t, newFakeServer(t))
+	want := client.Capabilities()
+	client.Close()
+	if got := client.Capabilities(); got != want {
+		t.Errorf("Capabilities() after Close() = %+v, want %+v", got, want)
+	}
+}
+
+func TestTransportString(t *testing.T) {
+	for _, tc := range []struct {
+		transport gcpkms.Transport
+		want      string
+	}{
+		{gcpkms.TransportREST, "REST"},
+		{gcpkms.Transport(0), "Transport(0)"},
+	} {
+		if got := tc.transport.String(); got != tc.want {
+			t.Errorf("Transport(%d).String() = %q, want %q", int(tc.transport), got, tc.want)
+		}
+	}
+}
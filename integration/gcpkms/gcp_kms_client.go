@@ -22,12 +22,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/api/cloudkms/v1"
 	"google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
 	"github.com/tink-crypto/tink-go/v2/core/registry"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
 	"github.com/tink-crypto/tink-go/v2/tink"
 )
 
@@ -40,45 +45,431 @@ var (
 	tinkUserAgent = "Tink/" + tink.Version + " Golang/" + runtime.Version()
 )
 
-// gcpClient represents a client that connects to the GCP KMS backend.
-type gcpClient struct {
+// ErrClientClosed is returned when a Client is used after Close.
+var ErrClientClosed = errors.New("gcpkms: client is closed")
+
+// Client represents a client that connects to the GCP KMS backend. It is safe
+// for concurrent use, including calls to Close while other methods or the
+// primitives of the client are in use.
+type Client struct {
 	keyURIPrefix string
-	kms          *cloudkms.Service
+	// keyURIPrefixes holds keyURIPrefix and the additional prefixes, with
+	// their scheme normalized to lowercase.
+	keyURIPrefixes []string
+	kms            *cloudkms.Service
+	// httpClient and endpoint are used for the Cloud KMS methods that
+	// cloudkms.Service does not provide.
+	httpClient *http.Client
+	endpoint   string
+	// endpoints holds the URLs of the endpoints of WithEndpoints, which the
+	// requests to endpoint are spread across.
+	endpoints []string
+	// insecure is true if WithInsecureTransport is used.
+	insecure bool
+	invoker  *invoker
+	// decrypts is nil if decrypt deduplication is disabled.
+	decrypts *decryptGroup
+	timeouts callTimeouts
+	// keyURIBinding is true if the primitives bind the key URI into the
+	// associated data.
+	keyURIBinding bool
+	// inputCopying is true if the AEADs copy the inputs of every Encrypt
+	// call, as set with WithInputCopying.
+	inputCopying bool
+	// largePayloadDEK is nil unless WithLargePayloadEnvelope is used.
+	largePayloadDEK *tinkpb.KeyTemplate
+	// decryptCache is nil unless WithDecryptCache is used.
+	decryptCache *decryptCache
+	// dekCache is nil unless WithDEKCache is used.
+	dekCache *dekCache
+	// staleness is nil unless WithRotationStalenessCheck is used.
+	staleness *stalenessChecker
+	// regionalEndpoints is true if the client calls the regional endpoint of
+	// location, which is set once known.
+	regionalEndpoints bool
+	location          string
+
+	// aeads caches the primitives returned by GetAEAD by key name. It is nil
+	// if caching is disabled, as set by primitiveCache, or the client is
+	// closed.
+	mu             sync.Mutex
+	aeads          map[string]*AEAD
+	primitiveCache bool
+	closed         bool
+	// publicKeys caches the public keys of the signers returned by GetSigner.
+	publicKeys *publicKeyCache
+	// keyHandles caches the crypto keys that Autokey key handles resolve to.
+	keyHandles map[string]string
+	// requiredKeyLabels is nil unless WithRequiredKeyLabels is used, and
+	// allowedKeyLocations unless WithAllowedKeyLocations is used. keyChecks
+	// caches the outcome of checking the crypto keys fetched for the labels,
+	// for WithKeyLocationVerification and for WithRequiredRotationPeriod by
+	// crypto key, which is nil or a *KeyPolicyError.
+	requiredKeyLabels       map[string]string
+	allowedKeyLocations     []string
+	keyLocationVerification bool
+	requiredRotationPeriod  time.Duration
+	rotationExemptions      map[string]bool
+	keyChecks               map[string]error
+	// connMonitor is nil unless WithConnectivityCallback is used.
+	connMonitor *connMonitor
+	// credsWatcher is nil unless WithCredentialsFileWatch is used.
+	credsWatcher *credentialsWatcher
 }
 
-var _ registry.KMSClient = (*gcpClient)(nil)
+var _ registry.KMSClient = (*Client)(nil)
+
+// NewClient returns a new GCP KMS client configured with opts to handle keys
+// with uriPrefix prefix, or with one of the prefixes passed with
+// WithAdditionalPrefixes.
+//
+// NewClient refuses to send requests to Cloud KMS without TLS or without
+// authentication unless this is allowed with WithInsecureTransport or
+// WithAllowUnauthenticated, and returns an error wrapping
+// ErrInsecureTransport otherwise. Since NewClient cannot tell whether an HTTP
+// client passed with option.WithHTTPClient adds credentials, such clients
+// also need to be allowed.
+//
+// uriPrefix must have the following format: 'gcp-kms://[:path]'. Prefixes
+// match whole path segments, and trailing slashes are ignored.
+//
+// The bare scheme 'gcp-kms://' makes the client handle all gcp-kms keys, e.g.
+// to serve keys of many projects with a single client registered with
+// registry.RegisterKMSClient. Supported then accepts any well-formed gcp-kms
+// URI, and GetAEAD still requires each URI to name a crypto key or a key
+// handle. Note that such a client uses its credentials for any key URI it is
+// given, including URIs read from keysets, so the credentials should only be
+// granted access to the keys the application is meant to use.
+func NewClient(ctx context.Context, uriPrefix string, opts ...Option) (*Client, error) {
+	if !strings.HasPrefix(strings.ToLower(uriPrefix), gcpPrefix) {
+		return nil, fmt.Errorf("uriPrefix must start with %s", gcpPrefix)
+	}
+	uriPrefix, err := canonicalKeyURI(uriPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uriPrefix: %v", err)
+	}
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.connectivityCallback != nil {
+		cfg.connMonitor = newConnMonitor(cfg.connectivityCallback)
+	}
+	var credsWatcher *credentialsWatcher
+	if cfg.credentialsFile != "" {
+		if credsWatcher, err = newCredentialsWatcher(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := cfg.checkCredentials(); err != nil {
+		return nil, err
+	}
+	prefixes := append([]string{uriPrefix}, cfg.additionalPrefixes...)
+	if cfg.projectCheck {
+		if err := cfg.checkProjectConsistency(ctx, prefixes); err != nil {
+			return nil, err
+		}
+	}
+	apiOpts, reauth, err := cfg.googleAPIClientOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	httpClient, endpoint, err := htransport.NewClient(ctx, apiOpts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkTransportSecurity(endpoint); err != nil {
+		return nil, err
+	}
+	kmsService, err := cloudkms.NewService(ctx, option.WithHTTPClient(httpClient), option.WithEndpoint(endpoint))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		keyURIPrefix:   uriPrefix,
+		keyURIPrefixes: prefixes,
+		kms:            kmsService,
+		httpClient:     httpClient,
+		endpoint:       endpoint,
+		insecure:       cfg.insecure,
+		invoker:        newInvoker(cfg, reauth),
+		timeouts:       cfg.timeouts,
+		keyURIBinding:  cfg.keyURIBinding,
+		inputCopying:   cfg.inputCopying,
+		publicKeys:     newPublicKeyCache(),
+		keyHandles:     make(map[string]string),
+		connMonitor:    cfg.connMonitor,
+		credsWatcher:   credsWatcher,
+
+		regionalEndpoints: cfg.regionalEndpoints,
+		largePayloadDEK:   cfg.largePayloadDEK,
+		requiredKeyLabels: cfg.requiredKeyLabels,
+		keyChecks:         make(map[string]error),
+
+		allowedKeyLocations:     cfg.allowedKeyLocations,
+		keyLocationVerification: cfg.keyLocationVerification,
+		requiredRotationPeriod:  cfg.requiredRotationPeriod,
+		rotationExemptions:      cfg.rotationExemptions,
+	}
+	if name := uriPrefix[len(gcpPrefix):]; cfg.regionalEndpoints && locationOf(name) != "" {
+		if err := c.bindLocation(name); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.decryptDeduplication {
+		c.decrypts = newDecryptGroup()
+	}
+	if cfg.decryptCacheEntries > 0 {
+		c.decryptCache = newDecryptCache(cfg.decryptCacheEntries, cfg.decryptCacheTTL, cfg.clock)
+	}
+	if cfg.dekCacheMessages > 0 {
+		c.dekCache = newDEKCache(cfg.dekCacheMessages, cfg.dekCacheTTL, cfg.offlineMaxStaleness, cfg.clock)
+	}
+	if cfg.stalenessCallback != nil {
+		c.staleness = newStalenessChecker(cfg.stalenessMaxAge, cfg.stalenessCallback, c.fetchCryptoKey, cfg.clock)
+	}
+	if !cfg.disablePrimitiveCache {
+		c.aeads = make(map[string]*AEAD)
+		c.primitiveCache = true
+	}
+	for _, e := range cfg.endpoints {
+		c.endpoints = append(c.endpoints, e.scheme+"://"+e.host+"/")
+	}
+	if cfg.warmup {
+		if err := c.warmup(ctx); err != nil {
+			if cfg.warmupPolicy == WarmupRequired {
+				return nil, err
+			}
+			cfg.logger.Printf("gcpkms: %v", err)
+		}
+	}
+	if c.connMonitor != nil {
+		go c.connMonitor.watch()
+	}
+	if c.credsWatcher != nil {
+		c.credsWatcher.src = reauth
+		go c.credsWatcher.watch()
+	}
+	return c, nil
+}
+
+// warmup establishes the connection to Cloud KMS by fetching the metadata of
+// the resource named by the client's uriPrefix.
+func (c *Client) warmup(ctx context.Context) error {
+	name := c.keyURIPrefix[len(gcpPrefix):]
+	var err error
+	switch strings.Count(name, "/") {
+	case 3:
+		_, err = c.kms.Projects.Locations.Get(name).Context(ctx).Do()
+	case 5:
+		_, err = c.kms.Projects.Locations.KeyRings.Get(name).Context(ctx).Do()
+	case 7:
+		_, err = c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+	default:
+		return fmt.Errorf("connection warm-up requires a uriPrefix naming a location, key ring or crypto key, got %q", c.keyURIPrefix)
+	}
+	if err != nil {
+		return fmt.Errorf("connection warm-up failed: %v", err)
+	}
+	return nil
+}
 
 // NewClientWithOptions returns a new GCP KMS client with provided Google API
 // options to handle keys with uriPrefix prefix.
 // uriPrefix must have the following format: 'gcp-kms://[:path]'.
+// Since opts cannot include WithInsecureTransport or WithAllowUnauthenticated,
+// endpoints without TLS and option.WithoutAuthentication are rejected; use
+// NewClient to allow them.
 func NewClientWithOptions(ctx context.Context, uriPrefix string, opts ...option.ClientOption) (registry.KMSClient, error) {
-	if !strings.HasPrefix(strings.ToLower(uriPrefix), gcpPrefix) {
-		return nil, fmt.Errorf("uriPrefix must start with %s", gcpPrefix)
+	c, err := NewClient(ctx, uriPrefix, WithGoogleAPIClientOptions(opts...))
+	if err != nil {
+		return nil, err
 	}
+	return c, nil
+}
 
-	opts = append(opts, option.WithUserAgent(tinkUserAgent))
-	kmsService, err := cloudkms.NewService(ctx, opts...)
+// Supported true if this client does support keyURI, i.e. if keyURI starts
+// with one of the client's prefixes. The scheme is compared
+// case-insensitively, trailing slashes are ignored and prefixes match whole
+// path segments. Malformed URIs, e.g. with percent-encoded characters or
+// whitespace, are not supported.
+func (c *Client) Supported(keyURI string) bool {
+	keyURI, err := canonicalKeyURI(keyURI)
 	if err != nil {
-		return nil, err
+		return false
 	}
+	for _, prefix := range c.keyURIPrefixes {
+		if hasKeyURIPrefix(keyURI, prefix) {
+			return true
+		}
+	}
+	return false
+}
 
-	return &gcpClient{
-		keyURIPrefix: uriPrefix,
-		kms:          kmsService,
-	}, nil
+// KMSClientWithContext is a registry.KMSClient whose AEADs can also be
+// obtained with a context, which the requests made to look up the key are
+// bound to. Client implements it, so that it can be registered as is once the
+// Tink registry accepts KMS clients with contexts.
+type KMSClientWithContext interface {
+	registry.KMSClient
+	// GetAEADWithContext is like GetAEAD, but the requests made to Cloud
+	// KMS are bound to ctx.
+	GetAEADWithContext(ctx context.Context, keyURI string) (tink.AEAD, error)
 }
 
-// Supported true if this client does support keyURI
-func (c *gcpClient) Supported(keyURI string) bool {
-	return strings.HasPrefix(keyURI, c.keyURIPrefix)
+var _ KMSClientWithContext = (*Client)(nil)
+
+// GetAEAD gets an AEAD backend by keyURI. The returned primitive is an *AEAD.
+// It is GetAEADWithContext with context.Background.
+//
+// keyURI may also name a Cloud KMS Autokey key handle, i.e.
+// 'gcp-kms://projects/*/locations/*/keyHandles/*', which is resolved to the
+// crypto key provisioned for it. If the key has not been provisioned yet,
+// ErrKeyHandleNotProvisioned is returned.
+//
+// With WithRequiredKeyLabels, WithAllowedKeyLocations and
+// WithRequiredRotationPeriod, the labels, the location and the rotation period
+// of the crypto key are checked before the primitive is returned.
+func (c *Client) GetAEAD(keyURI string) (tink.AEAD, error) {
+	return c.GetAEADWithContext(context.Background(), keyURI)
 }
 
-// GetAEAD gets an AEAD backend by keyURI.
-func (c *gcpClient) GetAEAD(keyURI string) (tink.AEAD, error) {
+// GetAEADWithContext is like GetAEAD, but the requests made to look up the
+// key, i.e. to resolve a key handle and to check the labels of the key, are
+// bound to ctx. The returned primitive is not bound to ctx.
+func (c *Client) GetAEADWithContext(ctx context.Context, keyURI string) (tink.AEAD, error) {
+	uri, err := keyNameFromURI(keyURI)
+	if err != nil {
+		return nil, err
+	}
 	if !c.Supported(keyURI) {
 		return nil, errors.New("unsupported keyURI")
 	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, ErrClientClosed
+	}
+	a, ok := c.aeads[uri]
+	c.mu.Unlock()
+	if ok {
+		return a, nil
+	}
+	if err := c.bindLocation(uri); err != nil {
+		return nil, err
+	}
+	if err := c.checkKeyLocation(uri); err != nil {
+		return nil, err
+	}
+
+	keyName := uri
+	if isKeyHandle(uri) {
+		var err error
+		keyName, err = c.resolveKeyHandle(ctx, uri)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := c.checkKeyPolicy(ctx, keyName); err != nil {
+		return nil, err
+	}
 
-	uri := strings.TrimPrefix(keyURI, gcpPrefix)
-	return newGCPAEAD(uri, c.kms), nil
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	if a, ok := c.aeads[uri]; ok {
+		return a, nil
+	}
+	a = newGCPAEAD(keyName, c.kms, c.invoker, c.decrypts, &c.timeouts, c.keyURIBinding)
+	a.largePayloadDEK = c.largePayloadDEK
+	a.cache = c.decryptCache
+	a.deks = c.dekCache
+	a.staleness = c.staleness
+	a.copyInputs = c.inputCopying
+	if c.aeads != nil {
+		c.aeads[uri] = a
+	}
+	return a, nil
+}
+
+// InFlightCalls returns the number of RPCs to Cloud KMS that the primitives
+// of the client currently have in flight, e.g. to export it as a gauge
+// metric. Calls waiting for WithMaxConcurrentCalls are not counted.
+func (c *Client) InFlightCalls() int {
+	return int(c.invoker.inFlight.Load())
+}
+
+// HedgedRequests returns the number of hedged requests that the primitives
+// of the client have issued because of WithHedging, e.g. to export it as a
+// counter metric.
+func (c *Client) HedgedRequests() int64 {
+	return c.invoker.hedges.Load()
+}
+
+// DecryptCacheStats returns the hit and miss counts of the cache of
+// WithDecryptCache, e.g. to export them as counter metrics. They are zero if
+// the cache is disabled.
+func (c *Client) DecryptCacheStats() DecryptCacheStats {
+	if c.decryptCache == nil {
+		return DecryptCacheStats{}
+	}
+	return c.decryptCache.stats()
+}
+
+// DEKCacheStats returns the counters of the cache of WithDEKCache, e.g. to
+// export them as counter metrics. They are zero if the cache is disabled.
+func (c *Client) DEKCacheStats() DEKCacheStats {
+	if c.dekCache == nil {
+		return DEKCacheStats{}
+	}
+	return c.dekCache.stats()
+}
+
+// CredentialsReloadFailures returns the number of times that the client
+// failed to reload the credentials file of WithCredentialsFileWatch after it
+// changed, e.g. to export it as a counter metric.
+func (c *Client) CredentialsReloadFailures() int64 {
+	if c.credsWatcher == nil {
+		return 0
+	}
+	return c.credsWatcher.failures.Load()
+}
+
+// Close releases the primitives cached by the client and cancels the
+// operations of its primitives that are in flight, which then fail with an
+// error matching ErrClientClosed. With WithCloseGracePeriod, Close first
+// waits up to the grace period for them to finish. GetAEAD, GetSigner and
+// the operations of primitives obtained earlier fail with ErrClientClosed
+// after Close has been called.
+//
+// With WithConnectivityCallback, Close reports the transition to SHUTDOWN
+// and stops the goroutine calling the callback. With
+// WithCredentialsFileWatch, it stops watching the credentials file, and with
+// WithDecryptCache and WithDEKCache, it empties the caches. With
+// WithRotationStalenessCheck, it waits for the checks in flight.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.aeads = nil
+	c.mu.Unlock()
+	c.invoker.closer.close()
+	if c.connMonitor != nil {
+		c.connMonitor.close()
+	}
+	if c.credsWatcher != nil {
+		c.credsWatcher.close()
+	}
+	if c.decryptCache != nil {
+		c.decryptCache.purge()
+	}
+	if c.dekCache != nil {
+		c.dekCache.purge()
+	}
+	if c.staleness != nil {
+		c.staleness.close()
+	}
+	return nil
 }
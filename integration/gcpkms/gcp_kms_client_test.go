@@ -17,14 +17,37 @@
 package gcpkms_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
 
 	"google.golang.org/api/option"
 	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
 	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
 )
 
+const (
+	fakeKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	fakeKeyURI  = "gcp-kms://" + fakeKeyName
+)
+
+func newFakeServer(t testing.TB) *fakekms.Server {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateKey(fakeKeyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	return srv
+}
+
 func Example() {
 	const keyURI = "gcp-kms://......"
 	ctx := context.Background()
@@ -58,3 +81,437 @@ func Example() {
 		log.Fatal(err)
 	}
 }
+
+func TestNewClientWithConnectionWarmup(t *testing.T) {
+	srv := newFakeServer(t)
+	for _, tc := range []struct {
+		uriPrefix string
+		rpc       string
+	}{
+		{uriPrefix: fakeKeyURI, rpc: "GetCryptoKey"},
+		{uriPrefix: "gcp-kms://projects/p/locations/global/keyRings/r/", rpc: "GetKeyRing"},
+		{uriPrefix: "gcp-kms://projects/p/locations/global", rpc: "GetLocation"},
+	} {
+		t.Run(tc.uriPrefix, func(t *testing.T) {
+			before := srv.CallCount(tc.rpc)
+			_, err := gcpkms.NewClient(context.Background(), tc.uriPrefix,
+				gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+				gcpkms.WithConnectionWarmup(gcpkms.WarmupRequired))
+			if err != nil {
+				t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+			}
+			if got := srv.CallCount(tc.rpc) - before; got != 1 {
+				t.Errorf("%s called %d times, want 1", tc.rpc, got)
+			}
+		})
+	}
+}
+
+func TestNewClientWithoutConnectionWarmupMakesNoCalls(t *testing.T) {
+	srv := newFakeServer(t)
+	if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()); err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("GetCryptoKey"); got != 0 {
+		t.Errorf("GetCryptoKey called %d times, want 0", got)
+	}
+}
+
+func TestNewClientWithFailingConnectionWarmup(t *testing.T) {
+	srv := newFakeServer(t)
+	for _, uriPrefix := range []string{fakeKeyURI + "-missing", "gcp-kms://"} {
+		t.Run(uriPrefix, func(t *testing.T) {
+			_, err := gcpkms.NewClient(context.Background(), uriPrefix,
+				gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+				gcpkms.WithConnectionWarmup(gcpkms.WarmupRequired))
+			if err == nil {
+				t.Error("gcpkms.NewClient() with WarmupRequired err = nil, want error")
+			}
+
+			buf := &bytes.Buffer{}
+			c, err := gcpkms.NewClient(context.Background(), uriPrefix,
+				gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+				gcpkms.WithConnectionWarmup(gcpkms.WarmupBestEffort),
+				gcpkms.WithLogger(log.New(buf, "", 0)))
+			if err != nil {
+				t.Fatalf("gcpkms.NewClient() with WarmupBestEffort err = %v, want nil", err)
+			}
+			if c == nil {
+				t.Error("gcpkms.NewClient() = nil, want client")
+			}
+			if !strings.Contains(buf.String(), "warm-up") {
+				t.Errorf("log = %q, want warm-up warning", buf.String())
+			}
+		})
+	}
+}
+
+func TestNewClientWithCanceledContextFailsRequiredWarmup(t *testing.T) {
+	srv := newFakeServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := gcpkms.NewClient(ctx, fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithConnectionWarmup(gcpkms.WarmupRequired)); err == nil {
+		t.Error("gcpkms.NewClient() err = nil, want error")
+	}
+}
+
+func TestGetAEADReturnsCachedPrimitive(t *testing.T) {
+	srv := newFakeServer(t)
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a1, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	a2, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if a1 != a2 {
+		t.Error("client.GetAEAD() returned different primitives for the same key")
+	}
+	other, err := client.GetAEAD(fakeKeyURI + "2")
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if other == a1 {
+		t.Error("client.GetAEAD() returned the same primitive for different keys")
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("client.Close() err = %v, want nil", err)
+	}
+	if _, err := client.GetAEAD(fakeKeyURI); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("client.GetAEAD() after Close err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+	if _, err := a1.Encrypt([]byte("plaintext"), nil); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("a1.Encrypt() after Close err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+}
+
+func TestGetAEADWithoutPrimitiveCache(t *testing.T) {
+	srv := newFakeServer(t)
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithoutPrimitiveCache())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a1, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	a2, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if a1 == a2 {
+		t.Error("client.GetAEAD() returned the same primitive with caching disabled")
+	}
+}
+
+func TestClientWithAdditionalPrefixes(t *testing.T) {
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	const (
+		keyNameA = "projects/a/locations/global/keyRings/r/cryptoKeys/k"
+		keyNameB = "projects/b/locations/global/keyRings/r/cryptoKeys/k"
+	)
+	for _, name := range []string{keyNameA, keyNameB} {
+		if err := srv.CreateKey(name); err != nil {
+			t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+		}
+	}
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://projects/a/",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithAdditionalPrefixes("gcp-kms://projects/b/", "GCP-KMS://projects/a/locations/global/"))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+
+	for _, tc := range []struct {
+		keyURI string
+		want   bool
+	}{
+		{keyURI: "gcp-kms://" + keyNameA, want: true},
+		{keyURI: "gcp-kms://" + keyNameB, want: true},
+		{keyURI: "GCP-KMS://" + keyNameB, want: true},
+		{keyURI: "gcp-kms://projects/c/locations/global/keyRings/r/cryptoKeys/k", want: false},
+		{keyURI: "gcp-kms://projects/bb/locations/global/keyRings/r/cryptoKeys/k", want: false},
+		{keyURI: "aws-kms://projects/a/locations/global/keyRings/r/cryptoKeys/k", want: false},
+	} {
+		if got := client.Supported(tc.keyURI); got != tc.want {
+			t.Errorf("client.Supported(%q) = %v, want %v", tc.keyURI, got, tc.want)
+		}
+		if _, err := client.GetAEAD(tc.keyURI); (err == nil) != tc.want {
+			t.Errorf("client.GetAEAD(%q) err = %v, want error: %v", tc.keyURI, err, !tc.want)
+		}
+	}
+
+	// Key URIs under a supported prefix must still name a crypto key.
+	if _, err := client.GetAEAD("gcp-kms://projects/b/locations/global/keyRings/r"); err == nil {
+		t.Error("client.GetAEAD() of a key ring err = nil, want error")
+	}
+
+	registry.RegisterKMSClient(client)
+	t.Cleanup(registry.ClearKMSClients)
+	for _, name := range []string{keyNameA, keyNameB} {
+		keyURI := "gcp-kms://" + name
+		kmsClient, err := registry.GetKMSClient(keyURI)
+		if err != nil {
+			t.Fatalf("registry.GetKMSClient(%q) err = %v, want nil", keyURI, err)
+		}
+		if kmsClient != client {
+			t.Errorf("registry.GetKMSClient(%q) returned another client", keyURI)
+		}
+		a, err := kmsClient.GetAEAD(keyURI)
+		if err != nil {
+			t.Fatalf("kmsClient.GetAEAD(%q) err = %v, want nil", keyURI, err)
+		}
+		ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+		if err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+		if _, err := a.Decrypt(ciphertext, nil); err != nil {
+			t.Errorf("a.Decrypt() err = %v, want nil", err)
+		}
+	}
+}
+
+func TestClientWithCatchAllPrefix(t *testing.T) {
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	const (
+		keyNameA = "projects/a/locations/global/keyRings/r/cryptoKeys/k"
+		keyNameB = "projects/b/locations/europe-west3/keyRings/r/cryptoKeys/k"
+	)
+	for _, name := range []string{keyNameA, keyNameB} {
+		if err := srv.CreateKey(name); err != nil {
+			t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+		}
+	}
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+
+	for _, tc := range []struct {
+		keyURI string
+		want   bool
+	}{
+		{keyURI: "gcp-kms://" + keyNameA, want: true},
+		{keyURI: "GCP-KMS://" + keyNameB, want: true},
+		{keyURI: "gcp-kms://projects/c/locations/global/keyRings/r", want: true},
+		{keyURI: "gcp-kms://projects/c%2F", want: false},
+		{keyURI: "aws-kms://arn:aws:kms:us-east-1:123456789012:key/k", want: false},
+	} {
+		if got := client.Supported(tc.keyURI); got != tc.want {
+			t.Errorf("client.Supported(%q) = %v, want %v", tc.keyURI, got, tc.want)
+		}
+	}
+	// The catch-all prefix does not relax the validation of key names.
+	for _, keyURI := range []string{
+		"gcp-kms://projects/c/locations/global/keyRings/r",
+		"gcp-kms://projects/c",
+		"gcp-kms://",
+	} {
+		if _, err := client.GetAEAD(keyURI); err == nil {
+			t.Errorf("client.GetAEAD(%q) err = nil, want error", keyURI)
+		}
+	}
+
+	registry.RegisterKMSClient(client)
+	t.Cleanup(registry.ClearKMSClients)
+	for _, name := range []string{keyNameA, keyNameB} {
+		keyURI := "gcp-kms://" + name
+		kmsClient, err := registry.GetKMSClient(keyURI)
+		if err != nil {
+			t.Fatalf("registry.GetKMSClient(%q) err = %v, want nil", keyURI, err)
+		}
+		if kmsClient != client {
+			t.Errorf("registry.GetKMSClient(%q) returned another client", keyURI)
+		}
+		a, err := kmsClient.GetAEAD(keyURI)
+		if err != nil {
+			t.Fatalf("kmsClient.GetAEAD(%q) err = %v, want nil", keyURI, err)
+		}
+		ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+		if err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+		if _, err := a.Decrypt(ciphertext, nil); err != nil {
+			t.Errorf("a.Decrypt() err = %v, want nil", err)
+		}
+	}
+	if got := srv.CallCount("Encrypt"); got != 2 {
+		t.Errorf("Encrypt called %d times, want 2", got)
+	}
+}
+
+func TestWithAdditionalPrefixesRejectsInvalidPrefixes(t *testing.T) {
+	if _, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithAdditionalPrefixes("aws-kms://")); err == nil {
+		t.Error("gcpkms.NewClient() err = nil, want error")
+	}
+}
+
+func TestClientCanonicalizesKeyURIs(t *testing.T) {
+	srv := newFakeServer(t)
+	client, err := gcpkms.NewClient(context.Background(), "GCP-KMS://projects/p/locations/global/keyRings/r/",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	want, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD(%q) err = %v, want nil", fakeKeyURI, err)
+	}
+
+	for _, keyURI := range []string{
+		fakeKeyURI,
+		"GCP-KMS://" + fakeKeyName,
+		"Gcp-Kms://" + fakeKeyName,
+		fakeKeyURI + "/",
+		fakeKeyURI + "///",
+	} {
+		if !client.Supported(keyURI) {
+			t.Errorf("client.Supported(%q) = false, want true", keyURI)
+		}
+		got, err := client.GetAEAD(keyURI)
+		if err != nil {
+			t.Errorf("client.GetAEAD(%q) err = %v, want nil", keyURI, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("client.GetAEAD(%q) returned a different primitive than for %q", keyURI, fakeKeyURI)
+		}
+	}
+
+	// Spellings that name another key, or that are malformed, must not be
+	// mistaken for fakeKeyURI.
+	for _, tc := range []struct {
+		keyURI    string
+		supported bool
+	}{
+		{keyURI: "gcp-kms://projects/P/locations/global/keyRings/r/cryptoKeys/k"},
+		{keyURI: "gcp-kms://projects/p/locations/global/keyRings/rr/cryptoKeys/k"},
+		{keyURI: fakeKeyURI + "2", supported: true},
+		{keyURI: "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys%2Fk"},
+		{keyURI: "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/%6B"},
+		{keyURI: fakeKeyURI + " "},
+		{keyURI: fakeKeyURI + "\n"},
+		{keyURI: fakeKeyURI + "/ "},
+		{keyURI: "gcp-kms:// " + fakeKeyName},
+		{keyURI: "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k\tk"},
+		{keyURI: "gcp-kms:///" + fakeKeyName},
+		{keyURI: "gcp-kms://projects/p/locations/global/keyRings/r//cryptoKeys/k"},
+		{keyURI: "gcp-kms:/" + fakeKeyName},
+	} {
+		if got := client.Supported(tc.keyURI); got != tc.supported {
+			t.Errorf("client.Supported(%q) = %v, want %v", tc.keyURI, got, tc.supported)
+		}
+		got, err := client.GetAEAD(tc.keyURI)
+		if tc.supported {
+			if err != nil {
+				t.Errorf("client.GetAEAD(%q) err = %v, want nil", tc.keyURI, err)
+			} else if got == want {
+				t.Errorf("client.GetAEAD(%q) returned the primitive of %q", tc.keyURI, fakeKeyURI)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("client.GetAEAD(%q) err = nil, want error", tc.keyURI)
+		}
+	}
+}
+
+func TestNewClientRejectsMalformedPrefixes(t *testing.T) {
+	for _, uriPrefix := range []string{
+		"gcp-kms://projects/p%2F",
+		"gcp-kms://projects/p /",
+		"gcp-kms://projects//locations/global",
+		"gcp-kms:projects/p",
+	} {
+		if _, err := gcpkms.NewClient(context.Background(), uriPrefix, gcpkms.WithInsecureTransport()); err == nil {
+			t.Errorf("gcpkms.NewClient(%q) err = nil, want error", uriPrefix)
+		}
+		if _, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+			gcpkms.WithInsecureTransport(), gcpkms.WithAdditionalPrefixes(uriPrefix)); err == nil {
+			t.Errorf("gcpkms.NewClient() with additional prefix %q err = nil, want error", uriPrefix)
+		}
+	}
+}
+
+type clientTestContextKey struct{}
+
+// contextTransport records the value of clientTestContextKey in the context
+// of each request, by path.
+type contextTransport struct {
+	mu     sync.Mutex
+	values map[string]any
+}
+
+func (t *contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.values[req.URL.Path] = req.Context().Value(clientTestContextKey{})
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestGetAEADWithContextPropagatesContext(t *testing.T) {
+	const (
+		handle      = "projects/p/locations/global/keyHandles/h"
+		otherHandle = "projects/p/locations/global/keyHandles/other"
+	)
+	srv := newFakeServer(t)
+	srv.CreateKeyHandle(handle, fakeKeyName)
+	srv.CreateKeyHandle(otherHandle, fakeKeyName)
+	if err := srv.SetLabels(fakeKeyName, map[string]string{"env": "prod"}); err != nil {
+		t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+	}
+	trans := &contextTransport{values: make(map[string]any)}
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://", gcpkms.WithGoogleAPIClientOptions(
+		option.WithEndpoint(srv.URL()+"/"),
+		option.WithHTTPClient(&http.Client{Transport: trans}),
+	), gcpkms.WithInsecureTransport(), gcpkms.WithRequiredKeyLabels(map[string]string{"env": "prod"}))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	var _ registry.KMSClient = client
+	var kmsClient gcpkms.KMSClientWithContext = client
+
+	ctx := context.WithValue(context.Background(), clientTestContextKey{}, "value")
+	a, err := kmsClient.GetAEADWithContext(ctx, "gcp-kms://"+handle)
+	if err != nil {
+		t.Fatalf("client.GetAEADWithContext() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	for _, path := range []string{"/v1/" + handle, "/v1/" + fakeKeyName} {
+		v, ok := trans.values[path]
+		if !ok {
+			t.Errorf("no request for %s", path)
+			continue
+		}
+		if v != "value" {
+			t.Errorf("request for %s has context value %v, want %q", path, v, "value")
+		}
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetAEADWithContext(canceled, "gcp-kms://"+otherHandle); !errors.Is(err, context.Canceled) {
+		t.Errorf("client.GetAEADWithContext() with canceled context err = %v, want %v", err, context.Canceled)
+	}
+	// GetAEAD is not bound to the canceled context.
+	if _, err := client.GetAEAD("gcp-kms://" + otherHandle); err != nil {
+		t.Errorf("client.GetAEAD() err = %v, want nil", err)
+	}
+}
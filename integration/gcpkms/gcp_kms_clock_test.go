@@ -0,0 +1,222 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock whose time only moves when Advance or Sleep is
+// called. Sleep records the duration, advances the clock by it and returns at
+// once, so that backoffs neither slow down tests nor need another goroutine
+// to move time forward.
+type fakeClock struct {
+	mu sync.Mutex
+	// changed is signaled when a timer is armed.
+	changed *sync.Cond
+	now     time.Time
+	timers  []*fakeTimer
+	sleeps  []time.Duration
+}
+
+// newFakeClock returns a fake clock that starts at the current real time, so
+// that the deadlines of contexts, which are set on the real clock, keep their
+// meaning until the fake clock is moved.
+func newFakeClock() *fakeClock {
+	c := &fakeClock{now: time.Now()}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, d time.Duration) error {
+	c.mu.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.Advance(d)
+	return nil
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d, and fires the timers that are due.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	active := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			active = append(active, t)
+			continue
+		}
+		t.fire(c.now)
+	}
+	c.timers = active
+}
+
+// Sleeps returns the durations passed to Sleep so far.
+func (c *fakeClock) Sleeps() []time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]time.Duration(nil), c.sleeps...)
+}
+
+// BlockUntil waits until n timers are armed, e.g. until a goroutine under
+// test waits for its next poll, so that a following Advance fires them.
+func (c *fakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.timers) < n {
+		c.changed.Wait()
+	}
+}
+
+type fakeTimer struct {
+	clock *fakeClock
+	c     chan time.Time
+	// when is the time at which the timer fires, if armed. It is guarded by
+	// clock.mu.
+	when time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+// fire sends now on the channel of t, unless a value is pending already.
+// t.clock.mu must be held.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.c <- now:
+	default:
+	}
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	return t.disarm()
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	armed := t.disarm()
+	if d <= 0 {
+		t.fire(c.now)
+		return armed
+	}
+	t.when = c.now.Add(d)
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return armed
+}
+
+// disarm removes t from the armed timers, and reports whether it was armed.
+// t.clock.mu must be held.
+func (t *fakeTimer) disarm() bool {
+	c := t.clock
+	for i, armed := range c.timers {
+		if armed == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestFakeClockTimers(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	t1 := c.NewTimer(time.Second)
+	t2 := c.NewTimer(2 * time.Second)
+	c.Advance(time.Second)
+	select {
+	case got := <-t1.C():
+		if want := start.Add(time.Second); !got.Equal(want) {
+			t.Errorf("<-t1.C() = %v, want %v", got, want)
+		}
+	default:
+		t.Error("t1 did not fire after 1s")
+	}
+	if !t2.Stop() {
+		t.Error("t2.Stop() = false, want true")
+	}
+	c.Advance(time.Hour)
+	select {
+	case <-t2.C():
+		t.Error("t2 fired after Stop")
+	default:
+	}
+	t1.Reset(time.Minute)
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	select {
+	case <-t1.C():
+	default:
+		t.Error("t1 did not fire after Reset")
+	}
+}
+
+func TestFakeClockSleepAdvances(t *testing.T) {
+	c := newFakeClock()
+	start := c.Now()
+	timer := c.NewTimer(time.Second)
+	if err := c.Sleep(context.Background(), 3*time.Second); err != nil {
+		t.Fatalf("c.Sleep() err = %v, want nil", err)
+	}
+	if got, want := c.Now(), start.Add(3*time.Second); !got.Equal(want) {
+		t.Errorf("c.Now() = %v, want %v", got, want)
+	}
+	select {
+	case <-timer.C():
+	default:
+		t.Error("timer did not fire during Sleep")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Sleep(ctx, time.Second); err != context.Canceled {
+		t.Errorf("c.Sleep() err = %v, want %v", err, context.Canceled)
+	}
+	if got, want := c.Sleeps(), []time.Duration{3 * time.Second, time.Second}; !reflect.DeepEqual(got, want) {
+		t.Errorf("c.Sleeps() = %v, want %v", got, want)
+	}
+}
+
+func TestRealClockSleepRespectsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := (realClock{}).Sleep(ctx, time.Hour); err != context.Canceled {
+		t.Errorf("realClock{}.Sleep() err = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// closer tracks the operations of the primitives of a Client, so that Close
+// can reject new operations and cancel the ones in flight.
+type closer struct {
+	// root is canceled with ErrClientClosed once the operations in flight
+	// should be abandoned.
+	root        context.Context
+	cancel      context.CancelCauseFunc
+	gracePeriod time.Duration
+	clock       clock
+
+	mu       sync.Mutex
+	closed   bool
+	inFlight int
+	// idle is closed when the last operation in flight after close finishes.
+	idle chan struct{}
+}
+
+func newCloser(gracePeriod time.Duration, clk clock) *closer {
+	root, cancel := context.WithCancelCause(context.Background())
+	return &closer{root: root, cancel: cancel, gracePeriod: gracePeriod, clock: clk, idle: make(chan struct{})}
+}
+
+// begin starts an operation bound to ctx. It returns a context that is also
+// canceled when close abandons the operations in flight, and end, which must
+// be called with the result of the operation once it finishes and returns the
+// error to report. Errors of abandoned operations match ErrClientClosed.
+//
+// begin fails with ErrClientClosed after close has been called. If c is nil,
+// operations are only bound to ctx.
+func (c *closer) begin(ctx context.Context) (context.Context, func(err error) error, error) {
+	if c == nil {
+		return ctx, func(err error) error { return err }, nil
+	}
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil, nil, ErrClientClosed
+	}
+	c.inFlight++
+	c.mu.Unlock()
+
+	opCtx, cancel := context.WithCancelCause(ctx)
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-c.root.Done():
+			cancel(ErrClientClosed)
+		case <-stop:
+		}
+	}()
+	end := func(err error) error {
+		close(stop)
+		abandoned := context.Cause(opCtx) == ErrClientClosed
+		cancel(nil)
+		c.end()
+		if err != nil && abandoned {
+			return fmt.Errorf("%w: %w", ErrClientClosed, err)
+		}
+		return err
+	}
+	return opCtx, end, nil
+}
+
+func (c *closer) end() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight--
+	if c.closed && c.inFlight == 0 {
+		close(c.idle)
+	}
+}
+
+// close makes begin fail from now on, waits up to the grace period for the
+// operations in flight to finish, and cancels the ones that have not. Calls
+// after the first return at once.
+func (c *closer) close() {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	idle := c.inFlight == 0
+	c.mu.Unlock()
+	if !idle && c.gracePeriod > 0 {
+		t := c.clock.NewTimer(c.gracePeriod)
+		defer t.Stop()
+		select {
+		case <-c.idle:
+		case <-t.C():
+		}
+	}
+	c.cancel(ErrClientClosed)
+}
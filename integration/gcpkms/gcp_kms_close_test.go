@@ -0,0 +1,222 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// hangingTransport holds requests whose path ends with suffix until they are
+// canceled or release is closed, and reports each of them on started.
+type hangingTransport struct {
+	suffix  string
+	started chan struct{}
+	release chan struct{}
+}
+
+func newHangingTransport(suffix string) *hangingTransport {
+	return &hangingTransport{suffix: suffix, started: make(chan struct{}, 10), release: make(chan struct{})}
+}
+
+func (t *hangingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, t.suffix) {
+		t.started <- struct{}{}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-t.release:
+		}
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// waitForRequest waits until trans holds a request.
+func waitForRequest(t *testing.T, trans *hangingTransport) {
+	t.Helper()
+	select {
+	case <-trans.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the request did not reach the server")
+	}
+}
+
+// newHangingClient returns a client for a fake server holding fakeKeyName,
+// whose Encrypt requests are held by the returned transport.
+func newHangingClient(t *testing.T, opts ...gcpkms.Option) (*gcpkms.Client, *hangingTransport) {
+	t.Helper()
+	srv := newFakeServer(t)
+	trans := newHangingTransport(":encrypt")
+	opts = append([]gcpkms.Option{
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithBaseTransport(trans),
+	}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	return client, trans
+}
+
+func TestCloseCancelsInFlightCalls(t *testing.T) {
+	client, trans := newHangingClient(t)
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		_, err := a.Encrypt([]byte("plaintext"), nil)
+		errs <- err
+	}()
+	waitForRequest(t, trans)
+	if err := client.Close(); err != nil {
+		t.Fatalf("client.Close() err = %v, want nil", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, gcpkms.ErrClientClosed) {
+			t.Errorf("a.Encrypt() err = %v, want %v", err, gcpkms.ErrClientClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("a.Encrypt() was not released by client.Close()")
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("a.Encrypt() after Close err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+}
+
+func TestCloseCancelsInFlightSignatures(t *testing.T) {
+	srv, _ := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	trans := newHangingTransport(":asymmetricSign")
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithBaseTransport(trans))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	s, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1))
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	errs := make(chan error, 1)
+	go func() {
+		_, err := s.Sign(nil, digest[:], s.SignerOpts())
+		errs <- err
+	}()
+	waitForRequest(t, trans)
+	client.Close()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, gcpkms.ErrClientClosed) {
+			t.Errorf("s.Sign() err = %v, want %v", err, gcpkms.ErrClientClosed)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("s.Sign() was not released by client.Close()")
+	}
+	if _, err := s.Sign(nil, digest[:], s.SignerOpts()); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("s.Sign() after Close err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+}
+
+// closeInBackground calls client.Close on a new goroutine, and returns a
+// channel that is closed when it returns.
+func closeInBackground(client *gcpkms.Client) <-chan struct{} {
+	closed := make(chan struct{})
+	go func() {
+		client.Close()
+		close(closed)
+	}()
+	return closed
+}
+
+func TestWithCloseGracePeriod(t *testing.T) {
+	const gracePeriod = 5 * time.Second
+	t.Run("operation finishes", func(t *testing.T) {
+		clock := gcpkms.NewFakeClock()
+		client, trans := newHangingClient(t, gcpkms.WithCloseGracePeriod(gracePeriod), gcpkms.WithClock(clock))
+		a, err := client.GetAEAD(fakeKeyURI)
+		if err != nil {
+			t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+		}
+		errs := make(chan error, 1)
+		go func() {
+			_, err := a.Encrypt([]byte("plaintext"), nil)
+			errs <- err
+		}()
+		waitForRequest(t, trans)
+		closed := closeInBackground(client)
+		// Close waits for the grace period, which does not elapse.
+		clock.BlockUntil(1)
+		close(trans.release)
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("client.Close() did not return once the operation finished")
+		}
+		if err := <-errs; err != nil {
+			t.Errorf("a.Encrypt() err = %v, want nil", err)
+		}
+	})
+	t.Run("grace period elapses", func(t *testing.T) {
+		clock := gcpkms.NewFakeClock()
+		client, trans := newHangingClient(t, gcpkms.WithCloseGracePeriod(gracePeriod), gcpkms.WithClock(clock))
+		a, err := client.GetAEAD(fakeKeyURI)
+		if err != nil {
+			t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+		}
+		errs := make(chan error, 1)
+		go func() {
+			_, err := a.Encrypt([]byte("plaintext"), nil)
+			errs <- err
+		}()
+		waitForRequest(t, trans)
+		closed := closeInBackground(client)
+		clock.BlockUntil(1)
+		clock.Advance(gracePeriod - time.Millisecond)
+		select {
+		case <-closed:
+			t.Fatal("client.Close() returned before the grace period elapsed")
+		default:
+		}
+		clock.Advance(time.Millisecond)
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("client.Close() did not return once the grace period elapsed")
+		}
+		if err := <-errs; !errors.Is(err, gcpkms.ErrClientClosed) {
+			t.Errorf("a.Encrypt() err = %v, want %v", err, gcpkms.ErrClientClosed)
+		}
+	})
+}
+
+func TestWithCloseGracePeriodRejectsInvalidDurations(t *testing.T) {
+	for _, d := range []time.Duration{0, -time.Second} {
+		if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithCloseGracePeriod(d)); err == nil {
+			t.Errorf("gcpkms.NewClient() with WithCloseGracePeriod(%v) err = nil, want error", d)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+var (
+	oidData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidRSAEncryption = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidMGF1          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 8}
+	oidRSASSAPSS     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}
+
+	oidDigestAlgorithms = map[crypto.Hash]asn1.ObjectIdentifier{
+		crypto.SHA256: {2, 16, 840, 1, 101, 3, 4, 2, 1},
+		crypto.SHA384: {2, 16, 840, 1, 101, 3, 4, 2, 2},
+		crypto.SHA512: {2, 16, 840, 1, 101, 3, 4, 2, 3},
+	}
+	oidECDSAAlgorithms = map[crypto.Hash]asn1.ObjectIdentifier{
+		crypto.SHA256: {1, 2, 840, 10045, 4, 3, 2},
+		crypto.SHA384: {1, 2, 840, 10045, 4, 3, 3},
+		crypto.SHA512: {1, 2, 840, 10045, 4, 3, 4},
+	}
+)
+
+// The following types are the ASN.1 structures of RFC 5652 and RFC 4055 that
+// are needed to encode a detached SignedData.
+
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	// Content is the [0] EXPLICIT content.
+	Content asn1.RawValue
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	EncapContentInfo encapsulatedContentInfo
+	// Certificates is the [0] IMPLICIT SET OF Certificate.
+	Certificates asn1.RawValue
+	SignerInfos  []signerInfo `asn1:"set"`
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+}
+
+type signerInfo struct {
+	Version         int
+	SID             issuerAndSerialNumber
+	DigestAlgorithm pkix.AlgorithmIdentifier
+	// SignedAttrs is the [0] IMPLICIT SET OF Attribute.
+	SignedAttrs        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type attribute struct {
+	Type asn1.ObjectIdentifier
+	// Values is the SET OF AttributeValue.
+	Values asn1.RawValue
+}
+
+type pssParameters struct {
+	Hash       pkix.AlgorithmIdentifier `asn1:"explicit,tag:0"`
+	MGF        pkix.AlgorithmIdentifier `asn1:"explicit,tag:1"`
+	SaltLength int                      `asn1:"explicit,tag:2"`
+}
+
+// SignCMSDetached returns a DER encoded CMS (RFC 5652) SignedData holding a
+// detached signature of content, created with the Cloud KMS asymmetric
+// signing key version with the given resource name, e.g.
+// "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+//
+// The signature covers the content type and message digest signed
+// attributes. signerCert must certify the public key of the key version;
+// it and chain are included in the SignedData. RSA PKCS #1 v1.5, RSA-PSS and
+// ECDSA keys are supported, and content is hashed with the hash function of
+// the key's algorithm; Ed25519 keys are rejected. All requests are bound to
+// ctx.
+func SignCMSDetached(ctx context.Context, content io.Reader, signerCert *x509.Certificate, chain []*x509.Certificate, keyName string, kms *cloudkms.Service) ([]byte, error) {
+	if signerCert == nil {
+		return nil, errors.New("signerCert must not be nil")
+	}
+	s, err := newSigner(ctx, keyName, kms, nil, callTimeouts{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	if pub, ok := signerCert.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(s.Public()) {
+		return nil, fmt.Errorf("signerCert does not certify the public key of %s", keyName)
+	}
+	alg := s.publicKey().alg
+	if alg.ed25519 {
+		return nil, fmt.Errorf("algorithm %s is not supported in CMS", s.publicKey().algorithm)
+	}
+
+	h := alg.hash.New()
+	if _, err := io.Copy(h, content); err != nil {
+		return nil, fmt.Errorf("reading content failed: %v", err)
+	}
+	attrs, err := signedAttributes(h.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	// The signature covers the DER encoding of the attributes with a SET tag,
+	// not the implicit tag they have in SignerInfo.
+	toSign, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: attrs})
+	if err != nil {
+		return nil, err
+	}
+	h = alg.hash.New()
+	h.Write(toSign)
+	var opts crypto.SignerOpts = alg.hash
+	if alg.pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.hash}
+	}
+	signature, err := s.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return nil, err
+	}
+	sigAlg, err := signatureAlgorithm(alg)
+	if err != nil {
+		return nil, err
+	}
+
+	digestAlg := pkix.AlgorithmIdentifier{Algorithm: oidDigestAlgorithms[alg.hash]}
+	var certs [][]byte
+	for _, c := range append([]*x509.Certificate{signerCert}, chain...) {
+		certs = append(certs, c.Raw)
+	}
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{digestAlg},
+		EncapContentInfo: encapsulatedContentInfo{EContentType: oidData},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: derSetOf(certs)},
+		SignerInfos: []signerInfo{{
+			Version: 1,
+			SID: issuerAndSerialNumber{
+				Issuer:       asn1.RawValue{FullBytes: signerCert.RawIssuer},
+				SerialNumber: signerCert.SerialNumber,
+			},
+			DigestAlgorithm:    digestAlg,
+			SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: attrs},
+			SignatureAlgorithm: sigAlg,
+			Signature:          signature,
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(contentInfo{
+		ContentType: oidSignedData,
+		Content:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd},
+	})
+}
+
+// signedAttributes returns the content of the DER encoded SET OF Attribute
+// with the content type and message digest attributes.
+func signedAttributes(digest []byte) ([]byte, error) {
+	contentType, err := asn1.Marshal(oidData)
+	if err != nil {
+		return nil, err
+	}
+	messageDigest, err := asn1.Marshal(digest)
+	if err != nil {
+		return nil, err
+	}
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value []byte
+	}{
+		{oidContentType, contentType},
+		{oidMessageDigest, messageDigest},
+	} {
+		encoded, err := asn1.Marshal(attribute{
+			Type:   a.oid,
+			Values: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: a.value},
+		})
+		if err != nil {
+			return nil, err
+		}
+		attrs = append(attrs, encoded)
+	}
+	return derSetOf(attrs), nil
+}
+
+// derSetOf returns the content of a DER encoded SET OF with the given encoded
+// elements, which DER requires to be sorted.
+func derSetOf(elements [][]byte) []byte {
+	sorted := append([][]byte(nil), elements...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i], sorted[j]) < 0
+	})
+	return bytes.Join(sorted, nil)
+}
+
+// signatureAlgorithm returns the identifier of the signature algorithm of alg
+// in SignerInfo.
+func signatureAlgorithm(alg signAlgorithm) (pkix.AlgorithmIdentifier, error) {
+	switch {
+	case alg.curve != nil:
+		return pkix.AlgorithmIdentifier{Algorithm: oidECDSAAlgorithms[alg.hash]}, nil
+	case !alg.pss:
+		return pkix.AlgorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1.NullRawValue}, nil
+	}
+	hashAlg := pkix.AlgorithmIdentifier{Algorithm: oidDigestAlgorithms[alg.hash], Parameters: asn1.NullRawValue}
+	mgfParams, err := asn1.Marshal(hashAlg)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	params, err := asn1.Marshal(pssParameters{
+		Hash:       hashAlg,
+		MGF:        pkix.AlgorithmIdentifier{Algorithm: oidMGF1, Parameters: asn1.RawValue{FullBytes: mgfParams}},
+		SaltLength: alg.hash.Size(),
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidRSASSAPSS, Parameters: asn1.RawValue{FullBytes: params}}, nil
+}
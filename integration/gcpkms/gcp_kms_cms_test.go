@@ -0,0 +1,175 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// kmsPublicKey returns the public key of the given key version.
+func kmsPublicKey(t *testing.T, kms *cloudkms.Service, version string) crypto.PublicKey {
+	t.Helper()
+	resp, err := kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.GetPublicKey(version).Do()
+	if err != nil {
+		t.Fatalf("GetPublicKey() err = %v, want nil", err)
+	}
+	block, _ := pem.Decode([]byte(resp.Pem))
+	if block == nil {
+		t.Fatal("pem.Decode() = nil, want PEM block")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("x509.ParsePKIXPublicKey() err = %v, want nil", err)
+	}
+	return pub
+}
+
+// newCertificates returns a CA certificate and a certificate for pub issued by
+// it, with the given extended key usage.
+func newCertificates(t *testing.T, pub crypto.PublicKey, extKeyUsage x509.ExtKeyUsage, dnsNames ...string) (ca, leaf *x509.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() err = %v, want nil", err)
+	}
+	notBefore := time.Now().Add(-time.Hour)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             notBefore,
+		NotAfter:              notBefore.Add(24 * time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() err = %v, want nil", err)
+	}
+	ca, err = x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() err = %v, want nil", err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "Test signer"},
+		DNSNames:     dnsNames,
+		NotBefore:    notBefore,
+		NotAfter:     notBefore.Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, pub, caKey)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() err = %v, want nil", err)
+	}
+	leaf, err = x509.ParseCertificate(leafDER)
+	if err != nil {
+		t.Fatalf("x509.ParseCertificate() err = %v, want nil", err)
+	}
+	return ca, leaf
+}
+
+// opensslVerifyCMS verifies a detached CMS signature of content with
+// openssl, and returns its output and error.
+func opensslVerifyCMS(t *testing.T, openssl string, signature, content []byte, ca *x509.Certificate) ([]byte, error) {
+	t.Helper()
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"signature.der": signature,
+		"content":       content,
+		"ca.pem":        pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0600); err != nil {
+			t.Fatalf("os.WriteFile() err = %v, want nil", err)
+		}
+	}
+	cmd := exec.Command(openssl, "cms", "-verify", "-binary", "-inform", "DER",
+		"-in", filepath.Join(dir, "signature.der"),
+		"-content", filepath.Join(dir, "content"),
+		"-CAfile", filepath.Join(dir, "ca.pem"),
+		"-purpose", "any", "-out", os.DevNull)
+	return cmd.CombinedOutput()
+}
+
+func TestSignCMSDetachedVerifiesWithOpenSSL(t *testing.T) {
+	openssl, err := exec.LookPath("openssl")
+	if err != nil {
+		t.Skip("openssl not found")
+	}
+	for _, algorithm := range []string{
+		"EC_SIGN_P256_SHA256",
+		"EC_SIGN_P384_SHA384",
+		"RSA_SIGN_PKCS1_2048_SHA256",
+		"RSA_SIGN_PSS_2048_SHA256",
+	} {
+		t.Run(algorithm, func(t *testing.T) {
+			_, kms := newFakeSigningKey(t, algorithm)
+			ca, leaf := newCertificates(t, kmsPublicKey(t, kms, versionName(1)), x509.ExtKeyUsageAny)
+			content := []byte("delivered file")
+
+			signature, err := gcpkms.SignCMSDetached(context.Background(), bytes.NewReader(content), leaf, []*x509.Certificate{ca}, versionName(1), kms)
+			if err != nil {
+				t.Fatalf("gcpkms.SignCMSDetached() err = %v, want nil", err)
+			}
+			if out, err := opensslVerifyCMS(t, openssl, signature, content, ca); err != nil {
+				t.Errorf("openssl cms -verify err = %v, want nil; output:\n%s", err, out)
+			}
+			if _, err := opensslVerifyCMS(t, openssl, signature, []byte("tampered file"), ca); err == nil {
+				t.Error("openssl cms -verify of tampered content err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSignCMSDetachedRejectsMismatchedCertificate(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() err = %v, want nil", err)
+	}
+	_, leaf := newCertificates(t, otherKey.Public(), x509.ExtKeyUsageAny)
+	if _, err := gcpkms.SignCMSDetached(context.Background(), bytes.NewReader([]byte("content")), leaf, nil, versionName(1), kms); err == nil {
+		t.Error("gcpkms.SignCMSDetached() with certificate of another key err = nil, want error")
+	}
+}
+
+func TestSignCMSDetachedRejectsInvalidKeyName(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	_, leaf := newCertificates(t, kmsPublicKey(t, kms, versionName(1)), x509.ExtKeyUsageAny)
+	if _, err := gcpkms.SignCMSDetached(context.Background(), bytes.NewReader([]byte("content")), leaf, nil, fakeSigningKeyName, kms); err == nil {
+		t.Error("gcpkms.SignCMSDetached() with crypto key name err = nil, want error")
+	}
+}
@@ -0,0 +1,299 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const (
+	// fakeCompatFixtures holds ciphertexts produced with the Cloud KMS JSON
+	// API client against the fake server, under a key with the material
+	// fakeCompatKey, see testdata/compat/README.md.
+	fakeCompatFixtures = "testdata/compat/fake/*.json"
+	fakeCompatKey      = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+)
+
+// compatData is encoded differently in standard and URL-safe base64, and
+// needs padding: "+/8=" and "-_8=".
+var compatData = []byte{0xfb, 0xff}
+
+func crc32c(data []byte) int64 {
+	return int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli)))
+}
+
+// recordingTransport records the JSON bodies of the requests it sends, by
+// the method in their path, e.g. "encrypt".
+type recordingTransport struct {
+	mu     sync.Mutex
+	bodies map[string]map[string]any
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	var fields map[string]any
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, err
+	}
+	method := req.URL.Path[strings.LastIndex(req.URL.Path, ":")+1:]
+	t.mu.Lock()
+	t.bodies[method] = fields
+	t.mu.Unlock()
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestAEADRequestsMatchJSONAPI(t *testing.T) {
+	srv := newFakeServer(t)
+	trans := &recordingTransport{bodies: make(map[string]map[string]any)}
+	a := newFakeAEAD(t, srv, gcpkms.WithGoogleAPIClientOptions(
+		option.WithEndpoint(srv.URL()+"/"),
+		option.WithHTTPClient(&http.Client{Transport: trans}),
+	))
+	associatedData := []byte{0xfe}
+	ciphertext, err := a.Encrypt(compatData, associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt(ciphertext, associatedData); err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	// The JSON API encodes bytes fields in standard base64 with padding, and
+	// int64 fields as decimal strings.
+	for _, tc := range []struct {
+		method string
+		want   map[string]any
+	}{
+		{
+			method: "encrypt",
+			want: map[string]any{
+				"plaintext":                   "+/8=",
+				"additionalAuthenticatedData": "/g==",
+			},
+		},
+		{
+			method: "decrypt",
+			want: map[string]any{
+				"ciphertext":                        base64.StdEncoding.EncodeToString(ciphertext),
+				"ciphertextCrc32c":                  strconv.FormatInt(crc32c(ciphertext), 10),
+				"additionalAuthenticatedData":       "/g==",
+				"additionalAuthenticatedDataCrc32c": strconv.FormatInt(crc32c(associatedData), 10),
+			},
+		},
+	} {
+		got := trans.bodies[tc.method]
+		if len(got) != len(tc.want) {
+			t.Errorf("%s request = %v, want %v", tc.method, got, tc.want)
+			continue
+		}
+		for field, want := range tc.want {
+			if got[field] != want {
+				t.Errorf("%s request field %q = %v, want %v", tc.method, field, got[field], want)
+			}
+		}
+	}
+}
+
+func TestAEADOmitsEmptyAssociatedData(t *testing.T) {
+	for _, associatedData := range [][]byte{nil, {}} {
+		srv := newFakeServer(t)
+		trans := &recordingTransport{bodies: make(map[string]map[string]any)}
+		a := newFakeAEAD(t, srv, gcpkms.WithGoogleAPIClientOptions(
+			option.WithEndpoint(srv.URL()+"/"),
+			option.WithHTTPClient(&http.Client{Transport: trans}),
+		))
+		ciphertext, err := a.Encrypt(compatData, associatedData)
+		if err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+		if _, err := a.Decrypt(ciphertext, associatedData); err != nil {
+			t.Fatalf("a.Decrypt() err = %v, want nil", err)
+		}
+		for _, method := range []string{"encrypt", "decrypt"} {
+			if v, ok := trans.bodies[method]["additionalAuthenticatedData"]; ok {
+				t.Errorf("%s request with associated data %v has additionalAuthenticatedData = %v, want none", method, associatedData, v)
+			}
+			// Checksums are sent even if they are zero.
+			if v, ok := trans.bodies[method]["additionalAuthenticatedDataCrc32c"]; ok && v != "0" {
+				t.Errorf("%s request with associated data %v has additionalAuthenticatedDataCrc32c = %v, want 0", method, associatedData, v)
+			}
+		}
+	}
+}
+
+func TestAEADDecodesBase64Variants(t *testing.T) {
+	for _, encoded := range []string{"+/8=", "-_8=", "+/8", "-_8"} {
+		t.Run(encoded, func(t *testing.T) {
+			crc := strconv.FormatInt(crc32c(compatData), 10)
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch {
+				case strings.HasSuffix(r.URL.Path, ":encrypt"):
+					fmt.Fprintf(w, `{"name": %q, "ciphertext": %q, "ciphertextCrc32c": %q, "verifiedPlaintextCrc32c": true, "verifiedAdditionalAuthenticatedDataCrc32c": true}`, fakeKeyName+"/cryptoKeyVersions/1", encoded, crc)
+				case strings.HasSuffix(r.URL.Path, ":decrypt"):
+					fmt.Fprintf(w, `{"plaintext": %q, "plaintextCrc32c": %q}`, encoded, crc)
+				default:
+					http.NotFound(w, r)
+				}
+			}))
+			t.Cleanup(ts.Close)
+			client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithGoogleAPIClientOptions(
+				option.WithEndpoint(ts.URL+"/"),
+				option.WithoutAuthentication(),
+			), gcpkms.WithInsecureTransport())
+			if err != nil {
+				t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+			}
+			a, err := client.GetAEAD(fakeKeyURI)
+			if err != nil {
+				t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+			}
+			ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+			if err != nil {
+				t.Fatalf("a.Encrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(ciphertext, compatData) {
+				t.Errorf("a.Encrypt() = %x, want %x", ciphertext, compatData)
+			}
+			plaintext, err := a.Decrypt([]byte("ciphertext"), nil)
+			if err != nil {
+				t.Fatalf("a.Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(plaintext, compatData) {
+				t.Errorf("a.Decrypt() = %x, want %x", plaintext, compatData)
+			}
+		})
+	}
+}
+
+func TestAEADInteroperatesWithJSONAPI(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	kms := newKMSService(t, srv.ClientOptions()...)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associated data")
+
+	// Ciphertexts of the AEAD are the ciphertexts of the API.
+	ciphertext, err := a.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	decResp, err := kms.Projects.Locations.KeyRings.CryptoKeys.Decrypt(fakeKeyName, &cloudkms.DecryptRequest{
+		Ciphertext:                  base64.StdEncoding.EncodeToString(ciphertext),
+		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(associatedData),
+	}).Do()
+	if err != nil {
+		t.Fatalf("Decrypt() err = %v, want nil", err)
+	}
+	if got, want := decResp.Plaintext, base64.StdEncoding.EncodeToString(plaintext); got != want {
+		t.Errorf("Decrypt() plaintext = %q, want %q", got, want)
+	}
+
+	// And vice versa.
+	encResp, err := kms.Projects.Locations.KeyRings.CryptoKeys.Encrypt(fakeKeyName, &cloudkms.EncryptRequest{
+		Plaintext:                   base64.StdEncoding.EncodeToString(plaintext),
+		AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(associatedData),
+	}).Do()
+	if err != nil {
+		t.Fatalf("Encrypt() err = %v, want nil", err)
+	}
+	ciphertext, err = base64.StdEncoding.DecodeString(encResp.Ciphertext)
+	if err != nil {
+		t.Fatalf("base64.StdEncoding.DecodeString() err = %v, want nil", err)
+	}
+	got, err := a.Decrypt(ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("a.Decrypt() = %q, want %q", got, plaintext)
+	}
+}
+
+func TestCompatibilityFixtures(t *testing.T) {
+	files, err := filepath.Glob(fakeCompatFixtures)
+	if err != nil {
+		t.Fatalf("filepath.Glob(%q) err = %v, want nil", fakeCompatFixtures, err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no fixtures match %s", fakeCompatFixtures)
+	}
+	key, err := hex.DecodeString(fakeCompatKey)
+	if err != nil {
+		t.Fatalf("hex.DecodeString() err = %v, want nil", err)
+	}
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("os.ReadFile() err = %v, want nil", err)
+			}
+			var f compatFixture
+			if err := json.Unmarshal(data, &f); err != nil {
+				t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+			}
+			srv := fakekms.NewServer()
+			t.Cleanup(srv.Close)
+			if err := srv.CreateKeyWithMaterial(f.KeyName, key); err != nil {
+				t.Fatalf("srv.CreateKeyWithMaterial() err = %v, want nil", err)
+			}
+			keyURI := "gcp-kms://" + f.KeyName
+			client, err := gcpkms.NewClient(context.Background(), keyURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+			if err != nil {
+				t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+			}
+			a, err := client.GetAEAD(keyURI)
+			if err != nil {
+				t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+			}
+			got, err := a.Decrypt(f.Ciphertext, f.AssociatedData)
+			if err != nil {
+				t.Fatalf("a.Decrypt() of ciphertext produced by %s (%s) err = %v, want nil", f.Tool, f.Description, err)
+			}
+			if !bytes.Equal(got, f.Plaintext) {
+				t.Errorf("a.Decrypt() of ciphertext produced by %s (%s) = %q, want %q", f.Tool, f.Description, got, f.Plaintext)
+			}
+			// The associated data is authenticated, so other associated
+			// data must not decrypt the fixture.
+			if _, err := a.Decrypt(f.Ciphertext, append(f.AssociatedData, 'x')); err == nil {
+				t.Error("a.Decrypt() with other associated data err = nil, want error")
+			}
+		})
+	}
+}
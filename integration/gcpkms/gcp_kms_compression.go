@@ -0,0 +1,151 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is a codec that plaintexts are compressed with before they are
+// encrypted, as set with WithCompression. Its values are stored in
+// ciphertexts and must not change.
+type Compression byte
+
+const (
+	// CompressionNone stores plaintexts uncompressed.
+	CompressionNone Compression = 0
+	// CompressionGzip compresses plaintexts with gzip.
+	CompressionGzip Compression = 1
+	// CompressionZstd compresses plaintexts with Zstandard.
+	CompressionZstd Compression = 2
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Compression(%d)", byte(c))
+	}
+}
+
+// valid returns true if c is a known codec.
+func (c Compression) valid() bool {
+	return c <= CompressionZstd
+}
+
+// maxDecompressedSize bounds the size of decompressed plaintexts, so that a
+// small ciphertext cannot make Decrypt allocate unbounded memory.
+const maxDecompressedSize = 256 << 20
+
+// maxZstdWindow bounds the memory the Zstandard decoder uses for its window.
+// It is larger than the window of the encoder, which is at most 8 MiB.
+const maxZstdWindow = 64 << 20
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+	zstdErr     error
+)
+
+// zstdCodec returns the shared Zstandard encoder and decoder, which are safe
+// for concurrent use with EncodeAll and DecodeAll.
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+		if zstdErr != nil {
+			return
+		}
+		zstdDecoder, zstdErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0),
+			zstd.WithDecoderMaxMemory(maxDecompressedSize), zstd.WithDecoderMaxWindow(maxZstdWindow))
+	})
+	return zstdEncoder, zstdDecoder, zstdErr
+}
+
+// compress returns data compressed with c.
+func compress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		enc, _, err := zstdCodec()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %v", c)
+	}
+}
+
+// decompress returns data decompressed with c. It fails if the result would
+// be larger than maxDecompressedSize.
+func decompress(c Compression, data []byte) ([]byte, error) {
+	return decompressLimited(c, data, maxDecompressedSize)
+}
+
+// decompressLimited is like decompress, but fails if the result would be
+// larger than limit, which must not exceed maxDecompressedSize.
+func decompressLimited(c Compression, data []byte, limit int64) ([]byte, error) {
+	var out []byte
+	var err error
+	switch c {
+	case CompressionNone:
+		return data, nil
+	case CompressionGzip:
+		var r *gzip.Reader
+		if r, err = gzip.NewReader(bytes.NewReader(data)); err == nil {
+			out, err = io.ReadAll(io.LimitReader(r, limit+1))
+		}
+	case CompressionZstd:
+		var dec *zstd.Decoder
+		if _, dec, err = zstdCodec(); err == nil {
+			out, err = dec.DecodeAll(data, nil)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression %v", c)
+	}
+	if errors.Is(err, zstd.ErrDecoderSizeExceeded) || int64(len(out)) > limit {
+		return nil, fmt.Errorf("decompressing plaintext with %v failed: plaintext is too large, more than %d bytes", c, limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decompressing plaintext with %v failed: %v", c, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,73 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDecompressRejectsOversizedPlaintexts(t *testing.T) {
+	const limit = 1 << 10
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			for _, tc := range []struct {
+				name    string
+				size    int
+				wantErr bool
+			}{
+				{name: "at limit", size: limit},
+				{name: "over limit", size: limit + 1, wantErr: true},
+				{name: "far over limit", size: 1 << 20, wantErr: true},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					plaintext := bytes.Repeat([]byte{'a'}, tc.size)
+					compressed, err := compress(c, plaintext)
+					if err != nil {
+						t.Fatalf("compress() err = %v, want nil", err)
+					}
+					got, err := decompressLimited(c, compressed, limit)
+					if tc.wantErr {
+						if err == nil || !strings.Contains(err.Error(), "too large") {
+							t.Errorf("decompressLimited() err = %v, want plaintext too large", err)
+						}
+						return
+					}
+					if err != nil {
+						t.Fatalf("decompressLimited() err = %v, want nil", err)
+					}
+					if !bytes.Equal(got, plaintext) {
+						t.Errorf("decompressLimited() = %d bytes, want %d bytes", len(got), len(plaintext))
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestZstdDecoderRejectsOversizedFrames(t *testing.T) {
+	// The frame header declares the size of the content, so the decoder
+	// fails before allocating it.
+	compressed, err := compress(CompressionZstd, make([]byte, maxDecompressedSize+1))
+	if err != nil {
+		t.Fatalf("compress() err = %v, want nil", err)
+	}
+	if _, err := decompress(CompressionZstd, compressed); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("decompress() err = %v, want plaintext too large", err)
+	}
+}
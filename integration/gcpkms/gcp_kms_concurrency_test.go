@@ -0,0 +1,339 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+)
+
+// The tests in this file use many goroutines to check that the primitives and
+// the client are safe for concurrent use. They are meant to be run with
+// -race, and are sized to stay fast.
+
+// stressGoroutines is the number of goroutines that the tests run at once.
+const stressGoroutines = 200
+
+// stress calls fn from n goroutines at once and waits for them to return.
+func stress(n int, fn func(i int)) {
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			fn(i)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+}
+
+// newStressServer returns a fake server holding the key fakeKeyName and the
+// EC_SIGN_P256_SHA256 key fakeSigningKeyName.
+func newStressServer(t *testing.T) *fakekms.Server {
+	t.Helper()
+	srv := newFakeServer(t)
+	if err := srv.CreateSigningKey(fakeSigningKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	return srv
+}
+
+// setTestLabels sets the labels of the crypto keys with the given names to
+// {"env": "test"}.
+func setTestLabels(t *testing.T, srv *fakekms.Server, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		if err := srv.SetLabels(strings.TrimPrefix(name, "gcp-kms://"), map[string]string{"env": "test"}); err != nil {
+			t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+		}
+	}
+}
+
+func newStressClient(t *testing.T, srv *fakekms.Server, opts ...gcpkms.Option) *gcpkms.Client {
+	t.Helper()
+	opts = append([]gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://", opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestAEADConcurrentUse(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+		// largeEvery makes every largeEvery-th goroutine encrypt a plaintext
+		// larger than Cloud KMS accepts. It is zero if none does.
+		largeEvery int
+	}{
+		{name: "default"},
+		{name: "decrypt deduplication", opts: []gcpkms.Option{gcpkms.WithDecryptDeduplication()}},
+		{name: "decrypt cache", opts: []gcpkms.Option{gcpkms.WithDecryptCache(16, time.Minute)}},
+		{name: "hedging", opts: []gcpkms.Option{gcpkms.WithHedging(time.Millisecond, 1)}},
+		{name: "max concurrent calls", opts: []gcpkms.Option{gcpkms.WithMaxConcurrentCalls(8)}},
+		{name: "large payload envelope", opts: []gcpkms.Option{gcpkms.WithLargePayloadEnvelope(aead.AES128GCMKeyTemplate())}, largeEvery: 50},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newStressServer(t)
+			client := newStressClient(t, srv, tc.opts...)
+			p, err := client.GetAEAD(fakeKeyURI)
+			if err != nil {
+				t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+			}
+			a := p.(*gcpkms.AEAD)
+			shared, err := a.Encrypt([]byte("shared plaintext"), []byte("shared"))
+			if err != nil {
+				t.Fatalf("a.Encrypt() err = %v, want nil", err)
+			}
+			stress(stressGoroutines, func(i int) {
+				plaintext := []byte(fmt.Sprint("plaintext ", i))
+				if tc.largeEvery > 0 && i%tc.largeEvery == 0 {
+					plaintext = bytes.Repeat(plaintext, 64*1024/len(plaintext)+1)
+				}
+				associatedData := []byte(fmt.Sprint("associated data ", i%4))
+				ciphertext, err := a.Encrypt(plaintext, associatedData)
+				if err != nil {
+					t.Errorf("a.Encrypt() err = %v, want nil", err)
+					return
+				}
+				decrypted, err := a.Decrypt(ciphertext, associatedData)
+				if err != nil || !bytes.Equal(decrypted, plaintext) {
+					t.Errorf("a.Decrypt() = %q, %v, want %q, nil", decrypted, err, plaintext)
+				}
+				res, err := a.DecryptWithMetadata(context.Background(), shared, []byte("shared"))
+				if err != nil || string(res.Plaintext) != "shared plaintext" {
+					t.Errorf("a.DecryptWithMetadata() = %q, %v, want %q, nil", res.Plaintext, err, "shared plaintext")
+				}
+				dst, err := a.DecryptInto(context.Background(), make([]byte, 0, 64), shared, []byte("shared"))
+				if err != nil || string(dst) != "shared plaintext" {
+					t.Errorf("a.DecryptInto() = %q, %v, want %q, nil", dst, err, "shared plaintext")
+				}
+			})
+		})
+	}
+}
+
+func TestSignerConcurrentUse(t *testing.T) {
+	srv := newStressServer(t)
+	client := newStressClient(t, srv)
+	keyURI := "gcp-kms://" + versionName(1)
+	shared, err := client.GetSigner(context.Background(), keyURI)
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	stress(stressGoroutines, func(i int) {
+		// Half of the goroutines create their own signer, which shares the
+		// public key cached by the client.
+		s := shared
+		if i%2 == 0 {
+			var err error
+			if s, err = client.GetSigner(context.Background(), keyURI); err != nil {
+				t.Errorf("client.GetSigner() err = %v, want nil", err)
+				return
+			}
+		}
+		digest := sha256.Sum256([]byte(fmt.Sprint("data ", i)))
+		signature, err := s.SignWithContext(context.Background(), digest[:], s.SignerOpts())
+		if err != nil {
+			t.Errorf("s.SignWithContext() err = %v, want nil", err)
+			return
+		}
+		if !ecdsa.VerifyASN1(s.Public().(*ecdsa.PublicKey), digest[:], signature) {
+			t.Error("ecdsa.VerifyASN1() = false, want true")
+		}
+	})
+	if got := srv.CallCount("GetPublicKey"); got != 1 {
+		t.Errorf("GetPublicKey called %d times, want 1", got)
+	}
+}
+
+func TestClientConcurrentGetAEAD(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 8)
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "primitive cache"},
+		{name: "without primitive cache", opts: []gcpkms.Option{gcpkms.WithoutPrimitiveCache()}},
+		{name: "required key labels", opts: []gcpkms.Option{gcpkms.WithRequiredKeyLabels(map[string]string{"env": "test"})}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			setTestLabels(t, srv, keyURIs...)
+			client := newStressClient(t, srv, tc.opts...)
+			stress(stressGoroutines, func(i int) {
+				keyURI := keyURIs[i%len(keyURIs)]
+				a, err := client.GetAEAD(keyURI)
+				if err != nil {
+					t.Errorf("client.GetAEAD(%q) err = %v, want nil", keyURI, err)
+					return
+				}
+				ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+				if err != nil {
+					t.Errorf("a.Encrypt() err = %v, want nil", err)
+					return
+				}
+				if _, err := a.Decrypt(ciphertext, nil); err != nil {
+					t.Errorf("a.Decrypt() err = %v, want nil", err)
+				}
+			})
+		})
+	}
+}
+
+func TestClientConcurrentUseDuringClose(t *testing.T) {
+	srv := newStressServer(t)
+	client := newStressClient(t, srv, gcpkms.WithDecryptCache(16, time.Minute), gcpkms.WithDecryptDeduplication())
+	p, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	ciphertext, err := p.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("p.Encrypt() err = %v, want nil", err)
+	}
+	// Operations either succeed or fail with ErrClientClosed, depending on
+	// whether they start before or after Close, which several goroutines call.
+	check := func(op string, err error) {
+		if err != nil && !errors.Is(err, gcpkms.ErrClientClosed) {
+			t.Errorf("%s err = %v, want nil or %v", op, err, gcpkms.ErrClientClosed)
+		}
+	}
+	digest := sha256.Sum256([]byte("data"))
+	stress(stressGoroutines, func(i int) {
+		switch i % 5 {
+		case 0:
+			if i%50 == 0 {
+				client.Close()
+			}
+			a, err := client.GetAEAD(fakeKeyURI)
+			check("client.GetAEAD()", err)
+			if err == nil {
+				_, err = a.Encrypt([]byte("plaintext"), nil)
+				check("a.Encrypt()", err)
+			}
+		case 1:
+			_, err := p.Encrypt([]byte("plaintext"), nil)
+			check("p.Encrypt()", err)
+		case 2:
+			_, err := p.Decrypt(ciphertext, nil)
+			check("p.Decrypt()", err)
+		case 3:
+			s, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1))
+			check("client.GetSigner()", err)
+			if err == nil {
+				_, err = s.Sign(nil, digest[:], s.SignerOpts())
+				check("s.Sign()", err)
+			}
+		case 4:
+			client.InFlightCalls()
+			client.DecryptCacheStats()
+			client.HedgedRequests()
+		}
+	})
+	if _, err := p.Decrypt(ciphertext, nil); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("p.Decrypt() after Close err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+}
+
+func TestConcurrentClientConstruction(t *testing.T) {
+	srv := newStressServer(t)
+	setTestLabels(t, srv, fakeKeyName)
+	// All clients are created with the same options, whose slice has room to
+	// grow, so that appending to it in place would be caught.
+	opts := make([]gcpkms.Option, 0, 16)
+	opts = append(opts,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...),
+		gcpkms.WithInsecureTransport(),
+		gcpkms.WithRequiredKeyLabels(map[string]string{"env": "test"}),
+		gcpkms.WithLargePayloadEnvelope(aead.AES128GCMKeyTemplate()),
+		gcpkms.WithDecryptCache(4, time.Minute),
+	)
+	const n = 50
+	clients := make([]*gcpkms.Client, n)
+	stress(n, func(i int) {
+		client, err := gcpkms.NewClient(context.Background(), "gcp-kms://", opts...)
+		if err != nil {
+			t.Errorf("gcpkms.NewClient() err = %v, want nil", err)
+			return
+		}
+		clients[i] = client
+		a, err := client.GetAEAD(fakeKeyURI)
+		if err != nil {
+			t.Errorf("client.GetAEAD() err = %v, want nil", err)
+			return
+		}
+		if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+			t.Errorf("a.Encrypt() err = %v, want nil", err)
+		}
+	})
+	for _, client := range clients {
+		if client != nil {
+			client.Close()
+		}
+	}
+}
+
+func TestOptionArgumentsMutatedAfterNewClient(t *testing.T) {
+	srv := newStressServer(t)
+	setTestLabels(t, srv, fakeKeyName, fakeSigningKeyName)
+	labels := map[string]string{"env": "test"}
+	dekTemplate := aead.AES128GCMKeyTemplate()
+	client := newStressClient(t, srv, gcpkms.WithRequiredKeyLabels(labels), gcpkms.WithLargePayloadEnvelope(dekTemplate))
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	plaintext := bytes.Repeat([]byte{'p'}, 64*1024+1)
+	// The client must have copied the arguments of the options, so changing
+	// them while it is in use neither races nor changes its behavior.
+	stress(stressGoroutines/10, func(i int) {
+		if i == 0 {
+			labels["env"] = "prod"
+			dekTemplate.TypeUrl = "type.googleapis.com/google.crypto.tink.Invalid"
+			dekTemplate.Value = nil
+			return
+		}
+		ciphertext, err := a.Encrypt(plaintext, nil)
+		if err != nil {
+			t.Errorf("a.Encrypt() err = %v, want nil", err)
+			return
+		}
+		if _, err := a.Decrypt(ciphertext, nil); err != nil {
+			t.Errorf("a.Decrypt() err = %v, want nil", err)
+		}
+	})
+	if _, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1)); err != nil {
+		t.Errorf("client.GetSigner() err = %v, want nil", err)
+	}
+}
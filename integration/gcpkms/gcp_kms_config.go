@@ -0,0 +1,435 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/credentials"
+)
+
+// Transports of Config.
+const (
+	// TransportTLS makes the client use TLS and authenticate its requests,
+	// as NewClient does by default.
+	TransportTLS = "tls"
+	// TransportInsecure is the equivalent of WithInsecureTransport.
+	TransportInsecure = "insecure"
+)
+
+// Warm-up policies of Config.
+const (
+	// WarmupPolicyBestEffort is the equivalent of WarmupBestEffort.
+	WarmupPolicyBestEffort = "best_effort"
+	// WarmupPolicyRequired is the equivalent of WarmupRequired.
+	WarmupPolicyRequired = "required"
+)
+
+// Project check policies of Config.
+const (
+	// ProjectCheckPolicyWarn is the equivalent of ProjectCheckWarn.
+	ProjectCheckPolicyWarn = "warn"
+	// ProjectCheckPolicyStrict is the equivalent of ProjectCheckStrict.
+	ProjectCheckPolicyStrict = "strict"
+)
+
+// Duration is a time.Duration that is marshaled to JSON as a string in the
+// format of time.ParseDuration, e.g. "1.5s", rather than as nanoseconds.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"1.5s\", got %s", data)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config is a serializable description of a Client, e.g. to receive the
+// settings of a client from a control plane or a configuration file. It is
+// marshaled to JSON with stable field names, and unmarshaling rejects unknown
+// fields, so that a misspelled setting is not silently ignored. Zero fields
+// keep the defaults of NewClient.
+//
+// Credentials are not part of Config, so that it can be logged and stored
+// without secrets; they are passed separately as a CredentialConfig. Settings
+// that take Go values, such as callbacks and loggers, can be added to the
+// options returned by OptionsFromConfig.
+type Config struct {
+	// Transport is TransportTLS, the default if empty, or TransportInsecure.
+	Transport string `json:"transport,omitempty"`
+	// KeyURIPrefix is the uriPrefix passed to NewClient, e.g.
+	// "gcp-kms://projects/p/locations/l/keyRings/r". It is required.
+	KeyURIPrefix string `json:"key_uri_prefix"`
+	// AdditionalPrefixes are passed to WithAdditionalPrefixes.
+	AdditionalPrefixes []string `json:"additional_prefixes,omitempty"`
+
+	// Endpoint is the Cloud KMS endpoint, as set with option.WithEndpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+	// Endpoints are passed to WithEndpoints.
+	Endpoints []string `json:"endpoints,omitempty"`
+	// RegionalEndpoints is the equivalent of WithRegionalEndpoints.
+	RegionalEndpoints bool `json:"regional_endpoints,omitempty"`
+
+	// CallTimeout is passed to WithCallTimeout.
+	CallTimeout Duration `json:"call_timeout,omitempty"`
+	// ProtectionLevelTimeouts maps protection levels, e.g. "EXTERNAL", to the
+	// timeouts passed to WithProtectionLevelTimeout.
+	ProtectionLevelTimeouts map[string]Duration `json:"protection_level_timeouts,omitempty"`
+	// MethodTimeouts maps the names of Cloud KMS methods, as returned by
+	// Method.String, e.g. "AsymmetricSign", to the timeouts passed to
+	// WithMethodTimeout.
+	MethodTimeouts map[string]Duration `json:"method_timeouts,omitempty"`
+
+	// Retry is passed to WithRetrySettings, if set.
+	Retry *RetryConfig `json:"retry,omitempty"`
+	// RetryBudget is passed to WithRetryBudget, if set.
+	RetryBudget *RetryBudgetConfig `json:"retry_budget,omitempty"`
+	// NewKeyGracePeriod is passed to WithNewKeyGracePeriod.
+	NewKeyGracePeriod Duration `json:"new_key_grace_period,omitempty"`
+	// Reauthentication is the equivalent of WithReauthentication.
+	Reauthentication bool `json:"reauthentication,omitempty"`
+
+	// RequiredKeyLabels are passed to WithRequiredKeyLabels.
+	RequiredKeyLabels map[string]string `json:"required_key_labels,omitempty"`
+	// AllowedKeyLocations are passed to WithAllowedKeyLocations.
+	AllowedKeyLocations []string `json:"allowed_key_locations,omitempty"`
+	// KeyLocationVerification is the equivalent of
+	// WithKeyLocationVerification.
+	KeyLocationVerification bool `json:"key_location_verification,omitempty"`
+	// RequiredRotationPeriod is passed to WithRequiredRotationPeriod.
+	RequiredRotationPeriod Duration `json:"required_rotation_period,omitempty"`
+	// RotationPolicyExemptions are passed to WithRotationPolicyExemptions.
+	RotationPolicyExemptions []string `json:"rotation_policy_exemptions,omitempty"`
+	// KeyURIBinding is the equivalent of WithKeyURIBinding.
+	KeyURIBinding bool `json:"key_uri_binding,omitempty"`
+	// Warmup is passed to WithConnectionWarmup, if set. It is
+	// WarmupPolicyBestEffort or WarmupPolicyRequired.
+	Warmup string `json:"warmup,omitempty"`
+	// ProjectCheck is passed to WithProjectConsistencyCheck, if set. It is
+	// ProjectCheckPolicyWarn or ProjectCheckPolicyStrict.
+	ProjectCheck string `json:"project_check,omitempty"`
+
+	// MaxConcurrentCalls is passed to WithMaxConcurrentCalls.
+	MaxConcurrentCalls int `json:"max_concurrent_calls,omitempty"`
+	// CloseGracePeriod is passed to WithCloseGracePeriod.
+	CloseGracePeriod Duration `json:"close_grace_period,omitempty"`
+	// Hedging is passed to WithHedging, if set.
+	Hedging *HedgingConfig `json:"hedging,omitempty"`
+	// DisablePrimitiveCache is the equivalent of WithoutPrimitiveCache.
+	DisablePrimitiveCache bool `json:"disable_primitive_cache,omitempty"`
+	// DecryptDeduplication is the equivalent of WithDecryptDeduplication.
+	DecryptDeduplication bool `json:"decrypt_deduplication,omitempty"`
+	// DecryptCache is passed to WithDecryptCache, if set.
+	DecryptCache *DecryptCacheConfig `json:"decrypt_cache,omitempty"`
+}
+
+// RetryConfig is the serializable form of RetrySettings.
+type RetryConfig struct {
+	MaxAttempts    int      `json:"max_attempts,omitempty"`
+	InitialBackoff Duration `json:"initial_backoff,omitempty"`
+	MaxBackoff     Duration `json:"max_backoff,omitempty"`
+	Multiplier     float64  `json:"multiplier,omitempty"`
+}
+
+// RetryBudgetConfig holds the arguments of WithRetryBudget.
+type RetryBudgetConfig struct {
+	Ratio     float64 `json:"ratio"`
+	MinTokens int     `json:"min_tokens"`
+}
+
+// HedgingConfig holds the arguments of WithHedging.
+type HedgingConfig struct {
+	Delay     Duration `json:"delay"`
+	MaxHedges int      `json:"max_hedges"`
+}
+
+// DecryptCacheConfig holds the arguments of WithDecryptCache.
+type DecryptCacheConfig struct {
+	MaxEntries int      `json:"max_entries"`
+	TTL        Duration `json:"ttl"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler. It fails on fields that Config
+// does not have, including those of nested objects.
+func (c *Config) UnmarshalJSON(data []byte) error {
+	// plain has the fields of Config without its methods, so that decoding
+	// into it does not recurse.
+	type plain Config
+	p := plain(*c)
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return fmt.Errorf("invalid client configuration: %v", err)
+	}
+	*c = Config(p)
+	return nil
+}
+
+// Validate checks that c describes a valid client, without contacting Cloud
+// KMS, e.g. to reject a configuration before it replaces the current one. It
+// returns the error that NewClientFromConfig would return for an invalid
+// configuration.
+func (c Config) Validate() error {
+	opts, err := c.options()
+	if err != nil {
+		return err
+	}
+	return c.validate(opts)
+}
+
+// validate checks c with the options it maps to.
+func (c Config) validate(opts []Option) error {
+	if !strings.HasPrefix(strings.ToLower(c.KeyURIPrefix), gcpPrefix) {
+		return fmt.Errorf("key_uri_prefix must start with %s, got %q", gcpPrefix, c.KeyURIPrefix)
+	}
+	if _, err := canonicalKeyURI(c.KeyURIPrefix); err != nil {
+		return fmt.Errorf("invalid key_uri_prefix: %v", err)
+	}
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return err
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	return cfg.checkTransportSecurity(endpoint)
+}
+
+// options returns the options that c maps to.
+func (c Config) options() ([]Option, error) {
+	var opts []Option
+	switch c.Transport {
+	case "", TransportTLS:
+	case TransportInsecure:
+		opts = append(opts, WithInsecureTransport())
+	default:
+		return nil, fmt.Errorf("unknown transport %q", c.Transport)
+	}
+	if len(c.AdditionalPrefixes) > 0 {
+		opts = append(opts, WithAdditionalPrefixes(c.AdditionalPrefixes...))
+	}
+	if c.Endpoint != "" {
+		opts = append(opts, WithGoogleAPIClientOptions(option.WithEndpoint(c.Endpoint)))
+	}
+	if len(c.Endpoints) > 0 {
+		opts = append(opts, WithEndpoints(c.Endpoints...))
+	}
+	if c.RegionalEndpoints {
+		opts = append(opts, WithRegionalEndpoints())
+	}
+	if c.CallTimeout != 0 {
+		opts = append(opts, WithCallTimeout(time.Duration(c.CallTimeout)))
+	}
+	for level, d := range c.ProtectionLevelTimeouts {
+		opts = append(opts, WithProtectionLevelTimeout(level, time.Duration(d)))
+	}
+	for name, d := range c.MethodTimeouts {
+		method, err := parseMethod(name)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithMethodTimeout(method, time.Duration(d)))
+	}
+	if r := c.Retry; r != nil {
+		opts = append(opts, WithRetrySettings(RetrySettings{
+			MaxAttempts:    r.MaxAttempts,
+			InitialBackoff: time.Duration(r.InitialBackoff),
+			MaxBackoff:     time.Duration(r.MaxBackoff),
+			Multiplier:     r.Multiplier,
+		}))
+	}
+	if b := c.RetryBudget; b != nil {
+		opts = append(opts, WithRetryBudget(b.Ratio, b.MinTokens))
+	}
+	if c.NewKeyGracePeriod != 0 {
+		opts = append(opts, WithNewKeyGracePeriod(time.Duration(c.NewKeyGracePeriod)))
+	}
+	if c.Reauthentication {
+		opts = append(opts, WithReauthentication())
+	}
+	if c.RequiredKeyLabels != nil {
+		opts = append(opts, WithRequiredKeyLabels(c.RequiredKeyLabels))
+	}
+	if c.AllowedKeyLocations != nil {
+		opts = append(opts, WithAllowedKeyLocations(c.AllowedKeyLocations...))
+	}
+	if c.KeyLocationVerification {
+		opts = append(opts, WithKeyLocationVerification())
+	}
+	if c.RequiredRotationPeriod != 0 {
+		opts = append(opts, WithRequiredRotationPeriod(time.Duration(c.RequiredRotationPeriod)))
+	}
+	if c.RotationPolicyExemptions != nil {
+		opts = append(opts, WithRotationPolicyExemptions(c.RotationPolicyExemptions...))
+	}
+	if c.KeyURIBinding {
+		opts = append(opts, WithKeyURIBinding())
+	}
+	switch c.Warmup {
+	case "":
+	case WarmupPolicyBestEffort:
+		opts = append(opts, WithConnectionWarmup(WarmupBestEffort))
+	case WarmupPolicyRequired:
+		opts = append(opts, WithConnectionWarmup(WarmupRequired))
+	default:
+		return nil, fmt.Errorf("unknown warm-up policy %q", c.Warmup)
+	}
+	switch c.ProjectCheck {
+	case "":
+	case ProjectCheckPolicyWarn:
+		opts = append(opts, WithProjectConsistencyCheck(ProjectCheckWarn))
+	case ProjectCheckPolicyStrict:
+		opts = append(opts, WithProjectConsistencyCheck(ProjectCheckStrict))
+	default:
+		return nil, fmt.Errorf("unknown project check policy %q", c.ProjectCheck)
+	}
+	if c.MaxConcurrentCalls != 0 {
+		opts = append(opts, WithMaxConcurrentCalls(c.MaxConcurrentCalls))
+	}
+	if c.CloseGracePeriod != 0 {
+		opts = append(opts, WithCloseGracePeriod(time.Duration(c.CloseGracePeriod)))
+	}
+	if h := c.Hedging; h != nil {
+		opts = append(opts, WithHedging(time.Duration(h.Delay), h.MaxHedges))
+	}
+	if c.DisablePrimitiveCache {
+		opts = append(opts, WithoutPrimitiveCache())
+	}
+	if c.DecryptDeduplication {
+		opts = append(opts, WithDecryptDeduplication())
+	}
+	if dc := c.DecryptCache; dc != nil {
+		opts = append(opts, WithDecryptCache(dc.MaxEntries, time.Duration(dc.TTL)))
+	}
+	return opts, nil
+}
+
+// parseMethod returns the Method whose String is name.
+func parseMethod(name string) (Method, error) {
+	for m := MethodEncrypt; m <= MethodTestIamPermissions; m++ {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown method %q", name)
+}
+
+// CredentialConfig holds the credentials of a client created with
+// NewClientFromConfig. At most one of CredentialsFile, CredentialsJSON,
+// TokenSource and PerRPCCredentials may be set; if none is, the client uses
+// the application default credentials.
+type CredentialConfig struct {
+	// CredentialsFile is the path of a credentials file, e.g. a service
+	// account key.
+	CredentialsFile string
+	// WatchCredentialsFile makes the client reload CredentialsFile when it
+	// changes, as with WithCredentialsFileWatch.
+	WatchCredentialsFile bool
+	// CredentialsJSON holds the contents of a credentials file.
+	CredentialsJSON []byte
+	// TokenSource is the source of the OAuth2 tokens of the client.
+	TokenSource oauth2.TokenSource
+	// PerRPCCredentials is passed to WithPerRPCCredentials.
+	PerRPCCredentials credentials.PerRPCCredentials
+	// ClientCertSource is passed to WithClientCertSource.
+	ClientCertSource option.ClientCertSource
+}
+
+// options returns the options that c maps to.
+func (c CredentialConfig) options() ([]Option, error) {
+	set := 0
+	for _, ok := range []bool{c.CredentialsFile != "", len(c.CredentialsJSON) > 0, c.TokenSource != nil, c.PerRPCCredentials != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, errors.New("at most one of CredentialsFile, CredentialsJSON, TokenSource and PerRPCCredentials may be set")
+	}
+	if c.WatchCredentialsFile && c.CredentialsFile == "" {
+		return nil, errors.New("WatchCredentialsFile requires CredentialsFile")
+	}
+	var opts []Option
+	switch {
+	case c.WatchCredentialsFile:
+		opts = append(opts, WithCredentialsFileWatch(c.CredentialsFile))
+	case c.CredentialsFile != "":
+		opts = append(opts, WithGoogleAPIClientOptions(option.WithCredentialsFile(c.CredentialsFile)))
+	case len(c.CredentialsJSON) > 0:
+		opts = append(opts, WithGoogleAPIClientOptions(option.WithCredentialsJSON(c.CredentialsJSON)))
+	case c.TokenSource != nil:
+		opts = append(opts, WithGoogleAPIClientOptions(option.WithTokenSource(c.TokenSource)))
+	case c.PerRPCCredentials != nil:
+		opts = append(opts, WithPerRPCCredentials(c.PerRPCCredentials))
+	}
+	if c.ClientCertSource != nil {
+		opts = append(opts, WithClientCertSource(c.ClientCertSource))
+	}
+	return opts, nil
+}
+
+// OptionsFromConfig validates cfg and returns the options it maps to,
+// followed by those of creds, so that they can be combined with further
+// options, e.g. WithLogger, and passed to NewClient with cfg.KeyURIPrefix.
+// Options passed after them override the settings of cfg.
+func OptionsFromConfig(cfg Config, creds CredentialConfig) ([]Option, error) {
+	opts, err := cfg.options()
+	if err != nil {
+		return nil, err
+	}
+	credOpts, err := creds.options()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, credOpts...)
+	if err := cfg.validate(opts); err != nil {
+		return nil, err
+	}
+	return opts, nil
+}
+
+// NewClientFromConfig returns a new client described by cfg, which
+// authenticates with creds. It is equivalent to calling NewClient with
+// cfg.KeyURIPrefix and the options returned by OptionsFromConfig.
+func NewClientFromConfig(ctx context.Context, cfg Config, creds CredentialConfig) (*Client, error) {
+	opts, err := OptionsFromConfig(cfg, creds)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(ctx, cfg.KeyURIPrefix, opts...)
+}
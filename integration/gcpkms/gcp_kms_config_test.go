@@ -0,0 +1,315 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+func fullConfig() gcpkms.Config {
+	return gcpkms.Config{
+		Transport:               gcpkms.TransportTLS,
+		KeyURIPrefix:            "gcp-kms://projects/p/locations/global/keyRings/r",
+		AdditionalPrefixes:      []string{"gcp-kms://projects/q/locations/global/keyRings/r"},
+		Endpoint:                "https://cloudkms.example.com/",
+		CallTimeout:             gcpkms.Duration(2 * time.Second),
+		ProtectionLevelTimeouts: map[string]gcpkms.Duration{"EXTERNAL": gcpkms.Duration(10 * time.Second)},
+		MethodTimeouts:          map[string]gcpkms.Duration{"AsymmetricSign": gcpkms.Duration(1500 * time.Millisecond)},
+		Retry: &gcpkms.RetryConfig{
+			MaxAttempts:    5,
+			InitialBackoff: gcpkms.Duration(50 * time.Millisecond),
+			MaxBackoff:     gcpkms.Duration(time.Second),
+			Multiplier:     1.5,
+		},
+		RetryBudget:              &gcpkms.RetryBudgetConfig{Ratio: 0.2, MinTokens: 20},
+		NewKeyGracePeriod:        gcpkms.Duration(time.Minute),
+		Reauthentication:         true,
+		RequiredKeyLabels:        map[string]string{"env": "prod"},
+		AllowedKeyLocations:      []string{"global"},
+		RequiredRotationPeriod:   gcpkms.Duration(90 * 24 * time.Hour),
+		RotationPolicyExemptions: []string{"gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/legacy"},
+		KeyURIBinding:            true,
+		Warmup:                   gcpkms.WarmupPolicyBestEffort,
+		ProjectCheck:             gcpkms.ProjectCheckPolicyWarn,
+		MaxConcurrentCalls:       64,
+		CloseGracePeriod:         gcpkms.Duration(5 * time.Second),
+		Hedging:                  &gcpkms.HedgingConfig{Delay: gcpkms.Duration(100 * time.Millisecond), MaxHedges: 1},
+		DisablePrimitiveCache:    true,
+		DecryptDeduplication:     true,
+		DecryptCache:             &gcpkms.DecryptCacheConfig{MaxEntries: 100, TTL: gcpkms.Duration(time.Minute)},
+	}
+}
+
+func TestConfigJSONRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		cfg  gcpkms.Config
+	}{
+		{name: "minimal", cfg: gcpkms.Config{KeyURIPrefix: fakeKeyURI}},
+		{name: "full", cfg: fullConfig()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.cfg.Validate(); err != nil {
+				t.Fatalf("cfg.Validate() err = %v, want nil", err)
+			}
+			data, err := json.Marshal(tc.cfg)
+			if err != nil {
+				t.Fatalf("json.Marshal() err = %v, want nil", err)
+			}
+			var got gcpkms.Config
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("json.Unmarshal(%s) err = %v, want nil", data, err)
+			}
+			if !reflect.DeepEqual(got, tc.cfg) {
+				t.Errorf("json.Unmarshal(json.Marshal(cfg)) = %+v, want %+v", got, tc.cfg)
+			}
+		})
+	}
+}
+
+func TestConfigUnmarshal(t *testing.T) {
+	data := []byte(`{
+		"key_uri_prefix": "gcp-kms://projects/p/locations/global/keyRings/r",
+		"call_timeout": "2s",
+		"method_timeouts": {"AsymmetricSign": "1.5s"},
+		"retry": {"max_attempts": 5, "initial_backoff": "50ms"},
+		"decrypt_cache": {"max_entries": 100, "ttl": "1m"}
+	}`)
+	var got gcpkms.Config
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+	}
+	want := gcpkms.Config{
+		KeyURIPrefix:   "gcp-kms://projects/p/locations/global/keyRings/r",
+		CallTimeout:    gcpkms.Duration(2 * time.Second),
+		MethodTimeouts: map[string]gcpkms.Duration{"AsymmetricSign": gcpkms.Duration(1500 * time.Millisecond)},
+		Retry:          &gcpkms.RetryConfig{MaxAttempts: 5, InitialBackoff: gcpkms.Duration(50 * time.Millisecond)},
+		DecryptCache:   &gcpkms.DecryptCacheConfig{MaxEntries: 100, TTL: gcpkms.Duration(time.Minute)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("json.Unmarshal() = %+v, want %+v", got, want)
+	}
+	marshaled, err := json.Marshal(want)
+	if err != nil {
+		t.Fatalf("json.Marshal() err = %v, want nil", err)
+	}
+	if !bytes.Contains(marshaled, []byte(`"call_timeout":"2s"`)) {
+		t.Errorf("json.Marshal() = %s, want durations as strings", marshaled)
+	}
+}
+
+func TestConfigUnmarshalRejectsInvalidJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		data string
+	}{
+		{name: "unknown field", data: `{"key_uri_prefix": "gcp-kms://", "call_timeuot": "1s"}`},
+		{name: "unknown nested field", data: `{"key_uri_prefix": "gcp-kms://", "retry": {"max_attemps": 3}}`},
+		{name: "duration in nanoseconds", data: `{"key_uri_prefix": "gcp-kms://", "call_timeout": 1000000000}`},
+		{name: "malformed duration", data: `{"key_uri_prefix": "gcp-kms://", "call_timeout": "1 second"}`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var cfg gcpkms.Config
+			if err := json.Unmarshal([]byte(tc.data), &cfg); err == nil {
+				t.Errorf("json.Unmarshal(%s) err = nil, want error", tc.data)
+			}
+		})
+	}
+}
+
+func TestConfigValidateRejectsInvalidConfigurations(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		modify func(cfg *gcpkms.Config)
+	}{
+		{name: "no key URI prefix", modify: func(cfg *gcpkms.Config) { cfg.KeyURIPrefix = "" }},
+		{name: "other scheme", modify: func(cfg *gcpkms.Config) { cfg.KeyURIPrefix = "aws-kms://key" }},
+		{name: "unknown transport", modify: func(cfg *gcpkms.Config) { cfg.Transport = "plaintext" }},
+		{name: "endpoint without TLS", modify: func(cfg *gcpkms.Config) { cfg.Endpoint = "http://localhost:8080/" }},
+		{name: "endpoint and endpoints", modify: func(cfg *gcpkms.Config) { cfg.Endpoints = []string{"https://cloudkms.example.com"} }},
+		{name: "negative call timeout", modify: func(cfg *gcpkms.Config) { cfg.CallTimeout = gcpkms.Duration(-time.Second) }},
+		{name: "unknown protection level", modify: func(cfg *gcpkms.Config) {
+			cfg.ProtectionLevelTimeouts = map[string]gcpkms.Duration{"CLOUD": gcpkms.Duration(time.Second)}
+		}},
+		{name: "unknown method", modify: func(cfg *gcpkms.Config) {
+			cfg.MethodTimeouts = map[string]gcpkms.Duration{"Sign": gcpkms.Duration(time.Second)}
+		}},
+		{name: "retry multiplier below 1", modify: func(cfg *gcpkms.Config) { cfg.Retry.Multiplier = 0.5 }},
+		{name: "retry budget ratio above 1", modify: func(cfg *gcpkms.Config) { cfg.RetryBudget.Ratio = 2 }},
+		{name: "empty required key labels", modify: func(cfg *gcpkms.Config) { cfg.RequiredKeyLabels = map[string]string{} }},
+		{name: "empty allowed key locations", modify: func(cfg *gcpkms.Config) { cfg.AllowedKeyLocations = []string{} }},
+		{name: "key location verification without allowed key locations", modify: func(cfg *gcpkms.Config) {
+			cfg.AllowedKeyLocations = nil
+			cfg.KeyLocationVerification = true
+		}},
+		{name: "negative required rotation period", modify: func(cfg *gcpkms.Config) {
+			cfg.RequiredRotationPeriod = gcpkms.Duration(-time.Hour)
+		}},
+		{name: "rotation policy exemptions without required rotation period", modify: func(cfg *gcpkms.Config) {
+			cfg.RequiredRotationPeriod = 0
+		}},
+		{name: "unknown warm-up policy", modify: func(cfg *gcpkms.Config) { cfg.Warmup = "always" }},
+		{name: "unknown project check policy", modify: func(cfg *gcpkms.Config) { cfg.ProjectCheck = "lenient" }},
+		{name: "no hedges", modify: func(cfg *gcpkms.Config) { cfg.Hedging.MaxHedges = 0 }},
+		{name: "decrypt cache without TTL", modify: func(cfg *gcpkms.Config) { cfg.DecryptCache.TTL = 0 }},
+		{name: "insecure reauthentication", modify: func(cfg *gcpkms.Config) { cfg.Transport = gcpkms.TransportInsecure }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := fullConfig()
+			tc.modify(&cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("cfg.Validate() err = nil, want error")
+			}
+			if _, err := gcpkms.NewClientFromConfig(context.Background(), cfg, gcpkms.CredentialConfig{}); err == nil {
+				t.Error("gcpkms.NewClientFromConfig() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestConfigValidateRejectsEndpointWithoutTLS(t *testing.T) {
+	cfg := gcpkms.Config{KeyURIPrefix: fakeKeyURI, Endpoint: "http://localhost:8080/"}
+	if err := cfg.Validate(); !errors.Is(err, gcpkms.ErrInsecureTransport) {
+		t.Errorf("cfg.Validate() err = %v, want %v", err, gcpkms.ErrInsecureTransport)
+	}
+	cfg.Transport = gcpkms.TransportInsecure
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("cfg.Validate() err = %v, want nil", err)
+	}
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	srv := newFakeServer(t)
+	cfg := gcpkms.Config{
+		Transport:         gcpkms.TransportInsecure,
+		KeyURIPrefix:      fakeKeyURI,
+		Endpoint:          srv.URL() + "/",
+		CallTimeout:       gcpkms.Duration(10 * time.Second),
+		Retry:             &gcpkms.RetryConfig{MaxAttempts: 2},
+		RequiredKeyLabels: map[string]string{"env": "prod"},
+	}
+	client, err := gcpkms.NewClientFromConfig(context.Background(), cfg, gcpkms.CredentialConfig{})
+	if err != nil {
+		t.Fatalf("gcpkms.NewClientFromConfig() err = %v, want nil", err)
+	}
+	defer client.Close()
+	// The key lacks the required label, so the configuration took effect.
+	if _, err := client.GetAEAD(fakeKeyURI); !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+		t.Fatalf("client.GetAEAD() err = %v, want %v", err, gcpkms.ErrKeyPolicyViolation)
+	}
+	if err := srv.SetLabels(fakeKeyName, map[string]string{"env": "prod"}); err != nil {
+		t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+	}
+
+	cfg.RequiredKeyLabels = nil
+	client, err = gcpkms.NewClientFromConfig(context.Background(), cfg, gcpkms.CredentialConfig{})
+	if err != nil {
+		t.Fatalf("gcpkms.NewClientFromConfig() err = %v, want nil", err)
+	}
+	defer client.Close()
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	ciphertext, err := a.Encrypt([]byte("plaintext"), []byte("ad"))
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got, err := a.Decrypt(ciphertext, []byte("ad")); err != nil || string(got) != "plaintext" {
+		t.Errorf("a.Decrypt() = %q, %v, want %q, nil", got, err, "plaintext")
+	}
+}
+
+func TestOptionsFromConfigComposesWithOptions(t *testing.T) {
+	srv := newFakeServer(t)
+	cfg := gcpkms.Config{
+		Transport:    gcpkms.TransportInsecure,
+		KeyURIPrefix: fakeKeyURI,
+		Endpoint:     srv.URL() + "/",
+		Warmup:       gcpkms.WarmupPolicyBestEffort,
+	}
+	opts, err := gcpkms.OptionsFromConfig(cfg, gcpkms.CredentialConfig{})
+	if err != nil {
+		t.Fatalf("gcpkms.OptionsFromConfig() err = %v, want nil", err)
+	}
+	// The warm-up fails since the prefix names a crypto key that does not
+	// exist, which is logged to the logger added to the options.
+	cfg.KeyURIPrefix = "gcp-kms://" + fakeKeyName + "-missing"
+	var logs strings.Builder
+	opts = append(opts, gcpkms.WithLogger(log.New(&logs, "", 0)))
+	client, err := gcpkms.NewClient(context.Background(), cfg.KeyURIPrefix, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	if !strings.Contains(logs.String(), "warm-up failed") {
+		t.Errorf("logs = %q, want the failed warm-up", logs.String())
+	}
+}
+
+func TestNewClientFromConfigRejectsInvalidCredentials(t *testing.T) {
+	cfg := gcpkms.Config{KeyURIPrefix: fakeKeyURI}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	for _, tc := range []struct {
+		name  string
+		creds gcpkms.CredentialConfig
+	}{
+		{name: "file and token source", creds: gcpkms.CredentialConfig{CredentialsFile: "credentials.json", TokenSource: ts}},
+		{name: "JSON and per-RPC credentials", creds: gcpkms.CredentialConfig{CredentialsJSON: []byte("{}"), PerRPCCredentials: staticCredentials{}}},
+		{name: "watch without file", creds: gcpkms.CredentialConfig{WatchCredentialsFile: true}},
+		{name: "watch of missing file", creds: gcpkms.CredentialConfig{CredentialsFile: t.TempDir() + "/missing.json", WatchCredentialsFile: true}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClientFromConfig(context.Background(), cfg, tc.creds); err == nil {
+				t.Error("gcpkms.NewClientFromConfig() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewClientFromConfigWithTokenSource(t *testing.T) {
+	srv := newAuthServer(t, func(token string) bool { return token == "static-token" })
+	cfg := gcpkms.Config{KeyURIPrefix: fakeKeyURI, Endpoint: srv.srv.URL + "/"}
+	creds := gcpkms.CredentialConfig{TokenSource: oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "static-token"})}
+	opts, err := gcpkms.OptionsFromConfig(cfg, creds)
+	if err != nil {
+		t.Fatalf("gcpkms.OptionsFromConfig() err = %v, want nil", err)
+	}
+	client, err := gcpkms.NewClient(context.Background(), cfg.KeyURIPrefix, append(opts, gcpkms.WithBaseTransport(srv.srv.Client().Transport))...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Errorf("a.Encrypt() err = %v, want nil", err)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"math/big"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	ecdsapb "github.com/tink-crypto/tink-go/v2/proto/ecdsa_go_proto"
+	rsassapkcs1pb "github.com/tink-crypto/tink-go/v2/proto/rsa_ssa_pkcs1_go_proto"
+	rsassapsspb "github.com/tink-crypto/tink-go/v2/proto/rsa_ssa_pss_go_proto"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"github.com/tink-crypto/tink-go/v2/signature"
+	"github.com/tink-crypto/tink-go/v2/signature/subtle"
+)
+
+// conformanceAlgorithms are the signing algorithms supported by the package.
+// large is true for algorithms whose keys are slow to generate.
+var conformanceAlgorithms = []struct {
+	algorithm string
+	large     bool
+}{
+	{algorithm: "EC_SIGN_P256_SHA256"},
+	{algorithm: "EC_SIGN_P384_SHA384"},
+	{algorithm: "RSA_SIGN_PKCS1_2048_SHA256"},
+	{algorithm: "RSA_SIGN_PKCS1_3072_SHA256", large: true},
+	{algorithm: "RSA_SIGN_PKCS1_4096_SHA256", large: true},
+	{algorithm: "RSA_SIGN_PKCS1_4096_SHA512", large: true},
+	{algorithm: "RSA_SIGN_PSS_2048_SHA256"},
+	{algorithm: "RSA_SIGN_PSS_3072_SHA256", large: true},
+	{algorithm: "RSA_SIGN_PSS_4096_SHA256", large: true},
+	{algorithm: "RSA_SIGN_PSS_4096_SHA512", large: true},
+}
+
+// tinkPublicKeyset returns a keyset holding pub as a Tink public key with the
+// parameters of the template returned by TinkKeyTemplateForAlgorithm, the way
+// applications mirror Cloud KMS public keys into Tink keysets.
+func tinkPublicKeyset(t *testing.T, algorithm string, pub crypto.PublicKey) *keyset.Handle {
+	t.Helper()
+	template, err := gcpkms.TinkKeyTemplateForAlgorithm(algorithm)
+	if err != nil {
+		t.Fatalf("gcpkms.TinkKeyTemplateForAlgorithm() err = %v, want nil", err)
+	}
+	var key proto.Message
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		format := new(ecdsapb.EcdsaKeyFormat)
+		if err := proto.Unmarshal(template.GetValue(), format); err != nil {
+			t.Fatalf("proto.Unmarshal() err = %v, want nil", err)
+		}
+		key = &ecdsapb.EcdsaPublicKey{Params: format.GetParams(), X: k.X.Bytes(), Y: k.Y.Bytes()}
+	case *rsa.PublicKey:
+		e := big.NewInt(int64(k.E)).Bytes()
+		if strings.Contains(template.GetTypeUrl(), "Pss") {
+			format := new(rsassapsspb.RsaSsaPssKeyFormat)
+			if err := proto.Unmarshal(template.GetValue(), format); err != nil {
+				t.Fatalf("proto.Unmarshal() err = %v, want nil", err)
+			}
+			key = &rsassapsspb.RsaSsaPssPublicKey{Params: format.GetParams(), N: k.N.Bytes(), E: e}
+		} else {
+			format := new(rsassapkcs1pb.RsaSsaPkcs1KeyFormat)
+			if err := proto.Unmarshal(template.GetValue(), format); err != nil {
+				t.Fatalf("proto.Unmarshal() err = %v, want nil", err)
+			}
+			key = &rsassapkcs1pb.RsaSsaPkcs1PublicKey{Params: format.GetParams(), N: k.N.Bytes(), E: e}
+		}
+	default:
+		t.Fatalf("unsupported public key type %T", pub)
+	}
+	value, err := proto.Marshal(key)
+	if err != nil {
+		t.Fatalf("proto.Marshal() err = %v, want nil", err)
+	}
+	handle, err := keyset.NewHandleWithNoSecrets(&tinkpb.Keyset{
+		PrimaryKeyId: 1,
+		Key: []*tinkpb.Keyset_Key{{
+			KeyData: &tinkpb.KeyData{
+				TypeUrl:         strings.Replace(template.GetTypeUrl(), "PrivateKey", "PublicKey", 1),
+				Value:           value,
+				KeyMaterialType: tinkpb.KeyData_ASYMMETRIC_PUBLIC,
+			},
+			Status:           tinkpb.KeyStatusType_ENABLED,
+			KeyId:            1,
+			OutputPrefixType: template.GetOutputPrefixType(),
+		}},
+	})
+	if err != nil {
+		t.Fatalf("keyset.NewHandleWithNoSecrets() err = %v, want nil", err)
+	}
+	return handle
+}
+
+// TestSignaturesVerifyWithTink checks that the signatures of every supported
+// algorithm verify with the standard library and with Tink verifiers of the
+// keys mirrored with TinkKeyTemplateForAlgorithm.
+func TestSignaturesVerifyWithTink(t *testing.T) {
+	for _, tc := range conformanceAlgorithms {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			if tc.large && testing.Short() {
+				t.Skip("generating large RSA keys is slow")
+			}
+			_, kms := newFakeSigningKey(t, tc.algorithm)
+			s, err := gcpkms.NewSigner(context.Background(), versionName(1), kms)
+			if err != nil {
+				t.Fatalf("gcpkms.NewSigner() err = %v, want nil", err)
+			}
+			data := []byte("data")
+			opts := s.SignerOpts()
+			h := opts.HashFunc().New()
+			h.Write(data)
+			digest := h.Sum(nil)
+			sig, err := s.Sign(nil, digest, opts)
+			if err != nil {
+				t.Fatalf("s.Sign() err = %v, want nil", err)
+			}
+
+			switch pub := s.Public().(type) {
+			case *ecdsa.PublicKey:
+				if !ecdsa.VerifyASN1(pub, digest, sig) {
+					t.Error("ecdsa.VerifyASN1() = false, want true")
+				}
+			case *rsa.PublicKey:
+				var err error
+				if pss, ok := opts.(*rsa.PSSOptions); ok {
+					err = rsa.VerifyPSS(pub, opts.HashFunc(), digest, sig, pss)
+				} else {
+					err = rsa.VerifyPKCS1v15(pub, opts.HashFunc(), digest, sig)
+				}
+				if err != nil {
+					t.Errorf("verifying with crypto/rsa failed: %v", err)
+				}
+			default:
+				t.Fatalf("s.Public() = %T, want *ecdsa.PublicKey or *rsa.PublicKey", pub)
+			}
+
+			verifier, err := signature.NewVerifier(tinkPublicKeyset(t, tc.algorithm, s.Public()))
+			if err != nil {
+				t.Fatalf("signature.NewVerifier() err = %v, want nil", err)
+			}
+			if err := verifier.Verify(sig, data); err != nil {
+				t.Errorf("verifier.Verify() err = %v, want nil", err)
+			}
+			if err := verifier.Verify(sig, []byte("other data")); err == nil {
+				t.Error("verifier.Verify() of other data err = nil, want error")
+			}
+		})
+	}
+}
+
+// TestECDSASignaturesNeedConversionToIEEEP1363 checks that ECDSA signatures
+// are DER encoded, so that Tink verifiers expecting IEEE P1363 signatures only
+// accept them once converted.
+func TestECDSASignaturesNeedConversionToIEEEP1363(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		hash      string
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256", hash: "SHA256"},
+		{algorithm: "EC_SIGN_P384_SHA384", hash: "SHA384"},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			_, kms := newFakeSigningKey(t, tc.algorithm)
+			s, err := gcpkms.NewSigner(context.Background(), versionName(1), kms)
+			if err != nil {
+				t.Fatalf("gcpkms.NewSigner() err = %v, want nil", err)
+			}
+			data := []byte("data")
+			h := s.SignerOpts().HashFunc().New()
+			h.Write(data)
+			sig, err := s.Sign(nil, h.Sum(nil), s.SignerOpts())
+			if err != nil {
+				t.Fatalf("s.Sign() err = %v, want nil", err)
+			}
+			pub := s.Public().(*ecdsa.PublicKey)
+
+			der, err := subtle.NewECDSAVerifierFromPublicKey(tc.hash, "DER", pub)
+			if err != nil {
+				t.Fatalf("subtle.NewECDSAVerifierFromPublicKey(DER) err = %v, want nil", err)
+			}
+			if err := der.Verify(sig, data); err != nil {
+				t.Errorf("DER verifier.Verify() err = %v, want nil", err)
+			}
+			ieee, err := subtle.NewECDSAVerifierFromPublicKey(tc.hash, "IEEE_P1363", pub)
+			if err != nil {
+				t.Fatalf("subtle.NewECDSAVerifierFromPublicKey(IEEE_P1363) err = %v, want nil", err)
+			}
+			if err := ieee.Verify(sig, data); err == nil {
+				t.Error("IEEE_P1363 verifier.Verify() of a DER signature err = nil, want error")
+			}
+			decoded, err := subtle.DecodeECDSASignature(sig, "DER")
+			if err != nil {
+				t.Fatalf("subtle.DecodeECDSASignature() err = %v, want nil", err)
+			}
+			converted, err := decoded.EncodeECDSASignature("IEEE_P1363", pub.Curve.Params().Name)
+			if err != nil {
+				t.Fatalf("EncodeECDSASignature() err = %v, want nil", err)
+			}
+			if err := ieee.Verify(converted, data); err != nil {
+				t.Errorf("IEEE_P1363 verifier.Verify() of the converted signature err = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"google.golang.org/grpc/connectivity"
+)
+
+// connMonitor tracks the connectivity state of the connections of a client
+// to Cloud KMS, as set with WithConnectivityCallback, and reports its
+// transitions to a callback from a watcher goroutine.
+//
+// The states follow those of a gRPC channel: the client is IDLE without open
+// connections, CONNECTING while it dials one, READY once at least one is
+// open, TRANSIENT_FAILURE if dialing failed without any open connection, and
+// SHUTDOWN once the client is closed.
+type connMonitor struct {
+	callback func(oldState, newState connectivity.State)
+
+	mu    sync.Mutex
+	state connectivity.State
+	// open is the number of open connections.
+	open int
+	// pending holds the transitions not reported yet, oldest first.
+	pending []connectivity.State
+	wake    chan struct{}
+	// stopped is closed once the watcher has reported SHUTDOWN.
+	stopped  chan struct{}
+	shutdown sync.Once
+}
+
+func newConnMonitor(callback func(oldState, newState connectivity.State)) *connMonitor {
+	return &connMonitor{
+		callback: callback,
+		state:    connectivity.Idle,
+		wake:     make(chan struct{}, 1),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// setState moves to state, and schedules the report of the transition if
+// the state changed. It does nothing once SHUTDOWN. m.mu must be held.
+func (m *connMonitor) setState(state connectivity.State) {
+	if m.state == state || m.state == connectivity.Shutdown {
+		return
+	}
+	m.state = state
+	m.pending = append(m.pending, state)
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// watch reports the transitions to the callback until SHUTDOWN has been
+// reported.
+func (m *connMonitor) watch() {
+	defer close(m.stopped)
+	old := connectivity.Idle
+	for range m.wake {
+		m.mu.Lock()
+		pending := m.pending
+		m.pending = nil
+		m.mu.Unlock()
+		for _, state := range pending {
+			m.callback(old, state)
+			old = state
+			if state == connectivity.Shutdown {
+				return
+			}
+		}
+	}
+}
+
+// close moves to SHUTDOWN and waits until the watcher has reported it.
+func (m *connMonitor) close() {
+	m.shutdown.Do(func() {
+		m.mu.Lock()
+		m.setState(connectivity.Shutdown)
+		m.mu.Unlock()
+	})
+	<-m.stopped
+}
+
+// wrapDial returns a dial function that dials with dial and tracks the
+// resulting connections.
+func (m *connMonitor) wrapDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		m.mu.Lock()
+		if m.state == connectivity.Idle || m.state == connectivity.TransientFailure {
+			m.setState(connectivity.Connecting)
+		}
+		m.mu.Unlock()
+
+		conn, err := dial(ctx, network, addr)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if err != nil {
+			if m.open == 0 {
+				m.setState(connectivity.TransientFailure)
+			}
+			return nil, err
+		}
+		m.open++
+		m.setState(connectivity.Ready)
+		return &monitoredConn{Conn: conn, m: m}, nil
+	}
+}
+
+// connClosed records that an open connection was closed.
+func (m *connMonitor) connClosed() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.open--
+	if m.open == 0 && m.state == connectivity.Ready {
+		m.setState(connectivity.Idle)
+	}
+}
+
+// monitoredConn reports its closing to a connMonitor.
+type monitoredConn struct {
+	net.Conn
+	m    *connMonitor
+	once sync.Once
+}
+
+func (c *monitoredConn) Close() error {
+	c.once.Do(c.m.connClosed)
+	return c.Conn.Close()
+}
@@ -0,0 +1,105 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/connectivity"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+type transition struct {
+	old, new connectivity.State
+}
+
+// wantTransitions waits for the transitions in want to be reported on ch, in
+// order.
+func wantTransitions(t *testing.T, ch <-chan transition, want ...transition) {
+	t.Helper()
+	for _, w := range want {
+		select {
+		case got := <-ch:
+			if got != w {
+				t.Fatalf("transition = %v -> %v, want %v -> %v", got.old, got.new, w.old, w.new)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("transition %v -> %v not reported", w.old, w.new)
+		}
+	}
+}
+
+func TestWithConnectivityCallback(t *testing.T) {
+	srv := newFakeServer(t)
+	transitions := make(chan transition, 100)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithRetrySettings(gcpkms.RetrySettings{MaxAttempts: 1}),
+		gcpkms.WithConnectivityCallback(func(oldState, newState connectivity.State) {
+			transitions <- transition{oldState, newState}
+		}))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	wantTransitions(t, transitions,
+		transition{connectivity.Idle, connectivity.Connecting},
+		transition{connectivity.Connecting, connectivity.Ready})
+
+	err = srv.Restart(func() {
+		wantTransitions(t, transitions, transition{connectivity.Ready, connectivity.Idle})
+		if _, err := a.Encrypt([]byte("plaintext"), nil); err == nil {
+			t.Error("a.Encrypt() while the server is down err = nil, want error")
+		}
+		wantTransitions(t, transitions,
+			transition{connectivity.Idle, connectivity.Connecting},
+			transition{connectivity.Connecting, connectivity.TransientFailure})
+	})
+	if err != nil {
+		t.Fatalf("srv.Restart() err = %v, want nil", err)
+	}
+
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() after restart err = %v, want nil", err)
+	}
+	wantTransitions(t, transitions,
+		transition{connectivity.TransientFailure, connectivity.Connecting},
+		transition{connectivity.Connecting, connectivity.Ready})
+
+	client.Close()
+	wantTransitions(t, transitions, transition{connectivity.Ready, connectivity.Shutdown})
+	select {
+	case got := <-transitions:
+		t.Errorf("transition %v -> %v reported after shutdown", got.old, got.new)
+	default:
+	}
+}
+
+func TestWithConnectivityCallbackRejectsNil(t *testing.T) {
+	if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithConnectivityCallback(nil)); err == nil {
+		t.Error("gcpkms.NewClient() err = nil, want error")
+	}
+}
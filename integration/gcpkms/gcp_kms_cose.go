@@ -0,0 +1,533 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"unicode/utf8"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// COSE algorithm identifiers (RFC 9053 and RFC 8230) of COSE_Sign1
+// structures.
+const (
+	COSEAlgorithmES256 = -7
+	COSEAlgorithmEdDSA = -8
+	COSEAlgorithmES384 = -35
+	COSEAlgorithmPS256 = -37
+	COSEAlgorithmPS512 = -39
+)
+
+const (
+	// coseHeaderAlg and coseHeaderCrit are the labels of the alg and crit
+	// header parameters.
+	coseHeaderAlg  = 1
+	coseHeaderCrit = 2
+	// coseSign1Tag is the CBOR tag of COSE_Sign1 structures.
+	coseSign1Tag = 18
+)
+
+// coseAlgorithms holds the COSE algorithm of the Cloud KMS signing
+// algorithms that have one, by name. The RSASSA-PKCS1-v1_5 algorithms of RFC
+// 8812 are left out, as COSE applications should not use them.
+var coseAlgorithms = map[string]int64{
+	"EC_SIGN_ED25519":          COSEAlgorithmEdDSA,
+	"EC_SIGN_P256_SHA256":      COSEAlgorithmES256,
+	"EC_SIGN_P384_SHA384":      COSEAlgorithmES384,
+	"RSA_SIGN_PSS_2048_SHA256": COSEAlgorithmPS256,
+	"RSA_SIGN_PSS_3072_SHA256": COSEAlgorithmPS256,
+	"RSA_SIGN_PSS_4096_SHA256": COSEAlgorithmPS256,
+	"RSA_SIGN_PSS_4096_SHA512": COSEAlgorithmPS512,
+}
+
+// coseAlgorithm returns the COSE algorithm of the Cloud KMS signing algorithm
+// with the given name.
+func coseAlgorithm(algorithm string) (int64, error) {
+	alg, ok := coseAlgorithms[algorithm]
+	if !ok {
+		return 0, fmt.Errorf("signing algorithm %q has no COSE algorithm", algorithm)
+	}
+	return alg, nil
+}
+
+// SignCOSE returns a tagged COSE_Sign1 structure (RFC 9052) holding payload,
+// signed with the Cloud KMS asymmetric signing key version with the given
+// resource name, e.g.
+// "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+//
+// The protected header holds the entries of protectedHeaders, with alg (1)
+// set to the COSE algorithm of the key's algorithm: ES256 or ES384 for
+// EC_SIGN_P256_SHA256 or EC_SIGN_P384_SHA384 keys, PS256 or PS512 for
+// RSA_SIGN_PSS_*_SHA256 or RSA_SIGN_PSS_4096_SHA512 keys, and EdDSA for
+// EC_SIGN_ED25519 keys, which sign the Sig_structure itself rather than a
+// digest of it. protectedHeaders
+// must not set alg to a different algorithm. Header values may be integers,
+// strings, byte slices, booleans, nil, []any and map[int]any or
+// map[string]any of these. The unprotected header is empty, there is no
+// external associated data, and ECDSA signatures are encoded as the
+// fixed-size concatenation of R and S as COSE requires.
+//
+// The structure is encoded with the core deterministic encoding of CBOR (RFC
+// 8949, section 4.2.1), so that the same headers and payload always encode to
+// the same protected header. All requests are bound to ctx.
+func SignCOSE(ctx context.Context, protectedHeaders map[int]any, payload []byte, keyName string, kms *cloudkms.Service) ([]byte, error) {
+	s, err := newSigner(ctx, keyName, kms, nil, callTimeouts{}, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	pub := s.publicKey()
+	alg, err := coseAlgorithm(pub.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	headers := make(map[int]any, len(protectedHeaders)+1)
+	for k, v := range protectedHeaders {
+		headers[k] = v
+	}
+	if v, ok := headers[coseHeaderAlg]; ok {
+		if n, ok := cborInt(v); !ok || n != alg {
+			return nil, fmt.Errorf("protected headers set alg to %v, but the key's algorithm is %d", v, alg)
+		}
+	}
+	headers[coseHeaderAlg] = alg
+	protected, err := cborAppend(nil, headers)
+	if err != nil {
+		return nil, fmt.Errorf("encoding protected headers failed: %v", err)
+	}
+
+	signature, err := signData(ctx, s, coseSigStructure(protected, payload))
+	if err != nil {
+		return nil, err
+	}
+	if pub.alg.curve != nil {
+		if signature, err = rawECDSASignature(signature, (pub.alg.curve.Params().BitSize+7)/8); err != nil {
+			return nil, err
+		}
+	}
+	b := cborAppendHead(nil, cborTag, coseSign1Tag)
+	b = cborAppendHead(b, cborArray, 4)
+	b = cborAppendBytes(b, protected)
+	b = cborAppendHead(b, cborMap, 0)
+	b = cborAppendBytes(b, payload)
+	return cborAppendBytes(b, signature), nil
+}
+
+// VerifyCOSE returns the payload of the COSE_Sign1 structure message, tagged
+// or not, if its signature is a valid signature by the key pub without
+// external associated data. ECDSA keys on P-256 and P-384, RSA keys and
+// Ed25519 keys are supported, e.g. the public key returned by Signer.Public.
+//
+// The algorithm is taken from the alg parameter of the protected header,
+// which must match the type of pub. Structures whose protected header has a
+// crit parameter, or whose payload is detached, are rejected. The
+// unprotected header is not checked.
+func VerifyCOSE(message []byte, pub crypto.PublicKey) ([]byte, error) {
+	v, rest, err := cborDecode(message, 0)
+	if err != nil {
+		return nil, fmt.Errorf("malformed COSE_Sign1: %v", err)
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("malformed COSE_Sign1: trailing data")
+	}
+	if tag, ok := v.(cborTagged); ok {
+		if tag.number != coseSign1Tag {
+			return nil, fmt.Errorf("malformed COSE_Sign1: tag %d, want %d", tag.number, coseSign1Tag)
+		}
+		v = tag.value
+	}
+	a, ok := v.([]any)
+	if !ok || len(a) != 4 {
+		return nil, errors.New("malformed COSE_Sign1: not an array of 4 items")
+	}
+	protected, ok1 := a[0].([]byte)
+	_, ok2 := a[1].(map[any]any)
+	signature, ok4 := a[3].([]byte)
+	if !ok1 || !ok2 || !ok4 {
+		return nil, errors.New("malformed COSE_Sign1")
+	}
+	payload, ok := a[2].([]byte)
+	if !ok {
+		return nil, errors.New("detached payloads are not supported")
+	}
+	headers := map[any]any{}
+	if len(protected) > 0 {
+		v, rest, err := cborDecode(protected, 0)
+		if err != nil {
+			return nil, fmt.Errorf("malformed protected header: %v", err)
+		}
+		if headers, ok = v.(map[any]any); !ok || len(rest) != 0 {
+			return nil, errors.New("malformed protected header")
+		}
+	}
+	if _, ok := headers[int64(coseHeaderCrit)]; ok {
+		return nil, errors.New("critical header parameters are not supported")
+	}
+	alg, ok := headers[int64(coseHeaderAlg)].(int64)
+	if !ok {
+		return nil, errors.New("protected header has no integer alg parameter")
+	}
+	if err := verifyCOSESignature(pub, alg, signature, coseSigStructure(protected, payload)); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
+
+// verifyCOSESignature returns nil if signature is a valid signature of data by
+// pub with the given COSE algorithm.
+func verifyCOSESignature(pub crypto.PublicKey, alg int64, signature, data []byte) error {
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		var hash crypto.Hash
+		switch {
+		case alg == COSEAlgorithmES256 && k.Curve == elliptic.P256():
+			hash = crypto.SHA256
+		case alg == COSEAlgorithmES384 && k.Curve == elliptic.P384():
+			hash = crypto.SHA384
+		default:
+			return fmt.Errorf("algorithm %d does not match the ECDSA key", alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		h := hash.New()
+		h.Write(data)
+		if !ecdsa.Verify(k, h.Sum(nil), new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		var hash crypto.Hash
+		switch alg {
+		case COSEAlgorithmPS256:
+			hash = crypto.SHA256
+		case COSEAlgorithmPS512:
+			hash = crypto.SHA512
+		default:
+			return fmt.Errorf("algorithm %d does not match the RSA key", alg)
+		}
+		h := hash.New()
+		h.Write(data)
+		return rsa.VerifyPSS(k, hash, h.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case ed25519.PublicKey:
+		if alg != COSEAlgorithmEdDSA {
+			return fmt.Errorf("algorithm %d does not match the Ed25519 key", alg)
+		}
+		if !ed25519.Verify(k, data, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// coseSigStructure returns the encoded Sig_structure of a COSE_Sign1
+// structure without external associated data.
+func coseSigStructure(protected, payload []byte) []byte {
+	b := cborAppendHead(nil, cborArray, 4)
+	b = cborAppendString(b, "Signature1")
+	b = cborAppendBytes(b, protected)
+	b = cborAppendBytes(b, nil)
+	return cborAppendBytes(b, payload)
+}
+
+// CBOR major types.
+const (
+	cborUint   = 0
+	cborNegInt = 1
+	cborBytes  = 2
+	cborText   = 3
+	cborArray  = 4
+	cborMap    = 5
+	cborTag    = 6
+	cborSimple = 7
+)
+
+// CBOR simple values.
+const (
+	cborFalse = 20
+	cborTrue  = 21
+	cborNull  = 22
+)
+
+// cborMaxDepth is the maximum nesting depth of decoded data items.
+const cborMaxDepth = 16
+
+// cborAppendHead appends the head of a data item of the given major type and
+// argument, in its shortest form.
+func cborAppendHead(b []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(b, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, m|26), uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64(append(b, m|27), n)
+	}
+}
+
+func cborAppendBytes(b, v []byte) []byte {
+	return append(cborAppendHead(b, cborBytes, uint64(len(v))), v...)
+}
+
+func cborAppendString(b []byte, v string) []byte {
+	return append(cborAppendHead(b, cborText, uint64(len(v))), v...)
+}
+
+// cborInt returns v as an int64 if it is an integer that fits.
+func cborInt(v any) (int64, bool) {
+	switch n := v.(type) {
+	case int:
+		return int64(n), true
+	case int8:
+		return int64(n), true
+	case int16:
+		return int64(n), true
+	case int32:
+		return int64(n), true
+	case int64:
+		return n, true
+	case uint:
+		return int64(n), uint64(n) <= math.MaxInt64
+	case uint8:
+		return int64(n), true
+	case uint16:
+		return int64(n), true
+	case uint32:
+		return int64(n), true
+	case uint64:
+		return int64(n), n <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// cborAppend appends the deterministic encoding of v: map entries are sorted
+// by the bytewise order of their encoded keys, and all lengths and integers
+// are encoded in their shortest form.
+func cborAppend(b []byte, v any) ([]byte, error) {
+	if n, ok := cborInt(v); ok {
+		if n < 0 {
+			return cborAppendHead(b, cborNegInt, uint64(-1-n)), nil
+		}
+		return cborAppendHead(b, cborUint, uint64(n)), nil
+	}
+	switch v := v.(type) {
+	case uint:
+		return cborAppendHead(b, cborUint, uint64(v)), nil
+	case uint64:
+		return cborAppendHead(b, cborUint, v), nil
+	case []byte:
+		return cborAppendBytes(b, v), nil
+	case string:
+		if !utf8.ValidString(v) {
+			return nil, fmt.Errorf("string %q is not valid UTF-8", v)
+		}
+		return cborAppendString(b, v), nil
+	case bool:
+		if v {
+			return append(b, cborSimple<<5|cborTrue), nil
+		}
+		return append(b, cborSimple<<5|cborFalse), nil
+	case nil:
+		return append(b, cborSimple<<5|cborNull), nil
+	case []any:
+		b = cborAppendHead(b, cborArray, uint64(len(v)))
+		for _, e := range v {
+			var err error
+			if b, err = cborAppend(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case map[int]any:
+		entries := make(map[any]any, len(v))
+		for k, e := range v {
+			entries[k] = e
+		}
+		return cborAppendMap(b, entries)
+	case map[string]any:
+		entries := make(map[any]any, len(v))
+		for k, e := range v {
+			entries[k] = e
+		}
+		return cborAppendMap(b, entries)
+	default:
+		return nil, fmt.Errorf("unsupported value %v of type %T", v, v)
+	}
+}
+
+// cborAppendMap appends the deterministic encoding of the map m.
+func cborAppendMap(b []byte, m map[any]any) ([]byte, error) {
+	type entry struct{ key, value []byte }
+	entries := make([]entry, 0, len(m))
+	for k, v := range m {
+		key, err := cborAppend(nil, k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := cborAppend(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key, value})
+	}
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].key, entries[j].key) < 0 })
+	b = cborAppendHead(b, cborMap, uint64(len(entries)))
+	for _, e := range entries {
+		b = append(append(b, e.key...), e.value...)
+	}
+	return b, nil
+}
+
+// cborTagged is a tagged CBOR data item.
+type cborTagged struct {
+	number uint64
+	value  any
+}
+
+// cborDecode decodes the data item at the start of b, nested depth levels
+// deep, and returns it with the bytes that follow it. Integers are returned
+// as int64, byte and text strings as []byte and string, arrays as []any,
+// maps, whose keys must be integers or text strings, as map[any]any and tags
+// as cborTagged. Floating-point numbers and indefinite lengths are not
+// supported.
+func cborDecode(b []byte, depth int) (any, []byte, error) {
+	if depth > cborMaxDepth {
+		return nil, nil, errors.New("too deeply nested")
+	}
+	if len(b) == 0 {
+		return nil, nil, errors.New("unexpected end of data")
+	}
+	major, info := b[0]>>5, b[0]&0x1f
+	b = b[1:]
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info <= 27:
+		size := 1 << (info - 24)
+		if len(b) < size {
+			return nil, nil, errors.New("unexpected end of data")
+		}
+		for _, c := range b[:size] {
+			n = n<<8 | uint64(c)
+		}
+		b = b[size:]
+	default:
+		return nil, nil, fmt.Errorf("unsupported additional information %d", info)
+	}
+	switch major {
+	case cborUint:
+		if n > math.MaxInt64 {
+			return nil, nil, errors.New("integer out of range")
+		}
+		return int64(n), b, nil
+	case cborNegInt:
+		if n > math.MaxInt64 {
+			return nil, nil, errors.New("integer out of range")
+		}
+		return -1 - int64(n), b, nil
+	case cborBytes, cborText:
+		if n > uint64(len(b)) {
+			return nil, nil, errors.New("unexpected end of data")
+		}
+		if major == cborText {
+			if !utf8.Valid(b[:n]) {
+				return nil, nil, errors.New("text string is not valid UTF-8")
+			}
+			return string(b[:n]), b[n:], nil
+		}
+		return append([]byte(nil), b[:n]...), b[n:], nil
+	case cborArray:
+		if n > uint64(len(b)) {
+			return nil, nil, errors.New("unexpected end of data")
+		}
+		a := make([]any, 0, n)
+		for i := uint64(0); i < n; i++ {
+			var v any
+			var err error
+			if v, b, err = cborDecode(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			a = append(a, v)
+		}
+		return a, b, nil
+	case cborMap:
+		if n > uint64(len(b))/2 {
+			return nil, nil, errors.New("unexpected end of data")
+		}
+		m := make(map[any]any, n)
+		for i := uint64(0); i < n; i++ {
+			var k, v any
+			var err error
+			if k, b, err = cborDecode(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("unsupported map key of type %T", k)
+			}
+			if _, ok := m[k]; ok {
+				return nil, nil, fmt.Errorf("duplicate map key %v", k)
+			}
+			if v, b, err = cborDecode(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, b, nil
+	case cborTag:
+		v, b, err := cborDecode(b, depth+1)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cborTagged{number: n, value: v}, b, nil
+	default:
+		if info >= 24 {
+			return nil, nil, errors.New("unsupported simple value or floating-point number")
+		}
+		switch n {
+		case cborFalse:
+			return false, b, nil
+		case cborTrue:
+			return true, b, nil
+		case cborNull:
+			return nil, b, nil
+		}
+		return nil, nil, fmt.Errorf("unsupported simple value %d", n)
+	}
+}
@@ -0,0 +1,306 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		t.Fatalf("hex.DecodeString(%q) err = %v, want nil", s, err)
+	}
+	return b
+}
+
+// bytesHead returns the head of a CBOR byte string of n < 256 bytes.
+func bytesHead(n int) []byte {
+	if n < 24 {
+		return []byte{0x40 + byte(n)}
+	}
+	return []byte{0x58, byte(n)}
+}
+
+const cosePayload = "This is the content."
+
+func TestSignCOSE(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		// hash is zero if the Sig_structure is signed as is.
+		hash crypto.Hash
+		// alg is the encoding of the COSE algorithm identifier.
+		alg string
+		// sigHead is the head of the signature byte string.
+		sigHead string
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256", hash: crypto.SHA256, alg: "26", sigHead: "5840"},
+		{algorithm: "EC_SIGN_P384_SHA384", hash: crypto.SHA384, alg: "3822", sigHead: "5860"},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", hash: crypto.SHA256, alg: "3824", sigHead: "590100"},
+		{algorithm: "RSA_SIGN_PSS_4096_SHA512", hash: crypto.SHA512, alg: "3826", sigHead: "590200"},
+		{algorithm: "EC_SIGN_ED25519", alg: "27", sigHead: "5840"},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			_, kms := newFakeSigningKey(t, tc.algorithm)
+			version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+			headers := map[int]any{3: "application/json", 4: []byte("key-1")}
+			msg, err := gcpkms.SignCOSE(context.Background(), headers, []byte(cosePayload), version, kms)
+			if err != nil {
+				t.Fatalf("gcpkms.SignCOSE() err = %v, want nil", err)
+			}
+			if _, ok := headers[1]; ok {
+				t.Error("gcpkms.SignCOSE() modified protectedHeaders")
+			}
+
+			// {1: alg, 3: "application/json", 4: h'6b65792d31'}
+			protected := mustHex(t, "a3 01"+tc.alg+" 03 70 6170706c69636174696f6e2f6a736f6e 04 45 6b65792d31")
+			// 18([protected, {}, payload, signature])
+			prefix := mustHex(t, "d2 84")
+			prefix = append(prefix, bytesHead(len(protected))...)
+			prefix = append(prefix, protected...)
+			prefix = append(prefix, mustHex(t, "a0 54")...)
+			prefix = append(prefix, cosePayload...)
+			prefix = append(prefix, mustHex(t, tc.sigHead)...)
+			if !bytes.HasPrefix(msg, prefix) {
+				t.Fatalf("gcpkms.SignCOSE() = %x, want prefix %x", msg, prefix)
+			}
+			signature := msg[len(prefix):]
+
+			// ["Signature1", protected, h'', payload]
+			toBeSigned := mustHex(t, "84 6a 5369676e617475726531")
+			toBeSigned = append(toBeSigned, bytesHead(len(protected))...)
+			toBeSigned = append(toBeSigned, protected...)
+			toBeSigned = append(toBeSigned, mustHex(t, "40 54")...)
+			toBeSigned = append(toBeSigned, cosePayload...)
+			var digest []byte
+			if tc.hash != 0 {
+				h := tc.hash.New()
+				h.Write(toBeSigned)
+				digest = h.Sum(nil)
+			}
+			switch pub := kmsPublicKey(t, kms, version).(type) {
+			case *ecdsa.PublicKey:
+				size := len(signature) / 2
+				if !ecdsa.Verify(pub, digest, new(big.Int).SetBytes(signature[:size]), new(big.Int).SetBytes(signature[size:])) {
+					t.Error("signature does not verify over the expected Sig_structure")
+				}
+			case *rsa.PublicKey:
+				if err := rsa.VerifyPSS(pub, tc.hash, digest, signature, &rsa.PSSOptions{SaltLength: tc.hash.Size()}); err != nil {
+					t.Errorf("signature does not verify over the expected Sig_structure: %v", err)
+				}
+			case ed25519.PublicKey:
+				if !ed25519.Verify(pub, toBeSigned, signature) {
+					t.Error("signature does not verify over the expected Sig_structure")
+				}
+			default:
+				t.Fatalf("public key has unexpected type %T", pub)
+			}
+
+			s, err := gcpkms.NewSigner(context.Background(), version, kms)
+			if err != nil {
+				t.Fatalf("gcpkms.NewSigner() err = %v, want nil", err)
+			}
+			payload, err := gcpkms.VerifyCOSE(msg, s.Public())
+			if err != nil {
+				t.Fatalf("gcpkms.VerifyCOSE() err = %v, want nil", err)
+			}
+			if string(payload) != cosePayload {
+				t.Errorf("gcpkms.VerifyCOSE() = %q, want %q", payload, cosePayload)
+			}
+		})
+	}
+}
+
+func TestSignCOSEEncodesHeadersDeterministically(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+	headers := map[int]any{
+		1:   int64(-7),
+		-1:  uint8(1),
+		24:  "x",
+		100: []any{1, "a"},
+		3:   map[string]any{"b": true, "a": nil},
+	}
+	msg, err := gcpkms.SignCOSE(context.Background(), headers, nil, version, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.SignCOSE() err = %v, want nil", err)
+	}
+	// Keys sorted by their encodings: 1, 3, 24, 100, -1.
+	protected := mustHex(t, "a5 01 26 03 a2 6161 f6 6162 f5 1818 6178 1864 82 01 6161 20 01")
+	want := append(mustHex(t, "d2 84"), bytesHead(len(protected))...)
+	want = append(want, protected...)
+	want = append(want, mustHex(t, "a0 40 5840")...)
+	if !bytes.HasPrefix(msg, want) {
+		t.Errorf("gcpkms.SignCOSE() = %x, want prefix %x", msg, want)
+	}
+}
+
+func TestSignCOSERejectsInvalidHeaders(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+	for _, headers := range []map[int]any{
+		{1: -35},
+		{1: "ES256"},
+		{3: 1.5},
+		{3: struct{}{}},
+		{3: "\xff"},
+		{3: map[int]any{1: []any{float32(1)}}},
+	} {
+		if _, err := gcpkms.SignCOSE(context.Background(), headers, []byte(cosePayload), version, kms); err == nil {
+			t.Errorf("gcpkms.SignCOSE(%v) err = nil, want error", headers)
+		}
+	}
+}
+
+func TestSignCOSERejectsInvalidKeyNames(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	for _, name := range []string{"", fakeSigningKeyName, fakeSigningKeyName + "/cryptoKeyVersions/2"} {
+		if _, err := gcpkms.SignCOSE(context.Background(), nil, []byte(cosePayload), name, kms); err == nil {
+			t.Errorf("gcpkms.SignCOSE(%q) err = nil, want error", name)
+		}
+	}
+}
+
+// rfc9052Sign1 is the COSE_Sign1 example of RFC 9052, appendix C.2.1, signed
+// with ES256 by the example key "11" of the COSE working group.
+const rfc9052Sign1 = `d2 84 43 a10126 a1 04 42 3131 54 546869732069732074686520636f6e74656e742e
+	5840 8eb33e4ca31d1c465ab05aac34cc6b23d58fef5c083106c4d25a91aef0b0117e
+	2af9a291aa32e14ab834dc56ed2a223444547e01f11d3b0916e5a4c345cacb36`
+
+func rfc9052Key(t *testing.T) *ecdsa.PublicKey {
+	t.Helper()
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(mustHex(t, "bac5b11cad8f99f9c72b05cf4b9e26d244dc189f745228255a219a86d6a09eff")),
+		Y:     new(big.Int).SetBytes(mustHex(t, "20138bf82dc1b6d562be0fa54ab7804a3a64b6d72ccfed6b6fb6ed28bbfc117e")),
+	}
+}
+
+func TestVerifyCOSERFC9052Vector(t *testing.T) {
+	msg := mustHex(t, rfc9052Sign1)
+	payload, err := gcpkms.VerifyCOSE(msg, rfc9052Key(t))
+	if err != nil {
+		t.Fatalf("gcpkms.VerifyCOSE() err = %v, want nil", err)
+	}
+	if string(payload) != cosePayload {
+		t.Errorf("gcpkms.VerifyCOSE() = %q, want %q", payload, cosePayload)
+	}
+	// The untagged structure.
+	if _, err := gcpkms.VerifyCOSE(msg[1:], rfc9052Key(t)); err != nil {
+		t.Errorf("gcpkms.VerifyCOSE() of the untagged structure err = %v, want nil", err)
+	}
+
+	tampered := append([]byte(nil), msg...)
+	tampered[bytes.Index(tampered, []byte(cosePayload))] ^= 1
+	if _, err := gcpkms.VerifyCOSE(tampered, rfc9052Key(t)); err == nil {
+		t.Error("gcpkms.VerifyCOSE() of a modified payload err = nil, want error")
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() err = %v, want nil", err)
+	}
+	if _, err := gcpkms.VerifyCOSE(msg, &other.PublicKey); err == nil {
+		t.Error("gcpkms.VerifyCOSE() with another key err = nil, want error")
+	}
+}
+
+func TestVerifyCOSEEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() err = %v, want nil", err)
+	}
+	// {1: -8}
+	protected := mustHex(t, "a1 01 27")
+	toBeSigned := append(mustHex(t, "84 6a 5369676e617475726531 43"), protected...)
+	toBeSigned = append(append(toBeSigned, mustHex(t, "40 54")...), cosePayload...)
+	msg := append(mustHex(t, "d2 84 43"), protected...)
+	msg = append(append(msg, mustHex(t, "a0 54")...), cosePayload...)
+	msg = append(append(msg, mustHex(t, "5840")...), ed25519.Sign(priv, toBeSigned)...)
+	payload, err := gcpkms.VerifyCOSE(msg, pub)
+	if err != nil {
+		t.Fatalf("gcpkms.VerifyCOSE() err = %v, want nil", err)
+	}
+	if string(payload) != cosePayload {
+		t.Errorf("gcpkms.VerifyCOSE() = %q, want %q", payload, cosePayload)
+	}
+}
+
+func TestVerifyCOSERejectsInvalidStructures(t *testing.T) {
+	const signature = "5840 8eb33e4ca31d1c465ab05aac34cc6b23d58fef5c083106c4d25a91aef0b0117e 2af9a291aa32e14ab834dc56ed2a223444547e01f11d3b0916e5a4c345cacb36"
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name string
+		msg  string
+		pub  crypto.PublicKey
+	}{
+		{name: "empty", msg: ""},
+		{name: "other tag", msg: "d1" + rfc9052Sign1[2:]},
+		{name: "trailing data", msg: rfc9052Sign1 + "00"},
+		{name: "truncated", msg: rfc9052Sign1[:len(rfc9052Sign1)-2]},
+		{name: "three items", msg: "d2 83 43 a10126 a1 04 42 3131 54 546869732069732074686520636f6e74656e742e"},
+		{name: "detached payload", msg: "d2 84 43 a10126 a0 f6 " + signature},
+		{name: "no alg", msg: "d2 84 41 a0 a0 54 546869732069732074686520636f6e74656e742e " + signature},
+		{name: "alg in unprotected header", msg: "d2 84 40 a1 01 26 54 546869732069732074686520636f6e74656e742e " + signature},
+		{name: "crit", msg: "d2 84 47 a2 01 26 02 81 04 a0 54 546869732069732074686520636f6e74656e742e " + signature},
+		{name: "duplicate protected header", msg: "d2 84 45 a2 01 26 01 26 a0 54 546869732069732074686520636f6e74656e742e " + signature},
+		{name: "indefinite length", msg: "d2 9f 43 a10126 a0 54 546869732069732074686520636f6e74656e742e " + signature + " ff"},
+		{name: "floating-point alg", msg: "d2 84 44 a1 01 f9 3c00 a0 54 546869732069732074686520636f6e74656e742e " + signature},
+		{name: "key of another type", msg: rfc9052Sign1, pub: &rsaKey.PublicKey},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pub := tc.pub
+			if pub == nil {
+				pub = rfc9052Key(t)
+			}
+			if _, err := gcpkms.VerifyCOSE(mustHex(t, tc.msg), pub); err == nil {
+				t.Error("gcpkms.VerifyCOSE() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyCOSERejectsDeeplyNestedStructures(t *testing.T) {
+	msg := bytes.Repeat([]byte{0x81}, 100000)
+	if _, err := gcpkms.VerifyCOSE(msg, rfc9052Key(t)); err == nil {
+		t.Error("gcpkms.VerifyCOSE() err = nil, want error")
+	}
+}
+
+func TestCOSEAlgorithmRejectsAlgorithmsWithoutMapping(t *testing.T) {
+	for _, algorithm := range []string{"RSA_SIGN_PKCS1_2048_SHA256", "EC_SIGN_SECP256K1_SHA256", "HMAC_SHA256", ""} {
+		if alg, err := gcpkms.COSEAlgorithm(algorithm); err == nil {
+			t.Errorf("gcpkms.COSEAlgorithm(%q) = %d, want error", algorithm, alg)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+var (
+	// ErrChecksumMissing is returned by VerifyCRC32C if there is no checksum
+	// to verify.
+	ErrChecksumMissing = errors.New("gcpkms: CRC32C checksum is missing")
+	// ErrChecksumMismatch is returned by VerifyCRC32C if the checksum does not
+	// match the data, which means that the data was corrupted.
+	ErrChecksumMismatch = errors.New("gcpkms: CRC32C checksum mismatch")
+)
+
+// ComputeCRC32C returns the CRC32C (Castagnoli) checksum of data, in the
+// format of the *_crc32c fields of Cloud KMS requests and responses.
+func ComputeCRC32C(data []byte) int64 {
+	return int64(crc32.Checksum(data, crc32cTable))
+}
+
+// VerifyCRC32C checks that want, e.g. a *_crc32c field of a Cloud KMS
+// response, is the CRC32C checksum of data. It returns an error wrapping
+// ErrChecksumMissing if want is nil, and ErrChecksumMismatch if the checksum
+// does not match.
+func VerifyCRC32C(data []byte, want *wrapperspb.Int64Value) error {
+	if want == nil {
+		return ErrChecksumMissing
+	}
+	if got := ComputeCRC32C(data); got != want.GetValue() {
+		return fmt.Errorf("%w: got %d, want %d", ErrChecksumMismatch, got, want.GetValue())
+	}
+	return nil
+}
+
+// VerifyStoredChecksum checks that crc32c, as returned by
+// AEAD.EncryptWithChecksum, is the CRC32C checksum of ciphertext, e.g. to
+// detect that a stored ciphertext was corrupted at rest without sending it to
+// Cloud KMS. It returns an error wrapping ErrChecksumMismatch if the checksum
+// does not match.
+func VerifyStoredChecksum(ciphertext []byte, crc32c int64) error {
+	return VerifyCRC32C(ciphertext, wrapperspb.Int64(crc32c))
+}
+
+// The ForceSendFields set by the Set*Checksums functions. Their length equals
+// their capacity, so that appending to them copies them.
+var (
+	encryptChecksumFields = []string{"PlaintextCrc32c", "AdditionalAuthenticatedDataCrc32c"}
+	decryptChecksumFields = []string{"CiphertextCrc32c", "AdditionalAuthenticatedDataCrc32c"}
+	signChecksumFields     = []string{"DigestCrc32c"}
+	signDataChecksumFields = []string{"DataCrc32c"}
+	macSignChecksumFields  = []string{"DataCrc32c"}
+)
+
+// forceSend returns forceSendFields with fields added. If forceSendFields is
+// empty, fields itself is returned, to avoid an allocation.
+func forceSend(forceSendFields, fields []string) []string {
+	if len(forceSendFields) == 0 {
+		return fields
+	}
+	return append(forceSendFields, fields...)
+}
+
+// optionalChecksum returns the checksum held by a *_crc32c field of a JSON
+// response, in which a zero checksum cannot be told apart from an absent one.
+// It returns nil, i.e. missing, for zero.
+func optionalChecksum(v int64) *wrapperspb.Int64Value {
+	if v == 0 {
+		return nil
+	}
+	return wrapperspb.Int64(v)
+}
+
+// SetEncryptRequestChecksums sets the CRC32C checksums of plaintext and
+// associatedData, which must be the data held by req, in req, so that Cloud
+// KMS rejects the request if it was corrupted in transit. The checksums are
+// sent even if they are zero.
+func SetEncryptRequestChecksums(req *cloudkms.EncryptRequest, plaintext, associatedData []byte) {
+	req.PlaintextCrc32c = ComputeCRC32C(plaintext)
+	req.AdditionalAuthenticatedDataCrc32c = ComputeCRC32C(associatedData)
+	req.ForceSendFields = forceSend(req.ForceSendFields, encryptChecksumFields)
+}
+
+// SetDecryptRequestChecksums sets the CRC32C checksums of ciphertext and
+// associatedData, which must be the data held by req, in req, so that Cloud
+// KMS rejects the request if it was corrupted in transit. The checksums are
+// sent even if they are zero.
+func SetDecryptRequestChecksums(req *cloudkms.DecryptRequest, ciphertext, associatedData []byte) {
+	req.CiphertextCrc32c = ComputeCRC32C(ciphertext)
+	req.AdditionalAuthenticatedDataCrc32c = ComputeCRC32C(associatedData)
+	req.ForceSendFields = forceSend(req.ForceSendFields, decryptChecksumFields)
+}
+
+// SetAsymmetricSignRequestChecksum sets the CRC32C checksum of digest, which
+// must be the digest held by req, in req, so that Cloud KMS rejects the
+// request if it was corrupted in transit. The checksum is sent even if it is
+// zero.
+func SetAsymmetricSignRequestChecksum(req *cloudkms.AsymmetricSignRequest, digest []byte) {
+	req.DigestCrc32c = ComputeCRC32C(digest)
+	req.ForceSendFields = forceSend(req.ForceSendFields, signChecksumFields)
+}
+
+// SetAsymmetricSignRequestDataChecksum is like
+// SetAsymmetricSignRequestChecksum, but for requests that hold data rather
+// than a digest, as those for EC_SIGN_ED25519 keys do.
+func SetAsymmetricSignRequestDataChecksum(req *cloudkms.AsymmetricSignRequest, data []byte) {
+	req.DataCrc32c = ComputeCRC32C(data)
+	req.ForceSendFields = forceSend(req.ForceSendFields, signDataChecksumFields)
+}
+
+// SetMacSignRequestChecksum sets the CRC32C checksum of data, which must be
+// the data held by req, in req, so that Cloud KMS rejects the request if it
+// was corrupted in transit. The checksum is sent even if it is zero.
+func SetMacSignRequestChecksum(req *cloudkms.MacSignRequest, data []byte) {
+	req.DataCrc32c = ComputeCRC32C(data)
+	req.ForceSendFields = forceSend(req.ForceSendFields, macSignChecksumFields)
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// crc32cVectors are the CRC32C test vectors of RFC 3720, Appendix B.4, and
+// the check value of the CRC catalogue.
+var crc32cVectors = []struct {
+	name string
+	data []byte
+	want int64
+}{
+	{name: "empty", data: nil, want: 0},
+	{name: "check value", data: []byte("123456789"), want: 0xe3069283},
+	{name: "32 zero bytes", data: make([]byte, 32), want: 0x8a9136aa},
+	{name: "32 0xff bytes", data: bytes.Repeat([]byte{0xff}, 32), want: 0x62a8ab43},
+	{name: "32 incrementing bytes", data: []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+	}, want: 0x46dd794e},
+	{name: "32 decrementing bytes", data: []byte{
+		0x1f, 0x1e, 0x1d, 0x1c, 0x1b, 0x1a, 0x19, 0x18, 0x17, 0x16, 0x15, 0x14, 0x13, 0x12, 0x11, 0x10,
+		0x0f, 0x0e, 0x0d, 0x0c, 0x0b, 0x0a, 0x09, 0x08, 0x07, 0x06, 0x05, 0x04, 0x03, 0x02, 0x01, 0x00,
+	}, want: 0x113fdb5c},
+}
+
+func TestComputeCRC32C(t *testing.T) {
+	for _, tc := range crc32cVectors {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := gcpkms.ComputeCRC32C(tc.data); got != tc.want {
+				t.Errorf("gcpkms.ComputeCRC32C() = %#x, want %#x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCRC32C(t *testing.T) {
+	for _, tc := range crc32cVectors {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := gcpkms.VerifyCRC32C(tc.data, wrapperspb.Int64(tc.want)); err != nil {
+				t.Errorf("gcpkms.VerifyCRC32C() err = %v, want nil", err)
+			}
+			if err := gcpkms.VerifyCRC32C(tc.data, wrapperspb.Int64(tc.want^1)); !errors.Is(err, gcpkms.ErrChecksumMismatch) {
+				t.Errorf("gcpkms.VerifyCRC32C() with wrong checksum err = %v, want %v", err, gcpkms.ErrChecksumMismatch)
+			}
+			if err := gcpkms.VerifyCRC32C(tc.data, nil); !errors.Is(err, gcpkms.ErrChecksumMissing) {
+				t.Errorf("gcpkms.VerifyCRC32C() without checksum err = %v, want %v", err, gcpkms.ErrChecksumMissing)
+			}
+		})
+	}
+}
+
+func TestSetRequestChecksums(t *testing.T) {
+	// Empty data has a zero checksum, which must still be sent.
+	encryptReq := &cloudkms.EncryptRequest{}
+	gcpkms.SetEncryptRequestChecksums(encryptReq, []byte("123456789"), nil)
+	decryptReq := &cloudkms.DecryptRequest{}
+	gcpkms.SetDecryptRequestChecksums(decryptReq, []byte("123456789"), nil)
+	signReq := &cloudkms.AsymmetricSignRequest{}
+	gcpkms.SetAsymmetricSignRequestChecksum(signReq, make([]byte, 32))
+	signDataReq := &cloudkms.AsymmetricSignRequest{}
+	gcpkms.SetAsymmetricSignRequestDataChecksum(signDataReq, []byte("123456789"))
+	macSignReq := &cloudkms.MacSignRequest{}
+	gcpkms.SetMacSignRequestChecksum(macSignReq, nil)
+	for _, tc := range []struct {
+		name string
+		req  interface{ MarshalJSON() ([]byte, error) }
+		want []string
+	}{
+		{name: "Encrypt", req: encryptReq, want: []string{`"plaintextCrc32c":"3808858755"`, `"additionalAuthenticatedDataCrc32c":"0"`}},
+		{name: "Decrypt", req: decryptReq, want: []string{`"ciphertextCrc32c":"3808858755"`, `"additionalAuthenticatedDataCrc32c":"0"`}},
+		{name: "AsymmetricSign", req: signReq, want: []string{`"digestCrc32c":"2324772522"`}},
+		{name: "AsymmetricSign data", req: signDataReq, want: []string{`"dataCrc32c":"3808858755"`}},
+		{name: "MacSign", req: macSignReq, want: []string{`"dataCrc32c":"0"`}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b, err := tc.req.MarshalJSON()
+			if err != nil {
+				t.Fatalf("MarshalJSON() err = %v, want nil", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(string(b), want) {
+					t.Errorf("MarshalJSON() = %s, want it to contain %s", b, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSetRequestChecksumsKeepsForceSendFields(t *testing.T) {
+	req := &cloudkms.DecryptRequest{ForceSendFields: []string{"Ciphertext"}}
+	gcpkms.SetDecryptRequestChecksums(req, nil, nil)
+	want := []string{"Ciphertext", "CiphertextCrc32c", "AdditionalAuthenticatedDataCrc32c"}
+	if strings.Join(req.ForceSendFields, ",") != strings.Join(want, ",") {
+		t.Errorf("req.ForceSendFields = %v, want %v", req.ForceSendFields, want)
+	}
+
+	// Appending to the fields of one request must not affect another.
+	other := &cloudkms.DecryptRequest{}
+	gcpkms.SetDecryptRequestChecksums(other, nil, nil)
+	other.ForceSendFields = append(other.ForceSendFields, "Ciphertext")
+	another := &cloudkms.DecryptRequest{}
+	gcpkms.SetDecryptRequestChecksums(another, nil, nil)
+	if len(another.ForceSendFields) != 2 {
+		t.Errorf("another.ForceSendFields = %v, want 2 fields", another.ForceSendFields)
+	}
+}
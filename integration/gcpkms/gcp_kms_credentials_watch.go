@@ -0,0 +1,142 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultCredentialsPollInterval is how often the credentials file of
+// WithCredentialsFileWatch is checked for changes.
+const defaultCredentialsPollInterval = 10 * time.Second
+
+// fileStamp identifies a version of a file by its modification time and size.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFile(path string) (fileStamp, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}, nil
+}
+
+func (s fileStamp) equal(other fileStamp) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size
+}
+
+// credentialsWatcher polls a credentials file and reloads the credentials of
+// a token source when the file changes. If the new file cannot be loaded, the
+// current credentials are kept, and the failure is logged and counted.
+type credentialsWatcher struct {
+	path     string
+	interval time.Duration
+	clock    clock
+	logger   *log.Logger
+	// src is set by NewClient once the token source has been created.
+	src *reauthTokenSource
+	// attempted is the stamp of the file when it was last loaded, or when
+	// loading it last failed, so that a file that cannot be loaded is only
+	// reported once per change.
+	attempted fileStamp
+	// statFailed is true if the file could not be found at the last poll.
+	statFailed bool
+	failures   atomic.Int64
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// newCredentialsWatcher returns a watcher for the credentials file of cfg. The
+// file is stat'ed before the credentials are loaded from it, so that changes
+// made in between are picked up by the first poll.
+func newCredentialsWatcher(cfg *config) (*credentialsWatcher, error) {
+	stamp, err := statFile(cfg.credentialsFile)
+	if err != nil {
+		return nil, fmt.Errorf("credentials file: %v", err)
+	}
+	interval := cfg.credentialsPollInterval
+	if interval == 0 {
+		interval = defaultCredentialsPollInterval
+	}
+	return &credentialsWatcher{
+		path:      cfg.credentialsFile,
+		interval:  interval,
+		clock:     cfg.clock,
+		logger:    cfg.logger,
+		attempted: stamp,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}, nil
+}
+
+// watch polls the file until close is called.
+func (w *credentialsWatcher) watch() {
+	defer close(w.done)
+	t := w.clock.NewTimer(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-t.C():
+			w.poll()
+			t.Reset(w.interval)
+		}
+	}
+}
+
+// poll reloads the credentials if the file changed since it was last loaded.
+func (w *credentialsWatcher) poll() {
+	stamp, err := statFile(w.path)
+	if err != nil {
+		// The file may be missing for a moment while it is replaced.
+		if !w.statFailed {
+			w.statFailed = true
+			w.fail(err)
+		}
+		return
+	}
+	w.statFailed = false
+	if stamp.equal(w.attempted) {
+		return
+	}
+	w.attempted = stamp
+	if err := w.src.reload(); err != nil {
+		w.fail(err)
+	}
+}
+
+func (w *credentialsWatcher) fail(err error) {
+	w.failures.Add(1)
+	w.logger.Printf("gcpkms: reloading the credentials from %s failed, keeping the current credentials: %v", w.path, err)
+}
+
+// close stops polling and waits for a reload in progress to finish.
+func (w *credentialsWatcher) close() {
+	w.stopOnce.Do(func() { close(w.stop) })
+	<-w.done
+}
@@ -0,0 +1,188 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// writeCredentials replaces the file at path with data like a secrets
+// manager would, by renaming a new file over it. The modification time is
+// moved forward, so that the change is detected even on file systems with a
+// coarse timestamp resolution.
+func writeCredentials(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		t.Fatalf("os.WriteFile() err = %v, want nil", err)
+	}
+	if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+		t.Fatalf("os.Chtimes() err = %v, want nil", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("os.Rename() err = %v, want nil", err)
+	}
+}
+
+// credentialsPollInterval is the poll interval of the clients returned by
+// newWatchingClient.
+const credentialsPollInterval = time.Minute
+
+// newWatchingClient returns a client of srv that watches the credentials
+// file at path on clock, and logs to logs.
+func newWatchingClient(t *testing.T, srv *authServer, path string, clock *gcpkms.FakeClock, logs logWriter) *gcpkms.Client {
+	t.Helper()
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.srv.URL+"/")),
+		gcpkms.WithBaseTransport(srv.srv.Client().Transport),
+		gcpkms.WithLogger(log.New(logs, "", 0)),
+		gcpkms.WithClock(clock),
+		gcpkms.WithCredentialsFileWatch(path),
+		gcpkms.WithCredentialsPollInterval(credentialsPollInterval))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// pollCredentials makes the watcher of a client returned by
+// newWatchingClient poll the credentials file once, and returns when the
+// poll is done, i.e. when the watcher waits for the next one.
+func pollCredentials(clock *gcpkms.FakeClock) {
+	clock.BlockUntil(1)
+	clock.Advance(credentialsPollInterval)
+	clock.BlockUntil(1)
+}
+
+// checkKeyID encrypts with a and checks that the token of the request was
+// obtained with the service account key with the given ID.
+func checkKeyID(t *testing.T, srv *authServer, a *gcpkms.AEAD, keyID string) {
+	t.Helper()
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got := srv.keyID(); got != keyID {
+		t.Errorf("the token was requested with key %q, want %q", got, keyID)
+	}
+}
+
+// checkNoLogs checks that nothing was logged to logs.
+func checkNoLogs(t *testing.T, logs logWriter) {
+	t.Helper()
+	select {
+	case line := <-logs:
+		t.Errorf("logged %q, want nothing", line)
+	default:
+	}
+}
+
+func TestCredentialsFileWatchReloadsRotatedFile(t *testing.T) {
+	srv := newAuthServer(t, func(string) bool { return true })
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	modTime := time.Now()
+	writeCredentials(t, path, srv.credentialsJSONWithKeyID(t, "key-1"), modTime)
+	clock := gcpkms.NewFakeClock()
+	logs := make(logWriter, 10)
+	client := newWatchingClient(t, srv, path, clock, logs)
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	checkKeyID(t, srv, a.(*gcpkms.AEAD), "key-1")
+
+	// The file is only reloaded by the next poll.
+	writeCredentials(t, path, srv.credentialsJSONWithKeyID(t, "key-2"), modTime.Add(time.Minute))
+	checkKeyID(t, srv, a.(*gcpkms.AEAD), "key-1")
+	pollCredentials(clock)
+	checkKeyID(t, srv, a.(*gcpkms.AEAD), "key-2")
+	checkNoLogs(t, logs)
+	if got := client.CredentialsReloadFailures(); got != 0 {
+		t.Errorf("client.CredentialsReloadFailures() = %d, want 0", got)
+	}
+}
+
+func TestCredentialsFileWatchKeepsCredentialsOnFailure(t *testing.T) {
+	srv := newAuthServer(t, func(string) bool { return true })
+	path := filepath.Join(t.TempDir(), "credentials.json")
+	modTime := time.Now()
+	writeCredentials(t, path, srv.credentialsJSONWithKeyID(t, "key-1"), modTime)
+	clock := gcpkms.NewFakeClock()
+	logs := make(logWriter, 10)
+	client := newWatchingClient(t, srv, path, clock, logs)
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	checkKeyID(t, srv, a.(*gcpkms.AEAD), "key-1")
+	tokenRequests := atomic.LoadInt32(&srv.tokenRequests)
+
+	writeCredentials(t, path, []byte("not a credentials file"), modTime.Add(time.Minute))
+	pollCredentials(clock)
+	select {
+	case line := <-logs:
+		if !strings.Contains(line, path) {
+			t.Errorf("logged %q, want the path of the credentials file", line)
+		}
+	default:
+		t.Fatal("reload failure not logged")
+	}
+	// The file is not loaded again until it changes again.
+	pollCredentials(clock)
+	checkNoLogs(t, logs)
+	if got := client.CredentialsReloadFailures(); got != 1 {
+		t.Errorf("client.CredentialsReloadFailures() = %d, want 1", got)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got := atomic.LoadInt32(&srv.tokenRequests); got != tokenRequests {
+		t.Errorf("token requests = %d, want %d, since the current token is kept", got, tokenRequests)
+	}
+
+	writeCredentials(t, path, srv.credentialsJSONWithKeyID(t, "key-2"), modTime.Add(2*time.Minute))
+	pollCredentials(clock)
+	checkKeyID(t, srv, a.(*gcpkms.AEAD), "key-2")
+}
+
+func TestWithCredentialsFileWatchRejectsInvalidConfigurations(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.json")
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "empty path", opts: []gcpkms.Option{gcpkms.WithCredentialsFileWatch("")}},
+		{name: "missing file", opts: []gcpkms.Option{gcpkms.WithCredentialsFileWatch(missing)}},
+		{name: "insecure transport", opts: []gcpkms.Option{gcpkms.WithCredentialsFileWatch(missing), gcpkms.WithInsecureTransport()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClient(context.Background(), "gcp-kms://", tc.opts...); err == nil {
+				t.Error("gcpkms.NewClient() err = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,296 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// debugString formats the fields of a DebugString of the given type, e.g.
+// "gcpkms.AEAD{key=gcp-kms://... protection-level=HSM}". Fields are only
+// ever built from configuration, never from credentials or data.
+func debugString(typ string, fields []string) string {
+	return "gcpkms." + typ + "{" + strings.Join(fields, " ") + "}"
+}
+
+// debugEndpoint returns the transport and endpoint fields of endpoint,
+// without the user info, query and fragment of the URL, which may hold
+// credentials.
+func debugEndpoint(endpoint string) []string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return []string{"transport=REST", "endpoint=invalid"}
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.Fragment = ""
+	return []string{"transport=REST/" + strings.ToUpper(u.Scheme), "endpoint=" + u.String()}
+}
+
+// debugFields returns the retry fields of i, which is nil for signers that
+// were not returned by Client.GetSigner.
+func (i *invoker) debugFields() []string {
+	if i == nil {
+		return []string{"retry=none"}
+	}
+	retry := fmt.Sprintf("retry=(attempts=%d,backoff=%v-%v,multiplier=%g)", i.maxAttempts, i.initialBackoff, i.maxBackoff, i.multiplier)
+	if i.retryPredicate != nil {
+		retry = "retry=custom"
+	}
+	return []string{retry, fmt.Sprintf("retry-budget=(ratio=%g,tokens=%g)", i.budget.ratio, i.budget.maxTokens)}
+}
+
+// debugFeatures returns the optional features of i, which are shared by the
+// primitives of a client.
+func (i *invoker) debugFeatures() []string {
+	if i == nil {
+		return nil
+	}
+	var features []string
+	if i.hedgeDelay > 0 {
+		features = append(features, fmt.Sprintf("hedging(delay=%v,max=%d)", i.hedgeDelay, i.maxHedges))
+	}
+	if i.reauth != nil {
+		features = append(features, "reauthentication")
+	}
+	if i.newKeyGracePeriod > 0 {
+		features = append(features, fmt.Sprintf("new-key-grace-period(%v)", i.newKeyGracePeriod))
+	}
+	if i.maxCalls > 0 {
+		features = append(features, fmt.Sprintf("max-concurrent-calls(%d)", i.maxCalls))
+	}
+	if i.slowCallHook != nil {
+		features = append(features, fmt.Sprintf("slow-call-threshold(%v)", i.slowCallThreshold))
+	}
+	if i.requestIDHook != nil {
+		features = append(features, "request-id-hook")
+	}
+	return features
+}
+
+// debugString returns the timeouts field of t, or "" if no timeout is set.
+func (t *callTimeouts) debugString() string {
+	var timeouts []string
+	if t.def > 0 {
+		timeouts = append(timeouts, "default="+t.def.String())
+	}
+	timeouts = append(timeouts, sortedDurations(t.byLevel, func(level string) string { return level })...)
+	timeouts = append(timeouts, sortedDurations(t.byMethod, Method.String)...)
+	if len(timeouts) == 0 {
+		return ""
+	}
+	return "timeouts=(" + strings.Join(timeouts, ",") + ")"
+}
+
+// sortedDurations returns the durations of m as "name=duration", sorted by
+// name.
+func sortedDurations[K comparable](m map[K]time.Duration, name func(K) string) []string {
+	durations := make([]string, 0, len(m))
+	for k, d := range m {
+		durations = append(durations, name(k)+"="+d.String())
+	}
+	sort.Strings(durations)
+	return durations
+}
+
+// appendTimeouts appends the timeouts field of t to fields, if any timeout is
+// set.
+func appendTimeouts(fields []string, t *callTimeouts) []string {
+	if s := t.debugString(); s != "" {
+		return append(fields, s)
+	}
+	return fields
+}
+
+// debugFeatures returns the features field, or nil if no optional feature is
+// active.
+func debugFeatures(features []string) []string {
+	if len(features) == 0 {
+		return nil
+	}
+	return []string{"features=[" + strings.Join(features, " ") + "]"}
+}
+
+// DebugString returns a one-line description of the configuration of the
+// client, e.g. to log it when triaging an incident: the transport, the
+// endpoints, the key URI prefixes, the retry settings, the timeouts and the
+// optional features that are active. It never includes credentials, nor any
+// data passed to the primitives of the client, and its format may change.
+func (c *Client) DebugString() string {
+	c.mu.Lock()
+	endpoint, location, closed := c.endpoint, c.location, c.closed
+	c.mu.Unlock()
+	fields := debugEndpoint(endpoint)
+	if c.endpoints != nil {
+		fields = append(fields, "endpoints=["+strings.Join(c.endpoints, " ")+"]")
+	}
+	fields = append(fields, "prefixes=["+strings.Join(c.keyURIPrefixes, " ")+"]")
+	if closed {
+		fields = append(fields, "state=closed")
+	}
+	fields = append(fields, c.invoker.debugFields()...)
+	fields = appendTimeouts(fields, &c.timeouts)
+
+	var features []string
+	if c.insecure {
+		features = append(features, "insecure-transport")
+	}
+	if c.primitiveCache {
+		features = append(features, "primitive-cache")
+	}
+	if c.regionalEndpoints {
+		if location == "" {
+			location = "unbound"
+		}
+		features = append(features, fmt.Sprintf("regional-endpoints(%s)", location))
+	}
+	features = append(features, c.primitiveFeatures()...)
+	features = append(features, c.invoker.debugFeatures()...)
+	if c.requiredKeyLabels != nil {
+		// Only the label keys are listed, as a policy may require values that
+		// identify its users.
+		labels := make([]string, 0, len(c.requiredKeyLabels))
+		for k := range c.requiredKeyLabels {
+			labels = append(labels, k)
+		}
+		sort.Strings(labels)
+		features = append(features, "required-key-labels("+strings.Join(labels, ",")+")")
+	}
+	if c.allowedKeyLocations != nil {
+		features = append(features, "allowed-key-locations("+strings.Join(c.allowedKeyLocations, ",")+")")
+	}
+	if c.keyLocationVerification {
+		features = append(features, "key-location-verification")
+	}
+	if c.requiredRotationPeriod > 0 {
+		features = append(features, fmt.Sprintf("required-rotation-period(%v,exemptions=%d)", c.requiredRotationPeriod, len(c.rotationExemptions)))
+	}
+	if c.connMonitor != nil {
+		features = append(features, "connectivity-callback")
+	}
+	if c.credsWatcher != nil {
+		features = append(features, "credentials-file-watch")
+	}
+	return debugString("Client", append(fields, debugFeatures(features)...))
+}
+
+// primitiveFeatures returns the optional features that the client passes to
+// its AEADs.
+func (c *Client) primitiveFeatures() []string {
+	var features []string
+	if c.keyURIBinding {
+		features = append(features, "key-uri-binding")
+	}
+	if c.inputCopying {
+		features = append(features, "input-copying")
+	}
+	if c.largePayloadDEK != nil {
+		features = append(features, "large-payload-envelope("+c.largePayloadDEK.GetTypeUrl()+")")
+	}
+	if c.decrypts != nil {
+		features = append(features, "decrypt-deduplication")
+	}
+	if c.decryptCache != nil {
+		features = append(features, fmt.Sprintf("decrypt-cache(entries=%d,ttl=%v)", c.decryptCache.maxEntries, c.decryptCache.ttl))
+	}
+	if c.dekCache != nil {
+		features = append(features, c.dekCache.debugFeatures()...)
+	}
+	if c.staleness != nil {
+		features = append(features, fmt.Sprintf("rotation-staleness-check(%v)", c.staleness.maxAge))
+	}
+	return features
+}
+
+// debugFeatures returns the features of the DEK cache.
+func (c *dekCache) debugFeatures() []string {
+	features := []string{fmt.Sprintf("dek-cache(messages=%d,ttl=%v)", c.maxMessages, c.ttl)}
+	if c.maxStaleness > 0 {
+		features = append(features, fmt.Sprintf("offline-decrypt-fallback(%v)", c.maxStaleness))
+	}
+	return features
+}
+
+// DebugString returns a one-line description of the configuration of the
+// AEAD, e.g. to log it when triaging an incident: the key URI, the transport
+// and endpoint, the algorithm, the protection level, which is "unknown" until
+// Cloud KMS has reported it in a response, the retry settings, the timeouts
+// and the optional features that are active. It never includes credentials,
+// nor any data passed to the AEAD, and its format may change.
+func (a *AEAD) DebugString() string {
+	fields := []string{"key=" + gcpPrefix + a.keyURI}
+	fields = append(fields, debugEndpoint(a.kms.BasePath)...)
+	level, _ := a.protectionLevel.Load().(string)
+	if level == "" {
+		level = "unknown"
+	}
+	// Cloud KMS keys of the purpose ENCRYPT_DECRYPT all have this algorithm.
+	fields = append(fields, "algorithm=GOOGLE_SYMMETRIC_ENCRYPTION", "protection-level="+level)
+	fields = append(fields, a.invoker.debugFields()...)
+	fields = appendTimeouts(fields, a.timeouts)
+
+	var features []string
+	if a.bindKeyURI {
+		features = append(features, "key-uri-binding")
+	}
+	if a.copyInputs {
+		features = append(features, "input-copying")
+	}
+	if a.largePayloadDEK != nil {
+		features = append(features, "large-payload-envelope("+a.largePayloadDEK.GetTypeUrl()+")")
+	}
+	if a.decrypts != nil {
+		features = append(features, "decrypt-deduplication")
+	}
+	if a.cache != nil {
+		features = append(features, fmt.Sprintf("decrypt-cache(entries=%d,ttl=%v)", a.cache.maxEntries, a.cache.ttl))
+	}
+	if a.deks != nil {
+		features = append(features, a.deks.debugFeatures()...)
+	}
+	if a.staleness != nil {
+		features = append(features, fmt.Sprintf("rotation-staleness-check(%v)", a.staleness.maxAge))
+	}
+	features = append(features, a.invoker.debugFeatures()...)
+	return debugString("AEAD", append(fields, debugFeatures(features)...))
+}
+
+// DebugString returns a one-line description of the configuration of the
+// signer, e.g. to log it when triaging an incident: the URI of the key
+// version, the transport and endpoint, the algorithm and protection level of
+// the key version, the retry settings, the timeouts and the optional
+// features that are active. It never includes credentials, nor any digest or
+// signature, and its format may change.
+func (s *Signer) DebugString() string {
+	pub := s.s.publicKey()
+	fields := []string{"key=" + gcpPrefix + pub.version}
+	fields = append(fields, debugEndpoint(s.s.kms.BasePath)...)
+	fields = append(fields, "algorithm="+pub.algorithm, "protection-level="+pub.protectionLevel)
+	fields = append(fields, s.s.invoker.debugFields()...)
+	fields = appendTimeouts(fields, &s.s.timeouts)
+
+	var features []string
+	if c := s.s.cache; c != nil {
+		features = append(features, fmt.Sprintf("signature-cache(entries=%d,ttl=%v)", c.maxEntries, c.ttl))
+	}
+	features = append(features, s.s.invoker.debugFeatures()...)
+	return debugString("Signer", append(fields, debugFeatures(features)...))
+}
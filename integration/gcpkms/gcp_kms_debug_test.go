@@ -0,0 +1,162 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+)
+
+// checkDebugString checks that got is a single line that contains all of want
+// and none of secrets.
+func checkDebugString(t *testing.T, got string, want, secrets []string) {
+	t.Helper()
+	if strings.Contains(got, "\n") {
+		t.Errorf("DebugString() = %q, want a single line", got)
+	}
+	for _, w := range want {
+		if !strings.Contains(got, w) {
+			t.Errorf("DebugString() = %q, want it to contain %q", got, w)
+		}
+	}
+	for _, s := range secrets {
+		if strings.Contains(got, s) {
+			t.Errorf("DebugString() = %q, must not contain %q", got, s)
+		}
+	}
+}
+
+func TestClientDebugString(t *testing.T) {
+	srv := newFakeServer(t)
+	// Credentials in the endpoint URL are sent as basic authentication.
+	endpoint := strings.Replace(srv.URL(), "://", "://user:secret-password@", 1) + "/"
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(append(srv.ClientOptions(), option.WithEndpoint(endpoint))...),
+		gcpkms.WithInsecureTransport(),
+		gcpkms.WithRetrySettings(gcpkms.RetrySettings{MaxAttempts: 5, InitialBackoff: 20 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}),
+		gcpkms.WithCallTimeout(10*time.Second),
+		gcpkms.WithMethodTimeout(gcpkms.MethodDecrypt, 2*time.Second),
+		gcpkms.WithHedging(100*time.Millisecond, 1),
+		gcpkms.WithDecryptCache(100, time.Minute),
+		gcpkms.WithRequiredKeyLabels(map[string]string{"env": "secret-label-value"}),
+	)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	secrets := []string{"secret"}
+	checkDebugString(t, client.DebugString(), []string{
+		"gcpkms.Client{",
+		"transport=REST/HTTP ",
+		"endpoint=" + srv.URL() + "/",
+		"prefixes=[gcp-kms://]",
+		"retry=(attempts=5,backoff=20ms-1s,multiplier=2)",
+		"timeouts=(default=10s,Decrypt=2s)",
+		"insecure-transport",
+		"primitive-cache",
+		"hedging(delay=100ms,max=1)",
+		"decrypt-cache(entries=100,ttl=1m0s)",
+		"required-key-labels(env)",
+	}, secrets)
+
+	client.Close()
+	checkDebugString(t, client.DebugString(), []string{"state=closed", "primitive-cache"}, secrets)
+}
+
+func TestClientDebugStringDefaults(t *testing.T) {
+	srv := newFakeServer(t)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithoutPrimitiveCache())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	got := client.DebugString()
+	checkDebugString(t, got, []string{"prefixes=[" + fakeKeyURI + "]", "retry=(attempts=3,"}, []string{"primitive-cache", "hedging", "timeouts="})
+}
+
+func TestAEADDebugString(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv, gcpkms.WithKeyURIBinding(), gcpkms.WithInputCopying(), gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))
+	want := []string{
+		"gcpkms.AEAD{",
+		"key=" + fakeKeyURI + " ",
+		"transport=REST/HTTP ",
+		"endpoint=" + srv.URL() + "/",
+		"algorithm=GOOGLE_SYMMETRIC_ENCRYPTION",
+		"retry=(attempts=3,",
+		"key-uri-binding",
+		"input-copying",
+		"large-payload-envelope(type.googleapis.com/google.crypto.tink.AesGcmKey)",
+	}
+	checkDebugString(t, a.DebugString(), append(want, "protection-level=unknown"), nil)
+
+	plaintext := []byte("secret plaintext")
+	associatedData := []byte("secret associated data")
+	ciphertext, err := a.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	secrets := []string{string(plaintext), string(associatedData), hex.EncodeToString(ciphertext[:16])}
+	checkDebugString(t, a.DebugString(), append(want, "protection-level=SOFTWARE"), secrets)
+}
+
+func TestSignerDebugString(t *testing.T) {
+	srv, _ := newFakeSigningKey(t, "RSA_SIGN_PKCS1_2048_SHA256")
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithMaxConcurrentCalls(8))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	s, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1), gcpkms.WithSignatureCache(10, time.Minute))
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	signature, err := s.Sign(nil, digest[:], s.SignerOpts())
+	if err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+	checkDebugString(t, s.DebugString(), []string{
+		"gcpkms.Signer{",
+		"key=gcp-kms://" + versionName(1) + " ",
+		"transport=REST/HTTP ",
+		"algorithm=RSA_SIGN_PKCS1_2048_SHA256",
+		"protection-level=SOFTWARE",
+		"retry=(attempts=3,",
+		"signature-cache(entries=10,ttl=1m0s)",
+		"max-concurrent-calls(8)",
+	}, []string{hex.EncodeToString(digest[:8]), hex.EncodeToString(signature[:8])})
+}
+
+func TestNewSignerDebugString(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	s, err := gcpkms.NewSigner(context.Background(), versionName(1), kms)
+	if err != nil {
+		t.Fatalf("gcpkms.NewSigner() err = %v, want nil", err)
+	}
+	checkDebugString(t, s.DebugString(), []string{"key=gcp-kms://" + versionName(1) + " ", "retry=none"}, nil)
+}
@@ -0,0 +1,171 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// decryptCacheKey identifies a decryption by the name of the crypto key and
+// the SHA-256 hashes of the ciphertext and the associated data.
+type decryptCacheKey struct {
+	keyName        string
+	ciphertext     [sha256.Size]byte
+	associatedData [sha256.Size]byte
+}
+
+func newDecryptCacheKey(keyName string, ciphertext, associatedData []byte) decryptCacheKey {
+	return decryptCacheKey{
+		keyName:        keyName,
+		ciphertext:     sha256.Sum256(ciphertext),
+		associatedData: sha256.Sum256(associatedData),
+	}
+}
+
+type decryptCacheEntry struct {
+	key    decryptCacheKey
+	result DecryptResult
+	expiry time.Time
+}
+
+// DecryptCacheStats holds the counters of the decrypt cache of a Client.
+type DecryptCacheStats struct {
+	// Hits is the number of decryptions served from the cache.
+	Hits int64
+	// Misses is the number of decryptions that were not cached and were sent
+	// to Cloud KMS.
+	Misses int64
+}
+
+// decryptCache is an LRU cache of decrypted plaintexts with a maximum number
+// of entries, each of which expires after ttl. The plaintexts of evicted and
+// expired entries are overwritten with zeros.
+type decryptCache struct {
+	maxEntries int
+	ttl        time.Duration
+	clock      clock
+
+	hits   atomic.Int64
+	misses atomic.Int64
+
+	mu      sync.Mutex
+	entries map[decryptCacheKey]*list.Element
+	// lru holds *decryptCacheEntry values, the most recently used first.
+	lru *list.List
+}
+
+func newDecryptCache(maxEntries int, ttl time.Duration, clk clock) *decryptCache {
+	return &decryptCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		clock:      clk,
+		entries:    make(map[decryptCacheKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+// get returns the cached result for key, with its plaintext appended to dst,
+// and false if there is none or it expired.
+func (c *decryptCache) get(key decryptCacheKey, dst []byte) (DecryptResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		c.misses.Add(1)
+		return DecryptResult{}, false
+	}
+	e := elem.Value.(*decryptCacheEntry)
+	if !c.clock.Now().Before(e.expiry) {
+		c.remove(elem)
+		c.misses.Add(1)
+		return DecryptResult{}, false
+	}
+	c.lru.MoveToFront(elem)
+	c.hits.Add(1)
+	res := e.result
+	res.Plaintext = append(dst, e.result.Plaintext...)
+	return res, true
+}
+
+// put caches res under key, with a copy of plaintext as its plaintext,
+// evicting the least recently used entry if the cache is full.
+func (c *decryptCache) put(key decryptCacheKey, res DecryptResult, plaintext []byte) {
+	res.Plaintext = append([]byte(nil), plaintext...)
+	e := &decryptCacheEntry{key: key, result: res, expiry: c.clock.Now().Add(c.ttl)}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		zero(elem.Value.(*decryptCacheEntry).result.Plaintext)
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	if c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+	}
+}
+
+// remove removes elem and zeroes its plaintext. c.mu must be held.
+func (c *decryptCache) remove(elem *list.Element) {
+	e := c.lru.Remove(elem).(*decryptCacheEntry)
+	delete(c.entries, e.key)
+	zero(e.result.Plaintext)
+}
+
+// purge removes all entries and zeroes their plaintexts.
+func (c *decryptCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *decryptCache) stats() DecryptCacheStats {
+	return DecryptCacheStats{Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// decryptCached decrypts ciphertext with associatedData and appends the
+// plaintext to dst, or returns the cached result of an earlier decryption.
+func (a *AEAD) decryptCached(ctx context.Context, dst, ciphertext, associatedData []byte) (DecryptResult, error) {
+	// The key is computed first, since dst may overlap ciphertext.
+	key := newDecryptCacheKey(a.keyURI, ciphertext, associatedData)
+	if res, ok := a.cache.get(key, dst); ok {
+		return res, nil
+	}
+	res, err := a.decryptWithMetadata(ctx, ciphertext, associatedData)
+	if err != nil {
+		return DecryptResult{}, err
+	}
+	a.cache.put(key, *res, res.Plaintext)
+	out := *res
+	out.Plaintext = append(dst, res.Plaintext...)
+	return out, nil
+}
+
+// zero overwrites b with zeros.
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const testDecryptKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+func newTestDecryptCache(maxEntries int, ttl time.Duration) (*decryptCache, *fakeClock) {
+	clock := newFakeClock()
+	c := newDecryptCache(maxEntries, ttl, clock)
+	return c, clock
+}
+
+func testDecryptCacheKey(ciphertext string) decryptCacheKey {
+	return newDecryptCacheKey(testDecryptKeyName, []byte(ciphertext), []byte("associated data"))
+}
+
+func TestDecryptCacheHitsAndMisses(t *testing.T) {
+	c, _ := newTestDecryptCache(10, time.Minute)
+	key := testDecryptCacheKey("ciphertext")
+	if _, ok := c.get(key, nil); ok {
+		t.Error("c.get() on empty cache ok = true, want false")
+	}
+	plaintext := []byte("plaintext")
+	c.put(key, DecryptResult{ProtectionLevel: "HSM", UsedPrimary: true}, plaintext)
+	// The cache holds a copy of the plaintext.
+	plaintext[0] = 'P'
+	res, ok := c.get(key, []byte("prefix "))
+	if !ok {
+		t.Fatal("c.get() ok = false, want true")
+	}
+	if want := (DecryptResult{Plaintext: []byte("prefix plaintext"), ProtectionLevel: "HSM", UsedPrimary: true}); !bytes.Equal(res.Plaintext, want.Plaintext) || res.ProtectionLevel != want.ProtectionLevel || res.UsedPrimary != want.UsedPrimary {
+		t.Errorf("c.get() = %+v, want %+v", res, want)
+	}
+	for _, other := range []decryptCacheKey{
+		testDecryptCacheKey("other ciphertext"),
+		newDecryptCacheKey(testDecryptKeyName, []byte("ciphertext"), []byte("other associated data")),
+		newDecryptCacheKey(testDecryptKeyName+"2", []byte("ciphertext"), []byte("associated data")),
+	} {
+		if _, ok := c.get(other, nil); ok {
+			t.Errorf("c.get(%+v) ok = true, want false", other)
+		}
+	}
+	if got, want := c.stats(), (DecryptCacheStats{Hits: 1, Misses: 4}); got != want {
+		t.Errorf("c.stats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecryptCacheExpiresEntries(t *testing.T) {
+	c, clock := newTestDecryptCache(10, time.Minute)
+	key := testDecryptCacheKey("ciphertext")
+	c.put(key, DecryptResult{}, []byte("plaintext"))
+	cached := c.entries[key].Value.(*decryptCacheEntry).result.Plaintext
+	clock.Advance(time.Minute - time.Second)
+	if _, ok := c.get(key, nil); !ok {
+		t.Error("c.get() before expiry ok = false, want true")
+	}
+	clock.Advance(time.Second)
+	if _, ok := c.get(key, nil); ok {
+		t.Error("c.get() after expiry ok = true, want false")
+	}
+	if got := c.lru.Len(); got != 0 {
+		t.Errorf("number of entries after expiry = %d, want 0", got)
+	}
+	if !bytes.Equal(cached, make([]byte, len(cached))) {
+		t.Errorf("plaintext of the expired entry = %q, want zeros", cached)
+	}
+}
+
+func TestDecryptCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestDecryptCache(2, time.Minute)
+	c.put(testDecryptCacheKey("a"), DecryptResult{}, []byte("plaintext a"))
+	c.put(testDecryptCacheKey("b"), DecryptResult{}, []byte("plaintext b"))
+	evicted := c.entries[testDecryptCacheKey("b")].Value.(*decryptCacheEntry).result.Plaintext
+	// Using a makes b the least recently used entry.
+	c.get(testDecryptCacheKey("a"), nil)
+	c.put(testDecryptCacheKey("c"), DecryptResult{}, []byte("plaintext c"))
+	if _, ok := c.get(testDecryptCacheKey("b"), nil); ok {
+		t.Error("c.get(b) ok = true, want false")
+	}
+	if !bytes.Equal(evicted, make([]byte, len(evicted))) {
+		t.Errorf("plaintext of the evicted entry = %q, want zeros", evicted)
+	}
+	for _, name := range []string{"a", "c"} {
+		res, ok := c.get(testDecryptCacheKey(name), nil)
+		if want := "plaintext " + name; !ok || string(res.Plaintext) != want {
+			t.Errorf("c.get(%s) = %q, %v, want %q, true", name, res.Plaintext, ok, want)
+		}
+	}
+}
+
+func TestDecryptCachePurge(t *testing.T) {
+	c, _ := newTestDecryptCache(10, time.Minute)
+	key := testDecryptCacheKey("ciphertext")
+	c.put(key, DecryptResult{}, []byte("plaintext"))
+	cached := c.entries[key].Value.(*decryptCacheEntry).result.Plaintext
+	c.purge()
+	if _, ok := c.get(key, nil); ok {
+		t.Error("c.get() after purge ok = true, want false")
+	}
+	if !bytes.Equal(cached, make([]byte, len(cached))) {
+		t.Errorf("plaintext of the purged entry = %q, want zeros", cached)
+	}
+}
+
+func TestDecryptCacheConcurrentAccess(t *testing.T) {
+	c, _ := newTestDecryptCache(8, time.Minute)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				name := fmt.Sprint((g + i) % 16)
+				key := testDecryptCacheKey(name)
+				if res, ok := c.get(key, nil); ok && string(res.Plaintext) != "plaintext "+name {
+					t.Errorf("c.get(%s) = %q, want %q", name, res.Plaintext, "plaintext "+name)
+				}
+				c.put(key, DecryptResult{}, []byte("plaintext "+name))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if got := c.lru.Len(); got > 8 {
+		t.Errorf("number of entries = %d, want at most 8", got)
+	}
+	if s := c.stats(); s.Hits+s.Misses != 8*200 {
+		t.Errorf("c.stats() = %+v, want %d lookups", s, 8*200)
+	}
+}
+
+// newTestDecryptCacheClient returns a Client for a fake server holding the
+// key testDecryptKeyName, and an AEAD for that key.
+func newTestDecryptCacheClient(t *testing.T, opts ...Option) (*fakekms.Server, *Client, *AEAD) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateKey(testDecryptKeyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	opts = append([]Option{WithGoogleAPIClientOptions(srv.ClientOptions()...), WithInsecureTransport()}, opts...)
+	client, err := NewClient(context.Background(), gcpPrefix, opts...)
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(gcpPrefix + testDecryptKeyName)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return srv, client, a.(*AEAD)
+}
+
+func TestWithDecryptCache(t *testing.T) {
+	srv, client, a := newTestDecryptCacheClient(t, WithDecryptCache(10, time.Minute))
+	ciphertext, err := a.Encrypt([]byte("plaintext"), []byte("associated data"))
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	for n := 0; n < 3; n++ {
+		plaintext, err := a.Decrypt(ciphertext, []byte("associated data"))
+		if err != nil {
+			t.Fatalf("a.Decrypt() err = %v, want nil", err)
+		}
+		if string(plaintext) != "plaintext" {
+			t.Errorf("a.Decrypt() = %q, want %q", plaintext, "plaintext")
+		}
+		// Modifying the result does not modify the cached plaintext.
+		plaintext[0] = 'P'
+	}
+	res, err := a.DecryptWithMetadata(context.Background(), ciphertext, []byte("associated data"))
+	if err != nil {
+		t.Fatalf("a.DecryptWithMetadata() err = %v, want nil", err)
+	}
+	if string(res.Plaintext) != "plaintext" || res.ProtectionLevel == "" {
+		t.Errorf("a.DecryptWithMetadata() = %+v, want plaintext %q with its protection level", res, "plaintext")
+	}
+	if got := srv.CallCount("Decrypt"); got != 1 {
+		t.Errorf("Decrypt called %d times, want 1", got)
+	}
+	if _, err := a.Decrypt(ciphertext, []byte("other associated data")); err == nil {
+		t.Error("a.Decrypt() with other associated data err = nil, want error")
+	}
+	if got, want := client.DecryptCacheStats(), (DecryptCacheStats{Hits: 3, Misses: 2}); got != want {
+		t.Errorf("client.DecryptCacheStats() = %+v, want %+v", got, want)
+	}
+}
+
+func TestWithDecryptCacheConcurrentDecrypts(t *testing.T) {
+	srv, client, a := newTestDecryptCacheClient(t, WithDecryptCache(4, time.Minute))
+	const n = 8
+	ciphertexts := make([][]byte, n)
+	for i := range ciphertexts {
+		var err error
+		if ciphertexts[i], err = a.Encrypt([]byte(fmt.Sprint("plaintext ", i)), nil); err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				i := (g + j) % n
+				plaintext, err := a.Decrypt(ciphertexts[i], nil)
+				if want := fmt.Sprint("plaintext ", i); err != nil || string(plaintext) != want {
+					t.Errorf("a.Decrypt() = %q, %v, want %q, nil", plaintext, err, want)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	stats := client.DecryptCacheStats()
+	if stats.Hits+stats.Misses != 4*20 {
+		t.Errorf("client.DecryptCacheStats() = %+v, want %d lookups", stats, 4*20)
+	}
+	if got := srv.CallCount("Decrypt"); int64(got) != stats.Misses {
+		t.Errorf("Decrypt called %d times, want %d", got, stats.Misses)
+	}
+}
+
+func TestDecryptCacheIsDisabledByDefault(t *testing.T) {
+	srv, client, a := newTestDecryptCacheClient(t)
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	for n := 0; n < 2; n++ {
+		if _, err := a.Decrypt(ciphertext, nil); err != nil {
+			t.Fatalf("a.Decrypt() err = %v, want nil", err)
+		}
+	}
+	if got := srv.CallCount("Decrypt"); got != 2 {
+		t.Errorf("Decrypt called %d times, want 2", got)
+	}
+	if got := client.DecryptCacheStats(); got != (DecryptCacheStats{}) {
+		t.Errorf("client.DecryptCacheStats() = %+v, want zero", got)
+	}
+}
+
+func TestWithDecryptCacheRejectsInvalidValues(t *testing.T) {
+	for _, opt := range []Option{WithDecryptCache(0, time.Minute), WithDecryptCache(10, 0), WithDecryptCache(10, -time.Second)} {
+		if _, err := newConfig(opt); err == nil {
+			t.Error("newConfig() err = nil, want error")
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// maxSharedDecryptDuration bounds how long a shared Decrypt call may run,
+// since it is not bound by the deadline of any caller.
+const maxSharedDecryptDuration = 5 * time.Minute
+
+// decryptGroup deduplicates concurrent identical Decrypt calls, so that they
+// share the result of a single RPC. Results are never kept once the RPC has
+// completed.
+type decryptGroup struct {
+	mu    sync.Mutex
+	calls map[[sha256.Size]byte]*decryptCall
+	// changed is signaled when a caller joins or gives up on a call, so that
+	// tests can wait for callers without polling.
+	changed *sync.Cond
+}
+
+type decryptCall struct {
+	done    chan struct{}
+	res     *DecryptResult
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
+func newDecryptGroup() *decryptGroup {
+	g := &decryptGroup{calls: make(map[[sha256.Size]byte]*decryptCall)}
+	g.changed = sync.NewCond(&g.mu)
+	return g
+}
+
+// decryptKey returns the key that identifies a Decrypt call.
+func decryptKey(keyName string, ciphertext, associatedData []byte) [sha256.Size]byte {
+	h := sha256.New()
+	for _, b := range [][]byte{[]byte(keyName), ciphertext, associatedData} {
+		var l [8]byte
+		binary.BigEndian.PutUint64(l[:], uint64(len(b)))
+		h.Write(l[:])
+		h.Write(b)
+	}
+	var k [sha256.Size]byte
+	h.Sum(k[:0])
+	return k
+}
+
+// do calls fn, unless an identical call is already in flight, in which case it
+// waits for its result instead.
+//
+// fn runs with a context that carries the values of the context of the first
+// caller, e.g. for tracing, but not its cancellation or deadline, so that one
+// caller giving up does not fail the others. It times out after
+// maxSharedDecryptDuration, and is canceled once all callers have given up.
+func (g *decryptGroup) do(ctx context.Context, key [sha256.Size]byte, fn func(context.Context) (*DecryptResult, error)) (*DecryptResult, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if !ok {
+		callCtx, cancel := context.WithTimeout(withoutCancel(ctx), maxSharedDecryptDuration)
+		c = &decryptCall{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go func() {
+			defer cancel()
+			c.res, c.err = fn(callCtx)
+			g.mu.Lock()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+			g.mu.Unlock()
+			close(c.done)
+		}()
+	}
+	c.waiters++
+	g.changed.Broadcast()
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		if c.err != nil {
+			return nil, c.err
+		}
+		// Every caller gets its own copy of the plaintext.
+		res := *c.res
+		res.Plaintext = append([]byte(nil), c.res.Plaintext...)
+		return &res, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		g.changed.Broadcast()
+		if c.waiters == 0 {
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// withoutCancel returns a context with the values of parent, which is never
+// canceled and has no deadline. It is context.WithoutCancel, which requires
+// Go 1.21.
+func withoutCancel(parent context.Context) context.Context {
+	return detachedContext{parent}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detachedContext) Done() <-chan struct{}       { return nil }
+func (detachedContext) Err() error                  { return nil }
+func (c detachedContext) Value(key any) any         { return c.parent.Value(key) }
@@ -0,0 +1,238 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForWaiters blocks until the in-flight call for key has n waiters.
+func waitForWaiters(g *decryptGroup, key [32]byte, n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for c := g.calls[key]; c == nil || c.waiters != n; c = g.calls[key] {
+		g.changed.Wait()
+	}
+}
+
+func TestDecryptGroupSharesInFlightCall(t *testing.T) {
+	g := newDecryptGroup()
+	key := decryptKey("key", []byte("ciphertext"), nil)
+	release := make(chan struct{})
+	var calls int32
+	fn := func(ctx context.Context) (*DecryptResult, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return &DecryptResult{Plaintext: []byte("plaintext"), ProtectionLevel: "HSM"}, nil
+	}
+
+	const n = 10
+	results := make([]*DecryptResult, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = g.do(context.Background(), key, fn)
+		}(i)
+	}
+	waitForWaiters(g, key, n)
+	close(release)
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&calls); got != 1 {
+		t.Errorf("fn called %d times, want 1", got)
+	}
+	for i := 0; i < n; i++ {
+		if errs[i] != nil {
+			t.Fatalf("g.do() err = %v, want nil", errs[i])
+		}
+		if !bytes.Equal(results[i].Plaintext, []byte("plaintext")) || results[i].ProtectionLevel != "HSM" {
+			t.Errorf("g.do() = %+v, want plaintext %q with protection level HSM", results[i], "plaintext")
+		}
+	}
+	// Callers must not share the plaintext buffer.
+	results[0].Plaintext[0] = 'P'
+	if results[1].Plaintext[0] != 'p' {
+		t.Error("modifying one caller's plaintext changed another caller's plaintext")
+	}
+}
+
+func TestDecryptGroupDoesNotCacheResults(t *testing.T) {
+	g := newDecryptGroup()
+	key := decryptKey("key", []byte("ciphertext"), nil)
+	var calls int32
+	fn := func(ctx context.Context) (*DecryptResult, error) {
+		atomic.AddInt32(&calls, 1)
+		return &DecryptResult{Plaintext: []byte("plaintext")}, nil
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := g.do(context.Background(), key, fn); err != nil {
+			t.Fatalf("g.do() err = %v, want nil", err)
+		}
+	}
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("fn called %d times, want 3", got)
+	}
+}
+
+func TestDecryptGroupSharesErrors(t *testing.T) {
+	g := newDecryptGroup()
+	key := decryptKey("key", []byte("ciphertext"), nil)
+	wantErr := errors.New("decryption failed")
+	if _, err := g.do(context.Background(), key, func(ctx context.Context) (*DecryptResult, error) {
+		return nil, wantErr
+	}); !errors.Is(err, wantErr) {
+		t.Errorf("g.do() err = %v, want %v", err, wantErr)
+	}
+}
+
+func TestDecryptGroupWaiterCancellationDoesNotCancelSharedCall(t *testing.T) {
+	g := newDecryptGroup()
+	key := decryptKey("key", []byte("ciphertext"), nil)
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (*DecryptResult, error) {
+		select {
+		case <-release:
+			return &DecryptResult{Plaintext: []byte("plaintext")}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	canceledErr := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, key, fn)
+		canceledErr <- err
+	}()
+	waitForWaiters(g, key, 1)
+	type result struct {
+		res *DecryptResult
+		err error
+	}
+	other := make(chan result, 1)
+	go func() {
+		res, err := g.do(context.Background(), key, fn)
+		other <- result{res, err}
+	}()
+	waitForWaiters(g, key, 2)
+
+	cancel()
+	if err := <-canceledErr; !errors.Is(err, context.Canceled) {
+		t.Errorf("g.do() with canceled context err = %v, want %v", err, context.Canceled)
+	}
+	close(release)
+	r := <-other
+	if r.err != nil {
+		t.Fatalf("g.do() err = %v, want nil", r.err)
+	}
+	if !bytes.Equal(r.res.Plaintext, []byte("plaintext")) {
+		t.Errorf("g.do() = %q, want %q", r.res.Plaintext, "plaintext")
+	}
+}
+
+func TestDecryptGroupCancelsSharedCallWhenAllWaitersGiveUp(t *testing.T) {
+	g := newDecryptGroup()
+	key := decryptKey("key", []byte("ciphertext"), nil)
+	sharedCanceled := make(chan struct{})
+	fn := func(ctx context.Context) (*DecryptResult, error) {
+		<-ctx.Done()
+		close(sharedCanceled)
+		return nil, ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.do(ctx, key, fn)
+		done <- err
+	}()
+	waitForWaiters(g, key, 1)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("g.do() err = %v, want %v", err, context.Canceled)
+	}
+	// The last waiter cancels the shared call before it returns.
+	<-sharedCanceled
+
+	// A new call starts a new request instead of joining the canceled one.
+	res, err := g.do(context.Background(), key, func(ctx context.Context) (*DecryptResult, error) {
+		return &DecryptResult{Plaintext: []byte("plaintext")}, nil
+	})
+	if err != nil {
+		t.Fatalf("g.do() err = %v, want nil", err)
+	}
+	if !bytes.Equal(res.Plaintext, []byte("plaintext")) {
+		t.Errorf("g.do() = %q, want %q", res.Plaintext, "plaintext")
+	}
+}
+
+type dedupTestKey struct{}
+
+func TestDecryptGroupSharedCallContext(t *testing.T) {
+	g := newDecryptGroup()
+	key := decryptKey("key", []byte("ciphertext"), nil)
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), dedupTestKey{}, "trace"), time.Minute)
+	defer cancel()
+	_, err := g.do(ctx, key, func(callCtx context.Context) (*DecryptResult, error) {
+		if got := callCtx.Value(dedupTestKey{}); got != "trace" {
+			t.Errorf("callCtx.Value() = %v, want %q", got, "trace")
+		}
+		deadline, ok := callCtx.Deadline()
+		if !ok {
+			t.Fatal("callCtx has no deadline, want a bounded one")
+		}
+		// The deadline of the caller does not apply to the shared call.
+		if d := time.Until(deadline); d <= time.Minute || d > maxSharedDecryptDuration {
+			t.Errorf("callCtx deadline in %v, want within (1m, %v]", d, maxSharedDecryptDuration)
+		}
+		return &DecryptResult{Plaintext: []byte("plaintext")}, nil
+	})
+	if err != nil {
+		t.Fatalf("g.do() err = %v, want nil", err)
+	}
+}
+
+func TestDecryptKey(t *testing.T) {
+	base := decryptKey("key", []byte("ciphertext"), []byte("ad"))
+	if base != decryptKey("key", []byte("ciphertext"), []byte("ad")) {
+		t.Error("decryptKey() is not deterministic")
+	}
+	for _, tc := range []struct {
+		name           string
+		keyName        string
+		ciphertext, ad []byte
+	}{
+		{"different key", "key2", []byte("ciphertext"), []byte("ad")},
+		{"different ciphertext", "key", []byte("ciphertext2"), []byte("ad")},
+		{"different associated data", "key", []byte("ciphertext"), []byte("ad2")},
+		{"shifted boundary", "key", []byte("ciphertexta"), []byte("d")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if decryptKey(tc.keyName, tc.ciphertext, tc.ad) == base {
+				t.Error("decryptKey() collides")
+			}
+		})
+	}
+}
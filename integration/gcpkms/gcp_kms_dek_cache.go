@@ -0,0 +1,372 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/binary"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// cachedDEK is a DEK of envelope encryption together with its encryption by
+// Cloud KMS.
+type cachedDEK struct {
+	aead tink.AEAD
+	// wrapped is the DEK encrypted by Cloud KMS, and version and
+	// protectionLevel are the metadata of that encryption.
+	wrapped         []byte
+	version         string
+	protectionLevel string
+	expiry          time.Time
+	// remaining is the number of plaintexts the DEK may still encrypt.
+	remaining int
+}
+
+// DEKCacheStats holds the counters of the DEK cache of a Client.
+type DEKCacheStats struct {
+	// Hits is the number of envelope encryptions that reused a cached DEK.
+	Hits int64
+	// Misses is the number of envelope encryptions that generated a new DEK
+	// and encrypted it with Cloud KMS.
+	Misses int64
+	// Rotations is the number of cached DEKs discarded before their limits
+	// because the primary version of their key changed.
+	Rotations int64
+	// OfflineDecrypts is the number of envelope decryptions that used a DEK
+	// kept for WithOfflineDecryptFallback because Cloud KMS was unreachable.
+	OfflineDecrypts int64
+}
+
+const (
+	// maxOfflineDEKs is the number of DEKs kept for
+	// WithOfflineDecryptFallback.
+	maxOfflineDEKs = 1024
+	// offlineLogInterval is the minimum interval between two log messages
+	// reporting offline decryptions.
+	offlineLogInterval = time.Minute
+)
+
+// offlineDEK is a DEK kept for WithOfflineDecryptFallback.
+type offlineDEK struct {
+	// id is the crypto key name and the encrypted DEK, see offlineID.
+	id              string
+	dek             []byte
+	protectionLevel string
+	// confirmed is the time at which Cloud KMS last encrypted or decrypted
+	// the DEK.
+	confirmed time.Time
+}
+
+// offlineID returns the ID of the DEK encrypted as wrapped by the crypto key
+// with the given name. The name is part of the ID so that a ciphertext is
+// only decrypted offline by the key that Cloud KMS decrypted it with.
+func offlineID(keyName string, wrapped []byte) string {
+	return keyName + "\x00" + string(wrapped)
+}
+
+// dekCache caches one DEK per crypto key, which encrypts up to maxMessages
+// plaintexts and expires after ttl. A DEK is discarded early when the
+// primary version of its key changes, so that new ciphertexts are not pinned
+// to the DEK of an old version.
+type dekCache struct {
+	maxMessages int
+	ttl         time.Duration
+	clock       clock
+
+	// maxStaleness is 0 unless WithOfflineDecryptFallback is used.
+	maxStaleness time.Duration
+
+	hits            atomic.Int64
+	misses          atomic.Int64
+	rotations       atomic.Int64
+	offlineDecrypts atomic.Int64
+
+	mu sync.Mutex
+	// deks holds the cached DEKs by crypto key name.
+	deks map[string]*cachedDEK
+	// offline holds the DEKs kept for WithOfflineDecryptFallback by ID, and
+	// offlineLRU the *offlineDEK values, the most recently confirmed first.
+	offline    map[string]*list.Element
+	offlineLRU *list.List
+	// lastOfflineLog is the time at which an offline decryption was last
+	// logged.
+	lastOfflineLog time.Time
+}
+
+func newDEKCache(maxMessages int, ttl, maxStaleness time.Duration, clk clock) *dekCache {
+	return &dekCache{
+		maxMessages:  maxMessages,
+		ttl:          ttl,
+		maxStaleness: maxStaleness,
+		clock:        clk,
+		deks:         make(map[string]*cachedDEK),
+		offline:      make(map[string]*list.Element),
+		offlineLRU:   list.New(),
+	}
+}
+
+// get returns the cached DEK of the crypto key with the given name, counting
+// one use of it, and false if there is none or it reached its limits.
+func (c *dekCache) get(keyName string) (*cachedDEK, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	d, ok := c.deks[keyName]
+	if !ok || d.remaining <= 0 || !c.clock.Now().Before(d.expiry) {
+		delete(c.deks, keyName)
+		c.misses.Add(1)
+		return nil, false
+	}
+	d.remaining--
+	c.hits.Add(1)
+	return d, true
+}
+
+// put caches d as the DEK of the crypto key with the given name, after its
+// first use.
+func (c *dekCache) put(keyName string, d *cachedDEK) {
+	d.expiry = c.clock.Now().Add(c.ttl)
+	d.remaining = c.maxMessages - 1
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deks[keyName] = d
+}
+
+// observePrimary discards the cached DEK of the crypto key with the given
+// name unless it was encrypted by primary, which Cloud KMS reported as the
+// primary version of the key.
+func (c *dekCache) observePrimary(keyName, primary string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.deks[keyName]; ok && d.version != primary {
+		delete(c.deks, keyName)
+		c.rotations.Add(1)
+	}
+}
+
+// observeNotPrimary discards the cached DEK of the crypto key with the given
+// name if its encryption is wrapped, which Cloud KMS reported as decrypted by
+// a version that is no longer the primary version.
+func (c *dekCache) observeNotPrimary(keyName string, wrapped []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if d, ok := c.deks[keyName]; ok && bytes.Equal(d.wrapped, wrapped) {
+		delete(c.deks, keyName)
+		c.rotations.Add(1)
+	}
+}
+
+// remember keeps a copy of dek, which Cloud KMS just encrypted as wrapped
+// with the crypto key with the given name or decrypted from wrapped, for
+// WithOfflineDecryptFallback. It does nothing if the option is not used.
+func (c *dekCache) remember(keyName string, wrapped, dek []byte, protectionLevel string) {
+	if c.maxStaleness == 0 {
+		return
+	}
+	id := offlineID(keyName, wrapped)
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.offline[id]; ok {
+		elem.Value.(*offlineDEK).confirmed = now
+		c.offlineLRU.MoveToFront(elem)
+		return
+	}
+	d := &offlineDEK{id: id, dek: append([]byte(nil), dek...), protectionLevel: protectionLevel, confirmed: now}
+	c.offline[id] = c.offlineLRU.PushFront(d)
+	if c.offlineLRU.Len() > maxOfflineDEKs {
+		c.removeOffline(c.offlineLRU.Back())
+	}
+}
+
+// forget discards the DEK kept for the encrypted DEK wrapped of the crypto
+// key with the given name, e.g. because Cloud KMS refused to decrypt it.
+func (c *dekCache) forget(keyName string, wrapped []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.offline[offlineID(keyName, wrapped)]; ok {
+		c.removeOffline(elem)
+	}
+}
+
+// unwrapOffline returns a copy of the DEK kept for the encrypted DEK wrapped
+// of the crypto key with the given name, and the protection level of the key
+// version that encrypted it, and false if there is none or Cloud KMS last
+// confirmed it more than maxStaleness ago.
+func (c *dekCache) unwrapOffline(keyName string, wrapped []byte) ([]byte, string, bool) {
+	now := c.clock.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.offline[offlineID(keyName, wrapped)]
+	if !ok {
+		return nil, "", false
+	}
+	d := elem.Value.(*offlineDEK)
+	if now.Sub(d.confirmed) > c.maxStaleness {
+		c.removeOffline(elem)
+		return nil, "", false
+	}
+	c.offlineDecrypts.Add(1)
+	return append([]byte(nil), d.dek...), d.protectionLevel, true
+}
+
+// logOffline logs an offline decryption with the crypto key with the given
+// name after Cloud KMS failed with err, at most once per offlineLogInterval.
+func (c *dekCache) logOffline(logger *log.Logger, keyName string, err error) {
+	now := c.clock.Now()
+	c.mu.Lock()
+	if !c.lastOfflineLog.IsZero() && now.Sub(c.lastOfflineLog) < offlineLogInterval {
+		c.mu.Unlock()
+		return
+	}
+	c.lastOfflineLog = now
+	c.mu.Unlock()
+	logger.Printf("gcpkms: Cloud KMS is unreachable, decrypting with a kept DEK of %s (%d offline decryptions so far): %v", keyName, c.offlineDecrypts.Load(), err)
+}
+
+// removeOffline removes elem from the kept DEKs and overwrites its DEK. c.mu
+// must be held.
+func (c *dekCache) removeOffline(elem *list.Element) {
+	d := c.offlineLRU.Remove(elem).(*offlineDEK)
+	delete(c.offline, d.id)
+	zero(d.dek)
+}
+
+// purge removes all DEKs.
+func (c *dekCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deks = make(map[string]*cachedDEK)
+	for c.offlineLRU.Len() > 0 {
+		c.removeOffline(c.offlineLRU.Back())
+	}
+}
+
+func (c *dekCache) stats() DEKCacheStats {
+	return DEKCacheStats{
+		Hits:            c.hits.Load(),
+		Misses:          c.misses.Load(),
+		Rotations:       c.rotations.Load(),
+		OfflineDecrypts: c.offlineDecrypts.Load(),
+	}
+}
+
+// isUnreachable reports whether err means that Cloud KMS could not be
+// reached or did not answer in time, rather than that it rejected the
+// request.
+func isUnreachable(err error) bool {
+	var apiErr *googleapi.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Code {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// isRejection reports whether err means that Cloud KMS refused to decrypt,
+// e.g. because the key version was disabled or the permission revoked, so
+// that a kept DEK must no longer be used.
+func isRejection(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return false
+}
+
+// sealWithCachedDEK encrypts plaintext with associatedData like the envelope
+// AEAD returned by aead.NewKMSEnvelopeAEAD2, but with the cached DEK of the
+// key, or with a new DEK that it caches. The result has the same format, so
+// openLargePayload decrypts it.
+func (a *AEAD) sealWithCachedDEK(ctx context.Context, plaintext, associatedData []byte, checksums bool) ([]byte, EncryptResult, error) {
+	d, ok := a.deks.get(a.keyURI)
+	if !ok {
+		var err error
+		if d, err = a.newCachedDEK(ctx, checksums); err != nil {
+			return nil, EncryptResult{}, err
+		}
+	}
+	payload, err := d.aead.Encrypt(plaintext, associatedData)
+	if err != nil {
+		return nil, EncryptResult{}, err
+	}
+	if !ok {
+		a.deks.put(a.keyURI, d)
+	}
+	ciphertext := make([]byte, 0, 4+len(d.wrapped)+len(payload))
+	ciphertext = binary.BigEndian.AppendUint32(ciphertext, uint32(len(d.wrapped)))
+	ciphertext = append(ciphertext, d.wrapped...)
+	ciphertext = append(ciphertext, payload...)
+	return ciphertext, EncryptResult{KeyVersion: d.version, ProtectionLevel: d.protectionLevel}, nil
+}
+
+// newCachedDEK generates a new DEK from the DEK template of the primitive and
+// encrypts it with Cloud KMS.
+func (a *AEAD) newCachedDEK(ctx context.Context, checksums bool) (*cachedDEK, error) {
+	keyData, err := registry.NewKeyData(a.largePayloadDEK)
+	if err != nil {
+		return nil, err
+	}
+	dek := keyData.GetValue()
+	defer zero(dek)
+	// The DEK is encrypted with empty associated data, like
+	// aead.NewKMSEnvelopeAEAD2 does.
+	wrapped, _, err := a.encrypt(ctx, nil, dek, []byte{}, checksums)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped.Ciphertext) == 0 {
+		return nil, errors.New("encrypted DEK is empty")
+	}
+	a.deks.remember(a.keyURI, wrapped.Ciphertext, dek, wrapped.ProtectionLevel)
+	p, err := registry.Primitive(a.largePayloadDEK.GetTypeUrl(), dek)
+	if err != nil {
+		return nil, err
+	}
+	primitive, ok := p.(tink.AEAD)
+	if !ok {
+		return nil, errors.New("DEK template does not describe an AEAD key")
+	}
+	return &cachedDEK{
+		aead:            primitive,
+		wrapped:         wrapped.Ciphertext,
+		version:         wrapped.KeyVersion,
+		protectionLevel: wrapped.ProtectionLevel,
+	}, nil
+}
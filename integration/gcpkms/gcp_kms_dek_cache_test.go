@@ -0,0 +1,415 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+)
+
+// newDEKCacheClient returns a client of srv with WithLargePayloadEnvelope and
+// WithDEKCache that tells the time with clock, and its AEAD for fakeKeyURI.
+// The client is also configured with opts.
+func newDEKCacheClient(t *testing.T, srv *fakekms.Server, clock *gcpkms.FakeClock, maxMessages int, ttl time.Duration, opts ...gcpkms.Option) (*gcpkms.Client, *gcpkms.AEAD) {
+	t.Helper()
+	opts = append([]gcpkms.Option{
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...),
+		gcpkms.WithInsecureTransport(),
+		gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()),
+		gcpkms.WithDEKCache(maxMessages, ttl),
+		gcpkms.WithClock(clock),
+	}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return client, a.(*gcpkms.AEAD)
+}
+
+// wrappedDEK returns the encrypted DEK of an envelope ciphertext.
+func wrappedDEK(t *testing.T, ciphertext []byte) []byte {
+	t.Helper()
+	rest := ciphertext[len(largePayloadHeader):]
+	n := binary.BigEndian.Uint32(rest)
+	return rest[4 : 4+n]
+}
+
+// largePlaintext is the plaintext of the envelope ciphertexts of encryptLarge.
+var largePlaintext = bytes.Repeat([]byte{'l'}, maxKMSPlaintextSize+1)
+
+// encryptLarge encrypts a plaintext that needs envelope encryption with a and
+// returns the ciphertext and the key version that encrypted its DEK. It
+// checks that the ciphertext decrypts.
+func encryptLarge(t *testing.T, a *gcpkms.AEAD) ([]byte, string) {
+	t.Helper()
+	res, err := a.EncryptWithMetadata(context.Background(), largePlaintext, []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("a.EncryptWithMetadata() err = %v, want nil", err)
+	}
+	decrypted, err := a.Decrypt(res.Ciphertext, []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(decrypted, largePlaintext) {
+		t.Fatalf("a.Decrypt() returned %d bytes, want the %d bytes of the plaintext", len(decrypted), len(largePlaintext))
+	}
+	return res.Ciphertext, res.KeyVersion
+}
+
+func TestDEKCacheReusesDEKUpToMaxMessages(t *testing.T) {
+	srv := newFakeServer(t)
+	client, a := newDEKCacheClient(t, srv, gcpkms.NewFakeClock(), 3, time.Hour)
+	var wrapped [][]byte
+	for i := 0; i < 5; i++ {
+		ciphertext, _ := encryptLarge(t, a)
+		wrapped = append(wrapped, wrappedDEK(t, ciphertext))
+	}
+	if got := srv.CallCount("Encrypt"); got != 2 {
+		t.Errorf("Encrypt calls = %d, want 2", got)
+	}
+	for i, want := range []bool{true, true, false, true} {
+		if got := bytes.Equal(wrapped[i], wrapped[i+1]); got != want {
+			t.Errorf("ciphertexts %d and %d share their DEK: %v, want %v", i, i+1, got, want)
+		}
+	}
+	if got, want := client.DEKCacheStats(), (gcpkms.DEKCacheStats{Hits: 3, Misses: 2}); got != want {
+		t.Errorf("client.DEKCacheStats() = %+v, want %+v", got, want)
+	}
+
+	// The ciphertexts have the format of WithLargePayloadEnvelope.
+	plain := newFakeAEAD(t, srv, gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))
+	ciphertext, _ := encryptLarge(t, a)
+	if _, err := plain.Decrypt(ciphertext, []byte("associatedData")); err != nil {
+		t.Errorf("Decrypt() without WithDEKCache err = %v, want nil", err)
+	}
+}
+
+func TestDEKCacheExpires(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	_, a := newDEKCacheClient(t, srv, clock, 100, time.Minute)
+	first, _ := encryptLarge(t, a)
+	clock.Advance(time.Minute - time.Second)
+	second, _ := encryptLarge(t, a)
+	if !bytes.Equal(wrappedDEK(t, first), wrappedDEK(t, second)) {
+		t.Error("ciphertexts do not share their DEK before it expires")
+	}
+	clock.Advance(time.Second)
+	third, _ := encryptLarge(t, a)
+	if bytes.Equal(wrappedDEK(t, first), wrappedDEK(t, third)) {
+		t.Error("ciphertexts share an expired DEK")
+	}
+}
+
+func TestDEKCacheSmallPayloadsDoNotUseDEK(t *testing.T) {
+	srv := newFakeServer(t)
+	client, a := newDEKCacheClient(t, srv, gcpkms.NewFakeClock(), 100, time.Hour)
+	for i := 0; i < 3; i++ {
+		ciphertext, err := a.Encrypt([]byte("small"), nil)
+		if err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+		if bytes.HasPrefix(ciphertext, []byte(largePayloadHeader)) {
+			t.Error("a.Encrypt() of a small plaintext returned an envelope ciphertext")
+		}
+	}
+	if got := client.DEKCacheStats(); got != (gcpkms.DEKCacheStats{}) {
+		t.Errorf("client.DEKCacheStats() = %+v, want zero", got)
+	}
+}
+
+func TestDEKCacheRotatesWithPrimaryVersion(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// watch is true if the key is watched with WatchKey before it is
+		// rotated.
+		watch bool
+		// observe makes the client learn that version 2 is the primary
+		// version, given a ciphertext whose DEK was encrypted by version 1
+		// and the events of WatchKey, if watched.
+		observe func(t *testing.T, a *gcpkms.AEAD, ciphertext []byte, clock *gcpkms.FakeClock, events <-chan gcpkms.KeyEvent)
+	}{
+		{
+			name: "encrypt response",
+			observe: func(t *testing.T, a *gcpkms.AEAD, ciphertext []byte, clock *gcpkms.FakeClock, events <-chan gcpkms.KeyEvent) {
+				if _, err := a.Encrypt([]byte("small"), nil); err != nil {
+					t.Fatalf("a.Encrypt() err = %v, want nil", err)
+				}
+			},
+		},
+		{
+			name: "decrypt response",
+			observe: func(t *testing.T, a *gcpkms.AEAD, ciphertext []byte, clock *gcpkms.FakeClock, events <-chan gcpkms.KeyEvent) {
+				if _, err := a.Decrypt(ciphertext, []byte("associatedData")); err != nil {
+					t.Fatalf("a.Decrypt() err = %v, want nil", err)
+				}
+			},
+		},
+		{
+			name:  "key watcher",
+			watch: true,
+			observe: func(t *testing.T, a *gcpkms.AEAD, ciphertext []byte, clock *gcpkms.FakeClock, events <-chan gcpkms.KeyEvent) {
+				// The new version is reported, and then the primary change.
+				nextEvents(t, clock, events, 2)
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			clock := gcpkms.NewFakeClock()
+			client, a := newDEKCacheClient(t, srv, clock, 100, time.Hour)
+			var events <-chan gcpkms.KeyEvent
+			if tc.watch {
+				events, _ = watchKey(t, client)
+			}
+			ciphertext, version := encryptLarge(t, a)
+			if version != fakeKeyName+"/cryptoKeyVersions/1" {
+				t.Fatalf("KeyVersion = %q, want version 1", version)
+			}
+			if _, err := srv.AddVersion(fakeKeyName); err != nil {
+				t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+			}
+			tc.observe(t, a, ciphertext, clock, events)
+
+			encrypts := srv.CallCount("Encrypt")
+			rotated, version := encryptLarge(t, a)
+			if got := srv.CallCount("Encrypt") - encrypts; got != 1 {
+				t.Errorf("encryption after the rotation made %d Encrypt calls, want 1", got)
+			}
+			if want := fakeKeyName + "/cryptoKeyVersions/2"; version != want {
+				t.Errorf("KeyVersion after the rotation = %q, want %q", version, want)
+			}
+			if bytes.Equal(wrappedDEK(t, ciphertext), wrappedDEK(t, rotated)) {
+				t.Error("encryption after the rotation reused the DEK of version 1")
+			}
+			if got := client.DEKCacheStats().Rotations; got != 1 {
+				t.Errorf("client.DEKCacheStats().Rotations = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestDEKCacheKeepsDEKUntilRotationIsObserved(t *testing.T) {
+	srv := newFakeServer(t)
+	_, a := newDEKCacheClient(t, srv, gcpkms.NewFakeClock(), 100, time.Hour)
+	first, _ := encryptLarge(t, a)
+	if _, err := srv.AddVersion(fakeKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	second, version := encryptLarge(t, a)
+	if !bytes.Equal(wrappedDEK(t, first), wrappedDEK(t, second)) {
+		t.Error("ciphertexts do not share their DEK")
+	}
+	if want := fakeKeyName + "/cryptoKeyVersions/1"; version != want {
+		t.Errorf("KeyVersion = %q, want %q", version, want)
+	}
+}
+
+func TestWithDEKCacheValidation(t *testing.T) {
+	srv := newFakeServer(t)
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "without envelope", opts: []gcpkms.Option{gcpkms.WithDEKCache(10, time.Minute)}},
+		{name: "zero messages", opts: []gcpkms.Option{gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()), gcpkms.WithDEKCache(0, time.Minute)}},
+		{name: "zero TTL", opts: []gcpkms.Option{gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()), gcpkms.WithDEKCache(10, 0)}},
+		{name: "offline fallback without DEK cache", opts: []gcpkms.Option{gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()), gcpkms.WithOfflineDecryptFallback(time.Hour)}},
+		{name: "zero offline staleness", opts: []gcpkms.Option{gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()), gcpkms.WithDEKCache(10, time.Minute), gcpkms.WithOfflineDecryptFallback(0)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()}, tc.opts...)
+			if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, opts...); err == nil {
+				t.Error("gcpkms.NewClient() err = nil, want error")
+			}
+		})
+	}
+}
+
+// newOfflineClient returns a client of srv with WithOfflineDecryptFallback
+// and a DEK cache that uses each DEK once, so that every envelope encryption
+// needs Cloud KMS, and its AEAD for fakeKeyURI. The client logs to logs.
+func newOfflineClient(t *testing.T, srv *fakekms.Server, clock *gcpkms.FakeClock, logs logWriter, opts ...gcpkms.Option) (*gcpkms.Client, *gcpkms.AEAD) {
+	t.Helper()
+	opts = append([]gcpkms.Option{gcpkms.WithOfflineDecryptFallback(time.Hour), gcpkms.WithLogger(log.New(logs, "", 0))}, opts...)
+	return newDEKCacheClient(t, srv, clock, 1, time.Hour, opts...)
+}
+
+// decryptOffline decrypts ciphertext with a and checks that it decrypts to
+// largePlaintext with a DEK kept for WithOfflineDecryptFallback.
+func decryptOffline(t *testing.T, a *gcpkms.AEAD, ciphertext []byte) {
+	t.Helper()
+	res, err := a.DecryptWithMetadata(context.Background(), ciphertext, []byte("associatedData"))
+	if err != nil {
+		t.Errorf("a.DecryptWithMetadata() during the outage err = %v, want nil", err)
+		return
+	}
+	if !bytes.Equal(res.Plaintext, largePlaintext) {
+		t.Errorf("a.DecryptWithMetadata() during the outage returned %d bytes, want the %d bytes of the plaintext", len(res.Plaintext), len(largePlaintext))
+	}
+	if !res.Offline {
+		t.Error("DecryptResult.Offline = false, want true")
+	}
+}
+
+func TestOfflineDecryptFallback(t *testing.T) {
+	srv := newFakeServer(t)
+	logs := make(logWriter, 10)
+	client, a := newOfflineClient(t, srv, gcpkms.NewFakeClock(), logs)
+	seen, _ := encryptLarge(t, a)
+	other := newFakeAEAD(t, srv, gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))
+	unseen, err := other.Encrypt(largePlaintext, []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("other.Encrypt() err = %v, want nil", err)
+	}
+
+	err = srv.Restart(func() {
+		decryptOffline(t, a, seen)
+		decryptOffline(t, a, seen)
+		if _, err := a.Decrypt(unseen, []byte("associatedData")); err == nil {
+			t.Error("a.Decrypt() of a ciphertext with an unseen DEK during the outage err = nil, want error")
+		}
+		// Encryption never falls back.
+		if _, err := a.Encrypt(largePlaintext, []byte("associatedData")); err == nil {
+			t.Error("a.Encrypt() during the outage err = nil, want error")
+		}
+	})
+	if err != nil {
+		t.Fatalf("srv.Restart() err = %v, want nil", err)
+	}
+	if got := client.DEKCacheStats().OfflineDecrypts; got != 2 {
+		t.Errorf("client.DEKCacheStats().OfflineDecrypts = %d, want 2", got)
+	}
+	select {
+	case line := <-logs:
+		if !strings.Contains(line, "unreachable") || !strings.Contains(line, fakeKeyName) {
+			t.Errorf("logged %q, want an offline decryption with %s", line, fakeKeyName)
+		}
+	default:
+		t.Error("offline decryption not logged")
+	}
+	// The log is rate limited.
+	if len(logs) != 0 {
+		t.Errorf("logged %d more lines, want 1 line for both offline decryptions", len(logs))
+	}
+
+	res, err := a.DecryptWithMetadata(context.Background(), seen, []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("a.DecryptWithMetadata() after the outage err = %v, want nil", err)
+	}
+	if res.Offline {
+		t.Error("DecryptResult.Offline after the outage = true, want false")
+	}
+}
+
+func TestOfflineDecryptFallbackKeepsDecryptedDEKs(t *testing.T) {
+	srv := newFakeServer(t)
+	_, a := newOfflineClient(t, srv, gcpkms.NewFakeClock(), make(logWriter, 10))
+	other := newFakeAEAD(t, srv, gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))
+	ciphertext, err := other.Encrypt(largePlaintext, []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("other.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt(ciphertext, []byte("associatedData")); err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if err := srv.Restart(func() { decryptOffline(t, a, ciphertext) }); err != nil {
+		t.Fatalf("srv.Restart() err = %v, want nil", err)
+	}
+}
+
+func TestOfflineDecryptFallbackMaxStaleness(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	_, a := newOfflineClient(t, srv, clock, make(logWriter, 10))
+	ciphertext, _ := encryptLarge(t, a)
+	clock.Advance(time.Hour)
+	err := srv.Restart(func() {
+		decryptOffline(t, a, ciphertext)
+		clock.Advance(time.Second)
+		if _, err := a.Decrypt(ciphertext, []byte("associatedData")); err == nil {
+			t.Error("a.Decrypt() with a stale DEK during the outage err = nil, want error")
+		}
+	})
+	if err != nil {
+		t.Fatalf("srv.Restart() err = %v, want nil", err)
+	}
+}
+
+func TestOfflineDecryptFallbackForgetsRejectedDEKs(t *testing.T) {
+	srv := newFakeServer(t)
+	_, a := newOfflineClient(t, srv, gcpkms.NewFakeClock(), make(logWriter, 10))
+	ciphertext, _ := encryptLarge(t, a)
+	if err := srv.SetVersionState(fakeKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt(ciphertext, []byte("associatedData")); err == nil {
+		t.Fatal("a.Decrypt() with a disabled key version err = nil, want error")
+	}
+	err := srv.Restart(func() {
+		if _, err := a.Decrypt(ciphertext, []byte("associatedData")); err == nil {
+			t.Error("a.Decrypt() of a rejected DEK during the outage err = nil, want error")
+		}
+	})
+	if err != nil {
+		t.Fatalf("srv.Restart() err = %v, want nil", err)
+	}
+}
+
+// outageTransport answers the Decrypt requests with UNAVAILABLE while down is
+// set, like Cloud KMS during an outage behind a reachable front end.
+type outageTransport struct {
+	down atomic.Bool
+}
+
+func (t *outageTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !t.down.Load() || !strings.HasSuffix(req.URL.Path, ":decrypt") {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(`{"error": {"code": 503, "status": "UNAVAILABLE"}}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestOfflineDecryptFallbackOnUnavailable(t *testing.T) {
+	srv := newFakeServer(t)
+	trans := &outageTransport{}
+	_, a := newOfflineClient(t, srv, gcpkms.NewFakeClock(), make(logWriter, 10), gcpkms.WithBaseTransport(trans))
+	ciphertext, _ := encryptLarge(t, a)
+	trans.down.Store(true)
+	decryptOffline(t, a, ciphertext)
+}
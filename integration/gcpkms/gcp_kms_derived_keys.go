@@ -0,0 +1,133 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	aeadsubtle "github.com/tink-crypto/tink-go/v2/aead/subtle"
+	"github.com/tink-crypto/tink-go/v2/subtle"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+const (
+	// masterSecretSize is the size of the master secret of a
+	// DerivedKeyManager.
+	masterSecretSize = 32
+	// derivedKeySize is the size of the AES-256-GCM keys derived for tenants.
+	derivedKeySize = 32
+)
+
+var (
+	// masterAssociatedData is the associated data of the encryption of the
+	// master secret with the KEK, so that other ciphertexts of the KEK cannot
+	// be passed off as a wrapped master secret.
+	masterAssociatedData = []byte("tink-go-gcpkms DerivedKeyManager master secret")
+	// derivationSalt is the HKDF salt of the derived keys.
+	derivationSalt = []byte("tink-go-gcpkms DerivedKeyManager v1")
+	// tenantAEADLabel starts the HKDF info of the keys of TenantAEAD.
+	tenantAEADLabel = []byte("AES256_GCM tenant key\x00")
+)
+
+// DerivedKeyManager derives an AEAD per tenant from a single master secret,
+// which is wrapped by a Cloud KMS key, so that bootstrapping a tenant needs
+// no Cloud KMS call: only unwrapping the master secret does, once per
+// manager.
+//
+// The master secret is 32 random bytes. The AES-256-GCM key of a tenant is
+//
+//	HKDF-SHA256(ikm = master secret,
+//	            salt = "tink-go-gcpkms DerivedKeyManager v1",
+//	            info = "AES256_GCM tenant key" || 0x00 || tenant ID,
+//	            length = 32)
+//
+// The salt and info are fixed, so the keys of a tenant only depend on the
+// master secret and the tenant ID, and keys derived for different tenant IDs
+// are independent. The label in the info separates these keys from keys that
+// may be derived for other purposes in the future.
+//
+// Anyone who can unwrap the master secret can derive the keys of every
+// tenant, and disabling the Cloud KMS key version that wrapped it only
+// prevents new managers from unwrapping it. Use a separate key per tenant
+// where tenants must be cryptographically isolated from each other's
+// administrators.
+type DerivedKeyManager struct {
+	master  []byte
+	wrapped []byte
+}
+
+// NewDerivedKeyManager returns a manager whose master secret is wrapped by
+// kek, e.g. an AEAD returned by Client.GetAEAD. If wrappedMaster is nil, a
+// new master secret is generated and wrapped with kek; it must be stored, as
+// returned by WrappedMaster, to derive the same keys again. Otherwise
+// wrappedMaster is unwrapped with kek.
+func NewDerivedKeyManager(kek tink.AEAD, wrappedMaster []byte) (*DerivedKeyManager, error) {
+	if kek == nil {
+		return nil, errors.New("kek must not be nil")
+	}
+	if wrappedMaster != nil {
+		master, err := kek.Decrypt(wrappedMaster, masterAssociatedData)
+		if err != nil {
+			return nil, fmt.Errorf("unwrapping master secret failed: %v", err)
+		}
+		if len(master) != masterSecretSize {
+			return nil, fmt.Errorf("invalid master secret: got %d bytes, want %d", len(master), masterSecretSize)
+		}
+		return &DerivedKeyManager{master: master, wrapped: append([]byte(nil), wrappedMaster...)}, nil
+	}
+	master := make([]byte, masterSecretSize)
+	if _, err := io.ReadFull(rand.Reader, master); err != nil {
+		return nil, err
+	}
+	wrapped, err := kek.Encrypt(master, masterAssociatedData)
+	if err != nil {
+		return nil, fmt.Errorf("wrapping master secret failed: %v", err)
+	}
+	return &DerivedKeyManager{master: master, wrapped: wrapped}, nil
+}
+
+// WrappedMaster returns the master secret of m, wrapped by the Cloud KMS
+// key.
+func (m *DerivedKeyManager) WrappedMaster() []byte {
+	return append([]byte(nil), m.wrapped...)
+}
+
+// TenantAEAD returns the AES-256-GCM AEAD of the tenant with the given ID,
+// which must not be empty. Its ciphertexts are those of Tink's AES-GCM
+// primitive without an output prefix, i.e. a 12-byte IV, the ciphertext and
+// a 16-byte tag.
+//
+// The key is derived anew on every call, which is cheap and needs no Cloud
+// KMS call; callers may keep the AEAD for as long as they need it.
+func (m *DerivedKeyManager) TenantAEAD(tenantID string) (tink.AEAD, error) {
+	if tenantID == "" {
+		return nil, errors.New("tenant ID must not be empty")
+	}
+	info := append(append([]byte(nil), tenantAEADLabel...), tenantID...)
+	key, err := subtle.ComputeHKDF("SHA256", m.master, derivationSalt, info, derivedKeySize)
+	if err != nil {
+		return nil, err
+	}
+	a, err := aeadsubtle.NewAESGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	aeadsubtle "github.com/tink-crypto/tink-go/v2/aead/subtle"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+func newDerivedKeyManager(t *testing.T, kek tink.AEAD, wrappedMaster []byte) *gcpkms.DerivedKeyManager {
+	t.Helper()
+	m, err := gcpkms.NewDerivedKeyManager(kek, wrappedMaster)
+	if err != nil {
+		t.Fatalf("gcpkms.NewDerivedKeyManager() err = %v, want nil", err)
+	}
+	return m
+}
+
+func tenantAEAD(t *testing.T, m *gcpkms.DerivedKeyManager, tenantID string) tink.AEAD {
+	t.Helper()
+	a, err := m.TenantAEAD(tenantID)
+	if err != nil {
+		t.Fatalf("m.TenantAEAD(%q) err = %v, want nil", tenantID, err)
+	}
+	return a
+}
+
+func TestDerivedKeyManagerIsStableAcrossRestarts(t *testing.T) {
+	srv := newFakeServer(t)
+	m := newDerivedKeyManager(t, newFakeAEAD(t, srv), nil)
+	plaintext, associatedData := []byte("plaintext"), []byte("associated data")
+	ciphertext, err := tenantAEAD(t, m, "tenant-a").Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("Encrypt() err = %v, want nil", err)
+	}
+
+	// A new client, as after a restart, unwraps the stored master secret and
+	// derives the same key.
+	restarted := newDerivedKeyManager(t, newFakeAEAD(t, srv), m.WrappedMaster())
+	got, err := tenantAEAD(t, restarted, "tenant-a").Decrypt(ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("Decrypt() after the restart err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("Decrypt() after the restart = %q, want %q", got, plaintext)
+	}
+	if got := srv.CallCount("Decrypt"); got != 1 {
+		t.Errorf("Decrypt calls = %d, want 1 to unwrap the master secret", got)
+	}
+}
+
+func TestDerivedKeyManagerIsolatesTenants(t *testing.T) {
+	srv := newFakeServer(t)
+	m := newDerivedKeyManager(t, newFakeAEAD(t, srv), nil)
+	other := newDerivedKeyManager(t, newFakeAEAD(t, srv), nil)
+	ciphertext, err := tenantAEAD(t, m, "tenant-a").Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name     string
+		m        *gcpkms.DerivedKeyManager
+		tenantID string
+	}{
+		{name: "other tenant", m: m, tenantID: "tenant-b"},
+		{name: "tenant ID with a suffix", m: m, tenantID: "tenant-a\x00"},
+		{name: "tenant ID with another case", m: m, tenantID: "Tenant-a"},
+		{name: "other master secret", m: other, tenantID: "tenant-a"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := tenantAEAD(t, tc.m, tc.tenantID).Decrypt(ciphertext, nil); err == nil {
+				t.Error("Decrypt() err = nil, want error")
+			}
+		})
+	}
+}
+
+// identityKEK is a KEK that does not encrypt, so that tests can choose the
+// master secret of a DerivedKeyManager.
+type identityKEK struct{}
+
+func (identityKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) { return plaintext, nil }
+func (identityKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return ciphertext, nil
+}
+
+func TestDerivedKeyManagerDerivation(t *testing.T) {
+	master := make([]byte, 32)
+	for i := range master {
+		master[i] = byte(i)
+	}
+	m := newDerivedKeyManager(t, identityKEK{}, master)
+	// The keys were computed independently with HKDF-SHA256 as documented.
+	for tenantID, keyHex := range map[string]string{
+		"tenant-a": "13a0148ec6378ea41a7bddaa52a9bfc8f5bbaf300e7e2562bfaa4c09dc748c56",
+		"tenant-b": "03a6f5189392ed81e1ceafa156f9da43bdca8f29326802e2c763a7f6d56baea5",
+	} {
+		key, err := hex.DecodeString(keyHex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := aeadsubtle.NewAESGCM(key)
+		if err != nil {
+			t.Fatalf("aeadsubtle.NewAESGCM() err = %v, want nil", err)
+		}
+		ciphertext, err := tenantAEAD(t, m, tenantID).Encrypt([]byte("plaintext"), []byte("ad"))
+		if err != nil {
+			t.Fatalf("Encrypt() err = %v, want nil", err)
+		}
+		if _, err := want.Decrypt(ciphertext, []byte("ad")); err != nil {
+			t.Errorf("tenant %q: Decrypt() with the expected key err = %v, want nil", tenantID, err)
+		}
+	}
+}
+
+func TestDerivedKeyManagerRejectsInvalidInputs(t *testing.T) {
+	srv := newFakeServer(t)
+	kek := newFakeAEAD(t, srv)
+	if _, err := gcpkms.NewDerivedKeyManager(nil, nil); err == nil {
+		t.Error("gcpkms.NewDerivedKeyManager(nil, nil) err = nil, want error")
+	}
+	// A ciphertext of the KEK that is not a wrapped master secret.
+	ciphertext, err := kek.Encrypt(make([]byte, 32), nil)
+	if err != nil {
+		t.Fatalf("kek.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := gcpkms.NewDerivedKeyManager(kek, ciphertext); err == nil {
+		t.Error("gcpkms.NewDerivedKeyManager() with another ciphertext of the KEK err = nil, want error")
+	}
+	if _, err := gcpkms.NewDerivedKeyManager(identityKEK{}, make([]byte, 16)); err == nil {
+		t.Error("gcpkms.NewDerivedKeyManager() with a short master secret err = nil, want error")
+	}
+	m := newDerivedKeyManager(t, kek, nil)
+	if _, err := m.TenantAEAD(""); err == nil {
+		t.Error("m.TenantAEAD(\"\") err = nil, want error")
+	}
+}
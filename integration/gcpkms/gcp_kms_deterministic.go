@@ -0,0 +1,180 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/tink-crypto/tink-go/v2/daead"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// wrappedDEKLengthSize is the size of the length prefix of the wrapped key
+// embedded in ciphertexts.
+const wrappedDEKLengthSize = 4
+
+// DeterministicEnvelopeAEAD is a deterministic AEAD that encrypts locally
+// with an AES-SIV key (the DEK), which is wrapped by a Cloud KMS key (the
+// KEK). Cloud KMS does not support deterministic encryption itself.
+//
+// The wrapped DEK is a Tink keyset encrypted with the KEK. By default, it is
+// stored separately from the ciphertexts: it is returned by WrappedDEK and
+// must be passed back with WithWrappedDEK to decrypt the ciphertexts later.
+// Ciphertexts are then AES-SIV ciphertexts in Tink's format.
+//
+// With WithEmbeddedWrappedDEK, every ciphertext instead has the format
+//
+//	len(wrapped DEK) (4 bytes, big-endian) || wrapped DEK || AES-SIV ciphertext
+//
+// so that it can be decrypted without knowing the DEK in advance.
+//
+// Equal plaintexts and associated data only yield equal ciphertexts under
+// the same DEK. To get equal ciphertexts across processes, e.g. for blind
+// indexes, pass the same wrapped DEK with WithWrappedDEK everywhere.
+type DeterministicEnvelopeAEAD struct {
+	kek        tink.AEAD
+	wrappedDEK []byte
+	dek        tink.DeterministicAEAD
+	embed      bool
+
+	mu sync.Mutex
+	// deks caches the DEKs embedded in ciphertexts, by wrapped DEK.
+	deks map[string]tink.DeterministicAEAD
+}
+
+var _ tink.DeterministicAEAD = (*DeterministicEnvelopeAEAD)(nil)
+
+// NewDeterministicEnvelopeAEAD returns a deterministic AEAD whose AES-SIV key
+// is wrapped by the Cloud KMS key with the given URI. The key is generated,
+// unless an existing one is passed with WithWrappedDEK. opts also configure
+// the client used to call Cloud KMS.
+func NewDeterministicEnvelopeAEAD(ctx context.Context, keyURI string, opts ...Option) (*DeterministicEnvelopeAEAD, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	client, err := NewClient(ctx, keyURI, opts...)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := client.GetAEAD(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	a := &DeterministicEnvelopeAEAD{
+		kek:   kek,
+		embed: cfg.embedWrappedDEK,
+		deks:  make(map[string]tink.DeterministicAEAD),
+	}
+	if cfg.wrappedDEK != nil {
+		a.wrappedDEK = cfg.wrappedDEK
+		if a.dek, err = unwrapDEK(kek, cfg.wrappedDEK); err != nil {
+			return nil, err
+		}
+		return a, nil
+	}
+	handle, err := keyset.NewHandle(daead.AESSIVKeyTemplate())
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	if err := handle.Write(keyset.NewBinaryWriter(buf), kek); err != nil {
+		return nil, fmt.Errorf("wrapping DEK failed: %v", err)
+	}
+	a.wrappedDEK = buf.Bytes()
+	if a.dek, err = daead.New(handle); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func unwrapDEK(kek tink.AEAD, wrapped []byte) (tink.DeterministicAEAD, error) {
+	handle, err := keyset.Read(keyset.NewBinaryReader(bytes.NewReader(wrapped)), kek)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping DEK failed: %v", err)
+	}
+	return daead.New(handle)
+}
+
+// WrappedDEK returns the AES-SIV key of a, wrapped by the Cloud KMS key.
+func (a *DeterministicEnvelopeAEAD) WrappedDEK() []byte {
+	return append([]byte(nil), a.wrappedDEK...)
+}
+
+// EncryptDeterministically deterministically encrypts plaintext with
+// associatedData.
+func (a *DeterministicEnvelopeAEAD) EncryptDeterministically(plaintext, associatedData []byte) ([]byte, error) {
+	ciphertext, err := a.dek.EncryptDeterministically(plaintext, associatedData)
+	if err != nil {
+		return nil, err
+	}
+	if !a.embed {
+		return ciphertext, nil
+	}
+	out := make([]byte, 0, wrappedDEKLengthSize+len(a.wrappedDEK)+len(ciphertext))
+	out = binary.BigEndian.AppendUint32(out, uint32(len(a.wrappedDEK)))
+	out = append(out, a.wrappedDEK...)
+	return append(out, ciphertext...), nil
+}
+
+// DecryptDeterministically decrypts ciphertext with associatedData.
+func (a *DeterministicEnvelopeAEAD) DecryptDeterministically(ciphertext, associatedData []byte) ([]byte, error) {
+	if !a.embed {
+		return a.dek.DecryptDeterministically(ciphertext, associatedData)
+	}
+	if len(ciphertext) < wrappedDEKLengthSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	n := binary.BigEndian.Uint32(ciphertext)
+	if uint64(n) > uint64(len(ciphertext)-wrappedDEKLengthSize) {
+		return nil, errors.New("invalid wrapped DEK length")
+	}
+	wrapped := ciphertext[wrappedDEKLengthSize : wrappedDEKLengthSize+int(n)]
+	dek, err := a.embeddedDEK(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return dek.DecryptDeterministically(ciphertext[wrappedDEKLengthSize+int(n):], associatedData)
+}
+
+// embeddedDEK returns the DEK wrapped by wrapped, unwrapping it with Cloud
+// KMS unless it is a's own DEK or has been unwrapped before.
+func (a *DeterministicEnvelopeAEAD) embeddedDEK(wrapped []byte) (tink.DeterministicAEAD, error) {
+	if bytes.Equal(wrapped, a.wrappedDEK) {
+		return a.dek, nil
+	}
+	a.mu.Lock()
+	dek, ok := a.deks[string(wrapped)]
+	a.mu.Unlock()
+	if ok {
+		return dek, nil
+	}
+	dek, err := unwrapDEK(a.kek, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deks[string(wrapped)] = dek
+	return dek, nil
+}
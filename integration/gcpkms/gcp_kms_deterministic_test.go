@@ -0,0 +1,152 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+func newFakeDeterministicAEAD(t *testing.T, srv *fakekms.Server, opts ...gcpkms.Option) *gcpkms.DeterministicEnvelopeAEAD {
+	t.Helper()
+	opts = append([]gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()}, opts...)
+	a, err := gcpkms.NewDeterministicEnvelopeAEAD(context.Background(), fakeKeyURI, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewDeterministicEnvelopeAEAD() err = %v, want nil", err)
+	}
+	return a
+}
+
+func TestDeterministicEnvelopeAEAD(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "separate DEK"},
+		{name: "embedded DEK", opts: []gcpkms.Option{gcpkms.WithEmbeddedWrappedDEK()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			a := newFakeDeterministicAEAD(t, srv, tc.opts...)
+			plaintext, associatedData := []byte("plaintext"), []byte("associated data")
+
+			ct1, err := a.EncryptDeterministically(plaintext, associatedData)
+			if err != nil {
+				t.Fatalf("a.EncryptDeterministically() err = %v, want nil", err)
+			}
+			ct2, err := a.EncryptDeterministically(plaintext, associatedData)
+			if err != nil {
+				t.Fatalf("a.EncryptDeterministically() err = %v, want nil", err)
+			}
+			if !bytes.Equal(ct1, ct2) {
+				t.Errorf("a.EncryptDeterministically() of equal inputs = %x and %x, want equal", ct1, ct2)
+			}
+			got, err := a.DecryptDeterministically(ct1, associatedData)
+			if err != nil {
+				t.Fatalf("a.DecryptDeterministically() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("a.DecryptDeterministically() = %q, want %q", got, plaintext)
+			}
+
+			ct3, err := a.EncryptDeterministically(plaintext, []byte("other associated data"))
+			if err != nil {
+				t.Fatalf("a.EncryptDeterministically() err = %v, want nil", err)
+			}
+			if bytes.Equal(ct1, ct3) {
+				t.Errorf("a.EncryptDeterministically() with different associated data = %x, want different ciphertexts", ct1)
+			}
+			if _, err := a.DecryptDeterministically(ct1, []byte("other associated data")); err == nil {
+				t.Error("a.DecryptDeterministically() with wrong associated data err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestDeterministicEnvelopeAEADWithWrappedDEK(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeDeterministicAEAD(t, srv)
+	b := newFakeDeterministicAEAD(t, srv, gcpkms.WithWrappedDEK(a.WrappedDEK()))
+	other := newFakeDeterministicAEAD(t, srv)
+	plaintext := []byte("plaintext")
+
+	ctA, err := a.EncryptDeterministically(plaintext, nil)
+	if err != nil {
+		t.Fatalf("a.EncryptDeterministically() err = %v, want nil", err)
+	}
+	ctB, err := b.EncryptDeterministically(plaintext, nil)
+	if err != nil {
+		t.Fatalf("b.EncryptDeterministically() err = %v, want nil", err)
+	}
+	if !bytes.Equal(ctA, ctB) {
+		t.Errorf("ciphertexts under the same wrapped DEK = %x and %x, want equal", ctA, ctB)
+	}
+	if got, err := b.DecryptDeterministically(ctA, nil); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("b.DecryptDeterministically() = %q, %v, want %q, nil", got, err, plaintext)
+	}
+	ctOther, err := other.EncryptDeterministically(plaintext, nil)
+	if err != nil {
+		t.Fatalf("other.EncryptDeterministically() err = %v, want nil", err)
+	}
+	if bytes.Equal(ctA, ctOther) {
+		t.Errorf("ciphertexts under different DEKs = %x, want different", ctA)
+	}
+}
+
+func TestDeterministicEnvelopeAEADDecryptsEmbeddedDEKs(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeDeterministicAEAD(t, srv, gcpkms.WithEmbeddedWrappedDEK())
+	b := newFakeDeterministicAEAD(t, srv, gcpkms.WithEmbeddedWrappedDEK())
+	plaintext := []byte("plaintext")
+
+	ciphertext, err := a.EncryptDeterministically(plaintext, nil)
+	if err != nil {
+		t.Fatalf("a.EncryptDeterministically() err = %v, want nil", err)
+	}
+	decrypts := srv.CallCount("Decrypt")
+	for i := 0; i < 2; i++ {
+		got, err := b.DecryptDeterministically(ciphertext, nil)
+		if err != nil {
+			t.Fatalf("b.DecryptDeterministically() err = %v, want nil", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("b.DecryptDeterministically() = %q, want %q", got, plaintext)
+		}
+	}
+	if got := srv.CallCount("Decrypt") - decrypts; got != 1 {
+		t.Errorf("Decrypt calls = %d, want 1", got)
+	}
+	for _, ct := range [][]byte{nil, {0, 0, 0}, {0, 0, 0, 9, 1}, append([]byte{0, 0, 0, 1}, ciphertext...)} {
+		if _, err := b.DecryptDeterministically(ct, nil); err == nil {
+			t.Errorf("b.DecryptDeterministically(%x) err = nil, want error", ct)
+		}
+	}
+}
+
+func TestNewDeterministicEnvelopeAEADWithInvalidWrappedDEK(t *testing.T) {
+	srv := newFakeServer(t)
+	for _, wrapped := range [][]byte{nil, []byte("invalid")} {
+		opts := []gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithWrappedDEK(wrapped)}
+		if _, err := gcpkms.NewDeterministicEnvelopeAEAD(context.Background(), fakeKeyURI, opts...); err == nil {
+			t.Errorf("gcpkms.NewDeterministicEnvelopeAEAD() with wrapped DEK %q err = nil, want error", wrapped)
+		}
+	}
+}
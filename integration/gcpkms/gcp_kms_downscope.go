@@ -0,0 +1,68 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google/downscope"
+)
+
+// maxAccessBoundaryRules is the maximum number of rules of a Credential Access
+// Boundary.
+const maxAccessBoundaryRules = 10
+
+// AccessBoundaryRule is a rule of the Credential Access Boundary of
+// WithDownscopedCredentials. It makes the permissions of the given IAM roles,
+// e.g. "inRole:roles/cloudkms.cryptoKeyEncrypterDecrypter", available on the
+// given resource, e.g.
+// "//cloudkms.googleapis.com/projects/p/locations/l/keyRings/r".
+type AccessBoundaryRule = downscope.AccessBoundaryRule
+
+// KeyAccessBoundaryRule returns an AccessBoundaryRule that makes the
+// permissions of roles available on the crypto key or key ring with the given
+// resource name, e.g. "projects/p/locations/l/keyRings/r/cryptoKeys/k". roles
+// are IAM role names, e.g. "roles/cloudkms.cryptoKeyEncrypterDecrypter",
+// which is used if roles is empty.
+func KeyAccessBoundaryRule(resourceName string, roles ...string) (AccessBoundaryRule, error) {
+	if !cryptoKeyRegex.MatchString(resourceName) && !keyRingRegex.MatchString(resourceName) {
+		return AccessBoundaryRule{}, fmt.Errorf("resource name must name a crypto key or a key ring, got %q", resourceName)
+	}
+	if len(roles) == 0 {
+		roles = []string{"roles/cloudkms.cryptoKeyEncrypterDecrypter"}
+	}
+	permissions := make([]string, len(roles))
+	for i, role := range roles {
+		if !strings.HasPrefix(role, "roles/") && !strings.Contains(role, "/roles/") {
+			return AccessBoundaryRule{}, fmt.Errorf("role must be an IAM role name, got %q", role)
+		}
+		permissions[i] = "inRole:" + role
+	}
+	return AccessBoundaryRule{
+		AvailableResource:    "//cloudkms.googleapis.com/" + resourceName,
+		AvailablePermissions: permissions,
+	}, nil
+}
+
+// newDownscopedTokenSource returns a token source that exchanges the tokens
+// of root for tokens limited by rules with the Security Token Service.
+func newDownscopedTokenSource(ctx context.Context, root oauth2.TokenSource, rules []AccessBoundaryRule) (oauth2.TokenSource, error) {
+	return downscope.NewTokenSource(ctx, downscope.DownscopingConfig{RootSource: root, Rules: rules})
+}
@@ -0,0 +1,238 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// recordingDownscoper creates token sources that stand in for the Security
+// Token Service: they prefix the tokens of the root source with
+// "downscoped-", and record the rules and the exchanged tokens.
+type recordingDownscoper struct {
+	mu     sync.Mutex
+	rules  []gcpkms.AccessBoundaryRule
+	tokens []string
+}
+
+func (d *recordingDownscoper) newSource(ctx context.Context, root oauth2.TokenSource, rules []gcpkms.AccessBoundaryRule) (oauth2.TokenSource, error) {
+	d.mu.Lock()
+	d.rules = rules
+	d.mu.Unlock()
+	return recordingTokenSource{d: d, root: root}, nil
+}
+
+func (d *recordingDownscoper) exchanged() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.tokens...)
+}
+
+type recordingTokenSource struct {
+	d    *recordingDownscoper
+	root oauth2.TokenSource
+}
+
+func (s recordingTokenSource) Token() (*oauth2.Token, error) {
+	tok, err := s.root.Token()
+	if err != nil {
+		return nil, err
+	}
+	s.d.mu.Lock()
+	defer s.d.mu.Unlock()
+	s.d.tokens = append(s.d.tokens, tok.AccessToken)
+	return &oauth2.Token{AccessToken: "downscoped-" + tok.AccessToken, TokenType: "Bearer", Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+func TestWithDownscopedCredentials(t *testing.T) {
+	srv := newAuthServer(t, func(token string) bool { return token == "downscoped-token-1" })
+	rule, err := gcpkms.KeyAccessBoundaryRule(fakeKeyName)
+	if err != nil {
+		t.Fatalf("gcpkms.KeyAccessBoundaryRule() err = %v, want nil", err)
+	}
+	rules := []gcpkms.AccessBoundaryRule{rule}
+	d := &recordingDownscoper{}
+	a := srv.newAEAD(t, gcpkms.WithDownscopedCredentials(rules), gcpkms.WithDownscopedTokenSource(d.newSource))
+	for i := 0; i < 3; i++ {
+		if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+	}
+	if !reflect.DeepEqual(d.rules, rules) {
+		t.Errorf("rules = %+v, want %+v", d.rules, rules)
+	}
+	// The downscoped token is cached until it expires.
+	if got, want := d.exchanged(), []string{"token-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exchanged tokens = %q, want %q", got, want)
+	}
+	if got := atomic.LoadInt32(&srv.encryptRequests); got != 3 {
+		t.Errorf("Encrypt requests = %d, want 3", got)
+	}
+}
+
+func TestWithDownscopedCredentialsFileWatch(t *testing.T) {
+	srv := newAuthServer(t, func(token string) bool { return token == "downscoped-token-1" })
+	path := t.TempDir() + "/credentials.json"
+	writeCredentials(t, path, srv.credentialsJSON(t), time.Now())
+	rule, err := gcpkms.KeyAccessBoundaryRule(fakeKeyName)
+	if err != nil {
+		t.Fatalf("gcpkms.KeyAccessBoundaryRule() err = %v, want nil", err)
+	}
+	d := &recordingDownscoper{}
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.srv.URL+"/")),
+		gcpkms.WithBaseTransport(srv.srv.Client().Transport),
+		gcpkms.WithCredentialsFileWatch(path),
+		gcpkms.WithDownscopedCredentials([]gcpkms.AccessBoundaryRule{rule}),
+		gcpkms.WithDownscopedTokenSource(d.newSource))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got, want := d.exchanged(), []string{"token-1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("exchanged tokens = %q, want %q", got, want)
+	}
+}
+
+func TestWithDownscopedCredentialsRejectsInvalidRules(t *testing.T) {
+	valid := gcpkms.AccessBoundaryRule{
+		AvailableResource:    "//cloudkms.googleapis.com/" + fakeKeyName,
+		AvailablePermissions: []string{"inRole:roles/cloudkms.cryptoKeyEncrypterDecrypter"},
+	}
+	for _, tc := range []struct {
+		name  string
+		rules []gcpkms.AccessBoundaryRule
+	}{
+		{name: "nil", rules: nil},
+		{name: "empty", rules: []gcpkms.AccessBoundaryRule{}},
+		{name: "too many", rules: make([]gcpkms.AccessBoundaryRule, 11)},
+		{name: "no resource", rules: []gcpkms.AccessBoundaryRule{valid, {AvailablePermissions: valid.AvailablePermissions}}},
+		{name: "no permissions", rules: []gcpkms.AccessBoundaryRule{{AvailableResource: valid.AvailableResource}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithDownscopedCredentials(tc.rules)); err == nil {
+				t.Error("gcpkms.NewClient() err = nil, want error")
+			}
+		})
+	}
+}
+
+// staticCredentials are per-RPC credentials with a fixed token.
+type staticCredentials struct{}
+
+func (staticCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer token"}, nil
+}
+
+func (staticCredentials) RequireTransportSecurity() bool { return true }
+
+func TestWithDownscopedCredentialsRejectsConflictingOptions(t *testing.T) {
+	rule, err := gcpkms.KeyAccessBoundaryRule(fakeKeyName)
+	if err != nil {
+		t.Fatalf("gcpkms.KeyAccessBoundaryRule() err = %v, want nil", err)
+	}
+	downscoped := gcpkms.WithDownscopedCredentials([]gcpkms.AccessBoundaryRule{rule})
+	for _, tc := range []struct {
+		name string
+		opt  gcpkms.Option
+	}{
+		{name: "WithInsecureTransport", opt: gcpkms.WithInsecureTransport()},
+		{name: "WithReauthentication", opt: gcpkms.WithReauthentication()},
+		{name: "WithPerRPCCredentials", opt: gcpkms.WithPerRPCCredentials(staticCredentials{})},
+		{name: "option.WithHTTPClient", opt: gcpkms.WithGoogleAPIClientOptions(option.WithHTTPClient(http.DefaultClient))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, downscoped, tc.opt); err == nil {
+				t.Error("gcpkms.NewClient() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestKeyAccessBoundaryRule(t *testing.T) {
+	const keyRing = "projects/p/locations/global/keyRings/r"
+	for _, tc := range []struct {
+		name         string
+		resourceName string
+		roles        []string
+		want         gcpkms.AccessBoundaryRule
+	}{
+		{
+			name:         "key with default role",
+			resourceName: fakeKeyName,
+			want: gcpkms.AccessBoundaryRule{
+				AvailableResource:    "//cloudkms.googleapis.com/" + fakeKeyName,
+				AvailablePermissions: []string{"inRole:roles/cloudkms.cryptoKeyEncrypterDecrypter"},
+			},
+		},
+		{
+			name:         "key ring with roles",
+			resourceName: keyRing,
+			roles:        []string{"roles/cloudkms.signerVerifier", "projects/p/roles/custom"},
+			want: gcpkms.AccessBoundaryRule{
+				AvailableResource:    "//cloudkms.googleapis.com/" + keyRing,
+				AvailablePermissions: []string{"inRole:roles/cloudkms.signerVerifier", "inRole:projects/p/roles/custom"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := gcpkms.KeyAccessBoundaryRule(tc.resourceName, tc.roles...)
+			if err != nil {
+				t.Fatalf("gcpkms.KeyAccessBoundaryRule() err = %v, want nil", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("gcpkms.KeyAccessBoundaryRule() = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestKeyAccessBoundaryRuleRejectsInvalidArguments(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		resourceName string
+		roles        []string
+	}{
+		{name: "key URI", resourceName: fakeKeyURI},
+		{name: "key version", resourceName: fakeKeyName + "/cryptoKeyVersions/1"},
+		{name: "location", resourceName: "projects/p/locations/global"},
+		{name: "role without prefix", resourceName: fakeKeyName, roles: []string{"cloudkms.cryptoKeyEncrypterDecrypter"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.KeyAccessBoundaryRule(tc.resourceName, tc.roles...); err == nil {
+				t.Error("gcpkms.KeyAccessBoundaryRule() err = nil, want error")
+			}
+		})
+	}
+}
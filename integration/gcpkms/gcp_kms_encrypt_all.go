@@ -0,0 +1,95 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// Item is a plaintext to be encrypted by EncryptAll.
+type Item struct {
+	Plaintext      []byte
+	AssociatedData []byte
+}
+
+// Result is the outcome of encrypting an Item with EncryptAll. Exactly one of
+// Ciphertext and Err is set.
+type Result struct {
+	// Index is the position of the item among all items read by EncryptAll,
+	// starting at 0. Results are sent in completion order, not in input
+	// order.
+	Index      int
+	Item       Item
+	Ciphertext []byte
+	Err        error
+}
+
+// contextEncrypter is implemented by primitives, such as *AEAD, whose Encrypt
+// requests can be bound to a context.
+type contextEncrypter interface {
+	EncryptWithContext(ctx context.Context, plaintext, associatedData []byte) ([]byte, error)
+}
+
+// EncryptAll encrypts every item read from items with a, using at most
+// concurrency concurrent Encrypt calls, and sends one Result per item to
+// results. It returns, and closes results, once items has been closed and
+// all results have been sent. The caller must keep reading results until
+// then.
+//
+// Once ctx is done, in-flight calls are canceled if a supports it, as *AEAD
+// does, and the remaining items are still read and get a Result with the
+// context's error. A concurrency of less than 1 is treated as 1.
+func EncryptAll(ctx context.Context, a tink.AEAD, items <-chan Item, results chan<- Result, concurrency int) {
+	defer close(results)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobs := make(chan Result)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range jobs {
+				results <- encryptItem(ctx, a, r)
+			}
+		}()
+	}
+	index := 0
+	for item := range items {
+		jobs <- Result{Index: index, Item: item}
+		index++
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func encryptItem(ctx context.Context, a tink.AEAD, r Result) Result {
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+		return r
+	}
+	if c, ok := a.(contextEncrypter); ok {
+		r.Ciphertext, r.Err = c.EncryptWithContext(ctx, r.Item.Plaintext, r.Item.AssociatedData)
+	} else {
+		r.Ciphertext, r.Err = a.Encrypt(r.Item.Plaintext, r.Item.AssociatedData)
+	}
+	return r
+}
@@ -0,0 +1,210 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// countingAEAD is a fake tink.AEAD that records the maximum number of
+// concurrent Encrypt calls. Encrypt blocks until release is closed and fails
+// for plaintexts starting with "fail".
+type countingAEAD struct {
+	release     chan struct{}
+	inFlight    int32
+	maxInFlight int32
+}
+
+func (a *countingAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	n := atomic.AddInt32(&a.inFlight, 1)
+	defer atomic.AddInt32(&a.inFlight, -1)
+	for {
+		max := atomic.LoadInt32(&a.maxInFlight)
+		if n <= max || atomic.CompareAndSwapInt32(&a.maxInFlight, max, n) {
+			break
+		}
+	}
+	<-a.release
+	if bytes.HasPrefix(plaintext, []byte("fail")) {
+		return nil, errors.New("encryption failed")
+	}
+	return append([]byte("ciphertext:"), plaintext...), nil
+}
+
+func (a *countingAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func sendItems(items chan<- gcpkms.Item, n int, plaintext func(i int) string) {
+	for i := 0; i < n; i++ {
+		items <- gcpkms.Item{Plaintext: []byte(plaintext(i))}
+	}
+	close(items)
+}
+
+// waitForGoroutines waits until at most n goroutines are running.
+func waitForGoroutines(t *testing.T, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > n {
+		if time.Now().After(deadline) {
+			t.Fatalf("runtime.NumGoroutine() = %d, want at most %d", runtime.NumGoroutine(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestEncryptAllWithFakeServer(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	const n = 1000
+	items := make(chan gcpkms.Item)
+	results := make(chan gcpkms.Result)
+	go sendItems(items, n, func(i int) string { return fmt.Sprintf("plaintext %d", i) })
+	go gcpkms.EncryptAll(context.Background(), a, items, results, 16)
+
+	seen := make(map[int]bool)
+	for r := range results {
+		if seen[r.Index] {
+			t.Fatalf("more than one result for item %d", r.Index)
+		}
+		seen[r.Index] = true
+		if r.Err != nil {
+			t.Fatalf("result %d has err = %v, want nil", r.Index, r.Err)
+		}
+		want := fmt.Sprintf("plaintext %d", r.Index)
+		if string(r.Item.Plaintext) != want {
+			t.Fatalf("result %d has plaintext %q, want %q", r.Index, r.Item.Plaintext, want)
+		}
+		got, err := a.Decrypt(r.Ciphertext, nil)
+		if err != nil {
+			t.Fatalf("a.Decrypt() err = %v, want nil", err)
+		}
+		if string(got) != want {
+			t.Fatalf("a.Decrypt() = %q, want %q", got, want)
+		}
+	}
+	if len(seen) != n {
+		t.Errorf("got %d results, want %d", len(seen), n)
+	}
+	if got := srv.CallCount("Encrypt"); got != n {
+		t.Errorf("Encrypt called %d times, want %d", got, n)
+	}
+}
+
+func TestEncryptAllBoundsConcurrencyAndDoesNotLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	a := &countingAEAD{release: make(chan struct{})}
+	const n, concurrency = 200, 8
+	items := make(chan gcpkms.Item)
+	results := make(chan gcpkms.Result)
+	go sendItems(items, n, func(i int) string {
+		if i%10 == 0 {
+			return fmt.Sprintf("fail %d", i)
+		}
+		return fmt.Sprintf("plaintext %d", i)
+	})
+	go gcpkms.EncryptAll(context.Background(), a, items, results, concurrency)
+
+	// Let the pool fill up before releasing the calls.
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&a.inFlight) < concurrency && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	close(a.release)
+
+	failures := 0
+	count := 0
+	for r := range results {
+		count++
+		if (r.Err != nil) == (r.Ciphertext != nil) {
+			t.Errorf("result %d has ciphertext %q and err %v, want exactly one", r.Index, r.Ciphertext, r.Err)
+		}
+		if r.Err != nil {
+			failures++
+		}
+	}
+	if count != n {
+		t.Errorf("got %d results, want %d", count, n)
+	}
+	if failures != n/10 {
+		t.Errorf("got %d failures, want %d", failures, n/10)
+	}
+	if got := atomic.LoadInt32(&a.maxInFlight); got != concurrency {
+		t.Errorf("max concurrent Encrypt calls = %d, want %d", got, concurrency)
+	}
+	waitForGoroutines(t, before)
+}
+
+func TestEncryptAllWithCanceledContext(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	const n = 50
+	items := make(chan gcpkms.Item)
+	results := make(chan gcpkms.Result)
+	go sendItems(items, n, func(i int) string { return "plaintext" })
+	go gcpkms.EncryptAll(ctx, a, items, results, 4)
+
+	count := 0
+	for r := range results {
+		count++
+		if !errors.Is(r.Err, context.Canceled) {
+			t.Errorf("result %d has err = %v, want %v", r.Index, r.Err, context.Canceled)
+		}
+	}
+	if count != n {
+		t.Errorf("got %d results, want %d", count, n)
+	}
+	if got := srv.CallCount("Encrypt"); got != 0 {
+		t.Errorf("Encrypt called %d times, want 0", got)
+	}
+}
+
+func TestEncryptAllStopsEncryptingAfterCancellation(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	ctx, cancel := context.WithCancel(context.Background())
+	items := make(chan gcpkms.Item)
+	results := make(chan gcpkms.Result)
+	go gcpkms.EncryptAll(ctx, a, items, results, 2)
+
+	items <- gcpkms.Item{Plaintext: []byte("plaintext")}
+	if r := <-results; r.Err != nil {
+		t.Fatalf("result %d has err = %v, want nil", r.Index, r.Err)
+	}
+	cancel()
+	items <- gcpkms.Item{Plaintext: []byte("plaintext")}
+	close(items)
+	r := <-results
+	if r.Index != 1 || !errors.Is(r.Err, context.Canceled) {
+		t.Errorf("result = %+v, want index 1 with err %v", r, context.Canceled)
+	}
+	if _, ok := <-results; ok {
+		t.Error("results is not closed")
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// endpointRetryDelay is how long an endpoint that could not be reached is
+// skipped before requests are sent to it again.
+const endpointRetryDelay = 5 * time.Second
+
+// balancedEndpoint is one of the endpoints of WithEndpoints.
+type balancedEndpoint struct {
+	scheme string
+	host   string
+	// downUntil is the time until which the endpoint is skipped, and zero
+	// while it is healthy.
+	downUntil time.Time
+}
+
+// endpointBalancer is an HTTP transport that spreads requests round-robin
+// across the endpoints of WithEndpoints by rewriting their URLs. Endpoints
+// that cannot be reached are skipped for endpointRetryDelay, and requests
+// that could not be sent because the connection to an endpoint failed are
+// sent to the next one.
+type endpointBalancer struct {
+	base       http.RoundTripper
+	clock      clock
+	retryDelay time.Duration
+
+	mu        sync.Mutex
+	endpoints []*balancedEndpoint
+	next      int
+}
+
+// parseEndpoint returns the scheme and host of endpoint, which is a URL
+// without a path, e.g. "https://cloudkms.us-east1.rep.googleapis.com/", or a
+// host and port, which use HTTPS.
+func parseEndpoint(endpoint string) (*balancedEndpoint, error) {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.User != nil {
+		return nil, errors.New("endpoint must be a host and port or a URL without a path")
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return nil, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+	return &balancedEndpoint{scheme: u.Scheme, host: u.Host}, nil
+}
+
+func newEndpointBalancer(endpoints []*balancedEndpoint, base http.RoundTripper, clk clock) *endpointBalancer {
+	b := &endpointBalancer{base: base, clock: clk, retryDelay: endpointRetryDelay}
+	for _, e := range endpoints {
+		// Copied, since the health of the endpoints is tracked per client.
+		e := *e
+		b.endpoints = append(b.endpoints, &e)
+	}
+	return b
+}
+
+// order returns the endpoints in the order in which a request tries them:
+// the healthy endpoints, starting with the next one in round-robin order,
+// and then the endpoints that are down, so that requests are still sent
+// when all are.
+func (b *endpointBalancer) order() []*balancedEndpoint {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := b.clock.Now()
+	n := len(b.endpoints)
+	start := b.next
+	b.next = (b.next + 1) % n
+	healthy := make([]*balancedEndpoint, 0, n)
+	var down []*balancedEndpoint
+	for i := 0; i < n; i++ {
+		e := b.endpoints[(start+i)%n]
+		if now.Before(e.downUntil) {
+			down = append(down, e)
+		} else {
+			healthy = append(healthy, e)
+		}
+	}
+	return append(healthy, down...)
+}
+
+// setHealthy records whether a request could be sent to e.
+func (b *endpointBalancer) setHealthy(e *balancedEndpoint, healthy bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if healthy {
+		e.downUntil = time.Time{}
+	} else {
+		e.downUntil = b.clock.Now().Add(b.retryDelay)
+	}
+}
+
+func (b *endpointBalancer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var err error
+	for _, e := range b.order() {
+		// RoundTrippers must not modify the original request.
+		r := req.Clone(req.Context())
+		r.URL.Scheme = e.scheme
+		r.URL.Host = e.host
+		r.Host = ""
+		if req.Body != nil && req.Body != http.NoBody && err != nil {
+			// Only the first attempt may use the original body.
+			if req.GetBody == nil {
+				return nil, err
+			}
+			if r.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+		var resp *http.Response
+		resp, err = b.base.RoundTrip(r)
+		if err == nil {
+			b.setHealthy(e, true)
+			return resp, nil
+		}
+		if req.Context().Err() != nil {
+			return nil, err
+		}
+		b.setHealthy(e, false)
+		if !isDialError(err) {
+			// The request may have reached the endpoint, so it is not sent
+			// again here. Retries are up to the retry policy of the client.
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// isDialError reports whether err means that no connection could be opened,
+// so the request was not sent.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
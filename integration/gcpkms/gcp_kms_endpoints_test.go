@@ -0,0 +1,279 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+// hostTransport records the hosts and bodies of the requests it receives,
+// and fails those to the hosts in down as if they could not be dialed, and
+// those to the hosts in broken after they were sent.
+type hostTransport struct {
+	mu     sync.Mutex
+	hosts  []string
+	bodies []string
+	down   map[string]bool
+	broken map[string]bool
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+		req.Body.Close()
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.hosts = append(t.hosts, req.URL.Host)
+	t.bodies = append(t.bodies, string(body))
+	if t.down[req.URL.Host] {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	}
+	if t.broken[req.URL.Host] {
+		return nil, errors.New("connection reset")
+	}
+	return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+}
+
+// takeHosts returns the hosts of the requests received since the last call.
+func (t *hostTransport) takeHosts() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	hosts := t.hosts
+	t.hosts = nil
+	return hosts
+}
+
+func newTestBalancer(t *testing.T, base http.RoundTripper, clock *fakeClock) *endpointBalancer {
+	t.Helper()
+	var endpoints []*balancedEndpoint
+	for _, endpoint := range []string{"a.example.com", "https://b.example.com/"} {
+		e, err := parseEndpoint(endpoint)
+		if err != nil {
+			t.Fatalf("parseEndpoint(%q) err = %v, want nil", endpoint, err)
+		}
+		endpoints = append(endpoints, e)
+	}
+	return newEndpointBalancer(endpoints, base, clock)
+}
+
+func roundTrip(t *testing.T, b *endpointBalancer, body string) error {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, "https://cloudkms.googleapis.com/v1/projects/p:encrypt", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("http.NewRequest() err = %v, want nil", err)
+	}
+	resp, err := b.RoundTrip(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func TestEndpointBalancerRoundRobin(t *testing.T) {
+	base := &hostTransport{}
+	b := newTestBalancer(t, base, newFakeClock())
+	for i := 0; i < 4; i++ {
+		if err := roundTrip(t, b, "body"); err != nil {
+			t.Fatalf("RoundTrip() err = %v, want nil", err)
+		}
+	}
+	want := []string{"a.example.com", "b.example.com", "a.example.com", "b.example.com"}
+	if got := base.takeHosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+}
+
+func TestEndpointBalancerFailsOverAndRecovers(t *testing.T) {
+	base := &hostTransport{down: map[string]bool{"b.example.com": true}}
+	clock := newFakeClock()
+	b := newTestBalancer(t, base, clock)
+
+	for i := 0; i < 2; i++ {
+		if err := roundTrip(t, b, "body"); err != nil {
+			t.Fatalf("RoundTrip() err = %v, want nil", err)
+		}
+	}
+	// The second request is sent to b, fails to connect and is re-sent to
+	// a, with the same body.
+	want := []string{"a.example.com", "b.example.com", "a.example.com"}
+	if got := base.takeHosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+	if want := []string{"body", "body", "body"}; !reflect.DeepEqual(base.bodies, want) {
+		t.Errorf("bodies = %q, want %q", base.bodies, want)
+	}
+
+	// b is skipped until the retry delay has passed.
+	for i := 0; i < 2; i++ {
+		if err := roundTrip(t, b, "body"); err != nil {
+			t.Fatalf("RoundTrip() err = %v, want nil", err)
+		}
+	}
+	if got, want := base.takeHosts(), []string{"a.example.com", "a.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts while b is down = %v, want %v", got, want)
+	}
+
+	base.mu.Lock()
+	base.down = nil
+	base.mu.Unlock()
+	clock.Advance(endpointRetryDelay)
+	for i := 0; i < 2; i++ {
+		if err := roundTrip(t, b, "body"); err != nil {
+			t.Fatalf("RoundTrip() err = %v, want nil", err)
+		}
+	}
+	if got, want := base.takeHosts(), []string{"a.example.com", "b.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts after b recovered = %v, want %v", got, want)
+	}
+}
+
+func TestEndpointBalancerAllDown(t *testing.T) {
+	base := &hostTransport{down: map[string]bool{"a.example.com": true, "b.example.com": true}}
+	b := newTestBalancer(t, base, newFakeClock())
+	if err := roundTrip(t, b, "body"); !isDialError(err) {
+		t.Errorf("RoundTrip() err = %v, want dial error", err)
+	}
+	// Endpoints that are down are still tried when no endpoint is healthy.
+	if err := roundTrip(t, b, "body"); !isDialError(err) {
+		t.Errorf("RoundTrip() err = %v, want dial error", err)
+	}
+	want := []string{"a.example.com", "b.example.com", "b.example.com", "a.example.com"}
+	if got := base.takeHosts(); !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+}
+
+func TestEndpointBalancerDoesNotResendSentRequests(t *testing.T) {
+	base := &hostTransport{broken: map[string]bool{"a.example.com": true}}
+	b := newTestBalancer(t, base, newFakeClock())
+	if err := roundTrip(t, b, "body"); err == nil {
+		t.Fatal("RoundTrip() err = nil, want error")
+	}
+	if got, want := base.takeHosts(), []string{"a.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+	// The next request avoids a.
+	if err := roundTrip(t, b, "body"); err != nil {
+		t.Fatalf("RoundTrip() err = %v, want nil", err)
+	}
+	if got, want := base.takeHosts(), []string{"b.example.com"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("hosts = %v, want %v", got, want)
+	}
+}
+
+const endpointsTestKeyName = "projects/p/locations/us/keyRings/r/cryptoKeys/k"
+
+// newReplicatedServers returns two fake servers with the same key material
+// for endpointsTestKeyName, like two regional endpoints of a multi-regional key.
+func newReplicatedServers(t *testing.T) (*fakekms.Server, *fakekms.Server) {
+	t.Helper()
+	material := bytes.Repeat([]byte{0x42}, 32)
+	var servers []*fakekms.Server
+	for i := 0; i < 2; i++ {
+		srv := fakekms.NewServer()
+		t.Cleanup(srv.Close)
+		if err := srv.CreateKeyWithMaterial(endpointsTestKeyName, material); err != nil {
+			t.Fatalf("srv.CreateKeyWithMaterial() err = %v, want nil", err)
+		}
+		servers = append(servers, srv)
+	}
+	return servers[0], servers[1]
+}
+
+func TestNewClientWithEndpointsSpreadsRequestsAndFailsOver(t *testing.T) {
+	srv1, srv2 := newReplicatedServers(t)
+	client, err := NewClient(context.Background(), "gcp-kms://"+endpointsTestKeyName,
+		WithEndpoints(srv1.URL()+"/", srv2.URL()+"/"), WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	a, err := client.GetAEAD("gcp-kms://" + endpointsTestKeyName)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	encryptDecrypt := func() {
+		t.Helper()
+		ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+		if err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+		if _, err := a.Decrypt(ciphertext, nil); err != nil {
+			t.Fatalf("a.Decrypt() err = %v, want nil", err)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		encryptDecrypt()
+	}
+	calls := func(srv *fakekms.Server) int {
+		return srv.CallCount("Encrypt") + srv.CallCount("Decrypt")
+	}
+	for _, srv := range []*fakekms.Server{srv1, srv2} {
+		if got := calls(srv); got != 10 {
+			t.Errorf("calls of %s = %d, want 10", srv.URL(), got)
+		}
+	}
+
+	srv2.Close()
+	for i := 0; i < 10; i++ {
+		encryptDecrypt()
+	}
+	if got := calls(srv1); got != 30 {
+		t.Errorf("calls of the remaining server = %d, want 30", got)
+	}
+}
+
+func TestWithEndpointsValidation(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "no endpoints", opts: []Option{WithEndpoints()}},
+		{name: "path", opts: []Option{WithEndpoints("https://cloudkms.googleapis.com/v1/")}},
+		{name: "scheme", opts: []Option{WithEndpoints("ftp://cloudkms.googleapis.com/")}},
+		{name: "empty host", opts: []Option{WithEndpoints("https:///")}},
+		{name: "regional endpoints", opts: []Option{WithEndpoints("cloudkms.us-east1.rep.googleapis.com"), WithRegionalEndpoints()}},
+		{name: "endpoint", opts: []Option{WithEndpoints("cloudkms.us-east1.rep.googleapis.com"), WithGoogleAPIClientOptions(option.WithEndpoint("https://cloudkms.googleapis.com/"))}},
+		{name: "HTTP client", opts: []Option{WithEndpoints("cloudkms.us-east1.rep.googleapis.com"), WithGoogleAPIClientOptions(option.WithHTTPClient(http.DefaultClient))}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewClient(context.Background(), "gcp-kms://", append(tc.opts, WithInsecureTransport())...); err == nil {
+				t.Error("NewClient() err = nil, want error")
+			}
+		})
+	}
+	_, err := NewClient(context.Background(), "gcp-kms://",
+		WithEndpoints("cloudkms.us-east1.rep.googleapis.com", "http://cloudkms.us-west1.rep.googleapis.com/"),
+		WithGoogleAPIClientOptions(option.WithoutAuthentication()), WithAllowUnauthenticated())
+	if !errors.Is(err, ErrInsecureTransport) {
+		t.Errorf("NewClient() with an HTTP endpoint err = %v, want %v", err, ErrInsecureTransport)
+	}
+}
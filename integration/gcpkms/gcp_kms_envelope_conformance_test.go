@@ -0,0 +1,349 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+const (
+	// fakeEnvelopeFixtures holds KMS envelope ciphertexts whose DEKs are
+	// encrypted by the fake server, under a key with the material
+	// fakeCompatKey, see testdata/envelope/README.md.
+	fakeEnvelopeFixtures = "testdata/envelope/fake/*.json"
+	fakeEnvelopeKEKURI   = "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/envelope"
+	// envelopeFixturesEnv optionally holds the directory that
+	// TestGenerateEnvelopeFixtures writes fixtures to.
+	envelopeFixturesEnv = "TINK_GCPKMS_ENVELOPE_FIXTURES_OUT"
+)
+
+// envelopeDEKTemplates are the DEK templates of KMS envelope AEADs, by the
+// names that Tink Java and Python give them.
+var envelopeDEKTemplates = map[string]func() *tinkpb.KeyTemplate{
+	"AES128_GCM":             aead.AES128GCMKeyTemplate,
+	"AES256_GCM":             aead.AES256GCMKeyTemplate,
+	"AES128_GCM_SIV":         aead.AES128GCMSIVKeyTemplate,
+	"AES256_GCM_SIV":         aead.AES256GCMSIVKeyTemplate,
+	"AES128_CTR_HMAC_SHA256": aead.AES128CTRHMACSHA256KeyTemplate,
+	"AES256_CTR_HMAC_SHA256": aead.AES256CTRHMACSHA256KeyTemplate,
+	"CHACHA20_POLY1305":      aead.ChaCha20Poly1305KeyTemplate,
+	"XCHACHA20_POLY1305":     aead.XChaCha20Poly1305KeyTemplate,
+}
+
+// envelopeFixture is a KMS envelope ciphertext, whose DEK is encrypted by a
+// Cloud KMS key, the KEK.
+type envelopeFixture struct {
+	Description    string `json:"description"`
+	Tool           string `json:"tool"`
+	KEKURI         string `json:"kek_uri"`
+	DEKTemplate    string `json:"dek_template"`
+	Plaintext      []byte `json:"plaintext"`
+	AssociatedData []byte `json:"associated_data,omitempty"`
+	Ciphertext     []byte `json:"ciphertext"`
+}
+
+// readEnvelopeFixtures reads the fixtures of the files matching pattern, by
+// file name.
+func readEnvelopeFixtures(t *testing.T, pattern string) map[string]envelopeFixture {
+	t.Helper()
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatalf("filepath.Glob(%q) err = %v, want nil", pattern, err)
+	}
+	fixtures := make(map[string]envelopeFixture, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("os.ReadFile() err = %v, want nil", err)
+		}
+		var f envelopeFixture
+		if err := json.Unmarshal(data, &f); err != nil {
+			t.Fatalf("json.Unmarshal() of %s err = %v, want nil", file, err)
+		}
+		fixtures[filepath.Base(file)] = f
+	}
+	return fixtures
+}
+
+// verifyEnvelopeFixture decrypts the ciphertext of f with a KMS envelope AEAD
+// whose DEKs are encrypted by kek.
+func verifyEnvelopeFixture(t *testing.T, kek tink.AEAD, f envelopeFixture) {
+	t.Helper()
+	template, ok := envelopeDEKTemplates[f.DEKTemplate]
+	if !ok {
+		t.Fatalf("fixture produced by %s has unknown DEK template %q", f.Tool, f.DEKTemplate)
+	}
+	a := aead.NewKMSEnvelopeAEAD2(template(), kek)
+	got, err := a.Decrypt(f.Ciphertext, f.AssociatedData)
+	if err != nil {
+		t.Fatalf("a.Decrypt() of ciphertext produced by %s (%s) err = %v, want nil", f.Tool, f.Description, err)
+	}
+	if !bytes.Equal(got, f.Plaintext) {
+		t.Errorf("a.Decrypt() of ciphertext produced by %s (%s) = %q, want %q", f.Tool, f.Description, got, f.Plaintext)
+	}
+	if _, err := a.Decrypt(f.Ciphertext, append(f.AssociatedData, 'x')); err == nil {
+		t.Error("a.Decrypt() with other associated data err = nil, want error")
+	}
+}
+
+// newFakeEnvelopeKEK returns the AEAD of the key of fakeEnvelopeKEKURI on a
+// new fake server, with the material fakeCompatKey.
+func newFakeEnvelopeKEK(t *testing.T) (*fakekms.Server, tink.AEAD) {
+	t.Helper()
+	key, err := hex.DecodeString(fakeCompatKey)
+	if err != nil {
+		t.Fatalf("hex.DecodeString() err = %v, want nil", err)
+	}
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateKeyWithMaterial(strings.TrimPrefix(fakeEnvelopeKEKURI, "gcp-kms://"), key); err != nil {
+		t.Fatalf("srv.CreateKeyWithMaterial() err = %v, want nil", err)
+	}
+	client, err := gcpkms.NewClient(context.Background(), fakeEnvelopeKEKURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	kek, err := client.GetAEAD(fakeEnvelopeKEKURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return srv, kek
+}
+
+func TestEnvelopeConformanceFixtures(t *testing.T) {
+	fixtures := readEnvelopeFixtures(t, fakeEnvelopeFixtures)
+	if len(fixtures) == 0 {
+		t.Fatalf("no fixtures match %s", fakeEnvelopeFixtures)
+	}
+	_, kek := newFakeEnvelopeKEK(t)
+	for file, f := range fixtures {
+		t.Run(file, func(t *testing.T) {
+			if f.KEKURI != fakeEnvelopeKEKURI {
+				t.Fatalf("fixture has KEK %s, want %s", f.KEKURI, fakeEnvelopeKEKURI)
+			}
+			verifyEnvelopeFixture(t, kek, f)
+		})
+	}
+}
+
+// TestEnvelopeConformanceWireFormat checks the ciphertexts of KMS envelope
+// AEADs with a KEK of this package against the wire format shared by the
+// Tink implementations, assembled with the standard library:
+//
+//	uint32(len(encryptedDEK)) || encryptedDEK || payload
+//
+// where the length is big-endian, encryptedDEK is the Cloud KMS ciphertext of
+// the serialized DEK key proto with empty associated data, and payload is the
+// ciphertext of the DEK without an output prefix, e.g. nonce || ciphertext ||
+// tag for AES-GCM.
+func TestEnvelopeConformanceWireFormat(t *testing.T) {
+	srv, kek := newFakeEnvelopeKEK(t)
+	kms := newKMSService(t, srv.ClientOptions()...)
+	keyName := strings.TrimPrefix(fakeEnvelopeKEKURI, "gcp-kms://")
+	a := aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), kek)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associated data")
+
+	t.Run("assembled ciphertext decrypts", func(t *testing.T) {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			t.Fatalf("rand.Read() err = %v, want nil", err)
+		}
+		// An AesGcmKey proto with version 0 and key_value, field 3.
+		dek := append([]byte{0x1a, byte(len(key))}, key...)
+		resp, err := kms.Projects.Locations.KeyRings.CryptoKeys.Encrypt(keyName, &cloudkms.EncryptRequest{
+			Plaintext: base64.StdEncoding.EncodeToString(dek),
+		}).Do()
+		if err != nil {
+			t.Fatalf("Encrypt() err = %v, want nil", err)
+		}
+		encryptedDEK, err := base64.StdEncoding.DecodeString(resp.Ciphertext)
+		if err != nil {
+			t.Fatalf("base64.StdEncoding.DecodeString() err = %v, want nil", err)
+		}
+		gcm := newStdlibGCM(t, key)
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			t.Fatalf("rand.Read() err = %v, want nil", err)
+		}
+		ciphertext := binary.BigEndian.AppendUint32(nil, uint32(len(encryptedDEK)))
+		ciphertext = append(ciphertext, encryptedDEK...)
+		ciphertext = append(ciphertext, nonce...)
+		ciphertext = gcm.Seal(ciphertext, nonce, plaintext, associatedData)
+
+		got, err := a.Decrypt(ciphertext, associatedData)
+		if err != nil {
+			t.Fatalf("a.Decrypt() err = %v, want nil", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("a.Decrypt() = %q, want %q", got, plaintext)
+		}
+	})
+
+	t.Run("ciphertext parses", func(t *testing.T) {
+		ciphertext, err := a.Encrypt(plaintext, associatedData)
+		if err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+		if len(ciphertext) < 4 {
+			t.Fatalf("a.Encrypt() returned %d bytes, want at least 4", len(ciphertext))
+		}
+		n := int(binary.BigEndian.Uint32(ciphertext))
+		if n == 0 || 4+n > len(ciphertext) {
+			t.Fatalf("encrypted DEK length = %d, want between 1 and %d", n, len(ciphertext)-4)
+		}
+		encryptedDEK, payload := ciphertext[4:4+n], ciphertext[4+n:]
+		resp, err := kms.Projects.Locations.KeyRings.CryptoKeys.Decrypt(keyName, &cloudkms.DecryptRequest{
+			Ciphertext: base64.StdEncoding.EncodeToString(encryptedDEK),
+		}).Do()
+		if err != nil {
+			t.Fatalf("Decrypt() of the encrypted DEK without associated data err = %v, want nil", err)
+		}
+		dek, err := base64.StdEncoding.DecodeString(resp.Plaintext)
+		if err != nil {
+			t.Fatalf("base64.StdEncoding.DecodeString() err = %v, want nil", err)
+		}
+		if len(dek) != 34 || dek[0] != 0x1a || dek[1] != 32 {
+			t.Fatalf("DEK = %x, want an AesGcmKey proto with a 32-byte key_value", dek)
+		}
+		gcm := newStdlibGCM(t, dek[2:])
+		if len(payload) < gcm.NonceSize() {
+			t.Fatalf("payload has %d bytes, want at least %d", len(payload), gcm.NonceSize())
+		}
+		got, err := gcm.Open(nil, payload[:gcm.NonceSize()], payload[gcm.NonceSize():], associatedData)
+		if err != nil {
+			t.Fatalf("gcm.Open() of the payload err = %v, want nil", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("gcm.Open() = %q, want %q", got, plaintext)
+		}
+	})
+}
+
+func newStdlibGCM(t *testing.T, key []byte) cipher.AEAD {
+	t.Helper()
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatalf("aes.NewCipher() err = %v, want nil", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatalf("cipher.NewGCM() err = %v, want nil", err)
+	}
+	return gcm
+}
+
+// TestGenerateEnvelopeFixtures writes a fixture for each DEK template to the
+// directory in envelopeFixturesEnv, for other Tink implementations to
+// verify. The DEKs are encrypted with the key of the integration tests if
+// they are enabled, and by the fake server otherwise.
+func TestGenerateEnvelopeFixtures(t *testing.T) {
+	dir := os.Getenv(envelopeFixturesEnv)
+	if dir == "" {
+		t.Skipf("%s not set; set it to a directory to write KMS envelope fixtures to", envelopeFixturesEnv)
+	}
+	kekURI := fakeEnvelopeKEKURI
+	var kek tink.AEAD
+	if os.Getenv(integrationEnv) == "1" {
+		cfg := newIntegrationConfig(t)
+		client, err := gcpkms.NewClient(context.Background(), cfg.keyURI, gcpkms.WithGoogleAPIClientOptions(cfg.apiOptions...))
+		if err != nil {
+			t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+		}
+		if kek, err = client.GetAEAD(cfg.keyURI); err != nil {
+			t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+		}
+		kekURI = cfg.keyURI
+	} else {
+		_, kek = newFakeEnvelopeKEK(t)
+	}
+
+	names := make([]string, 0, len(envelopeDEKTemplates))
+	for name := range envelopeDEKTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var fixtures []envelopeFixture
+	for _, name := range names {
+		fixtures = append(fixtures, envelopeFixture{
+			Description:    name + " DEK with associated data",
+			DEKTemplate:    name,
+			Plaintext:      []byte("plaintext"),
+			AssociatedData: []byte("associated data"),
+		})
+	}
+	fixtures = append(fixtures, envelopeFixture{
+		Description: "AES256_GCM DEK without associated data",
+		DEKTemplate: "AES256_GCM",
+		Plaintext:   []byte("plaintext"),
+	})
+	for _, f := range fixtures {
+		f.Tool = envelopeFixtureTool()
+		f.KEKURI = kekURI
+		ciphertext, err := aead.NewKMSEnvelopeAEAD2(envelopeDEKTemplates[f.DEKTemplate](), kek).Encrypt(f.Plaintext, f.AssociatedData)
+		if err != nil {
+			t.Fatalf("Encrypt() with DEK template %s err = %v, want nil", f.DEKTemplate, err)
+		}
+		f.Ciphertext = ciphertext
+		data, err := json.MarshalIndent(f, "", "  ")
+		if err != nil {
+			t.Fatalf("json.MarshalIndent() err = %v, want nil", err)
+		}
+		file := "go_" + strings.ToLower(f.DEKTemplate) + ".json"
+		if f.AssociatedData == nil {
+			file = "go_" + strings.ToLower(f.DEKTemplate) + "_without_associated_data.json"
+		}
+		if err := os.WriteFile(filepath.Join(dir, file), append(data, '\n'), 0o644); err != nil {
+			t.Fatalf("os.WriteFile() err = %v, want nil", err)
+		}
+	}
+}
+
+// envelopeFixtureTool returns the tool of the fixtures written by
+// TestGenerateEnvelopeFixtures, with the version of Tink Go.
+func envelopeFixtureTool() string {
+	tool := "tink-go aead.NewKMSEnvelopeAEAD2 with tink-go-gcpkms"
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range info.Deps {
+			if dep.Path == "github.com/tink-crypto/tink-go/v2" {
+				return strings.Replace(tool, "tink-go ", "tink-go "+dep.Version+" ", 1)
+			}
+		}
+	}
+	return tool
+}
@@ -0,0 +1,357 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/googleapi"
+)
+
+var (
+	// ErrKeyVersionDisabled is matched by errors returned when the key
+	// version needed by a request is disabled.
+	ErrKeyVersionDisabled = errors.New("gcpkms: key version is disabled")
+	// ErrKeyVersionDestroyed is matched by errors returned when the key
+	// version needed by a request has been destroyed.
+	ErrKeyVersionDestroyed = errors.New("gcpkms: key version is destroyed")
+	// ErrKeyVersionScheduledForDestruction is matched by errors returned when
+	// the key version needed by a request is scheduled for destruction. Such
+	// a version can still be restored until its destroy time.
+	ErrKeyVersionScheduledForDestruction = errors.New("gcpkms: key version is scheduled for destruction")
+	// ErrQuotaExceeded is matched by errors returned when a request is
+	// rejected because a Cloud KMS quota is exhausted.
+	ErrQuotaExceeded = errors.New("gcpkms: quota exceeded")
+	// ErrKeyNotFound is matched by errors returned when a key was still not
+	// found at the end of the grace period set with WithNewKeyGracePeriod,
+	// so that it is most likely missing.
+	ErrKeyNotFound = errors.New("gcpkms: key not found")
+	// ErrKeyPropagating is matched by errors returned when a key was not
+	// found, but the grace period set with WithNewKeyGracePeriod was cut
+	// short, e.g. by the deadline of the context, so that the key may still
+	// be propagating.
+	ErrKeyPropagating = errors.New("gcpkms: key not found, it may still be propagating")
+)
+
+const (
+	quotaFailureType = "type.googleapis.com/google.rpc.QuotaFailure"
+	retryInfoType    = "type.googleapis.com/google.rpc.RetryInfo"
+
+	// requestIDHeader is the response header in which Cloud KMS reports the
+	// ID of a request.
+	requestIDHeader = "X-Goog-Request-Id"
+)
+
+// versionNotEnabledRegex matches the message of the FAILED_PRECONDITION error
+// that Cloud KMS returns when a request needs a key version that is not
+// enabled.
+var versionNotEnabledRegex = regexp.MustCompile(`(projects/[^/\s]+/locations/[^/\s]+/keyRings/[^/\s]+/cryptoKeys/[^/\s]+/cryptoKeyVersions/[^/\s.]+) is not enabled, current state is: ([A-Z_]+)`)
+
+// KeyVersionStateError is returned when a request fails because the key
+// version it needs is not enabled. Use errors.Is with ErrKeyVersionDisabled,
+// ErrKeyVersionDestroyed or ErrKeyVersionScheduledForDestruction to check for
+// a particular state.
+type KeyVersionStateError struct {
+	// Version is the resource name of the key version.
+	Version string
+	// State is the state of the key version, e.g. "DISABLED".
+	State string
+	// DestroyTime is the time at which the key version was or will be
+	// destroyed. It is zero if unknown, e.g. because the caller is not
+	// permitted to get the key version.
+	DestroyTime time.Time
+	// Err is the error returned by Cloud KMS.
+	Err error
+}
+
+func (e *KeyVersionStateError) Error() string {
+	switch e.State {
+	case "DISABLED":
+		return fmt.Sprintf("gcpkms: key version %s is disabled; enable it to use it: %v", e.Version, e.Err)
+	case "DESTROYED":
+		if !e.DestroyTime.IsZero() {
+			return fmt.Sprintf("gcpkms: key version %s was destroyed at %s: %v", e.Version, e.DestroyTime.Format(time.RFC3339), e.Err)
+		}
+		return fmt.Sprintf("gcpkms: key version %s is destroyed: %v", e.Version, e.Err)
+	case "DESTROY_SCHEDULED":
+		if !e.DestroyTime.IsZero() {
+			return fmt.Sprintf("gcpkms: key version %s is scheduled for destruction at %s; restore it to use it: %v", e.Version, e.DestroyTime.Format(time.RFC3339), e.Err)
+		}
+		return fmt.Sprintf("gcpkms: key version %s is scheduled for destruction; restore it to use it: %v", e.Version, e.Err)
+	default:
+		return fmt.Sprintf("gcpkms: key version %s is not enabled, its state is %s: %v", e.Version, e.State, e.Err)
+	}
+}
+
+// Is reports whether target is the sentinel error for the state of the key
+// version.
+func (e *KeyVersionStateError) Is(target error) bool {
+	switch target {
+	case ErrKeyVersionDisabled:
+		return e.State == "DISABLED"
+	case ErrKeyVersionDestroyed:
+		return e.State == "DESTROYED"
+	case ErrKeyVersionScheduledForDestruction:
+		return e.State == "DESTROY_SCHEDULED"
+	}
+	return false
+}
+
+func (e *KeyVersionStateError) Unwrap() error {
+	return e.Err
+}
+
+// KeyVersionChangedError is returned by signers when Cloud KMS rejects a
+// request because the key version changed since its public key was fetched,
+// e.g. it was re-created with another algorithm. Signatures must be computed
+// again for the new algorithm.
+type KeyVersionChangedError struct {
+	// Version is the resource name of the key version.
+	Version string
+	// OldAlgorithm and NewAlgorithm are the algorithms of the key version
+	// before and after the change.
+	OldAlgorithm, NewAlgorithm string
+	// OldProtectionLevel and NewProtectionLevel are the protection levels of
+	// the key version before and after the change.
+	OldProtectionLevel, NewProtectionLevel string
+	// Err is the error returned by Cloud KMS.
+	Err error
+}
+
+func (e *KeyVersionChangedError) Error() string {
+	return fmt.Sprintf("gcpkms: key version %s changed from %s (%s) to %s (%s): %v",
+		e.Version, e.OldAlgorithm, e.OldProtectionLevel, e.NewAlgorithm, e.NewProtectionLevel, e.Err)
+}
+
+func (e *KeyVersionChangedError) Unwrap() error {
+	return e.Err
+}
+
+// isFailedPrecondition returns true if err is a FAILED_PRECONDITION error
+// returned by Cloud KMS.
+func isFailedPrecondition(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Body, `"FAILED_PRECONDITION"`)
+}
+
+// isNotFound returns true if err is a NOT_FOUND error returned by Cloud KMS.
+func isNotFound(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// isInvalidArgument returns true if err is an INVALID_ARGUMENT error returned
+// by Cloud KMS, e.g. because a ciphertext cannot be decrypted.
+func isInvalidArgument(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusBadRequest && strings.Contains(apiErr.Body, `"INVALID_ARGUMENT"`)
+}
+
+// keyVersionStateError returns a *KeyVersionStateError if err reports that a
+// key version is not enabled, and err otherwise. For destroyed versions, it
+// tries to look up the destroy time, ignoring any failure to do so.
+func keyVersionStateError(ctx context.Context, kms *cloudkms.Service, err error) error {
+	version, state, ok := versionNotEnabled(err)
+	if !ok {
+		return err
+	}
+	stateErr := &KeyVersionStateError{Version: version, State: state, Err: err}
+	if stateErr.State == "DESTROYED" || stateErr.State == "DESTROY_SCHEDULED" {
+		if v, err := kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.Get(stateErr.Version).Context(ctx).Do(); err == nil {
+			if t, err := time.Parse(time.RFC3339Nano, v.DestroyTime); err == nil {
+				stateErr.DestroyTime = t
+			}
+		}
+	}
+	return stateErr
+}
+
+// versionNotEnabled returns the name and state of the key version if err
+// reports that it is not enabled.
+func versionNotEnabled(err error) (version, state string, ok bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+		return "", "", false
+	}
+	m := versionNotEnabledRegex.FindStringSubmatch(apiErr.Message)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
+
+// KMSError is returned by the primitives of a Client when Cloud KMS rejects a
+// request. It holds the identifiers that Google Cloud support asks for when
+// investigating a failed request.
+type KMSError struct {
+	// RequestID is the ID of the failed request, or "" if Cloud KMS did not
+	// report one.
+	RequestID string
+	// Err is the error returned by Cloud KMS, possibly wrapped, e.g. in a
+	// *QuotaError.
+	Err error
+}
+
+func (e *KMSError) Error() string {
+	if e.RequestID == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v (request ID %s)", e.Err, e.RequestID)
+}
+
+func (e *KMSError) Unwrap() error {
+	return e.Err
+}
+
+// kmsError returns a *KMSError wrapping err if err was returned by Cloud KMS,
+// and err otherwise.
+func kmsError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	var kmsErr *KMSError
+	if errors.As(err, &kmsErr) {
+		return err
+	}
+	return &KMSError{RequestID: apiErr.Header.Get(requestIDHeader), Err: err}
+}
+
+// QuotaViolation describes a Cloud KMS quota that is exhausted.
+type QuotaViolation struct {
+	// Subject is the subject of the quota check, e.g.
+	// "project:my-project".
+	Subject string
+	// Description describes the quota and how it was exceeded.
+	Description string
+}
+
+// QuotaError is returned when a request is rejected because a Cloud KMS
+// quota is exhausted, i.e. with RESOURCE_EXHAUSTED. It matches
+// ErrQuotaExceeded with errors.Is.
+type QuotaError struct {
+	// QuotaViolations holds the exhausted quotas reported by Cloud KMS, if
+	// any.
+	QuotaViolations []QuotaViolation
+	// RetryDelay is the delay after which Cloud KMS asked the request to be
+	// retried, or 0 if it did not.
+	RetryDelay time.Duration
+	// Err is the error returned by Cloud KMS.
+	Err error
+}
+
+func (e *QuotaError) Error() string {
+	if e.RetryDelay > 0 {
+		return fmt.Sprintf("gcpkms: quota exceeded, retry after %v: %v", e.RetryDelay, e.Err)
+	}
+	return fmt.Sprintf("gcpkms: quota exceeded: %v", e.Err)
+}
+
+// Is reports whether target is ErrQuotaExceeded.
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+// quotaError returns a *QuotaError if err is a RESOURCE_EXHAUSTED error
+// returned by Cloud KMS, and err otherwise.
+func quotaError(err error) error {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusTooManyRequests {
+		return err
+	}
+	var quotaErr *QuotaError
+	if errors.As(err, &quotaErr) {
+		return err
+	}
+	quotaErr = &QuotaError{Err: err}
+	quotaErr.RetryDelay, _ = retryDelay(err)
+	for _, d := range apiErr.Details {
+		detail, ok := d.(map[string]interface{})
+		if !ok || detail["@type"] != quotaFailureType {
+			continue
+		}
+		violations, _ := detail["violations"].([]interface{})
+		for _, v := range violations {
+			violation, ok := v.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			subject, _ := violation["subject"].(string)
+			description, _ := violation["description"].(string)
+			quotaErr.QuotaViolations = append(quotaErr.QuotaViolations, QuotaViolation{Subject: subject, Description: description})
+		}
+	}
+	return quotaErr
+}
+
+// retryDelay returns the delay of the RetryInfo detail of err, or else of its
+// Retry-After header, if err is an error returned by Cloud KMS with either.
+func retryDelay(err error) (time.Duration, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return 0, false
+	}
+	for _, d := range apiErr.Details {
+		detail, ok := d.(map[string]interface{})
+		if !ok || detail["@type"] != retryInfoType {
+			continue
+		}
+		// Durations are encoded in JSON as decimal seconds with an "s"
+		// suffix, e.g. "1.5s", which time.ParseDuration accepts.
+		encoded, _ := detail["retryDelay"].(string)
+		delay, err := time.ParseDuration(encoded)
+		if err != nil || delay < 0 {
+			return 0, false
+		}
+		return delay, true
+	}
+	return retryAfter(apiErr.Header.Get("Retry-After"))
+}
+
+// retryAfter parses the value of a Retry-After header, which is either a
+// number of seconds or an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if d := time.Until(date); d > 0 {
+		return d, true
+	}
+	return 0, true
+}
@@ -0,0 +1,244 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+const fakeVersionName = fakeKeyName + "/cryptoKeyVersions/1"
+
+func TestDecryptWithKeyVersionNotEnabled(t *testing.T) {
+	destroyTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, tc := range []struct {
+		state           string
+		destroyTime     string
+		wantErr         error
+		wantDestroyTime time.Time
+	}{
+		{state: "DISABLED", wantErr: gcpkms.ErrKeyVersionDisabled},
+		{state: "DESTROYED", destroyTime: destroyTime.Format(time.RFC3339), wantErr: gcpkms.ErrKeyVersionDestroyed, wantDestroyTime: destroyTime},
+		{state: "DESTROY_SCHEDULED", destroyTime: destroyTime.Format(time.RFC3339), wantErr: gcpkms.ErrKeyVersionScheduledForDestruction, wantDestroyTime: destroyTime},
+	} {
+		t.Run(tc.state, func(t *testing.T) {
+			srv := newFakeServer(t)
+			a := newFakeAEAD(t, srv)
+			ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+			if err != nil {
+				t.Fatalf("a.Encrypt() err = %v, want nil", err)
+			}
+			if err := srv.SetVersionState(fakeKeyName, 1, tc.state, tc.destroyTime); err != nil {
+				t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+			}
+
+			_, err = a.Decrypt(ciphertext, nil)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("a.Decrypt() err = %v, want %v", err, tc.wantErr)
+			}
+			var stateErr *gcpkms.KeyVersionStateError
+			if !errors.As(err, &stateErr) {
+				t.Fatalf("a.Decrypt() err = %T, want *gcpkms.KeyVersionStateError", err)
+			}
+			if stateErr.Version != fakeVersionName || stateErr.State != tc.state || !stateErr.DestroyTime.Equal(tc.wantDestroyTime) {
+				t.Errorf("a.Decrypt() err = %+v, want version %q, state %q and destroy time %v", stateErr, fakeVersionName, tc.state, tc.wantDestroyTime)
+			}
+			for _, other := range []error{gcpkms.ErrKeyVersionDisabled, gcpkms.ErrKeyVersionDestroyed, gcpkms.ErrKeyVersionScheduledForDestruction} {
+				if other != tc.wantErr && errors.Is(err, other) {
+					t.Errorf("errors.Is(%v, %v) = true, want false", err, other)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptWithDisabledPrimary(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	if err := srv.SetVersionState(fakeKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); !errors.Is(err, gcpkms.ErrKeyVersionDisabled) {
+		t.Errorf("a.Encrypt() err = %v, want %v", err, gcpkms.ErrKeyVersionDisabled)
+	}
+	if got := srv.CallCount("GetCryptoKeyVersion"); got != 0 {
+		t.Errorf("GetCryptoKeyVersion called %d times, want 0", got)
+	}
+}
+
+func TestDecryptWithDestroyedVersionWithoutGetPermission(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		code, status, message := http.StatusBadRequest, "FAILED_PRECONDITION", fakeVersionName+" is not enabled, current state is: DESTROYED."
+		if r.Method == http.MethodGet {
+			code, status, message = http.StatusForbidden, "PERMISSION_DENIED", "Permission 'cloudkms.cryptoKeyVersions.get' denied."
+		}
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{"code": code, "status": status, "message": message},
+		})
+	}))
+	defer srv.Close()
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	_, err = a.Decrypt([]byte("ciphertext"), nil)
+	var stateErr *gcpkms.KeyVersionStateError
+	if !errors.As(err, &stateErr) || !errors.Is(err, gcpkms.ErrKeyVersionDestroyed) {
+		t.Fatalf("a.Decrypt() err = %v, want %v", err, gcpkms.ErrKeyVersionDestroyed)
+	}
+	if !stateErr.DestroyTime.IsZero() {
+		t.Errorf("stateErr.DestroyTime = %v, want zero", stateErr.DestroyTime)
+	}
+}
+
+func TestDecryptWithInvalidCiphertextIsNotKeyVersionStateError(t *testing.T) {
+	srv := newFakeServer(t)
+	a := newFakeAEAD(t, srv)
+	_, err := a.Decrypt([]byte("invalid ciphertext"), nil)
+	if err == nil {
+		t.Fatal("a.Decrypt() err = nil, want error")
+	}
+	var stateErr *gcpkms.KeyVersionStateError
+	if errors.As(err, &stateErr) {
+		t.Errorf("a.Decrypt() err = %v, want an error that is not a *gcpkms.KeyVersionStateError", err)
+	}
+}
+
+func TestEncryptWithExhaustedQuota(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		details := []any{map[string]any{
+			"@type": "type.googleapis.com/google.rpc.QuotaFailure",
+			"violations": []any{
+				map[string]any{"subject": "project:p", "description": "Cryptographic requests per minute exceeded."},
+			},
+		}}
+		if requests == 1 {
+			details = append(details, map[string]any{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "0.010s"})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{"code": http.StatusTooManyRequests, "status": "RESOURCE_EXHAUSTED", "message": "Quota exceeded.", "details": details},
+		})
+	}))
+	defer srv.Close()
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+
+	// The first response asks for a retry, the second does not.
+	_, err = a.Encrypt([]byte("plaintext"), nil)
+	var quotaErr *gcpkms.QuotaError
+	if !errors.As(err, &quotaErr) || !errors.Is(err, gcpkms.ErrQuotaExceeded) {
+		t.Fatalf("a.Encrypt() err = %v, want %v", err, gcpkms.ErrQuotaExceeded)
+	}
+	want := gcpkms.QuotaViolation{Subject: "project:p", Description: "Cryptographic requests per minute exceeded."}
+	if len(quotaErr.QuotaViolations) != 1 || quotaErr.QuotaViolations[0] != want {
+		t.Errorf("quotaErr.QuotaViolations = %v, want [%v]", quotaErr.QuotaViolations, want)
+	}
+	if quotaErr.RetryDelay != 0 {
+		t.Errorf("quotaErr.RetryDelay = %v, want 0", quotaErr.RetryDelay)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+}
+
+func TestErrorsCarryRequestID(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.SetResponseHeader("X-Goog-Request-Id", "req-123")
+	a := newFakeAEAD(t, srv)
+
+	_, err := a.Decrypt([]byte("invalid ciphertext"), nil)
+	var kmsErr *gcpkms.KMSError
+	if !errors.As(err, &kmsErr) {
+		t.Fatalf("a.Decrypt() err = %v, want a *gcpkms.KMSError", err)
+	}
+	if kmsErr.RequestID != "req-123" {
+		t.Errorf("kmsErr.RequestID = %q, want %q", kmsErr.RequestID, "req-123")
+	}
+	if !strings.Contains(err.Error(), "req-123") {
+		t.Errorf("a.Decrypt() err = %q, want it to contain the request ID", err)
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		t.Errorf("a.Decrypt() err = %T, want it to wrap a *googleapi.Error", err)
+	}
+
+	if err := srv.SetVersionState(fakeKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	_, err = a.Encrypt([]byte("plaintext"), nil)
+	if !errors.Is(err, gcpkms.ErrKeyVersionDisabled) {
+		t.Fatalf("a.Encrypt() err = %v, want %v", err, gcpkms.ErrKeyVersionDisabled)
+	}
+	if !errors.As(err, &kmsErr) || kmsErr.RequestID != "req-123" {
+		t.Errorf("a.Encrypt() err = %v, want it to wrap a *gcpkms.KMSError with request ID %q", err, "req-123")
+	}
+}
+
+func TestRequestIDHook(t *testing.T) {
+	srv := newFakeServer(t)
+	srv.SetResponseHeader("X-Goog-Request-Id", "req-123")
+	var got []gcpkms.RequestInfo
+	a := newFakeAEAD(t, srv, gcpkms.WithRequestIDHook(func(info gcpkms.RequestInfo) {
+		got = append(got, info)
+	}))
+
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt(ciphertext, nil); err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt([]byte("invalid ciphertext"), nil); err == nil {
+		t.Fatal("a.Decrypt() err = nil, want error")
+	}
+	want := []gcpkms.RequestInfo{
+		{Method: "Encrypt", KeyName: fakeKeyName, RequestID: "req-123"},
+		{Method: "Decrypt", KeyName: fakeKeyName, RequestID: "req-123"},
+	}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("hook got %v, want %v", got, want)
+	}
+}
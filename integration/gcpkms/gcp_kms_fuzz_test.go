@@ -0,0 +1,146 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+var fuzzKeyURIs = []string{
+	"gcp-kms://",
+	"gcp-kms://invalid",
+	"gcp-kms://projects/p/locations/global",
+	"gcp-kms://projects/p/locations/global/keyRings/r",
+	"gcp-kms://projects/p/locations/global/keyRings/r/",
+	"gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k",
+	"gcp-kms://projects/p/locations/europe-west3/keyRings/r/cryptoKeys/k",
+	"gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+	"gcp-kms://projects/p/locations/global/keyHandles/h",
+	"GCP-KMS://projects/p/locations/global/keyRings/r/cryptoKeys/k",
+	"aws-kms://arn:aws:kms:us-east-1:123456789012:key/k",
+}
+
+func FuzzParseKeyURI(f *testing.F) {
+	for _, uri := range fuzzKeyURIs {
+		f.Add(uri)
+	}
+	f.Fuzz(func(t *testing.T, uri string) {
+		name, err := keyNameFromURI(uri)
+		if err != nil {
+			return
+		}
+		if !cryptoKeyRegex.MatchString(name) && !isKeyHandle(name) {
+			t.Fatalf("keyNameFromURI(%q) = %q, which is neither a crypto key nor a key handle", uri, name)
+		}
+		if locationOf(name) == "" {
+			t.Errorf("locationOf(%q) = \"\", want a location", name)
+		}
+		// Formatting the name as a URI and parsing it again is idempotent.
+		again, err := keyNameFromURI(gcpPrefix + name)
+		if err != nil || again != name {
+			t.Errorf("keyNameFromURI(%q) = %q, %v, want %q, nil", gcpPrefix+name, again, err, name)
+		}
+		canonical, err := canonicalKeyURI(uri)
+		if err != nil || gcpPrefix+name != canonical {
+			t.Errorf("keyNameFromURI(%q) = %q, which does not format back to the canonical URI %q (err = %v)", uri, name, canonical, err)
+		}
+		if !strings.EqualFold(canonical, strings.TrimRight(uri, "/")) {
+			t.Errorf("canonicalKeyURI(%q) = %q, which differs by more than case and trailing slashes", uri, canonical)
+		}
+	})
+}
+
+func FuzzSupported(f *testing.F) {
+	for _, uri := range fuzzKeyURIs {
+		f.Add("gcp-kms://", uri)
+		f.Add("gcp-kms://projects/p/locations/global/keyRings/r/", uri)
+	}
+	f.Fuzz(func(t *testing.T, uriPrefix, keyURI string) {
+		c, err := NewClient(context.Background(), uriPrefix, WithInsecureTransport())
+		if err != nil {
+			return
+		}
+		name, nameErr := keyNameFromURI(keyURI)
+		if nameErr != nil || isKeyHandle(name) {
+			// Key handles are resolved with a request to Cloud KMS.
+			return
+		}
+		a, err := c.GetAEAD(keyURI)
+		if !c.Supported(keyURI) {
+			if err == nil {
+				t.Errorf("c.GetAEAD(%q) err = nil for a keyURI not supported with prefix %q, want error", keyURI, uriPrefix)
+			}
+			return
+		}
+		if err != nil {
+			t.Fatalf("c.GetAEAD(%q) err = %v for a keyURI supported with prefix %q, want nil", keyURI, err, uriPrefix)
+		}
+		if got := a.(*AEAD).keyURI; got != name {
+			t.Errorf("c.GetAEAD(%q) uses key %q, want %q", keyURI, got, name)
+		}
+	})
+}
+
+func FuzzResponseNameMatch(f *testing.F) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		f.Fatalf("ecdsa.GenerateKey() err = %v, want nil", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		f.Fatalf("x509.MarshalPKIXPublicKey() err = %v, want nil", err)
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	const version = "projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1"
+	for _, name := range []string{
+		"",
+		version,
+		version + "0",
+		version + "/",
+		strings.ToUpper(version),
+		"projects/p/locations/global/keyRings/r/cryptoKeys/k/cryptoKeyVersions/2",
+		"projects/p/locations/global/keyRings/r/cryptoKeys/k",
+	} {
+		f.Add(name, version)
+	}
+	f.Fuzz(func(t *testing.T, name, version string) {
+		pub, err := parsePublicKey(version, &cloudkms.PublicKey{
+			Name:      name,
+			Algorithm: "EC_SIGN_P256_SHA256",
+			Pem:       pemKey,
+			PemCrc32c: ComputeCRC32C([]byte(pemKey)),
+		})
+		// The name may be omitted, but must otherwise match exactly.
+		wantMatch := name == "" || name == version
+		if wantMatch != (err == nil) {
+			t.Fatalf("parsePublicKey(%q) with response name %q err = %v, want match = %v", version, name, err, wantMatch)
+		}
+		if err == nil && pub.version != version {
+			t.Errorf("pub.version = %q, want %q", pub.version, version)
+		}
+	})
+}
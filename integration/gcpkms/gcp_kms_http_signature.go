@@ -0,0 +1,822 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTP message signature algorithms of RFC 9421.
+const (
+	HTTPSignatureRSAPSSSHA512    = "rsa-pss-sha512"
+	HTTPSignatureRSAv15SHA256    = "rsa-v1_5-sha256"
+	HTTPSignatureECDSAP256SHA256 = "ecdsa-p256-sha256"
+	HTTPSignatureECDSAP384SHA384 = "ecdsa-p384-sha384"
+	HTTPSignatureEd25519         = "ed25519"
+)
+
+// httpSignatureAlgorithms holds the HTTP message signature algorithm of the
+// Cloud KMS signing algorithms that have one, by name.
+var httpSignatureAlgorithms = map[string]string{
+	"EC_SIGN_ED25519":            HTTPSignatureEd25519,
+	"EC_SIGN_P256_SHA256":        HTTPSignatureECDSAP256SHA256,
+	"EC_SIGN_P384_SHA384":        HTTPSignatureECDSAP384SHA384,
+	"RSA_SIGN_PKCS1_2048_SHA256": HTTPSignatureRSAv15SHA256,
+	"RSA_SIGN_PKCS1_3072_SHA256": HTTPSignatureRSAv15SHA256,
+	"RSA_SIGN_PKCS1_4096_SHA256": HTTPSignatureRSAv15SHA256,
+	"RSA_SIGN_PSS_4096_SHA512":   HTTPSignatureRSAPSSSHA512,
+}
+
+// httpSignatureAlgorithm returns the HTTP message signature algorithm of the
+// Cloud KMS signing algorithm with the given name.
+func httpSignatureAlgorithm(algorithm string) (string, error) {
+	alg, ok := httpSignatureAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("signing algorithm %q has no HTTP message signature algorithm", algorithm)
+	}
+	return alg, nil
+}
+
+const (
+	// defaultHTTPSignatureLabel is the label of signatures if none is set.
+	defaultHTTPSignatureLabel = "sig1"
+	// contentDigestComponent is the component that covers the body.
+	contentDigestComponent = "content-digest"
+)
+
+// defaultHTTPSignatureComponents are the components covered by signatures
+// if none are set.
+var defaultHTTPSignatureComponents = []string{"@method", "@target-uri", contentDigestComponent}
+
+// HTTPSignatureOptions configures SignHTTPRequest.
+type HTTPSignatureOptions struct {
+	// Label is the label of the signature in the Signature and
+	// Signature-Input fields. If empty, "sig1" is used.
+	Label string
+	// Components are the names of the covered components, in order: the
+	// derived components "@method", "@target-uri", "@authority", "@scheme",
+	// "@request-target", "@path" and "@query", and lowercase header field
+	// names, e.g. "content-digest" or "date". If nil, "@method",
+	// "@target-uri" and "content-digest" are covered.
+	Components []string
+	// KeyID is the keyid parameter of the signature. If empty, the parameter
+	// is omitted.
+	KeyID string
+	// Created is the created parameter of the signature. If zero, the
+	// current time is used.
+	Created time.Time
+}
+
+// SignHTTPRequest signs req with signer as an HTTP message signature (RFC
+// 9421) and adds the signature to its Signature and Signature-Input header
+// fields. The signature has the created and alg parameters, and the keyid
+// parameter if opts sets it. The AsymmetricSign request is bound to the
+// context of req.
+//
+// If content-digest is covered and req has no Content-Digest field, the
+// SHA-256 digest of the body is added as set by RFC 9530. The body is read
+// through req.GetBody if set, and replaced by an equivalent reader otherwise.
+//
+// The algorithm is rsa-pss-sha512 for RSA_SIGN_PSS_4096_SHA512 keys,
+// rsa-v1_5-sha256 for RSA_SIGN_PKCS1_*_SHA256 keys, ecdsa-p256-sha256 or
+// ecdsa-p384-sha384 for EC_SIGN_P256_SHA256 or EC_SIGN_P384_SHA384 keys, and
+// ed25519 for EC_SIGN_ED25519 keys, which sign the signature base itself
+// rather than a digest of it. Other keys are rejected.
+func SignHTTPRequest(req *http.Request, signer *Signer, opts HTTPSignatureOptions) error {
+	if req == nil || signer == nil {
+		return errors.New("req and signer must not be nil")
+	}
+	pub := signer.s.publicKey()
+	alg, err := httpSignatureAlgorithm(pub.algorithm)
+	if err != nil {
+		return err
+	}
+	label := opts.Label
+	if label == "" {
+		label = defaultHTTPSignatureLabel
+	}
+	if !isSFKey(label) {
+		return fmt.Errorf("invalid label %q", label)
+	}
+	components := opts.Components
+	if components == nil {
+		components = defaultHTTPSignatureComponents
+	}
+	if err := checkHTTPSignatureComponents(components); err != nil {
+		return err
+	}
+	for _, name := range []string{"Signature", "Signature-Input"} {
+		if values := req.Header.Values(name); len(values) > 0 {
+			d, err := parseSFDictionary(strings.Join(values, ", "))
+			if err != nil {
+				return fmt.Errorf("malformed %s field: %v", name, err)
+			}
+			if _, ok := d[label]; ok {
+				return fmt.Errorf("%s field already has a signature labeled %q", name, label)
+			}
+		}
+	}
+	if containsString(components, contentDigestComponent) && len(req.Header.Values("Content-Digest")) == 0 {
+		body, err := readRequestBody(req)
+		if err != nil {
+			return fmt.Errorf("reading body failed: %v", err)
+		}
+		digest := sha256.Sum256(body)
+		req.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(digest[:])+":")
+	}
+
+	created := opts.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+	var params strings.Builder
+	params.WriteByte('(')
+	for i, name := range components {
+		if i > 0 {
+			params.WriteByte(' ')
+		}
+		params.WriteString(strconv.Quote(name))
+	}
+	params.WriteString(");created=")
+	params.WriteString(strconv.FormatInt(created.Unix(), 10))
+	if opts.KeyID != "" {
+		keyID, err := sfString(opts.KeyID)
+		if err != nil {
+			return fmt.Errorf("invalid key ID: %v", err)
+		}
+		params.WriteString(";keyid=")
+		params.WriteString(keyID)
+	}
+	params.WriteString(`;alg="` + alg + `"`)
+	base, err := httpSignatureBase(req, components, params.String())
+	if err != nil {
+		return err
+	}
+
+	signature, err := signData(req.Context(), signer.s, base)
+	if err != nil {
+		return err
+	}
+	if pub.alg.curve != nil {
+		if signature, err = rawECDSASignature(signature, (pub.alg.curve.Params().BitSize+7)/8); err != nil {
+			return err
+		}
+	}
+	req.Header.Add("Signature-Input", label+"="+params.String())
+	req.Header.Add("Signature", label+"=:"+base64.StdEncoding.EncodeToString(signature)+":")
+	return nil
+}
+
+// HTTPVerificationOptions configures VerifyHTTPRequest.
+type HTTPVerificationOptions struct {
+	// Label is the label of the signature to verify. If empty, "sig1" is
+	// used.
+	Label string
+	// RequiredComponents are the components that the signature must cover.
+	// If nil, "@method", "@target-uri" and "content-digest" are required; an
+	// empty, non-nil slice requires none.
+	RequiredComponents []string
+	// Algorithm is the algorithm that the signature must use, e.g.
+	// HTTPSignatureRSAPSSSHA512. If empty, it is taken from the alg
+	// parameter of the signature or, for keys other than RSA keys, from the
+	// key.
+	Algorithm string
+	// MaxAge is the maximum age of the signature according to its created
+	// parameter, which is required if MaxAge is positive.
+	MaxAge time.Duration
+}
+
+// VerifyHTTPRequest returns nil if req has a valid HTTP message signature
+// (RFC 9421) by the key pub, e.g. the public key returned by Signer.Public or
+// the PublicKeyDER of a VerificationBundle parsed with
+// x509.ParsePKIXPublicKey. ECDSA keys on P-256 and P-384, RSA keys and
+// Ed25519 keys are supported.
+//
+// If the signature covers content-digest, the body of req is read, and
+// replaced by an equivalent reader, to check that it matches the SHA-256 and
+// SHA-512 digests of the Content-Digest field, which must have at least one
+// of them. Signatures whose expires parameter has passed are rejected.
+//
+// Requests received by a server are supported: if the URL of req is not
+// absolute, the target URI is made of the scheme of the connection, req.Host
+// and the request URI, which proxies in front of the server must preserve.
+func VerifyHTTPRequest(req *http.Request, pub crypto.PublicKey, opts HTTPVerificationOptions) error {
+	if req == nil || pub == nil {
+		return errors.New("req and pub must not be nil")
+	}
+	label := opts.Label
+	if label == "" {
+		label = defaultHTTPSignatureLabel
+	}
+	inputs, err := parseSFDictionary(strings.Join(req.Header.Values("Signature-Input"), ", "))
+	if err != nil {
+		return fmt.Errorf("malformed Signature-Input field: %v", err)
+	}
+	input, ok := inputs[label]
+	if !ok {
+		return fmt.Errorf("no signature labeled %q", label)
+	}
+	signatures, err := parseSFDictionary(strings.Join(req.Header.Values("Signature"), ", "))
+	if err != nil {
+		return fmt.Errorf("malformed Signature field: %v", err)
+	}
+	signature, ok := signatures[label].item.value.([]byte)
+	if !ok {
+		return fmt.Errorf("no signature labeled %q in Signature field", label)
+	}
+	items, ok := input.item.value.([]sfItem)
+	if !ok {
+		return fmt.Errorf("signature input %q is not an inner list", label)
+	}
+	components := make([]string, 0, len(items))
+	for _, item := range items {
+		name, ok := item.value.(string)
+		if !ok || len(item.params) > 0 {
+			return fmt.Errorf("unsupported component %v in signature input %q", item.value, label)
+		}
+		components = append(components, name)
+	}
+	if err := checkHTTPSignatureComponents(components); err != nil {
+		return err
+	}
+	required := opts.RequiredComponents
+	if required == nil {
+		required = defaultHTTPSignatureComponents
+	}
+	for _, name := range required {
+		if !containsString(components, name) {
+			return fmt.Errorf("signature does not cover %q", name)
+		}
+	}
+
+	now := time.Now()
+	params := input.item.params
+	var created, expires int64
+	for name, dst := range map[string]*int64{"created": &created, "expires": &expires} {
+		if v, ok := params[name]; ok {
+			n, ok := v.(int64)
+			if !ok {
+				return fmt.Errorf("%s parameter is not an integer", name)
+			}
+			*dst = n
+		}
+	}
+	if _, ok := params["expires"]; ok && !now.Before(time.Unix(expires, 0)) {
+		return errors.New("signature expired")
+	}
+	if opts.MaxAge > 0 {
+		if _, ok := params["created"]; !ok {
+			return errors.New("signature has no created parameter")
+		}
+		if now.Sub(time.Unix(created, 0)) > opts.MaxAge {
+			return fmt.Errorf("signature is older than %v", opts.MaxAge)
+		}
+	}
+	alg, err := resolveHTTPSignatureAlgorithm(pub, params["alg"], opts.Algorithm)
+	if err != nil {
+		return err
+	}
+
+	if containsString(components, contentDigestComponent) {
+		if err := checkContentDigest(req); err != nil {
+			return err
+		}
+	}
+	base, err := httpSignatureBase(req, components, input.raw)
+	if err != nil {
+		return err
+	}
+	return verifyHTTPSignature(pub, alg, signature, base)
+}
+
+// resolveHTTPSignatureAlgorithm returns the algorithm of a signature by pub
+// whose alg parameter is param, or nil if it has none, and that must use
+// want, unless it is empty.
+func resolveHTTPSignatureAlgorithm(pub crypto.PublicKey, param any, want string) (string, error) {
+	var keyAlgs []string
+	switch k := pub.(type) {
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			keyAlgs = []string{HTTPSignatureECDSAP256SHA256}
+		case elliptic.P384():
+			keyAlgs = []string{HTTPSignatureECDSAP384SHA384}
+		}
+	case *rsa.PublicKey:
+		keyAlgs = []string{HTTPSignatureRSAPSSSHA512, HTTPSignatureRSAv15SHA256}
+	case ed25519.PublicKey:
+		keyAlgs = []string{HTTPSignatureEd25519}
+	}
+	if len(keyAlgs) == 0 {
+		return "", fmt.Errorf("unsupported public key type %T", pub)
+	}
+	alg := want
+	if param != nil {
+		s, ok := param.(string)
+		if !ok {
+			return "", errors.New("alg parameter is not a string")
+		}
+		if alg != "" && s != alg {
+			return "", fmt.Errorf("signature uses algorithm %q, want %q", s, alg)
+		}
+		alg = s
+	}
+	if alg == "" {
+		if len(keyAlgs) > 1 {
+			return "", fmt.Errorf("signature has no alg parameter, which is required for keys of type %T", pub)
+		}
+		alg = keyAlgs[0]
+	}
+	if !containsString(keyAlgs, alg) {
+		return "", fmt.Errorf("algorithm %q does not match keys of type %T", alg, pub)
+	}
+	return alg, nil
+}
+
+// verifyHTTPSignature returns nil if signature is a valid signature of base by
+// pub with the given algorithm, which must match the type of pub.
+func verifyHTTPSignature(pub crypto.PublicKey, alg string, signature, base []byte) error {
+	switch alg {
+	case HTTPSignatureRSAPSSSHA512:
+		digest := sha512.Sum512(base)
+		return rsa.VerifyPSS(pub.(*rsa.PublicKey), crypto.SHA512, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case HTTPSignatureRSAv15SHA256:
+		digest := sha256.Sum256(base)
+		return rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, digest[:], signature)
+	case HTTPSignatureECDSAP256SHA256, HTTPSignatureECDSAP384SHA384:
+		k := pub.(*ecdsa.PublicKey)
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		var digest []byte
+		if alg == HTTPSignatureECDSAP256SHA256 {
+			d := sha256.Sum256(base)
+			digest = d[:]
+		} else {
+			d := sha512.Sum384(base)
+			digest = d[:]
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case HTTPSignatureEd25519:
+		if !ed25519.Verify(pub.(ed25519.PublicKey), base, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+// derivedComponents holds the supported derived components.
+var derivedComponents = map[string]bool{
+	"@method":         true,
+	"@target-uri":     true,
+	"@authority":      true,
+	"@scheme":         true,
+	"@request-target": true,
+	"@path":           true,
+	"@query":          true,
+}
+
+// checkHTTPSignatureComponents returns an error if components has unsupported
+// or duplicate names.
+func checkHTTPSignatureComponents(components []string) error {
+	seen := make(map[string]bool, len(components))
+	for _, name := range components {
+		if seen[name] {
+			return fmt.Errorf("duplicate component %q", name)
+		}
+		seen[name] = true
+		if strings.HasPrefix(name, "@") {
+			if !derivedComponents[name] {
+				return fmt.Errorf("unsupported derived component %q", name)
+			}
+			continue
+		}
+		if name == "" || strings.ToLower(name) != name || strings.IndexFunc(name, func(r rune) bool { return !isTChar(r) }) >= 0 {
+			return fmt.Errorf("invalid component %q, want a derived component or a lowercase field name", name)
+		}
+	}
+	return nil
+}
+
+// httpSignatureBase returns the signature base (RFC 9421, section 2.5) of req
+// for the given components and serialized signature parameters.
+func httpSignatureBase(req *http.Request, components []string, params string) ([]byte, error) {
+	var b bytes.Buffer
+	for _, name := range components {
+		value, err := httpComponentValue(req, name)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(strconv.Quote(name))
+		b.WriteString(": ")
+		b.WriteString(value)
+		b.WriteByte('\n')
+	}
+	b.WriteString(`"@signature-params": `)
+	b.WriteString(params)
+	return b.Bytes(), nil
+}
+
+// httpComponentValue returns the value of the component of req with the given
+// name.
+func httpComponentValue(req *http.Request, name string) (string, error) {
+	switch name {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		return requestScheme(req) + "://" + requestAuthority(req) + req.URL.RequestURI(), nil
+	case "@authority":
+		return requestAuthority(req), nil
+	case "@scheme":
+		return requestScheme(req), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if path := req.URL.EscapedPath(); path != "" {
+			return path, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+	values := req.Header.Values(name)
+	if len(values) == 0 && name == "content-length" && req.ContentLength > 0 {
+		// The HTTP client and server keep the length out of the header.
+		return strconv.FormatInt(req.ContentLength, 10), nil
+	}
+	if len(values) == 0 {
+		return "", fmt.Errorf("request has no %q field", name)
+	}
+	trimmed := make([]string, len(values))
+	for i, v := range values {
+		trimmed[i] = strings.Trim(v, " \t")
+	}
+	return strings.Join(trimmed, ", "), nil
+}
+
+// requestScheme returns the lowercase scheme of req, taken from the
+// connection if its URL has none.
+func requestScheme(req *http.Request) string {
+	if req.URL.Scheme != "" {
+		return strings.ToLower(req.URL.Scheme)
+	}
+	if req.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// requestAuthority returns the lowercase authority of req.
+func requestAuthority(req *http.Request) string {
+	if req.Host != "" {
+		return strings.ToLower(req.Host)
+	}
+	return strings.ToLower(req.URL.Host)
+}
+
+// readRequestBody returns the body of req, through req.GetBody if set, and
+// replaces the body by an equivalent reader otherwise.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		defer body.Close()
+		return io.ReadAll(body)
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	return body, nil
+}
+
+// checkContentDigest returns nil if the body of req matches the SHA-256 and
+// SHA-512 digests of its Content-Digest field, which must have at least one
+// of them.
+func checkContentDigest(req *http.Request) error {
+	digests, err := parseSFDictionary(strings.Join(req.Header.Values("Content-Digest"), ", "))
+	if err != nil {
+		return fmt.Errorf("malformed Content-Digest field: %v", err)
+	}
+	body, err := readRequestBody(req)
+	if err != nil {
+		return fmt.Errorf("reading body failed: %v", err)
+	}
+	checked := 0
+	for name, sum := range map[string]func([]byte) []byte{
+		"sha-256": func(b []byte) []byte { d := sha256.Sum256(b); return d[:] },
+		"sha-512": func(b []byte) []byte { d := sha512.Sum512(b); return d[:] },
+	} {
+		m, ok := digests[name]
+		if !ok {
+			continue
+		}
+		want, ok := m.item.value.([]byte)
+		if !ok || subtle.ConstantTimeCompare(sum(body), want) != 1 {
+			return fmt.Errorf("body does not match %s digest of Content-Digest field", name)
+		}
+		checked++
+	}
+	if checked == 0 {
+		return errors.New("Content-Digest field has no sha-256 or sha-512 digest")
+	}
+	return nil
+}
+
+func containsString(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// sfItem is an item or inner list of a structured field value (RFC 8941).
+// Its value is an int64, a string, an sfToken, a []byte, a bool, or an
+// []sfItem for inner lists.
+type sfItem struct {
+	value  any
+	params map[string]any
+}
+
+// sfToken is a token of a structured field value.
+type sfToken string
+
+// sfMember is a member of a structured field dictionary.
+type sfMember struct {
+	item sfItem
+	// raw is the serialized value of the member as received, which is the
+	// signature parameters component value of Signature-Input members.
+	raw string
+}
+
+// parseSFDictionary parses s as a structured field dictionary. Decimals are
+// not supported.
+func parseSFDictionary(s string) (map[string]sfMember, error) {
+	p := &sfParser{s: strings.Trim(s, " ")}
+	d := make(map[string]sfMember)
+	for p.i < len(p.s) {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var m sfMember
+		start := p.i
+		if p.consume('=') {
+			start = p.i
+			m.item, err = p.itemOrInnerList()
+		} else {
+			m.item.value = true
+			m.item.params, err = p.params()
+		}
+		if err != nil {
+			return nil, err
+		}
+		m.raw = p.s[start:p.i]
+		d[key] = m
+		p.skipOWS()
+		if p.i == len(p.s) {
+			break
+		}
+		if !p.consume(',') {
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+		}
+		p.skipOWS()
+		if p.i == len(p.s) {
+			return nil, errors.New("trailing comma")
+		}
+	}
+	return d, nil
+}
+
+// sfParser parses structured field values.
+type sfParser struct {
+	s string
+	i int
+}
+
+func (p *sfParser) consume(c byte) bool {
+	if p.i < len(p.s) && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *sfParser) skipOWS() {
+	for p.i < len(p.s) && (p.s[p.i] == ' ' || p.s[p.i] == '\t') {
+		p.i++
+	}
+}
+
+func (p *sfParser) key() (string, error) {
+	start := p.i
+	for p.i < len(p.s) {
+		c := p.s[p.i]
+		if !(c >= 'a' && c <= 'z' || c == '*' || p.i > start && (c >= '0' && c <= '9' || c == '_' || c == '-' || c == '.')) {
+			break
+		}
+		p.i++
+	}
+	if p.i == start {
+		return "", fmt.Errorf("expected key at offset %d", start)
+	}
+	return p.s[start:p.i], nil
+}
+
+func (p *sfParser) itemOrInnerList() (sfItem, error) {
+	if !p.consume('(') {
+		return p.item()
+	}
+	var items []sfItem
+	for {
+		for p.consume(' ') {
+		}
+		if p.consume(')') {
+			params, err := p.params()
+			return sfItem{value: items, params: params}, err
+		}
+		item, err := p.item()
+		if err != nil {
+			return sfItem{}, err
+		}
+		items = append(items, item)
+		if p.i < len(p.s) && p.s[p.i] != ' ' && p.s[p.i] != ')' {
+			return sfItem{}, fmt.Errorf("unexpected %q at offset %d", p.s[p.i], p.i)
+		}
+	}
+}
+
+func (p *sfParser) item() (sfItem, error) {
+	value, err := p.bareItem()
+	if err != nil {
+		return sfItem{}, err
+	}
+	params, err := p.params()
+	return sfItem{value: value, params: params}, err
+}
+
+func (p *sfParser) params() (map[string]any, error) {
+	var params map[string]any
+	for p.consume(';') {
+		for p.consume(' ') {
+		}
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		var value any = true
+		if p.consume('=') {
+			if value, err = p.bareItem(); err != nil {
+				return nil, err
+			}
+		}
+		if params == nil {
+			params = make(map[string]any)
+		}
+		params[key] = value
+	}
+	return params, nil
+}
+
+func (p *sfParser) bareItem() (any, error) {
+	if p.i == len(p.s) {
+		return nil, errors.New("unexpected end of field")
+	}
+	start := p.i
+	switch c := p.s[p.i]; {
+	case c == '-' || c >= '0' && c <= '9':
+		p.consume('-')
+		digits := p.i
+		for p.i < len(p.s) && p.s[p.i] >= '0' && p.s[p.i] <= '9' {
+			p.i++
+		}
+		if p.i == digits || p.i-digits > 15 || p.i < len(p.s) && p.s[p.i] == '.' {
+			return nil, fmt.Errorf("unsupported number at offset %d", start)
+		}
+		return strconv.ParseInt(p.s[start:p.i], 10, 64)
+	case c == '"':
+		p.i++
+		var b strings.Builder
+		for p.i < len(p.s) {
+			c := p.s[p.i]
+			p.i++
+			switch {
+			case c == '"':
+				return b.String(), nil
+			case c == '\\' && p.i < len(p.s) && (p.s[p.i] == '"' || p.s[p.i] == '\\'):
+				b.WriteByte(p.s[p.i])
+				p.i++
+			case c < 0x20 || c > 0x7e || c == '\\':
+				return nil, fmt.Errorf("invalid string at offset %d", start)
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, fmt.Errorf("unterminated string at offset %d", start)
+	case c == ':':
+		end := strings.IndexByte(p.s[p.i+1:], ':')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated byte sequence at offset %d", start)
+		}
+		p.i += end + 2
+		b, err := base64.StdEncoding.DecodeString(p.s[start+1 : p.i-1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid byte sequence at offset %d: %v", start, err)
+		}
+		return b, nil
+	case c == '?':
+		if p.i+1 < len(p.s) && (p.s[p.i+1] == '0' || p.s[p.i+1] == '1') {
+			p.i += 2
+			return p.s[p.i-1] == '1', nil
+		}
+		return nil, fmt.Errorf("invalid boolean at offset %d", start)
+	case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '*':
+		for p.i < len(p.s) && (isTChar(rune(p.s[p.i])) || p.s[p.i] == ':' || p.s[p.i] == '/') {
+			p.i++
+		}
+		return sfToken(p.s[start:p.i]), nil
+	default:
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, start)
+	}
+}
+
+// isSFKey returns true if s is a valid structured field key.
+func isSFKey(s string) bool {
+	p := &sfParser{s: s}
+	_, err := p.key()
+	return err == nil && p.i == len(s)
+}
+
+// isTChar returns true if r may be part of an HTTP token (RFC 9110).
+func isTChar(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", r)
+}
+
+// sfString returns s serialized as a structured field string.
+func sfString(s string) (string, error) {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c > 0x7e {
+			return "", fmt.Errorf("%q has characters other than printable ASCII", s)
+		}
+		if c == '"' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte('"')
+	return b.String(), nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+)
+
+// mutatingTransport overwrites buf with 'x' bytes during the first request
+// whose path ends with suffix, like a caller that reuses its buffer as soon
+// as a call has started. If status is not 0, that request is answered with
+// status and body instead of being sent.
+type mutatingTransport struct {
+	suffix string
+	buf    []byte
+	status int
+	body   string
+	once   sync.Once
+}
+
+func (t *mutatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, t.suffix) {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	first := false
+	t.once.Do(func() {
+		first = true
+		for i := range t.buf {
+			t.buf[i] = 'x'
+		}
+	})
+	if !first || t.status == 0 {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	return &http.Response{
+		StatusCode: t.status,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(t.body)),
+		Request:    req,
+	}, nil
+}
+
+const unavailableBody = `{"error": {"code": 503, "status": "UNAVAILABLE"}}`
+
+// TestEncryptCopiesInputsMutatedDuringCall checks that the payload of a large
+// plaintext, which is encrypted with the DEK after Cloud KMS has encrypted
+// the DEK, is computed from a copy of the plaintext taken before the call.
+func TestEncryptCopiesInputsMutatedDuringCall(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		opts   []gcpkms.Option
+		status int
+	}{
+		{
+			name:   "retried",
+			opts:   []gcpkms.Option{gcpkms.WithRetrySettings(gcpkms.RetrySettings{InitialBackoff: time.Millisecond})},
+			status: http.StatusServiceUnavailable,
+		},
+		{
+			name: "without retries",
+			opts: []gcpkms.Option{gcpkms.WithRetrySettings(gcpkms.RetrySettings{MaxAttempts: 1})},
+		},
+		{
+			name: "WithInputCopying without retries",
+			opts: []gcpkms.Option{gcpkms.WithRetrySettings(gcpkms.RetrySettings{MaxAttempts: 1}), gcpkms.WithInputCopying()},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			want := bytes.Repeat([]byte{'p'}, 1<<20)
+			plaintext := append([]byte{}, want...)
+			associatedData := []byte("associatedData")
+			trans := &mutatingTransport{suffix: ":encrypt", buf: plaintext, status: tc.status, body: unavailableBody}
+			opts := append([]gcpkms.Option{gcpkms.WithBaseTransport(trans), gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate())}, tc.opts...)
+			a := newFakeAEAD(t, srv, opts...)
+
+			ciphertext, crc32c, err := a.EncryptWithChecksum(context.Background(), plaintext, associatedData)
+			if err != nil {
+				t.Fatalf("a.EncryptWithChecksum() err = %v, want nil", err)
+			}
+			if bytes.Equal(plaintext, want) {
+				t.Fatal("plaintext was not modified during the call")
+			}
+			if got := gcpkms.ComputeCRC32C(ciphertext); got != crc32c {
+				t.Errorf("ComputeCRC32C(ciphertext) = %d, want %d", got, crc32c)
+			}
+			got, err := a.Decrypt(ciphertext, associatedData)
+			if err != nil {
+				t.Fatalf("a.Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("a.Decrypt() returned a modified plaintext of %d bytes, want the %d bytes passed to Encrypt", len(got), len(want))
+			}
+		})
+	}
+}
+
+func TestSignCopiesDigestMutatedDuringCall(t *testing.T) {
+	srv, _ := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	sum := sha256.Sum256([]byte("data"))
+	digest := append([]byte{}, sum[:]...)
+	// The first AsymmetricSign request fails like for a disabled version, so
+	// the signer refreshes the public key and sends the digest again.
+	trans := &mutatingTransport{
+		suffix: ":asymmetricSign",
+		buf:    digest,
+		status: http.StatusBadRequest,
+		body:   `{"error": {"code": 400, "status": "FAILED_PRECONDITION"}}`,
+	}
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://",
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithBaseTransport(trans))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	s, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1))
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+
+	signature, err := s.SignWithContext(context.Background(), digest, crypto.SHA256)
+	if err != nil {
+		t.Fatalf("s.SignWithContext() err = %v, want nil", err)
+	}
+	if bytes.Equal(digest, sum[:]) {
+		t.Fatal("digest was not modified during the call")
+	}
+	if !ecdsa.VerifyASN1(s.Public().(*ecdsa.PublicKey), sum[:], signature) {
+		t.Error("ecdsa.VerifyASN1() of the digest passed to SignWithContext = false, want true")
+	}
+}
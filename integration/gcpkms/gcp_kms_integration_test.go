@@ -19,52 +19,228 @@ package gcpkms_test
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	// Placeholder for internal flag import.
 	// context is used to cancel outstanding requests
+	"google.golang.org/api/cloudkms/v1"
 	"google.golang.org/api/option"
 	"github.com/tink-crypto/tink-go/v2/aead"
 	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/kmstest"
 )
 
+// The integration tests run against a real Cloud KMS key. They are enabled
+// by setting TINK_GCPKMS_INTEGRATION to 1, and configured with the following
+// environment variables. Under Bazel, they use the credentials and the key
+// name in testdata/gcp instead.
 const (
-	keyURI = "gcp-kms://projects/tink-test-infrastructure/locations/global/keyRings/unit-and-integration-testing/cryptoKeys/aead-key"
+	integrationEnv = "TINK_GCPKMS_INTEGRATION"
+	// keyURIEnv holds the URI of a symmetric encryption key, e.g.
+	// 'gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k'.
+	keyURIEnv = "TINK_GCPKMS_KEY_URI"
+	// credentialsEnv optionally holds the path of a credentials file. If it
+	// is not set, Application Default Credentials are used.
+	credentialsEnv = "TINK_GCPKMS_CREDENTIALS"
+	// signingKeyVersionEnv optionally holds the name of an asymmetric
+	// signing key version, which the signing tests need.
+	signingKeyVersionEnv = "TINK_GCPKMS_SIGNING_KEY_VERSION"
+	// macKeyVersionEnv optionally holds the name of an HMAC key version,
+	// which the PRF tests need.
+	macKeyVersionEnv = "TINK_GCPKMS_MAC_KEY_VERSION"
+	// provisionKeysEnv, if set to 1, also enables the integration tests, but
+	// with keys that kmstest.Provision creates in a dedicated key ring of the
+	// project in projectEnv, instead of the keys of the variables above. The
+	// key versions it creates are scheduled for destruction when the tests
+	// end. If set to dry-run, what would be created is logged and the tests
+	// are skipped.
+	provisionKeysEnv = "PROVISION_KEYS"
+	// projectEnv holds the ID of the project to provision keys in.
+	projectEnv = "TINK_GCPKMS_PROJECT"
+	// locationEnv optionally holds the location to provision keys in,
+	// "global" by default.
+	locationEnv = "TINK_GCPKMS_LOCATION"
 )
 
 var (
-	credFile = "testdata/gcp/credential.json"
+	credFile    = "testdata/gcp/credential.json"
+	keyNameFile = "testdata/gcp/key_name.txt"
+	// compatFixtures holds ciphertexts produced by other Cloud KMS clients,
+	// see testdata/compat/README.md.
+	compatFixtures = "testdata/compat/*.json"
+	// envelopeFixtures holds KMS envelope ciphertexts produced by other Tink
+	// implementations, see testdata/envelope/README.md.
+	envelopeFixtures = "testdata/envelope/*.json"
 )
 
 // Placeholder for internal initialization.
 
-func TestGetAeadWithEnvelopeAead(t *testing.T) {
-	srcDir, ok := os.LookupEnv("TEST_SRCDIR")
-	if !ok {
-		t.Skip("TEST_SRCDIR not set")
+// provisioned holds the keys provisioned with provisionKeysEnv, once for all
+// tests.
+var provisioned struct {
+	once sync.Once
+	kms  *cloudkms.Service
+	keys *kmstest.Keys
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if keys := provisioned.keys; keys != nil {
+		if err := keys.Cleanup(context.Background(), provisioned.kms); err != nil {
+			log.Printf("destroying the provisioned key versions failed: %v", err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// integrationConfig is the configuration of the integration tests.
+type integrationConfig struct {
+	keyURI string
+	// signingKeyVersions are the names of the asymmetric signing key
+	// versions, one per algorithm if the keys are provisioned.
+	signingKeyVersions []string
+	macKeyVersion      string
+	apiOptions         []option.ClientOption
+}
+
+// newIntegrationConfig returns the configuration of the integration tests,
+// or skips the test if they are not enabled.
+func newIntegrationConfig(t *testing.T) *integrationConfig {
+	t.Helper()
+	cfg := &integrationConfig{
+		keyURI:        os.Getenv(keyURIEnv),
+		macKeyVersion: os.Getenv(macKeyVersionEnv),
+	}
+	if v := os.Getenv(signingKeyVersionEnv); v != "" {
+		cfg.signingKeyVersions = []string{v}
+	}
+	credentials := os.Getenv(credentialsEnv)
+	provision := os.Getenv(provisionKeysEnv)
+	srcDir, inBazel := os.LookupEnv("TEST_SRCDIR")
+	workspaceDir, _ := os.LookupEnv("TEST_WORKSPACE")
+	switch {
+	case os.Getenv(integrationEnv) == "1" || provision != "":
+	case inBazel && workspaceDir != "":
+		keyName, err := os.ReadFile(filepath.Join(srcDir, workspaceDir, keyNameFile))
+		if err != nil {
+			t.Fatalf("os.ReadFile(%q) err = %v, want nil", keyNameFile, err)
+		}
+		cfg.keyURI = "gcp-kms://" + strings.TrimSpace(string(keyName))
+		credentials = filepath.Join(srcDir, workspaceDir, credFile)
+	default:
+		t.Skipf("integration tests are disabled; set %s=1 and %s to the URI of a Cloud KMS encryption key, or %s=1 and %s to a project to create keys in, to enable them", integrationEnv, keyURIEnv, provisionKeysEnv, projectEnv)
+	}
+	if credentials != "" {
+		cfg.apiOptions = append(cfg.apiOptions, option.WithCredentialsFile(credentials))
+	}
+	if provision != "" {
+		cfg.provisionKeys(t, provision)
+	}
+	if cfg.keyURI == "" {
+		t.Skipf("%s not set; set it to the URI of a Cloud KMS encryption key, e.g. gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k", keyURIEnv)
+	}
+	cfg.requireKey(t)
+	return cfg
+}
+
+// provisionKeys replaces the configured keys with keys provisioned by
+// kmstest.Provision, which only runs for the first test. With mode dry-run,
+// it logs what would be created and skips the test.
+func (cfg *integrationConfig) provisionKeys(t *testing.T, mode string) {
+	t.Helper()
+	if mode != "1" && mode != "dry-run" {
+		t.Fatalf("%s = %q, want 1 or dry-run", provisionKeysEnv, mode)
+	}
+	project := os.Getenv(projectEnv)
+	if project == "" {
+		t.Fatalf("%s is set but %s is not; set it to the ID of the project to create keys in", provisionKeysEnv, projectEnv)
+	}
+	provisioned.once.Do(func() {
+		ctx := context.Background()
+		provisioned.kms, provisioned.err = cloudkms.NewService(ctx, cfg.apiOptions...)
+		if provisioned.err != nil {
+			return
+		}
+		// On error, the keys still hold the versions to destroy.
+		provisioned.keys, provisioned.err = kmstest.Provision(ctx, provisioned.kms, kmstest.Options{
+			Project:  project,
+			Location: os.Getenv(locationEnv),
+			DryRun:   mode == "dry-run",
+			Logf:     log.Printf,
+		})
+	})
+	if provisioned.err != nil {
+		t.Fatalf("provisioning the keys of the integration tests failed: %v", provisioned.err)
+	}
+	if mode == "dry-run" {
+		t.Skipf("%s=dry-run; no keys were created", provisionKeysEnv)
+	}
+	keys := provisioned.keys
+	cfg.keyURI = keys.URIs["aead"]
+	cfg.macKeyVersion = keys.Versions["hmac-sha256"]
+	cfg.signingKeyVersions = nil
+	for _, spec := range kmstest.Matrix() {
+		if spec.Purpose == "ASYMMETRIC_SIGN" {
+			cfg.signingKeyVersions = append(cfg.signingKeyVersions, keys.Versions[spec.ID])
+		}
+	}
+}
+
+// requireKey fails the test unless the configured key exists and can be used
+// for encryption, so that misconfigurations are reported as such rather than
+// as failed operations.
+func (cfg *integrationConfig) requireKey(t *testing.T) {
+	t.Helper()
+	if !strings.HasPrefix(cfg.keyURI, "gcp-kms://") {
+		t.Fatalf("%s = %q, want a URI starting with gcp-kms://", keyURIEnv, cfg.keyURI)
+	}
+	name := strings.TrimPrefix(cfg.keyURI, "gcp-kms://")
+	key, err := cfg.kms(t).Projects.Locations.KeyRings.CryptoKeys.Get(name).Do()
+	if err != nil {
+		t.Fatalf("getting key %s failed: %v; check that it exists and that the credentials may use it", name, err)
+	}
+	if key.Purpose != "ENCRYPT_DECRYPT" {
+		t.Fatalf("key %s has purpose %s, want ENCRYPT_DECRYPT", name, key.Purpose)
+	}
+	if key.Primary == nil || key.Primary.State != "ENABLED" {
+		t.Fatalf("key %s has no enabled primary version", name)
 	}
-	workspaceDir, ok := os.LookupEnv("TEST_WORKSPACE")
-	if !ok {
-		t.Skip("TEST_WORKSPACE not set")
+}
+
+// kms returns a Cloud KMS service authenticated as configured.
+func (cfg *integrationConfig) kms(t *testing.T) *cloudkms.Service {
+	t.Helper()
+	kms, err := cloudkms.NewService(context.Background(), cfg.apiOptions...)
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
 	}
+	return kms
+}
+
+func TestGetAeadWithEnvelopeAead(t *testing.T) {
+	cfg := newIntegrationConfig(t)
 	ctx := context.Background()
-	gcpClient, err := gcpkms.NewClientWithOptions(
-		ctx, keyURI, option.WithCredentialsFile(filepath.Join(srcDir, workspaceDir, credFile)))
+	gcpClient, err := gcpkms.NewClientWithOptions(ctx, cfg.keyURI, cfg.apiOptions...)
 	if err != nil {
 		t.Fatalf("gcpkms.NewClientWithOptions() err = %q, want nil", err)
 	}
-	kekAEAD, err := gcpClient.GetAEAD(keyURI)
+	kekAEAD, err := gcpClient.GetAEAD(cfg.keyURI)
 	if err != nil {
 		t.Fatalf("gcpClient.GetAEAD(keyURI) err = %q, want nil", err)
 	}
 
 	dekTemplate := aead.AES128CTRHMACSHA256KeyTemplate()
 	a := aead.NewKMSEnvelopeAEAD2(dekTemplate, kekAEAD)
-	if err != nil {
-		t.Fatalf("a.Encrypt(plaintext, associatedData) err = %q, want nil", err)
-	}
 	plaintext := []byte("message")
 	associatedData := []byte("example KMS envelope AEAD encryption")
 
@@ -85,3 +261,253 @@ func TestGetAeadWithEnvelopeAead(t *testing.T) {
 		t.Error("a.Decrypt(ciphertext, []byte(\"invalid associatedData\")) err = nil, want error")
 	}
 }
+
+func TestIntegrationDecryptWithMetadata(t *testing.T) {
+	cfg := newIntegrationConfig(t)
+	ctx := context.Background()
+	client, err := gcpkms.NewClient(ctx, cfg.keyURI, gcpkms.WithGoogleAPIClientOptions(cfg.apiOptions...))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(cfg.keyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	plaintext := []byte("plaintext")
+	ciphertext, err := a.(*gcpkms.AEAD).EncryptWithContext(ctx, plaintext, nil)
+	if err != nil {
+		t.Fatalf("a.EncryptWithContext() err = %v, want nil", err)
+	}
+	res, err := a.(*gcpkms.AEAD).DecryptWithMetadata(ctx, ciphertext, nil)
+	if err != nil {
+		t.Fatalf("a.DecryptWithMetadata() err = %v, want nil", err)
+	}
+	if !bytes.Equal(res.Plaintext, plaintext) || !res.PlaintextChecksumVerified || !res.UsedPrimary {
+		t.Errorf("a.DecryptWithMetadata() = %+v, want verified plaintext %q decrypted with the primary", res, plaintext)
+	}
+}
+
+func TestIntegrationVerifySignature(t *testing.T) {
+	cfg := newIntegrationConfig(t)
+	if len(cfg.signingKeyVersions) == 0 {
+		t.Skipf("%s not set; set it to the name of an asymmetric signing key version to run the signing tests", signingKeyVersionEnv)
+	}
+	kms := cfg.kms(t)
+	for _, version := range cfg.signingKeyVersions {
+		t.Run(version, func(t *testing.T) {
+			verifySignature(t, kms, version)
+		})
+	}
+}
+
+// verifySignature checks that signatures of the asymmetric signing key
+// version with the given name are verified by the verifier of its key.
+func verifySignature(t *testing.T, kms *cloudkms.Service, signingKeyVersion string) {
+	t.Helper()
+	pub, err := kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.GetPublicKey(signingKeyVersion).Do()
+	if err != nil {
+		t.Fatalf("getting public key of %s failed: %v", signingKeyVersion, err)
+	}
+	hash := crypto.SHA256
+	switch {
+	case strings.HasSuffix(pub.Algorithm, "SHA384"):
+		hash = crypto.SHA384
+	case strings.HasSuffix(pub.Algorithm, "SHA512"):
+		hash = crypto.SHA512
+	}
+	data := []byte("data")
+	h := hash.New()
+	h.Write(data)
+	encoded := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	digest := &cloudkms.Digest{Sha256: encoded}
+	switch hash {
+	case crypto.SHA384:
+		digest = &cloudkms.Digest{Sha384: encoded}
+	case crypto.SHA512:
+		digest = &cloudkms.Digest{Sha512: encoded}
+	}
+	resp, err := kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.AsymmetricSign(signingKeyVersion, &cloudkms.AsymmetricSignRequest{Digest: digest}).Do()
+	if err != nil {
+		t.Fatalf("signing with %s failed: %v", signingKeyVersion, err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil {
+		t.Fatalf("base64.StdEncoding.DecodeString() err = %v, want nil", err)
+	}
+
+	keyName := signingKeyVersion[:strings.LastIndex(signingKeyVersion, "/cryptoKeyVersions/")]
+	v, err := gcpkms.NewMultiVersionVerifier(context.Background(), keyName, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiVersionVerifier() err = %v, want nil", err)
+	}
+	if err := v.Verify(signature, data); err != nil {
+		t.Errorf("v.Verify() err = %v, want nil", err)
+	}
+	if err := v.Verify(signature, []byte("other data")); err == nil {
+		t.Error("v.Verify() err = nil for other data, want error")
+	}
+}
+
+func TestIntegrationKMSPRF(t *testing.T) {
+	cfg := newIntegrationConfig(t)
+	if cfg.macKeyVersion == "" {
+		t.Skipf("%s not set; set it to the name of an HMAC key version to run the PRF tests", macKeyVersionEnv)
+	}
+	p, err := gcpkms.NewKMSPRF(context.Background(), "gcp-kms://"+cfg.macKeyVersion, gcpkms.WithGoogleAPIClientOptions(cfg.apiOptions...))
+	if err != nil {
+		t.Fatalf("gcpkms.NewKMSPRF() err = %v, want nil", err)
+	}
+	output, err := p.ComputePRF([]byte("data"), 16)
+	if err != nil {
+		t.Fatalf("p.ComputePRF() err = %v, want nil", err)
+	}
+	again, err := p.ComputePRF([]byte("data"), 32)
+	if err != nil {
+		t.Fatalf("p.ComputePRF() err = %v, want nil", err)
+	}
+	if !bytes.Equal(again[:16], output) {
+		t.Errorf("p.ComputePRF() = %x, want a prefix of %x", output, again)
+	}
+	other, err := p.ComputePRF([]byte("other data"), 16)
+	if err != nil {
+		t.Fatalf("p.ComputePRF() err = %v, want nil", err)
+	}
+	if bytes.Equal(other, output) {
+		t.Errorf("p.ComputePRF() = %x for other data, want a different output", other)
+	}
+}
+
+// compatFixture is a ciphertext produced by another Cloud KMS client.
+type compatFixture struct {
+	Description    string `json:"description"`
+	Tool           string `json:"tool"`
+	KeyName        string `json:"key_name"`
+	Plaintext      []byte `json:"plaintext"`
+	AssociatedData []byte `json:"associated_data"`
+	Ciphertext     []byte `json:"ciphertext"`
+}
+
+func TestIntegrationCompatibilityFixtures(t *testing.T) {
+	cfg := newIntegrationConfig(t)
+	files, err := filepath.Glob(compatFixtures)
+	if err != nil {
+		t.Fatalf("filepath.Glob(%q) err = %v, want nil", compatFixtures, err)
+	}
+	if len(files) == 0 {
+		t.Fatalf("no fixtures match %s, see testdata/compat/README.md", compatFixtures)
+	}
+	client, err := gcpkms.NewClient(context.Background(), cfg.keyURI, gcpkms.WithGoogleAPIClientOptions(cfg.apiOptions...))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(cfg.keyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	keyName := strings.TrimPrefix(cfg.keyURI, "gcp-kms://")
+	for _, file := range files {
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("os.ReadFile() err = %v, want nil", err)
+			}
+			var f compatFixture
+			if err := json.Unmarshal(data, &f); err != nil {
+				t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+			}
+			if f.KeyName != keyName {
+				t.Skipf("fixture is for key %s, not %s", f.KeyName, keyName)
+			}
+			got, err := a.Decrypt(f.Ciphertext, f.AssociatedData)
+			if err != nil {
+				t.Fatalf("a.Decrypt() of ciphertext produced by %s (%s) err = %v, want nil", f.Tool, f.Description, err)
+			}
+			if !bytes.Equal(got, f.Plaintext) {
+				t.Errorf("a.Decrypt() of ciphertext produced by %s (%s) = %q, want %q", f.Tool, f.Description, got, f.Plaintext)
+			}
+		})
+	}
+}
+
+func TestIntegrationEnvelopeFixtures(t *testing.T) {
+	cfg := newIntegrationConfig(t)
+	fixtures := readEnvelopeFixtures(t, envelopeFixtures)
+	if len(fixtures) == 0 {
+		t.Fatalf("no fixtures match %s, see testdata/envelope/README.md", envelopeFixtures)
+	}
+	client, err := gcpkms.NewClient(context.Background(), cfg.keyURI, gcpkms.WithGoogleAPIClientOptions(cfg.apiOptions...))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	kek, err := client.GetAEAD(cfg.keyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	for file, f := range fixtures {
+		t.Run(file, func(t *testing.T) {
+			if f.KEKURI != cfg.keyURI {
+				t.Skipf("fixture is for KEK %s, not %s", f.KEKURI, cfg.keyURI)
+			}
+			verifyEnvelopeFixture(t, kek, f)
+		})
+	}
+}
+
+func TestIntegrationJSONAPICompatibility(t *testing.T) {
+	cfg := newIntegrationConfig(t)
+	client, err := gcpkms.NewClient(context.Background(), cfg.keyURI, gcpkms.WithGoogleAPIClientOptions(cfg.apiOptions...))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(cfg.keyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	keys := cfg.kms(t).Projects.Locations.KeyRings.CryptoKeys
+	keyName := strings.TrimPrefix(cfg.keyURI, "gcp-kms://")
+	for _, tc := range []struct {
+		name           string
+		plaintext      []byte
+		associatedData []byte
+	}{
+		{name: "with associated data", plaintext: []byte("plaintext"), associatedData: []byte("associated data")},
+		{name: "without associated data", plaintext: []byte("plaintext")},
+		{name: "URL-unsafe base64", plaintext: []byte{0xfb, 0xff}, associatedData: []byte{0xfe}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ciphertext, err := a.Encrypt(tc.plaintext, tc.associatedData)
+			if err != nil {
+				t.Fatalf("a.Encrypt() err = %v, want nil", err)
+			}
+			decResp, err := keys.Decrypt(keyName, &cloudkms.DecryptRequest{
+				Ciphertext:                  base64.StdEncoding.EncodeToString(ciphertext),
+				AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(tc.associatedData),
+			}).Do()
+			if err != nil {
+				t.Fatalf("Decrypt() err = %v, want nil", err)
+			}
+			if got, want := decResp.Plaintext, base64.StdEncoding.EncodeToString(tc.plaintext); got != want {
+				t.Errorf("Decrypt() plaintext = %q, want %q", got, want)
+			}
+
+			encResp, err := keys.Encrypt(keyName, &cloudkms.EncryptRequest{
+				Plaintext:                   base64.StdEncoding.EncodeToString(tc.plaintext),
+				AdditionalAuthenticatedData: base64.StdEncoding.EncodeToString(tc.associatedData),
+			}).Do()
+			if err != nil {
+				t.Fatalf("Encrypt() err = %v, want nil", err)
+			}
+			ciphertext, err = base64.StdEncoding.DecodeString(encResp.Ciphertext)
+			if err != nil {
+				t.Fatalf("base64.StdEncoding.DecodeString() err = %v, want nil", err)
+			}
+			got, err := a.Decrypt(ciphertext, tc.associatedData)
+			if err != nil {
+				t.Fatalf("a.Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, tc.plaintext) {
+				t.Errorf("a.Decrypt() = %q, want %q", got, tc.plaintext)
+			}
+		})
+	}
+}
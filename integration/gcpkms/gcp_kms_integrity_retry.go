@@ -0,0 +1,174 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	defaultIntegrityAttempts       = 3
+	defaultIntegrityInitialBackoff = 50 * time.Millisecond
+	defaultIntegrityMaxBackoff     = time.Second
+)
+
+// integrityRetry retries requests whose response fails checksum
+// verification, e.g. because it was corrupted in transit. Attempts are
+// separated by an exponential, jittered backoff, so that a corruption source
+// that persists for a while, such as a broken proxy, does not exhaust them at
+// once.
+type integrityRetry struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	// jitter randomizes a backoff. It is replaced in tests.
+	jitter func(backoff time.Duration) time.Duration
+	// clock times the backoff. It is the clock of the Client, if any.
+	clock clock
+	// predicate is nil unless the predicate of WithRetryPredicate decides
+	// which errors are retried, and after which backoff.
+	predicate func(op Method, attempt int, err error) (retry bool, backoff time.Duration)
+	// budget is nil unless retries are limited by the retry budget of a
+	// Client.
+	budget *retryBudget
+}
+
+func newIntegrityRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) *integrityRetry {
+	return &integrityRetry{
+		maxAttempts:    maxAttempts,
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		jitter:         jitter,
+		clock:          realClock{},
+	}
+}
+
+// defaultIntegrityRetry is used by signers and verifiers configured without
+// WithIntegrityRetry.
+var defaultIntegrityRetry = newIntegrityRetry(defaultIntegrityAttempts, defaultIntegrityInitialBackoff, defaultIntegrityMaxBackoff)
+
+// forClient returns a copy of r, or of the default settings if r is nil,
+// whose retries are limited by budget, decided by predicate if it is not nil,
+// and timed by clk. Other errors are retried by the invoker of the Client.
+func (r *integrityRetry) forClient(budget *retryBudget, predicate func(op Method, attempt int, err error) (bool, time.Duration), clk clock) *integrityRetry {
+	if r == nil {
+		r = defaultIntegrityRetry
+	}
+	forClient := *r
+	forClient.budget = budget
+	forClient.predicate = predicate
+	forClient.clock = clk
+	return &forClient
+}
+
+// do calls fn, which calls the Cloud KMS method op, until it succeeds, it
+// fails with an error that does not match ErrChecksumMismatch, the attempts
+// or the retry budget, if any, are exhausted, or ctx is done. It returns the
+// last error of fn. If r is nil, the default settings are used. If r has a
+// predicate, it decides instead whether and after which backoff checksum
+// failures are retried, within the attempts, the retry budget and the
+// deadline of ctx.
+func (r *integrityRetry) do(ctx context.Context, op Method, fn func() error) error {
+	if r == nil {
+		r = defaultIntegrityRetry
+	}
+	backoff := r.initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil {
+			if r.budget != nil {
+				r.budget.onSuccess()
+			}
+			return nil
+		}
+		if !errors.Is(err, ErrChecksumMismatch) {
+			return err
+		}
+		delay := r.jitter(backoff)
+		if r.predicate != nil {
+			var retry bool
+			if retry, delay = r.predicate(op, attempt, err); !retry {
+				return err
+			}
+		}
+		if attempt >= r.maxAttempts || ctx.Err() != nil {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(r.clock.Now()) < delay {
+			return err
+		}
+		if r.budget != nil && !r.budget.tryAcquire() {
+			return fmt.Errorf("%w (retry budget exhausted)", err)
+		}
+		if r.clock.Sleep(ctx, delay) != nil {
+			return err
+		}
+		backoff *= 2
+		if backoff > r.maxBackoff {
+			backoff = r.maxBackoff
+		}
+	}
+}
+
+// IntegrityRetryOption is returned by WithIntegrityRetry. It configures
+// signers and verifiers.
+type IntegrityRetryOption struct {
+	r *integrityRetry
+}
+
+var (
+	_ MultiSignerOption = IntegrityRetryOption{}
+	_ VerifierOption    = IntegrityRetryOption{}
+)
+
+// WithIntegrityRetry sets how often GetPublicKey requests are attempted when
+// the response fails checksum verification, and the backoff between
+// attempts, which starts at initialBackoff and doubles up to maxBackoff, and
+// is jittered. Waiting stops early when the context of the request is done.
+// The default is 3 attempts with a backoff from 50ms up to 1s.
+func WithIntegrityRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration) IntegrityRetryOption {
+	return IntegrityRetryOption{r: newIntegrityRetry(maxAttempts, initialBackoff, maxBackoff)}
+}
+
+func (o IntegrityRetryOption) validate() error {
+	if o.r.maxAttempts < 1 {
+		return fmt.Errorf("integrity retry attempts must be at least 1, got %d", o.r.maxAttempts)
+	}
+	if o.r.initialBackoff <= 0 || o.r.maxBackoff < o.r.initialBackoff {
+		return fmt.Errorf("integrity retry backoff must satisfy 0 < initial <= max, got %v and %v", o.r.initialBackoff, o.r.maxBackoff)
+	}
+	return nil
+}
+
+func (o IntegrityRetryOption) applyMultiSigner(cfg *multiSignerConfig) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	cfg.integrity = o.r
+	return nil
+}
+
+func (o IntegrityRetryOption) applyVerifier(cfg *verifierConfig) error {
+	if err := o.validate(); err != nil {
+		return err
+	}
+	cfg.integrity = o.r
+	return nil
+}
@@ -0,0 +1,228 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+// newTestIntegrityRetry returns an integrityRetry without jitter that
+// sleeps on clock.
+func newTestIntegrityRetry(maxAttempts int, initialBackoff, maxBackoff time.Duration, clock *fakeClock) *integrityRetry {
+	r := newIntegrityRetry(maxAttempts, initialBackoff, maxBackoff)
+	r.jitter = func(backoff time.Duration) time.Duration { return backoff }
+	r.clock = clock
+	return r
+}
+
+func TestIntegrityRetryBacksOff(t *testing.T) {
+	clock := newFakeClock()
+	r := newTestIntegrityRetry(5, 10*time.Millisecond, 40*time.Millisecond, clock)
+	calls := 0
+	err := r.do(context.Background(), MethodGetPublicKey, func() error {
+		calls++
+		return ErrChecksumMismatch
+	})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("r.do() err = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if calls != 5 {
+		t.Errorf("fn called %d times, want 5", calls)
+	}
+	want := []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 40 * time.Millisecond, 40 * time.Millisecond}
+	if got := clock.Sleeps(); !reflect.DeepEqual(got, want) {
+		t.Errorf("sleeps = %v, want %v", got, want)
+	}
+}
+
+func TestIntegrityRetryStops(t *testing.T) {
+	otherErr := errors.New("other error")
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	for _, tc := range []struct {
+		name string
+		ctx  context.Context
+		// errs are returned by the successive calls of fn.
+		errs       []error
+		wantErr    error
+		wantSleeps int
+	}{
+		{name: "success", ctx: context.Background(), errs: []error{ErrChecksumMismatch, nil}, wantSleeps: 1},
+		{name: "other error", ctx: context.Background(), errs: []error{otherErr}, wantErr: otherErr},
+		{name: "context done", ctx: canceled, errs: []error{ErrChecksumMismatch}, wantErr: ErrChecksumMismatch},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := newFakeClock()
+			r := newTestIntegrityRetry(5, time.Millisecond, time.Second, clock)
+			calls := 0
+			err := r.do(tc.ctx, MethodGetPublicKey, func() error {
+				calls++
+				if calls > len(tc.errs) {
+					t.Fatalf("fn called %d times, want %d", calls, len(tc.errs))
+				}
+				return tc.errs[calls-1]
+			})
+			if !errors.Is(err, tc.wantErr) || (err == nil) != (tc.wantErr == nil) {
+				t.Errorf("r.do() err = %v, want %v", err, tc.wantErr)
+			}
+			if calls != len(tc.errs) {
+				t.Errorf("fn called %d times, want %d", calls, len(tc.errs))
+			}
+			if got := len(clock.Sleeps()); got != tc.wantSleeps {
+				t.Errorf("slept %d times, want %d", got, tc.wantSleeps)
+			}
+		})
+	}
+}
+
+func TestIntegrityRetryStopsWaitingWhenContextIsDone(t *testing.T) {
+	r := newIntegrityRetry(3, time.Hour, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	calls := 0
+	err := r.do(ctx, MethodGetPublicKey, func() error {
+		calls++
+		return ErrChecksumMismatch
+	})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("r.do() err = %v, want %v", err, ErrChecksumMismatch)
+	}
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+}
+
+func TestIntegrityRetryPredicateIsBounded(t *testing.T) {
+	always := func(Method, int, error) (bool, time.Duration) { return true, time.Millisecond }
+	for _, tc := range []struct {
+		name      string
+		budget    *retryBudget
+		wantCalls int
+		// wantExhausted is true if the error reports the exhausted budget.
+		wantExhausted bool
+	}{
+		{name: "attempts", wantCalls: 4},
+		{name: "budget", budget: newRetryBudget(0.1, 2), wantCalls: 3, wantExhausted: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := newFakeClock()
+			r := newTestIntegrityRetry(4, time.Millisecond, time.Second, clock).forClient(tc.budget, always, clock)
+			calls := 0
+			err := r.do(context.Background(), MethodGetPublicKey, func() error {
+				calls++
+				return ErrChecksumMismatch
+			})
+			if !errors.Is(err, ErrChecksumMismatch) {
+				t.Errorf("r.do() err = %v, want %v", err, ErrChecksumMismatch)
+			}
+			if got := strings.Contains(err.Error(), "retry budget exhausted"); got != tc.wantExhausted {
+				t.Errorf("r.do() err = %v, reports exhausted budget = %v, want %v", err, got, tc.wantExhausted)
+			}
+			if calls != tc.wantCalls {
+				t.Errorf("fn called %d times, want %d", calls, tc.wantCalls)
+			}
+		})
+	}
+
+	// Without a deadline long enough for the backoff, the predicate is not
+	// waited for.
+	r := newIntegrityRetry(100, time.Millisecond, time.Millisecond).forClient(nil, func(Method, int, error) (bool, time.Duration) { return true, time.Hour }, realClock{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	calls := 0
+	r.do(ctx, MethodGetPublicKey, func() error {
+		calls++
+		return ErrChecksumMismatch
+	})
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+}
+
+func TestGetPublicKeyRetriesCorruptedResponses(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		corrupted int
+		wantErr   bool
+	}{
+		{name: "recovers", corrupted: 2},
+		{name: "gives up", corrupted: 3, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := fakekms.NewServer()
+			t.Cleanup(srv.Close)
+			if err := srv.CreateSigningKey(testSigningKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+				t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+			}
+			faults := fakekms.NewFaultInjector()
+			for n := 0; n < tc.corrupted; n++ {
+				faults.Inject("GetPublicKey", testSigningVersion, fakekms.Fault{CorruptChecksums: true})
+			}
+			srv.SetFaultInjector(faults)
+			kms, err := cloudkms.NewService(context.Background(), srv.ClientOptions()...)
+			if err != nil {
+				t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+			}
+			clock := newFakeClock()
+			r := newTestIntegrityRetry(3, 10*time.Millisecond, time.Second, clock)
+			_, err = newSigner(context.Background(), testSigningVersion, kms, nil, callTimeouts{}, r, nil)
+			if tc.wantErr {
+				if !errors.Is(err, ErrChecksumMismatch) {
+					t.Errorf("newSigner() err = %v, want %v", err, ErrChecksumMismatch)
+				}
+			} else if err != nil {
+				t.Errorf("newSigner() err = %v, want nil", err)
+			}
+			if got := srv.CallCount("GetPublicKey"); got != 3 {
+				t.Errorf("GetPublicKey called %d times, want 3", got)
+			}
+			if got, want := clock.Sleeps(), []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}; !reflect.DeepEqual(got, want) {
+				t.Errorf("sleeps = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestWithIntegrityRetryRejectsInvalidValues(t *testing.T) {
+	for _, tc := range []struct {
+		name                       string
+		maxAttempts                int
+		initialBackoff, maxBackoff time.Duration
+	}{
+		{name: "no attempts", maxAttempts: 0, initialBackoff: time.Millisecond, maxBackoff: time.Second},
+		{name: "zero backoff", maxAttempts: 3, initialBackoff: 0, maxBackoff: time.Second},
+		{name: "max below initial", maxAttempts: 3, initialBackoff: time.Second, maxBackoff: time.Millisecond},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			opt := WithIntegrityRetry(tc.maxAttempts, tc.initialBackoff, tc.maxBackoff)
+			if _, err := newMultiSignerConfig([]MultiSignerOption{opt}); err == nil {
+				t.Error("newMultiSignerConfig() err = nil, want error")
+			}
+			if err := opt.applyVerifier(&verifierConfig{}); err == nil {
+				t.Error("opt.applyVerifier() err = nil, want error")
+			}
+		})
+	}
+}
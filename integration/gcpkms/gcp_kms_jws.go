@@ -0,0 +1,174 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// jwsAlgorithms holds the JWS (RFC 7518) algorithm of the Cloud KMS signing
+// algorithms that have one, by name.
+var jwsAlgorithms = map[string]string{
+	"EC_SIGN_P256_SHA256":        "ES256",
+	"EC_SIGN_P384_SHA384":        "ES384",
+	"RSA_SIGN_PKCS1_2048_SHA256": "RS256",
+	"RSA_SIGN_PKCS1_3072_SHA256": "RS256",
+	"RSA_SIGN_PKCS1_4096_SHA256": "RS256",
+	"RSA_SIGN_PKCS1_4096_SHA512": "RS512",
+	"RSA_SIGN_PSS_2048_SHA256":   "PS256",
+	"RSA_SIGN_PSS_3072_SHA256":   "PS256",
+	"RSA_SIGN_PSS_4096_SHA256":   "PS256",
+	"RSA_SIGN_PSS_4096_SHA512":   "PS512",
+}
+
+// jwsAlgorithm returns the JWS algorithm of the Cloud KMS signing algorithm
+// with the given name.
+func jwsAlgorithm(algorithm string) (string, error) {
+	alg, ok := jwsAlgorithms[algorithm]
+	if !ok {
+		return "", fmt.Errorf("signing algorithm %q has no JWS algorithm", algorithm)
+	}
+	return alg, nil
+}
+
+// SignJWSDetached returns a JWS (RFC 7515) in compact serialization with a
+// detached, unencoded payload (RFC 7797), i.e. "header..signature", signed
+// with the Cloud KMS asymmetric signing key version with the given resource
+// name, e.g. "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+//
+// The protected header holds the entries of header, with "alg" set to the JWS
+// algorithm of the key's algorithm, "b64" set to false and "b64" added to
+// "crit". header must not set "alg" to a different algorithm or "b64" to
+// true. The signature covers the encoded header, a period and payload as is,
+// and ECDSA signatures are encoded as the fixed-size concatenation of R and S
+// as JWS requires. All requests are bound to ctx.
+func SignJWSDetached(ctx context.Context, header map[string]any, payload []byte, keyName string, kms *cloudkms.Service) (string, error) {
+	s, err := newSigner(ctx, keyName, kms, nil, callTimeouts{}, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	pub := s.publicKey()
+	alg, err := jwsAlgorithm(pub.algorithm)
+	if err != nil {
+		return "", err
+	}
+	protected, err := jwsProtectedHeader(header, alg)
+	if err != nil {
+		return "", err
+	}
+	encodedHeader := base64.RawURLEncoding.EncodeToString(protected)
+
+	h := pub.alg.hash.New()
+	h.Write([]byte(encodedHeader))
+	h.Write([]byte{'.'})
+	h.Write(payload)
+	var opts crypto.SignerOpts = pub.alg.hash
+	if pub.alg.pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: pub.alg.hash}
+	}
+	signature, err := s.Sign(rand.Reader, h.Sum(nil), opts)
+	if err != nil {
+		return "", err
+	}
+	if pub.alg.curve != nil {
+		if signature, err = rawECDSASignature(signature, (pub.alg.curve.Params().BitSize+7)/8); err != nil {
+			return "", err
+		}
+	}
+	return encodedHeader + ".." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// jwsProtectedHeader returns the JSON encoding of header with "alg" set to
+// alg, "b64" set to false and "b64" added to "crit".
+func jwsProtectedHeader(header map[string]any, alg string) ([]byte, error) {
+	protected := make(map[string]any, len(header)+3)
+	for k, v := range header {
+		protected[k] = v
+	}
+	if v, ok := protected["alg"]; ok && v != alg {
+		return nil, fmt.Errorf("header sets alg to %v, but the key's algorithm is %s", v, alg)
+	}
+	protected["alg"] = alg
+	if v, ok := protected["b64"]; ok && v != false {
+		return nil, fmt.Errorf("header sets b64 to %v, want false", v)
+	}
+	protected["b64"] = false
+	crit := []string{"b64"}
+	if v, ok := protected["crit"]; ok {
+		names, err := stringList(v)
+		if err != nil {
+			return nil, fmt.Errorf("header crit: %v", err)
+		}
+		for _, name := range names {
+			if name != "b64" {
+				crit = append(crit, name)
+			}
+		}
+	}
+	protected["crit"] = crit
+	return json.Marshal(protected)
+}
+
+// stringList returns v as a list of strings if it is a []string or an []any
+// holding only strings, as decoded from JSON.
+func stringList(v any) ([]string, error) {
+	switch l := v.(type) {
+	case []string:
+		return l, nil
+	case []any:
+		names := make([]string, 0, len(l))
+		for _, e := range l {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("%v is not a string", e)
+			}
+			names = append(names, s)
+		}
+		return names, nil
+	default:
+		return nil, fmt.Errorf("%v is not a list of strings", v)
+	}
+}
+
+// rawECDSASignature converts the ASN.1 DER encoded ECDSA signature returned
+// by Cloud KMS to the concatenation of R and S, each left-padded to size
+// bytes.
+func rawECDSASignature(der []byte, size int) ([]byte, error) {
+	var sig struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil || len(rest) != 0 {
+		return nil, errors.New("malformed ECDSA signature")
+	}
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.BitLen() > 8*size || sig.S.BitLen() > 8*size {
+		return nil, errors.New("malformed ECDSA signature")
+	}
+	raw := make([]byte, 2*size)
+	sig.R.FillBytes(raw[:size])
+	sig.S.FillBytes(raw[size:])
+	return raw, nil
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	jose "gopkg.in/square/go-jose.v2"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+func TestSignJWSDetachedVerifiesWithJOSE(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		jwsAlg    string
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256", jwsAlg: "ES256"},
+		{algorithm: "EC_SIGN_P384_SHA384", jwsAlg: "ES384"},
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", jwsAlg: "RS256"},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", jwsAlg: "PS256"},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			_, kms := newFakeSigningKey(t, tc.algorithm)
+			version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+			// The payload is signed as is, so it may hold characters that
+			// base64url does not, including periods.
+			payload := []byte(`{"amount":"10.00","currency":"EUR"}`)
+			header := map[string]any{"kid": "key-1", "typ": "JOSE"}
+			jws, err := gcpkms.SignJWSDetached(context.Background(), header, payload, version, kms)
+			if err != nil {
+				t.Fatalf("gcpkms.SignJWSDetached() err = %v, want nil", err)
+			}
+			parts := strings.Split(jws, ".")
+			if len(parts) != 3 || parts[1] != "" {
+				t.Fatalf("gcpkms.SignJWSDetached() = %q, want header..signature", jws)
+			}
+			rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+			if err != nil {
+				t.Fatalf("decoding header failed: %v", err)
+			}
+			var got map[string]any
+			if err := json.Unmarshal(rawHeader, &got); err != nil {
+				t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+			}
+			want := map[string]any{"alg": tc.jwsAlg, "b64": false, "crit": []any{"b64"}, "kid": "key-1", "typ": "JOSE"}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("header = %v, want %v", got, want)
+			}
+			if _, ok := header["alg"]; ok {
+				t.Error("gcpkms.SignJWSDetached() modified header")
+			}
+
+			parsed, err := jose.ParseDetached(jws, payload)
+			if err != nil {
+				t.Fatalf("jose.ParseDetached() err = %v, want nil", err)
+			}
+			pub := kmsPublicKey(t, kms, version)
+			if err := parsed.DetachedVerify(payload, pub); err != nil {
+				t.Errorf("DetachedVerify() err = %v, want nil", err)
+			}
+			if err := parsed.DetachedVerify([]byte(`{"amount":"99.00","currency":"EUR"}`), pub); err == nil {
+				t.Error("DetachedVerify() with other payload err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSignJWSDetachedMergesCrit(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+	header := map[string]any{"crit": []any{"b64", "exp"}, "exp": 1, "b64": false, "alg": "ES256"}
+	jws, err := gcpkms.SignJWSDetached(context.Background(), header, []byte("payload"), version, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.SignJWSDetached() err = %v, want nil", err)
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(strings.Split(jws, ".")[0])
+	if err != nil {
+		t.Fatalf("decoding header failed: %v", err)
+	}
+	var got struct {
+		Crit []string `json:"crit"`
+	}
+	if err := json.Unmarshal(rawHeader, &got); err != nil {
+		t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+	}
+	if want := []string{"b64", "exp"}; !reflect.DeepEqual(got.Crit, want) {
+		t.Errorf("crit = %v, want %v", got.Crit, want)
+	}
+}
+
+func TestSignJWSDetachedRejectsInvalidHeaders(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+	for _, header := range []map[string]any{
+		{"alg": "RS256"},
+		{"alg": "none"},
+		{"b64": true},
+		{"crit": "b64"},
+		{"crit": []any{1}},
+	} {
+		if _, err := gcpkms.SignJWSDetached(context.Background(), header, []byte("payload"), version, kms); err == nil {
+			t.Errorf("gcpkms.SignJWSDetached(%v) err = nil, want error", header)
+		}
+	}
+}
+
+func TestSignJWSDetachedRejectsInvalidKeyNames(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	for _, name := range []string{"", fakeSigningKeyName, fakeSigningKeyName + "/cryptoKeyVersions/2"} {
+		if _, err := gcpkms.SignJWSDetached(context.Background(), nil, []byte("payload"), name, kms); err == nil {
+			t.Errorf("gcpkms.SignJWSDetached(%q) err = nil, want error", name)
+		}
+	}
+}
+
+func TestJWSAlgorithmRejectsAlgorithmsWithoutMapping(t *testing.T) {
+	for _, algorithm := range []string{"EC_SIGN_ED25519", "EC_SIGN_SECP256K1_SHA256", "HMAC_SHA256", "GOOGLE_SYMMETRIC_ENCRYPTION", ""} {
+		if alg, err := gcpkms.JWSAlgorithm(algorithm); err == nil {
+			t.Errorf("gcpkms.JWSAlgorithm(%q) = %q, want error", algorithm, alg)
+		}
+	}
+}
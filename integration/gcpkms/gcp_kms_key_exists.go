@@ -0,0 +1,91 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// KeyCheckError is returned by Client.KeyExists when it cannot tell whether
+// the key exists.
+type KeyCheckError struct {
+	// KeyName is the resource name of the key.
+	KeyName string
+	// PermissionDenied is true if the credentials were rejected or lack the
+	// permission to get the key. Note that Cloud KMS may also deny access to
+	// keys that do not exist.
+	PermissionDenied bool
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *KeyCheckError) Error() string {
+	if e.PermissionDenied {
+		return fmt.Sprintf("gcpkms: cannot tell whether %s exists: permission denied: %v", e.KeyName, e.Err)
+	}
+	return fmt.Sprintf("gcpkms: cannot tell whether %s exists: %v", e.KeyName, e.Err)
+}
+
+func (e *KeyCheckError) Unwrap() error {
+	return e.Err
+}
+
+// KeyExists reports whether the crypto key with URI keyURI exists, with a
+// single GetCryptoKey request and without constructing a primitive, e.g. to
+// check a tenant's key before enabling a feature that depends on it.
+//
+// It returns false and no error if Cloud KMS reports that the key does not
+// exist, and a *KeyCheckError if it cannot tell, e.g. because the permission
+// to get the key is denied or Cloud KMS cannot be reached. The request is
+// retried like those of the primitives.
+//
+// KeyExists does not check the purpose of the key or the state of its
+// versions; SelfTest proves that the key can be used for encryption.
+func (c *Client) KeyExists(ctx context.Context, keyURI string) (bool, error) {
+	name, err := keyNameFromURI(keyURI)
+	if err != nil {
+		return false, err
+	}
+	if !cryptoKeyRegex.MatchString(name) {
+		return false, fmt.Errorf("keyURI must name a crypto key, got %q", keyURI)
+	}
+	if !c.Supported(keyURI) {
+		return false, errors.New("unsupported keyURI")
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return false, ErrClientClosed
+	}
+	if err := c.bindLocation(name); err != nil {
+		return false, err
+	}
+	err = c.invoker.call(ctx, MethodGetCryptoKey, func(ctx context.Context) error {
+		_, err := c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+		return err
+	})
+	switch {
+	case err == nil:
+		return true, nil
+	case isNotFound(err):
+		return false, nil
+	}
+	return false, &KeyCheckError{KeyName: name, PermissionDenied: classifySelfTestError(err) == SelfTestAuth, Err: err}
+}
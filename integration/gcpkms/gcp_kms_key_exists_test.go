@@ -0,0 +1,108 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+func TestClientKeyExists(t *testing.T) {
+	srv := newFakeServer(t)
+	client := newSelfTestClient(t, srv.URL(), nil)
+	for _, tc := range []struct {
+		keyURI string
+		want   bool
+	}{
+		{keyURI: fakeKeyURI, want: true},
+		{keyURI: fakeKeyURI + "-missing", want: false},
+	} {
+		got, err := client.KeyExists(context.Background(), tc.keyURI)
+		if err != nil {
+			t.Fatalf("client.KeyExists(%q) err = %v, want nil", tc.keyURI, err)
+		}
+		if got != tc.want {
+			t.Errorf("client.KeyExists(%q) = %v, want %v", tc.keyURI, got, tc.want)
+		}
+	}
+	if got := srv.CallCount("Encrypt"); got != 0 {
+		t.Errorf("Encrypt called %d times, want 0", got)
+	}
+}
+
+func TestClientKeyExistsCannotTell(t *testing.T) {
+	permissionDenied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{"code": http.StatusForbidden, "status": "PERMISSION_DENIED", "message": "Permission 'cloudkms.cryptoKeys.get' denied."},
+		})
+	}))
+	defer permissionDenied.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, tc := range []struct {
+		name                 string
+		endpoint             string
+		wantPermissionDenied bool
+	}{
+		{name: "permission denied", endpoint: permissionDenied.URL, wantPermissionDenied: true},
+		{name: "transport failure", endpoint: closed.URL},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client := newSelfTestClient(t, tc.endpoint, nil)
+			got, err := client.KeyExists(context.Background(), fakeKeyURI)
+			if got {
+				t.Errorf("client.KeyExists() = true, want false")
+			}
+			var checkErr *gcpkms.KeyCheckError
+			if !errors.As(err, &checkErr) {
+				t.Fatalf("client.KeyExists() err = %v, want *gcpkms.KeyCheckError", err)
+			}
+			if checkErr.KeyName != fakeKeyName {
+				t.Errorf("checkErr.KeyName = %q, want %q", checkErr.KeyName, fakeKeyName)
+			}
+			if checkErr.PermissionDenied != tc.wantPermissionDenied {
+				t.Errorf("checkErr.PermissionDenied = %v, want %v", checkErr.PermissionDenied, tc.wantPermissionDenied)
+			}
+		})
+	}
+}
+
+func TestClientKeyExistsRejectsInvalidURIs(t *testing.T) {
+	client := newSelfTestClient(t, newFakeServer(t).URL(), nil)
+	for _, keyURI := range []string{
+		fakeKeyName,
+		fakeKeyURI + "/cryptoKeyVersions/1",
+		"gcp-kms://projects/p/locations/global/keyHandles/h",
+	} {
+		if _, err := client.KeyExists(context.Background(), keyURI); err == nil {
+			t.Errorf("client.KeyExists(%q) err = nil, want error", keyURI)
+		}
+	}
+	client.Close()
+	if _, err := client.KeyExists(context.Background(), fakeKeyURI); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("client.KeyExists() after Close err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+}
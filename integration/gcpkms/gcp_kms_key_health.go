@@ -0,0 +1,169 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+const (
+	encryptPermission = "cloudkms.cryptoKeyVersions.useToEncrypt"
+	decryptPermission = "cloudkms.cryptoKeyVersions.useToDecrypt"
+)
+
+// KeyHealth is the outcome of checking a crypto key with Client.CheckKeys.
+type KeyHealth struct {
+	KeyURI string
+	// Exists is true if the key could be fetched. It is false both if Cloud
+	// KMS reports that the key does not exist, in which case Err is nil, and
+	// if the key could not be fetched, in which case Err is set.
+	Exists bool
+	// Purpose is the purpose of the key, e.g. "ENCRYPT_DECRYPT".
+	Purpose string
+	// PrimaryVersion is the resource name of the primary version, and
+	// PrimaryState its state, e.g. "ENABLED" or "DISABLED". They are empty if
+	// the key has no primary version.
+	PrimaryVersion string
+	PrimaryState   string
+	// ProtectionLevel is the protection level of the primary version, or of
+	// new versions if the key has no primary version, e.g. "HSM".
+	ProtectionLevel string
+	// CanEncrypt and CanDecrypt are true if the caller holds the permission
+	// to use the key to encrypt and decrypt, respectively.
+	CanEncrypt bool
+	CanDecrypt bool
+	// Err holds the errors that prevented some of the checks, e.g. an invalid
+	// key URI or a PERMISSION_DENIED error fetching the key.
+	Err error
+}
+
+// Healthy reports whether the key exists, has an enabled primary version and
+// can be used to encrypt and decrypt, and all checks succeeded.
+func (h *KeyHealth) Healthy() bool {
+	return h.Err == nil && h.Exists && h.PrimaryState == "ENABLED" && h.CanEncrypt && h.CanDecrypt
+}
+
+// CheckKeys checks the crypto keys with URIs keyURIs, e.g. every key in the
+// configuration of an application before a failover drill, and returns one
+// KeyHealth per key, in the order of keyURIs. Each key is checked with a
+// GetCryptoKey and a TestIamPermissions request, and at most concurrency
+// keys are checked at a time. A concurrency of less than 1 is treated as 1.
+//
+// Keys that cannot be checked are reported in their KeyHealth, so CheckKeys
+// only fails if the client is closed. The requests are retried like those of
+// the primitives.
+func (c *Client) CheckKeys(ctx context.Context, keyURIs []string, concurrency int) ([]KeyHealth, error) {
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClientClosed
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	health := make([]KeyHealth, len(keyURIs))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(keyURIs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				health[j] = c.checkKey(ctx, keyURIs[j])
+			}
+		}()
+	}
+	for i := range keyURIs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return health, nil
+}
+
+// checkKey checks the crypto key with URI keyURI.
+func (c *Client) checkKey(ctx context.Context, keyURI string) KeyHealth {
+	h := KeyHealth{KeyURI: keyURI}
+	name, err := keyNameFromURI(keyURI)
+	if err == nil && !cryptoKeyRegex.MatchString(name) {
+		err = fmt.Errorf("keyURI must name a crypto key, got %q", keyURI)
+	}
+	if err == nil && !c.Supported(keyURI) {
+		err = errors.New("unsupported keyURI")
+	}
+	if err == nil {
+		err = c.bindLocation(name)
+	}
+	if err != nil {
+		h.Err = err
+		return h
+	}
+
+	var key *cloudkms.CryptoKey
+	getErr := c.invoker.call(ctx, MethodGetCryptoKey, func(ctx context.Context) error {
+		var err error
+		key, err = c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+		return err
+	})
+	switch {
+	case getErr == nil:
+		h.Exists = true
+		h.Purpose = key.Purpose
+		if t := key.VersionTemplate; t != nil {
+			h.ProtectionLevel = t.ProtectionLevel
+		}
+		if p := key.Primary; p != nil {
+			h.PrimaryVersion = p.Name
+			h.PrimaryState = p.State
+			if p.ProtectionLevel != "" {
+				h.ProtectionLevel = p.ProtectionLevel
+			}
+		}
+	case isNotFound(getErr):
+		return h
+	default:
+		getErr = fmt.Errorf("getting %s: %w", name, getErr)
+	}
+
+	var resp *cloudkms.TestIamPermissionsResponse
+	permErr := c.invoker.call(ctx, MethodTestIamPermissions, func(ctx context.Context) error {
+		var err error
+		req := &cloudkms.TestIamPermissionsRequest{Permissions: []string{encryptPermission, decryptPermission}}
+		resp, err = c.kms.Projects.Locations.KeyRings.CryptoKeys.TestIamPermissions(name, req).Context(ctx).Do()
+		return err
+	})
+	if permErr == nil {
+		for _, p := range resp.Permissions {
+			switch p {
+			case encryptPermission:
+				h.CanEncrypt = true
+			case decryptPermission:
+				h.CanDecrypt = true
+			}
+		}
+	} else {
+		permErr = fmt.Errorf("testing permissions on %s: %w", name, permErr)
+	}
+	h.Err = errors.Join(getErr, permErr)
+	return h
+}
@@ -0,0 +1,170 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const keyHealthKeyRing = "projects/p/locations/global/keyRings/r"
+
+func newKeyHealthClient(t *testing.T, srv *fakekms.Server, opts ...gcpkms.Option) *gcpkms.Client {
+	t.Helper()
+	opts = append([]gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://", opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientCheckKeys(t *testing.T) {
+	srv := fakekms.NewServer()
+	defer srv.Close()
+	healthy := keyHealthKeyRing + "/cryptoKeys/healthy"
+	disabled := keyHealthKeyRing + "/cryptoKeys/disabled"
+	denied := keyHealthKeyRing + "/cryptoKeys/denied"
+	encryptOnly := keyHealthKeyRing + "/cryptoKeys/encrypt-only"
+	for _, name := range []string{healthy, disabled, denied, encryptOnly} {
+		if err := srv.CreateKey(name); err != nil {
+			t.Fatalf("srv.CreateKey(%q) err = %v, want nil", name, err)
+		}
+	}
+	if err := srv.SetProtectionLevel(healthy, "HSM"); err != nil {
+		t.Fatalf("srv.SetProtectionLevel() err = %v, want nil", err)
+	}
+	if err := srv.SetVersionState(disabled, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	if err := srv.DenyPermissions(denied, "cloudkms.cryptoKeys.get", "cloudkms.cryptoKeyVersions.useToEncrypt", "cloudkms.cryptoKeyVersions.useToDecrypt"); err != nil {
+		t.Fatalf("srv.DenyPermissions() err = %v, want nil", err)
+	}
+	if err := srv.DenyPermissions(encryptOnly, "cloudkms.cryptoKeyVersions.useToDecrypt"); err != nil {
+		t.Fatalf("srv.DenyPermissions() err = %v, want nil", err)
+	}
+	client := newKeyHealthClient(t, srv)
+
+	keyURIs := []string{
+		"gcp-kms://" + healthy,
+		"gcp-kms://" + keyHealthKeyRing + "/cryptoKeys/missing",
+		"gcp-kms://" + disabled,
+		"gcp-kms://" + denied,
+		"gcp-kms://" + encryptOnly,
+		"gcp-kms://" + keyHealthKeyRing,
+	}
+	got, err := client.CheckKeys(context.Background(), keyURIs, 3)
+	if err != nil {
+		t.Fatalf("client.CheckKeys() err = %v, want nil", err)
+	}
+	if len(got) != len(keyURIs) {
+		t.Fatalf("len(client.CheckKeys()) = %d, want %d", len(got), len(keyURIs))
+	}
+	for i, h := range got {
+		if h.KeyURI != keyURIs[i] {
+			t.Errorf("health[%d].KeyURI = %q, want %q", i, h.KeyURI, keyURIs[i])
+		}
+	}
+
+	want := gcpkms.KeyHealth{
+		KeyURI:          keyURIs[0],
+		Exists:          true,
+		Purpose:         "ENCRYPT_DECRYPT",
+		PrimaryVersion:  healthy + "/cryptoKeyVersions/1",
+		PrimaryState:    "ENABLED",
+		ProtectionLevel: "HSM",
+		CanEncrypt:      true,
+		CanDecrypt:      true,
+	}
+	if got[0] != want {
+		t.Errorf("healthy key: got %+v, want %+v", got[0], want)
+	}
+	if !got[0].Healthy() {
+		t.Error("healthy key: Healthy() = false, want true")
+	}
+
+	if want := (gcpkms.KeyHealth{KeyURI: keyURIs[1]}); got[1] != want {
+		t.Errorf("missing key: got %+v, want %+v", got[1], want)
+	}
+
+	if h := got[2]; !h.Exists || h.PrimaryState != "DISABLED" || h.Err != nil || !h.CanEncrypt || h.Healthy() {
+		t.Errorf("disabled key: got %+v, want an existing key with a DISABLED primary version that is not healthy", h)
+	}
+
+	h := got[3]
+	var apiErr *googleapi.Error
+	if !errors.As(h.Err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		t.Errorf("denied key: Err = %v, want a googleapi.Error with code %d", h.Err, http.StatusForbidden)
+	}
+	if h.Exists || h.CanEncrypt || h.CanDecrypt || h.Healthy() {
+		t.Errorf("denied key: got %+v, want no access", h)
+	}
+
+	if h := got[4]; !h.Exists || !h.CanEncrypt || h.CanDecrypt || h.Err != nil || h.Healthy() {
+		t.Errorf("encrypt-only key: got %+v, want CanEncrypt without CanDecrypt", h)
+	}
+
+	if h := got[5]; h.Err == nil || h.Exists {
+		t.Errorf("key ring URI: got %+v, want an error", h)
+	}
+}
+
+func TestClientCheckKeysBoundsConcurrency(t *testing.T) {
+	srv := fakekms.NewServer()
+	defer srv.Close()
+	var keyURIs []string
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("%s/cryptoKeys/k%d", keyHealthKeyRing, i)
+		if err := srv.CreateKey(name); err != nil {
+			t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+		}
+		keyURIs = append(keyURIs, "gcp-kms://"+name)
+	}
+	trans := &concurrencyTransport{delay: 10 * time.Millisecond}
+	client := newKeyHealthClient(t, srv, gcpkms.WithBaseTransport(trans))
+	got, err := client.CheckKeys(context.Background(), keyURIs, 3)
+	if err != nil {
+		t.Fatalf("client.CheckKeys() err = %v, want nil", err)
+	}
+	for _, h := range got {
+		if !h.Healthy() {
+			t.Errorf("key %s: got %+v, want healthy", h.KeyURI, h)
+		}
+	}
+	if max := atomic.LoadInt32(&trans.maxInFlight); max > 3 {
+		t.Errorf("maximum requests in flight = %d, want at most 3", max)
+	}
+}
+
+func TestClientCheckKeysClosed(t *testing.T) {
+	srv := newFakeServer(t)
+	client := newKeyHealthClient(t, srv)
+	client.Close()
+	if _, err := client.CheckKeys(context.Background(), []string{fakeKeyURI}, 1); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("client.CheckKeys() err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// ErrKeyPolicyViolation is matched by the *KeyPolicyError returned by
+// Client.AssertKeyConfiguration, and by GetAEAD and GetSigner with
+// WithRequiredKeyLabels, WithAllowedKeyLocations or
+// WithRequiredRotationPeriod.
+var ErrKeyPolicyViolation = errors.New("gcpkms: key violates policy")
+
+// KeyPolicy is the configuration that Client.AssertKeyConfiguration requires
+// of a crypto key. Fields with their zero value are not checked.
+type KeyPolicy struct {
+	// Purpose is the purpose of the key, e.g. "ENCRYPT_DECRYPT" or
+	// "ASYMMETRIC_SIGN".
+	Purpose string
+	// ProtectionLevel is the protection level of new versions of the key,
+	// e.g. "HSM".
+	ProtectionLevel string
+	// Algorithm is the algorithm of new versions of the key, e.g.
+	// "EC_SIGN_P256_SHA256".
+	Algorithm string
+	// MaxRotationPeriod is the longest allowed rotation period. Keys that are
+	// not rotated automatically violate it.
+	MaxRotationPeriod time.Duration
+	// Labels are labels that the key must have, with the given values.
+	Labels map[string]string
+}
+
+// KeyPolicyViolation is a constraint of a KeyPolicy that a key violates.
+type KeyPolicyViolation struct {
+	// Field is the violated field of the KeyPolicy, e.g. "ProtectionLevel",
+	// or "Labels[k]" for the label with key k. It is "Location" for the
+	// locations allowed with WithAllowedKeyLocations.
+	Field string
+	// Want is the required value, and Got the value of the key, which is
+	// empty if the key has none.
+	Want, Got string
+}
+
+func (v KeyPolicyViolation) String() string {
+	return fmt.Sprintf("%s is %q, want %s", v.Field, v.Got, v.Want)
+}
+
+// KeyPolicyError is returned by Client.AssertKeyConfiguration when a key
+// violates the policy, and by GetAEAD and GetSigner when a key lacks a label
+// required with WithRequiredKeyLabels, is in a location not allowed with
+// WithAllowedKeyLocations, or is not rotated as required with
+// WithRequiredRotationPeriod. It lists every violated constraint.
+type KeyPolicyError struct {
+	// KeyName is the resource name of the key.
+	KeyName    string
+	Violations []KeyPolicyViolation
+}
+
+func (e *KeyPolicyError) Error() string {
+	violations := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		violations[i] = v.String()
+	}
+	return fmt.Sprintf("gcpkms: key %s violates policy: %s", e.KeyName, strings.Join(violations, "; "))
+}
+
+func (e *KeyPolicyError) Is(target error) bool {
+	return target == ErrKeyPolicyViolation
+}
+
+// AssertKeyConfiguration fetches the crypto key with URI keyURI and returns
+// a *KeyPolicyError listing every constraint of want that the key violates,
+// e.g. to check at startup that a key referenced by configuration meets the
+// security policy. The protection level and algorithm are those of the
+// version template of the key, which new versions are created with.
+//
+// Errors fetching the key are returned as is.
+func (c *Client) AssertKeyConfiguration(ctx context.Context, keyURI string, want KeyPolicy) error {
+	if want.MaxRotationPeriod < 0 {
+		return fmt.Errorf("MaxRotationPeriod must not be negative, got %v", want.MaxRotationPeriod)
+	}
+	name, err := keyNameFromURI(keyURI)
+	if err != nil {
+		return err
+	}
+	if !cryptoKeyRegex.MatchString(name) {
+		return fmt.Errorf("keyURI must name a crypto key, got %q", keyURI)
+	}
+	if !c.Supported(keyURI) {
+		return errors.New("unsupported keyURI")
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return ErrClientClosed
+	}
+	if err := c.bindLocation(name); err != nil {
+		return err
+	}
+	var key *cloudkms.CryptoKey
+	err = c.invoker.call(ctx, MethodGetCryptoKey, func(ctx context.Context) error {
+		var err error
+		key, err = c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if violations := keyPolicyViolations(key, &want); len(violations) > 0 {
+		return &KeyPolicyError{KeyName: name, Violations: violations}
+	}
+	return nil
+}
+
+// checkKeyPolicy returns a *KeyPolicyError if the crypto key with the given
+// name is in a location not allowed with WithAllowedKeyLocations, lacks one
+// of the labels required with WithRequiredKeyLabels, or is a symmetric key
+// not rotated as required with WithRequiredRotationPeriod. The key is only
+// fetched for the labels, the rotation period and for
+// WithKeyLocationVerification. The outcome of checking a fetched key is
+// cached, but errors fetching the key are not.
+func (c *Client) checkKeyPolicy(ctx context.Context, name string) error {
+	if err := c.checkKeyLocation(name); err != nil {
+		return err
+	}
+	var maxRotationPeriod time.Duration
+	if !c.rotationExemptions[name] {
+		maxRotationPeriod = c.requiredRotationPeriod
+	}
+	if c.requiredKeyLabels == nil && !c.keyLocationVerification && maxRotationPeriod == 0 {
+		return nil
+	}
+	c.mu.Lock()
+	err, ok := c.keyChecks[name]
+	c.mu.Unlock()
+	if ok {
+		return err
+	}
+	var key *cloudkms.CryptoKey
+	err = c.invoker.call(ctx, MethodGetCryptoKey, func(ctx context.Context) error {
+		var err error
+		key, err = c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("gcpkms: checking the policy of %s failed: %w", name, err)
+	}
+	// Cloud KMS only rotates symmetric keys automatically.
+	if key.Purpose != "ENCRYPT_DECRYPT" {
+		maxRotationPeriod = 0
+	}
+	violations := keyPolicyViolations(key, &KeyPolicy{Labels: c.requiredKeyLabels, MaxRotationPeriod: maxRotationPeriod})
+	if c.keyLocationVerification {
+		if v, ok := c.keyLocationViolation(key.Name); !ok {
+			violations = append(violations, v)
+		}
+	}
+	err = nil
+	if len(violations) > 0 {
+		err = &KeyPolicyError{KeyName: name, Violations: violations}
+	}
+	c.mu.Lock()
+	c.keyChecks[name] = err
+	c.mu.Unlock()
+	return err
+}
+
+// checkKeyLocation returns a *KeyPolicyError if the resource with the given
+// name is in a location not allowed with WithAllowedKeyLocations.
+func (c *Client) checkKeyLocation(name string) error {
+	if v, ok := c.keyLocationViolation(name); !ok {
+		return &KeyPolicyError{KeyName: name, Violations: []KeyPolicyViolation{v}}
+	}
+	return nil
+}
+
+// keyLocationViolation returns false and the violation if the resource with
+// the given name is in a location not allowed with WithAllowedKeyLocations.
+func (c *Client) keyLocationViolation(name string) (KeyPolicyViolation, bool) {
+	if c.allowedKeyLocations == nil {
+		return KeyPolicyViolation{}, true
+	}
+	location := locationOf(name)
+	for _, l := range c.allowedKeyLocations {
+		if location == l {
+			return KeyPolicyViolation{}, true
+		}
+	}
+	allowed := make([]string, len(c.allowedKeyLocations))
+	for i, l := range c.allowedKeyLocations {
+		allowed[i] = fmt.Sprintf("%q", l)
+	}
+	return KeyPolicyViolation{Field: "Location", Want: "one of " + strings.Join(allowed, ", "), Got: location}, false
+}
+
+// keyPolicyViolations returns the constraints of want that key violates.
+func keyPolicyViolations(key *cloudkms.CryptoKey, want *KeyPolicy) []KeyPolicyViolation {
+	var violations []KeyPolicyViolation
+	check := func(field, want, got string) {
+		if want != "" && got != want {
+			violations = append(violations, KeyPolicyViolation{Field: field, Want: fmt.Sprintf("%q", want), Got: got})
+		}
+	}
+	var protectionLevel, algorithm string
+	if t := key.VersionTemplate; t != nil {
+		protectionLevel, algorithm = t.ProtectionLevel, t.Algorithm
+	}
+	check("Purpose", want.Purpose, key.Purpose)
+	check("ProtectionLevel", want.ProtectionLevel, protectionLevel)
+	check("Algorithm", want.Algorithm, algorithm)
+	if want.MaxRotationPeriod > 0 {
+		// The API encodes durations as seconds with an "s" suffix, which
+		// time.ParseDuration accepts.
+		period, err := time.ParseDuration(key.RotationPeriod)
+		if err != nil || period > want.MaxRotationPeriod {
+			violations = append(violations, KeyPolicyViolation{
+				Field: "MaxRotationPeriod",
+				Want:  fmt.Sprintf("at most %v", want.MaxRotationPeriod),
+				Got:   key.RotationPeriod,
+			})
+		}
+	}
+	labels := make([]string, 0, len(want.Labels))
+	for k := range want.Labels {
+		labels = append(labels, k)
+	}
+	sort.Strings(labels)
+	for _, k := range labels {
+		if got, ok := key.Labels[k]; !ok || got != want.Labels[k] {
+			violations = append(violations, KeyPolicyViolation{Field: fmt.Sprintf("Labels[%s]", k), Want: fmt.Sprintf("%q", want.Labels[k]), Got: got})
+		}
+	}
+	return violations
+}
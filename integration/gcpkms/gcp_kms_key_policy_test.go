@@ -0,0 +1,624 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+func TestClientAssertKeyConfiguration(t *testing.T) {
+	const day = 24 * time.Hour
+	for _, tc := range []struct {
+		name   string
+		keyURI string
+		// setup configures the keys of the fake server.
+		setup func(t *testing.T, srv *fakekms.Server)
+		want  gcpkms.KeyPolicy
+		// wantViolations is nil if the key meets the policy.
+		wantViolations []gcpkms.KeyPolicyViolation
+	}{
+		{
+			name:   "empty policy",
+			keyURI: fakeKeyURI,
+		},
+		{
+			name:   "all constraints met",
+			keyURI: fakeKeyURI,
+			setup: func(t *testing.T, srv *fakekms.Server) {
+				if err := srv.SetProtectionLevel(fakeKeyName, "HSM"); err != nil {
+					t.Fatalf("srv.SetProtectionLevel() err = %v, want nil", err)
+				}
+				if err := srv.SetRotationPeriod(fakeKeyName, "7776000s"); err != nil {
+					t.Fatalf("srv.SetRotationPeriod() err = %v, want nil", err)
+				}
+				if err := srv.SetLabels(fakeKeyName, map[string]string{"env": "prod", "team": "payments"}); err != nil {
+					t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+				}
+			},
+			want: gcpkms.KeyPolicy{
+				Purpose:           "ENCRYPT_DECRYPT",
+				ProtectionLevel:   "HSM",
+				Algorithm:         "GOOGLE_SYMMETRIC_ENCRYPTION",
+				MaxRotationPeriod: 90 * day,
+				Labels:            map[string]string{"env": "prod"},
+			},
+		},
+		{
+			name:           "purpose",
+			keyURI:         "gcp-kms://" + fakeSigningKeyName,
+			setup:          createSigningKey,
+			want:           gcpkms.KeyPolicy{Purpose: "ENCRYPT_DECRYPT"},
+			wantViolations: []gcpkms.KeyPolicyViolation{{Field: "Purpose", Want: `"ENCRYPT_DECRYPT"`, Got: "ASYMMETRIC_SIGN"}},
+		},
+		{
+			name:           "protection level",
+			keyURI:         fakeKeyURI,
+			want:           gcpkms.KeyPolicy{ProtectionLevel: "HSM"},
+			wantViolations: []gcpkms.KeyPolicyViolation{{Field: "ProtectionLevel", Want: `"HSM"`, Got: "SOFTWARE"}},
+		},
+		{
+			name:           "signing algorithm",
+			keyURI:         "gcp-kms://" + fakeSigningKeyName,
+			setup:          createSigningKey,
+			want:           gcpkms.KeyPolicy{Algorithm: "EC_SIGN_P384_SHA384"},
+			wantViolations: []gcpkms.KeyPolicyViolation{{Field: "Algorithm", Want: `"EC_SIGN_P384_SHA384"`, Got: "EC_SIGN_P256_SHA256"}},
+		},
+		{
+			name:   "rotation period too long",
+			keyURI: fakeKeyURI,
+			setup: func(t *testing.T, srv *fakekms.Server) {
+				if err := srv.SetRotationPeriod(fakeKeyName, "31536000s"); err != nil {
+					t.Fatalf("srv.SetRotationPeriod() err = %v, want nil", err)
+				}
+			},
+			want:           gcpkms.KeyPolicy{MaxRotationPeriod: 90 * day},
+			wantViolations: []gcpkms.KeyPolicyViolation{{Field: "MaxRotationPeriod", Want: "at most 2160h0m0s", Got: "31536000s"}},
+		},
+		{
+			name:           "no rotation",
+			keyURI:         fakeKeyURI,
+			want:           gcpkms.KeyPolicy{MaxRotationPeriod: 90 * day},
+			wantViolations: []gcpkms.KeyPolicyViolation{{Field: "MaxRotationPeriod", Want: "at most 2160h0m0s"}},
+		},
+		{
+			name:   "labels",
+			keyURI: fakeKeyURI,
+			setup: func(t *testing.T, srv *fakekms.Server) {
+				if err := srv.SetLabels(fakeKeyName, map[string]string{"env": "dev"}); err != nil {
+					t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+				}
+			},
+			want: gcpkms.KeyPolicy{Labels: map[string]string{"env": "prod", "team": "payments"}},
+			wantViolations: []gcpkms.KeyPolicyViolation{
+				{Field: "Labels[env]", Want: `"prod"`, Got: "dev"},
+				{Field: "Labels[team]", Want: `"payments"`},
+			},
+		},
+		{
+			name:   "all violations are listed",
+			keyURI: fakeKeyURI,
+			want: gcpkms.KeyPolicy{
+				Purpose:           "ASYMMETRIC_SIGN",
+				ProtectionLevel:   "HSM",
+				MaxRotationPeriod: 90 * day,
+			},
+			wantViolations: []gcpkms.KeyPolicyViolation{
+				{Field: "Purpose", Want: `"ASYMMETRIC_SIGN"`, Got: "ENCRYPT_DECRYPT"},
+				{Field: "ProtectionLevel", Want: `"HSM"`, Got: "SOFTWARE"},
+				{Field: "MaxRotationPeriod", Want: "at most 2160h0m0s"},
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			if tc.setup != nil {
+				tc.setup(t, srv)
+			}
+			client := newSelfTestClient(t, srv.URL(), nil)
+			err := client.AssertKeyConfiguration(context.Background(), tc.keyURI, tc.want)
+			if tc.wantViolations == nil {
+				if err != nil {
+					t.Fatalf("client.AssertKeyConfiguration() err = %v, want nil", err)
+				}
+				return
+			}
+			var policyErr *gcpkms.KeyPolicyError
+			if !errors.As(err, &policyErr) {
+				t.Fatalf("client.AssertKeyConfiguration() err = %v, want *gcpkms.KeyPolicyError", err)
+			}
+			if !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+				t.Errorf("errors.Is(%v, gcpkms.ErrKeyPolicyViolation) = false, want true", err)
+			}
+			if !reflect.DeepEqual(policyErr.Violations, tc.wantViolations) {
+				t.Errorf("policyErr.Violations = %+v, want %+v", policyErr.Violations, tc.wantViolations)
+			}
+		})
+	}
+}
+
+func createSigningKey(t *testing.T, srv *fakekms.Server) {
+	t.Helper()
+	if err := srv.CreateSigningKey(fakeSigningKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+}
+
+func TestClientAssertKeyConfigurationErrors(t *testing.T) {
+	srv := newFakeServer(t)
+	client := newSelfTestClient(t, srv.URL(), nil)
+	ctx := context.Background()
+	if err := client.AssertKeyConfiguration(ctx, fakeKeyURI+"-missing", gcpkms.KeyPolicy{}); err == nil || errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+		t.Errorf("client.AssertKeyConfiguration() of missing key err = %v, want error fetching the key", err)
+	}
+	if err := client.AssertKeyConfiguration(ctx, fakeKeyURI, gcpkms.KeyPolicy{MaxRotationPeriod: -time.Hour}); err == nil {
+		t.Error("client.AssertKeyConfiguration() with negative MaxRotationPeriod err = nil, want error")
+	}
+	if err := client.AssertKeyConfiguration(ctx, fakeKeyURI+"/cryptoKeyVersions/1", gcpkms.KeyPolicy{}); err == nil {
+		t.Error("client.AssertKeyConfiguration() of key version err = nil, want error")
+	}
+}
+
+// newRequiredLabelsClient returns a client for srv that requires the labels
+// env=prod and data-class=pii, and sends its requests through base, if not
+// nil.
+func newRequiredLabelsClient(t *testing.T, srv *fakekms.Server, base http.RoundTripper) *gcpkms.Client {
+	t.Helper()
+	opts := []gcpkms.Option{
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithoutPrimitiveCache(),
+		gcpkms.WithRequiredKeyLabels(map[string]string{"env": "prod", "data-class": "pii"}),
+	}
+	if base != nil {
+		opts = append(opts, gcpkms.WithBaseTransport(base))
+	}
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://", opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestWithRequiredKeyLabels(t *testing.T) {
+	srv := newFakeServer(t)
+	createSigningKey(t, srv)
+	labels := map[string]string{"env": "prod", "data-class": "pii", "team": "payments"}
+	for _, name := range []string{fakeKeyName, fakeSigningKeyName} {
+		if err := srv.SetLabels(name, labels); err != nil {
+			t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+		}
+	}
+	client := newRequiredLabelsClient(t, srv, nil)
+	for i := 0; i < 2; i++ {
+		a, err := client.GetAEAD(fakeKeyURI)
+		if err != nil {
+			t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+		}
+		if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+		s, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1))
+		if err != nil {
+			t.Fatalf("client.GetSigner() err = %v, want nil", err)
+		}
+		digest := sha256.Sum256([]byte("data"))
+		if _, err := s.Sign(nil, digest[:], s.SignerOpts()); err != nil {
+			t.Fatalf("s.Sign() err = %v, want nil", err)
+		}
+	}
+	// The labels of each key are only fetched once.
+	if got := srv.CallCount("GetCryptoKey"); got != 2 {
+		t.Errorf("GetCryptoKey called %d times, want 2", got)
+	}
+}
+
+func TestWithRequiredKeyLabelsRejectsKeys(t *testing.T) {
+	srv := newFakeServer(t)
+	createSigningKey(t, srv)
+	for _, name := range []string{fakeKeyName, fakeSigningKeyName} {
+		if err := srv.SetLabels(name, map[string]string{"env": "dev"}); err != nil {
+			t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+		}
+	}
+	client := newRequiredLabelsClient(t, srv, nil)
+	wantViolations := []gcpkms.KeyPolicyViolation{
+		{Field: "Labels[data-class]", Want: `"pii"`, Got: ""},
+		{Field: "Labels[env]", Want: `"prod"`, Got: "dev"},
+	}
+	checkErr := func(t *testing.T, err error, keyName string) {
+		t.Helper()
+		var policyErr *gcpkms.KeyPolicyError
+		if !errors.As(err, &policyErr) {
+			t.Fatalf("err = %v, want *gcpkms.KeyPolicyError", err)
+		}
+		if !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+			t.Errorf("errors.Is(%v, gcpkms.ErrKeyPolicyViolation) = false, want true", err)
+		}
+		if policyErr.KeyName != keyName {
+			t.Errorf("policyErr.KeyName = %q, want %q", policyErr.KeyName, keyName)
+		}
+		if !reflect.DeepEqual(policyErr.Violations, wantViolations) {
+			t.Errorf("policyErr.Violations = %+v, want %+v", policyErr.Violations, wantViolations)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		_, err := client.GetAEAD(fakeKeyURI)
+		checkErr(t, err, fakeKeyName)
+		_, err = client.GetSigner(context.Background(), "gcp-kms://"+versionName(1))
+		checkErr(t, err, fakeSigningKeyName)
+	}
+	if got := srv.CallCount("GetCryptoKey"); got != 2 {
+		t.Errorf("GetCryptoKey called %d times, want 2", got)
+	}
+	if got := srv.CallCount("GetPublicKey"); got != 0 {
+		t.Errorf("GetPublicKey called %d times, want 0", got)
+	}
+}
+
+// denyGetCryptoKeyTransport rejects GetCryptoKey requests with
+// PERMISSION_DENIED and sends all other requests to Cloud KMS.
+type denyGetCryptoKeyTransport struct{}
+
+func (denyGetCryptoKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || strings.Contains(req.URL.Path, ":") || strings.Contains(req.URL.Path, "/cryptoKeyVersions/") {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	body := `{"error": {"code": 403, "status": "PERMISSION_DENIED", "message": "Permission 'cloudkms.cryptoKeys.get' denied."}}`
+	return &http.Response{
+		StatusCode: http.StatusForbidden,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func TestWithRequiredKeyLabelsPermissionDenied(t *testing.T) {
+	srv := newFakeServer(t)
+	if err := srv.SetLabels(fakeKeyName, map[string]string{"env": "prod", "data-class": "pii"}); err != nil {
+		t.Fatalf("srv.SetLabels() err = %v, want nil", err)
+	}
+	client := newRequiredLabelsClient(t, srv, denyGetCryptoKeyTransport{})
+	_, err := client.GetAEAD(fakeKeyURI)
+	if err == nil {
+		t.Fatal("client.GetAEAD() err = nil, want error")
+	}
+	if errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+		t.Errorf("client.GetAEAD() err = %v, want an error fetching the key", err)
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		t.Errorf("client.GetAEAD() err = %v, want a *googleapi.Error with code %d", err, http.StatusForbidden)
+	}
+	if got := srv.CallCount("Encrypt"); got != 0 {
+		t.Errorf("Encrypt called %d times, want 0", got)
+	}
+}
+
+func TestWithRequiredKeyLabelsRejectsInvalidLabels(t *testing.T) {
+	for _, labels := range []map[string]string{nil, {}, {"": "prod"}} {
+		if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithRequiredKeyLabels(labels)); err == nil {
+			t.Errorf("gcpkms.NewClient() with WithRequiredKeyLabels(%v) err = nil, want error", labels)
+		}
+	}
+}
+
+// newKeyPolicyClient returns a client for srv with the given options
+// that sends its requests through base, if not nil.
+func newKeyPolicyClient(t *testing.T, srv *fakekms.Server, base http.RoundTripper, opts ...gcpkms.Option) *gcpkms.Client {
+	t.Helper()
+	opts = append([]gcpkms.Option{
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithoutPrimitiveCache(),
+	}, opts...)
+	if base != nil {
+		opts = append(opts, gcpkms.WithBaseTransport(base))
+	}
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://", opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestWithAllowedKeyLocations(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		location string
+		allowed  []string
+		wantErr  bool
+	}{
+		{name: "allowed region", location: "europe-west1", allowed: []string{"europe-west1", "europe-west3"}},
+		{name: "allowed multi-region", location: "europe", allowed: []string{"europe"}},
+		{name: "allowed global", location: "global", allowed: []string{"global", "europe"}},
+		{name: "disallowed region", location: "us-east1", allowed: []string{"europe-west1"}, wantErr: true},
+		{name: "region of allowed multi-region", location: "europe-west1", allowed: []string{"europe"}, wantErr: true},
+		{name: "multi-region of allowed regions", location: "europe", allowed: []string{"europe-west1", "europe-west3"}, wantErr: true},
+		{name: "disallowed global", location: "global", allowed: []string{"europe", "europe-west1"}, wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			keyName := "projects/p/locations/" + tc.location + "/keyRings/r/cryptoKeys/residency"
+			if err := srv.CreateKey(keyName); err != nil {
+				t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+			}
+			client := newKeyPolicyClient(t, srv, nil, gcpkms.WithAllowedKeyLocations(tc.allowed...))
+
+			a, err := client.GetAEAD("gcp-kms://" + keyName)
+			if !tc.wantErr {
+				if err != nil {
+					t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+				}
+				if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+					t.Fatalf("a.Encrypt() err = %v, want nil", err)
+				}
+				return
+			}
+			var policyErr *gcpkms.KeyPolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+				t.Fatalf("client.GetAEAD() err = %v, want *gcpkms.KeyPolicyError", err)
+			}
+			if policyErr.KeyName != keyName {
+				t.Errorf("policyErr.KeyName = %q, want %q", policyErr.KeyName, keyName)
+			}
+			if len(policyErr.Violations) != 1 || policyErr.Violations[0].Field != "Location" || policyErr.Violations[0].Got != tc.location {
+				t.Errorf("policyErr.Violations = %+v, want a violation of Location by %q", policyErr.Violations, tc.location)
+			}
+			if want := `Location is "` + tc.location + `"`; !strings.Contains(err.Error(), want) {
+				t.Errorf("client.GetAEAD() err = %q, want it to contain %q", err, want)
+			}
+			// The location is checked without contacting Cloud KMS.
+			if got := srv.CallCount("GetCryptoKey"); got != 0 {
+				t.Errorf("GetCryptoKey called %d times, want 0", got)
+			}
+		})
+	}
+}
+
+func TestWithAllowedKeyLocationsSigner(t *testing.T) {
+	srv := newFakeServer(t)
+	createSigningKey(t, srv)
+	client := newKeyPolicyClient(t, srv, nil, gcpkms.WithAllowedKeyLocations("global"))
+	s, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1))
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	if _, err := s.Sign(nil, digest[:], s.SignerOpts()); err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+
+	client = newKeyPolicyClient(t, srv, nil, gcpkms.WithAllowedKeyLocations("europe-west1"))
+	if _, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1)); !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+		t.Errorf("client.GetSigner() err = %v, want %v", err, gcpkms.ErrKeyPolicyViolation)
+	}
+	if got := srv.CallCount("GetPublicKey"); got != 1 {
+		t.Errorf("GetPublicKey called %d times, want 1", got)
+	}
+}
+
+func TestWithAllowedKeyLocationsKeyHandle(t *testing.T) {
+	srv := newFakeServer(t)
+	// A key handle whose crypto key is in another location is rejected once
+	// it is resolved.
+	const euKeyHandleName = "projects/p/locations/europe-west1/keyHandles/h"
+	srv.CreateKeyHandle(euKeyHandleName, fakeKeyName)
+	client := newKeyPolicyClient(t, srv, nil, gcpkms.WithAllowedKeyLocations("europe-west1"))
+	_, err := client.GetAEAD("gcp-kms://" + euKeyHandleName)
+	var policyErr *gcpkms.KeyPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("client.GetAEAD() err = %v, want *gcpkms.KeyPolicyError", err)
+	}
+	if policyErr.KeyName != fakeKeyName {
+		t.Errorf("policyErr.KeyName = %q, want %q", policyErr.KeyName, fakeKeyName)
+	}
+
+	client = newKeyPolicyClient(t, srv, nil, gcpkms.WithAllowedKeyLocations("global"))
+	if _, err := client.GetAEAD("gcp-kms://" + euKeyHandleName); !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+		t.Errorf("client.GetAEAD() err = %v, want %v", err, gcpkms.ErrKeyPolicyViolation)
+	}
+}
+
+// relocatingTransport rewrites the location of the crypto keys returned by
+// GetCryptoKey to location, like an endpoint that serves keys from another
+// location than that of their names.
+type relocatingTransport struct {
+	location string
+}
+
+func (t relocatingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || strings.Contains(req.URL.Path, ":") || strings.Contains(req.URL.Path, "/cryptoKeyVersions/") {
+		return resp, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	body = []byte(strings.ReplaceAll(string(body), "/locations/global/", "/locations/"+t.location+"/"))
+	resp.Body = io.NopCloser(strings.NewReader(string(body)))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Del("Content-Length")
+	return resp, nil
+}
+
+func TestWithKeyLocationVerification(t *testing.T) {
+	srv := newFakeServer(t)
+	client := newKeyPolicyClient(t, srv, nil, gcpkms.WithAllowedKeyLocations("global"), gcpkms.WithKeyLocationVerification())
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetAEAD(fakeKeyURI); err != nil {
+			t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+		}
+	}
+	// The key is only fetched once.
+	if got := srv.CallCount("GetCryptoKey"); got != 1 {
+		t.Errorf("GetCryptoKey called %d times, want 1", got)
+	}
+
+	client = newKeyPolicyClient(t, srv, relocatingTransport{location: "us-east1"},
+		gcpkms.WithAllowedKeyLocations("global"), gcpkms.WithKeyLocationVerification())
+	_, err := client.GetAEAD(fakeKeyURI)
+	var policyErr *gcpkms.KeyPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("client.GetAEAD() err = %v, want *gcpkms.KeyPolicyError", err)
+	}
+	want := []gcpkms.KeyPolicyViolation{{Field: "Location", Want: `one of "global"`, Got: "us-east1"}}
+	if !reflect.DeepEqual(policyErr.Violations, want) {
+		t.Errorf("policyErr.Violations = %+v, want %+v", policyErr.Violations, want)
+	}
+	if got := srv.CallCount("Encrypt"); got != 0 {
+		t.Errorf("Encrypt called %d times, want 0", got)
+	}
+}
+
+func TestWithAllowedKeyLocationsRejectsInvalidLocations(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "no locations", opts: []gcpkms.Option{gcpkms.WithAllowedKeyLocations()}},
+		{name: "empty location", opts: []gcpkms.Option{gcpkms.WithAllowedKeyLocations("europe", "")}},
+		{name: "location name", opts: []gcpkms.Option{gcpkms.WithAllowedKeyLocations("projects/p/locations/europe")}},
+		{name: "verification without locations", opts: []gcpkms.Option{gcpkms.WithKeyLocationVerification()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, tc.opts...); err == nil {
+				t.Error("gcpkms.NewClient() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestWithRequiredRotationPeriod(t *testing.T) {
+	const day = 24 * time.Hour
+	const exemptKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/legacy"
+	for _, tc := range []struct {
+		name           string
+		keyName        string
+		rotationPeriod string
+		wantViolations []gcpkms.KeyPolicyViolation
+	}{
+		{name: "compliant", keyName: fakeKeyName, rotationPeriod: "2592000s"},
+		{name: "at maximum", keyName: fakeKeyName, rotationPeriod: "7776000s"},
+		{
+			name:           "no rotation",
+			keyName:        fakeKeyName,
+			wantViolations: []gcpkms.KeyPolicyViolation{{Field: "MaxRotationPeriod", Want: "at most 2160h0m0s"}},
+		},
+		{
+			name:           "too long",
+			keyName:        fakeKeyName,
+			rotationPeriod: "31536000s",
+			wantViolations: []gcpkms.KeyPolicyViolation{{Field: "MaxRotationPeriod", Want: "at most 2160h0m0s", Got: "31536000s"}},
+		},
+		{name: "exempted without rotation", keyName: exemptKeyName},
+		{name: "exempted too long", keyName: exemptKeyName, rotationPeriod: "31536000s"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			if tc.keyName != fakeKeyName {
+				if err := srv.CreateKey(tc.keyName); err != nil {
+					t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+				}
+			}
+			if tc.rotationPeriod != "" {
+				if err := srv.SetRotationPeriod(tc.keyName, tc.rotationPeriod); err != nil {
+					t.Fatalf("srv.SetRotationPeriod() err = %v, want nil", err)
+				}
+			}
+			client := newKeyPolicyClient(t, srv, nil,
+				gcpkms.WithRequiredRotationPeriod(90*day), gcpkms.WithRotationPolicyExemptions("gcp-kms://"+exemptKeyName))
+
+			a, err := client.GetAEAD("gcp-kms://" + tc.keyName)
+			if tc.wantViolations == nil {
+				if err != nil {
+					t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+				}
+				if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+					t.Fatalf("a.Encrypt() err = %v, want nil", err)
+				}
+				return
+			}
+			var policyErr *gcpkms.KeyPolicyError
+			if !errors.As(err, &policyErr) || !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+				t.Fatalf("client.GetAEAD() err = %v, want *gcpkms.KeyPolicyError", err)
+			}
+			if !reflect.DeepEqual(policyErr.Violations, tc.wantViolations) {
+				t.Errorf("policyErr.Violations = %+v, want %+v", policyErr.Violations, tc.wantViolations)
+			}
+			if want := fmt.Sprintf("MaxRotationPeriod is %q", tc.rotationPeriod); !strings.Contains(err.Error(), want) {
+				t.Errorf("client.GetAEAD() err = %q, want it to contain %q", err, want)
+			}
+		})
+	}
+}
+
+func TestWithRequiredRotationPeriodFetchesOnce(t *testing.T) {
+	srv := newFakeServer(t)
+	createSigningKey(t, srv)
+	client := newKeyPolicyClient(t, srv, nil, gcpkms.WithRequiredRotationPeriod(time.Hour))
+	for i := 0; i < 2; i++ {
+		if _, err := client.GetAEAD(fakeKeyURI); !errors.Is(err, gcpkms.ErrKeyPolicyViolation) {
+			t.Fatalf("client.GetAEAD() err = %v, want %v", err, gcpkms.ErrKeyPolicyViolation)
+		}
+		// Signing keys are not rotated automatically, so they are not checked.
+		if _, err := client.GetSigner(context.Background(), "gcp-kms://"+versionName(1)); err != nil {
+			t.Fatalf("client.GetSigner() err = %v, want nil", err)
+		}
+	}
+	if got := srv.CallCount("GetCryptoKey"); got != 2 {
+		t.Errorf("GetCryptoKey called %d times, want 2", got)
+	}
+}
+
+func TestWithRequiredRotationPeriodRejectsInvalidOptions(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "zero period", opts: []gcpkms.Option{gcpkms.WithRequiredRotationPeriod(0)}},
+		{name: "negative period", opts: []gcpkms.Option{gcpkms.WithRequiredRotationPeriod(-time.Hour)}},
+		{name: "exemptions without period", opts: []gcpkms.Option{gcpkms.WithRotationPolicyExemptions(fakeKeyURI)}},
+		{name: "no exemptions", opts: []gcpkms.Option{gcpkms.WithRequiredRotationPeriod(time.Hour), gcpkms.WithRotationPolicyExemptions()}},
+		{name: "exempted key version", opts: []gcpkms.Option{
+			gcpkms.WithRequiredRotationPeriod(time.Hour), gcpkms.WithRotationPolicyExemptions(fakeKeyURI + "/cryptoKeyVersions/1"),
+		}},
+		{name: "exempted key of another scheme", opts: []gcpkms.Option{
+			gcpkms.WithRequiredRotationPeriod(time.Hour), gcpkms.WithRotationPolicyExemptions("aws-kms://arn:aws:kms:us-east-1:1:key/k"),
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, tc.opts...); err == nil {
+				t.Error("gcpkms.NewClient() err = nil, want error")
+			}
+		})
+	}
+}
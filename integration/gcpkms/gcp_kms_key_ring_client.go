@@ -0,0 +1,190 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+var (
+	keyRingRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+$`)
+	// relativeKeyRegex matches the IDs of crypto keys, which Cloud KMS
+	// restricts to these characters.
+	relativeKeyRegex        = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,63}$`)
+	relativeKeyVersionRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,63}/cryptoKeyVersions/[0-9]+$`)
+)
+
+// KeyRingClient is a Client for the keys of one key ring, whose methods also
+// accept key names relative to the key ring, e.g. "my-key" for an AEAD or
+// "my-key/cryptoKeyVersions/2" for a signer. Fully qualified key URIs, e.g.
+// 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/my-key', are
+// accepted too.
+type KeyRingClient struct {
+	client *Client
+	// keyRingURI is the canonical URI of the key ring.
+	keyRingURI string
+}
+
+var _ registry.KMSClient = (*KeyRingClient)(nil)
+
+// NewKeyRingClient returns a client for the keys of the key ring with URI
+// keyRingURI, e.g. 'gcp-kms://projects/p/locations/l/keyRings/r'. opts
+// configure the underlying Client like those of NewClient, whose uriPrefix
+// is keyRingURI.
+func NewKeyRingClient(ctx context.Context, keyRingURI string, opts ...Option) (*KeyRingClient, error) {
+	canonical, err := canonicalKeyURI(keyRingURI)
+	if err != nil {
+		return nil, err
+	}
+	if !keyRingRegex.MatchString(canonical[len(gcpPrefix):]) {
+		return nil, fmt.Errorf("invalid key ring URI %q, want %sprojects/*/locations/*/keyRings/*", keyRingURI, gcpPrefix)
+	}
+	client, err := NewClient(ctx, canonical, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyRingClient{client: client, keyRingURI: canonical}, nil
+}
+
+// Client returns the underlying client, e.g. to read its metrics.
+func (k *KeyRingClient) Client() *Client {
+	return k.client
+}
+
+// keyURI returns the key URI of name, which is either a key URI, returned as
+// is, or a name relative to the key ring that matches relative.
+func (k *KeyRingClient) keyURI(name string, relative *regexp.Regexp) (string, error) {
+	if strings.HasPrefix(strings.ToLower(name), gcpPrefix) {
+		return name, nil
+	}
+	if !relative.MatchString(name) {
+		return "", fmt.Errorf("invalid key name %q: want a key URI starting with %s, or a name relative to %s matching %s", name, gcpPrefix, k.keyRingURI, relative)
+	}
+	return k.keyRingURI + "/cryptoKeys/" + name, nil
+}
+
+// Supported returns true if name is a crypto key relative to the key ring, or
+// a key URI supported by the underlying client.
+func (k *KeyRingClient) Supported(name string) bool {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	return err == nil && k.client.Supported(uri)
+}
+
+// GetAEAD is like Client.GetAEAD, for the crypto key with the given name.
+func (k *KeyRingClient) GetAEAD(name string) (tink.AEAD, error) {
+	return k.GetAEADWithContext(context.Background(), name)
+}
+
+// GetAEADWithContext is like Client.GetAEADWithContext, for the crypto key
+// with the given name.
+func (k *KeyRingClient) GetAEADWithContext(ctx context.Context, name string) (tink.AEAD, error) {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return nil, err
+	}
+	return k.client.GetAEADWithContext(ctx, uri)
+}
+
+// GetEncryptOnlyAEAD is like Client.GetEncryptOnlyAEAD, for the crypto key
+// with the given name.
+func (k *KeyRingClient) GetEncryptOnlyAEAD(name string) (tink.AEAD, error) {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return nil, err
+	}
+	return k.client.GetEncryptOnlyAEAD(uri)
+}
+
+// GetDecryptOnlyAEAD is like Client.GetDecryptOnlyAEAD, for the crypto key
+// with the given name.
+func (k *KeyRingClient) GetDecryptOnlyAEAD(name string) (tink.AEAD, error) {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return nil, err
+	}
+	return k.client.GetDecryptOnlyAEAD(uri)
+}
+
+// GetSigner is like Client.GetSigner, for the key version with the given
+// name, e.g. "my-key/cryptoKeyVersions/2".
+func (k *KeyRingClient) GetSigner(ctx context.Context, name string, opts ...MultiSignerOption) (*Signer, error) {
+	uri, err := k.keyURI(name, relativeKeyVersionRegex)
+	if err != nil {
+		return nil, err
+	}
+	return k.client.GetSigner(ctx, uri, opts...)
+}
+
+// GetMultiVersionVerifier is like Client.GetMultiVersionVerifier, for the
+// crypto key with the given name.
+func (k *KeyRingClient) GetMultiVersionVerifier(ctx context.Context, name string, opts ...VerifierOption) (*MultiVersionVerifier, error) {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return nil, err
+	}
+	return k.client.GetMultiVersionVerifier(ctx, uri, opts...)
+}
+
+// KeyExists is like Client.KeyExists, for the crypto key with the given
+// name.
+func (k *KeyRingClient) KeyExists(ctx context.Context, name string) (bool, error) {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return false, err
+	}
+	return k.client.KeyExists(ctx, uri)
+}
+
+// AssertKeyConfiguration is like Client.AssertKeyConfiguration, for the
+// crypto key with the given name.
+func (k *KeyRingClient) AssertKeyConfiguration(ctx context.Context, name string, want KeyPolicy) error {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return err
+	}
+	return k.client.AssertKeyConfiguration(ctx, uri, want)
+}
+
+// SelfTest is like Client.SelfTest, for the crypto key with the given name.
+func (k *KeyRingClient) SelfTest(ctx context.Context, name string) error {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return err
+	}
+	return k.client.SelfTest(ctx, uri)
+}
+
+// WatchKey is like Client.WatchKey, for the crypto key with the given name.
+func (k *KeyRingClient) WatchKey(ctx context.Context, name string, interval time.Duration, fn func(KeyEvent)) (stop func(), err error) {
+	uri, err := k.keyURI(name, relativeKeyRegex)
+	if err != nil {
+		return nil, err
+	}
+	return k.client.WatchKey(ctx, uri, interval, fn)
+}
+
+// Close closes the underlying client, see Client.Close.
+func (k *KeyRingClient) Close() error {
+	return k.client.Close()
+}
@@ -0,0 +1,141 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const fakeKeyRingURI = "gcp-kms://projects/p/locations/global/keyRings/r"
+
+func newFakeKeyRingClient(t *testing.T) (*fakekms.Server, *gcpkms.KeyRingClient) {
+	t.Helper()
+	srv := newFakeServer(t)
+	if err := srv.CreateSigningKey("projects/p/locations/global/keyRings/r/cryptoKeys/signing", "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	client, err := gcpkms.NewKeyRingClient(context.Background(), fakeKeyRingURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewKeyRingClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return srv, client
+}
+
+func TestKeyRingClientResolvesRelativeNames(t *testing.T) {
+	_, client := newFakeKeyRingClient(t)
+	relative, err := client.GetAEAD("k")
+	if err != nil {
+		t.Fatalf("client.GetAEAD(%q) err = %v, want nil", "k", err)
+	}
+	absolute, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD(%q) err = %v, want nil", fakeKeyURI, err)
+	}
+	ciphertext, err := relative.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("relative.Encrypt() err = %v, want nil", err)
+	}
+	plaintext, err := absolute.Decrypt(ciphertext, nil)
+	if err != nil {
+		t.Fatalf("absolute.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(plaintext, []byte("plaintext")) {
+		t.Errorf("absolute.Decrypt() = %q, want %q", plaintext, "plaintext")
+	}
+
+	s, err := client.GetSigner(context.Background(), "signing/cryptoKeyVersions/1")
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	sig, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+	if !ecdsa.VerifyASN1(s.Public().(*ecdsa.PublicKey), digest[:], sig) {
+		t.Error("signature of relative signer does not verify")
+	}
+	v, err := client.GetMultiVersionVerifier(context.Background(), "signing")
+	if err != nil {
+		t.Fatalf("client.GetMultiVersionVerifier() err = %v, want nil", err)
+	}
+	if err := v.Verify(sig, []byte("data")); err != nil {
+		t.Errorf("v.Verify() err = %v, want nil", err)
+	}
+	if ok, err := client.KeyExists(context.Background(), "k"); err != nil || !ok {
+		t.Errorf("client.KeyExists() = %v, %v, want true, nil", ok, err)
+	}
+}
+
+func TestKeyRingClientRejectsMalformedNames(t *testing.T) {
+	_, client := newFakeKeyRingClient(t)
+	for _, name := range []string{
+		"",
+		"cryptoKeys/k",
+		"k/cryptoKeyVersions/1",
+		"k/",
+		"../k",
+		"k k",
+		"projects/p/locations/global/keyRings/r/cryptoKeys/k",
+		"gcp-kms://projects/p/locations/global/keyRings/other/cryptoKeys/k",
+	} {
+		if client.Supported(name) {
+			t.Errorf("client.Supported(%q) = true, want false", name)
+		}
+		if _, err := client.GetAEAD(name); err == nil {
+			t.Errorf("client.GetAEAD(%q) err = nil, want error", name)
+		}
+	}
+	for _, name := range []string{
+		"signing",
+		"signing/cryptoKeyVersions/",
+		"signing/cryptoKeyVersions/x",
+		"signing/cryptoKeyVersions/1/other",
+		"other/signing/cryptoKeyVersions/1",
+	} {
+		if _, err := client.GetSigner(context.Background(), name); err == nil {
+			t.Errorf("client.GetSigner(%q) err = nil, want error", name)
+		}
+	}
+	if !client.Supported("k") || !client.Supported(fakeKeyURI) {
+		t.Error("client.Supported() = false for key in key ring, want true")
+	}
+}
+
+func TestNewKeyRingClientRejectsOtherResources(t *testing.T) {
+	for _, uri := range []string{
+		"gcp-kms://",
+		"gcp-kms://projects/p/locations/global",
+		fakeKeyURI,
+		"projects/p/locations/global/keyRings/r",
+	} {
+		if _, err := gcpkms.NewKeyRingClient(context.Background(), uri, gcpkms.WithInsecureTransport()); err == nil {
+			t.Errorf("gcpkms.NewKeyRingClient(%q) err = nil, want error", uri)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/tink-crypto/tink-go/v2/aead"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+// keyNameFromURI returns the crypto key or Autokey key handle named by
+// keyURI, which must have the format 'gcp-kms://projects/*/locations/*/keyRings/*/cryptoKeys/*'
+// or 'gcp-kms://projects/*/locations/*/keyHandles/*'. keyURI is
+// canonicalized first, see canonicalKeyURI.
+func keyNameFromURI(keyURI string) (string, error) {
+	canonical, err := canonicalKeyURI(keyURI)
+	if err != nil {
+		return "", err
+	}
+	name := canonical[len(gcpPrefix):]
+	if !cryptoKeyRegex.MatchString(name) && !isKeyHandle(name) {
+		return "", fmt.Errorf("keyURI must name a crypto key or a key handle, got %q", keyURI)
+	}
+	return name, nil
+}
+
+// CreateKMSEnvelopeAEADKeyTemplate returns a key template for envelope
+// encryption with DEKs generated from dekTemplate and wrapped by the Cloud
+// KMS key with URI keyURI. dekTemplate must be a Tink AEAD key template.
+//
+// Handles created from the template with keyset.NewHandle hold no key
+// material, only a reference to the KMS key. Getting their primitive requires
+// a Client supporting keyURI to be registered with registry.RegisterKMSClient.
+func CreateKMSEnvelopeAEADKeyTemplate(keyURI string, dekTemplate *tinkpb.KeyTemplate) (*tinkpb.KeyTemplate, error) {
+	if _, err := keyNameFromURI(keyURI); err != nil {
+		return nil, err
+	}
+	if dekTemplate == nil {
+		return nil, errors.New("dekTemplate must not be nil")
+	}
+	return aead.CreateKMSEnvelopeAEADKeyTemplate(keyURI, dekTemplate)
+}
@@ -0,0 +1,91 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/mac"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+func TestKMSEnvelopeAEADKeyTemplate(t *testing.T) {
+	srv := newFakeServer(t)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	registry.RegisterKMSClient(client)
+	t.Cleanup(registry.ClearKMSClients)
+
+	template, err := gcpkms.CreateKMSEnvelopeAEADKeyTemplate(fakeKeyURI, aead.AES256GCMKeyTemplate())
+	if err != nil {
+		t.Fatalf("gcpkms.CreateKMSEnvelopeAEADKeyTemplate() err = %v, want nil", err)
+	}
+	if template.GetOutputPrefixType() != tinkpb.OutputPrefixType_RAW {
+		t.Errorf("template.GetOutputPrefixType() = %v, want %v", template.GetOutputPrefixType(), tinkpb.OutputPrefixType_RAW)
+	}
+	handle, err := keyset.NewHandle(template)
+	if err != nil {
+		t.Fatalf("keyset.NewHandle() err = %v, want nil", err)
+	}
+	a, err := aead.New(handle)
+	if err != nil {
+		t.Fatalf("aead.New() err = %v, want nil", err)
+	}
+	plaintext, associatedData := []byte("plaintext"), []byte("associated data")
+	ciphertext, err := a.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	got, err := a.Decrypt(ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("a.Decrypt() = %q, want %q", got, plaintext)
+	}
+	if srv.CallCount("Encrypt") != 1 || srv.CallCount("Decrypt") != 1 {
+		t.Errorf("Encrypt and Decrypt calls = %d and %d, want 1 and 1", srv.CallCount("Encrypt"), srv.CallCount("Decrypt"))
+	}
+}
+
+func TestKMSEnvelopeAEADKeyTemplateRejectsInvalidInput(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		keyURI      string
+		dekTemplate *tinkpb.KeyTemplate
+	}{
+		{name: "wrong prefix", keyURI: "aws-kms://" + fakeKeyName, dekTemplate: aead.AES256GCMKeyTemplate()},
+		{name: "key ring", keyURI: "gcp-kms://projects/p/locations/global/keyRings/r", dekTemplate: aead.AES256GCMKeyTemplate()},
+		{name: "key version", keyURI: fakeKeyURI + "/cryptoKeyVersions/1", dekTemplate: aead.AES256GCMKeyTemplate()},
+		{name: "nil DEK template", keyURI: fakeKeyURI},
+		{name: "non-AEAD DEK template", keyURI: fakeKeyURI, dekTemplate: mac.HMACSHA256Tag256KeyTemplate()},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.CreateKMSEnvelopeAEADKeyTemplate(tc.keyURI, tc.dekTemplate); err == nil {
+				t.Error("gcpkms.CreateKMSEnvelopeAEADKeyTemplate() err = nil, want error")
+			}
+		})
+	}
+}
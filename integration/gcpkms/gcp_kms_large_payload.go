@@ -0,0 +1,166 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+const (
+	// maxKMSPlaintextSize is the size of the largest plaintext that Cloud KMS
+	// encrypts.
+	maxKMSPlaintextSize = 64 * 1024
+	// largePayloadMagic starts every envelope ciphertext of an AEAD with
+	// WithLargePayloadEnvelope.
+	largePayloadMagic = "GLPE"
+	// largePayloadVersion is the version of the envelope ciphertext format,
+	// which follows the magic bytes.
+	largePayloadVersion byte = 1
+)
+
+// largePayloadHeader is the header of envelope ciphertexts.
+var largePayloadHeader = []byte(largePayloadMagic + string(largePayloadVersion))
+
+// largePayloadKEK is the KEK of the envelope encryption of a large payload.
+// It encrypts and decrypts the DEK with Cloud KMS directly, with the requests
+// bound to ctx, and records the metadata reported by Cloud KMS.
+type largePayloadKEK struct {
+	a         *AEAD
+	ctx       context.Context
+	checksums bool
+	// called is true once Encrypt or Decrypt was called.
+	called    bool
+	encrypted EncryptResult
+	decrypted DecryptResult
+}
+
+var _ tink.AEAD = (*largePayloadKEK)(nil)
+
+func (k *largePayloadKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	k.called = true
+	res, _, err := k.a.encrypt(k.ctx, nil, plaintext, associatedData, k.checksums)
+	if err != nil {
+		return nil, err
+	}
+	k.encrypted = res
+	return res.Ciphertext, nil
+}
+
+func (k *largePayloadKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	k.called = true
+	res, err := k.a.decryptPooled(k.ctx, nil, ciphertext, k.a.boundAssociatedData(associatedData))
+	if err != nil {
+		if deks := k.a.deks; deks != nil {
+			if isUnreachable(err) {
+				if dek, level, ok := deks.unwrapOffline(k.a.keyURI, ciphertext); ok {
+					deks.logOffline(k.a.invoker.logger, k.a.keyURI, err)
+					k.decrypted = DecryptResult{ProtectionLevel: level, Offline: true}
+					return dek, nil
+				}
+			} else if isRejection(err) {
+				deks.forget(k.a.keyURI, ciphertext)
+			}
+		}
+		return nil, err
+	}
+	k.decrypted = res
+	if k.a.deks != nil {
+		if !res.UsedPrimary {
+			// The DEK was encrypted by a version that is no longer primary,
+			// so it must not encrypt more plaintexts if it is cached.
+			k.a.deks.observeNotPrimary(k.a.keyURI, ciphertext)
+		}
+		k.a.deks.remember(k.a.keyURI, ciphertext, res.Plaintext, res.ProtectionLevel)
+	}
+	return res.Plaintext, nil
+}
+
+// seal encrypts plaintext like encrypt, but with envelope encryption if
+// WithLargePayloadEnvelope is used and plaintext is too large for Cloud KMS.
+// With WithDEKCache, envelope encryption uses the cached DEK of the key.
+// Inputs are copied first as documented in WithInputCopying.
+func (a *AEAD) seal(ctx context.Context, dst, plaintext, associatedData []byte, checksums bool) (EncryptResult, int64, error) {
+	envelope := a.largePayloadDEK != nil && len(plaintext) > maxKMSPlaintextSize
+	if a.copyInputs || envelope {
+		// The caller may modify its buffers before the payload is encrypted
+		// with the DEK, which only happens once Cloud KMS has encrypted the
+		// DEK, so the payload is computed from private copies. Requests to
+		// Cloud KMS need no copy, as they are encoded before they are first
+		// sent, and resent as is.
+		plaintext, associatedData = clone(plaintext), clone(associatedData)
+		defer zero(plaintext)
+	}
+	if !envelope {
+		return a.encrypt(ctx, dst, plaintext, associatedData, checksums)
+	}
+	var payload []byte
+	var res EncryptResult
+	if a.deks != nil {
+		var err error
+		payload, res, err = a.sealWithCachedDEK(ctx, plaintext, headerAssociatedData(largePayloadHeader, associatedData), checksums)
+		if err != nil {
+			return EncryptResult{}, 0, err
+		}
+	} else {
+		kek := &largePayloadKEK{a: a, ctx: ctx, checksums: checksums}
+		var err error
+		payload, err = aead.NewKMSEnvelopeAEAD2(a.largePayloadDEK, kek).Encrypt(plaintext, headerAssociatedData(largePayloadHeader, associatedData))
+		if err != nil {
+			return EncryptResult{}, 0, err
+		}
+		res = kek.encrypted
+	}
+	ciphertext := append(append(dst, largePayloadHeader...), payload...)
+	var crc32c int64
+	if checksums {
+		// Only the encrypted DEK comes from Cloud KMS, so the checksum of the
+		// ciphertext is computed locally.
+		crc32c = ComputeCRC32C(ciphertext[len(dst):])
+	}
+	return EncryptResult{
+		Ciphertext:      ciphertext,
+		KeyVersion:      res.KeyVersion,
+		ProtectionLevel: res.ProtectionLevel,
+	}, crc32c, nil
+}
+
+// openLargePayload decrypts ciphertext with associatedData and appends the
+// plaintext to dst if WithLargePayloadEnvelope is used and ciphertext is an
+// envelope ciphertext. It returns false if ciphertext must be decrypted by
+// Cloud KMS directly instead, which is also the case if it merely starts
+// with the header but cannot be parsed. The metadata of the result is that
+// of the decryption of the DEK.
+func (a *AEAD) openLargePayload(ctx context.Context, dst, ciphertext, associatedData []byte) (DecryptResult, bool, error) {
+	if a.largePayloadDEK == nil || !bytes.HasPrefix(ciphertext, largePayloadHeader) {
+		return DecryptResult{}, false, nil
+	}
+	kek := &largePayloadKEK{a: a, ctx: ctx}
+	plaintext, err := aead.NewKMSEnvelopeAEAD2(a.largePayloadDEK, kek).Decrypt(ciphertext[len(largePayloadHeader):], headerAssociatedData(largePayloadHeader, associatedData))
+	if err != nil {
+		if !kek.called {
+			return DecryptResult{}, false, nil
+		}
+		return DecryptResult{}, true, err
+	}
+	res := kek.decrypted
+	res.Plaintext = append(dst, plaintext...)
+	return res, true, nil
+}
@@ -0,0 +1,223 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+)
+
+const (
+	// maxKMSPlaintextSize is the size of the largest plaintext that Cloud KMS
+	// encrypts.
+	maxKMSPlaintextSize = 64 * 1024
+	largePayloadHeader  = "GLPE\x01"
+)
+
+func TestLargePayloadEnvelopeBoundary(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		opts []gcpkms.Option
+	}{
+		{name: "default"},
+		{name: "decrypt deduplication", opts: []gcpkms.Option{gcpkms.WithDecryptDeduplication()}},
+		{name: "key URI binding", opts: []gcpkms.Option{gcpkms.WithKeyURIBinding()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			a := newFakeAEAD(t, srv, append(tc.opts, gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))...)
+			associatedData := []byte("associatedData")
+			for _, size := range []int{0, maxKMSPlaintextSize - 1, maxKMSPlaintextSize, maxKMSPlaintextSize + 1, 4 * maxKMSPlaintextSize} {
+				plaintext := bytes.Repeat([]byte{'p'}, size)
+				encrypts := srv.CallCount("Encrypt")
+				ciphertext, err := a.Encrypt(plaintext, associatedData)
+				if err != nil {
+					t.Fatalf("a.Encrypt(%d bytes) err = %v, want nil", size, err)
+				}
+				if got := srv.CallCount("Encrypt") - encrypts; got != 1 {
+					t.Errorf("a.Encrypt(%d bytes) made %d Encrypt calls, want 1", size, got)
+				}
+				wantEnvelope := size > maxKMSPlaintextSize
+				if got := bytes.HasPrefix(ciphertext, []byte(largePayloadHeader)); got != wantEnvelope {
+					t.Errorf("a.Encrypt(%d bytes) is an envelope ciphertext: %v, want %v", size, got, wantEnvelope)
+				}
+				if wantEnvelope && len(ciphertext) > size+1024 {
+					t.Errorf("len(a.Encrypt(%d bytes)) = %d, want at most %d", size, len(ciphertext), size+1024)
+				}
+				decrypted, err := a.Decrypt(ciphertext, associatedData)
+				if err != nil {
+					t.Fatalf("a.Decrypt(%d bytes) err = %v, want nil", size, err)
+				}
+				if !bytes.Equal(decrypted, plaintext) {
+					t.Errorf("a.Decrypt() returned %d bytes, want the %d bytes of the plaintext", len(decrypted), size)
+				}
+			}
+		})
+	}
+}
+
+func TestLargePayloadsFailWithoutEnvelope(t *testing.T) {
+	a := newFakeAEAD(t, newFakeServer(t))
+	if _, err := a.Encrypt(make([]byte, maxKMSPlaintextSize), nil); err != nil {
+		t.Fatalf("a.Encrypt(%d bytes) err = %v, want nil", maxKMSPlaintextSize, err)
+	}
+	if _, err := a.Encrypt(make([]byte, maxKMSPlaintextSize+1), nil); err == nil {
+		t.Errorf("a.Encrypt(%d bytes) err = nil, want error", maxKMSPlaintextSize+1)
+	}
+}
+
+func TestLargePayloadEnvelopeCrossFormatDecrypt(t *testing.T) {
+	srv := newFakeServer(t)
+	plain := newFakeAEAD(t, srv)
+	enveloped := newFakeAEAD(t, srv, gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))
+	associatedData := []byte("associatedData")
+	small := bytes.Repeat([]byte{'s'}, maxKMSPlaintextSize)
+	large := bytes.Repeat([]byte{'l'}, maxKMSPlaintextSize+1)
+
+	// Ciphertexts of clients without the option decrypt with it, and small
+	// payloads still decrypt without it.
+	for _, tc := range []struct {
+		name      string
+		encrypter *gcpkms.AEAD
+		decrypter *gcpkms.AEAD
+		plaintext []byte
+	}{
+		{name: "raw to enveloped", encrypter: plain, decrypter: enveloped, plaintext: small},
+		{name: "small enveloped to raw", encrypter: enveloped, decrypter: plain, plaintext: small},
+		{name: "large enveloped to enveloped", encrypter: enveloped, decrypter: enveloped, plaintext: large},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ciphertext, err := tc.encrypter.Encrypt(tc.plaintext, associatedData)
+			if err != nil {
+				t.Fatalf("Encrypt() err = %v, want nil", err)
+			}
+			decrypted, err := tc.decrypter.Decrypt(ciphertext, associatedData)
+			if err != nil {
+				t.Fatalf("Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(decrypted, tc.plaintext) {
+				t.Error("Decrypt() did not return the plaintext")
+			}
+		})
+	}
+
+	// Envelope ciphertexts require the option.
+	ciphertext, err := enveloped.Encrypt(large, associatedData)
+	if err != nil {
+		t.Fatalf("enveloped.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := plain.Decrypt(ciphertext, associatedData); err == nil {
+		t.Error("plain.Decrypt(envelope ciphertext) err = nil, want error")
+	}
+}
+
+func TestLargePayloadEnvelopeRejectsTampering(t *testing.T) {
+	a := newFakeAEAD(t, newFakeServer(t), gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))
+	associatedData := []byte("associatedData")
+	ciphertext, err := a.Encrypt(make([]byte, maxKMSPlaintextSize+1), associatedData)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	modified := func(i int) []byte {
+		c := bytes.Clone(ciphertext)
+		c[i] ^= 1
+		return c
+	}
+	for _, tc := range []struct {
+		name           string
+		ciphertext     []byte
+		associatedData []byte
+	}{
+		{name: "other associated data", ciphertext: ciphertext, associatedData: []byte("other")},
+		{name: "bad magic", ciphertext: modified(0), associatedData: associatedData},
+		{name: "unknown version", ciphertext: modified(len(largePayloadHeader) - 1), associatedData: associatedData},
+		{name: "modified DEK length", ciphertext: modified(len(largePayloadHeader) + 3), associatedData: associatedData},
+		{name: "modified payload", ciphertext: modified(len(ciphertext) - 1), associatedData: associatedData},
+		{name: "truncated", ciphertext: ciphertext[:len(ciphertext)-1], associatedData: associatedData},
+		{name: "header only", ciphertext: []byte(largePayloadHeader), associatedData: associatedData},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := a.Decrypt(tc.ciphertext, tc.associatedData); err == nil {
+				t.Error("a.Decrypt() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLargePayloadEnvelopeMetadata(t *testing.T) {
+	a := newFakeAEAD(t, newFakeServer(t), gcpkms.WithLargePayloadEnvelope(aead.AES256GCMKeyTemplate()))
+	ctx := context.Background()
+	plaintext := bytes.Repeat([]byte{'p'}, maxKMSPlaintextSize+1)
+	associatedData := []byte("associatedData")
+
+	res, err := a.EncryptWithMetadata(ctx, plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.EncryptWithMetadata() err = %v, want nil", err)
+	}
+	if want := fakeKeyName + "/cryptoKeyVersions/1"; res.KeyVersion != want {
+		t.Errorf("res.KeyVersion = %q, want %q", res.KeyVersion, want)
+	}
+	if res.ProtectionLevel == "" {
+		t.Error("res.ProtectionLevel is empty, want the protection level of the key")
+	}
+	decrypted, err := a.DecryptWithMetadata(ctx, res.Ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("a.DecryptWithMetadata() err = %v, want nil", err)
+	}
+	if !bytes.Equal(decrypted.Plaintext, plaintext) || !decrypted.PlaintextChecksumVerified {
+		t.Errorf("a.DecryptWithMetadata() = %d bytes with PlaintextChecksumVerified = %v, want the plaintext, verified", len(decrypted.Plaintext), decrypted.PlaintextChecksumVerified)
+	}
+
+	ciphertext, crc32c, err := a.EncryptWithChecksum(ctx, plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.EncryptWithChecksum() err = %v, want nil", err)
+	}
+	if want := gcpkms.ComputeCRC32C(ciphertext); crc32c != want {
+		t.Errorf("a.EncryptWithChecksum() checksum = %d, want %d", crc32c, want)
+	}
+
+	prefix := []byte("prefix")
+	ciphertext, err = a.EncryptInto(ctx, prefix, plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("a.EncryptInto() err = %v, want nil", err)
+	}
+	if !bytes.HasPrefix(ciphertext, append(prefix, largePayloadHeader...)) {
+		t.Fatalf("a.EncryptInto() does not start with %q followed by the envelope header", prefix)
+	}
+	out, err := a.DecryptInto(ctx, prefix, ciphertext[len(prefix):], associatedData)
+	if err != nil {
+		t.Fatalf("a.DecryptInto() err = %v, want nil", err)
+	}
+	if !bytes.Equal(out, append(bytes.Clone(prefix), plaintext...)) {
+		t.Error("a.DecryptInto() did not append the plaintext to dst")
+	}
+}
+
+func TestWithLargePayloadEnvelopeRejectsNilTemplate(t *testing.T) {
+	srv := newFakeServer(t)
+	_, err := gcpkms.NewClient(context.Background(), fakeKeyURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...),
+		gcpkms.WithInsecureTransport(),
+		gcpkms.WithLargePayloadEnvelope(nil))
+	if err == nil {
+		t.Error("gcpkms.NewClient() err = nil, want error")
+	}
+}
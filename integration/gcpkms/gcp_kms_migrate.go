@@ -0,0 +1,224 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"google.golang.org/api/iterator"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// MigrationItem is a ciphertext to be migrated by Migrate.
+type MigrationItem struct {
+	// ID identifies the item in the callbacks of MigrateOptions and in the
+	// Report.
+	ID             string
+	Ciphertext     []byte
+	AssociatedData []byte
+}
+
+// Iterator yields the items to be migrated by Migrate. Next returns
+// iterator.Done once there are no more items.
+type Iterator interface {
+	Next(ctx context.Context) (MigrationItem, error)
+}
+
+// MigrateOptions configures Migrate.
+type MigrateOptions struct {
+	// Concurrency is the maximum number of items migrated concurrently. A
+	// concurrency of less than 1 is treated as 1.
+	Concurrency int
+	// DryRun makes Migrate only decrypt the items with the source key, to
+	// validate that they can be migrated. Nothing is encrypted or stored.
+	DryRun bool
+	// Migrated, if set, reports whether an item has already been migrated,
+	// e.g. by a previous run. Such items are skipped.
+	Migrated func(ctx context.Context, item MigrationItem) (bool, error)
+	// Store is called with the ciphertext of each item re-encrypted with the
+	// destination key. It must persist it, and record the item as migrated
+	// for Migrated, so that an interrupted migration can be resumed. It is
+	// required unless DryRun is set.
+	Store func(ctx context.Context, item MigrationItem, ciphertext []byte) error
+}
+
+// MigrationStatus is the outcome of migrating an item.
+type MigrationStatus int
+
+const (
+	// MigrationFailed means the item could not be migrated.
+	MigrationFailed MigrationStatus = iota
+	// MigrationSucceeded means the item was re-encrypted and stored.
+	MigrationSucceeded
+	// MigrationSkipped means the item had already been migrated.
+	MigrationSkipped
+	// MigrationValidated means the item was decrypted in a dry run.
+	MigrationValidated
+)
+
+func (s MigrationStatus) String() string {
+	switch s {
+	case MigrationFailed:
+		return "failed"
+	case MigrationSucceeded:
+		return "succeeded"
+	case MigrationSkipped:
+		return "skipped"
+	case MigrationValidated:
+		return "validated"
+	default:
+		return fmt.Sprintf("MigrationStatus(%d)", int(s))
+	}
+}
+
+// ItemReport is the outcome of migrating the item with the given ID. Err is
+// set if and only if Status is MigrationFailed.
+type ItemReport struct {
+	ID     string
+	Status MigrationStatus
+	Err    error
+}
+
+// Report summarizes a migration.
+type Report struct {
+	// Items holds the outcome of every item read from the iterator, in
+	// completion order.
+	Items []ItemReport
+	// Counts holds the number of items per status.
+	Counts map[MigrationStatus]int
+}
+
+// contextDecrypter is implemented by primitives, such as *AEAD, whose Decrypt
+// requests can be bound to a context.
+type contextDecrypter interface {
+	DecryptWithMetadata(ctx context.Context, ciphertext, associatedData []byte) (*DecryptResult, error)
+}
+
+// Migrate decrypts every item read from items with src and re-encrypts it
+// with dst, under the same associated data, using at most
+// opts.Concurrency concurrent migrations. src and dst are typically the
+// primitives of Cloud KMS keys in different projects, and are called with
+// ctx if they support it, as *AEAD does.
+//
+// Failures of individual items are recorded in the Report and do not stop the
+// migration. Migrate returns an error, along with the report of the items
+// processed so far, if opts are invalid, items fails or ctx is done. A
+// migration can be resumed by calling Migrate again with opts.Migrated
+// reporting the items stored by the previous run.
+func Migrate(ctx context.Context, src, dst tink.AEAD, items Iterator, opts MigrateOptions) (Report, error) {
+	report := Report{Counts: make(map[MigrationStatus]int)}
+	if opts.Store == nil && !opts.DryRun {
+		return report, errors.New("MigrateOptions.Store must be set unless DryRun is set")
+	}
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var mu sync.Mutex
+	jobs := make(chan MigrationItem)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range jobs {
+				r := migrateItem(ctx, src, dst, item, &opts)
+				mu.Lock()
+				report.Items = append(report.Items, r)
+				report.Counts[r.Status]++
+				mu.Unlock()
+			}
+		}()
+	}
+	err := func() error {
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item, err := items.Next(ctx)
+			if err == iterator.Done {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("reading items failed: %w", err)
+			}
+			select {
+			case jobs <- item:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}()
+	close(jobs)
+	wg.Wait()
+	return report, err
+}
+
+func migrateItem(ctx context.Context, src, dst tink.AEAD, item MigrationItem, opts *MigrateOptions) ItemReport {
+	r := ItemReport{ID: item.ID}
+	fail := func(format string, err error) ItemReport {
+		r.Status, r.Err = MigrationFailed, fmt.Errorf(format, err)
+		return r
+	}
+	if opts.Migrated != nil {
+		done, err := opts.Migrated(ctx, item)
+		if err != nil {
+			return fail("checking migration state failed: %w", err)
+		}
+		if done {
+			r.Status = MigrationSkipped
+			return r
+		}
+	}
+
+	var plaintext []byte
+	var err error
+	if d, ok := src.(contextDecrypter); ok {
+		var res *DecryptResult
+		if res, err = d.DecryptWithMetadata(ctx, item.Ciphertext, item.AssociatedData); err == nil {
+			plaintext = res.Plaintext
+		}
+	} else {
+		plaintext, err = src.Decrypt(item.Ciphertext, item.AssociatedData)
+	}
+	if err != nil {
+		return fail("decryption with the source key failed: %w", err)
+	}
+	if opts.DryRun {
+		r.Status = MigrationValidated
+		return r
+	}
+
+	var ciphertext []byte
+	if e, ok := dst.(contextEncrypter); ok {
+		ciphertext, err = e.EncryptWithContext(ctx, plaintext, item.AssociatedData)
+	} else {
+		ciphertext, err = dst.Encrypt(plaintext, item.AssociatedData)
+	}
+	if err != nil {
+		return fail("encryption with the destination key failed: %w", err)
+	}
+	if err := opts.Store(ctx, item, ciphertext); err != nil {
+		return fail("storing the new ciphertext failed: %w", err)
+	}
+	r.Status = MigrationSucceeded
+	return r
+}
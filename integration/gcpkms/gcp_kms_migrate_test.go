@@ -0,0 +1,222 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"google.golang.org/api/iterator"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const (
+	srcKeyName = "projects/a/locations/global/keyRings/r/cryptoKeys/k"
+	dstKeyName = "projects/b/locations/global/keyRings/r/cryptoKeys/k"
+)
+
+type sliceIterator struct {
+	items []gcpkms.MigrationItem
+	err   error
+}
+
+func (it *sliceIterator) Next(ctx context.Context) (gcpkms.MigrationItem, error) {
+	if len(it.items) == 0 {
+		if it.err != nil {
+			return gcpkms.MigrationItem{}, it.err
+		}
+		return gcpkms.MigrationItem{}, iterator.Done
+	}
+	item := it.items[0]
+	it.items = it.items[1:]
+	return item, nil
+}
+
+// store records the ciphertexts stored by Migrate, and fails for the IDs in
+// fail.
+type store struct {
+	mu          sync.Mutex
+	ciphertexts map[string][]byte
+	fail        map[string]bool
+}
+
+func (s *store) Store(ctx context.Context, item gcpkms.MigrationItem, ciphertext []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[item.ID] {
+		return errors.New("storage unavailable")
+	}
+	s.ciphertexts[item.ID] = ciphertext
+	return nil
+}
+
+func (s *store) Migrated(ctx context.Context, item gcpkms.MigrationItem) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.ciphertexts[item.ID]
+	return ok, nil
+}
+
+func newMigrationKeys(t *testing.T) (*fakekms.Server, *gcpkms.AEAD, *gcpkms.AEAD) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	var aeads []*gcpkms.AEAD
+	for _, name := range []string{srcKeyName, dstKeyName} {
+		if err := srv.CreateKey(name); err != nil {
+			t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+		}
+		client, err := gcpkms.NewClient(context.Background(), "gcp-kms://"+name, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+		if err != nil {
+			t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+		}
+		a, err := client.GetAEAD("gcp-kms://" + name)
+		if err != nil {
+			t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+		}
+		aeads = append(aeads, a.(*gcpkms.AEAD))
+	}
+	return srv, aeads[0], aeads[1]
+}
+
+// newMigrationItems returns n items encrypted with src. The items whose index
+// is in corrupt get an invalid ciphertext.
+func newMigrationItems(t *testing.T, src *gcpkms.AEAD, n int, corrupt ...int) []gcpkms.MigrationItem {
+	t.Helper()
+	items := make([]gcpkms.MigrationItem, n)
+	for i := range items {
+		ad := []byte(fmt.Sprintf("ad %d", i))
+		ciphertext, err := src.Encrypt([]byte(fmt.Sprintf("plaintext %d", i)), ad)
+		if err != nil {
+			t.Fatalf("src.Encrypt() err = %v, want nil", err)
+		}
+		items[i] = gcpkms.MigrationItem{ID: fmt.Sprint(i), Ciphertext: ciphertext, AssociatedData: ad}
+	}
+	for _, i := range corrupt {
+		items[i].Ciphertext = []byte("corrupt")
+	}
+	return items
+}
+
+func TestMigrate(t *testing.T) {
+	_, src, dst := newMigrationKeys(t)
+	items := newMigrationItems(t, src, 10, 3, 7)
+	s := &store{ciphertexts: make(map[string][]byte)}
+
+	report, err := gcpkms.Migrate(context.Background(), src, dst, &sliceIterator{items: items}, gcpkms.MigrateOptions{Concurrency: 4, Store: s.Store})
+	if err != nil {
+		t.Fatalf("gcpkms.Migrate() err = %v, want nil", err)
+	}
+	if len(report.Items) != 10 || report.Counts[gcpkms.MigrationSucceeded] != 8 || report.Counts[gcpkms.MigrationFailed] != 2 {
+		t.Errorf("gcpkms.Migrate() report = %+v, want 8 of 10 items succeeded and 2 failed", report)
+	}
+	for _, r := range report.Items {
+		if failed := r.ID == "3" || r.ID == "7"; failed != (r.Status == gcpkms.MigrationFailed) || failed != (r.Err != nil) {
+			t.Errorf("item %s: status = %v, err = %v", r.ID, r.Status, r.Err)
+		}
+	}
+	for _, item := range items {
+		ciphertext, ok := s.ciphertexts[item.ID]
+		if item.ID == "3" || item.ID == "7" {
+			if ok {
+				t.Errorf("item %s was stored, want not stored", item.ID)
+			}
+			continue
+		}
+		want := "plaintext " + item.ID
+		if got, err := dst.Decrypt(ciphertext, item.AssociatedData); err != nil || string(got) != want {
+			t.Errorf("dst.Decrypt() of item %s = %q, %v, want %q, nil", item.ID, got, err, want)
+		}
+		if _, err := src.Decrypt(ciphertext, item.AssociatedData); err == nil {
+			t.Errorf("src.Decrypt() of migrated item %s err = nil, want error", item.ID)
+		}
+	}
+}
+
+func TestMigrateDryRun(t *testing.T) {
+	srv, src, dst := newMigrationKeys(t)
+	items := newMigrationItems(t, src, 5, 1)
+	encrypts := srv.CallCount("Encrypt")
+
+	report, err := gcpkms.Migrate(context.Background(), src, dst, &sliceIterator{items: items}, gcpkms.MigrateOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("gcpkms.Migrate() err = %v, want nil", err)
+	}
+	if report.Counts[gcpkms.MigrationValidated] != 4 || report.Counts[gcpkms.MigrationFailed] != 1 {
+		t.Errorf("gcpkms.Migrate() report = %+v, want 4 items validated and 1 failed", report)
+	}
+	if got := srv.CallCount("Encrypt") - encrypts; got != 0 {
+		t.Errorf("Encrypt calls = %d, want 0", got)
+	}
+}
+
+func TestMigrateResumes(t *testing.T) {
+	srv, src, dst := newMigrationKeys(t)
+	items := newMigrationItems(t, src, 6)
+	s := &store{ciphertexts: make(map[string][]byte), fail: map[string]bool{"2": true, "4": true}}
+	opts := gcpkms.MigrateOptions{Concurrency: 2, Migrated: s.Migrated, Store: s.Store}
+
+	report, err := gcpkms.Migrate(context.Background(), src, dst, &sliceIterator{items: items}, opts)
+	if err != nil {
+		t.Fatalf("gcpkms.Migrate() err = %v, want nil", err)
+	}
+	if report.Counts[gcpkms.MigrationSucceeded] != 4 || report.Counts[gcpkms.MigrationFailed] != 2 {
+		t.Fatalf("gcpkms.Migrate() report = %+v, want 4 items succeeded and 2 failed", report)
+	}
+
+	s.fail = nil
+	encrypts := srv.CallCount("Encrypt")
+	report, err = gcpkms.Migrate(context.Background(), src, dst, &sliceIterator{items: items}, opts)
+	if err != nil {
+		t.Fatalf("gcpkms.Migrate() err = %v, want nil", err)
+	}
+	if report.Counts[gcpkms.MigrationSucceeded] != 2 || report.Counts[gcpkms.MigrationSkipped] != 4 {
+		t.Errorf("gcpkms.Migrate() report = %+v, want 2 items succeeded and 4 skipped", report)
+	}
+	if got := srv.CallCount("Encrypt") - encrypts; got != 2 {
+		t.Errorf("Encrypt calls = %d, want 2", got)
+	}
+	if len(s.ciphertexts) != 6 {
+		t.Errorf("stored items = %d, want 6", len(s.ciphertexts))
+	}
+}
+
+func TestMigrateStopsOnIteratorError(t *testing.T) {
+	_, src, dst := newMigrationKeys(t)
+	items := newMigrationItems(t, src, 2)
+	s := &store{ciphertexts: make(map[string][]byte)}
+	iterErr := errors.New("listing failed")
+
+	report, err := gcpkms.Migrate(context.Background(), src, dst, &sliceIterator{items: items, err: iterErr}, gcpkms.MigrateOptions{Store: s.Store})
+	if !errors.Is(err, iterErr) {
+		t.Errorf("gcpkms.Migrate() err = %v, want %v", err, iterErr)
+	}
+	if report.Counts[gcpkms.MigrationSucceeded] != 2 {
+		t.Errorf("gcpkms.Migrate() report = %+v, want 2 items succeeded", report)
+	}
+}
+
+func TestMigrateRequiresStore(t *testing.T) {
+	_, src, dst := newMigrationKeys(t)
+	if _, err := gcpkms.Migrate(context.Background(), src, dst, &sliceIterator{}, gcpkms.MigrateOptions{}); err == nil {
+		t.Error("gcpkms.Migrate() without Store err = nil, want error")
+	}
+}
@@ -0,0 +1,233 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+const (
+	// mirroredMagic starts every ciphertext of MirroredEnvelopeAEAD.
+	mirroredMagic = "GMIR"
+	// mirroredVersion is the version of the ciphertext format, which follows
+	// the magic bytes.
+	mirroredVersion byte = 1
+)
+
+// MirroredEnvelopeOption configures an envelope created with
+// NewMirroredEnvelopeAEAD.
+type MirroredEnvelopeOption interface {
+	apply(cfg *mirroredConfig) error
+}
+
+type mirroredOptionFunc func(*mirroredConfig) error
+
+func (o mirroredOptionFunc) apply(cfg *mirroredConfig) error { return o(cfg) }
+
+type mirroredConfig struct {
+	// degradedLogger is set if writes may degrade to a single KEK.
+	degradedLogger *log.Logger
+}
+
+// WithDegradedWrites makes Encrypt of a MirroredEnvelopeAEAD succeed when the
+// DEK could be wrapped by only one of the two KEKs, e.g. during an outage of
+// one region, and log a warning with l. Such ciphertexts can only be
+// decrypted with the KEK that wrapped their DEK. By default, Encrypt fails
+// unless both KEKs wrapped the DEK.
+func WithDegradedWrites(l *log.Logger) MirroredEnvelopeOption {
+	return mirroredOptionFunc(func(cfg *mirroredConfig) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+		cfg.degradedLogger = l
+		return nil
+	})
+}
+
+// MirroredEnvelopeAEAD is an envelope AEAD whose DEKs are wrapped by two
+// KEKs, e.g. Cloud KMS keys in different regions, so that its ciphertexts
+// can be decrypted with either KEK. Ciphertexts have the format
+//
+//	"GMIR" || 0x01 ||
+//	len(DEK wrapped by primary) (4 bytes, big-endian) || DEK wrapped by primary ||
+//	len(DEK wrapped by secondary) (4 bytes, big-endian) || DEK wrapped by secondary ||
+//	payload
+//
+// where the wrapped DEKs are Tink keysets encrypted with the KEKs, and the
+// payload is the ciphertext of the DEK. A wrapped DEK is empty if wrapping
+// it failed and WithDegradedWrites is set. The header, i.e. everything
+// before the payload, is authenticated as part of the payload's associated
+// data.
+type MirroredEnvelopeAEAD struct {
+	dekTemplate        *tinkpb.KeyTemplate
+	primary, secondary tink.AEAD
+	degradedLogger     *log.Logger
+}
+
+var _ tink.AEAD = (*MirroredEnvelopeAEAD)(nil)
+
+// NewMirroredEnvelopeAEAD returns an envelope AEAD that encrypts with DEKs
+// generated from dekTemplate and wrapped by both primary and secondary,
+// e.g. the AEADs returned by Client.GetAEAD for keys in two regions. Decrypt
+// unwraps with primary, which should be the KEK closest to the caller, and
+// falls back to secondary.
+func NewMirroredEnvelopeAEAD(dekTemplate *tinkpb.KeyTemplate, primary, secondary tink.AEAD, opts ...MirroredEnvelopeOption) (*MirroredEnvelopeAEAD, error) {
+	if dekTemplate == nil {
+		return nil, errors.New("dekTemplate must not be nil")
+	}
+	if primary == nil || secondary == nil {
+		return nil, errors.New("both KEKs are required")
+	}
+	cfg := &mirroredConfig{}
+	for _, opt := range opts {
+		if err := opt.apply(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &MirroredEnvelopeAEAD{
+		dekTemplate:    dekTemplate,
+		primary:        primary,
+		secondary:      secondary,
+		degradedLogger: cfg.degradedLogger,
+	}, nil
+}
+
+// wrapDEK returns handle encrypted with kek.
+func wrapDEK(handle *keyset.Handle, kek tink.AEAD) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := handle.Write(keyset.NewBinaryWriter(buf), kek); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Encrypt encrypts plaintext with associatedData under a new DEK, which is
+// wrapped by both KEKs concurrently.
+func (m *MirroredEnvelopeAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	handle, err := keyset.NewHandle(m.dekTemplate)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := aead.New(handle)
+	if err != nil {
+		return nil, err
+	}
+	var wrapped [2][]byte
+	var errs [2]error
+	var wg sync.WaitGroup
+	for i, kek := range []tink.AEAD{m.primary, m.secondary} {
+		wg.Add(1)
+		go func(i int, kek tink.AEAD) {
+			defer wg.Done()
+			wrapped[i], errs[i] = wrapDEK(handle, kek)
+		}(i, kek)
+	}
+	wg.Wait()
+	switch {
+	case errs[0] != nil && errs[1] != nil:
+		return nil, fmt.Errorf("wrapping DEK failed: primary KEK: %v; secondary KEK: %v", errs[0], errs[1])
+	case errs[0] != nil || errs[1] != nil:
+		name, err := "primary", errs[0]
+		if err == nil {
+			name, err = "secondary", errs[1]
+		}
+		if m.degradedLogger == nil {
+			return nil, fmt.Errorf("wrapping DEK with %s KEK failed: %v", name, err)
+		}
+		m.degradedLogger.Printf("gcpkms: wrapping DEK with %s KEK failed, the ciphertext can only be decrypted with the other KEK: %v", name, err)
+	}
+
+	header := make([]byte, 0, len(mirroredMagic)+1+2*wrappedDEKLengthSize+len(wrapped[0])+len(wrapped[1]))
+	header = append(header, mirroredMagic...)
+	header = append(header, mirroredVersion)
+	for _, w := range wrapped {
+		header = binary.BigEndian.AppendUint32(header, uint32(len(w)))
+		header = append(header, w...)
+	}
+	payload, err := dek.Encrypt(plaintext, headerAssociatedData(header, associatedData))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, payload...), nil
+}
+
+// Decrypt decrypts ciphertext with associatedData. It unwraps the DEK with
+// the primary KEK, and with the secondary KEK if that fails or the DEK was
+// not wrapped by the primary KEK.
+func (m *MirroredEnvelopeAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	wrapped, header, err := parseMirroredHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	var errs []string
+	for i, kek := range []tink.AEAD{m.primary, m.secondary} {
+		name := [2]string{"primary", "secondary"}[i]
+		if len(wrapped[i]) == 0 {
+			errs = append(errs, fmt.Sprintf("%s KEK: DEK not wrapped", name))
+			continue
+		}
+		handle, err := keyset.Read(keyset.NewBinaryReader(bytes.NewReader(wrapped[i])), kek)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s KEK: %v", name, err))
+			continue
+		}
+		dek, err := aead.New(handle)
+		if err != nil {
+			return nil, err
+		}
+		return dek.Decrypt(ciphertext[len(header):], headerAssociatedData(header, associatedData))
+	}
+	return nil, fmt.Errorf("unwrapping DEK failed: %s", strings.Join(errs, "; "))
+}
+
+// parseMirroredHeader returns the DEKs wrapped by the primary and secondary
+// KEKs and the header of ciphertext.
+func parseMirroredHeader(ciphertext []byte) (wrapped [2][]byte, header []byte, err error) {
+	if len(ciphertext) <= len(mirroredMagic) || !bytes.HasPrefix(ciphertext, []byte(mirroredMagic)) {
+		return wrapped, nil, errors.New("ciphertext is not a mirrored envelope ciphertext")
+	}
+	if v := ciphertext[len(mirroredMagic)]; v != mirroredVersion {
+		return wrapped, nil, fmt.Errorf("unsupported mirrored envelope version %d", v)
+	}
+	rest := ciphertext[len(mirroredMagic)+1:]
+	for i := range wrapped {
+		if len(rest) < wrappedDEKLengthSize {
+			return wrapped, nil, errors.New("ciphertext too short")
+		}
+		n := binary.BigEndian.Uint32(rest)
+		rest = rest[wrappedDEKLengthSize:]
+		if uint64(n) > uint64(len(rest)) {
+			return wrapped, nil, errors.New("invalid wrapped DEK length")
+		}
+		wrapped[i], rest = rest[:n], rest[n:]
+	}
+	if len(wrapped[0]) == 0 && len(wrapped[1]) == 0 {
+		return wrapped, nil, errors.New("ciphertext has no wrapped DEK")
+	}
+	return wrapped, ciphertext[:len(ciphertext)-len(rest)], nil
+}
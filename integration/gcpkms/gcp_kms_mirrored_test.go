@@ -0,0 +1,215 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// unavailableAEAD is a KEK whose Cloud KMS region is unavailable.
+type unavailableAEAD struct {
+	calls atomic.Int32
+}
+
+var errUnavailable = errors.New("region unavailable")
+
+func (a *unavailableAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	a.calls.Add(1)
+	return nil, errUnavailable
+}
+
+func (a *unavailableAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	a.calls.Add(1)
+	return nil, errUnavailable
+}
+
+// newMirroredKEKs returns the KEKs of two keys on separate fake servers,
+// standing for two regions.
+func newMirroredKEKs(t *testing.T) (primary, secondary tink.AEAD) {
+	t.Helper()
+	return newFakeAEAD(t, newFakeServer(t)), newFakeAEAD(t, newFakeServer(t))
+}
+
+func newMirroredEnvelope(t *testing.T, primary, secondary tink.AEAD, opts ...gcpkms.MirroredEnvelopeOption) *gcpkms.MirroredEnvelopeAEAD {
+	t.Helper()
+	m, err := gcpkms.NewMirroredEnvelopeAEAD(aead.AES256GCMKeyTemplate(), primary, secondary, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewMirroredEnvelopeAEAD() err = %v, want nil", err)
+	}
+	return m
+}
+
+func TestMirroredEnvelopeAEADDecryptsWithEitherKEK(t *testing.T) {
+	primary, secondary := newMirroredKEKs(t)
+	m := newMirroredEnvelope(t, primary, secondary)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	ciphertext, err := m.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("m.Encrypt() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name               string
+		primary, secondary tink.AEAD
+	}{
+		{name: "both", primary: primary, secondary: secondary},
+		{name: "only primary", primary: primary, secondary: &unavailableAEAD{}},
+		{name: "only secondary", primary: &unavailableAEAD{}, secondary: secondary},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := newMirroredEnvelope(t, tc.primary, tc.secondary)
+			got, err := d.Decrypt(ciphertext, associatedData)
+			if err != nil {
+				t.Fatalf("d.Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("d.Decrypt() = %q, want %q", got, plaintext)
+			}
+			if _, err := d.Decrypt(ciphertext, []byte("other associatedData")); err == nil {
+				t.Error("d.Decrypt() with other associated data err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMirroredEnvelopeAEADDecryptTriesPrimaryFirst(t *testing.T) {
+	primary, _ := newMirroredKEKs(t)
+	secondary := &unavailableAEAD{}
+	// The secondary KEK is only needed for writes, so it may be down when
+	// degraded writes are allowed.
+	m := newMirroredEnvelope(t, primary, secondary, gcpkms.WithDegradedWrites(log.New(&bytes.Buffer{}, "", 0)))
+	ciphertext, err := m.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("m.Encrypt() err = %v, want nil", err)
+	}
+	secondary.calls.Store(0)
+	if _, err := m.Decrypt(ciphertext, nil); err != nil {
+		t.Fatalf("m.Decrypt() err = %v, want nil", err)
+	}
+	if got := secondary.calls.Load(); got != 0 {
+		t.Errorf("secondary KEK called %d times, want 0", got)
+	}
+}
+
+func TestMirroredEnvelopeAEADPartialWrapFailure(t *testing.T) {
+	for _, failing := range []string{"primary", "secondary"} {
+		t.Run(failing, func(t *testing.T) {
+			primary, secondary := newMirroredKEKs(t)
+			var working tink.AEAD
+			if failing == "primary" {
+				working, primary = secondary, &unavailableAEAD{}
+			} else {
+				working, secondary = primary, &unavailableAEAD{}
+			}
+			plaintext := []byte("plaintext")
+
+			// By default, writes fail.
+			m := newMirroredEnvelope(t, primary, secondary)
+			if _, err := m.Encrypt(plaintext, nil); err == nil || !strings.Contains(err.Error(), failing) {
+				t.Errorf("m.Encrypt() err = %v, want error naming the %s KEK", err, failing)
+			}
+
+			// With WithDegradedWrites, they succeed with a warning.
+			warnings := &bytes.Buffer{}
+			m = newMirroredEnvelope(t, primary, secondary, gcpkms.WithDegradedWrites(log.New(warnings, "", 0)))
+			ciphertext, err := m.Encrypt(plaintext, nil)
+			if err != nil {
+				t.Fatalf("m.Encrypt() with WithDegradedWrites err = %v, want nil", err)
+			}
+			if !strings.Contains(warnings.String(), failing+" KEK failed") {
+				t.Errorf("warnings = %q, want a warning about the %s KEK", warnings, failing)
+			}
+			got, err := m.Decrypt(ciphertext, nil)
+			if err != nil {
+				t.Fatalf("m.Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("m.Decrypt() = %q, want %q", got, plaintext)
+			}
+
+			// The ciphertext can only be decrypted with the KEK that wrapped
+			// the DEK.
+			onlyWorking := newMirroredEnvelope(t, working, working)
+			if _, err := onlyWorking.Decrypt(ciphertext, nil); err != nil {
+				t.Errorf("Decrypt() with the working KEK err = %v, want nil", err)
+			}
+			_, other := newMirroredKEKs(t)
+			withoutWorking := newMirroredEnvelope(t, other, other)
+			if _, err := withoutWorking.Decrypt(ciphertext, nil); err == nil {
+				t.Error("Decrypt() without the working KEK err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMirroredEnvelopeAEADBothWrapsFail(t *testing.T) {
+	m := newMirroredEnvelope(t, &unavailableAEAD{}, &unavailableAEAD{}, gcpkms.WithDegradedWrites(log.New(&bytes.Buffer{}, "", 0)))
+	if _, err := m.Encrypt([]byte("plaintext"), nil); !strings.Contains(fmt.Sprint(err), errUnavailable.Error()) {
+		t.Errorf("m.Encrypt() err = %v, want %v", err, errUnavailable)
+	}
+}
+
+func TestMirroredEnvelopeAEADRejectsInvalidCiphertexts(t *testing.T) {
+	primary, secondary := newMirroredKEKs(t)
+	m := newMirroredEnvelope(t, primary, secondary)
+	ciphertext, err := m.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("m.Encrypt() err = %v, want nil", err)
+	}
+	modifiedPayload := append([]byte(nil), ciphertext...)
+	modifiedPayload[len(modifiedPayload)-1] ^= 1
+	for _, tc := range []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{name: "empty", ciphertext: nil},
+		{name: "wrong magic", ciphertext: append([]byte("GKEK"), ciphertext[4:]...)},
+		{name: "unknown version", ciphertext: append([]byte("GMIR\x02"), ciphertext[5:]...)},
+		{name: "truncated header", ciphertext: ciphertext[:7]},
+		{name: "no wrapped DEK", ciphertext: []byte("GMIR\x01\x00\x00\x00\x00\x00\x00\x00\x00payload")},
+		{name: "modified payload", ciphertext: modifiedPayload},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := m.Decrypt(tc.ciphertext, nil); err == nil {
+				t.Error("m.Decrypt() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewMirroredEnvelopeAEADRejectsInvalidArguments(t *testing.T) {
+	primary, secondary := newMirroredKEKs(t)
+	if _, err := gcpkms.NewMirroredEnvelopeAEAD(nil, primary, secondary); err == nil {
+		t.Error("gcpkms.NewMirroredEnvelopeAEAD() with nil template err = nil, want error")
+	}
+	if _, err := gcpkms.NewMirroredEnvelopeAEAD(aead.AES256GCMKeyTemplate(), primary, nil); err == nil {
+		t.Error("gcpkms.NewMirroredEnvelopeAEAD() without secondary KEK err = nil, want error")
+	}
+	if _, err := gcpkms.NewMirroredEnvelopeAEAD(aead.AES256GCMKeyTemplate(), primary, secondary, gcpkms.WithDegradedWrites(nil)); err == nil {
+		t.Error("gcpkms.NewMirroredEnvelopeAEAD() with WithDegradedWrites(nil) err = nil, want error")
+	}
+}
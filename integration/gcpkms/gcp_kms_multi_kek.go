@@ -0,0 +1,246 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/tink-crypto/tink-go/v2/aead"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+const (
+	// multiKEKMagic starts every ciphertext of MultiKEKEnvelope.
+	multiKEKMagic = "GKEK"
+	// multiKEKVersion and multiKEKCompressedVersion are the versions of the
+	// ciphertext format, which follow the magic bytes. Compressed ciphertexts
+	// name their codec after the version.
+	multiKEKVersion           byte = 1
+	multiKEKCompressedVersion byte = 2
+	// multiKEKURILengthSize is the size of the length prefix of the KEK URI.
+	multiKEKURILengthSize = 2
+)
+
+// MultiKEKEnvelopeOption configures an envelope created with
+// NewMultiKEKEnvelope.
+type MultiKEKEnvelopeOption interface {
+	apply(cfg *multiKEKConfig) error
+}
+
+type multiKEKOptionFunc func(*multiKEKConfig) error
+
+func (o multiKEKOptionFunc) apply(cfg *multiKEKConfig) error { return o(cfg) }
+
+type multiKEKConfig struct {
+	compression Compression
+}
+
+// WithCompression makes a MultiKEKEnvelope compress plaintexts with c before
+// encrypting them with the DEK, and record c in the header of the
+// ciphertexts, so that Decrypt decompresses them automatically. Plaintexts
+// that do not get smaller are stored uncompressed. The wrapped DEK is never
+// compressed. Decrypt fails for plaintexts that decompress to more than
+// 256 MiB.
+//
+// Ciphertexts of compressed envelopes use version 2 of the format, which
+// envelopes without WithCompression decrypt as well.
+func WithCompression(c Compression) MultiKEKEnvelopeOption {
+	return multiKEKOptionFunc(func(cfg *multiKEKConfig) error {
+		if !c.valid() {
+			return fmt.Errorf("unsupported compression %v", c)
+		}
+		cfg.compression = c
+		return nil
+	})
+}
+
+// MultiKEKEnvelope is an envelope AEAD whose ciphertexts name the KEK that
+// wrapped their DEK, so that ciphertexts produced under different KEKs can be
+// decrypted without knowing in advance which KEK encrypted them. Ciphertexts
+// have the format
+//
+//	"GKEK" || 0x01 || len(KEK URI) (2 bytes, big-endian) || KEK URI ||
+//	len(encrypted DEK) (4 bytes, big-endian) || encrypted DEK || payload
+//
+// or, with WithCompression,
+//
+//	"GKEK" || 0x02 || codec (1 byte) || len(KEK URI) (2 bytes, big-endian) ||
+//	KEK URI || len(encrypted DEK) (4 bytes, big-endian) || encrypted DEK ||
+//	payload
+//
+// where everything following the KEK URI is a ciphertext of the envelope AEAD
+// returned by aead.NewKMSEnvelopeAEAD2, and codec is a Compression. The
+// header is authenticated as part of the payload's associated data, so
+// ciphertexts whose header was modified do not decrypt.
+//
+// Decrypt only uses KEKs whose URI is supported by one of the configured
+// clients, so a ciphertext cannot make it use a key, or contact a Cloud KMS
+// endpoint, that the caller did not allow.
+type MultiKEKEnvelope struct {
+	dekTemplate *tinkpb.KeyTemplate
+	clients     []*Client
+	compression Compression
+	// keyURI is the URI of primary.
+	keyURI  string
+	primary tink.AEAD
+}
+
+var _ tink.AEAD = (*MultiKEKEnvelope)(nil)
+
+// NewMultiKEKEnvelope returns a MultiKEKEnvelope that encrypts with DEKs
+// generated from dekTemplate and wrapped by the KEK with URI primaryKeyURI,
+// and decrypts ciphertexts whose KEK URI is supported by one of clients.
+// primaryKeyURI must be supported by one of clients as well.
+func NewMultiKEKEnvelope(primaryKeyURI string, dekTemplate *tinkpb.KeyTemplate, clients []*Client, opts ...MultiKEKEnvelopeOption) (*MultiKEKEnvelope, error) {
+	if dekTemplate == nil {
+		return nil, errors.New("dekTemplate must not be nil")
+	}
+	if len(clients) == 0 {
+		return nil, errors.New("at least one client is required")
+	}
+	if len(primaryKeyURI) > math.MaxUint16 {
+		return nil, fmt.Errorf("primary key URI has %d bytes, want at most %d", len(primaryKeyURI), math.MaxUint16)
+	}
+	cfg := &multiKEKConfig{}
+	for _, opt := range opts {
+		if err := opt.apply(cfg); err != nil {
+			return nil, err
+		}
+	}
+	e := &MultiKEKEnvelope{dekTemplate: dekTemplate, clients: clients, compression: cfg.compression, keyURI: primaryKeyURI}
+	primary, err := e.kek(primaryKeyURI)
+	if err != nil {
+		return nil, err
+	}
+	e.primary = primary
+	return e, nil
+}
+
+// kek returns the KEK with the given URI from the first client that
+// supports it.
+func (e *MultiKEKEnvelope) kek(keyURI string) (tink.AEAD, error) {
+	for _, c := range e.clients {
+		if c.Supported(keyURI) {
+			return c.GetAEAD(keyURI)
+		}
+	}
+	return nil, fmt.Errorf("key URI %q is not supported by any configured client", keyURI)
+}
+
+// header returns the header of the ciphertexts of the primary KEK whose
+// plaintext was compressed with codec. The header has version 1 if
+// compression is disabled.
+func (e *MultiKEKEnvelope) header(codec Compression) []byte {
+	header := make([]byte, 0, len(multiKEKMagic)+2+multiKEKURILengthSize+len(e.keyURI))
+	header = append(header, multiKEKMagic...)
+	if e.compression == CompressionNone {
+		header = append(header, multiKEKVersion)
+	} else {
+		header = append(header, multiKEKCompressedVersion, byte(codec))
+	}
+	header = binary.BigEndian.AppendUint16(header, uint16(len(e.keyURI)))
+	return append(header, e.keyURI...)
+}
+
+// headerAssociatedData returns the associated data of the payload of a
+// MultiKEKEnvelope or MirroredEnvelopeAEAD ciphertext with the given header.
+// The header is self-delimiting, so different headers and associated data
+// never result in the same value.
+func headerAssociatedData(header, associatedData []byte) []byte {
+	ad := make([]byte, 0, len(header)+len(associatedData))
+	ad = append(ad, header...)
+	return append(ad, associatedData...)
+}
+
+// Encrypt encrypts plaintext with associatedData under a new DEK, which is
+// wrapped by the primary KEK.
+func (e *MultiKEKEnvelope) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	codec := e.compression
+	compressed, err := compress(codec, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) >= len(plaintext) {
+		codec, compressed = CompressionNone, plaintext
+	}
+	header := e.header(codec)
+	envelope := aead.NewKMSEnvelopeAEAD2(e.dekTemplate, e.primary)
+	ciphertext, err := envelope.Encrypt(compressed, headerAssociatedData(header, associatedData))
+	if err != nil {
+		return nil, err
+	}
+	return append(header, ciphertext...), nil
+}
+
+// Decrypt decrypts ciphertext with associatedData, using the KEK named by
+// its header to unwrap the DEK, and decompresses the plaintext if needed. It
+// fails without contacting Cloud KMS if the KEK URI is not supported by any
+// configured client.
+func (e *MultiKEKEnvelope) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	keyURI, codec, header, err := parseMultiKEKHeader(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	kek, err := e.kek(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	envelope := aead.NewKMSEnvelopeAEAD2(e.dekTemplate, kek)
+	plaintext, err := envelope.Decrypt(ciphertext[len(header):], headerAssociatedData(header, associatedData))
+	if err != nil {
+		return nil, err
+	}
+	return decompress(codec, plaintext)
+}
+
+// parseMultiKEKHeader returns the KEK URI, the compression codec and the
+// header of ciphertext.
+func parseMultiKEKHeader(ciphertext []byte) (keyURI string, codec Compression, header []byte, err error) {
+	if len(ciphertext) <= len(multiKEKMagic) || !bytes.HasPrefix(ciphertext, []byte(multiKEKMagic)) {
+		return "", 0, nil, errors.New("ciphertext is not a multi-KEK envelope ciphertext")
+	}
+	prefixSize := len(multiKEKMagic) + 1 + multiKEKURILengthSize
+	switch v := ciphertext[len(multiKEKMagic)]; v {
+	case multiKEKVersion:
+		codec = CompressionNone
+	case multiKEKCompressedVersion:
+		prefixSize++
+		if len(ciphertext) < prefixSize {
+			return "", 0, nil, errors.New("ciphertext too short")
+		}
+		codec = Compression(ciphertext[len(multiKEKMagic)+1])
+		if !codec.valid() {
+			return "", 0, nil, fmt.Errorf("unsupported compression %v", codec)
+		}
+	default:
+		return "", 0, nil, fmt.Errorf("unsupported multi-KEK envelope version %d", v)
+	}
+	if len(ciphertext) < prefixSize {
+		return "", 0, nil, errors.New("ciphertext too short")
+	}
+	n := int(binary.BigEndian.Uint16(ciphertext[prefixSize-multiKEKURILengthSize:]))
+	if n == 0 || n > len(ciphertext)-prefixSize {
+		return "", 0, nil, errors.New("invalid key URI length")
+	}
+	header = ciphertext[:prefixSize+n]
+	return string(header[prefixSize:]), codec, header, nil
+}
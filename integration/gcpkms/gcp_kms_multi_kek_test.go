@@ -0,0 +1,319 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+)
+
+const (
+	otherKeyName = "projects/p/locations/global/keyRings/other/cryptoKeys/k"
+	otherKeyURI  = "gcp-kms://" + otherKeyName
+)
+
+// newMultiKEKClients returns a fake server holding two keys, and one client
+// for each of them.
+func newMultiKEKClients(t testing.TB) (*fakekms.Server, *gcpkms.Client, *gcpkms.Client) {
+	t.Helper()
+	srv := newFakeServer(t)
+	if err := srv.CreateKey(otherKeyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	var clients []*gcpkms.Client
+	for _, uri := range []string{fakeKeyURI, otherKeyURI} {
+		c, err := gcpkms.NewClient(context.Background(), uri, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+		if err != nil {
+			t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		clients = append(clients, c)
+	}
+	return srv, clients[0], clients[1]
+}
+
+func newMultiKEKEnvelope(t testing.TB, primaryKeyURI string, clients ...*gcpkms.Client) *gcpkms.MultiKEKEnvelope {
+	t.Helper()
+	e, err := gcpkms.NewMultiKEKEnvelope(primaryKeyURI, aead.AES256GCMKeyTemplate(), clients)
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiKEKEnvelope() err = %v, want nil", err)
+	}
+	return e
+}
+
+func TestMultiKEKEnvelopeRoutesToKEK(t *testing.T) {
+	_, client, otherClient := newMultiKEKClients(t)
+	e := newMultiKEKEnvelope(t, fakeKeyURI, client, otherClient)
+	other := newMultiKEKEnvelope(t, otherKeyURI, client, otherClient)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	for _, enc := range []*gcpkms.MultiKEKEnvelope{e, other} {
+		ciphertext, err := enc.Encrypt(plaintext, associatedData)
+		if err != nil {
+			t.Fatalf("Encrypt() err = %v, want nil", err)
+		}
+		// Both envelopes decrypt the ciphertexts of both KEKs.
+		for _, dec := range []*gcpkms.MultiKEKEnvelope{e, other} {
+			got, err := dec.Decrypt(ciphertext, associatedData)
+			if err != nil {
+				t.Fatalf("Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("Decrypt() = %q, want %q", got, plaintext)
+			}
+			if _, err := dec.Decrypt(ciphertext, []byte("other associatedData")); err == nil {
+				t.Error("Decrypt() with other associated data err = nil, want error")
+			}
+		}
+	}
+}
+
+func TestMultiKEKEnvelopeFormat(t *testing.T) {
+	srv, client, _ := newMultiKEKClients(t)
+	e := newMultiKEKEnvelope(t, fakeKeyURI, client)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	ciphertext, err := e.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("e.Encrypt() err = %v, want nil", err)
+	}
+	var header []byte
+	header = append(header, "GKEK"...)
+	header = append(header, 1)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(fakeKeyURI)))
+	header = append(header, fakeKeyURI...)
+	if !bytes.HasPrefix(ciphertext, header) {
+		t.Fatalf("ciphertext = %x, want prefix %x", ciphertext, header)
+	}
+
+	// The rest is an envelope ciphertext whose associated data starts with the
+	// header.
+	envelope := aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), newFakeAEAD(t, srv))
+	got, err := envelope.Decrypt(ciphertext[len(header):], append(header, associatedData...))
+	if err != nil {
+		t.Fatalf("envelope.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("envelope.Decrypt() = %q, want %q", got, plaintext)
+	}
+
+	// Ciphertexts produced by the envelope AEAD directly can be decrypted
+	// once the header is prepended.
+	payload, err := envelope.Encrypt(plaintext, append(header, associatedData...))
+	if err != nil {
+		t.Fatalf("envelope.Encrypt() err = %v, want nil", err)
+	}
+	got, err = e.Decrypt(append(header, payload...), associatedData)
+	if err != nil {
+		t.Fatalf("e.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("e.Decrypt() = %q, want %q", got, plaintext)
+	}
+}
+
+// withHeader returns the ciphertext of e for plaintext, with its header
+// replaced by one with the given version and key URI.
+func withHeader(t *testing.T, e *gcpkms.MultiKEKEnvelope, version byte, keyURI string) []byte {
+	t.Helper()
+	ciphertext, err := e.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("e.Encrypt() err = %v, want nil", err)
+	}
+	n := int(binary.BigEndian.Uint16(ciphertext[5:]))
+	var out []byte
+	out = append(out, "GKEK"...)
+	out = append(out, version)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(keyURI)))
+	out = append(out, keyURI...)
+	return append(out, ciphertext[7+n:]...)
+}
+
+func TestMultiKEKEnvelopeRejectsTamperedHeaders(t *testing.T) {
+	_, client, otherClient := newMultiKEKClients(t)
+	e := newMultiKEKEnvelope(t, fakeKeyURI, client, otherClient)
+	ciphertext, err := e.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("e.Encrypt() err = %v, want nil", err)
+	}
+	badMagic := bytes.Clone(ciphertext)
+	badMagic[0] ^= 1
+	longURILength := bytes.Clone(ciphertext)
+	binary.BigEndian.PutUint16(longURILength[5:], 0xffff)
+	for _, tc := range []struct {
+		name       string
+		ciphertext []byte
+	}{
+		{name: "empty", ciphertext: nil},
+		{name: "truncated header", ciphertext: ciphertext[:6]},
+		{name: "truncated key URI", ciphertext: ciphertext[:10]},
+		{name: "bad magic", ciphertext: badMagic},
+		{name: "unknown version", ciphertext: withHeader(t, e, 3, fakeKeyURI)},
+		{name: "empty key URI", ciphertext: withHeader(t, e, 1, "")},
+		{name: "key URI too long", ciphertext: longURILength},
+		{name: "other configured KEK", ciphertext: withHeader(t, e, 1, otherKeyURI)},
+		{name: "equivalent key URI", ciphertext: withHeader(t, e, 1, "GCP-KMS://"+fakeKeyName)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := e.Decrypt(tc.ciphertext, nil); err == nil {
+				t.Error("e.Decrypt() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMultiKEKEnvelopeRejectsUnconfiguredKEKs(t *testing.T) {
+	srv, client, otherClient := newMultiKEKClients(t)
+	e := newMultiKEKEnvelope(t, fakeKeyURI, client)
+	for _, keyURI := range []string{
+		otherKeyURI,
+		"gcp-kms://projects/attacker/locations/global/keyRings/r/cryptoKeys/k",
+		"aws-kms://arn:aws:kms:us-east-1:123456789012:key/k",
+		"gcp-kms://" + fakeKeyName + "/../../../../../../projects/attacker",
+	} {
+		t.Run(keyURI, func(t *testing.T) {
+			before := srv.CallCount("Decrypt")
+			if _, err := e.Decrypt(withHeader(t, e, 1, keyURI), nil); err == nil {
+				t.Error("e.Decrypt() err = nil, want error")
+			}
+			if got := srv.CallCount("Decrypt"); got != before {
+				t.Errorf("Decrypt called %d times, want 0", got-before)
+			}
+		})
+	}
+
+	if _, err := gcpkms.NewMultiKEKEnvelope(otherKeyURI, aead.AES256GCMKeyTemplate(), []*gcpkms.Client{client}); err == nil {
+		t.Error("gcpkms.NewMultiKEKEnvelope() with unsupported primary key URI err = nil, want error")
+	}
+	if _, err := gcpkms.NewMultiKEKEnvelope(fakeKeyURI, aead.AES256GCMKeyTemplate(), nil); err == nil {
+		t.Error("gcpkms.NewMultiKEKEnvelope() without clients err = nil, want error")
+	}
+	if _, err := gcpkms.NewMultiKEKEnvelope(fakeKeyURI, nil, []*gcpkms.Client{client, otherClient}); err == nil {
+		t.Error("gcpkms.NewMultiKEKEnvelope() without DEK template err = nil, want error")
+	}
+}
+
+func TestMultiKEKEnvelopeWithCompression(t *testing.T) {
+	_, client, _ := newMultiKEKClients(t)
+	plain := newMultiKEKEnvelope(t, fakeKeyURI, client)
+	random := make([]byte, 4096)
+	if _, err := rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+	compressible := bytes.Repeat([]byte(`{"name":"value","count":42},`), 1000)
+	for _, c := range []gcpkms.Compression{gcpkms.CompressionNone, gcpkms.CompressionGzip, gcpkms.CompressionZstd} {
+		t.Run(c.String(), func(t *testing.T) {
+			e, err := gcpkms.NewMultiKEKEnvelope(fakeKeyURI, aead.AES256GCMKeyTemplate(), []*gcpkms.Client{client}, gcpkms.WithCompression(c))
+			if err != nil {
+				t.Fatalf("gcpkms.NewMultiKEKEnvelope() err = %v, want nil", err)
+			}
+			for _, tc := range []struct {
+				name      string
+				plaintext []byte
+				// compressed is true if the plaintext should be stored
+				// compressed.
+				compressed bool
+			}{
+				{name: "compressible", plaintext: compressible, compressed: c != gcpkms.CompressionNone},
+				{name: "incompressible", plaintext: random},
+				{name: "empty", plaintext: []byte{}},
+			} {
+				t.Run(tc.name, func(t *testing.T) {
+					ciphertext, err := e.Encrypt(tc.plaintext, []byte("associatedData"))
+					if err != nil {
+						t.Fatalf("e.Encrypt() err = %v, want nil", err)
+					}
+					wantHeader := []byte{'G', 'K', 'E', 'K', 1}
+					if c != gcpkms.CompressionNone {
+						wantCodec := gcpkms.CompressionNone
+						if tc.compressed {
+							wantCodec = c
+						}
+						wantHeader = []byte{'G', 'K', 'E', 'K', 2, byte(wantCodec)}
+					}
+					if !bytes.HasPrefix(ciphertext, wantHeader) {
+						t.Errorf("ciphertext = %x..., want prefix %x", ciphertext[:len(wantHeader)], wantHeader)
+					}
+					if tc.compressed && len(ciphertext) >= len(tc.plaintext) {
+						t.Errorf("len(ciphertext) = %d, want less than %d", len(ciphertext), len(tc.plaintext))
+					}
+					// Envelopes decrypt all codecs, whatever their own.
+					for _, dec := range []*gcpkms.MultiKEKEnvelope{e, plain} {
+						got, err := dec.Decrypt(ciphertext, []byte("associatedData"))
+						if err != nil {
+							t.Fatalf("Decrypt() err = %v, want nil", err)
+						}
+						if !bytes.Equal(got, tc.plaintext) {
+							t.Errorf("Decrypt() = %d bytes, want %d bytes", len(got), len(tc.plaintext))
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestMultiKEKEnvelopeCrossCodecFails(t *testing.T) {
+	srv, client, _ := newMultiKEKClients(t)
+	e := newMultiKEKEnvelope(t, fakeKeyURI, client)
+	envelope := aead.NewKMSEnvelopeAEAD2(aead.AES256GCMKeyTemplate(), newFakeAEAD(t, srv))
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("zstd.NewWriter() err = %v, want nil", err)
+	}
+	zstdPlaintext := enc.EncodeAll(bytes.Repeat([]byte("plaintext"), 100), nil)
+	for _, tc := range []struct {
+		name    string
+		codec   byte
+		wantErr string
+	}{
+		{name: "zstd data with gzip codec", codec: byte(gcpkms.CompressionGzip), wantErr: "decompressing plaintext with gzip failed"},
+		{name: "unknown codec", codec: 9, wantErr: "unsupported compression"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Build a correctly encrypted ciphertext whose header names
+			// another codec than the one the plaintext was compressed with.
+			header := []byte{'G', 'K', 'E', 'K', 2, tc.codec}
+			header = binary.BigEndian.AppendUint16(header, uint16(len(fakeKeyURI)))
+			header = append(header, fakeKeyURI...)
+			payload, err := envelope.Encrypt(zstdPlaintext, header)
+			if err != nil {
+				t.Fatalf("envelope.Encrypt() err = %v, want nil", err)
+			}
+			_, err = e.Decrypt(append(header, payload...), nil)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("e.Decrypt() err = %v, want error containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestWithCompressionRejectsUnknownCodecs(t *testing.T) {
+	_, client, _ := newMultiKEKClients(t)
+	if _, err := gcpkms.NewMultiKEKEnvelope(fakeKeyURI, aead.AES256GCMKeyTemplate(), []*gcpkms.Client{client}, gcpkms.WithCompression(gcpkms.Compression(9))); err == nil {
+		t.Error("gcpkms.NewMultiKEKEnvelope() err = nil, want error")
+	}
+}
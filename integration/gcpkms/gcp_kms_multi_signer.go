@@ -0,0 +1,248 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+const defaultSignConcurrency = 4
+
+// MultiSignerOption configures a signer created with NewMultiSigner or
+// NewSigner.
+type MultiSignerOption interface {
+	applyMultiSigner(cfg *multiSignerConfig) error
+}
+
+type multiSignerOptionFunc func(*multiSignerConfig) error
+
+func (o multiSignerOptionFunc) applyMultiSigner(cfg *multiSignerConfig) error { return o(cfg) }
+
+type multiSignerConfig struct {
+	concurrency int
+	cache       *signatureCache
+	timeouts    callTimeouts
+	// integrity is nil if the default integrity retries are used.
+	integrity *integrityRetry
+	// pubKeys, closer and invoker are set by Client.GetSigner, and nil
+	// otherwise.
+	pubKeys *publicKeyCache
+	closer  *closer
+	invoker *invoker
+}
+
+// newMultiSignerConfig returns the configuration set by opts.
+func newMultiSignerConfig(opts []MultiSignerOption) (*multiSignerConfig, error) {
+	cfg := &multiSignerConfig{concurrency: defaultSignConcurrency}
+	for _, opt := range opts {
+		if err := opt.applyMultiSigner(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
+// newSigner returns a signer for the key version with the given resource name,
+// configured with cfg.
+func (cfg *multiSignerConfig) newSigner(ctx context.Context, keyVersionName string, kms *cloudkms.Service) (*signer, error) {
+	s, err := newSigner(ctx, keyVersionName, kms, cfg.invoker, cfg.timeouts, cfg.integrity, cfg.pubKeys)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.cache != nil {
+		if pub := s.publicKey(); !pub.alg.deterministic() {
+			return nil, fmt.Errorf("cannot cache signatures of %s: algorithm %s is randomized", keyVersionName, pub.algorithm)
+		}
+		s.cache = cfg.cache
+	}
+	s.closer = cfg.closer
+	return s, nil
+}
+
+// WithSignConcurrency sets the maximum number of concurrent AsymmetricSign
+// requests of a MultiSigner. The default is 4.
+func WithSignConcurrency(n int) MultiSignerOption {
+	return multiSignerOptionFunc(func(cfg *multiSignerConfig) error {
+		if n < 1 {
+			return fmt.Errorf("sign concurrency must be positive, got %d", n)
+		}
+		cfg.concurrency = n
+		return nil
+	})
+}
+
+// WithSignatureCache makes a MultiSigner remember up to maxEntries signatures
+// for ttl, and return them instead of calling AsymmetricSign again when the
+// same data is signed with the same key version, e.g. when a deployment is
+// retried. The least recently used signatures are evicted first.
+//
+// Only the RSA PKCS #1 v1.5 algorithms and Ed25519 are deterministic, and NewMultiSigner
+// fails if any of the versions uses a randomized algorithm, such as RSA-PSS
+// or ECDSA, since caching would make all signatures of the same data equal.
+func WithSignatureCache(maxEntries int, ttl time.Duration) MultiSignerOption {
+	return multiSignerOptionFunc(func(cfg *multiSignerConfig) error {
+		if maxEntries < 1 {
+			return fmt.Errorf("maximum number of cached signatures must be positive, got %d", maxEntries)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("signature cache TTL must be positive, got %v", ttl)
+		}
+		cfg.cache = newSignatureCache(maxEntries, ttl)
+		return nil
+	})
+}
+
+// SigningVersion is a key version that a MultiSigner signs with.
+type SigningVersion struct {
+	// Name is the resource name of the key version, e.g.
+	// "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+	Name string
+	// Optional versions do not fail SignAllWithContext when signing with
+	// them fails.
+	Optional bool
+}
+
+// VersionSignature is the signature of data under a key version, as
+// returned by MultiSigner.SignAllWithContext. Err is set, and Signature is
+// nil, if signing with an optional version failed.
+type VersionSignature struct {
+	Version   string
+	Signature []byte
+	Err       error
+}
+
+// MultiSigner signs data with several Cloud KMS asymmetric signing key
+// versions at once, e.g. with both the outgoing and the incoming version
+// during a rotation, so that verifiers that only know one of them keep
+// working. The versions may belong to different keys and use different
+// algorithms.
+//
+// MultiSigner is safe for concurrent use.
+type MultiSigner struct {
+	versions    []SigningVersion
+	signers     []*signer
+	concurrency int
+}
+
+// NewMultiSigner returns a signer for the given key versions, at least one
+// of which must be required. The public keys of the versions are fetched
+// with ctx.
+func NewMultiSigner(ctx context.Context, versions []SigningVersion, kms *cloudkms.Service, opts ...MultiSignerOption) (*MultiSigner, error) {
+	cfg, err := newMultiSignerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	required := false
+	seen := make(map[string]bool)
+	for _, v := range versions {
+		if seen[v.Name] {
+			return nil, fmt.Errorf("duplicate key version %s", v.Name)
+		}
+		seen[v.Name] = true
+		required = required || !v.Optional
+	}
+	if !required {
+		return nil, errors.New("at least one key version must be required")
+	}
+	m := &MultiSigner{
+		versions:    append([]SigningVersion(nil), versions...),
+		concurrency: cfg.concurrency,
+	}
+	for _, v := range versions {
+		s, err := cfg.newSigner(ctx, v.Name, kms)
+		if err != nil {
+			return nil, err
+		}
+		m.signers = append(m.signers, s)
+	}
+	return m, nil
+}
+
+// SignAllWithContext signs data with every key version, hashing it with the
+// hash function of each version's algorithm, and returns the signatures in
+// the order of the versions passed to NewMultiSigner. The AsymmetricSign
+// requests are issued concurrently and bound to ctx.
+//
+// If signing with a required version fails, SignAllWithContext cancels the
+// remaining requests and returns an error. Failures of optional versions are
+// reported in the Err field of their VersionSignature instead.
+func (m *MultiSigner) SignAllWithContext(ctx context.Context, data []byte) ([]VersionSignature, error) {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]VersionSignature, len(m.signers))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < m.concurrency && i < len(m.signers); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				signature, err := signData(ctx, m.signers[j], data)
+				results[j] = VersionSignature{Version: m.versions[j].Name, Signature: signature, Err: err}
+				if err != nil && !m.versions[j].Optional {
+					cancel()
+				}
+			}
+		}()
+	}
+	for j := range m.signers {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	var errs []error
+	for j, r := range results {
+		if r.Err == nil || m.versions[j].Optional {
+			continue
+		}
+		if errors.Is(r.Err, context.Canceled) && parent.Err() == nil {
+			// The request was canceled because another version failed.
+			continue
+		}
+		errs = append(errs, fmt.Errorf("signing with %s failed: %w", r.Version, r.Err))
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return results, nil
+}
+
+// signData signs data with s, hashing it with the hash function of the key's
+// algorithm, or as is for Ed25519 keys.
+func signData(ctx context.Context, s *signer, data []byte) ([]byte, error) {
+	alg := s.publicKey().alg
+	if alg.ed25519 {
+		return s.signWithContext(ctx, data, crypto.Hash(0))
+	}
+	h := alg.hash.New()
+	h.Write(data)
+	var opts crypto.SignerOpts = alg.hash
+	if alg.pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.hash}
+	}
+	return s.signWithContext(ctx, h.Sum(nil), opts)
+}
@@ -0,0 +1,222 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+func TestMultiSignerSignAllWithContext(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	if _, err := srv.AddVersion(fakeSigningKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	versions := []gcpkms.SigningVersion{{Name: versionName(1)}, {Name: versionName(2)}}
+	m, err := gcpkms.NewMultiSigner(context.Background(), versions, kms, gcpkms.WithSignConcurrency(1))
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiSigner() err = %v, want nil", err)
+	}
+	data := []byte("data")
+	signatures, err := m.SignAllWithContext(context.Background(), data)
+	if err != nil {
+		t.Fatalf("m.SignAllWithContext() err = %v, want nil", err)
+	}
+	if len(signatures) != len(versions) {
+		t.Fatalf("len(m.SignAllWithContext()) = %d, want %d", len(signatures), len(versions))
+	}
+	digest := sha256.Sum256(data)
+	for i, s := range signatures {
+		if s.Version != versions[i].Name || s.Err != nil {
+			t.Errorf("signatures[%d] = {Version: %q, Err: %v}, want {Version: %q, Err: nil}", i, s.Version, s.Err, versions[i].Name)
+			continue
+		}
+		pub := kmsPublicKey(t, kms, s.Version).(*ecdsa.PublicKey)
+		if !ecdsa.VerifyASN1(pub, digest[:], s.Signature) {
+			t.Errorf("signature of %s does not verify", s.Version)
+		}
+	}
+	if got := srv.CallCount("AsymmetricSign"); got != len(versions) {
+		t.Errorf("AsymmetricSign called %d times, want %d", got, len(versions))
+	}
+}
+
+func TestMultiSignerToleratesFailingOptionalVersions(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	if _, err := srv.AddVersion(fakeSigningKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	versions := []gcpkms.SigningVersion{{Name: versionName(1), Optional: true}, {Name: versionName(2)}}
+	m, err := gcpkms.NewMultiSigner(context.Background(), versions, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiSigner() err = %v, want nil", err)
+	}
+	if err := srv.SetVersionState(fakeSigningKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	signatures, err := m.SignAllWithContext(context.Background(), []byte("data"))
+	if err != nil {
+		t.Fatalf("m.SignAllWithContext() err = %v, want nil", err)
+	}
+	var stateErr *gcpkms.KeyVersionStateError
+	if !errors.As(signatures[0].Err, &stateErr) || signatures[0].Signature != nil {
+		t.Errorf("signatures[0] = {Signature: %x, Err: %v}, want {Signature: nil, Err: *gcpkms.KeyVersionStateError}", signatures[0].Signature, signatures[0].Err)
+	}
+	if signatures[1].Err != nil || len(signatures[1].Signature) == 0 {
+		t.Errorf("signatures[1] = {Signature: %x, Err: %v}, want signature", signatures[1].Signature, signatures[1].Err)
+	}
+}
+
+func TestMultiSignerFailsIfRequiredVersionFails(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	if _, err := srv.AddVersion(fakeSigningKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	versions := []gcpkms.SigningVersion{{Name: versionName(1)}, {Name: versionName(2), Optional: true}}
+	m, err := gcpkms.NewMultiSigner(context.Background(), versions, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiSigner() err = %v, want nil", err)
+	}
+	if err := srv.SetVersionState(fakeSigningKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	signatures, err := m.SignAllWithContext(context.Background(), []byte("data"))
+	if err == nil {
+		t.Fatalf("m.SignAllWithContext() = %v, nil, want error", signatures)
+	}
+	if !strings.Contains(err.Error(), versionName(1)) {
+		t.Errorf("m.SignAllWithContext() err = %v, want error mentioning %s", err, versionName(1))
+	}
+	if !errors.Is(err, gcpkms.ErrKeyVersionDisabled) {
+		t.Errorf("m.SignAllWithContext() err = %v, want %v", err, gcpkms.ErrKeyVersionDisabled)
+	}
+}
+
+func TestMultiSignerRespectsContext(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	m, err := gcpkms.NewMultiSigner(context.Background(), []gcpkms.SigningVersion{{Name: versionName(1)}}, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiSigner() err = %v, want nil", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.SignAllWithContext(ctx, []byte("data")); !errors.Is(err, context.Canceled) {
+		t.Errorf("m.SignAllWithContext() with canceled context err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestNewMultiSignerRejectsInvalidVersions(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	for _, tc := range []struct {
+		name     string
+		versions []gcpkms.SigningVersion
+		opts     []gcpkms.MultiSignerOption
+	}{
+		{name: "no versions"},
+		{name: "only optional versions", versions: []gcpkms.SigningVersion{{Name: versionName(1), Optional: true}}},
+		{name: "duplicate versions", versions: []gcpkms.SigningVersion{{Name: versionName(1)}, {Name: versionName(1), Optional: true}}},
+		{name: "invalid name", versions: []gcpkms.SigningVersion{{Name: fakeSigningKeyName}}},
+		{name: "missing version", versions: []gcpkms.SigningVersion{{Name: versionName(2)}}},
+		{name: "invalid concurrency", versions: []gcpkms.SigningVersion{{Name: versionName(1)}}, opts: []gcpkms.MultiSignerOption{gcpkms.WithSignConcurrency(0)}},
+		{name: "invalid cache size", versions: []gcpkms.SigningVersion{{Name: versionName(1)}}, opts: []gcpkms.MultiSignerOption{gcpkms.WithSignatureCache(0, time.Minute)}},
+		{name: "invalid cache TTL", versions: []gcpkms.SigningVersion{{Name: versionName(1)}}, opts: []gcpkms.MultiSignerOption{gcpkms.WithSignatureCache(1, 0)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewMultiSigner(context.Background(), tc.versions, kms, tc.opts...); err == nil {
+				t.Error("gcpkms.NewMultiSigner() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMultiSignerWithSignatureCache(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "RSA_SIGN_PKCS1_2048_SHA256")
+	if _, err := srv.AddVersion(fakeSigningKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	versions := []gcpkms.SigningVersion{{Name: versionName(1)}, {Name: versionName(2)}}
+	m, err := gcpkms.NewMultiSigner(context.Background(), versions, kms, gcpkms.WithSignatureCache(10, time.Hour))
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiSigner() err = %v, want nil", err)
+	}
+	first, err := m.SignAllWithContext(context.Background(), []byte("manifest"))
+	if err != nil {
+		t.Fatalf("m.SignAllWithContext() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("AsymmetricSign"); got != 2 {
+		t.Errorf("AsymmetricSign called %d times after the first call, want 2", got)
+	}
+	second, err := m.SignAllWithContext(context.Background(), []byte("manifest"))
+	if err != nil {
+		t.Fatalf("m.SignAllWithContext() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("AsymmetricSign"); got != 2 {
+		t.Errorf("AsymmetricSign called %d times after signing the same data, want 2", got)
+	}
+	for i := range first {
+		if !bytes.Equal(first[i].Signature, second[i].Signature) {
+			t.Errorf("cached signature of %s = %x, want %x", versions[i].Name, second[i].Signature, first[i].Signature)
+		}
+	}
+	// The caller may modify the returned signatures.
+	second[0].Signature[0] ^= 1
+
+	third, err := m.SignAllWithContext(context.Background(), []byte("other manifest"))
+	if err != nil {
+		t.Fatalf("m.SignAllWithContext() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("AsymmetricSign"); got != 4 {
+		t.Errorf("AsymmetricSign called %d times after signing other data, want 4", got)
+	}
+	digest := sha256.Sum256([]byte("other manifest"))
+	for _, s := range third {
+		pub := kmsPublicKey(t, kms, s.Version).(*rsa.PublicKey)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], s.Signature); err != nil {
+			t.Errorf("signature of %s does not verify: %v", s.Version, err)
+		}
+	}
+	fourth, err := m.SignAllWithContext(context.Background(), []byte("manifest"))
+	if err != nil {
+		t.Fatalf("m.SignAllWithContext() err = %v, want nil", err)
+	}
+	if !bytes.Equal(fourth[0].Signature, first[0].Signature) {
+		t.Errorf("cached signature = %x, want %x", fourth[0].Signature, first[0].Signature)
+	}
+}
+
+func TestWithSignatureCacheRefusesRandomizedAlgorithms(t *testing.T) {
+	for _, algorithm := range []string{"EC_SIGN_P256_SHA256", "RSA_SIGN_PSS_2048_SHA256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			_, kms := newFakeSigningKey(t, algorithm)
+			versions := []gcpkms.SigningVersion{{Name: versionName(1)}}
+			_, err := gcpkms.NewMultiSigner(context.Background(), versions, kms, gcpkms.WithSignatureCache(10, time.Hour))
+			if err == nil || !strings.Contains(err.Error(), "randomized") {
+				t.Errorf("gcpkms.NewMultiSigner() with WithSignatureCache() err = %v, want error about the randomized algorithm", err)
+			}
+		})
+	}
+}
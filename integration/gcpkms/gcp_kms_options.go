@@ -0,0 +1,1555 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	"google.golang.org/api/transport"
+	htransport "google.golang.org/api/transport/http"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/protobuf/proto"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+const (
+	defaultEndpoint = "https://cloudkms.googleapis.com/"
+	mtlsEndpoint    = "https://cloudkms.mtls.googleapis.com/"
+)
+
+// Option configures a Client created with NewClient.
+type Option interface {
+	apply(cfg *config) error
+}
+
+type optionFunc func(*config) error
+
+func (o optionFunc) apply(cfg *config) error { return o(cfg) }
+
+// config holds the settings collected from the Options passed to NewClient.
+type config struct {
+	additionalPrefixes []string
+	apiOptions         []option.ClientOption
+	clientCertSource   option.ClientCertSource
+	insecure           bool
+	// allowUnauthenticated is set by WithAllowUnauthenticated.
+	allowUnauthenticated bool
+	// baseTransport, if set, replaces http.DefaultTransport under the
+	// authentication layers, in tests.
+	baseTransport http.RoundTripper
+	warmup        bool
+	warmupPolicy  WarmupPolicy
+	logger        *log.Logger
+	clock         clock
+
+	projectCheck       bool
+	projectCheckPolicy ProjectCheckPolicy
+
+	retryBudgetRatio     float64
+	retryBudgetMinTokens int
+	retrySettings        RetrySettings
+	retryPredicate       func(op Method, attempt int, err error) (retry bool, backoff time.Duration)
+
+	disablePrimitiveCache bool
+	decryptDeduplication  bool
+	// decryptCacheEntries is 0 if the decrypt cache is disabled.
+	decryptCacheEntries int
+	decryptCacheTTL     time.Duration
+	// dekCacheMessages is 0 if the DEK cache is disabled.
+	dekCacheMessages int
+	dekCacheTTL      time.Duration
+	// offlineMaxStaleness is 0 unless WithOfflineDecryptFallback is used.
+	offlineMaxStaleness time.Duration
+	// stalenessCallback is nil unless WithRotationStalenessCheck is used.
+	stalenessMaxAge   time.Duration
+	stalenessCallback func(StalenessEvent)
+
+	timeouts callTimeouts
+
+	regionalEndpoints bool
+	// endpoints is nil unless WithEndpoints is used.
+	endpoints         []*balancedEndpoint
+	reauthentication  bool
+	perRPCCredentials credentials.PerRPCCredentials
+	// credentialsPollInterval is 0 for defaultCredentialsPollInterval, and
+	// only set in tests.
+	credentialsFile         string
+	credentialsPollInterval time.Duration
+	// downscopeRules is nil unless WithDownscopedCredentials is used.
+	// newDownscopedTokenSource is nil for newDownscopedTokenSource, and only
+	// set in tests, which cannot reach the Security Token Service.
+	downscopeRules           []AccessBoundaryRule
+	newDownscopedTokenSource func(ctx context.Context, root oauth2.TokenSource, rules []AccessBoundaryRule) (oauth2.TokenSource, error)
+
+	connectivityCallback func(oldState, newState connectivity.State)
+	// connMonitor is created by NewClient if connectivityCallback is set.
+	connMonitor *connMonitor
+
+	keyURIBinding      bool
+	inputCopying       bool
+	maxConcurrentCalls int
+	newKeyGracePeriod  time.Duration
+	closeGracePeriod   time.Duration
+	requiredKeyLabels  map[string]string
+	largePayloadDEK    *tinkpb.KeyTemplate
+	hedgeDelay         time.Duration
+	maxHedges          int
+	requestIDHook      func(RequestInfo)
+	slowCallThreshold  time.Duration
+	slowCallHook       func(SlowCallInfo)
+
+	// allowedKeyLocations is sorted, and nil unless WithAllowedKeyLocations
+	// is used.
+	allowedKeyLocations     []string
+	keyLocationVerification bool
+	// rotationExemptions holds the names of the crypto keys exempted with
+	// WithRotationPolicyExemptions.
+	requiredRotationPeriod time.Duration
+	rotationExemptions     map[string]bool
+
+	// eagerValidationConcurrency only applies to GetAEADs. It is 0 if eager
+	// validation is disabled.
+	eagerValidationConcurrency int
+
+	// wrappedDEK and embedWrappedDEK only apply to
+	// NewDeterministicEnvelopeAEAD.
+	wrappedDEK      []byte
+	embedWrappedDEK bool
+}
+
+func newConfig(opts ...Option) (*config, error) {
+	cfg := &config{
+		clock:                realClock{},
+		logger:               log.Default(),
+		retryBudgetRatio:     defaultRetryBudgetRatio,
+		retryBudgetMinTokens: defaultRetryBudgetMinTokens,
+		retrySettings: RetrySettings{
+			MaxAttempts:    defaultMaxAttempts,
+			InitialBackoff: defaultInitialBackoff,
+			MaxBackoff:     defaultMaxBackoff,
+			Multiplier:     defaultBackoffMultiplier,
+		},
+	}
+	for _, opt := range opts {
+		if err := opt.apply(cfg); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.clientCertSource != nil && cfg.insecure {
+		return nil, errors.New("WithClientCertSource cannot be combined with WithInsecureTransport")
+	}
+	if cfg.insecure && cfg.reauthentication {
+		return nil, errors.New("WithReauthentication cannot be combined with WithInsecureTransport")
+	}
+	if cfg.reauthentication && hasAPIOption(cfg.apiOptions, option.WithHTTPClient(nil)) {
+		return nil, errors.New("WithReauthentication cannot be combined with option.WithHTTPClient")
+	}
+	if cfg.clientCertSource != nil && cfg.regionalEndpoints {
+		return nil, errors.New("WithClientCertSource cannot be combined with WithRegionalEndpoints")
+	}
+	if cfg.perRPCCredentials != nil && cfg.insecure {
+		return nil, errors.New("WithPerRPCCredentials cannot be combined with WithInsecureTransport")
+	}
+	if cfg.perRPCCredentials != nil && cfg.reauthentication {
+		return nil, errors.New("WithPerRPCCredentials cannot be combined with WithReauthentication")
+	}
+	if cfg.credentialsFile != "" && cfg.insecure {
+		return nil, errors.New("WithCredentialsFileWatch cannot be combined with WithInsecureTransport")
+	}
+	if cfg.credentialsFile != "" && cfg.perRPCCredentials != nil {
+		return nil, errors.New("WithCredentialsFileWatch cannot be combined with WithPerRPCCredentials")
+	}
+	if cfg.endpoints != nil && cfg.regionalEndpoints {
+		return nil, errors.New("WithEndpoints cannot be combined with WithRegionalEndpoints")
+	}
+	if cfg.endpoints != nil && hasAPIOption(cfg.apiOptions, option.WithEndpoint("")) {
+		return nil, errors.New("WithEndpoints cannot be combined with option.WithEndpoint")
+	}
+	if cfg.endpoints != nil && hasAPIOption(cfg.apiOptions, option.WithHTTPClient(nil)) {
+		return nil, errors.New("WithEndpoints cannot be combined with option.WithHTTPClient")
+	}
+	if cfg.downscopeRules != nil && cfg.insecure {
+		return nil, errors.New("WithDownscopedCredentials cannot be combined with WithInsecureTransport")
+	}
+	if cfg.downscopeRules != nil && cfg.perRPCCredentials != nil {
+		return nil, errors.New("WithDownscopedCredentials cannot be combined with WithPerRPCCredentials")
+	}
+	if cfg.downscopeRules != nil && cfg.reauthentication {
+		return nil, errors.New("WithDownscopedCredentials cannot be combined with WithReauthentication")
+	}
+	if cfg.downscopeRules != nil && hasAPIOption(cfg.apiOptions, option.WithHTTPClient(nil)) {
+		return nil, errors.New("WithDownscopedCredentials cannot be combined with option.WithHTTPClient")
+	}
+	if cfg.dekCacheMessages > 0 && cfg.largePayloadDEK == nil {
+		return nil, errors.New("WithDEKCache requires WithLargePayloadEnvelope")
+	}
+	if cfg.offlineMaxStaleness > 0 && cfg.dekCacheMessages == 0 {
+		return nil, errors.New("WithOfflineDecryptFallback requires WithDEKCache")
+	}
+	if cfg.keyLocationVerification && cfg.allowedKeyLocations == nil {
+		return nil, errors.New("WithKeyLocationVerification requires WithAllowedKeyLocations")
+	}
+	if cfg.rotationExemptions != nil && cfg.requiredRotationPeriod == 0 {
+		return nil, errors.New("WithRotationPolicyExemptions requires WithRequiredRotationPeriod")
+	}
+	return cfg, nil
+}
+
+// hasAPIOption reports whether opts include an option of the same kind as
+// opt, e.g. option.WithHTTPClient(nil) for any HTTP client.
+func hasAPIOption(opts []option.ClientOption, opt option.ClientOption) bool {
+	kind := reflect.TypeOf(opt)
+	for _, o := range opts {
+		if reflect.TypeOf(o) == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// WithAdditionalPrefixes makes the client also handle keys whose URIs start
+// with one of prefixes, which have the same format as the uriPrefix passed to
+// NewClient. This lets a single client, and connection, serve keys from
+// several projects or key rings.
+func WithAdditionalPrefixes(prefixes ...string) Option {
+	return optionFunc(func(cfg *config) error {
+		for _, prefix := range prefixes {
+			if !strings.HasPrefix(strings.ToLower(prefix), gcpPrefix) {
+				return fmt.Errorf("additional prefix %q must start with %s", prefix, gcpPrefix)
+			}
+			canonical, err := canonicalKeyURI(prefix)
+			if err != nil {
+				return fmt.Errorf("invalid additional prefix: %v", err)
+			}
+			cfg.additionalPrefixes = append(cfg.additionalPrefixes, canonical)
+		}
+		return nil
+	})
+}
+
+// WithGoogleAPIClientOptions passes opts to the underlying Cloud KMS service.
+func WithGoogleAPIClientOptions(opts ...option.ClientOption) Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.apiOptions = append(cfg.apiOptions, opts...)
+		return nil
+	})
+}
+
+// WithClientCertSource configures the client to authenticate to Cloud KMS
+// with mutual TLS, using certificates obtained from src.
+//
+// Unlike option.WithClientCertSource, this does not depend on the
+// GOOGLE_API_USE_CLIENT_CERTIFICATE environment variable. Unless an endpoint
+// is set with option.WithEndpoint, the Cloud KMS mTLS endpoint is used.
+func WithClientCertSource(src option.ClientCertSource) Option {
+	return optionFunc(func(cfg *config) error {
+		if src == nil {
+			return errors.New("client certificate source must not be nil")
+		}
+		if cfg.clientCertSource != nil {
+			return errors.New("client certificate source already set")
+		}
+		cfg.clientCertSource = src
+		return nil
+	})
+}
+
+// WithInsecureTransport disables authentication so that the client can talk
+// to a local emulator or a test server. It also allows endpoints that do not
+// use TLS, which NewClient rejects otherwise. It must not be used in
+// production.
+func WithInsecureTransport() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.insecure = true
+		return nil
+	})
+}
+
+// WithAllowUnauthenticated allows Google API client options that disable
+// authentication or whose credentials NewClient cannot check, i.e.
+// option.WithoutAuthentication and option.WithHTTPClient, e.g. when requests
+// go through a proxy that adds credentials. NewClient rejects them otherwise.
+// Unlike WithInsecureTransport, it does not allow endpoints without TLS.
+func WithAllowUnauthenticated() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.allowUnauthenticated = true
+		return nil
+	})
+}
+
+// withBaseTransport makes the client send requests with rt instead of
+// http.DefaultTransport, below the authentication layers, e.g. so that tests
+// can trust the certificate of a TLS test server.
+func withBaseTransport(rt http.RoundTripper) Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.baseTransport = rt
+		return nil
+	})
+}
+
+// WarmupPolicy controls how NewClient reacts to a failed connection warm-up.
+type WarmupPolicy int
+
+const (
+	// WarmupBestEffort logs a failed warm-up and returns the client anyway.
+	WarmupBestEffort WarmupPolicy = iota
+	// WarmupRequired makes NewClient fail if the warm-up fails.
+	WarmupRequired
+)
+
+// WithConnectionWarmup makes NewClient establish the connection to Cloud KMS
+// before returning, so that the first operation does not pay for connection
+// setup and token exchange.
+//
+// The warm-up fetches the metadata of the crypto key, key ring or location
+// named by the client's uriPrefix, and is bounded by the context passed to
+// NewClient. The uriPrefix must therefore name at least a location.
+func WithConnectionWarmup(policy WarmupPolicy) Option {
+	return optionFunc(func(cfg *config) error {
+		if policy != WarmupBestEffort && policy != WarmupRequired {
+			return fmt.Errorf("invalid warm-up policy %d", policy)
+		}
+		cfg.warmup = true
+		cfg.warmupPolicy = policy
+		return nil
+	})
+}
+
+// ProjectCheckPolicy controls how NewClient reacts when the project of its
+// credentials is not the project of its key URIs, as checked with
+// WithProjectConsistencyCheck.
+type ProjectCheckPolicy int
+
+const (
+	// ProjectCheckWarn logs a mismatch, or a failure to determine the
+	// project of the credentials, and returns the client anyway.
+	ProjectCheckWarn ProjectCheckPolicy = iota
+	// ProjectCheckStrict makes NewClient fail with a *ProjectMismatchError on
+	// a mismatch, and with an error if the project of the credentials cannot
+	// be determined.
+	ProjectCheckStrict
+)
+
+// WithProjectConsistencyCheck makes NewClient compare the project of its
+// credentials, as named by the credentials JSON or the metadata server, with
+// the projects of the uriPrefix and of WithAdditionalPrefixes, to catch
+// credentials of the wrong project before requests fail with
+// PermissionDenied. Mismatches are logged to the logger of WithLogger, or
+// rejected with ProjectCheckStrict.
+//
+// Prefixes without a project, or with a project number rather than an ID,
+// are not checked. Without this option, keys of other projects can be used
+// as long as the credentials are granted access to them.
+func WithProjectConsistencyCheck(policy ProjectCheckPolicy) Option {
+	return optionFunc(func(cfg *config) error {
+		if policy != ProjectCheckWarn && policy != ProjectCheckStrict {
+			return fmt.Errorf("invalid project check policy %d", policy)
+		}
+		cfg.projectCheck = true
+		cfg.projectCheckPolicy = policy
+		return nil
+	})
+}
+
+// WithLogger sets the logger used to report non-fatal problems, such as a
+// failed best-effort warm-up. By default, the standard logger is used.
+func WithLogger(l *log.Logger) Option {
+	return optionFunc(func(cfg *config) error {
+		if l == nil {
+			return errors.New("logger must not be nil")
+		}
+		cfg.logger = l
+		return nil
+	})
+}
+
+// WithRetryBudget configures the retry budget shared by all primitives of the
+// client, including the signers returned by GetSigner. Operations failing
+// with transient errors are retried only while the budget has tokens left: a
+// fresh budget holds minTokens tokens, each retry costs one token, and each
+// successful call earns ratio tokens, up to minTokens. When the budget is
+// exhausted, the error of the failed attempt is returned, annotated with
+// "retry budget exhausted".
+//
+// By default, ratio is 0.1 and minTokens is 10.
+func WithRetryBudget(ratio float64, minTokens int) Option {
+	return optionFunc(func(cfg *config) error {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("retry budget ratio must be in [0, 1], got %v", ratio)
+		}
+		if minTokens < 0 {
+			return fmt.Errorf("retry budget minTokens must not be negative, got %d", minTokens)
+		}
+		cfg.retryBudgetRatio = ratio
+		cfg.retryBudgetMinTokens = minTokens
+		return nil
+	})
+}
+
+// RetrySettings configures how operations failing with transient errors, i.e.
+// HTTP status 500, 502, 503 or 504, or 429 with a retry delay, are retried.
+type RetrySettings struct {
+	// MaxAttempts is the maximum number of attempts per operation, including
+	// the first one. The default is 3.
+	MaxAttempts int
+	// InitialBackoff is the backoff before the first retry. The default is
+	// 100ms.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the backoff. The default is 5s.
+	MaxBackoff time.Duration
+	// Multiplier is the factor by which the backoff grows after each retry.
+	// The default is 2.
+	Multiplier float64
+}
+
+// WithRetrySettings configures the retries of the primitives of the client.
+// Zero fields of s keep their current value. Backoffs are jittered, and
+// retry delays requested by Cloud KMS, e.g. in a Retry-After header, are
+// waited instead. Retries are also limited by the retry budget and by the
+// deadline of the operation's context.
+func WithRetrySettings(s RetrySettings) Option {
+	return optionFunc(func(cfg *config) error {
+		if s.MaxAttempts < 0 || s.InitialBackoff < 0 || s.MaxBackoff < 0 || s.Multiplier < 0 {
+			return fmt.Errorf("retry settings must not be negative, got %+v", s)
+		}
+		if s.Multiplier != 0 && s.Multiplier < 1 {
+			return fmt.Errorf("retry backoff multiplier must be at least 1, got %v", s.Multiplier)
+		}
+		merged := cfg.retrySettings
+		if s.MaxAttempts != 0 {
+			merged.MaxAttempts = s.MaxAttempts
+		}
+		if s.InitialBackoff != 0 {
+			merged.InitialBackoff = s.InitialBackoff
+		}
+		if s.MaxBackoff != 0 {
+			merged.MaxBackoff = s.MaxBackoff
+		}
+		if s.Multiplier != 0 {
+			merged.Multiplier = s.Multiplier
+		}
+		if merged.MaxBackoff < merged.InitialBackoff {
+			return fmt.Errorf("retry max backoff %v is less than the initial backoff %v", merged.MaxBackoff, merged.InitialBackoff)
+		}
+		cfg.retrySettings = merged
+		return nil
+	})
+}
+
+// WithTransientErrorRetries sets the maximum number of retries of operations
+// failing with transient errors. It is shorthand for WithRetrySettings with
+// MaxAttempts set to n+1, and like it keeps the other settings. A value of 0
+// disables retries.
+func WithTransientErrorRetries(n int) Option {
+	if n < 0 {
+		return optionFunc(func(*config) error {
+			return fmt.Errorf("number of retries must not be negative, got %d", n)
+		})
+	}
+	return WithRetrySettings(RetrySettings{MaxAttempts: n + 1})
+}
+
+// WithRetryPredicate replaces the default retry policy of the client, as set
+// by WithRetrySettings, with fn. fn is called after every failed attempt of
+// an operation with the Cloud KMS method it calls, the number of the attempt,
+// starting at 1, and its error, which is the error the operation would
+// return, e.g. a *KMSError wrapping the *googleapi.Error with the status
+// details. If fn returns true, the operation is retried after backoff.
+//
+// fn decides for the transient errors retried by the primitives of the
+// client, and for the checksum failures of the GetPublicKey requests of
+// signers returned by GetSigner. It must be safe for concurrent use, and
+// must limit the attempts itself, except for checksum failures, which are
+// still attempted at most as often as set with WithIntegrityRetry. Retries
+// are still limited by the retry budget and by the deadline of the
+// operation's context, and fn is not consulted for the retries of
+// WithNewKeyGracePeriod and WithReauthentication.
+func WithRetryPredicate(fn func(op Method, attempt int, err error) (retry bool, backoff time.Duration)) Option {
+	return optionFunc(func(cfg *config) error {
+		if fn == nil {
+			return errors.New("retry predicate must not be nil")
+		}
+		cfg.retryPredicate = fn
+		return nil
+	})
+}
+
+// WithoutPrimitiveCache makes GetAEAD return a new primitive on every call. By
+// default, repeated calls for the same key return the same primitive, which
+// is safe for concurrent use.
+func WithoutPrimitiveCache() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.disablePrimitiveCache = true
+		return nil
+	})
+}
+
+// WithDecryptDeduplication makes concurrent identical Decrypt calls, i.e.
+// calls with the same key, ciphertext and associated data, share the result
+// of a single Cloud KMS request. Results are not kept once the request has
+// completed.
+func WithDecryptDeduplication() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.decryptDeduplication = true
+		return nil
+	})
+}
+
+// WithDecryptCache makes the primitives of the client remember the results of
+// up to maxEntries decryptions for ttl, and return them instead of calling
+// Cloud KMS again when the same ciphertext is decrypted with the same key and
+// associated data, e.g. for configuration that is decrypted on every request.
+// The least recently used results are evicted first. Client.DecryptCacheStats
+// reports the hit and miss counts.
+//
+// The cache is a confidentiality trade-off: plaintexts stay in memory for up
+// to ttl, and decryptions served from the cache are not authorized, audited
+// or billed by Cloud KMS, so revoking access to the key or disabling its
+// version only takes effect for cached ciphertexts once they expire. Entries
+// are keyed by SHA-256 hashes of the ciphertext and associated data, and the
+// plaintexts of evicted and expired entries, and of all entries on
+// Client.Close, are overwritten with zeros. Only use it for small, frequently
+// decrypted data.
+func WithDecryptCache(maxEntries int, ttl time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if maxEntries < 1 {
+			return fmt.Errorf("maximum number of cached decryptions must be positive, got %d", maxEntries)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("decrypt cache TTL must be positive, got %v", ttl)
+		}
+		cfg.decryptCacheEntries = maxEntries
+		cfg.decryptCacheTTL = ttl
+		return nil
+	})
+}
+
+// WithCallTimeout sets the default deadline of Encrypt and Decrypt
+// operations, including retries. By default, operations have no deadline
+// other than that of their context.
+func WithCallTimeout(d time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if d <= 0 {
+			return fmt.Errorf("call timeout must be positive, got %v", d)
+		}
+		cfg.timeouts.def = d
+		return nil
+	})
+}
+
+// WithProtectionLevelTimeout sets the deadline of Encrypt and Decrypt
+// operations on keys with the given protection level, e.g. "EXTERNAL" or
+// "EXTERNAL_VPC", overriding WithCallTimeout. Keys whose protection level is
+// not known yet, i.e. before the first response from Cloud KMS, use the
+// default deadline.
+func WithProtectionLevelTimeout(protectionLevel string, d time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		switch protectionLevel {
+		case "SOFTWARE", "HSM", "EXTERNAL", "EXTERNAL_VPC":
+		default:
+			return fmt.Errorf("unknown protection level %q", protectionLevel)
+		}
+		if d <= 0 {
+			return fmt.Errorf("call timeout must be positive, got %v", d)
+		}
+		if cfg.timeouts.byLevel == nil {
+			cfg.timeouts.byLevel = make(map[string]time.Duration)
+		}
+		cfg.timeouts.byLevel[protectionLevel] = d
+		return nil
+	})
+}
+
+// Method is a Cloud KMS method. The deadlines of the methods from
+// MethodEncrypt to MethodMacVerify can be set with WithMethodTimeout, and all
+// methods are passed to the predicate of WithRetryPredicate.
+type Method int
+
+const (
+	// MethodEncrypt is the Encrypt method, used by AEAD encryption.
+	MethodEncrypt Method = iota + 1
+	// MethodDecrypt is the Decrypt method, used by AEAD decryption.
+	MethodDecrypt
+	// MethodSign is the AsymmetricSign method, used by signers.
+	MethodSign
+	// MethodGetPublicKey is the GetPublicKey method, used by signers and
+	// verifiers.
+	MethodGetPublicKey
+	// MethodMacSign is the MacSign method, used by NewKMSPRF.
+	MethodMacSign
+	// MethodMacVerify is the MacVerify method.
+	MethodMacVerify
+	// MethodGetCryptoKey is the GetCryptoKey method, used to check keys, e.g.
+	// by KeyExists and WithRequiredKeyLabels, and by WatchKey.
+	MethodGetCryptoKey
+	// MethodGetCryptoKeyVersion is the GetCryptoKeyVersion method, used by
+	// NewKMSPRF.
+	MethodGetCryptoKeyVersion
+	// MethodListCryptoKeyVersions is the ListCryptoKeyVersions method, used
+	// by WatchKey.
+	MethodListCryptoKeyVersions
+	// MethodGetKeyHandle is the GetKeyHandle method of the Autokey API, used
+	// to resolve key handles.
+	MethodGetKeyHandle
+	// MethodTestIamPermissions is the TestIamPermissions method of crypto
+	// keys, used by Client.CheckKeys.
+	MethodTestIamPermissions
+)
+
+func (m Method) String() string {
+	switch m {
+	case MethodEncrypt:
+		return "Encrypt"
+	case MethodDecrypt:
+		return "Decrypt"
+	case MethodSign:
+		return "AsymmetricSign"
+	case MethodGetPublicKey:
+		return "GetPublicKey"
+	case MethodMacSign:
+		return "MacSign"
+	case MethodMacVerify:
+		return "MacVerify"
+	case MethodGetCryptoKey:
+		return "GetCryptoKey"
+	case MethodGetCryptoKeyVersion:
+		return "GetCryptoKeyVersion"
+	case MethodListCryptoKeyVersions:
+		return "ListCryptoKeyVersions"
+	case MethodGetKeyHandle:
+		return "GetKeyHandle"
+	case MethodTestIamPermissions:
+		return "TestIamPermissions"
+	default:
+		return fmt.Sprintf("Method(%d)", int(m))
+	}
+}
+
+// MethodTimeoutOption is the option returned by WithMethodTimeout. It is an
+// Option, a MultiSignerOption and a VerifierOption, so that the same
+// deadlines can be used with clients, signers and verifiers.
+type MethodTimeoutOption struct {
+	method Method
+	d      time.Duration
+}
+
+var (
+	_ Option            = MethodTimeoutOption{}
+	_ MultiSignerOption = MethodTimeoutOption{}
+	_ VerifierOption    = MethodTimeoutOption{}
+)
+
+// WithMethodTimeout sets the deadline of the requests to the given Cloud KMS
+// method, including retries, overriding WithProtectionLevelTimeout and
+// WithCallTimeout. E.g. Encrypt and Decrypt can fail fast while
+// AsymmetricSign requests to EXTERNAL keys are given more time. Methods
+// without a deadline fall back to the other timeout options, and then to no
+// deadline other than that of their context.
+func WithMethodTimeout(method Method, d time.Duration) MethodTimeoutOption {
+	return MethodTimeoutOption{method: method, d: d}
+}
+
+func (o MethodTimeoutOption) apply(cfg *config) error {
+	return cfg.timeouts.setMethodTimeout(o.method, o.d)
+}
+
+func (o MethodTimeoutOption) applyMultiSigner(cfg *multiSignerConfig) error {
+	return cfg.timeouts.setMethodTimeout(o.method, o.d)
+}
+
+func (o MethodTimeoutOption) applyVerifier(cfg *verifierConfig) error {
+	return cfg.timeouts.setMethodTimeout(o.method, o.d)
+}
+
+// WithRegionalEndpoints makes the client call the regional Cloud KMS
+// endpoint of the location of its keys, e.g.
+// "https://cloudkms.europe-west3.rep.googleapis.com/" for keys in
+// europe-west3, instead of the global endpoint. Keys in the "global" location
+// use the global endpoint. The regional endpoint overrides any endpoint set
+// with WithGoogleAPIClientOptions.
+//
+// The location is taken from the uriPrefix passed to NewClient, or otherwise
+// from the first key passed to GetAEAD. A client in this mode serves keys
+// from a single location only; GetAEAD fails for keys in other locations.
+func WithRegionalEndpoints() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.regionalEndpoints = true
+		return nil
+	})
+}
+
+// WithEndpoints makes the client spread its requests round-robin across the
+// given Cloud KMS endpoints instead of calling a single one, e.g. across
+// "https://cloudkms.us-east1.rep.googleapis.com/" and
+// "https://cloudkms.us-west1.rep.googleapis.com/" for keys of a
+// multi-region, to cut latency and ride out the outage of one region. Each
+// endpoint is a URL without a path or a host and port, which uses HTTPS.
+//
+// Routing is health-aware: an endpoint that cannot be connected to is
+// skipped for 5 seconds, and a request that could not be sent because the
+// connection failed is sent to the next endpoint at once. Requests that
+// fail after they were sent are not re-sent to another endpoint, but are
+// subject to the retry policy of the client, whose next attempt goes to the
+// next endpoint. If no endpoint is healthy, all are tried in turn.
+//
+// All endpoints must serve the locations of the keys of the client. The
+// option cannot be combined with an endpoint set with option.WithEndpoint,
+// with option.WithHTTPClient or with WithRegionalEndpoints, and NewClient
+// fails if they are.
+func WithEndpoints(endpoints ...string) Option {
+	return optionFunc(func(cfg *config) error {
+		if len(endpoints) == 0 {
+			return errors.New("at least one endpoint is required")
+		}
+		parsed := make([]*balancedEndpoint, 0, len(endpoints))
+		for _, endpoint := range endpoints {
+			e, err := parseEndpoint(endpoint)
+			if err != nil {
+				return fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+			}
+			parsed = append(parsed, e)
+		}
+		cfg.endpoints = parsed
+		return nil
+	})
+}
+
+// WithReauthentication makes operations that fail because Cloud KMS rejects
+// their credentials, e.g. after the workload's tokens were rotated, re-create
+// the credentials and retry once before failing. It cannot be combined with
+// option.WithHTTPClient, which bypasses the credentials of the client, and
+// NewClient fails if both are given.
+func WithReauthentication() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.reauthentication = true
+		return nil
+	})
+}
+
+// WithCredentialsFileWatch makes the client authenticate with the credentials
+// file at path, e.g. a service account key, and reload it whenever its
+// modification time or size changes, so that a key rotated on disk is used
+// without restarting the application. The file is checked every 10 seconds.
+// Calls in flight keep the credentials they started with.
+//
+// If the new file cannot be loaded, the current credentials are kept, the
+// failure is logged to the logger of WithLogger, and
+// Client.CredentialsReloadFailures is incremented. The file is loaded again
+// when it changes again.
+//
+// It cannot be combined with WithInsecureTransport, WithPerRPCCredentials or
+// Google API client options that provide credentials.
+func WithCredentialsFileWatch(path string) Option {
+	return optionFunc(func(cfg *config) error {
+		if path == "" {
+			return errors.New("credentials file path must not be empty")
+		}
+		cfg.credentialsFile = path
+		return nil
+	})
+}
+
+// withCredentialsPollInterval makes the client check the file of
+// WithCredentialsFileWatch every d, so that tests do not wait for the
+// default interval.
+func withCredentialsPollInterval(d time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.credentialsPollInterval = d
+		return nil
+	})
+}
+
+// WithDownscopedCredentials limits the credentials of the client with a
+// Credential Access Boundary made of rules, so that a leaked token only
+// grants access to the resources and roles they list, e.g. the rules returned
+// by KeyAccessBoundaryRule for the keys or key rings that the client uses.
+// The tokens of the credentials configured otherwise, e.g. with
+// WithCredentialsFileWatch or the Google API client options, are exchanged
+// for downscoped tokens with the Security Token Service, which are cached
+// until they expire.
+//
+// rules must hold between 1 and 10 rules, each with a resource and at least
+// one permission. It cannot be combined with WithInsecureTransport,
+// WithPerRPCCredentials, WithReauthentication or option.WithHTTPClient.
+func WithDownscopedCredentials(rules []AccessBoundaryRule) Option {
+	return optionFunc(func(cfg *config) error {
+		if len(rules) == 0 {
+			return errors.New("access boundary rules must not be empty")
+		}
+		if len(rules) > maxAccessBoundaryRules {
+			return fmt.Errorf("at most %d access boundary rules are allowed, got %d", maxAccessBoundaryRules, len(rules))
+		}
+		for i, rule := range rules {
+			if rule.AvailableResource == "" {
+				return fmt.Errorf("access boundary rule %d has no resource", i)
+			}
+			if len(rule.AvailablePermissions) == 0 {
+				return fmt.Errorf("access boundary rule %d has no permissions", i)
+			}
+		}
+		cfg.downscopeRules = append([]AccessBoundaryRule(nil), rules...)
+		return nil
+	})
+}
+
+// withDownscopedTokenSource makes the client create the token source of
+// WithDownscopedCredentials with newSource, so that tests do not need the
+// Security Token Service.
+func withDownscopedTokenSource(newSource func(ctx context.Context, root oauth2.TokenSource, rules []AccessBoundaryRule) (oauth2.TokenSource, error)) Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.newDownscopedTokenSource = newSource
+		return nil
+	})
+}
+
+// WithPerRPCCredentials authenticates every request to Cloud KMS with the
+// metadata returned by creds, e.g. short-lived tokens minted per request,
+// instead of the default credentials. The metadata is sent as HTTP headers,
+// and requests fail if creds requires transport security and the endpoint
+// does not use TLS.
+//
+// It cannot be combined with WithInsecureTransport, WithReauthentication or
+// Google API client options that provide credentials.
+func WithPerRPCCredentials(creds credentials.PerRPCCredentials) Option {
+	return optionFunc(func(cfg *config) error {
+		if creds == nil {
+			return errors.New("per-RPC credentials must not be nil")
+		}
+		if cfg.perRPCCredentials != nil {
+			return errors.New("per-RPC credentials already set")
+		}
+		cfg.perRPCCredentials = creds
+		return nil
+	})
+}
+
+// WithConnectivityCallback makes the client call fn with the old and new
+// state whenever the connectivity state of its connections to Cloud KMS
+// changes, e.g. to detect that it keeps failing to connect. The states are
+// those of a gRPC channel: IDLE without open connections, CONNECTING while a
+// connection is dialed, READY once one is open, TRANSIENT_FAILURE if dialing
+// failed and no connection is open, and SHUTDOWN once the client is closed.
+//
+// fn is called from a single goroutine, one transition at a time, and must
+// not call Client.Close, which waits until the transition to SHUTDOWN has
+// been reported. It has no effect on HTTP clients provided with
+// option.WithHTTPClient.
+func WithConnectivityCallback(fn func(oldState, newState connectivity.State)) Option {
+	return optionFunc(func(cfg *config) error {
+		if fn == nil {
+			return errors.New("connectivity callback must not be nil")
+		}
+		cfg.connectivityCallback = fn
+		return nil
+	})
+}
+
+// WithKeyURIBinding makes the primitives of the client bind the key URI into
+// the associated data of every Encrypt and Decrypt request, so that
+// decrypting a ciphertext with a client configured for another key URI fails
+// closed. This also applies to the wrapped DEKs of envelope encryption.
+//
+// The associated data sent to Cloud KMS is
+//
+//	associatedData || uri || uint32(len(uri))
+//
+// where uri is "gcp-kms://" followed by the resource name of the crypto key,
+// i.e. with a lowercase scheme, and with Autokey key handles resolved to
+// their crypto key, and the length is encoded in big-endian byte order.
+//
+// Ciphertexts encrypted with and without this option are not compatible, so
+// the option must be set consistently for a key.
+func WithKeyURIBinding() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.keyURIBinding = true
+		return nil
+	})
+}
+
+// WithInputCopying makes the AEADs of the client copy the plaintext and
+// associated data of every Encrypt call once, before anything is sent to
+// Cloud KMS, so that callers may reuse their buffers as soon as the call has
+// started. The request, its checksums and, with WithLargePayloadEnvelope, the
+// locally encrypted payload are all computed from the copies.
+//
+// Without it, inputs are only copied when WithLargePayloadEnvelope encrypts
+// them with a DEK, after Cloud KMS has encrypted the DEK. Requests to Cloud
+// KMS are encoded before they are first sent, and retries resend them as is,
+// so they never read the buffers of the caller afterwards. Signers always
+// copy the digest, since they resend it after refreshing the public key.
+func WithInputCopying() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.inputCopying = true
+		return nil
+	})
+}
+
+// RequestInfo identifies a successful Cloud KMS request.
+type RequestInfo struct {
+	// Method is the Cloud KMS method, e.g. "Encrypt" or "Decrypt".
+	Method string
+	// KeyName is the resource name of the key the request was made with.
+	KeyName string
+	// RequestID is the ID of the request, or "" if Cloud KMS did not report
+	// one.
+	RequestID string
+}
+
+// WithRequestIDHook makes the primitives of the client call fn after every
+// successful Encrypt and Decrypt request, e.g. to log request IDs for audits
+// or support cases. fn is called synchronously and must be safe for
+// concurrent use. The IDs of failed requests are available in *KMSError.
+func WithRequestIDHook(fn func(RequestInfo)) Option {
+	return optionFunc(func(cfg *config) error {
+		if fn == nil {
+			return errors.New("request ID hook must not be nil")
+		}
+		cfg.requestIDHook = fn
+		return nil
+	})
+}
+
+// SlowCallInfo describes a Cloud KMS operation that exceeded the threshold set
+// with WithSlowCallThreshold.
+type SlowCallInfo struct {
+	// Method is the Cloud KMS method, e.g. "Encrypt" or "Decrypt".
+	Method string
+	// KeyName is the resource name of the key the operation was made with.
+	KeyName string
+	// Duration is the time the operation took, including retries.
+	Duration time.Duration
+	// Err is the error the operation failed with, or nil if it succeeded.
+	Err error
+}
+
+// WithSlowCallThreshold makes the primitives of the client call fn after
+// every Encrypt and Decrypt operation that takes longer than d, whether it
+// succeeds or fails, e.g. to alert on degraded networks or external key
+// managers without enabling tracing. fn is called on a separate goroutine, so
+// it does not delay the operation, and a panic in fn is logged and recovered.
+func WithSlowCallThreshold(d time.Duration, fn func(SlowCallInfo)) Option {
+	return optionFunc(func(cfg *config) error {
+		if d <= 0 {
+			return fmt.Errorf("slow-call threshold must be positive, got %v", d)
+		}
+		if fn == nil {
+			return errors.New("slow-call hook must not be nil")
+		}
+		cfg.slowCallThreshold = d
+		cfg.slowCallHook = fn
+		return nil
+	})
+}
+
+// WithMaxConcurrentCalls limits the number of RPCs to Cloud KMS that the
+// primitives of the client issue concurrently to n. Further calls block
+// until an earlier one finishes, or until their context is done. Retries
+// are limited too, but waiting for a backoff does not count as a call in
+// flight.
+//
+// The limit protects the process and the Cloud KMS quota from runaway
+// callers. Client.InFlightCalls reports the current number of calls.
+func WithMaxConcurrentCalls(n int) Option {
+	return optionFunc(func(cfg *config) error {
+		if n < 1 {
+			return fmt.Errorf("maximum number of concurrent calls must be positive, got %d", n)
+		}
+		cfg.maxConcurrentCalls = n
+		return nil
+	})
+}
+
+// WithNewKeyGracePeriod makes Encrypt retry NOT_FOUND errors with backoff
+// for up to d, since a newly created key may take a while to propagate
+// through Cloud KMS. Decrypt never retries them, since for an existing key
+// they mean that the ciphertext names another key.
+//
+// If the key is still not found after d, the error matches ErrKeyNotFound.
+// If the retries are cut short, e.g. by the deadline of the context, it
+// matches ErrKeyPropagating instead.
+func WithNewKeyGracePeriod(d time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if d <= 0 {
+			return fmt.Errorf("new-key grace period must be positive, got %v", d)
+		}
+		cfg.newKeyGracePeriod = d
+		return nil
+	})
+}
+
+// WithRequiredKeyLabels makes GetAEAD and GetSigner refuse keys that do not
+// have all of the given labels with the given values, e.g. {"env": "prod"},
+// to catch the URI of a development key in a production configuration. The
+// crypto key is fetched once per key and client to check its labels, and the
+// error lists every missing or mismatched label in a *KeyPolicyError.
+//
+// This requires the cloudkms.cryptoKeys.get permission on the keys.
+func WithRequiredKeyLabels(labels map[string]string) Option {
+	return optionFunc(func(cfg *config) error {
+		if len(labels) == 0 {
+			return errors.New("at least one required key label must be given")
+		}
+		required := make(map[string]string, len(labels))
+		for k, v := range labels {
+			if k == "" {
+				return errors.New("required key label keys must not be empty")
+			}
+			required[k] = v
+		}
+		cfg.requiredKeyLabels = required
+		return nil
+	})
+}
+
+// WithAllowedKeyLocations makes GetAEAD and GetSigner refuse keys that are
+// not in one of the given locations, e.g. to enforce that the keys of EU
+// customer data stay in the EU. The location is taken from the key URI, and
+// for Autokey key handles also from the crypto key they resolve to. The error
+// is a *KeyPolicyError that names the location of the key.
+//
+// Locations are compared exactly. In particular, a multi-region such as
+// "europe" does not allow the regions it spans, such as "europe-west1", nor
+// the other way round, and "global" is only allowed if listed, so that each
+// allowed location is stated explicitly, e.g.
+// WithAllowedKeyLocations("europe", "europe-west1", "europe-west3").
+func WithAllowedKeyLocations(locations ...string) Option {
+	return optionFunc(func(cfg *config) error {
+		if len(locations) == 0 {
+			return errors.New("at least one allowed key location must be given")
+		}
+		allowed := make([]string, 0, len(locations))
+		for _, l := range locations {
+			if l == "" || strings.Contains(l, "/") {
+				return fmt.Errorf("invalid key location %q, want a location ID such as \"europe-west1\"", l)
+			}
+			allowed = append(allowed, l)
+		}
+		sort.Strings(allowed)
+		cfg.allowedKeyLocations = allowed
+		return nil
+	})
+}
+
+// WithKeyLocationVerification makes GetAEAD and GetSigner also fetch the
+// crypto key, once per key and client, and check the location of the name
+// that Cloud KMS returns against WithAllowedKeyLocations, which it requires.
+// This guards against endpoints, such as proxies, that serve a key from
+// another location than that of the key URI.
+//
+// This requires the cloudkms.cryptoKeys.get permission on the keys.
+func WithKeyLocationVerification() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.keyLocationVerification = true
+		return nil
+	})
+}
+
+// WithRequiredRotationPeriod makes GetAEAD refuse keys that are not rotated
+// automatically, or whose rotation period is longer than max, e.g. to enforce
+// a crypto standard that requires keys to be rotated at least every 90 days.
+// The crypto key is fetched once per key and client to check its rotation
+// period, and the error is a *KeyPolicyError with the configured period,
+// which is empty for keys without automatic rotation.
+//
+// Only keys of the purpose ENCRYPT_DECRYPT are checked, since Cloud KMS does
+// not rotate other keys, such as signing keys, automatically. Keys that are
+// rotated by other means can be exempted with WithRotationPolicyExemptions.
+//
+// This requires the cloudkms.cryptoKeys.get permission on the keys.
+func WithRequiredRotationPeriod(max time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if max <= 0 {
+			return fmt.Errorf("required rotation period must be positive, got %v", max)
+		}
+		cfg.requiredRotationPeriod = max
+		return nil
+	})
+}
+
+// WithRotationPolicyExemptions exempts the crypto keys with the given URIs,
+// e.g. 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k', from
+// WithRequiredRotationPeriod, which it requires. Keys of Autokey key handles
+// are exempted by the URIs of their crypto keys.
+func WithRotationPolicyExemptions(keyURIs ...string) Option {
+	return optionFunc(func(cfg *config) error {
+		if len(keyURIs) == 0 {
+			return errors.New("at least one exempted key URI must be given")
+		}
+		exemptions := make(map[string]bool, len(keyURIs))
+		for _, uri := range keyURIs {
+			name, err := keyNameFromURI(uri)
+			if err != nil {
+				return err
+			}
+			if !cryptoKeyRegex.MatchString(name) {
+				return fmt.Errorf("exempted key URI must name a crypto key, got %q", uri)
+			}
+			exemptions[name] = true
+		}
+		cfg.rotationExemptions = exemptions
+		return nil
+	})
+}
+
+// WithCloseGracePeriod makes Client.Close wait up to d for the operations
+// in flight to finish before canceling them. By default, Close cancels them
+// at once, and they fail with an error matching ErrClientClosed.
+func WithCloseGracePeriod(d time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if d <= 0 {
+			return fmt.Errorf("close grace period must be positive, got %v", d)
+		}
+		cfg.closeGracePeriod = d
+		return nil
+	})
+}
+
+// WithLargePayloadEnvelope makes the primitives returned by GetAEAD encrypt
+// plaintexts larger than the 64 KiB that Cloud KMS accepts with envelope
+// encryption instead of failing: the plaintext is encrypted locally under a
+// new DEK generated from dekTemplate, and only the DEK is encrypted with
+// Cloud KMS. Plaintexts of up to 64 KiB are still encrypted by Cloud KMS
+// directly, so their ciphertexts do not change. See AEAD for the format of
+// envelope ciphertexts.
+//
+// Decrypt accepts both formats. Envelope ciphertexts can only be decrypted by
+// primitives of a client with this option, with the same dekTemplate.
+func WithLargePayloadEnvelope(dekTemplate *tinkpb.KeyTemplate) Option {
+	return optionFunc(func(cfg *config) error {
+		if dekTemplate == nil {
+			return errors.New("dekTemplate must not be nil")
+		}
+		// Copied so that changes made by the caller do not affect the
+		// primitives, which use it concurrently.
+		cfg.largePayloadDEK = proto.Clone(dekTemplate).(*tinkpb.KeyTemplate)
+		return nil
+	})
+}
+
+// WithDEKCache makes the envelope encryption of WithLargePayloadEnvelope
+// reuse a DEK, and its encryption by Cloud KMS, for up to maxMessages
+// plaintexts or for ttl, whichever comes first, instead of encrypting a new
+// DEK with Cloud KMS for every plaintext. The primitives of the client share
+// one DEK per key. Client.DEKCacheStats reports how often DEKs were reused.
+//
+// A cached DEK is discarded early once the primary version of its key
+// changes, so that new ciphertexts are not pinned to the old version: when an
+// Encrypt response names another version, when Cloud KMS reports that the
+// cached DEK was decrypted by a version that is no longer primary, or when
+// Client.WatchKey reports a KeyPrimaryChanged event for the key.
+//
+// Ciphertexts sharing a DEK are only as independent as the nonces of the DEK
+// template allow, e.g. AES-GCM keys should encrypt far fewer than 2^32
+// plaintexts, and disabling or destroying the key version that encrypted a
+// DEK makes all of them undecryptable at once.
+func WithDEKCache(maxMessages int, ttl time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if maxMessages < 1 {
+			return fmt.Errorf("maximum number of messages per DEK must be positive, got %d", maxMessages)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("DEK cache TTL must be positive, got %v", ttl)
+		}
+		cfg.dekCacheMessages = maxMessages
+		cfg.dekCacheTTL = ttl
+		return nil
+	})
+}
+
+// WithOfflineDecryptFallback keeps the envelope decryption of WithDEKCache
+// working while Cloud KMS is unreachable, e.g. during a regional outage, for
+// data that was seen before. The client keeps the DEKs that Cloud KMS
+// encrypted or decrypted for its envelope ciphertexts, up to 1024 of them,
+// and when decrypting the DEK of a ciphertext fails because Cloud KMS cannot
+// be reached or does not answer in time, including with HTTP status 502, 503
+// or 504, the kept DEK is used instead if Cloud KMS confirmed it at most
+// maxStaleness ago.
+//
+// Offline decryptions are counted in DEKCacheStats.OfflineDecrypts, reported
+// by DecryptResult.Offline, and logged to the logger of WithLogger at most
+// once per minute. Encryption never falls back: new DEKs are always encrypted
+// by Cloud KMS. A kept DEK is discarded once Cloud KMS refuses to decrypt it,
+// e.g. because its key version was disabled, but revoking access to the key
+// has no effect on offline decryptions until then, so maxStaleness should be
+// as short as the outages to ride out.
+func WithOfflineDecryptFallback(maxStaleness time.Duration) Option {
+	return optionFunc(func(cfg *config) error {
+		if maxStaleness <= 0 {
+			return fmt.Errorf("maximum staleness of offline DEKs must be positive, got %v", maxStaleness)
+		}
+		cfg.offlineMaxStaleness = maxStaleness
+		return nil
+	})
+}
+
+// WithRotationStalenessCheck makes the client call fn when the primary
+// version of a crypto key used by its AEAD primitives is older than maxAge,
+// e.g. to alert when a key is not rotated as often as policy requires. The
+// event holds the key URI, the primary version and its age.
+//
+// Each key is checked with an extra GetCryptoKey request when it is first
+// used, and then at most once per hour while it is in use. The checks run in
+// the background, so they do not delay the operations, and need the
+// cloudkms.cryptoKeys.get permission. If a check fails, fn is called with an
+// event whose Err is set, at most once per hour.
+//
+// fn is called one event at a time, and must not call Client.Close, which
+// waits for the checks in flight.
+func WithRotationStalenessCheck(maxAge time.Duration, fn func(StalenessEvent)) Option {
+	return optionFunc(func(cfg *config) error {
+		if maxAge <= 0 {
+			return fmt.Errorf("maximum age of the primary version must be positive, got %v", maxAge)
+		}
+		if fn == nil {
+			return errors.New("staleness callback must not be nil")
+		}
+		cfg.stalenessMaxAge = maxAge
+		cfg.stalenessCallback = fn
+		return nil
+	})
+}
+
+// withClock makes the client tell the time, wait and set timers with c instead
+// of the real clock, so that tests run fast and deterministically.
+func withClock(c clock) Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.clock = c
+		return nil
+	})
+}
+
+// WithHedging makes Decrypt, and the GetPublicKey requests of signers and
+// verifiers returned by the client, issue a hedged request, identical to the
+// first one, if no response has arrived after delay, and so on once per delay
+// for up to maxHedges hedged requests. The first successful response is used,
+// and the other requests are canceled. This cuts the tail latency caused by
+// occasional slow responses, at the cost of more requests;
+// Client.HedgedRequests reports how many were issued.
+//
+// Hedged requests count against WithMaxConcurrentCalls, and are skipped while
+// the limit is reached. Encrypt is never hedged, since each request would
+// create a different ciphertext.
+func WithHedging(delay time.Duration, maxHedges int) Option {
+	return optionFunc(func(cfg *config) error {
+		if delay <= 0 {
+			return fmt.Errorf("hedging delay must be positive, got %v", delay)
+		}
+		if maxHedges < 1 {
+			return fmt.Errorf("maximum number of hedged requests must be positive, got %d", maxHedges)
+		}
+		cfg.hedgeDelay = delay
+		cfg.maxHedges = maxHedges
+		return nil
+	})
+}
+
+// WithWrappedDEK makes NewDeterministicEnvelopeAEAD use the AES-SIV key
+// wrapped by wrapped, as returned by DeterministicEnvelopeAEAD.WrappedDEK,
+// instead of generating a new one. Other functions ignore this option.
+func WithWrappedDEK(wrapped []byte) Option {
+	return optionFunc(func(cfg *config) error {
+		if len(wrapped) == 0 {
+			return errors.New("wrapped DEK must not be empty")
+		}
+		cfg.wrappedDEK = append([]byte(nil), wrapped...)
+		return nil
+	})
+}
+
+// WithEmbeddedWrappedDEK makes the primitive returned by
+// NewDeterministicEnvelopeAEAD embed its wrapped AES-SIV key in every
+// ciphertext. Other functions ignore this option.
+func WithEmbeddedWrappedDEK() Option {
+	return optionFunc(func(cfg *config) error {
+		cfg.embedWrappedDEK = true
+		return nil
+	})
+}
+
+// WithEagerValidation makes GetAEADs and WarmForKeyset fetch every crypto
+// key, with at most concurrency concurrent requests, to check that it exists
+// and is an ENCRYPT_DECRYPT key. Other functions ignore this option.
+func WithEagerValidation(concurrency int) Option {
+	return optionFunc(func(cfg *config) error {
+		if concurrency < 1 {
+			return fmt.Errorf("eager validation concurrency must be positive, got %d", concurrency)
+		}
+		cfg.eagerValidationConcurrency = concurrency
+		return nil
+	})
+}
+
+// callTimeouts holds the deadlines of operations by method and by protection
+// level. A zero duration means no deadline.
+type callTimeouts struct {
+	def      time.Duration
+	byLevel  map[string]time.Duration
+	byMethod map[Method]time.Duration
+}
+
+// setMethodTimeout sets the deadline of the requests to method.
+func (t *callTimeouts) setMethodTimeout(method Method, d time.Duration) error {
+	if method < MethodEncrypt || method > MethodTestIamPermissions {
+		return fmt.Errorf("unknown method %v", method)
+	}
+	if method > MethodMacVerify {
+		return fmt.Errorf("the timeout of method %v cannot be set", method)
+	}
+	if d <= 0 {
+		return fmt.Errorf("%v timeout must be positive, got %v", method, d)
+	}
+	if t.byMethod == nil {
+		t.byMethod = make(map[Method]time.Duration)
+	}
+	t.byMethod[method] = d
+	return nil
+}
+
+// withTimeout returns ctx with the deadline for requests to method on keys
+// with the given protection level, which may be empty if unknown.
+func (t *callTimeouts) withTimeout(ctx context.Context, method Method, protectionLevel string) (context.Context, context.CancelFunc) {
+	d, ok := t.byMethod[method]
+	if !ok {
+		d, ok = t.byLevel[protectionLevel]
+	}
+	if !ok {
+		d = t.def
+	}
+	if d == 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+// ErrInsecureTransport is matched by the errors returned by NewClient when the
+// client would send requests to Cloud KMS without TLS or without
+// authentication, and this was not allowed with WithInsecureTransport or
+// WithAllowUnauthenticated.
+var ErrInsecureTransport = errors.New("gcpkms: insecure transport")
+
+// checkCredentials returns an error if the Google API client options cannot
+// be used by NewClient, or an error wrapping ErrInsecureTransport if the
+// requests would not be authenticated with credentials known to the client,
+// unless this was explicitly allowed. This is the case with
+// option.WithoutAuthentication, and with option.WithHTTPClient, since the
+// client cannot tell whether the caller's HTTP client adds credentials.
+func (cfg *config) checkCredentials() error {
+	if hasAPIOption(cfg.apiOptions, option.WithGRPCConn(nil)) {
+		return errors.New("option.WithGRPCConn is not supported, the client uses the Cloud KMS REST API")
+	}
+	if cfg.insecure || cfg.allowUnauthenticated {
+		return nil
+	}
+	if hasAPIOption(cfg.apiOptions, option.WithoutAuthentication()) {
+		return fmt.Errorf("%w: option.WithoutAuthentication disables authentication, use WithAllowUnauthenticated to allow it", ErrInsecureTransport)
+	}
+	if hasAPIOption(cfg.apiOptions, option.WithHTTPClient(nil)) {
+		return fmt.Errorf("%w: the credentials of an HTTP client passed with option.WithHTTPClient cannot be checked, use WithAllowUnauthenticated to allow it", ErrInsecureTransport)
+	}
+	return nil
+}
+
+// checkTransportSecurity returns an error wrapping ErrInsecureTransport if
+// requests to endpoint would not use TLS, unless this was explicitly allowed.
+// This applies to HTTP clients passed with option.WithHTTPClient too, since
+// the scheme of the endpoint decides whether they use TLS.
+func (cfg *config) checkTransportSecurity(endpoint string) error {
+	if cfg.insecure {
+		return nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || u.Scheme != "https" {
+		return fmt.Errorf("%w: endpoint %q does not use TLS, use WithInsecureTransport to allow it", ErrInsecureTransport, endpoint)
+	}
+	for _, e := range cfg.endpoints {
+		if e.scheme != "https" {
+			return fmt.Errorf("%w: endpoint %q does not use TLS, use WithInsecureTransport to allow it", ErrInsecureTransport, e.scheme+"://"+e.host)
+		}
+	}
+	return nil
+}
+
+// googleAPIClientOptions returns the options used to create the HTTP client
+// that talks to Cloud KMS. If reauthentication or WithCredentialsFileWatch is
+// enabled, it also returns the token source that the client uses.
+func (cfg *config) googleAPIClientOptions(ctx context.Context) ([]option.ClientOption, *reauthTokenSource, error) {
+	opts := []option.ClientOption{
+		internaloption.WithDefaultScopes(cloudkms.CloudPlatformScope, cloudkms.CloudkmsScope),
+		internaloption.WithDefaultEndpoint(defaultEndpoint),
+		internaloption.WithDefaultMTLSEndpoint(mtlsEndpoint),
+	}
+	if cfg.clientCertSource != nil {
+		// Prepended so that an endpoint set by the caller takes precedence.
+		opts = append(opts, option.WithEndpoint(mtlsEndpoint))
+	}
+	opts = append(opts, cfg.apiOptions...)
+	if cfg.endpoints != nil {
+		// The service calls the first endpoint, and the balancer rewrites
+		// the requests for the others.
+		first := cfg.endpoints[0]
+		opts = append(opts, option.WithEndpoint(first.scheme+"://"+first.host+"/"))
+	}
+	if cfg.insecure {
+		opts = append(opts, option.WithoutAuthentication())
+	}
+	opts = append(opts, option.WithUserAgent(tinkUserAgent))
+
+	var reauth *reauthTokenSource
+	if cfg.reauthentication || cfg.credentialsFile != "" {
+		sourceOpts := opts
+		if cfg.credentialsFile != "" {
+			sourceOpts = append(opts[:len(opts):len(opts)], option.WithCredentialsFile(cfg.credentialsFile))
+		}
+		var err error
+		if reauth, err = newReauthTokenSource(ctx, sourceOpts, cfg.clock); err != nil {
+			return nil, nil, err
+		}
+	}
+	// tokens is the token source that authenticates the requests, if the
+	// client creates it.
+	var tokens oauth2.TokenSource
+	if reauth != nil {
+		tokens = reauth
+	}
+	if cfg.downscopeRules != nil {
+		root := tokens
+		if root == nil {
+			creds, err := transport.Creds(ctx, opts...)
+			if err != nil {
+				return nil, nil, err
+			}
+			root = creds.TokenSource
+		}
+		newSource := newDownscopedTokenSource
+		if cfg.newDownscopedTokenSource != nil {
+			newSource = cfg.newDownscopedTokenSource
+		}
+		downscoped, err := newSource(ctx, root, cfg.downscopeRules)
+		if err != nil {
+			return nil, nil, err
+		}
+		tokens = oauth2.ReuseTokenSource(nil, downscoped)
+	}
+	if cfg.clientCertSource == nil && tokens == nil && cfg.perRPCCredentials == nil && cfg.connMonitor == nil && cfg.baseTransport == nil && cfg.endpoints == nil {
+		return opts, nil, nil
+	}
+	var base http.RoundTripper = http.DefaultTransport
+	if cfg.baseTransport != nil {
+		base = cfg.baseTransport
+	}
+	if cfg.clientCertSource != nil {
+		mtls := newMTLSTransport(cfg.clientCertSource)
+		if t, ok := cfg.baseTransport.(*http.Transport); ok {
+			// Keep the TLS settings of the base transport, e.g. its root
+			// CAs.
+			mtls = t.Clone()
+			if mtls.TLSClientConfig == nil {
+				mtls.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			}
+			mtls.TLSClientConfig.GetClientCertificate = cfg.clientCertSource
+		}
+		base = mtls
+	}
+	if cfg.connMonitor != nil {
+		t, ok := base.(*http.Transport)
+		if !ok {
+			return nil, nil, fmt.Errorf("WithConnectivityCallback requires an *http.Transport, got %T", base)
+		}
+		t = t.Clone()
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		t.DialContext = cfg.connMonitor.wrapDial(dial)
+		base = t
+	}
+	if cfg.endpoints != nil {
+		base = newEndpointBalancer(cfg.endpoints, base, cfg.clock)
+	}
+	transportOpts := opts
+	if tokens != nil {
+		// The credentials are added below, from the re-creatable or
+		// downscoped token source.
+		transportOpts = append(opts[:len(opts):len(opts)], option.WithoutAuthentication(), internaloption.SkipDialSettingsValidation())
+	}
+	if cfg.perRPCCredentials != nil {
+		// The credentials are added below, from the per-RPC credentials. The
+		// dial settings are still validated, which rejects options that
+		// provide other credentials.
+		transportOpts = append(opts[:len(opts):len(opts)], option.WithoutAuthentication())
+	}
+	trans, err := htransport.NewTransport(ctx, base, transportOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if tokens != nil {
+		trans = &oauth2.Transport{Base: trans, Source: tokens}
+	}
+	if cfg.perRPCCredentials != nil {
+		trans = &perRPCCredentialsTransport{base: trans, creds: cfg.perRPCCredentials}
+	}
+	return append(opts, option.WithHTTPClient(&http.Client{Transport: trans})), reauth, nil
+}
+
+// perRPCCredentialsTransport adds the metadata of per-RPC credentials to the
+// headers of every request.
+type perRPCCredentialsTransport struct {
+	base  http.RoundTripper
+	creds credentials.PerRPCCredentials
+}
+
+func (t *perRPCCredentialsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.creds.RequireTransportSecurity() && req.URL.Scheme != "https" {
+		return nil, fmt.Errorf("per-RPC credentials require transport security, but %s does not use TLS", req.URL.Host)
+	}
+	md, err := t.creds.GetRequestMetadata(req.Context(), req.URL.Scheme+"://"+req.URL.Host)
+	if err != nil {
+		return nil, fmt.Errorf("per-RPC credentials: %v", err)
+	}
+	// RoundTrippers must not modify the original request.
+	req = req.Clone(req.Context())
+	for k, v := range md {
+		req.Header.Set(k, v)
+	}
+	return t.base.RoundTrip(req)
+}
+
+// newMTLSTransport returns an HTTP transport that presents client
+// certificates obtained from src.
+func newMTLSTransport(src option.ClientCertSource) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{
+		MinVersion:           tls.VersionTLS12,
+		GetClientCertificate: src,
+	}
+	return t
+}
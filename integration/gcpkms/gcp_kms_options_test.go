@@ -0,0 +1,487 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc/connectivity"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+func newClientCertificate(t *testing.T) *tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() err = %v, want nil", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "tink-test-client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() err = %v, want nil", err)
+	}
+	return &tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+func TestClientCertSourceIsPresentedDuringHandshake(t *testing.T) {
+	cert := newClientCertificate(t)
+	calls := 0
+	src := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		calls++
+		return cert, nil
+	}
+
+	var gotCommonName string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TLS.PeerCertificates) > 0 {
+			gotCommonName = r.TLS.PeerCertificates[0].Subject.CommonName
+		}
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	cfg, err := newConfig(WithClientCertSource(src))
+	if err != nil {
+		t.Fatalf("newConfig() err = %v, want nil", err)
+	}
+	trans := newMTLSTransport(cfg.clientCertSource)
+	trans.TLSClientConfig.RootCAs = srv.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	resp, err := (&http.Client{Transport: trans}).Get(srv.URL)
+	if err != nil {
+		t.Fatalf("Get() err = %v, want nil", err)
+	}
+	resp.Body.Close()
+	if calls != 1 {
+		t.Errorf("client certificate source called %d times, want 1", calls)
+	}
+	if gotCommonName != "tink-test-client" {
+		t.Errorf("server saw client certificate %q, want %q", gotCommonName, "tink-test-client")
+	}
+}
+
+func TestNewClientWithClientCertSource(t *testing.T) {
+	src := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return nil, nil }
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	c, err := NewClient(context.Background(), "gcp-kms://", WithClientCertSource(src),
+		WithGoogleAPIClientOptions(option.WithTokenSource(ts)))
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	if c.kms.BasePath != mtlsEndpoint {
+		t.Errorf("c.kms.BasePath = %q, want %q", c.kms.BasePath, mtlsEndpoint)
+	}
+
+	c, err = NewClient(context.Background(), "gcp-kms://", WithClientCertSource(src),
+		WithGoogleAPIClientOptions(option.WithTokenSource(ts), option.WithEndpoint("https://example.com/")))
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	if c.kms.BasePath != "https://example.com/" {
+		t.Errorf("c.kms.BasePath = %q, want %q", c.kms.BasePath, "https://example.com/")
+	}
+}
+
+func TestNewClientWithClientCertSourceTalksToMTLSServer(t *testing.T) {
+	cert := newClientCertificate(t)
+	var calls atomic.Int32
+	src := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		calls.Add(1)
+		return cert, nil
+	}
+	var gotCommonName atomic.Value
+	srv := fakekms.NewTLSServer(&tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			c, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return err
+			}
+			gotCommonName.Store(c.Subject.CommonName)
+			return nil
+		},
+	})
+	defer srv.Close()
+	const keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	if err := srv.CreateKey(keyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = &tls.Config{RootCAs: roots}
+
+	client, err := NewClient(context.Background(), gcpPrefix, WithClientCertSource(src), withBaseTransport(base),
+		WithGoogleAPIClientOptions(srv.ClientOptions()...), WithAllowUnauthenticated())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(gcpPrefix + keyName)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt(ciphertext, nil); err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	if calls.Load() == 0 {
+		t.Error("client certificate source was not called")
+	}
+	if got, _ := gotCommonName.Load().(string); got != "tink-test-client" {
+		t.Errorf("server saw client certificate %q, want %q", got, "tink-test-client")
+	}
+
+	// Without the client certificate, the handshake fails.
+	client, err = NewClient(context.Background(), gcpPrefix, withBaseTransport(base),
+		WithGoogleAPIClientOptions(srv.ClientOptions()...), WithAllowUnauthenticated())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	a, err = client.GetAEAD(gcpPrefix + keyName)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err == nil {
+		t.Error("a.Encrypt() without client certificate err = nil, want error")
+	}
+}
+
+func TestNewClientRejectsInsecureTransport(t *testing.T) {
+	src := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return nil, nil }
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "plaintext endpoint with credentials",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/"), option.WithTokenSource(ts))},
+		},
+		{
+			name: "plaintext endpoint with HTTP client",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/"), option.WithHTTPClient(http.DefaultClient))},
+		},
+		{
+			name: "without authentication",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithoutAuthentication())},
+		},
+		{
+			name: "HTTP client on TLS endpoint",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("https://example.com/"), option.WithHTTPClient(http.DefaultClient))},
+		},
+		{
+			name: "without authentication on TLS endpoint",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("https://example.com/"), option.WithoutAuthentication())},
+		},
+		{
+			name: "plaintext endpoint without authentication",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/"), option.WithoutAuthentication())},
+		},
+		{
+			name: "plaintext endpoint allowing unauthenticated",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/"), option.WithoutAuthentication()), WithAllowUnauthenticated()},
+		},
+		{
+			name: "plaintext endpoint with per-RPC credentials",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/")), WithPerRPCCredentials(&perRPCTokens{})},
+		},
+		{
+			name: "plaintext endpoint with reauthentication",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/"), option.WithTokenSource(ts)), WithReauthentication()},
+		},
+		{
+			name: "plaintext endpoint with client certificates",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/"), option.WithTokenSource(ts)), WithClientCertSource(src)},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewClient(context.Background(), "gcp-kms://", tc.opts...); !errors.Is(err, ErrInsecureTransport) {
+				t.Errorf("NewClient() err = %v, want %v", err, ErrInsecureTransport)
+			}
+		})
+	}
+}
+
+func TestNewClientAllowsExplicitlyInsecureTransport(t *testing.T) {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{
+			name: "TLS endpoint with credentials",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("https://example.com/"), option.WithTokenSource(ts))},
+		},
+		{
+			name: "insecure transport",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/")), WithInsecureTransport()},
+		},
+		{
+			name: "insecure transport without authentication",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("http://localhost:8080/"), option.WithoutAuthentication()), WithInsecureTransport()},
+		},
+		{
+			name: "HTTP client allowing unauthenticated",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("https://example.com/"), option.WithHTTPClient(http.DefaultClient)), WithAllowUnauthenticated()},
+		},
+		{
+			name: "allow unauthenticated",
+			opts: []Option{WithGoogleAPIClientOptions(option.WithEndpoint("https://example.com/"), option.WithoutAuthentication()), WithAllowUnauthenticated()},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewClient(context.Background(), "gcp-kms://", tc.opts...); err != nil {
+				t.Errorf("NewClient() err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestNewClientRejectsInvalidClientCertSourceOptions(t *testing.T) {
+	src := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return nil, nil }
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "nil source", opts: []Option{WithClientCertSource(nil)}},
+		{name: "set twice", opts: []Option{WithClientCertSource(src), WithClientCertSource(src)}},
+		{name: "insecure transport", opts: []Option{WithClientCertSource(src), WithInsecureTransport()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewClient(context.Background(), "gcp-kms://", tc.opts...); err == nil {
+				t.Error("NewClient() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestCallTimeoutOptionsRejectInvalidValues(t *testing.T) {
+	for _, opt := range []Option{
+		WithCallTimeout(0),
+		WithCallTimeout(-time.Second),
+		WithProtectionLevelTimeout("EXTERNAL", 0),
+		WithProtectionLevelTimeout("UNKNOWN", time.Second),
+		WithProtectionLevelTimeout("", time.Second),
+	} {
+		if _, err := newConfig(opt); err == nil {
+			t.Error("newConfig() err = nil, want error")
+		}
+	}
+}
+
+func TestWithMethodTimeoutRejectsInvalidValues(t *testing.T) {
+	for _, opt := range []MethodTimeoutOption{
+		WithMethodTimeout(MethodEncrypt, 0),
+		WithMethodTimeout(MethodSign, -time.Second),
+		WithMethodTimeout(Method(0), time.Second),
+		WithMethodTimeout(MethodMacVerify+1, time.Second),
+	} {
+		if _, err := newConfig(opt); err == nil {
+			t.Errorf("newConfig(%+v) err = nil, want error", opt)
+		}
+		if _, err := newMultiSignerConfig([]MultiSignerOption{opt}); err == nil {
+			t.Errorf("newMultiSignerConfig(%+v) err = nil, want error", opt)
+		}
+		if err := opt.applyVerifier(&verifierConfig{}); err == nil {
+			t.Errorf("opt.applyVerifier() of %+v err = nil, want error", opt)
+		}
+	}
+}
+
+func TestCallTimeoutsPrecedence(t *testing.T) {
+	cfg, err := newConfig(
+		WithCallTimeout(time.Second),
+		WithProtectionLevelTimeout("EXTERNAL", 2*time.Second),
+		WithMethodTimeout(MethodSign, 3*time.Second))
+	if err != nil {
+		t.Fatalf("newConfig() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		method          Method
+		protectionLevel string
+		want            time.Duration
+	}{
+		{method: MethodEncrypt, protectionLevel: "", want: time.Second},
+		{method: MethodEncrypt, protectionLevel: "EXTERNAL", want: 2 * time.Second},
+		{method: MethodSign, protectionLevel: "", want: 3 * time.Second},
+		{method: MethodSign, protectionLevel: "EXTERNAL", want: 3 * time.Second},
+	} {
+		ctx, cancel := cfg.timeouts.withTimeout(context.Background(), tc.method, tc.protectionLevel)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if got := time.Until(deadline); !ok || got > tc.want || got < tc.want-time.Second/2 {
+			t.Errorf("withTimeout(%v, %q) deadline in %v, want %v", tc.method, tc.protectionLevel, got, tc.want)
+		}
+	}
+	ctx, cancel := (&callTimeouts{}).withTimeout(context.Background(), MethodDecrypt, "")
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("withTimeout() without timeouts has a deadline, want none")
+	}
+}
+
+func TestWithRequestIDHookRejectsNil(t *testing.T) {
+	if _, err := newConfig(WithRequestIDHook(nil)); err == nil {
+		t.Error("newConfig() err = nil, want error")
+	}
+}
+
+func TestWithSlowCallThresholdRejectsInvalidValues(t *testing.T) {
+	hook := func(SlowCallInfo) {}
+	for _, opt := range []Option{
+		WithSlowCallThreshold(0, hook),
+		WithSlowCallThreshold(-time.Second, hook),
+		WithSlowCallThreshold(time.Second, nil),
+	} {
+		if _, err := newConfig(opt); err == nil {
+			t.Error("newConfig() err = nil, want error")
+		}
+	}
+}
+
+// perRPCTokens mints a new token for every request.
+type perRPCTokens struct {
+	requireTransportSecurity bool
+	minted                   int32
+}
+
+func (c *perRPCTokens) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	n := atomic.AddInt32(&c.minted, 1)
+	return map[string]string{"authorization": fmt.Sprintf("Bearer token-%d", n)}, nil
+}
+
+func (c *perRPCTokens) RequireTransportSecurity() bool {
+	return c.requireTransportSecurity
+}
+
+func TestPerRPCCredentialsAreSentWithEveryRequest(t *testing.T) {
+	var got []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+		w.Write([]byte(`{"ciphertext": "Y2lwaGVydGV4dA=="}`))
+	}))
+	defer srv.Close()
+	c, err := NewClient(context.Background(), "gcp-kms://", WithPerRPCCredentials(&perRPCTokens{}),
+		WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/")), withBaseTransport(srv.Client().Transport))
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	a, err := c.GetAEAD("gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k")
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	for n := 0; n < 2; n++ {
+		if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+	}
+	want := []string{"Bearer token-1", "Bearer token-2"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("server saw authorization headers %q, want %q", got, want)
+	}
+}
+
+func TestPerRPCCredentialsRequiringTransportSecurity(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+	creds := &perRPCTokens{requireTransportSecurity: true}
+	_, err := NewClient(context.Background(), "gcp-kms://", WithPerRPCCredentials(creds),
+		WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/")))
+	if !errors.Is(err, ErrInsecureTransport) {
+		t.Errorf("NewClient() err = %v, want %v", err, ErrInsecureTransport)
+	}
+	// The transport also refuses to send the credentials in plaintext.
+	req, err := http.NewRequest(http.MethodPost, srv.URL, nil)
+	if err != nil {
+		t.Fatalf("http.NewRequest() err = %v, want nil", err)
+	}
+	trans := &perRPCCredentialsTransport{base: http.DefaultTransport, creds: creds}
+	if _, err := trans.RoundTrip(req); err == nil {
+		t.Error("trans.RoundTrip() err = nil, want error")
+	}
+	if requests != 0 {
+		t.Errorf("requests = %d, want 0", requests)
+	}
+}
+
+func TestNewClientRejectsConflictingPerRPCCredentials(t *testing.T) {
+	creds := &perRPCTokens{}
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"})
+	for _, tc := range []struct {
+		name string
+		opts []Option
+	}{
+		{name: "nil credentials", opts: []Option{WithPerRPCCredentials(nil)}},
+		{name: "set twice", opts: []Option{WithPerRPCCredentials(creds), WithPerRPCCredentials(creds)}},
+		{name: "insecure transport", opts: []Option{WithPerRPCCredentials(creds), WithInsecureTransport()}},
+		{name: "reauthentication", opts: []Option{WithPerRPCCredentials(creds), WithReauthentication()}},
+		{name: "token source", opts: []Option{WithPerRPCCredentials(creds), WithGoogleAPIClientOptions(option.WithTokenSource(ts))}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := NewClient(context.Background(), "gcp-kms://", tc.opts...); err == nil {
+				t.Error("NewClient() err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestNewClientRejectsGRPCConn(t *testing.T) {
+	_, err := NewClient(context.Background(), "gcp-kms://", WithInsecureTransport(),
+		WithGoogleAPIClientOptions(option.WithGRPCConn(nil)))
+	if err == nil || !strings.Contains(err.Error(), "option.WithGRPCConn") {
+		t.Errorf("NewClient() err = %v, want error about option.WithGRPCConn", err)
+	}
+}
+
+func TestConnectivityCallbackRejectsOtherTransports(t *testing.T) {
+	base := &perRPCCredentialsTransport{base: http.DefaultTransport, creds: &perRPCTokens{}}
+	_, err := NewClient(context.Background(), "gcp-kms://",
+		WithGoogleAPIClientOptions(option.WithEndpoint("https://example.com/"), option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))),
+		withBaseTransport(base), WithConnectivityCallback(func(_, _ connectivity.State) {}))
+	if err == nil {
+		t.Error("NewClient() err = nil, want error")
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/cloudkms/v1"
+	"github.com/tink-crypto/tink-go/v2/prf"
+)
+
+// hmacOutputSizes maps the Cloud KMS HMAC algorithms to the size of their
+// output in bytes.
+var hmacOutputSizes = map[string]uint32{
+	"HMAC_SHA1":   20,
+	"HMAC_SHA224": 28,
+	"HMAC_SHA256": 32,
+	"HMAC_SHA384": 48,
+	"HMAC_SHA512": 64,
+}
+
+// kmsPRF is a PRF whose key is a Cloud KMS HMAC key version. Outputs are
+// computed with MacSign and truncated to the requested length.
+type kmsPRF struct {
+	ctx      context.Context
+	version  string
+	kms      *cloudkms.Service
+	invoker  *invoker
+	timeouts *callTimeouts
+	// maxOutputLength is the output size of the HMAC algorithm.
+	maxOutputLength uint32
+}
+
+var _ prf.PRF = (*kmsPRF)(nil)
+
+// NewKMSPRF returns a PRF backed by the Cloud KMS HMAC key version with URI
+// keyURI, e.g.
+// 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1',
+// so that the PRF key never leaves Cloud KMS. A version must be named since
+// MAC keys have no primary version. opts configure the client used to call
+// Cloud KMS.
+//
+// The algorithm of the version is fetched with ctx, and ComputePRF rejects
+// output lengths larger than the output size of the algorithm, e.g. 32 bytes
+// for HMAC_SHA256. The MacSign requests of ComputePRF are bound to ctx, and
+// the CRC32C checksums of their requests and responses are verified.
+func NewKMSPRF(ctx context.Context, keyURI string, opts ...Option) (prf.PRF, error) {
+	keyURI, err := canonicalKeyURI(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	version := keyURI[len(gcpPrefix):]
+	if !cryptoKeyVersionRegex.MatchString(version) {
+		return nil, fmt.Errorf("keyURI must name a crypto key version, got %q", keyURI)
+	}
+	client, err := NewClient(ctx, keyURI, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.bindLocation(version); err != nil {
+		return nil, err
+	}
+	var algorithm string
+	err = client.invoker.call(ctx, MethodGetCryptoKeyVersion, func(ctx context.Context) error {
+		v, err := client.kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.Get(version).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		algorithm = v.Algorithm
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("getting key version %s failed: %w", version, err)
+	}
+	size, ok := hmacOutputSizes[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("key version %s has algorithm %s, want an HMAC algorithm", version, algorithm)
+	}
+	return &kmsPRF{
+		ctx:             ctx,
+		version:         version,
+		kms:             client.kms,
+		invoker:         client.invoker,
+		timeouts:        &client.timeouts,
+		maxOutputLength: size,
+	}, nil
+}
+
+// ComputePRF returns the first outputLength bytes of the HMAC of input. An
+// output length of 0 returns an empty output without calling Cloud KMS.
+//
+// If the key version is not usable, the error is a *KeyVersionStateError.
+func (p *kmsPRF) ComputePRF(input []byte, outputLength uint32) ([]byte, error) {
+	if outputLength > p.maxOutputLength {
+		return nil, fmt.Errorf("outputLength must be between 0 and %d, got %d", p.maxOutputLength, outputLength)
+	}
+	if outputLength == 0 {
+		return []byte{}, nil
+	}
+	req := &cloudkms.MacSignRequest{Data: base64.StdEncoding.EncodeToString(input)}
+	SetMacSignRequestChecksum(req, input)
+	ctx, cancel := p.timeouts.withTimeout(p.ctx, MethodMacSign, "")
+	defer cancel()
+	start := p.invoker.clock.Now()
+	var resp *cloudkms.MacSignResponse
+	err := p.invoker.call(ctx, MethodMacSign, func(ctx context.Context) error {
+		var err error
+		resp, err = p.kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.MacSign(p.version, req).Context(ctx).Do()
+		return err
+	})
+	p.invoker.finished("MacSign", p.version, start, err)
+	if err != nil {
+		return nil, keyVersionStateError(ctx, p.kms, err)
+	}
+	p.invoker.succeeded("MacSign", p.version, resp.ServerResponse)
+	if !resp.VerifiedDataCrc32c {
+		return nil, errors.New("MacSign request corrupted in transit: data checksum not verified")
+	}
+	if resp.Name != p.version {
+		return nil, fmt.Errorf("MacSign response is for %s, want %s", resp.Name, p.version)
+	}
+	mac, err := decodeBase64(resp.Mac)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyCRC32C(mac, optionalChecksum(resp.MacCrc32c)); err != nil {
+		return nil, fmt.Errorf("MacSign response corrupted in transit: MAC: %w", err)
+	}
+	if uint32(len(mac)) < outputLength {
+		return nil, fmt.Errorf("MacSign returned %d bytes, want at least %d", len(mac), outputLength)
+	}
+	return mac[:outputLength], nil
+}
@@ -0,0 +1,218 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const (
+	fakeMACKeyName    = "projects/p/locations/global/keyRings/r/cryptoKeys/mac"
+	fakeMACVersionURI = "gcp-kms://" + fakeMACKeyName + "/cryptoKeyVersions/1"
+)
+
+func newFakeMACKey(t *testing.T, algorithm string) *fakekms.Server {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateMACKey(fakeMACKeyName, algorithm); err != nil {
+		t.Fatalf("srv.CreateMACKey() err = %v, want nil", err)
+	}
+	return srv
+}
+
+func TestKMSPRFOutputLengths(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		size      uint32
+	}{
+		{"HMAC_SHA1", 20},
+		{"HMAC_SHA256", 32},
+		{"HMAC_SHA512", 64},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			srv := newFakeMACKey(t, tc.algorithm)
+			p, err := gcpkms.NewKMSPRF(context.Background(), fakeMACVersionURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+			if err != nil {
+				t.Fatalf("gcpkms.NewKMSPRF() err = %v, want nil", err)
+			}
+			input := []byte("record-id")
+			want, err := srv.MAC(fakeMACKeyName, 1, input)
+			if err != nil {
+				t.Fatalf("srv.MAC() err = %v, want nil", err)
+			}
+			for _, n := range []uint32{1, 16, tc.size - 1, tc.size} {
+				got, err := p.ComputePRF(input, n)
+				if err != nil {
+					t.Errorf("p.ComputePRF(%d) err = %v, want nil", n, err)
+					continue
+				}
+				if !bytes.Equal(got, want[:n]) {
+					t.Errorf("p.ComputePRF(%d) = %x, want %x", n, got, want[:n])
+				}
+			}
+			calls := srv.CallCount("MacSign")
+			if got, err := p.ComputePRF(input, 0); err != nil || len(got) != 0 {
+				t.Errorf("p.ComputePRF(0) = %x, %v, want empty output, nil", got, err)
+			}
+			if got := srv.CallCount("MacSign"); got != calls {
+				t.Errorf("MacSign called %d times after p.ComputePRF(0), want %d", got, calls)
+			}
+			for _, n := range []uint32{tc.size + 1, 1 << 31} {
+				if _, err := p.ComputePRF(input, n); err == nil {
+					t.Errorf("p.ComputePRF(%d) err = nil, want error", n)
+				}
+			}
+			if got := srv.CallCount("MacSign"); got != calls {
+				t.Errorf("MacSign called %d times after invalid output lengths, want %d", got, calls)
+			}
+		})
+	}
+}
+
+func TestKMSPRFIsDeterministic(t *testing.T) {
+	srv := newFakeMACKey(t, "HMAC_SHA256")
+	p, err := gcpkms.NewKMSPRF(context.Background(), fakeMACVersionURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewKMSPRF() err = %v, want nil", err)
+	}
+	a, err := p.ComputePRF([]byte("input"), 32)
+	if err != nil {
+		t.Fatalf("p.ComputePRF() err = %v, want nil", err)
+	}
+	b, err := p.ComputePRF([]byte("input"), 32)
+	if err != nil {
+		t.Fatalf("p.ComputePRF() err = %v, want nil", err)
+	}
+	if !bytes.Equal(a, b) {
+		t.Errorf("p.ComputePRF() = %x, then %x, want equal outputs", a, b)
+	}
+	c, err := p.ComputePRF([]byte("other input"), 32)
+	if err != nil {
+		t.Fatalf("p.ComputePRF() err = %v, want nil", err)
+	}
+	if bytes.Equal(a, c) {
+		t.Error("p.ComputePRF() returned the same output for different inputs")
+	}
+}
+
+func TestKMSPRFWithDisabledVersion(t *testing.T) {
+	srv := newFakeMACKey(t, "HMAC_SHA256")
+	p, err := gcpkms.NewKMSPRF(context.Background(), fakeMACVersionURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewKMSPRF() err = %v, want nil", err)
+	}
+	if err := srv.SetVersionState(fakeMACKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	var stateErr *gcpkms.KeyVersionStateError
+	if _, err := p.ComputePRF([]byte("input"), 32); !errors.As(err, &stateErr) {
+		t.Errorf("p.ComputePRF() err = %v, want *gcpkms.KeyVersionStateError", err)
+	}
+}
+
+func TestNewKMSPRFRejectsInvalidKeys(t *testing.T) {
+	srv := newFakeMACKey(t, "HMAC_SHA256")
+	if err := srv.CreateKey(fakeKeyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		keyURI string
+	}{
+		{name: "crypto key", keyURI: "gcp-kms://" + fakeMACKeyName},
+		{name: "other scheme", keyURI: "aws-kms://" + fakeMACKeyName + "/cryptoKeyVersions/1"},
+		{name: "missing version", keyURI: "gcp-kms://" + fakeMACKeyName + "/cryptoKeyVersions/2"},
+		{name: "encryption key", keyURI: fakeKeyURI + "/cryptoKeyVersions/1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewKMSPRF(context.Background(), tc.keyURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()); err == nil {
+				t.Errorf("gcpkms.NewKMSPRF(%q) err = nil, want error", tc.keyURI)
+			}
+		})
+	}
+}
+
+func TestKMSPRFRejectsCorruptedResponses(t *testing.T) {
+	version := fakeMACKeyName + "/cryptoKeyVersions/1"
+	mac := bytes.Repeat([]byte{0x42}, 32)
+	for _, tc := range []struct {
+		name string
+		resp *cloudkms.MacSignResponse
+		// want is the error that the error must wrap, if any.
+		want error
+	}{
+		{
+			name: "data checksum not verified",
+			resp: &cloudkms.MacSignResponse{Name: version, Mac: base64.StdEncoding.EncodeToString(mac), MacCrc32c: gcpkms.ComputeCRC32C(mac)},
+		},
+		{
+			name: "wrong MAC checksum",
+			resp: &cloudkms.MacSignResponse{Name: version, Mac: base64.StdEncoding.EncodeToString(mac), MacCrc32c: 0x1234, VerifiedDataCrc32c: true},
+			want: gcpkms.ErrChecksumMismatch,
+		},
+		{
+			name: "missing MAC checksum",
+			resp: &cloudkms.MacSignResponse{Name: version, Mac: base64.StdEncoding.EncodeToString(mac), VerifiedDataCrc32c: true},
+			want: gcpkms.ErrChecksumMissing,
+		},
+		{
+			name: "other version",
+			resp: &cloudkms.MacSignResponse{Name: fakeMACKeyName + "/cryptoKeyVersions/2", Mac: base64.StdEncoding.EncodeToString(mac), MacCrc32c: gcpkms.ComputeCRC32C(mac), VerifiedDataCrc32c: true},
+		},
+		{
+			name: "short MAC",
+			resp: &cloudkms.MacSignResponse{Name: version, Mac: base64.StdEncoding.EncodeToString(mac[:16]), MacCrc32c: gcpkms.ComputeCRC32C(mac[:16]), VerifiedDataCrc32c: true},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, ":macSign") {
+					json.NewEncoder(w).Encode(tc.resp)
+					return
+				}
+				json.NewEncoder(w).Encode(&cloudkms.CryptoKeyVersion{Name: version, Algorithm: "HMAC_SHA256", State: "ENABLED"})
+			}))
+			defer srv.Close()
+			p, err := gcpkms.NewKMSPRF(context.Background(), fakeMACVersionURI,
+				gcpkms.WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), gcpkms.WithInsecureTransport())
+			if err != nil {
+				t.Fatalf("gcpkms.NewKMSPRF() err = %v, want nil", err)
+			}
+			got, err := p.ComputePRF([]byte("input"), 32)
+			if err == nil {
+				t.Fatalf("p.ComputePRF() = %x, nil, want error", got)
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("p.ComputePRF() err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/option/internaloption"
+	"google.golang.org/api/transport"
+)
+
+var (
+	projectOfRegex     = regexp.MustCompile(`^projects/([^/]+)(/|$)`)
+	projectNumberRegex = regexp.MustCompile(`^[0-9]+$`)
+)
+
+// ErrProjectMismatch is matched by the *ProjectMismatchError returned when
+// the credentials of a client belong to another project than its key URIs.
+var ErrProjectMismatch = errors.New("gcpkms: credentials project does not match the key project")
+
+// ProjectMismatchError is returned by NewClient with
+// WithProjectConsistencyCheck(ProjectCheckStrict) when the project of the
+// credentials is not the project of a key URI prefix of the client. Requests
+// for keys in other projects fail with PermissionDenied unless the service
+// account was granted a role in that project.
+type ProjectMismatchError struct {
+	// CredentialsProject is the project of the credentials.
+	CredentialsProject string
+	// KeyURI is the key URI prefix in another project.
+	KeyURI string
+	// KeyProject is the project of KeyURI.
+	KeyProject string
+}
+
+func (e *ProjectMismatchError) Error() string {
+	return fmt.Sprintf("gcpkms: the credentials belong to project %s, but %s is in project %s", e.CredentialsProject, e.KeyURI, e.KeyProject)
+}
+
+// Is reports whether target is ErrProjectMismatch.
+func (e *ProjectMismatchError) Is(target error) bool {
+	return target == ErrProjectMismatch
+}
+
+// projectOf returns the project of the resource with the given name, e.g.
+// "p" for "projects/p/locations/global", or "" if name does not contain a
+// project.
+func projectOf(name string) string {
+	m := projectOfRegex.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// credentialsProject returns the project of the credentials that the client
+// would use, as named by the credentials JSON or, for the default
+// credentials on Google Cloud, the metadata server.
+func (cfg *config) credentialsProject(ctx context.Context) (string, error) {
+	if cfg.insecure || hasAPIOption(cfg.apiOptions, option.WithoutAuthentication()) || hasAPIOption(cfg.apiOptions, option.WithHTTPClient(nil)) {
+		return "", errors.New("the client does not use Google credentials")
+	}
+	opts := append([]option.ClientOption{internaloption.WithDefaultScopes(cloudkms.CloudPlatformScope, cloudkms.CloudkmsScope)}, cfg.apiOptions...)
+	if cfg.credentialsFile != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.credentialsFile))
+	}
+	creds, err := transport.Creds(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+	if creds.ProjectID == "" {
+		return "", errors.New("the credentials do not name a project")
+	}
+	return creds.ProjectID, nil
+}
+
+// checkProjectConsistency compares the project of the credentials with the
+// projects of the key URI prefixes, as set by WithProjectConsistencyCheck.
+// Prefixes without a project, or with a project number, are not checked.
+func (cfg *config) checkProjectConsistency(ctx context.Context, prefixes []string) error {
+	type keyProject struct{ uri, project string }
+	var keys []keyProject
+	for _, prefix := range prefixes {
+		project := projectOf(prefix[len(gcpPrefix):])
+		if project != "" && !projectNumberRegex.MatchString(project) {
+			keys = append(keys, keyProject{prefix, project})
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	credsProject, err := cfg.credentialsProject(ctx)
+	if err != nil {
+		err = fmt.Errorf("gcpkms: checking the project of the credentials failed: %v", err)
+		if cfg.projectCheckPolicy == ProjectCheckStrict {
+			return err
+		}
+		cfg.logger.Printf("%v", err)
+		return nil
+	}
+	for _, k := range keys {
+		if k.project == credsProject {
+			continue
+		}
+		err := &ProjectMismatchError{CredentialsProject: credsProject, KeyURI: k.uri, KeyProject: k.project}
+		if cfg.projectCheckPolicy == ProjectCheckStrict {
+			return err
+		}
+		cfg.logger.Printf("%v", err)
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// serviceAccountJSON returns service account credentials of the given
+// project. No tokens are issued for them.
+func serviceAccountJSON(t *testing.T, project string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() err = %v, want nil", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKCS8PrivateKey() err = %v, want nil", err)
+	}
+	b, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     project,
+		"private_key_id": "1",
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "sa@" + project + ".iam.gserviceaccount.com",
+		"client_id":      "1",
+		"token_uri":      "https://oauth2.googleapis.com/token",
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() err = %v, want nil", err)
+	}
+	return b
+}
+
+func TestWithProjectConsistencyCheck(t *testing.T) {
+	creds := serviceAccountJSON(t, "project-a")
+	for _, tc := range []struct {
+		name      string
+		uriPrefix string
+		opts      []gcpkms.Option
+		policy    gcpkms.ProjectCheckPolicy
+		wantErr   bool
+		wantLog   string
+	}{
+		{
+			name:      "match",
+			uriPrefix: "gcp-kms://projects/project-a/locations/global/keyRings/r",
+			policy:    gcpkms.ProjectCheckStrict,
+		},
+		{
+			name:      "mismatch with warning",
+			uriPrefix: "gcp-kms://projects/project-b/locations/global/keyRings/r",
+			policy:    gcpkms.ProjectCheckWarn,
+			wantLog:   "the credentials belong to project project-a, but gcp-kms://projects/project-b/locations/global/keyRings/r is in project project-b",
+		},
+		{
+			name:      "mismatch in strict mode",
+			uriPrefix: "gcp-kms://projects/project-b/locations/global/keyRings/r",
+			policy:    gcpkms.ProjectCheckStrict,
+			wantErr:   true,
+		},
+		{
+			name:      "mismatch of additional prefix",
+			uriPrefix: "gcp-kms://projects/project-a/locations/global/keyRings/r",
+			opts:      []gcpkms.Option{gcpkms.WithAdditionalPrefixes("gcp-kms://projects/project-b/locations/global/keyRings/r")},
+			policy:    gcpkms.ProjectCheckStrict,
+			wantErr:   true,
+		},
+		{
+			name:      "prefix without project",
+			uriPrefix: "gcp-kms://",
+			policy:    gcpkms.ProjectCheckStrict,
+		},
+		{
+			name:      "project number",
+			uriPrefix: "gcp-kms://projects/123456/locations/global/keyRings/r",
+			policy:    gcpkms.ProjectCheckStrict,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			opts := append([]gcpkms.Option{
+				gcpkms.WithGoogleAPIClientOptions(option.WithCredentialsJSON(creds)),
+				gcpkms.WithProjectConsistencyCheck(tc.policy),
+				gcpkms.WithLogger(log.New(&logs, "", 0)),
+			}, tc.opts...)
+			_, err := gcpkms.NewClient(context.Background(), tc.uriPrefix, opts...)
+			if tc.wantErr {
+				var mismatch *gcpkms.ProjectMismatchError
+				if !errors.As(err, &mismatch) || !errors.Is(err, gcpkms.ErrProjectMismatch) {
+					t.Fatalf("gcpkms.NewClient() err = %v, want a *ProjectMismatchError", err)
+				}
+				if mismatch.CredentialsProject != "project-a" || mismatch.KeyProject != "project-b" {
+					t.Errorf("mismatch = %+v, want projects project-a and project-b", mismatch)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+			}
+			if tc.wantLog == "" && logs.Len() > 0 {
+				t.Errorf("logs = %q, want none", logs.String())
+			}
+			if !strings.Contains(logs.String(), tc.wantLog) {
+				t.Errorf("logs = %q, want %q", logs.String(), tc.wantLog)
+			}
+		})
+	}
+}
+
+func TestWithProjectConsistencyCheckWithoutCredentialsProject(t *testing.T) {
+	srv := newFakeServer(t)
+	var logs bytes.Buffer
+	opts := []gcpkms.Option{
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...),
+		gcpkms.WithInsecureTransport(),
+		gcpkms.WithLogger(log.New(&logs, "", 0)),
+	}
+	if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, append(opts, gcpkms.WithProjectConsistencyCheck(gcpkms.ProjectCheckStrict))...); err == nil {
+		t.Error("gcpkms.NewClient() in strict mode err = nil, want error")
+	}
+	if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, append(opts, gcpkms.WithProjectConsistencyCheck(gcpkms.ProjectCheckWarn))...); err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	if !strings.Contains(logs.String(), "checking the project of the credentials failed") {
+		t.Errorf("logs = %q, want a warning", logs.String())
+	}
+}
+
+func TestCrossProjectKeysWithoutProjectConsistencyCheck(t *testing.T) {
+	var logs bytes.Buffer
+	_, err := gcpkms.NewClient(context.Background(), "gcp-kms://projects/project-b/locations/global/keyRings/r",
+		gcpkms.WithGoogleAPIClientOptions(option.WithCredentialsJSON(serviceAccountJSON(t, "project-a"))),
+		gcpkms.WithLogger(log.New(&logs, "", 0)))
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	if logs.Len() > 0 {
+		t.Errorf("logs = %q, want none", logs.String())
+	}
+}
+
+func TestWithProjectConsistencyCheckRejectsInvalidPolicies(t *testing.T) {
+	if _, err := gcpkms.NewClient(context.Background(), "gcp-kms://", gcpkms.WithProjectConsistencyCheck(gcpkms.ProjectCheckPolicy(7))); err == nil {
+		t.Error("gcpkms.NewClient() err = nil, want error")
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	// Register the hash functions used by Cloud KMS signing algorithms.
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// signAlgorithm describes how signatures of a Cloud KMS signing algorithm
+// are verified.
+type signAlgorithm struct {
+	// hash is zero for Ed25519, whose signatures cover the data rather than
+	// a digest of it.
+	hash crypto.Hash
+	// curve is the curve of ECDSA keys, and nil for RSA and Ed25519 keys.
+	curve elliptic.Curve
+	// rsaBits is the modulus size of RSA keys.
+	rsaBits int
+	pss     bool
+	ed25519 bool
+}
+
+// signAlgorithms holds the signing algorithms of Cloud KMS whose signatures
+// can be verified locally, by name.
+//
+// EC_SIGN_SECP256K1_SHA256 is not supported, so its keys are rejected by
+// parsePublicKey, as the standard library has no secp256k1 implementation.
+var signAlgorithms = map[string]signAlgorithm{
+	"EC_SIGN_ED25519":            {ed25519: true},
+	"EC_SIGN_P256_SHA256":        {hash: crypto.SHA256, curve: elliptic.P256()},
+	"EC_SIGN_P384_SHA384":        {hash: crypto.SHA384, curve: elliptic.P384()},
+	"RSA_SIGN_PKCS1_2048_SHA256": {hash: crypto.SHA256, rsaBits: 2048},
+	"RSA_SIGN_PKCS1_3072_SHA256": {hash: crypto.SHA256, rsaBits: 3072},
+	"RSA_SIGN_PKCS1_4096_SHA256": {hash: crypto.SHA256, rsaBits: 4096},
+	"RSA_SIGN_PKCS1_4096_SHA512": {hash: crypto.SHA512, rsaBits: 4096},
+	"RSA_SIGN_PSS_2048_SHA256":   {hash: crypto.SHA256, rsaBits: 2048, pss: true},
+	"RSA_SIGN_PSS_3072_SHA256":   {hash: crypto.SHA256, rsaBits: 3072, pss: true},
+	"RSA_SIGN_PSS_4096_SHA256":   {hash: crypto.SHA256, rsaBits: 4096, pss: true},
+	"RSA_SIGN_PSS_4096_SHA512":   {hash: crypto.SHA512, rsaBits: 4096, pss: true},
+}
+
+// deterministic returns true if signing the same digest twice returns the
+// same signature, which is the case for RSA PKCS #1 v1.5 and Ed25519 but not
+// for RSA-PSS and ECDSA, whose signatures are randomized.
+func (a signAlgorithm) deterministic() bool {
+	return a.curve == nil && !a.pss
+}
+
+// publicKey is the public key of a Cloud KMS signing key version, used to
+// verify its signatures locally.
+type publicKey struct {
+	// version is the resource name of the key version.
+	version         string
+	algorithm       string
+	protectionLevel string
+	alg             signAlgorithm
+	key             crypto.PublicKey
+}
+
+// parsePublicKey validates the response of GetPublicKey for the key version
+// with the given name and parses the key it holds.
+func parsePublicKey(version string, resp *cloudkms.PublicKey) (*publicKey, error) {
+	if resp.Name != "" && resp.Name != version {
+		return nil, fmt.Errorf("public key response is for %s, want %s", resp.Name, version)
+	}
+	if err := VerifyCRC32C([]byte(resp.Pem), wrapperspb.Int64(resp.PemCrc32c)); err != nil {
+		return nil, fmt.Errorf("public key response corrupted in transit: pem: %w", err)
+	}
+	alg, ok := signAlgorithms[resp.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", resp.Algorithm)
+	}
+	block, _ := pem.Decode([]byte(resp.Pem))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("public key is not a PEM encoded PUBLIC KEY")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing public key failed: %v", err)
+	}
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if alg.curve == nil || k.Curve != alg.curve {
+			return nil, fmt.Errorf("public key does not match algorithm %s", resp.Algorithm)
+		}
+	case *rsa.PublicKey:
+		if alg.curve != nil || k.N.BitLen() != alg.rsaBits {
+			return nil, fmt.Errorf("public key does not match algorithm %s", resp.Algorithm)
+		}
+	case ed25519.PublicKey:
+		if !alg.ed25519 {
+			return nil, fmt.Errorf("public key does not match algorithm %s", resp.Algorithm)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+	return &publicKey{version: version, algorithm: resp.Algorithm, protectionLevel: resp.ProtectionLevel, alg: alg, key: key}, nil
+}
+
+// verify returns nil if signature is a valid signature of data.
+func (p *publicKey) verify(signature, data []byte) error {
+	if k, ok := p.key.(ed25519.PublicKey); ok {
+		if !ed25519.Verify(k, data, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	h := p.alg.hash.New()
+	h.Write(data)
+	digest := h.Sum(nil)
+	switch k := p.key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	case *rsa.PublicKey:
+		if p.alg.pss {
+			return rsa.VerifyPSS(k, p.alg.hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(k, p.alg.hash, digest, signature)
+	default:
+		return fmt.Errorf("unsupported public key type %T", p.key)
+	}
+}
+
+// publicKeyCache caches the public keys of key versions by name, so that the
+// signers of a Client share them. Concurrent fetches of the public key of the
+// same version share one GetPublicKey request.
+type publicKeyCache struct {
+	group singleflight.Group
+
+	mu   sync.Mutex
+	keys map[string]*publicKey
+}
+
+func newPublicKeyCache() *publicKeyCache {
+	return &publicKeyCache{keys: make(map[string]*publicKey)}
+}
+
+// get returns the public key of the key version with the given name and
+// protection level, which may be empty if unknown, and fetches it with
+// getPublicKey if it is not cached. Concurrent fetches are bound to the ctx of
+// the first caller. If c is nil, the public key is always fetched.
+func (c *publicKeyCache) get(ctx context.Context, kms *cloudkms.Service, invoker *invoker, timeouts *callTimeouts, integrity *integrityRetry, keyVersionName, protectionLevel string) (*publicKey, error) {
+	if c == nil {
+		return getPublicKey(ctx, kms, invoker, timeouts, integrity, keyVersionName, protectionLevel)
+	}
+	c.mu.Lock()
+	pub, ok := c.keys[keyVersionName]
+	c.mu.Unlock()
+	if ok {
+		return pub, nil
+	}
+	v, err, _ := c.group.Do(keyVersionName, func() (any, error) {
+		pub, err := getPublicKey(ctx, kms, invoker, timeouts, integrity, keyVersionName, protectionLevel)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.keys[keyVersionName] = pub
+		c.mu.Unlock()
+		return pub, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(*publicKey), nil
+}
+
+// invalidate removes stale from the cache, unless it was replaced already, so
+// that the next call to get fetches the public key again. It does nothing if c
+// is nil.
+func (c *publicKeyCache) invalidate(stale *publicKey) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.keys[stale.version] == stale {
+		delete(c.keys, stale.version)
+		c.group.Forget(stale.version)
+	}
+}
@@ -0,0 +1,106 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// maxRandomBytes is the maximum number of bytes that GenerateRandomBytes
+// returns per request.
+const maxRandomBytes = 1024
+
+var locationRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+$`)
+
+// hsmRandReader serves random bytes generated by Cloud HSM.
+type hsmRandReader struct {
+	ctx      context.Context
+	location string
+	kms      *cloudkms.Service
+
+	mu  sync.Mutex
+	buf []byte
+}
+
+// NewHSMRandReader returns a reader of random bytes generated by Cloud HSM in
+// the given location, e.g. "projects/p/locations/us-east1". The bytes are
+// requested from Cloud KMS with GenerateRandomBytes in chunks of 1024 bytes,
+// whose CRC32C checksums are verified, and buffered locally. All requests are
+// bound to ctx. The reader is safe for concurrent use.
+//
+// The reader is meant as an additional source of randomness where HSM
+// randomness is required, e.g. for compliance. It is not a substitute for
+// crypto/rand.
+func NewHSMRandReader(ctx context.Context, location string, kms *cloudkms.Service) (io.Reader, error) {
+	if !locationRegex.MatchString(location) {
+		return nil, fmt.Errorf("invalid location %q, want projects/*/locations/*", location)
+	}
+	if kms == nil {
+		return nil, errors.New("kms must not be nil")
+	}
+	return &hsmRandReader{ctx: ctx, location: location, kms: kms}, nil
+}
+
+// Read fills p with random bytes. It only returns fewer than len(p) bytes
+// together with an error.
+func (r *hsmRandReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(p) {
+		if len(r.buf) == 0 {
+			if err := r.fill(); err != nil {
+				return n, err
+			}
+		}
+		c := copy(p[n:], r.buf)
+		r.buf = r.buf[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// fill replaces the empty buffer with a new chunk of random bytes.
+func (r *hsmRandReader) fill() error {
+	resp, err := r.kms.Projects.Locations.GenerateRandomBytes(r.location, &cloudkms.GenerateRandomBytesRequest{
+		LengthBytes:     maxRandomBytes,
+		ProtectionLevel: "HSM",
+	}).Context(r.ctx).Do()
+	if err != nil {
+		return fmt.Errorf("generating random bytes failed: %v", err)
+	}
+	data, err := decodeBase64(resp.Data)
+	if err != nil {
+		return err
+	}
+	if len(data) != maxRandomBytes {
+		return fmt.Errorf("generating random bytes failed: got %d bytes, want %d", len(data), maxRandomBytes)
+	}
+	if err := VerifyCRC32C(data, wrapperspb.Int64(resp.DataCrc32c)); err != nil {
+		return fmt.Errorf("generate random bytes response corrupted in transit: data: %w", err)
+	}
+	r.buf = data
+	return nil
+}
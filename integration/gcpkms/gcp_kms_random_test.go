@@ -0,0 +1,124 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+const fakeLocation = "projects/p/locations/global"
+
+func newKMSService(t testing.TB, opts ...option.ClientOption) *cloudkms.Service {
+	t.Helper()
+	kms, err := cloudkms.NewService(context.Background(), opts...)
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+	}
+	return kms
+}
+
+func TestHSMRandReaderChunksRequests(t *testing.T) {
+	srv := newFakeServer(t)
+	r, err := gcpkms.NewHSMRandReader(context.Background(), fakeLocation, newKMSService(t, srv.ClientOptions()...))
+	if err != nil {
+		t.Fatalf("gcpkms.NewHSMRandReader() err = %v, want nil", err)
+	}
+
+	small := make([]byte, 10)
+	for i := 0; i < 10; i++ {
+		if _, err := io.ReadFull(r, small); err != nil {
+			t.Fatalf("io.ReadFull() err = %v, want nil", err)
+		}
+	}
+	if got := srv.CallCount("GenerateRandomBytes"); got != 1 {
+		t.Errorf("GenerateRandomBytes called %d times, want 1", got)
+	}
+
+	// 100 buffered bytes have been read, so 2900 more bytes span three
+	// chunks.
+	large := make([]byte, 2900)
+	n, err := r.Read(large)
+	if err != nil || n != len(large) {
+		t.Fatalf("r.Read() = %d, %v, want %d, nil", n, err, len(large))
+	}
+	if got := srv.CallCount("GenerateRandomBytes"); got != 3 {
+		t.Errorf("GenerateRandomBytes called %d times, want 3", got)
+	}
+	if bytes.Equal(large[:1024], large[1024:2048]) {
+		t.Error("r.Read() returned the same chunk twice")
+	}
+}
+
+func TestHSMRandReaderRejectsCorruptedResponse(t *testing.T) {
+	data := bytes.Repeat([]byte{0x42}, 1024)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(&cloudkms.GenerateRandomBytesResponse{
+			Data:       base64.StdEncoding.EncodeToString(data),
+			DataCrc32c: 0x1234,
+		})
+	}))
+	defer srv.Close()
+	r, err := gcpkms.NewHSMRandReader(context.Background(), fakeLocation,
+		newKMSService(t, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()))
+	if err != nil {
+		t.Fatalf("gcpkms.NewHSMRandReader() err = %v, want nil", err)
+	}
+	buf := make([]byte, 16)
+	if n, err := r.Read(buf); err == nil || n != 0 {
+		t.Errorf("r.Read() = %d, %v, want 0, error", n, err)
+	}
+	// Corrupted data must not be served by later reads either.
+	if n, err := r.Read(buf); err == nil || n != 0 {
+		t.Errorf("r.Read() = %d, %v, want 0, error", n, err)
+	}
+}
+
+func TestHSMRandReaderWithCanceledContext(t *testing.T) {
+	srv := newFakeServer(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r, err := gcpkms.NewHSMRandReader(ctx, fakeLocation, newKMSService(t, srv.ClientOptions()...))
+	if err != nil {
+		t.Fatalf("gcpkms.NewHSMRandReader() err = %v, want nil", err)
+	}
+	if _, err := r.Read(make([]byte, 16)); err == nil {
+		t.Error("r.Read() with canceled context err = nil, want error")
+	}
+}
+
+func TestNewHSMRandReaderWithInvalidArguments(t *testing.T) {
+	kms := newKMSService(t, option.WithoutAuthentication())
+	for _, location := range []string{"", "projects/p", "projects/p/locations/l/keyRings/r", "locations/l"} {
+		if _, err := gcpkms.NewHSMRandReader(context.Background(), location, kms); err == nil {
+			t.Errorf("gcpkms.NewHSMRandReader(%q) err = nil, want error", location)
+		}
+	}
+	if _, err := gcpkms.NewHSMRandReader(context.Background(), fakeLocation, nil); err == nil {
+		t.Error("gcpkms.NewHSMRandReader() with nil kms err = nil, want error")
+	}
+}
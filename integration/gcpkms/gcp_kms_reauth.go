@@ -0,0 +1,112 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"google.golang.org/api/transport"
+)
+
+// minReauthInterval is the minimum time between two re-initializations of
+// the credentials, so that a burst of Unauthenticated errors triggers only
+// one.
+const minReauthInterval = time.Second
+
+// reauthTokenSource is a token source whose credentials can be
+// re-initialized, e.g. after the tokens they produce have been rejected.
+type reauthTokenSource struct {
+	newSource func() (oauth2.TokenSource, error)
+	clock     clock
+
+	mu         sync.Mutex
+	src        oauth2.TokenSource
+	lastReauth time.Time
+}
+
+// newReauthTokenSource returns a token source for the credentials configured
+// by opts, whose reauthentications are rate-limited with clk.
+func newReauthTokenSource(ctx context.Context, opts []option.ClientOption, clk clock) (*reauthTokenSource, error) {
+	s := &reauthTokenSource{
+		clock: clk,
+		newSource: func() (oauth2.TokenSource, error) {
+			creds, err := transport.Creds(ctx, opts...)
+			if err != nil {
+				return nil, err
+			}
+			return creds.TokenSource, nil
+		},
+	}
+	src, err := s.newSource()
+	if err != nil {
+		return nil, err
+	}
+	s.src = src
+	return s, nil
+}
+
+func (s *reauthTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	src := s.src
+	s.mu.Unlock()
+	return src.Token()
+}
+
+// reauthenticate re-initializes the credentials, so that the next token is
+// obtained from scratch, unless that happened very recently.
+func (s *reauthTokenSource) reauthenticate() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	if now.Sub(s.lastReauth) < minReauthInterval {
+		return nil
+	}
+	src, err := s.newSource()
+	if err != nil {
+		return err
+	}
+	s.src = src
+	s.lastReauth = now
+	return nil
+}
+
+// reload re-initializes the credentials, e.g. after the credentials file
+// changed. The current credentials are kept if this fails.
+func (s *reauthTokenSource) reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	src, err := s.newSource()
+	if err != nil {
+		return err
+	}
+	s.src = src
+	return nil
+}
+
+// isUnauthenticated returns true if err indicates that the request was
+// rejected because of its credentials.
+func isUnauthenticated(err error) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusUnauthorized
+}
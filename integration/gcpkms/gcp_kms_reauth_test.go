@@ -0,0 +1,221 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// authServer is a fake Cloud KMS server with its own OAuth 2.0 token
+// endpoint. The token endpoint issues "token-1", "token-2", and so on, and
+// records the ID of the service account key that signed the last token
+// request. Encrypt requests are rejected if their token is rejected by
+// accept. Cloud KMS requests use TLS, since NewClient rejects credentials
+// sent in plaintext.
+type authServer struct {
+	srv             *httptest.Server
+	tokenSrv        *httptest.Server
+	accept          func(token string) bool
+	tokenRequests   int32
+	encryptRequests int32
+	lastKeyID       atomic.Value
+}
+
+func newAuthServer(t *testing.T, accept func(token string) bool) *authServer {
+	t.Helper()
+	s := &authServer{accept: accept}
+	s.tokenSrv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&s.tokenRequests, 1)
+		s.lastKeyID.Store(assertionKeyID(r.FormValue("assertion")))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": fmt.Sprintf("token-%d", n),
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	t.Cleanup(s.tokenSrv.Close)
+	s.srv = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.encryptRequests, 1)
+		w.Header().Set("Content-Type", "application/json")
+		var token string
+		fmt.Sscanf(r.Header.Get("Authorization"), "Bearer %s", &token)
+		if !s.accept(token) {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{
+				"error": map[string]any{"code": 401, "status": "UNAUTHENTICATED", "message": "Request had invalid authentication credentials."},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(&cloudkms.EncryptResponse{
+			Ciphertext: base64.StdEncoding.EncodeToString([]byte("ciphertext")),
+		})
+	}))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// assertionKeyID returns the key ID in the header of a JWT assertion, or the
+// empty string if it cannot be parsed.
+func assertionKeyID(assertion string) string {
+	header, _, _ := strings.Cut(assertion, ".")
+	b, err := base64.RawURLEncoding.DecodeString(header)
+	if err != nil {
+		return ""
+	}
+	var h struct {
+		KeyID string `json:"kid"`
+	}
+	if err := json.Unmarshal(b, &h); err != nil {
+		return ""
+	}
+	return h.KeyID
+}
+
+// keyID returns the ID of the service account key that signed the last token
+// request.
+func (s *authServer) keyID() string {
+	id, _ := s.lastKeyID.Load().(string)
+	return id
+}
+
+// credentialsJSON returns service account credentials whose tokens are
+// issued by the server.
+func (s *authServer) credentialsJSON(t *testing.T) []byte {
+	t.Helper()
+	return s.credentialsJSONWithKeyID(t, "1")
+}
+
+// credentialsJSONWithKeyID is like credentialsJSON, with a new service
+// account key with the given ID.
+func (s *authServer) credentialsJSONWithKeyID(t *testing.T, keyID string) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() err = %v, want nil", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKCS8PrivateKey() err = %v, want nil", err)
+	}
+	b, err := json.Marshal(map[string]string{
+		"type":           "service_account",
+		"project_id":     "p",
+		"private_key_id": keyID,
+		"private_key":    string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"client_email":   "sa@p.iam.gserviceaccount.com",
+		"client_id":      "1",
+		"token_uri":      s.tokenSrv.URL + "/token",
+	})
+	if err != nil {
+		t.Fatalf("json.Marshal() err = %v, want nil", err)
+	}
+	return b
+}
+
+func (s *authServer) newAEAD(t *testing.T, opts ...gcpkms.Option) *gcpkms.AEAD {
+	t.Helper()
+	opts = append([]gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(
+		option.WithEndpoint(s.srv.URL+"/"), option.WithCredentialsJSON(s.credentialsJSON(t))),
+		gcpkms.WithBaseTransport(s.srv.Client().Transport)}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return a.(*gcpkms.AEAD)
+}
+
+func TestReauthenticationRetriesWithNewCredentials(t *testing.T) {
+	srv := newAuthServer(t, func(token string) bool { return token != "token-1" })
+	a := srv.newAEAD(t, gcpkms.WithReauthentication())
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got := atomic.LoadInt32(&srv.tokenRequests); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+	if got := atomic.LoadInt32(&srv.encryptRequests); got != 2 {
+		t.Errorf("Encrypt requests = %d, want 2", got)
+	}
+	// The new token is kept.
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got := atomic.LoadInt32(&srv.tokenRequests); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+}
+
+func TestReauthenticationGivesUpOnInvalidCredentials(t *testing.T) {
+	srv := newAuthServer(t, func(string) bool { return false })
+	a := srv.newAEAD(t, gcpkms.WithReauthentication())
+	_, err := a.Encrypt([]byte("plaintext"), nil)
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusUnauthorized {
+		t.Fatalf("a.Encrypt() err = %v, want error with code 401", err)
+	}
+	if got := atomic.LoadInt32(&srv.encryptRequests); got != 2 {
+		t.Errorf("Encrypt requests = %d, want 2", got)
+	}
+}
+
+func TestWithoutReauthentication(t *testing.T) {
+	srv := newAuthServer(t, func(token string) bool { return token != "token-1" })
+	a := srv.newAEAD(t)
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err == nil {
+		t.Fatal("a.Encrypt() err = nil, want error")
+	}
+	if got := atomic.LoadInt32(&srv.encryptRequests); got != 1 {
+		t.Errorf("Encrypt requests = %d, want 1", got)
+	}
+}
+
+func TestWithReauthenticationRejectsInsecureTransport(t *testing.T) {
+	if _, err := gcpkms.NewClient(context.Background(), "gcp-kms://", gcpkms.WithReauthentication(), gcpkms.WithInsecureTransport()); err == nil {
+		t.Error("gcpkms.NewClient() err = nil, want error")
+	}
+}
+
+func TestWithReauthenticationRejectsHTTPClient(t *testing.T) {
+	_, err := gcpkms.NewClient(context.Background(), "gcp-kms://", gcpkms.WithReauthentication(),
+		gcpkms.WithGoogleAPIClientOptions(option.WithHTTPClient(http.DefaultClient)))
+	if err == nil || !strings.Contains(err.Error(), "option.WithHTTPClient") {
+		t.Errorf("gcpkms.NewClient() err = %v, want error about option.WithHTTPClient", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	locationOfRegex       = regexp.MustCompile(`^projects/[^/]+/locations/([^/]+)(/|$)`)
+	regionalEndpointRegex = regexp.MustCompile(`^cloudkms\.([a-z0-9-]+)\.rep\.googleapis\.com$`)
+)
+
+// ErrLocationMismatch is matched by the *LocationMismatchError returned when
+// a key is used with the regional endpoint of another location.
+var ErrLocationMismatch = errors.New("gcpkms: key location does not match the endpoint")
+
+// LocationMismatchError is returned by Client.GetAEAD when the client calls
+// the regional endpoint of one location, e.g. set with option.WithEndpoint or
+// WithRegionalEndpoints, and the key is in another location. Cloud KMS would
+// otherwise reject every request with a NotFound error. Keys in the "global"
+// location require the global endpoint.
+type LocationMismatchError struct {
+	// Endpoint is the endpoint that the client calls.
+	Endpoint string
+	// EndpointLocation is the location served by Endpoint.
+	EndpointLocation string
+	// Name is the resource name of the key.
+	Name string
+	// Location is the location of the key.
+	Location string
+}
+
+func (e *LocationMismatchError) Error() string {
+	return fmt.Sprintf("gcpkms: %s is in location %s, but the client calls the endpoint %s of location %s", e.Name, e.Location, e.Endpoint, e.EndpointLocation)
+}
+
+// Is reports whether target is ErrLocationMismatch.
+func (e *LocationMismatchError) Is(target error) bool {
+	return target == ErrLocationMismatch
+}
+
+// locationOf returns the location of the resource with the given name, e.g.
+// "europe-west3" for "projects/p/locations/europe-west3/keyRings/r", or ""
+// if name does not contain a location.
+func locationOf(name string) string {
+	m := locationOfRegex.FindStringSubmatch(name)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// regionalEndpoint returns the Cloud KMS endpoint for the given location.
+func regionalEndpoint(location string) string {
+	if location == "global" {
+		return defaultEndpoint
+	}
+	return "https://cloudkms." + location + ".rep.googleapis.com/"
+}
+
+// endpointLocation returns the location served by the regional Cloud KMS
+// endpoint, e.g. "europe-west3" for
+// "https://cloudkms.europe-west3.rep.googleapis.com/", or "" if endpoint is
+// the global endpoint or an endpoint whose location is unknown, such as a
+// private one.
+func endpointLocation(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	m := regionalEndpointRegex.FindStringSubmatch(u.Hostname())
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// bindLocation points the client at the regional endpoint of the location of
+// the resource with the given name, if regional endpoints are enabled. Once
+// bound, resources in other locations are rejected. Without regional
+// endpoints, resources in another location than that of the endpoint, if
+// known, are rejected.
+func (c *Client) bindLocation(name string) error {
+	if !c.regionalEndpoints {
+		return c.checkEndpointLocation(name)
+	}
+	location := locationOf(name)
+	if location == "" {
+		return fmt.Errorf("regional endpoints require a location in %q", name)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.location == "" {
+		c.location = location
+		c.endpoint = regionalEndpoint(location)
+		c.kms.BasePath = c.endpoint
+		return nil
+	}
+	if c.location != location {
+		return &LocationMismatchError{Endpoint: c.endpoint, EndpointLocation: c.location, Name: name, Location: location}
+	}
+	return nil
+}
+
+// checkEndpointLocation returns a *LocationMismatchError if the client calls
+// the regional endpoint of another location than that of the resource with
+// the given name.
+func (c *Client) checkEndpointLocation(name string) error {
+	c.mu.Lock()
+	endpoint := c.endpoint
+	c.mu.Unlock()
+	endpointLoc := endpointLocation(endpoint)
+	if endpointLoc == "" {
+		return nil
+	}
+	if location := locationOf(name); location != "" && location != endpointLoc {
+		return &LocationMismatchError{Endpoint: endpoint, EndpointLocation: endpointLoc, Name: name, Location: location}
+	}
+	return nil
+}
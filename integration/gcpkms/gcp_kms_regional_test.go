@@ -0,0 +1,214 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"google.golang.org/api/option"
+)
+
+func TestRegionalEndpoint(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want string
+	}{
+		{name: "projects/p/locations/europe-west3/keyRings/r/cryptoKeys/k", want: "https://cloudkms.europe-west3.rep.googleapis.com/"},
+		{name: "projects/p/locations/us-central1/keyRings/r", want: "https://cloudkms.us-central1.rep.googleapis.com/"},
+		{name: "projects/p/locations/europe/keyRings/r/cryptoKeys/k", want: "https://cloudkms.europe.rep.googleapis.com/"},
+		{name: "projects/p/locations/us", want: "https://cloudkms.us.rep.googleapis.com/"},
+		{name: "projects/p/locations/global/keyRings/r/cryptoKeys/k", want: "https://cloudkms.googleapis.com/"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := regionalEndpoint(locationOf(tc.name)); got != tc.want {
+				t.Errorf("regionalEndpoint(locationOf(%q)) = %q, want %q", tc.name, got, tc.want)
+			}
+		})
+	}
+	for _, name := range []string{"", "projects/p", "projects/p/locations", "keyRings/r/locations/l"} {
+		if got := locationOf(name); got != "" {
+			t.Errorf("locationOf(%q) = %q, want \"\"", name, got)
+		}
+	}
+}
+
+func TestNewClientWithRegionalEndpointsFromURIPrefix(t *testing.T) {
+	c, err := NewClient(context.Background(), "gcp-kms://projects/p/locations/europe-west3/keyRings/r",
+		WithRegionalEndpoints(), WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	const want = "https://cloudkms.europe-west3.rep.googleapis.com/"
+	if c.kms.BasePath != want {
+		t.Errorf("c.kms.BasePath = %q, want %q", c.kms.BasePath, want)
+	}
+	if _, err := c.GetAEAD("gcp-kms://projects/p/locations/europe-west3/keyRings/r/cryptoKeys/k"); err != nil {
+		t.Errorf("c.GetAEAD() err = %v, want nil", err)
+	}
+}
+
+func TestNewClientWithRegionalEndpointsFromFirstKey(t *testing.T) {
+	c, err := NewClient(context.Background(), "gcp-kms://", WithRegionalEndpoints(), WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	if c.kms.BasePath != defaultEndpoint {
+		t.Errorf("c.kms.BasePath = %q, want %q", c.kms.BasePath, defaultEndpoint)
+	}
+	if _, err := c.GetAEAD("gcp-kms://projects/p/locations/asia-east1/keyRings/r/cryptoKeys/k"); err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	const want = "https://cloudkms.asia-east1.rep.googleapis.com/"
+	if c.kms.BasePath != want || c.endpoint != want {
+		t.Errorf("c.kms.BasePath, c.endpoint = %q, %q, want %q", c.kms.BasePath, c.endpoint, want)
+	}
+	if _, err := c.GetAEAD("gcp-kms://projects/p/locations/asia-east1/keyRings/r/cryptoKeys/k2"); err != nil {
+		t.Errorf("c.GetAEAD() for key in the same location err = %v, want nil", err)
+	}
+	for _, keyURI := range []string{
+		"gcp-kms://projects/p/locations/us-east1/keyRings/r/cryptoKeys/k",
+		"gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k",
+		"gcp-kms://invalid",
+	} {
+		if _, err := c.GetAEAD(keyURI); err == nil {
+			t.Errorf("c.GetAEAD(%q) err = nil, want error", keyURI)
+		}
+	}
+}
+
+func TestNewClientWithoutRegionalEndpointsServesAllLocations(t *testing.T) {
+	c, err := NewClient(context.Background(), "gcp-kms://", WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	for _, keyURI := range []string{
+		"gcp-kms://projects/p/locations/us-east1/keyRings/r/cryptoKeys/k",
+		"gcp-kms://projects/p/locations/europe-west3/keyRings/r/cryptoKeys/k",
+	} {
+		if _, err := c.GetAEAD(keyURI); err != nil {
+			t.Errorf("c.GetAEAD(%q) err = %v, want nil", keyURI, err)
+		}
+	}
+	if c.kms.BasePath != defaultEndpoint {
+		t.Errorf("c.kms.BasePath = %q, want %q", c.kms.BasePath, defaultEndpoint)
+	}
+}
+
+func TestEndpointLocation(t *testing.T) {
+	for _, tc := range []struct {
+		endpoint string
+		want     string
+	}{
+		{endpoint: "https://cloudkms.europe-west3.rep.googleapis.com/", want: "europe-west3"},
+		{endpoint: "https://cloudkms.us-central1.rep.googleapis.com:443/", want: "us-central1"},
+		{endpoint: "cloudkms.asia-east1.rep.googleapis.com", want: "asia-east1"},
+		{endpoint: "https://cloudkms.us.rep.googleapis.com/", want: "us"},
+		{endpoint: "https://cloudkms.europe.rep.googleapis.com/", want: "europe"},
+		{endpoint: defaultEndpoint, want: ""},
+		{endpoint: "https://cloudkms.mtls.googleapis.com/", want: ""},
+		{endpoint: "http://127.0.0.1:1234/", want: ""},
+		{endpoint: "https://kms.example.com/", want: ""},
+		{endpoint: "https://cloudkms.europe-west3.rep.googleapis.com.example.com/", want: ""},
+		{endpoint: "", want: ""},
+	} {
+		if got := endpointLocation(tc.endpoint); got != tc.want {
+			t.Errorf("endpointLocation(%q) = %q, want %q", tc.endpoint, got, tc.want)
+		}
+	}
+}
+
+func TestGetAEADDetectsLocationMismatch(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		endpoint string
+		location string
+		wantErr  bool
+	}{
+		{name: "matching region", endpoint: "https://cloudkms.europe-west3.rep.googleapis.com/", location: "europe-west3"},
+		{name: "other region", endpoint: "https://cloudkms.europe-west3.rep.googleapis.com/", location: "us-central1", wantErr: true},
+		{name: "global key on regional endpoint", endpoint: "https://cloudkms.europe-west3.rep.googleapis.com/", location: "global", wantErr: true},
+		{name: "global key on global endpoint", endpoint: defaultEndpoint, location: "global"},
+		{name: "regional key on global endpoint", endpoint: defaultEndpoint, location: "us-central1"},
+		{name: "matching multi-region", endpoint: "https://cloudkms.us.rep.googleapis.com/", location: "us"},
+		{name: "region in multi-region", endpoint: "https://cloudkms.us.rep.googleapis.com/", location: "us-central1", wantErr: true},
+		{name: "multi-region on regional endpoint", endpoint: "https://cloudkms.europe-west3.rep.googleapis.com/", location: "europe", wantErr: true},
+		{name: "unknown endpoint", endpoint: "https://kms.example.com/", location: "us-central1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := NewClient(context.Background(), "gcp-kms://",
+				WithGoogleAPIClientOptions(option.WithEndpoint(tc.endpoint), option.WithoutAuthentication()), WithAllowUnauthenticated())
+			if err != nil {
+				t.Fatalf("NewClient() err = %v, want nil", err)
+			}
+			name := "projects/p/locations/" + tc.location + "/keyRings/r/cryptoKeys/k"
+			_, err = c.GetAEAD(gcpPrefix + name)
+			if !tc.wantErr {
+				if err != nil {
+					t.Errorf("c.GetAEAD() err = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrLocationMismatch) {
+				t.Fatalf("c.GetAEAD() err = %v, want %v", err, ErrLocationMismatch)
+			}
+			var mismatchErr *LocationMismatchError
+			if !errors.As(err, &mismatchErr) {
+				t.Fatalf("c.GetAEAD() err = %v, want *LocationMismatchError", err)
+			}
+			want := LocationMismatchError{
+				Endpoint:         tc.endpoint,
+				EndpointLocation: endpointLocation(tc.endpoint),
+				Name:             name,
+				Location:         tc.location,
+			}
+			if *mismatchErr != want {
+				t.Errorf("c.GetAEAD() err = %+v, want %+v", *mismatchErr, want)
+			}
+		})
+	}
+}
+
+func TestNewKMSPRFDetectsLocationMismatch(t *testing.T) {
+	_, err := NewKMSPRF(context.Background(), "gcp-kms://projects/p/locations/us-east1/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1",
+		WithGoogleAPIClientOptions(option.WithEndpoint("https://cloudkms.europe-west3.rep.googleapis.com/"), option.WithoutAuthentication()), WithAllowUnauthenticated())
+	if !errors.Is(err, ErrLocationMismatch) {
+		t.Errorf("NewKMSPRF() err = %v, want %v", err, ErrLocationMismatch)
+	}
+}
+
+func TestRegionalEndpointsRejectOtherLocationsWithLocationMismatch(t *testing.T) {
+	c, err := NewClient(context.Background(), "gcp-kms://", WithRegionalEndpoints(), WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	if _, err := c.GetAEAD("gcp-kms://projects/p/locations/europe-west3/keyRings/r/cryptoKeys/k"); err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := c.GetAEAD("gcp-kms://projects/p/locations/us-east1/keyRings/r/cryptoKeys/k"); !errors.Is(err, ErrLocationMismatch) {
+		t.Errorf("c.GetAEAD() err = %v, want %v", err, ErrLocationMismatch)
+	}
+}
+
+func TestWithRegionalEndpointsRejectsClientCertSource(t *testing.T) {
+	src := func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return nil, nil }
+	if _, err := NewClient(context.Background(), "gcp-kms://", WithRegionalEndpoints(), WithClientCertSource(src)); err == nil {
+		t.Error("NewClient() err = nil, want error")
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// ErrOperationNotPermitted is matched by errors returned by the primitives of
+// GetEncryptOnlyAEAD and GetDecryptOnlyAEAD when the operation they do not
+// permit is called. No request is sent to Cloud KMS in that case.
+var ErrOperationNotPermitted = errors.New("gcpkms: operation not permitted")
+
+// EncryptOnlyAEAD is an AEAD that encrypts with a Cloud KMS key, but refuses
+// to decrypt, e.g. to enforce separation of duties in the service holding
+// it.
+//
+// The primitives returned by Client.GetEncryptOnlyAEAD are of type
+// *EncryptOnlyAEAD.
+type EncryptOnlyAEAD struct {
+	a *AEAD
+}
+
+var _ tink.AEAD = (*EncryptOnlyAEAD)(nil)
+
+// Encrypt encrypts the plaintext with associatedData.
+func (e *EncryptOnlyAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return e.a.Encrypt(plaintext, associatedData)
+}
+
+// EncryptWithContext is like Encrypt, but the request to Cloud KMS is bound
+// to ctx.
+func (e *EncryptOnlyAEAD) EncryptWithContext(ctx context.Context, plaintext, associatedData []byte) ([]byte, error) {
+	return e.a.EncryptWithContext(ctx, plaintext, associatedData)
+}
+
+// EncryptWithMetadata is like AEAD.EncryptWithMetadata.
+func (e *EncryptOnlyAEAD) EncryptWithMetadata(ctx context.Context, plaintext, associatedData []byte) (*EncryptResult, error) {
+	return e.a.EncryptWithMetadata(ctx, plaintext, associatedData)
+}
+
+// EncryptInto is like AEAD.EncryptInto.
+func (e *EncryptOnlyAEAD) EncryptInto(ctx context.Context, dst, plaintext, associatedData []byte) ([]byte, error) {
+	return e.a.EncryptInto(ctx, dst, plaintext, associatedData)
+}
+
+// Decrypt returns an error matching ErrOperationNotPermitted.
+func (e *EncryptOnlyAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return nil, fmt.Errorf("%w: %s is encrypt-only", ErrOperationNotPermitted, e.a.keyURI)
+}
+
+// DecryptOnlyAEAD is an AEAD that decrypts with a Cloud KMS key, but refuses
+// to encrypt.
+//
+// The primitives returned by Client.GetDecryptOnlyAEAD are of type
+// *DecryptOnlyAEAD.
+type DecryptOnlyAEAD struct {
+	a *AEAD
+}
+
+var _ tink.AEAD = (*DecryptOnlyAEAD)(nil)
+
+// Encrypt returns an error matching ErrOperationNotPermitted.
+func (d *DecryptOnlyAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return nil, fmt.Errorf("%w: %s is decrypt-only", ErrOperationNotPermitted, d.a.keyURI)
+}
+
+// Decrypt decrypts ciphertext with associatedData.
+func (d *DecryptOnlyAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return d.a.Decrypt(ciphertext, associatedData)
+}
+
+// DecryptWithMetadata is like AEAD.DecryptWithMetadata.
+func (d *DecryptOnlyAEAD) DecryptWithMetadata(ctx context.Context, ciphertext, associatedData []byte) (*DecryptResult, error) {
+	return d.a.DecryptWithMetadata(ctx, ciphertext, associatedData)
+}
+
+// DecryptInto is like AEAD.DecryptInto.
+func (d *DecryptOnlyAEAD) DecryptInto(ctx context.Context, dst, ciphertext, associatedData []byte) ([]byte, error) {
+	return d.a.DecryptInto(ctx, dst, ciphertext, associatedData)
+}
+
+// GetEncryptOnlyAEAD is like GetAEAD, but the returned primitive, an
+// *EncryptOnlyAEAD, refuses to decrypt.
+func (c *Client) GetEncryptOnlyAEAD(keyURI string) (tink.AEAD, error) {
+	a, err := c.GetAEAD(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptOnlyAEAD{a: a.(*AEAD)}, nil
+}
+
+// GetDecryptOnlyAEAD is like GetAEAD, but the returned primitive, a
+// *DecryptOnlyAEAD, refuses to encrypt.
+func (c *Client) GetDecryptOnlyAEAD(keyURI string) (tink.AEAD, error) {
+	a, err := c.GetAEAD(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	return &DecryptOnlyAEAD{a: a.(*AEAD)}, nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// newRestrictedAEADs returns the encrypt-only and decrypt-only primitives of
+// the same fake key.
+func newRestrictedAEADs(t *testing.T, srv *fakekms.Server) (tink.AEAD, tink.AEAD) {
+	t.Helper()
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	enc, err := client.GetEncryptOnlyAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetEncryptOnlyAEAD() err = %v, want nil", err)
+	}
+	dec, err := client.GetDecryptOnlyAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetDecryptOnlyAEAD() err = %v, want nil", err)
+	}
+	return enc, dec
+}
+
+func TestRestrictedAEADsPermittedOperations(t *testing.T) {
+	srv := newFakeServer(t)
+	enc, dec := newRestrictedAEADs(t, srv)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	ciphertext, err := enc.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("enc.Encrypt() err = %v, want nil", err)
+	}
+	got, err := dec.Decrypt(ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("dec.Decrypt() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("dec.Decrypt() = %q, want %q", got, plaintext)
+	}
+
+	ciphertext, err = enc.(*gcpkms.EncryptOnlyAEAD).EncryptWithContext(context.Background(), plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("enc.EncryptWithContext() err = %v, want nil", err)
+	}
+	res, err := dec.(*gcpkms.DecryptOnlyAEAD).DecryptWithMetadata(context.Background(), ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("dec.DecryptWithMetadata() err = %v, want nil", err)
+	}
+	if !bytes.Equal(res.Plaintext, plaintext) {
+		t.Errorf("dec.DecryptWithMetadata().Plaintext = %q, want %q", res.Plaintext, plaintext)
+	}
+}
+
+func TestRestrictedAEADsForbiddenOperations(t *testing.T) {
+	srv := newFakeServer(t)
+	enc, dec := newRestrictedAEADs(t, srv)
+	ciphertext, err := newFakeAEAD(t, srv).Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("Encrypt() err = %v, want nil", err)
+	}
+	encrypts, decrypts := srv.CallCount("Encrypt"), srv.CallCount("Decrypt")
+
+	if _, err := enc.Decrypt(ciphertext, nil); !errors.Is(err, gcpkms.ErrOperationNotPermitted) {
+		t.Errorf("enc.Decrypt() err = %v, want %v", err, gcpkms.ErrOperationNotPermitted)
+	}
+	if _, err := dec.Encrypt([]byte("plaintext"), nil); !errors.Is(err, gcpkms.ErrOperationNotPermitted) {
+		t.Errorf("dec.Encrypt() err = %v, want %v", err, gcpkms.ErrOperationNotPermitted)
+	}
+	if got := srv.CallCount("Encrypt"); got != encrypts {
+		t.Errorf("Encrypt called %d times, want 0", got-encrypts)
+	}
+	if got := srv.CallCount("Decrypt"); got != decrypts {
+		t.Errorf("Decrypt called %d times, want 0", got-decrypts)
+	}
+}
+
+func TestRestrictedAEADsUnsupportedKeyURI(t *testing.T) {
+	srv := newFakeServer(t)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	defer client.Close()
+	const keyURI = "gcp-kms://projects/other/locations/global/keyRings/r/cryptoKeys/k"
+	if _, err := client.GetEncryptOnlyAEAD(keyURI); err == nil {
+		t.Errorf("client.GetEncryptOnlyAEAD(%q) err = nil, want error", keyURI)
+	}
+	if _, err := client.GetDecryptOnlyAEAD(keyURI); err == nil {
+		t.Errorf("client.GetDecryptOnlyAEAD(%q) err = nil, want error", keyURI)
+	}
+}
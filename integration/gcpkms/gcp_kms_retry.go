@@ -0,0 +1,462 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	defaultRetryBudgetRatio     = 0.1
+	defaultRetryBudgetMinTokens = 10
+	defaultMaxAttempts          = 3
+	defaultInitialBackoff       = 100 * time.Millisecond
+	defaultMaxBackoff           = 5 * time.Second
+	defaultBackoffMultiplier    = 2
+)
+
+// retryBudget is a token bucket shared by all primitives of a Client that
+// limits how many retries they issue, similar to gRPC's retry throttling.
+//
+// The bucket starts with minTokens tokens, which is also its capacity. Each
+// retry costs one token and each successful call earns ratio tokens, so that
+// once the backend is unhealthy retries stop until calls succeed again.
+type retryBudget struct {
+	mu        sync.Mutex
+	ratio     float64
+	maxTokens float64
+	tokens    float64
+}
+
+func newRetryBudget(ratio float64, minTokens int) *retryBudget {
+	return &retryBudget{
+		ratio:     ratio,
+		maxTokens: float64(minTokens),
+		tokens:    float64(minTokens),
+	}
+}
+
+// onSuccess refills the budget after a successful call.
+func (b *retryBudget) onSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens += b.ratio
+	if b.tokens > b.maxTokens {
+		b.tokens = b.maxTokens
+	}
+}
+
+// tryAcquire takes the token required for a retry. It returns false if the
+// budget is exhausted.
+func (b *retryBudget) tryAcquire() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// invoker issues the RPCs of all primitives of a Client and retries them on
+// transient errors.
+type invoker struct {
+	budget         *retryBudget
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	multiplier     float64
+	// jitter randomizes a backoff. It is replaced in tests.
+	jitter func(backoff time.Duration) time.Duration
+	// reauth is nil if reauthentication is disabled.
+	reauth *reauthTokenSource
+	// clock times the backoff between attempts, hedged requests and slow
+	// calls. It is shared with the other parts of the Client.
+	clock clock
+	// requestIDHook is nil if no hook is configured.
+	requestIDHook func(RequestInfo)
+	// slowCallHook is nil if no slow-call threshold is configured. Its panics
+	// are reported to logger.
+	slowCallThreshold time.Duration
+	slowCallHook      func(SlowCallInfo)
+	logger            *log.Logger
+	// calls limits the number of concurrent RPCs to maxCalls. It is nil if
+	// the number is not limited.
+	calls    *semaphore.Weighted
+	maxCalls int
+	// inFlight is the number of RPCs currently in flight.
+	inFlight atomic.Int64
+	// newKeyGracePeriod is 0 if NOT_FOUND errors are not retried.
+	newKeyGracePeriod time.Duration
+	// hedgeDelay is 0 if hedging is disabled.
+	hedgeDelay time.Duration
+	maxHedges  int
+	// hedges is the number of hedged requests issued so far.
+	hedges atomic.Int64
+	// closer is nil if the calls cannot be canceled by Client.Close.
+	closer *closer
+	// retryPredicate is nil unless WithRetryPredicate is used, in which case
+	// it replaces the default retry policy.
+	retryPredicate func(op Method, attempt int, err error) (retry bool, backoff time.Duration)
+}
+
+func newInvoker(cfg *config, reauth *reauthTokenSource) *invoker {
+	i := &invoker{
+		budget:         newRetryBudget(cfg.retryBudgetRatio, cfg.retryBudgetMinTokens),
+		maxAttempts:    cfg.retrySettings.MaxAttempts,
+		initialBackoff: cfg.retrySettings.InitialBackoff,
+		maxBackoff:     cfg.retrySettings.MaxBackoff,
+		multiplier:     cfg.retrySettings.Multiplier,
+		jitter:         jitter,
+		clock:          cfg.clock,
+		requestIDHook:  cfg.requestIDHook,
+
+		slowCallThreshold: cfg.slowCallThreshold,
+		slowCallHook:      cfg.slowCallHook,
+		logger:            cfg.logger,
+	}
+	if cfg.reauthentication {
+		// The token source may also exist for WithCredentialsFileWatch.
+		i.reauth = reauth
+	}
+	i.newKeyGracePeriod = cfg.newKeyGracePeriod
+	i.hedgeDelay = cfg.hedgeDelay
+	i.maxHedges = cfg.maxHedges
+	i.closer = newCloser(cfg.closeGracePeriod, cfg.clock)
+	i.retryPredicate = cfg.retryPredicate
+	if cfg.maxConcurrentCalls > 0 {
+		i.calls = semaphore.NewWeighted(int64(cfg.maxConcurrentCalls))
+		i.maxCalls = cfg.maxConcurrentCalls
+	}
+	return i
+}
+
+// jitter returns a random duration in [backoff/2, backoff], so that clients
+// failing at the same time do not retry in lockstep.
+func jitter(backoff time.Duration) time.Duration {
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// now returns the current time of the clock of i, or of the real clock if i
+// is nil.
+func (i *invoker) now() time.Time {
+	if i == nil {
+		return time.Now()
+	}
+	return i.clock.Now()
+}
+
+// call invokes fn, which calls the Cloud KMS method op, until it succeeds, it
+// fails with a non-retryable error, the attempts or the retry budget are
+// exhausted, or ctx is done, which includes the Client being closed. After
+// Close, call fails with ErrClientClosed. If reauthentication is enabled, fn
+// is also retried once after it fails because of its credentials.
+//
+// The backoff between attempts grows exponentially up to a maximum and is
+// jittered. Every attempt first waits until fewer than the maximum number of
+// concurrent calls are in flight, if limited. If Cloud KMS asks for a retry
+// delay, in a RetryInfo detail or a Retry-After header, it is waited instead,
+// and quota errors are only retried in that case. Errors are not retried if
+// the delay would exceed the deadline of ctx. Quota errors are returned as
+// *QuotaError, and all errors returned by Cloud KMS are wrapped in a
+// *KMSError.
+//
+// With WithRetryPredicate, the predicate decides instead whether and after
+// which backoff an error is retried, within the deadline and the retry budget.
+func (i *invoker) call(ctx context.Context, op Method, fn func(ctx context.Context) error) error {
+	ctx, end, err := i.closer.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return end(i.retry(ctx, op, fn))
+}
+
+// retry implements call, without tracking the call for Client.Close.
+func (i *invoker) retry(ctx context.Context, op Method, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		err = kmsError(err)
+	}()
+	backoff := i.initialBackoff
+	reauthenticated := false
+	for attempt := 1; ; attempt++ {
+		err := i.attempt(ctx, fn)
+		if err == nil {
+			i.budget.onSuccess()
+			return nil
+		}
+		if i.reauth != nil && !reauthenticated && isUnauthenticated(err) {
+			reauthenticated = true
+			if reauthErr := i.reauth.reauthenticate(); reauthErr != nil {
+				return fmt.Errorf("%w (reauthentication failed: %v)", err, reauthErr)
+			}
+			// The retry with the new credentials is not counted as an
+			// attempt.
+			attempt--
+			continue
+		}
+		err = kmsError(quotaError(err))
+		var delay time.Duration
+		if i.retryPredicate != nil {
+			retry, d := i.retryPredicate(op, attempt, err)
+			if !retry {
+				return err
+			}
+			delay = d
+		} else {
+			if !isRetryable(err) || attempt >= i.maxAttempts {
+				return err
+			}
+			delay = i.jitter(backoff)
+			if d, ok := retryDelay(err); ok {
+				delay = d
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && deadline.Sub(i.clock.Now()) < delay {
+			return err
+		}
+		if !i.budget.tryAcquire() {
+			return fmt.Errorf("%w (retry budget exhausted)", err)
+		}
+		if i.clock.Sleep(ctx, delay) != nil {
+			return err
+		}
+		backoff = time.Duration(float64(backoff) * i.multiplier)
+		if backoff > i.maxBackoff {
+			backoff = i.maxBackoff
+		}
+	}
+}
+
+// do is like retry, but calls fn once, without retries or limits, if i is
+// nil, i.e. for signers and verifiers that were not created by a Client.
+func (i *invoker) do(ctx context.Context, op Method, fn func(ctx context.Context) error) error {
+	if i == nil {
+		return fn(ctx)
+	}
+	return i.retry(ctx, op, fn)
+}
+
+// callNewKey is like call, but also retries NOT_FOUND errors about the key
+// with the given name with backoff until the new-key grace period, if any,
+// has elapsed. It must only be used for requests for which NOT_FOUND means
+// that the key does not exist yet.
+func (i *invoker) callNewKey(ctx context.Context, op Method, keyName string, fn func(ctx context.Context) error) error {
+	ctx, end, err := i.closer.begin(ctx)
+	if err != nil {
+		return err
+	}
+	return end(i.retryNewKey(ctx, op, keyName, fn))
+}
+
+// retryNewKey implements callNewKey, without tracking the call for
+// Client.Close.
+func (i *invoker) retryNewKey(ctx context.Context, op Method, keyName string, fn func(ctx context.Context) error) error {
+	if i.newKeyGracePeriod == 0 {
+		return i.retry(ctx, op, fn)
+	}
+	deadline := i.clock.Now().Add(i.newKeyGracePeriod)
+	backoff := i.initialBackoff
+	for {
+		err := i.retry(ctx, op, fn)
+		if err == nil || !isNotFound(err) {
+			return err
+		}
+		delay := i.jitter(backoff)
+		if i.clock.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("%w: %s was not found within the new-key grace period of %v: %w", ErrKeyNotFound, keyName, i.newKeyGracePeriod, err)
+		}
+		if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Sub(i.clock.Now()) < delay {
+			return fmt.Errorf("%w: %s: %w", ErrKeyPropagating, keyName, err)
+		}
+		if i.clock.Sleep(ctx, delay) != nil {
+			return fmt.Errorf("%w: %s: %w", ErrKeyPropagating, keyName, err)
+		}
+		backoff = time.Duration(float64(backoff) * i.multiplier)
+		if backoff > i.maxBackoff {
+			backoff = i.maxBackoff
+		}
+	}
+}
+
+// attempt calls fn once it may issue an RPC without exceeding the maximum
+// number of concurrent calls, and counts it as in flight in the meantime. It
+// returns the context's error if ctx is done while waiting.
+func (i *invoker) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if i.calls != nil {
+		if err := i.calls.Acquire(ctx, 1); err != nil {
+			return err
+		}
+	}
+	i.inFlight.Add(1)
+	defer i.done()
+	return fn(ctx)
+}
+
+// tryStart counts a request as in flight and returns true, unless this would
+// exceed the maximum number of concurrent calls.
+func (i *invoker) tryStart() bool {
+	if i.calls != nil && !i.calls.TryAcquire(1) {
+		return false
+	}
+	i.inFlight.Add(1)
+	return true
+}
+
+// done counts a request started by attempt or tryStart as finished.
+func (i *invoker) done() {
+	i.inFlight.Add(-1)
+	if i.calls != nil {
+		i.calls.Release(1)
+	}
+}
+
+// hedgeResult is the outcome of one of the requests issued by hedge.
+type hedgeResult[T any] struct {
+	v   T
+	err error
+}
+
+// hedge calls fn and, if hedging is enabled and fn has not returned after
+// the hedge delay, calls it again, up to the maximum number of hedges, once
+// per delay. It returns the result of the first call that succeeds, or the
+// first error if all calls fail, and cancels the other calls and waits for
+// them before returning. fn must be safe to call concurrently, and must only
+// be used for requests without side effects, such as Decrypt and
+// GetPublicKey.
+//
+// The first call is expected to be counted as in flight by the caller, e.g.
+// through call. Hedged calls are counted too, and are skipped rather than
+// delayed if they would exceed the maximum number of concurrent calls.
+func hedge[T any](ctx context.Context, i *invoker, fn func(ctx context.Context) (T, error)) (T, error) {
+	if i.hedgeDelay == 0 {
+		return fn(ctx)
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan hedgeResult[T], 1+i.maxHedges)
+	run := func() {
+		v, err := fn(ctx)
+		results <- hedgeResult[T]{v: v, err: err}
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run()
+	}()
+	timer := i.clock.NewTimer(i.hedgeDelay)
+	defer timer.Stop()
+	outstanding, hedges := 1, 0
+	var firstErr error
+	for {
+		select {
+		case r := <-results:
+			if r.err == nil {
+				return r.v, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			outstanding--
+			if outstanding == 0 {
+				var zero T
+				return zero, firstErr
+			}
+		case <-timer.C():
+			if i.tryStart() {
+				hedges++
+				outstanding++
+				i.hedges.Add(1)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					defer i.done()
+					run()
+				}()
+			}
+			if hedges < i.maxHedges {
+				timer.Reset(i.hedgeDelay)
+			}
+		}
+	}
+}
+
+// succeeded calls the request ID hook, if any, after a successful request of
+// the given Cloud KMS method.
+func (i *invoker) succeeded(method, keyName string, resp googleapi.ServerResponse) {
+	if i.requestIDHook == nil {
+		return
+	}
+	i.requestIDHook(RequestInfo{
+		Method:    method,
+		KeyName:   keyName,
+		RequestID: resp.Header.Get(requestIDHeader),
+	})
+}
+
+// finished reports the operation of the given Cloud KMS method that started
+// at start and returned err to the slow-call hook, if any, if it took longer
+// than the threshold. The hook runs on its own goroutine, so that it does not
+// delay the caller, and its panics are logged.
+func (i *invoker) finished(method, keyName string, start time.Time, err error) {
+	if i.slowCallHook == nil {
+		return
+	}
+	d := i.clock.Now().Sub(start)
+	if d <= i.slowCallThreshold {
+		return
+	}
+	info := SlowCallInfo{Method: method, KeyName: keyName, Duration: d, Err: err}
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				i.logger.Printf("gcpkms: slow-call hook panicked: %v", r)
+			}
+		}()
+		i.slowCallHook(info)
+	}()
+}
+
+// isRetryable returns true if err indicates a transient server error, or that
+// a quota is exhausted and Cloud KMS asked for a retry after some delay.
+func isRetryable(err error) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	switch apiErr.Code {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	case http.StatusTooManyRequests:
+		_, ok := retryDelay(err)
+		return ok
+	}
+	return false
+}
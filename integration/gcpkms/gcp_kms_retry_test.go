@@ -0,0 +1,745 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+var errUnavailable = &googleapi.Error{Code: http.StatusServiceUnavailable, Message: "unavailable"}
+
+// scriptedCall returns a function that fails with the given errors, in order,
+// and succeeds once they are consumed.
+func scriptedCall(errs ...error) (func(context.Context) error, *int) {
+	calls := 0
+	return func(context.Context) error {
+		calls++
+		if len(errs) == 0 {
+			return nil
+		}
+		err := errs[0]
+		errs = errs[1:]
+		return err
+	}, &calls
+}
+
+// newTestInvoker returns an invoker without initial backoff or jitter, which
+// sleeps on a fake clock unless opts set another one.
+func newTestInvoker(t *testing.T, opts ...Option) *invoker {
+	t.Helper()
+	cfg, err := newConfig(append([]Option{withClock(newFakeClock())}, opts...)...)
+	if err != nil {
+		t.Fatalf("newConfig() err = %v, want nil", err)
+	}
+	i := newInvoker(cfg, nil)
+	i.initialBackoff = 0
+	i.jitter = func(backoff time.Duration) time.Duration { return backoff }
+	return i
+}
+
+func TestInvokerRetriesTransientErrors(t *testing.T) {
+	i := newTestInvoker(t)
+	fn, calls := scriptedCall(errUnavailable, errUnavailable)
+	if err := i.call(context.Background(), MethodEncrypt, fn); err != nil {
+		t.Fatalf("i.call() err = %v, want nil", err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d, want 3", *calls)
+	}
+}
+
+func TestInvokerDoesNotRetryPermanentErrors(t *testing.T) {
+	i := newTestInvoker(t)
+	permanent := &googleapi.Error{Code: http.StatusBadRequest}
+	fn, calls := scriptedCall(permanent)
+	if err := i.call(context.Background(), MethodEncrypt, fn); !errors.Is(err, permanent) {
+		t.Fatalf("i.call() err = %v, want %v", err, permanent)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+func TestInvokerStopsAfterMaxAttempts(t *testing.T) {
+	i := newTestInvoker(t)
+	fn, calls := scriptedCall(errUnavailable, errUnavailable, errUnavailable, errUnavailable)
+	if err := i.call(context.Background(), MethodEncrypt, fn); err == nil {
+		t.Fatal("i.call() err = nil, want error")
+	}
+	if *calls != defaultMaxAttempts {
+		t.Errorf("calls = %d, want %d", *calls, defaultMaxAttempts)
+	}
+}
+
+func TestRetryBudgetDepletionAndRecovery(t *testing.T) {
+	i := newTestInvoker(t, WithRetryBudget(0.5, 2))
+
+	// The first failing call consumes both tokens.
+	fn, calls := scriptedCall(errUnavailable, errUnavailable, errUnavailable)
+	err := i.call(context.Background(), MethodEncrypt, fn)
+	if err == nil || strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Fatalf("i.call() err = %v, want attempts exhausted", err)
+	}
+	if *calls != 3 {
+		t.Errorf("calls = %d, want 3", *calls)
+	}
+
+	// The budget is empty, so the next failure is not retried.
+	fn, calls = scriptedCall(errUnavailable, errUnavailable)
+	err = i.call(context.Background(), MethodEncrypt, fn)
+	if err == nil || !strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Fatalf("i.call() err = %v, want retry budget exhausted", err)
+	}
+	if !errors.Is(err, errUnavailable) {
+		t.Errorf("i.call() err = %v, want it to wrap %v", err, errUnavailable)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+
+	// Two successful calls earn one token, which allows one retry again.
+	for n := 0; n < 2; n++ {
+		fn, _ = scriptedCall()
+		if err := i.call(context.Background(), MethodEncrypt, fn); err != nil {
+			t.Fatalf("i.call() err = %v, want nil", err)
+		}
+	}
+	fn, calls = scriptedCall(errUnavailable)
+	if err := i.call(context.Background(), MethodEncrypt, fn); err != nil {
+		t.Fatalf("i.call() err = %v, want nil", err)
+	}
+	if *calls != 2 {
+		t.Errorf("calls = %d, want 2", *calls)
+	}
+}
+
+func TestInvokerStopsRetryingWhenContextIsDone(t *testing.T) {
+	i := newTestInvoker(t)
+	i.initialBackoff = defaultInitialBackoff
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	fn, calls := scriptedCall(errUnavailable, errUnavailable)
+	if err := i.call(ctx, MethodEncrypt, fn); !errors.Is(err, errUnavailable) {
+		t.Fatalf("i.call() err = %v, want %v", err, errUnavailable)
+	}
+	if *calls != 1 {
+		t.Errorf("calls = %d, want 1", *calls)
+	}
+}
+
+// quotaExhausted returns a RESOURCE_EXHAUSTED error as returned by Cloud KMS,
+// with a RetryInfo detail if retryDelay is not empty.
+func quotaExhausted(retryDelay string) *googleapi.Error {
+	err := &googleapi.Error{
+		Code:    http.StatusTooManyRequests,
+		Message: "Quota exceeded",
+		Details: []interface{}{
+			map[string]interface{}{
+				"@type": quotaFailureType,
+				"violations": []interface{}{
+					map[string]interface{}{"subject": "project:p", "description": "Cryptographic requests per minute exceeded."},
+				},
+			},
+		},
+	}
+	if retryDelay != "" {
+		err.Details = append(err.Details, map[string]interface{}{"@type": retryInfoType, "retryDelay": retryDelay})
+	}
+	return err
+}
+
+func TestInvokerHonorsRetryDelay(t *testing.T) {
+	clock := newFakeClock()
+	i := newTestInvoker(t, withClock(clock))
+	i.initialBackoff = defaultInitialBackoff
+	withDelay := &googleapi.Error{
+		Code:    http.StatusServiceUnavailable,
+		Details: []interface{}{map[string]interface{}{"@type": retryInfoType, "retryDelay": "0.5s"}},
+	}
+	fn, calls := scriptedCall(quotaExhausted("2.500s"), withDelay, errUnavailable)
+	i.maxAttempts = 4
+	if err := i.call(context.Background(), MethodEncrypt, fn); err != nil {
+		t.Fatalf("i.call() err = %v, want nil", err)
+	}
+	if *calls != 4 {
+		t.Errorf("calls = %d, want 4", *calls)
+	}
+	// The last retry falls back to the backoff, which doubled twice.
+	want := []time.Duration{2500 * time.Millisecond, 500 * time.Millisecond, 4 * defaultInitialBackoff}
+	delays := clock.Sleeps()
+	if len(delays) != len(want) {
+		t.Fatalf("delays = %v, want %v", delays, want)
+	}
+	for n := range want {
+		if delays[n] != want[n] {
+			t.Errorf("delays = %v, want %v", delays, want)
+			break
+		}
+	}
+}
+
+func TestInvokerReturnsQuotaError(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		err            *googleapi.Error
+		wantCalls      int
+		wantRetryDelay time.Duration
+	}{
+		{name: "without retry delay", err: quotaExhausted(""), wantCalls: 1},
+		{name: "with retry delay", err: quotaExhausted("1s"), wantCalls: defaultMaxAttempts, wantRetryDelay: time.Second},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			i := newTestInvoker(t)
+			fn, calls := scriptedCall(tc.err, tc.err, tc.err, tc.err)
+			err := i.call(context.Background(), MethodEncrypt, fn)
+			if !errors.Is(err, ErrQuotaExceeded) {
+				t.Fatalf("i.call() err = %v, want %v", err, ErrQuotaExceeded)
+			}
+			var quotaErr *QuotaError
+			if !errors.As(err, &quotaErr) {
+				t.Fatalf("i.call() err = %T, want *QuotaError", err)
+			}
+			if quotaErr.RetryDelay != tc.wantRetryDelay {
+				t.Errorf("quotaErr.RetryDelay = %v, want %v", quotaErr.RetryDelay, tc.wantRetryDelay)
+			}
+			want := QuotaViolation{Subject: "project:p", Description: "Cryptographic requests per minute exceeded."}
+			if len(quotaErr.QuotaViolations) != 1 || quotaErr.QuotaViolations[0] != want {
+				t.Errorf("quotaErr.QuotaViolations = %v, want [%v]", quotaErr.QuotaViolations, want)
+			}
+			if !errors.Is(err, tc.err) {
+				t.Errorf("i.call() err = %v, want it to wrap %v", err, tc.err)
+			}
+			if *calls != tc.wantCalls {
+				t.Errorf("calls = %d, want %d", *calls, tc.wantCalls)
+			}
+		})
+	}
+}
+
+func TestInvokerDoesNotWaitPastDeadline(t *testing.T) {
+	clock := newFakeClock()
+	i := newTestInvoker(t, withClock(clock))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	fn, calls := scriptedCall(quotaExhausted("1m"))
+	if err := i.call(ctx, MethodEncrypt, fn); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("i.call() err = %v, want %v", err, ErrQuotaExceeded)
+	}
+	delays := clock.Sleeps()
+	if *calls != 1 || len(delays) != 0 {
+		t.Errorf("calls = %d and delays = %v, want 1 call and no delay", *calls, delays)
+	}
+}
+
+func TestWithRetryBudgetRejectsInvalidValues(t *testing.T) {
+	for _, opt := range []Option{WithRetryBudget(-0.1, 1), WithRetryBudget(1.5, 1), WithRetryBudget(0.1, -1)} {
+		if _, err := newConfig(opt); err == nil {
+			t.Error("newConfig() err = nil, want error")
+		}
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for n := 0; n < 100; n++ {
+		if d := jitter(time.Second); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jitter(%v) = %v, want a value in [%v, %v]", time.Second, d, 500*time.Millisecond, time.Second)
+		}
+	}
+	if d := jitter(0); d != 0 {
+		t.Errorf("jitter(0) = %v, want 0", d)
+	}
+}
+
+// newScriptedServer returns a Client talking to a server that fails the
+// first requests with the given status codes and headers, and the number of
+// requests it received.
+func newScriptedServer(t *testing.T, responses []func(http.Header) int, opts ...Option) (*Client, *int) {
+	t.Helper()
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests <= len(responses) {
+			w.WriteHeader(responses[requests-1](w.Header()))
+			return
+		}
+		w.Write([]byte(`{"ciphertext": "Y2lwaGVydGV4dA=="}`))
+	}))
+	t.Cleanup(srv.Close)
+	opts = append([]Option{WithGoogleAPIClientOptions(option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication()), WithInsecureTransport()}, opts...)
+	c, err := NewClient(context.Background(), "gcp-kms://", opts...)
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	return c, &requests
+}
+
+func status(code int) func(http.Header) int {
+	return func(http.Header) int { return code }
+}
+
+func TestRESTRetriesWithJitteredBackoff(t *testing.T) {
+	responses := []func(http.Header) int{
+		status(http.StatusInternalServerError),
+		status(http.StatusBadGateway),
+		status(http.StatusServiceUnavailable),
+		status(http.StatusGatewayTimeout),
+	}
+	clock := newFakeClock()
+	c, requests := newScriptedServer(t, responses, withClock(clock), WithRetrySettings(RetrySettings{
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     300 * time.Millisecond,
+		Multiplier:     2,
+	}))
+	a, err := c.GetAEAD("gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k")
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if *requests != 5 {
+		t.Errorf("requests = %d, want 5", *requests)
+	}
+	backoffs := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond}
+	delays := clock.Sleeps()
+	if len(delays) != len(backoffs) {
+		t.Fatalf("delays = %v, want %d delays", delays, len(backoffs))
+	}
+	for n, backoff := range backoffs {
+		if d := delays[n]; d < backoff/2 || d > backoff {
+			t.Errorf("delays[%d] = %v, want a value in [%v, %v]", n, d, backoff/2, backoff)
+		}
+	}
+}
+
+func TestRESTRetriesHonorRetryAfter(t *testing.T) {
+	responses := []func(http.Header) int{
+		func(h http.Header) int {
+			h.Set("Retry-After", "2")
+			return http.StatusTooManyRequests
+		},
+		func(h http.Header) int {
+			h.Set("Retry-After", "1")
+			return http.StatusServiceUnavailable
+		},
+	}
+	clock := newFakeClock()
+	c, requests := newScriptedServer(t, responses, withClock(clock))
+	a, err := c.GetAEAD("gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k")
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if *requests != 3 {
+		t.Errorf("requests = %d, want 3", *requests)
+	}
+	want := []time.Duration{2 * time.Second, time.Second}
+	delays := clock.Sleeps()
+	if len(delays) != len(want) || delays[0] != want[0] || delays[1] != want[1] {
+		t.Errorf("delays = %v, want %v", delays, want)
+	}
+}
+
+func TestRESTRetriesStopAfterTransientErrorRetries(t *testing.T) {
+	responses := []func(http.Header) int{
+		status(http.StatusServiceUnavailable),
+		status(http.StatusServiceUnavailable),
+	}
+	c, requests := newScriptedServer(t, responses, withClock(newFakeClock()), WithTransientErrorRetries(1))
+	a, err := c.GetAEAD("gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k")
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	_, err = a.Encrypt([]byte("plaintext"), nil)
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != http.StatusServiceUnavailable {
+		t.Fatalf("a.Encrypt() err = %v, want a %d error", err, http.StatusServiceUnavailable)
+	}
+	if *requests != 2 {
+		t.Errorf("requests = %d, want 2", *requests)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "", wantOK: false},
+		{value: "3", want: 3 * time.Second, wantOK: true},
+		{value: "-1", wantOK: false},
+		{value: "soon", wantOK: false},
+		{value: "Mon, 02 Jan 2006 15:04:05 GMT", want: 0, wantOK: true},
+	} {
+		got, ok := retryAfter(tc.value)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tc.value, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestRetrySettingsOptions(t *testing.T) {
+	cfg, err := newConfig(WithRetrySettings(RetrySettings{InitialBackoff: time.Second}), WithTransientErrorRetries(4))
+	if err != nil {
+		t.Fatalf("newConfig() err = %v, want nil", err)
+	}
+	want := RetrySettings{MaxAttempts: 5, InitialBackoff: time.Second, MaxBackoff: defaultMaxBackoff, Multiplier: defaultBackoffMultiplier}
+	if cfg.retrySettings != want {
+		t.Errorf("cfg.retrySettings = %+v, want %+v", cfg.retrySettings, want)
+	}
+
+	// Both options set the same settings, so their order does not matter.
+	cfg, err = newConfig(WithTransientErrorRetries(4), WithRetrySettings(RetrySettings{InitialBackoff: time.Second}))
+	if err != nil {
+		t.Fatalf("newConfig() err = %v, want nil", err)
+	}
+	if cfg.retrySettings != want {
+		t.Errorf("cfg.retrySettings = %+v, want %+v", cfg.retrySettings, want)
+	}
+
+	for _, opt := range []Option{
+		WithRetrySettings(RetrySettings{MaxAttempts: -1}),
+		WithRetrySettings(RetrySettings{InitialBackoff: -time.Second}),
+		WithRetrySettings(RetrySettings{Multiplier: 0.5}),
+		WithRetrySettings(RetrySettings{InitialBackoff: time.Minute}),
+		WithTransientErrorRetries(-1),
+	} {
+		if _, err := newConfig(opt); err == nil {
+			t.Error("newConfig() err = nil, want error")
+		}
+	}
+}
+
+// notFound returns n responses that fail with NOT_FOUND.
+func notFound(n int) []func(http.Header) int {
+	responses := make([]func(http.Header) int, n)
+	for j := range responses {
+		responses[j] = status(http.StatusNotFound)
+	}
+	return responses
+}
+
+const retryTestKeyURI = "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/k"
+
+func TestNewKeyGracePeriodRetriesNotFound(t *testing.T) {
+	clock := newFakeClock()
+	c, requests := newScriptedServer(t, notFound(3), withClock(clock), WithNewKeyGracePeriod(time.Minute))
+	a, err := c.GetAEAD(retryTestKeyURI)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if *requests != 4 {
+		t.Errorf("requests = %d, want 4", *requests)
+	}
+	delays := clock.Sleeps()
+	if len(delays) != 3 {
+		t.Errorf("delays = %v, want 3 delays", delays)
+	}
+}
+
+func TestNewKeyGracePeriodExpires(t *testing.T) {
+	c, requests := newScriptedServer(t, notFound(1000), withClock(newFakeClock()),
+		WithNewKeyGracePeriod(50*time.Millisecond),
+		WithRetrySettings(RetrySettings{InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}))
+	a, err := c.GetAEAD(retryTestKeyURI)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	_, err = a.Encrypt([]byte("plaintext"), nil)
+	if !errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrKeyPropagating) {
+		t.Errorf("a.Encrypt() err = %v, want %v", err, ErrKeyNotFound)
+	}
+	if !isNotFound(err) {
+		t.Errorf("a.Encrypt() err = %v, want it to wrap the NOT_FOUND error", err)
+	}
+	if *requests < 2 {
+		t.Errorf("requests = %d, want at least 2", *requests)
+	}
+}
+
+func TestNewKeyGracePeriodCutShortByContext(t *testing.T) {
+	// The first backoff exceeds the deadline of the context.
+	c, _ := newScriptedServer(t, notFound(1000), withClock(newFakeClock()), WithNewKeyGracePeriod(time.Hour),
+		WithRetrySettings(RetrySettings{InitialBackoff: time.Minute, MaxBackoff: time.Minute}))
+	a, err := c.GetAEAD(retryTestKeyURI)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err = a.(*AEAD).EncryptWithContext(ctx, []byte("plaintext"), nil)
+	if !errors.Is(err, ErrKeyPropagating) || errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("a.EncryptWithContext() err = %v, want %v", err, ErrKeyPropagating)
+	}
+}
+
+func TestNewKeyGracePeriodDoesNotApplyToDecrypt(t *testing.T) {
+	c, requests := newScriptedServer(t, notFound(3), withClock(newFakeClock()), WithNewKeyGracePeriod(time.Minute))
+	a, err := c.GetAEAD(retryTestKeyURI)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt([]byte("ciphertext"), nil); !isNotFound(err) || errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("a.Decrypt() err = %v, want NOT_FOUND error", err)
+	}
+	if *requests != 1 {
+		t.Errorf("requests = %d, want 1", *requests)
+	}
+}
+
+func TestNotFoundIsNotRetriedByDefault(t *testing.T) {
+	c, requests := newScriptedServer(t, notFound(3), withClock(newFakeClock()))
+	a, err := c.GetAEAD(retryTestKeyURI)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); !isNotFound(err) || errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("a.Encrypt() err = %v, want NOT_FOUND error", err)
+	}
+	if *requests != 1 {
+		t.Errorf("requests = %d, want 1", *requests)
+	}
+	if _, err := newConfig(WithNewKeyGracePeriod(0)); err == nil {
+		t.Error("newConfig(WithNewKeyGracePeriod(0)) err = nil, want error")
+	}
+}
+
+// errorInfo returns a 503 error with an ErrorInfo detail with the given
+// reason.
+func errorInfo(reason string) *googleapi.Error {
+	return &googleapi.Error{
+		Code: http.StatusServiceUnavailable,
+		Details: []interface{}{
+			map[string]interface{}{"@type": "type.googleapis.com/google.rpc.ErrorInfo", "reason": reason},
+		},
+	}
+}
+
+// hasErrorInfoReason reports whether err carries an ErrorInfo detail with the
+// given reason.
+func hasErrorInfoReason(err error, reason string) bool {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+	for _, d := range apiErr.Details {
+		if m, ok := d.(map[string]interface{}); ok && m["reason"] == reason {
+			return true
+		}
+	}
+	return false
+}
+
+// predicateCall records a call of a retry predicate.
+type predicateCall struct {
+	op      Method
+	attempt int
+}
+
+func TestRetryPredicate(t *testing.T) {
+	badRequest := &googleapi.Error{Code: http.StatusBadRequest}
+	internal := &googleapi.Error{Code: http.StatusInternalServerError}
+	for _, tc := range []struct {
+		name      string
+		op        Method
+		errs      []error
+		wantCalls int
+		// wantCode is the HTTP status code of the error, or 0 if the call
+		// succeeds.
+		wantCode int
+	}{
+		// Not retried by default.
+		{name: "forced retry of INVALID_ARGUMENT", op: MethodEncrypt, errs: []error{badRequest}, wantCalls: 2},
+		{name: "forced retry of INTERNAL for Decrypt", op: MethodDecrypt, errs: []error{internal, internal, internal, internal}, wantCalls: 5},
+		// Retried by default.
+		{name: "vetoed retry of INTERNAL for Encrypt", op: MethodEncrypt, errs: []error{internal}, wantCalls: 1, wantCode: http.StatusInternalServerError},
+		{name: "vetoed retry of ErrorInfo reason", op: MethodDecrypt, errs: []error{errorInfo("KEY_DISABLED")}, wantCalls: 1, wantCode: http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []predicateCall
+			clock := newFakeClock()
+			i := newTestInvoker(t, withClock(clock), WithRetryPredicate(func(op Method, attempt int, err error) (bool, time.Duration) {
+				calls = append(calls, predicateCall{op: op, attempt: attempt})
+				var kmsErr *KMSError
+				if !errors.As(err, &kmsErr) {
+					t.Errorf("predicate called with %T, want a *KMSError", err)
+				}
+				var apiErr *googleapi.Error
+				switch {
+				case hasErrorInfoReason(err, "KEY_DISABLED") || !errors.As(err, &apiErr):
+					return false, 0
+				case apiErr.Code == http.StatusBadRequest:
+					return true, time.Millisecond
+				}
+				return apiErr.Code == http.StatusInternalServerError && op == MethodDecrypt && attempt < 5, time.Millisecond
+			}))
+			fn, n := scriptedCall(tc.errs...)
+			err := i.call(context.Background(), tc.op, fn)
+			var apiErr *googleapi.Error
+			switch {
+			case tc.wantCode == 0 && err != nil:
+				t.Fatalf("i.call() err = %v, want nil", err)
+			case tc.wantCode != 0 && (!errors.As(err, &apiErr) || apiErr.Code != tc.wantCode):
+				t.Fatalf("i.call() err = %v, want a %d error", err, tc.wantCode)
+			}
+			if *n != tc.wantCalls {
+				t.Errorf("calls = %d, want %d", *n, tc.wantCalls)
+			}
+			var want []predicateCall
+			for attempt := 1; attempt <= len(tc.errs) && attempt <= tc.wantCalls; attempt++ {
+				want = append(want, predicateCall{op: tc.op, attempt: attempt})
+			}
+			if !reflect.DeepEqual(calls, want) {
+				t.Errorf("predicate calls = %v, want %v", calls, want)
+			}
+			delays := clock.Sleeps()
+			for _, d := range delays {
+				if d != time.Millisecond {
+					t.Errorf("delays = %v, want the backoff of the predicate", delays)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestRetryPredicateIsBoundByDeadline(t *testing.T) {
+	clock := newFakeClock()
+	i := newTestInvoker(t, withClock(clock), WithRetryPredicate(func(Method, int, error) (bool, time.Duration) { return true, time.Hour }))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	fn, calls := scriptedCall(errUnavailable)
+	if err := i.call(ctx, MethodEncrypt, fn); !errors.Is(err, errUnavailable) {
+		t.Fatalf("i.call() err = %v, want %v", err, errUnavailable)
+	}
+	delays := clock.Sleeps()
+	if *calls != 1 || len(delays) != 0 {
+		t.Errorf("calls = %d and delays = %v, want 1 call and no delay", *calls, delays)
+	}
+	if _, err := newConfig(WithRetryPredicate(nil)); err == nil {
+		t.Error("newConfig(WithRetryPredicate(nil)) err = nil, want error")
+	}
+}
+
+func TestRetryPredicateDecidesIntegrityRetries(t *testing.T) {
+	clock := newFakeClock()
+	var calls []predicateCall
+	r := newTestIntegrityRetry(3, time.Millisecond, time.Second, clock).forClient(nil, func(op Method, attempt int, err error) (bool, time.Duration) {
+		calls = append(calls, predicateCall{op: op, attempt: attempt})
+		// Checksum failures are retried three times by default.
+		return attempt < 3, 5 * time.Millisecond
+	}, clock)
+	// Other errors are left to the invoker of the client.
+	errs := []error{ErrChecksumMismatch, ErrChecksumMismatch, ErrChecksumMismatch, errUnavailable}
+	n := 0
+	err := r.do(context.Background(), MethodGetPublicKey, func() error {
+		n++
+		return errs[n-1]
+	})
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("r.do() err = %v, want %v", err, ErrChecksumMismatch)
+	}
+	want := []predicateCall{{MethodGetPublicKey, 1}, {MethodGetPublicKey, 2}, {MethodGetPublicKey, 3}}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("predicate calls = %v, want %v", calls, want)
+	}
+	if got, want := clock.Sleeps(), []time.Duration{5 * time.Millisecond, 5 * time.Millisecond}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sleeps = %v, want %v", got, want)
+	}
+}
+
+func TestRetryPredicateAppliesToOperations(t *testing.T) {
+	// INVALID_ARGUMENT is not retried by default.
+	c, requests := newScriptedServer(t, []func(http.Header) int{status(http.StatusBadRequest)},
+		WithRetryPredicate(func(op Method, attempt int, err error) (bool, time.Duration) {
+			return op == MethodEncrypt && attempt == 1, 0
+		}))
+	a, err := c.GetAEAD(retryTestKeyURI)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if *requests != 2 {
+		t.Errorf("requests = %d, want 2", *requests)
+	}
+}
+
+func TestRetriesFaultsInjectedIntoFakeKMS(t *testing.T) {
+	const otherKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/other"
+	keyName := retryTestKeyURI[len(gcpPrefix):]
+	srv, c := newTestSigningClient(t, withClock(newFakeClock()))
+	for _, name := range []string{keyName, otherKeyName} {
+		if err := srv.CreateKey(name); err != nil {
+			t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+		}
+	}
+	faults := fakekms.NewFaultInjector()
+	// The faults are consumed in order: two transient errors are retried, and
+	// the permanent error that follows is returned.
+	faults.FailNext("Encrypt", keyName, 2, http.StatusServiceUnavailable, "UNAVAILABLE")
+	faults.Inject("Encrypt", keyName, fakekms.Fault{Code: http.StatusBadRequest, Status: "INVALID_ARGUMENT"})
+	srv.SetFaultInjector(faults)
+
+	other, err := c.GetAEAD(gcpPrefix + otherKeyName)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	if _, err := other.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Fatalf("other.Encrypt() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("Encrypt"); got != 1 {
+		t.Errorf("Encrypt called %d times for another key, want 1", got)
+	}
+
+	a, err := c.GetAEAD(retryTestKeyURI)
+	if err != nil {
+		t.Fatalf("c.GetAEAD() err = %v, want nil", err)
+	}
+	var apiErr *googleapi.Error
+	if _, err := a.Encrypt([]byte("plaintext"), nil); !errors.As(err, &apiErr) || apiErr.Code != http.StatusBadRequest {
+		t.Fatalf("a.Encrypt() err = %v, want a %d error", err, http.StatusBadRequest)
+	}
+	if got := srv.CallCount("Encrypt"); got != 4 {
+		t.Errorf("Encrypt called %d times, want 4", got)
+	}
+	if got := faults.Pending("Encrypt", keyName); got != 0 {
+		t.Errorf("faults.Pending() = %d, want 0", got)
+	}
+	if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+		t.Errorf("a.Encrypt() once the faults are consumed err = %v, want nil", err)
+	}
+}
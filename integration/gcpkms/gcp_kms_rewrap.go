@@ -0,0 +1,100 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/tink-crypto/tink-go/v2/aead"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// unwrappedKEK is a KEK for aead.KMSEnvelopeAEAD that only decrypts the
+// encrypted DEK it was created for, to the DEK already unwrapped by Cloud
+// KMS.
+type unwrappedKEK struct {
+	encryptedDEK []byte
+	dek          []byte
+}
+
+var _ tink.AEAD = (*unwrappedKEK)(nil)
+
+func (k *unwrappedKEK) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return nil, errors.New("unwrappedKEK: Encrypt is not supported")
+}
+
+func (k *unwrappedKEK) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	if !bytes.Equal(ciphertext, k.encryptedDEK) {
+		return nil, errors.New("unwrappedKEK: unknown encrypted DEK")
+	}
+	return k.dek, nil
+}
+
+// DecryptAndRewrap decrypts envelopeCiphertext with associatedData.
+// envelopeCiphertext must have been encrypted by the envelope AEAD returned
+// by aead.NewKMSEnvelopeAEAD2 for dekTemplate and kek, so it has the format
+//
+//	len(encrypted DEK) (4 bytes, big-endian) || encrypted DEK || payload
+//
+// If Cloud KMS reports that the DEK was not encrypted with the primary
+// version of kek, e.g. because the key has been rotated since, the DEK is
+// re-encrypted with the primary version and rewrapped holds the resulting
+// envelope ciphertext, which the caller should store in place of
+// envelopeCiphertext. The payload is not re-encrypted, so a re-wrap costs a
+// single Encrypt request. Otherwise, didRewrap is false and rewrapped is nil.
+//
+// Staleness is detected with the used_primary field of the Decrypt
+// response, so ciphertexts need no embedded version marker.
+func DecryptAndRewrap(ctx context.Context, kek *AEAD, dekTemplate *tinkpb.KeyTemplate, envelopeCiphertext, associatedData []byte) (plaintext, rewrapped []byte, didRewrap bool, err error) {
+	if len(envelopeCiphertext) < wrappedDEKLengthSize {
+		return nil, nil, false, errors.New("ciphertext too short")
+	}
+	n := binary.BigEndian.Uint32(envelopeCiphertext)
+	if n == 0 || uint64(n) > uint64(len(envelopeCiphertext)-wrappedDEKLengthSize) {
+		return nil, nil, false, errors.New("invalid encrypted DEK length")
+	}
+	encryptedDEK := envelopeCiphertext[wrappedDEKLengthSize : wrappedDEKLengthSize+int(n)]
+	payload := envelopeCiphertext[wrappedDEKLengthSize+int(n):]
+
+	res, err := kek.DecryptWithMetadata(ctx, encryptedDEK, []byte{})
+	if err != nil {
+		return nil, nil, false, err
+	}
+	remote := &unwrappedKEK{encryptedDEK: encryptedDEK, dek: res.Plaintext}
+	plaintext, err = aead.NewKMSEnvelopeAEAD2(dekTemplate, remote).Decrypt(envelopeCiphertext, associatedData)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	if res.UsedPrimary {
+		return plaintext, nil, false, nil
+	}
+
+	newEncryptedDEK, err := kek.EncryptWithContext(ctx, res.Plaintext, []byte{})
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("re-wrapping DEK failed: %w", err)
+	}
+	rewrapped = make([]byte, 0, wrappedDEKLengthSize+len(newEncryptedDEK)+len(payload))
+	rewrapped = binary.BigEndian.AppendUint32(rewrapped, uint32(len(newEncryptedDEK)))
+	rewrapped = append(rewrapped, newEncryptedDEK...)
+	rewrapped = append(rewrapped, payload...)
+	return plaintext, rewrapped, true, nil
+}
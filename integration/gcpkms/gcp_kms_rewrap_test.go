@@ -0,0 +1,111 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+)
+
+func TestDecryptAndRewrap(t *testing.T) {
+	srv := newFakeServer(t)
+	kek := newFakeAEAD(t, srv)
+	dekTemplate := aead.AES256GCMKeyTemplate()
+	envelope := aead.NewKMSEnvelopeAEAD2(dekTemplate, kek)
+	plaintext := []byte("plaintext")
+	associatedData := []byte("associatedData")
+	ciphertext, err := envelope.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("envelope.Encrypt() err = %v, want nil", err)
+	}
+
+	got, rewrapped, didRewrap, err := gcpkms.DecryptAndRewrap(context.Background(), kek, dekTemplate, ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("gcpkms.DecryptAndRewrap() err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) || rewrapped != nil || didRewrap {
+		t.Fatalf("gcpkms.DecryptAndRewrap() = %q, %x, %v, want %q, nil, false", got, rewrapped, didRewrap, plaintext)
+	}
+
+	if _, err := srv.AddVersion(fakeKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	got, rewrapped, didRewrap, err = gcpkms.DecryptAndRewrap(context.Background(), kek, dekTemplate, ciphertext, associatedData)
+	if err != nil {
+		t.Fatalf("gcpkms.DecryptAndRewrap() after rotation err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) || !didRewrap {
+		t.Fatalf("gcpkms.DecryptAndRewrap() after rotation = %q, _, %v, want %q, _, true", got, didRewrap, plaintext)
+	}
+
+	// The re-wrapped ciphertext must only depend on the new primary version.
+	if err := srv.SetVersionState(fakeKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	if _, err := envelope.Decrypt(ciphertext, associatedData); err == nil {
+		t.Error("envelope.Decrypt() of the original ciphertext err = nil, want error")
+	}
+	got, err = envelope.Decrypt(rewrapped, associatedData)
+	if err != nil {
+		t.Fatalf("envelope.Decrypt() of the re-wrapped ciphertext err = %v, want nil", err)
+	}
+	if !bytes.Equal(got, plaintext) {
+		t.Errorf("envelope.Decrypt() of the re-wrapped ciphertext = %q, want %q", got, plaintext)
+	}
+	_, rewrapped, didRewrap, err = gcpkms.DecryptAndRewrap(context.Background(), kek, dekTemplate, rewrapped, associatedData)
+	if err != nil || rewrapped != nil || didRewrap {
+		t.Errorf("gcpkms.DecryptAndRewrap() of the re-wrapped ciphertext = _, %x, %v, %v, want _, nil, false, nil", rewrapped, didRewrap, err)
+	}
+}
+
+func TestDecryptAndRewrapRejectsInvalidCiphertexts(t *testing.T) {
+	srv := newFakeServer(t)
+	kek := newFakeAEAD(t, srv)
+	dekTemplate := aead.AES256GCMKeyTemplate()
+	ciphertext, err := aead.NewKMSEnvelopeAEAD2(dekTemplate, kek).Encrypt([]byte("plaintext"), []byte("associatedData"))
+	if err != nil {
+		t.Fatalf("envelope.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := srv.AddVersion(fakeKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	encrypts := srv.CallCount("Encrypt")
+
+	for _, tc := range []struct {
+		name           string
+		ciphertext     []byte
+		associatedData []byte
+	}{
+		{name: "empty", ciphertext: nil, associatedData: []byte("associatedData")},
+		{name: "zero DEK length", ciphertext: []byte{0, 0, 0, 0, 1}, associatedData: []byte("associatedData")},
+		{name: "truncated", ciphertext: ciphertext[:20], associatedData: []byte("associatedData")},
+		{name: "wrong associated data", ciphertext: ciphertext, associatedData: []byte("wrong")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, _, _, err := gcpkms.DecryptAndRewrap(context.Background(), kek, dekTemplate, tc.ciphertext, tc.associatedData); err == nil {
+				t.Error("gcpkms.DecryptAndRewrap() err = nil, want error")
+			}
+		})
+	}
+	if got := srv.CallCount("Encrypt"); got != encrypts {
+		t.Errorf("srv.CallCount(\"Encrypt\") = %d, want %d", got, encrypts)
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// stalenessCheckInterval is how often WithRotationStalenessCheck checks a key
+// that is in use.
+const stalenessCheckInterval = time.Hour
+
+// StalenessEvent is passed to the callback of WithRotationStalenessCheck.
+type StalenessEvent struct {
+	// KeyURI is the URI of the crypto key, e.g.
+	// "gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k".
+	KeyURI string
+	// PrimaryVersion is the resource name of the primary version of the key.
+	PrimaryVersion string
+	// CreateTime is the time the primary version was created, and Age how
+	// long ago that was.
+	CreateTime time.Time
+	Age        time.Duration
+	// Err is set, and the other fields but KeyURI are empty, if the key could
+	// not be checked, e.g. because the caller lacks the
+	// cloudkms.cryptoKeys.get permission.
+	Err error
+}
+
+// stalenessCheck is the state of the checks of one crypto key.
+type stalenessCheck struct {
+	// last is the time the last check started.
+	last    time.Time
+	running bool
+}
+
+// stalenessChecker checks the age of the primary version of the crypto keys
+// used by the primitives of a client, as set with WithRotationStalenessCheck.
+// Each key is checked when first used and then at most once per interval,
+// from a goroutine, so that operations do not wait for the check.
+type stalenessChecker struct {
+	maxAge   time.Duration
+	callback func(StalenessEvent)
+	interval time.Duration
+	// fetch returns the crypto key with the given name.
+	fetch func(ctx context.Context, name string) (*cloudkms.CryptoKey, error)
+	clock clock
+
+	mu     sync.Mutex
+	checks map[string]*stalenessCheck
+	closed bool
+	// running counts the checks in flight, and report serializes the calls
+	// to callback.
+	running sync.WaitGroup
+	report  sync.Mutex
+}
+
+func newStalenessChecker(maxAge time.Duration, callback func(StalenessEvent), fetch func(ctx context.Context, name string) (*cloudkms.CryptoKey, error), clk clock) *stalenessChecker {
+	return &stalenessChecker{
+		maxAge:   maxAge,
+		callback: callback,
+		interval: stalenessCheckInterval,
+		fetch:    fetch,
+		clock:    clk,
+		checks:   make(map[string]*stalenessCheck),
+	}
+}
+
+// used records a use of the crypto key with the given name, and starts a
+// check of it unless one is running or the last one started less than an
+// interval ago.
+func (s *stalenessChecker) used(keyName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	now := s.clock.Now()
+	check, ok := s.checks[keyName]
+	if !ok {
+		check = &stalenessCheck{}
+		s.checks[keyName] = check
+	} else if check.running || now.Sub(check.last) < s.interval {
+		return
+	}
+	check.last = now
+	check.running = true
+	s.running.Add(1)
+	go func() {
+		defer s.running.Done()
+		s.check(keyName)
+		s.mu.Lock()
+		check.running = false
+		s.mu.Unlock()
+	}()
+}
+
+// check fetches the crypto key with the given name and calls the callback if
+// its primary version is older than maxAge, or if it could not be fetched.
+func (s *stalenessChecker) check(keyName string) {
+	key, err := s.fetch(context.Background(), keyName)
+	if errors.Is(err, ErrClientClosed) {
+		return
+	}
+	event := StalenessEvent{KeyURI: gcpPrefix + keyName}
+	if err != nil {
+		event.Err = fmt.Errorf("gcpkms: checking the primary version of %s failed: %w", keyName, err)
+		s.reportEvent(event)
+		return
+	}
+	if key.Primary == nil {
+		// Only symmetric keys have a primary version.
+		return
+	}
+	created, err := time.Parse(time.RFC3339Nano, key.Primary.CreateTime)
+	if err != nil {
+		event.Err = fmt.Errorf("gcpkms: primary version of %s has invalid create time %q", keyName, key.Primary.CreateTime)
+		s.reportEvent(event)
+		return
+	}
+	age := s.clock.Now().Sub(created)
+	if age <= s.maxAge {
+		return
+	}
+	event.PrimaryVersion = key.Primary.Name
+	event.CreateTime = created
+	event.Age = age
+	s.reportEvent(event)
+}
+
+func (s *stalenessChecker) reportEvent(event StalenessEvent) {
+	s.report.Lock()
+	defer s.report.Unlock()
+	s.callback(event)
+}
+
+// close stops starting checks and waits for those in flight to finish.
+func (s *stalenessChecker) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.mu.Unlock()
+	s.running.Wait()
+}
+
+// fetchCryptoKey returns the crypto key with the given name.
+func (c *Client) fetchCryptoKey(ctx context.Context, name string) (*cloudkms.CryptoKey, error) {
+	var key *cloudkms.CryptoKey
+	err := c.invoker.call(ctx, MethodGetCryptoKey, func(ctx context.Context) error {
+		var err error
+		key, err = c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+		return err
+	})
+	return key, err
+}
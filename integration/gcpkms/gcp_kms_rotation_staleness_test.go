@@ -0,0 +1,220 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const stalenessMaxAge = 90 * 24 * time.Hour
+
+// stalenessEvents collects the events passed to the callback of
+// WithRotationStalenessCheck.
+type stalenessEvents struct {
+	mu     sync.Mutex
+	events []gcpkms.StalenessEvent
+}
+
+func (e *stalenessEvents) add(event gcpkms.StalenessEvent) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *stalenessEvents) get() []gcpkms.StalenessEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]gcpkms.StalenessEvent(nil), e.events...)
+}
+
+// newStalenessAEAD returns a client with WithRotationStalenessCheck that
+// reports to events and tells the time with clock, and its AEAD for
+// fakeKeyURI.
+func newStalenessAEAD(t *testing.T, srv *fakekms.Server, events *stalenessEvents, clock *gcpkms.FakeClock, opts ...gcpkms.Option) (*gcpkms.Client, *gcpkms.AEAD) {
+	t.Helper()
+	opts = append([]gcpkms.Option{
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(),
+		gcpkms.WithRotationStalenessCheck(stalenessMaxAge, events.add), gcpkms.WithClock(clock),
+	}, opts...)
+	client, err := gcpkms.NewClient(context.Background(), fakeKeyURI, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	a, err := client.GetAEAD(fakeKeyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	return client, a.(*gcpkms.AEAD)
+}
+
+// encryptTimes encrypts with a n times.
+func encryptTimes(t *testing.T, a *gcpkms.AEAD, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := a.Encrypt([]byte("plaintext"), nil); err != nil {
+			t.Fatalf("a.Encrypt() err = %v, want nil", err)
+		}
+	}
+}
+
+func TestWithRotationStalenessCheckFresh(t *testing.T) {
+	srv := newFakeServer(t)
+	events := &stalenessEvents{}
+	client, a := newStalenessAEAD(t, srv, events, gcpkms.NewFakeClock())
+	encryptTimes(t, a, 5)
+	// Close waits for the check in flight.
+	client.Close()
+	if got := srv.CallCount("GetCryptoKey"); got != 1 {
+		t.Errorf("GetCryptoKey calls = %d, want 1", got)
+	}
+	if got := events.get(); len(got) != 0 {
+		t.Errorf("events = %+v, want none", got)
+	}
+}
+
+func TestWithRotationStalenessCheckStale(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	created := clock.Now().Add(-100 * 24 * time.Hour)
+	if err := srv.SetVersionCreateTime(fakeKeyName, 1, created); err != nil {
+		t.Fatalf("srv.SetVersionCreateTime() err = %v, want nil", err)
+	}
+	events := &stalenessEvents{}
+	client, a := newStalenessAEAD(t, srv, events, clock)
+	encryptTimes(t, a, 5)
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if _, err := a.Decrypt(ciphertext, nil); err != nil {
+		t.Fatalf("a.Decrypt() err = %v, want nil", err)
+	}
+	client.Close()
+
+	if got := srv.CallCount("GetCryptoKey"); got != 1 {
+		t.Errorf("GetCryptoKey calls = %d, want 1", got)
+	}
+	got := events.get()
+	if len(got) != 1 {
+		t.Fatalf("events = %+v, want 1", got)
+	}
+	event := got[0]
+	if event.Err != nil {
+		t.Fatalf("event.Err = %v, want nil", event.Err)
+	}
+	if event.KeyURI != fakeKeyURI {
+		t.Errorf("event.KeyURI = %q, want %q", event.KeyURI, fakeKeyURI)
+	}
+	if want := fakeKeyName + "/cryptoKeyVersions/1"; event.PrimaryVersion != want {
+		t.Errorf("event.PrimaryVersion = %q, want %q", event.PrimaryVersion, want)
+	}
+	if !event.CreateTime.Equal(created) {
+		t.Errorf("event.CreateTime = %v, want %v", event.CreateTime, created)
+	}
+	if want := 100 * 24 * time.Hour; event.Age != want {
+		t.Errorf("event.Age = %v, want %v", event.Age, want)
+	}
+}
+
+func TestWithRotationStalenessCheckAfterRotation(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	if err := srv.SetVersionCreateTime(fakeKeyName, 1, clock.Now().Add(-100*24*time.Hour)); err != nil {
+		t.Fatalf("srv.SetVersionCreateTime() err = %v, want nil", err)
+	}
+	events := &stalenessEvents{}
+	client, a := newStalenessAEAD(t, srv, events, clock)
+	encryptTimes(t, a, 1)
+	gcpkms.WaitForStalenessChecks(client)
+	if got := events.get(); len(got) != 1 {
+		t.Fatalf("events = %+v, want one for the stale primary version", got)
+	}
+	version, err := srv.AddVersion(fakeKeyName)
+	if err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	if err := srv.SetVersionCreateTime(fakeKeyName, version, clock.Now()); err != nil {
+		t.Fatalf("srv.SetVersionCreateTime() err = %v, want nil", err)
+	}
+	// Uses after the check interval check the key again, and find the new,
+	// fresh primary version.
+	clock.Advance(59 * time.Minute)
+	encryptTimes(t, a, 5)
+	gcpkms.WaitForStalenessChecks(client)
+	if got := srv.CallCount("GetCryptoKey"); got != 1 {
+		t.Errorf("GetCryptoKey calls within the check interval = %d, want 1", got)
+	}
+	clock.Advance(time.Minute)
+	encryptTimes(t, a, 1)
+	gcpkms.WaitForStalenessChecks(client)
+	if got := srv.CallCount("GetCryptoKey"); got != 2 {
+		t.Errorf("GetCryptoKey calls after the check interval = %d, want 2", got)
+	}
+	client.Close()
+	if got := events.get(); len(got) != 1 {
+		t.Errorf("events = %+v, want only the one of the first check", got)
+	}
+}
+
+func TestWithRotationStalenessCheckPermissionDenied(t *testing.T) {
+	srv := newFakeServer(t)
+	events := &stalenessEvents{}
+	client, a := newStalenessAEAD(t, srv, events, gcpkms.NewFakeClock(), gcpkms.WithBaseTransport(denyGetCryptoKeyTransport{}))
+	// Failing checks neither fail the operations nor repeat on every use.
+	encryptTimes(t, a, 5)
+	client.Close()
+
+	got := events.get()
+	if len(got) != 1 {
+		t.Fatalf("events = %+v, want 1", got)
+	}
+	if got[0].KeyURI != fakeKeyURI {
+		t.Errorf("event.KeyURI = %q, want %q", got[0].KeyURI, fakeKeyURI)
+	}
+	var apiErr *googleapi.Error
+	if !errors.As(got[0].Err, &apiErr) || apiErr.Code != http.StatusForbidden {
+		t.Errorf("event.Err = %v, want a googleapi.Error with code %d", got[0].Err, http.StatusForbidden)
+	}
+}
+
+func TestWithRotationStalenessCheckInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		maxAge time.Duration
+		fn     func(gcpkms.StalenessEvent)
+	}{
+		{name: "zero max age", maxAge: 0, fn: func(gcpkms.StalenessEvent) {}},
+		{name: "negative max age", maxAge: -time.Hour, fn: func(gcpkms.StalenessEvent) {}},
+		{name: "nil callback", maxAge: time.Hour},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewClient(context.Background(), fakeKeyURI, gcpkms.WithRotationStalenessCheck(tc.maxAge, tc.fn)); err == nil {
+				t.Error("gcpkms.NewClient() err = nil, want error")
+			}
+		})
+	}
+}
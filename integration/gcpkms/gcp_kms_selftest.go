@@ -0,0 +1,172 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"google.golang.org/api/googleapi"
+	"golang.org/x/oauth2"
+)
+
+// selfTestPlaintext is the plaintext encrypted, or the data signed, by the
+// self-tests.
+var selfTestPlaintext = []byte("gcpkms self-test")
+
+// SelfTestFailure classifies the failure of a self-test.
+type SelfTestFailure int
+
+const (
+	// SelfTestUnknown is a failure that fits no other class.
+	SelfTestUnknown SelfTestFailure = iota
+	// SelfTestAuth means that the credentials were rejected or could not be
+	// obtained, or that they lack the permission to use the key.
+	SelfTestAuth
+	// SelfTestNotFound means that the key or key version does not exist.
+	SelfTestNotFound
+	// SelfTestKeyState means that the key version needed is not enabled.
+	SelfTestKeyState
+	// SelfTestIntegrity means that a response was corrupted, the decrypted
+	// plaintext did not match, or the signature did not verify.
+	SelfTestIntegrity
+	// SelfTestTransport means that Cloud KMS could not be reached, did not
+	// answer in time or failed with a server error.
+	SelfTestTransport
+)
+
+func (f SelfTestFailure) String() string {
+	switch f {
+	case SelfTestAuth:
+		return "auth"
+	case SelfTestNotFound:
+		return "not found"
+	case SelfTestKeyState:
+		return "key state"
+	case SelfTestIntegrity:
+		return "integrity"
+	case SelfTestTransport:
+		return "transport"
+	default:
+		return "unknown"
+	}
+}
+
+// SelfTestError is returned by Client.SelfTest and Signer.SelfTest.
+type SelfTestError struct {
+	// Failure classifies the failure.
+	Failure SelfTestFailure
+	// Op is the step that failed: "encrypt", "decrypt", "compare", "sign" or
+	// "verify".
+	Op string
+	// Err is the underlying error, if any.
+	Err error
+}
+
+func (e *SelfTestError) Error() string {
+	return fmt.Sprintf("gcpkms: self-test failed: %s: %v failure: %v", e.Op, e.Failure, e.Err)
+}
+
+func (e *SelfTestError) Unwrap() error {
+	return e.Err
+}
+
+// selfTestError returns a *SelfTestError for err, which was returned by op.
+func selfTestError(op string, err error) *SelfTestError {
+	return &SelfTestError{Failure: classifySelfTestError(err), Op: op, Err: err}
+}
+
+func classifySelfTestError(err error) SelfTestFailure {
+	var stateErr *KeyVersionStateError
+	var retrieveErr *oauth2.RetrieveError
+	var netErr net.Error
+	var apiErr *googleapi.Error
+	switch {
+	case errors.Is(err, ErrChecksumMismatch), errors.Is(err, ErrChecksumMissing):
+		return SelfTestIntegrity
+	case errors.As(err, &stateErr):
+		return SelfTestKeyState
+	case errors.As(err, &retrieveErr):
+		return SelfTestAuth
+	case errors.As(err, &apiErr):
+		switch {
+		case apiErr.Code == http.StatusUnauthorized, apiErr.Code == http.StatusForbidden:
+			return SelfTestAuth
+		case apiErr.Code == http.StatusNotFound:
+			return SelfTestNotFound
+		case apiErr.Code >= http.StatusInternalServerError:
+			return SelfTestTransport
+		}
+		return SelfTestUnknown
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return SelfTestTransport
+	}
+	return SelfTestUnknown
+}
+
+// SelfTest proves that the key with the given URI can be used through the
+// client, e.g. at startup: it encrypts a fixed plaintext with random
+// associated data, decrypts the ciphertext and compares the result. It makes
+// no other requests than the Encrypt and Decrypt RPCs, and the ciphertext is
+// discarded.
+//
+// Failures are returned as a *SelfTestError, whose Failure tells apart
+// rejected credentials, missing keys, disabled key versions, corrupted
+// responses and unreachable endpoints.
+func (c *Client) SelfTest(ctx context.Context, keyURI string) error {
+	p, err := c.GetAEAD(keyURI)
+	if err != nil {
+		return err
+	}
+	a := p.(*AEAD)
+	associatedData := make([]byte, 16)
+	if _, err := rand.Read(associatedData); err != nil {
+		return err
+	}
+	ciphertext, err := a.EncryptWithContext(ctx, selfTestPlaintext, associatedData)
+	if err != nil {
+		return selfTestError("encrypt", err)
+	}
+	res, err := a.DecryptWithMetadata(ctx, ciphertext, associatedData)
+	if err != nil {
+		return selfTestError("decrypt", err)
+	}
+	if !bytes.Equal(res.Plaintext, selfTestPlaintext) {
+		return &SelfTestError{Failure: SelfTestIntegrity, Op: "compare", Err: errors.New("decrypted plaintext does not match")}
+	}
+	return nil
+}
+
+// SelfTest proves that the key version can sign, e.g. at startup: it signs
+// a fixed message with one AsymmetricSign RPC and verifies the signature
+// locally with the public key of the version. Failures are returned as a
+// *SelfTestError, as by Client.SelfTest.
+func (s *Signer) SelfTest(ctx context.Context) error {
+	signature, err := signData(ctx, s.s, selfTestPlaintext)
+	if err != nil {
+		return selfTestError("sign", err)
+	}
+	if err := s.s.publicKey().verify(signature, selfTestPlaintext); err != nil {
+		return &SelfTestError{Failure: SelfTestIntegrity, Op: "verify", Err: err}
+	}
+	return nil
+}
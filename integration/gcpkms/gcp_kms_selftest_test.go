@@ -0,0 +1,273 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// rewriteTransport lets rewrite change the JSON responses to requests whose
+// path ends with ":"+verb, e.g. ":decrypt".
+type rewriteTransport struct {
+	verb    string
+	rewrite func(resp map[string]any)
+}
+
+func (tr *rewriteTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err != nil || !strings.HasSuffix(r.URL.Path, ":"+tr.verb) || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+	defer resp.Body.Close()
+	body := make(map[string]any)
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	tr.rewrite(body)
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(b))
+	resp.ContentLength = int64(len(b))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(b)))
+	return resp, nil
+}
+
+// setBytes sets field of resp to data and the corresponding CRC32C field to
+// its checksum, as an uncorrupted response would.
+func setBytes(resp map[string]any, field string, data []byte) {
+	resp[field] = base64.StdEncoding.EncodeToString(data)
+	resp[field+"Crc32c"] = strconv.FormatInt(int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))), 10)
+}
+
+func newSelfTestClient(t *testing.T, endpoint string, tr http.RoundTripper) *gcpkms.Client {
+	t.Helper()
+	opts := []option.ClientOption{option.WithEndpoint(endpoint + "/"), option.WithoutAuthentication()}
+	if tr != nil {
+		opts = []option.ClientOption{option.WithEndpoint(endpoint + "/"), option.WithHTTPClient(&http.Client{Transport: tr})}
+	}
+	client, err := gcpkms.NewClient(context.Background(), "gcp-kms://", gcpkms.WithGoogleAPIClientOptions(opts...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestClientSelfTest(t *testing.T) {
+	srv := newFakeServer(t)
+	client := newSelfTestClient(t, srv.URL(), nil)
+	if err := client.SelfTest(context.Background(), fakeKeyURI); err != nil {
+		t.Fatalf("client.SelfTest() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("Encrypt"); got != 1 {
+		t.Errorf("Encrypt called %d times, want 1", got)
+	}
+	if got := srv.CallCount("Decrypt"); got != 1 {
+		t.Errorf("Decrypt called %d times, want 1", got)
+	}
+}
+
+func TestClientSelfTestFailures(t *testing.T) {
+	permissionDenied := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error": map[string]any{"code": http.StatusForbidden, "status": "PERMISSION_DENIED", "message": "Permission 'cloudkms.cryptoKeyVersions.useToEncrypt' denied."},
+		})
+	}))
+	defer permissionDenied.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	for _, tc := range []struct {
+		name string
+		// setup returns the client to test and the key URI to test it with.
+		setup       func(t *testing.T) (*gcpkms.Client, string)
+		wantFailure gcpkms.SelfTestFailure
+		wantOp      string
+	}{
+		{
+			name: "permission denied",
+			setup: func(t *testing.T) (*gcpkms.Client, string) {
+				return newSelfTestClient(t, permissionDenied.URL, nil), fakeKeyURI
+			},
+			wantFailure: gcpkms.SelfTestAuth,
+			wantOp:      "encrypt",
+		},
+		{
+			name: "key not found",
+			setup: func(t *testing.T) (*gcpkms.Client, string) {
+				return newSelfTestClient(t, newFakeServer(t).URL(), nil), fakeKeyURI + "-missing"
+			},
+			wantFailure: gcpkms.SelfTestNotFound,
+			wantOp:      "encrypt",
+		},
+		{
+			name: "key version disabled",
+			setup: func(t *testing.T) (*gcpkms.Client, string) {
+				srv := newFakeServer(t)
+				if err := srv.SetVersionState(fakeKeyName, 1, "DISABLED", ""); err != nil {
+					t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+				}
+				return newSelfTestClient(t, srv.URL(), nil), fakeKeyURI
+			},
+			wantFailure: gcpkms.SelfTestKeyState,
+			wantOp:      "encrypt",
+		},
+		{
+			name: "corrupted response",
+			setup: func(t *testing.T) (*gcpkms.Client, string) {
+				tr := &rewriteTransport{verb: "decrypt", rewrite: func(resp map[string]any) {
+					resp["plaintextCrc32c"] = "1"
+				}}
+				return newSelfTestClient(t, newFakeServer(t).URL(), tr), fakeKeyURI
+			},
+			wantFailure: gcpkms.SelfTestIntegrity,
+			wantOp:      "decrypt",
+		},
+		{
+			name: "wrong plaintext",
+			setup: func(t *testing.T) (*gcpkms.Client, string) {
+				tr := &rewriteTransport{verb: "decrypt", rewrite: func(resp map[string]any) {
+					setBytes(resp, "plaintext", []byte("other plaintext"))
+				}}
+				return newSelfTestClient(t, newFakeServer(t).URL(), tr), fakeKeyURI
+			},
+			wantFailure: gcpkms.SelfTestIntegrity,
+			wantOp:      "compare",
+		},
+		{
+			name: "server error",
+			setup: func(t *testing.T) (*gcpkms.Client, string) {
+				return newSelfTestClient(t, unavailable.URL, nil), fakeKeyURI
+			},
+			wantFailure: gcpkms.SelfTestTransport,
+			wantOp:      "encrypt",
+		},
+		{
+			name: "unreachable",
+			setup: func(t *testing.T) (*gcpkms.Client, string) {
+				return newSelfTestClient(t, closed.URL, nil), fakeKeyURI
+			},
+			wantFailure: gcpkms.SelfTestTransport,
+			wantOp:      "encrypt",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			client, keyURI := tc.setup(t)
+			err := client.SelfTest(context.Background(), keyURI)
+			var selfTestErr *gcpkms.SelfTestError
+			if !errors.As(err, &selfTestErr) {
+				t.Fatalf("client.SelfTest() err = %v, want *gcpkms.SelfTestError", err)
+			}
+			if selfTestErr.Failure != tc.wantFailure || selfTestErr.Op != tc.wantOp {
+				t.Errorf("client.SelfTest() err = %v, want %v failure in %s", err, tc.wantFailure, tc.wantOp)
+			}
+		})
+	}
+}
+
+func TestSignerSelfTest(t *testing.T) {
+	for _, algorithm := range []string{"EC_SIGN_ED25519", "EC_SIGN_P256_SHA256", "RSA_SIGN_PKCS1_2048_SHA256", "RSA_SIGN_PSS_2048_SHA256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			srv, kms := newFakeSigningKey(t, algorithm)
+			s, err := gcpkms.NewSigner(context.Background(), versionName(1), kms)
+			if err != nil {
+				t.Fatalf("gcpkms.NewSigner() err = %v, want nil", err)
+			}
+			if err := s.SelfTest(context.Background()); err != nil {
+				t.Fatalf("s.SelfTest() err = %v, want nil", err)
+			}
+			if got := srv.CallCount("AsymmetricSign"); got != 1 {
+				t.Errorf("AsymmetricSign called %d times, want 1", got)
+			}
+		})
+	}
+}
+
+func TestSignerSelfTestFailures(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		rewrite     func(resp map[string]any)
+		state       string
+		wantFailure gcpkms.SelfTestFailure
+		wantOp      string
+	}{
+		{
+			name:        "invalid signature",
+			rewrite:     func(resp map[string]any) { setBytes(resp, "signature", []byte("invalid signature")) },
+			wantFailure: gcpkms.SelfTestIntegrity,
+			wantOp:      "verify",
+		},
+		{
+			name:        "corrupted response",
+			rewrite:     func(resp map[string]any) { resp["signatureCrc32c"] = "1" },
+			wantFailure: gcpkms.SelfTestIntegrity,
+			wantOp:      "sign",
+		},
+		{
+			name:        "key version disabled",
+			rewrite:     func(map[string]any) {},
+			state:       "DISABLED",
+			wantFailure: gcpkms.SelfTestKeyState,
+			wantOp:      "sign",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, _ := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+			kms := newKMSService(t, option.WithEndpoint(srv.URL()+"/"),
+				option.WithHTTPClient(&http.Client{Transport: &rewriteTransport{verb: "asymmetricSign", rewrite: tc.rewrite}}))
+			s, err := gcpkms.NewSigner(context.Background(), versionName(1), kms)
+			if err != nil {
+				t.Fatalf("gcpkms.NewSigner() err = %v, want nil", err)
+			}
+			if tc.state != "" {
+				if err := srv.SetVersionState(fakeSigningKeyName, 1, tc.state, ""); err != nil {
+					t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+				}
+			}
+			err = s.SelfTest(context.Background())
+			var selfTestErr *gcpkms.SelfTestError
+			if !errors.As(err, &selfTestErr) {
+				t.Fatalf("s.SelfTest() err = %v, want *gcpkms.SelfTestError", err)
+			}
+			if selfTestErr.Failure != tc.wantFailure || selfTestErr.Op != tc.wantOp {
+				t.Errorf("s.SelfTest() err = %v, want %v failure in %s", err, tc.wantFailure, tc.wantOp)
+			}
+		})
+	}
+}
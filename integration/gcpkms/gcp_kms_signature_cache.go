@@ -0,0 +1,111 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// signatureCacheKey identifies a signature by the key version and the
+// SHA-256 hash of the signed digest.
+type signatureCacheKey struct {
+	version string
+	digest  [sha256.Size]byte
+}
+
+type signatureCacheEntry struct {
+	key       signatureCacheKey
+	signature []byte
+	expiry    time.Time
+}
+
+// signatureCache is an LRU cache of signatures with a maximum number of
+// entries, each of which expires after ttl. It must only hold signatures of
+// deterministic algorithms, for which signing the same digest again would
+// return the same signature.
+type signatureCache struct {
+	maxEntries int
+	ttl        time.Duration
+	// clock is the clock of the Client that created the signers, if any.
+	clock clock
+
+	mu      sync.Mutex
+	entries map[signatureCacheKey]*list.Element
+	// lru holds *signatureCacheEntry values, the most recently used first.
+	lru *list.List
+}
+
+func newSignatureCache(maxEntries int, ttl time.Duration) *signatureCache {
+	return &signatureCache{
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		clock:      realClock{},
+		entries:    make(map[signatureCacheKey]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func newSignatureCacheKey(version string, digest []byte) signatureCacheKey {
+	return signatureCacheKey{version: version, digest: sha256.Sum256(digest)}
+}
+
+// get returns a copy of the cached signature of digest under the key
+// version, or nil if there is none or it expired.
+func (c *signatureCache) get(version string, digest []byte) []byte {
+	key := newSignatureCacheKey(version, digest)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := elem.Value.(*signatureCacheEntry)
+	if !c.clock.Now().Before(e.expiry) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(elem)
+	return append([]byte(nil), e.signature...)
+}
+
+// put caches a copy of the signature of digest under the key version,
+// evicting the least recently used entry if the cache is full.
+func (c *signatureCache) put(version string, digest, signature []byte) {
+	key := newSignatureCacheKey(version, digest)
+	e := &signatureCacheEntry{
+		key:       key,
+		signature: append([]byte(nil), signature...),
+		expiry:    c.clock.Now().Add(c.ttl),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	if c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*signatureCacheEntry).key)
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func newTestSignatureCache(maxEntries int, ttl time.Duration) (*signatureCache, *fakeClock) {
+	clock := newFakeClock()
+	c := newSignatureCache(maxEntries, ttl)
+	c.clock = clock
+	return c, clock
+}
+
+func TestSignatureCacheHitsAndMisses(t *testing.T) {
+	c, _ := newTestSignatureCache(10, time.Minute)
+	if got := c.get(testSigningVersion, []byte("digest")); got != nil {
+		t.Errorf("c.get() on empty cache = %x, want nil", got)
+	}
+	c.put(testSigningVersion, []byte("digest"), []byte("signature"))
+	if got := c.get(testSigningVersion, []byte("digest")); !bytes.Equal(got, []byte("signature")) {
+		t.Errorf("c.get() = %q, want %q", got, "signature")
+	}
+	if got := c.get(testSigningVersion, []byte("other digest")); got != nil {
+		t.Errorf("c.get() with other digest = %q, want nil", got)
+	}
+	if got := c.get(testSigningKeyName+"/cryptoKeyVersions/2", []byte("digest")); got != nil {
+		t.Errorf("c.get() with other version = %q, want nil", got)
+	}
+}
+
+func TestSignatureCacheExpiresEntries(t *testing.T) {
+	c, clock := newTestSignatureCache(10, time.Minute)
+	c.put(testSigningVersion, []byte("digest"), []byte("signature"))
+	clock.Advance(time.Minute - time.Second)
+	if got := c.get(testSigningVersion, []byte("digest")); !bytes.Equal(got, []byte("signature")) {
+		t.Errorf("c.get() before expiry = %q, want %q", got, "signature")
+	}
+	clock.Advance(time.Second)
+	if got := c.get(testSigningVersion, []byte("digest")); got != nil {
+		t.Errorf("c.get() after expiry = %q, want nil", got)
+	}
+	if got := c.lru.Len(); got != 0 {
+		t.Errorf("number of entries after expiry = %d, want 0", got)
+	}
+}
+
+func TestSignatureCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c, _ := newTestSignatureCache(2, time.Minute)
+	c.put(testSigningVersion, []byte("a"), []byte("signature a"))
+	c.put(testSigningVersion, []byte("b"), []byte("signature b"))
+	// Using a makes b the least recently used entry.
+	c.get(testSigningVersion, []byte("a"))
+	c.put(testSigningVersion, []byte("c"), []byte("signature c"))
+	if got := c.get(testSigningVersion, []byte("b")); got != nil {
+		t.Errorf("c.get(b) = %q, want nil", got)
+	}
+	for _, digest := range []string{"a", "c"} {
+		if got, want := c.get(testSigningVersion, []byte(digest)), "signature "+digest; string(got) != want {
+			t.Errorf("c.get(%s) = %q, want %q", digest, got, want)
+		}
+	}
+}
+
+func TestSignatureCacheCopiesSignatures(t *testing.T) {
+	c, _ := newTestSignatureCache(10, time.Minute)
+	signature := []byte("signature")
+	c.put(testSigningVersion, []byte("digest"), signature)
+	signature[0] = 'S'
+	got := c.get(testSigningVersion, []byte("digest"))
+	got[1] = 'I'
+	if got := c.get(testSigningVersion, []byte("digest")); !bytes.Equal(got, []byte("signature")) {
+		t.Errorf("c.get() = %q, want %q", got, "signature")
+	}
+}
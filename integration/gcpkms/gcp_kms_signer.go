@@ -0,0 +1,462 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+var cryptoKeyVersionRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+/cryptoKeyVersions/[^/]+$`)
+
+// signerRefreshInterval is the minimum time between two refreshes of the
+// public key of a signer.
+const signerRefreshInterval = time.Minute
+
+// signer is a crypto.Signer whose private key is a Cloud KMS asymmetric
+// signing key version. Digests, or the data itself for Ed25519 keys, are
+// signed with AsymmetricSign, and the CRC32C checksums of the request and
+// response are verified.
+//
+// When Cloud KMS rejects a request with FAILED_PRECONDITION, e.g. because the
+// version was disabled, the signer fetches the public key again, at most once
+// per signerRefreshInterval, and retries the request if the version is usable
+// with the same algorithm.
+type signer struct {
+	ctx      context.Context
+	kms      *cloudkms.Service
+	timeouts callTimeouts
+	// integrity is nil if the default integrity retries are used.
+	integrity *integrityRetry
+
+	mu          sync.Mutex
+	pub         *publicKey
+	lastRefresh time.Time
+	// refreshInterval is signerRefreshInterval, except in tests.
+	refreshInterval time.Duration
+	// pubKeys is nil if the public key is not shared with other signers.
+	pubKeys *publicKeyCache
+	// cache is nil if signatures are not cached. It is only set if the
+	// algorithm of the key version is deterministic, which refreshes do not
+	// change.
+	cache *signatureCache
+	// closer and invoker are nil unless the signer was returned by
+	// Client.GetSigner. The invoker retries requests that fail with transient
+	// errors, within the retry budget and the concurrency limit of the
+	// client.
+	closer  *closer
+	invoker *invoker
+}
+
+var _ crypto.Signer = (*signer)(nil)
+
+// newSigner returns a signer for the key version with the given resource
+// name, e.g. "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+// All requests are bound to ctx, with the deadlines set by timeouts, are
+// issued by invoker, which may be nil, and GetPublicKey requests are retried
+// as set by integrity, which may be nil. The public key is taken from
+// pubKeys, which may be nil.
+func newSigner(ctx context.Context, keyVersionName string, kms *cloudkms.Service, invoker *invoker, timeouts callTimeouts, integrity *integrityRetry, pubKeys *publicKeyCache) (*signer, error) {
+	canonical, err := canonicalResourceName(keyVersionName)
+	if err != nil {
+		return nil, fmt.Errorf("malformed key version name %q: %v", keyVersionName, err)
+	}
+	keyVersionName = canonical
+	if !cryptoKeyVersionRegex.MatchString(keyVersionName) {
+		return nil, fmt.Errorf("invalid key version name %q, want projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*", keyVersionName)
+	}
+	if kms == nil {
+		return nil, errors.New("kms must not be nil")
+	}
+	pub, err := pubKeys.get(ctx, kms, invoker, &timeouts, integrity, keyVersionName, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting public key of %s failed: %w", keyVersionName, err)
+	}
+	return &signer{ctx: ctx, kms: kms, invoker: invoker, timeouts: timeouts, integrity: integrity, pub: pub, refreshInterval: signerRefreshInterval, pubKeys: pubKeys}, nil
+}
+
+// Signer is a crypto.Signer whose private key is a Cloud KMS asymmetric
+// signing key version. It is safe for concurrent use.
+type Signer struct {
+	s *signer
+	// client is the client created by NewSignerVerifierPair, and nil
+	// otherwise.
+	client *Client
+}
+
+var _ crypto.Signer = (*Signer)(nil)
+
+// NewSigner returns a signer for the key version with the given resource
+// name, e.g. "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+// Trailing slashes are ignored, and names with percent-encoded characters or
+// whitespace are rejected. The public key of the version is fetched once, and
+// signing requests made by Sign are bound to ctx.
+//
+// opts configure the signer like those of NewMultiSigner, e.g. with
+// WithMethodTimeout or WithSignatureCache. WithSignConcurrency has no effect.
+//
+// Keys of the RSA algorithms, the ECDSA algorithms on the NIST curves and
+// EC_SIGN_ED25519 are supported. secp256k1 keys are rejected.
+func NewSigner(ctx context.Context, keyVersionName string, kms *cloudkms.Service, opts ...MultiSignerOption) (*Signer, error) {
+	cfg, err := newMultiSignerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	s, err := cfg.newSigner(ctx, keyVersionName, kms)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{s: s}, nil
+}
+
+// GetSigner returns a Signer for the key version with URI keyURI, e.g.
+// 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1'.
+// Signing requests made by Sign are bound to ctx, and opts configure the
+// signer like those of NewSigner.
+//
+// The client caches the public keys of key versions, so that signers created
+// for the same version, even concurrently, share one GetPublicKey request.
+// When a signer fetches the public key again because the version is not
+// usable anymore, the cached key is replaced.
+//
+// The AsymmetricSign and GetPublicKey requests of the signer are issued like
+// those of the primitives returned by GetAEAD: they are retried on transient
+// errors within the retry budget of the client, and count against
+// WithMaxConcurrentCalls.
+//
+// With WithRequiredKeyLabels and WithAllowedKeyLocations, the labels and the
+// location of the crypto key are checked before the signer is created.
+func (c *Client) GetSigner(ctx context.Context, keyURI string, opts ...MultiSignerOption) (*Signer, error) {
+	canonical, err := canonicalKeyURI(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Supported(keyURI) {
+		return nil, errors.New("unsupported keyURI")
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClientClosed
+	}
+	cfg, err := newMultiSignerConfig(opts)
+	if err != nil {
+		return nil, err
+	}
+	cfg.pubKeys = c.publicKeys
+	cfg.closer = c.invoker.closer
+	cfg.invoker = c.invoker
+	cfg.integrity = cfg.integrity.forClient(c.invoker.budget, c.invoker.retryPredicate, c.invoker.clock)
+	if cfg.cache != nil {
+		cfg.cache.clock = c.invoker.clock
+	}
+	name := canonical[len(gcpPrefix):]
+	if err := c.bindLocation(name); err != nil {
+		return nil, err
+	}
+	// Names without a version are rejected by newSigner.
+	if i := strings.Index(name, "/cryptoKeyVersions/"); i >= 0 {
+		if err := c.checkKeyPolicy(ctx, name[:i]); err != nil {
+			return nil, err
+		}
+	}
+	s, err := cfg.newSigner(ctx, name, c.kms)
+	if err != nil {
+		return nil, err
+	}
+	return &Signer{s: s}, nil
+}
+
+// Public returns the public key of the key version.
+func (s *Signer) Public() crypto.PublicKey {
+	return s.s.Public()
+}
+
+// SignerOpts returns the options that Sign expects for the algorithm of the
+// key version: the hash function, *rsa.PSSOptions for RSA-PSS keys, or
+// crypto.Hash(0) for Ed25519 keys.
+func (s *Signer) SignerOpts() crypto.SignerOpts {
+	alg := s.s.publicKey().alg
+	if alg.pss {
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.hash}
+	}
+	return alg.hash
+}
+
+// Sign signs digest, which must have been computed with the hash function of
+// the key's algorithm, with opts equivalent to SignerOpts. ECDSA signatures
+// are ASN.1 DER encoded. As with ed25519.PrivateKey, Ed25519 keys sign the
+// message itself, passed as digest with opts crypto.Hash(0), and Cloud KMS
+// receives it as the data of the request.
+//
+// If the key version is not usable, the error is a *KeyVersionStateError, and
+// if its algorithm or protection level changed, a *KeyVersionChangedError.
+func (s *Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.s.signWithContext(s.s.ctx, digest, opts)
+}
+
+// SignWithContext is like Sign, but the requests are bound to ctx.
+func (s *Signer) SignWithContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.s.signWithContext(ctx, digest, opts)
+}
+
+// getPublicKey fetches and parses the public key of the key version with the
+// given name and protection level, which may be empty if unknown, with the
+// deadline set by timeouts. Requests are issued by invoker, which may be nil,
+// and responses that fail checksum verification are retried as set by
+// integrity, which may be nil.
+func getPublicKey(ctx context.Context, kms *cloudkms.Service, invoker *invoker, timeouts *callTimeouts, integrity *integrityRetry, keyVersionName, protectionLevel string) (*publicKey, error) {
+	ctx, cancel := timeouts.withTimeout(ctx, MethodGetPublicKey, protectionLevel)
+	defer cancel()
+	var pub *publicKey
+	err := integrity.do(ctx, MethodGetPublicKey, func() error {
+		var resp *cloudkms.PublicKey
+		err := invoker.do(ctx, MethodGetPublicKey, func(ctx context.Context) error {
+			get := func(ctx context.Context) (*cloudkms.PublicKey, error) {
+				return kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.GetPublicKey(keyVersionName).Context(ctx).Do()
+			}
+			var err error
+			if invoker == nil {
+				resp, err = get(ctx)
+			} else {
+				// GetPublicKey has no side effects, so it is hedged like Decrypt.
+				resp, err = hedge(ctx, invoker, get)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		pub, err = parsePublicKey(keyVersionName, resp)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pub, nil
+}
+
+// publicKey returns the current public key of the key version.
+func (s *signer) publicKey() *publicKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pub
+}
+
+// Public returns the public key of the key version.
+func (s *signer) Public() crypto.PublicKey {
+	return s.publicKey().key
+}
+
+// Sign signs digest, which must have been computed with the hash function of
+// the key's algorithm. For RSA-PSS keys, opts must be *rsa.PSSOptions with a
+// salt length equal to the hash length, which is what Cloud KMS uses. For
+// Ed25519 keys, digest is the message and opts must be crypto.Hash(0).
+//
+// If the key version is not usable, the error is a *KeyVersionStateError, and
+// if its algorithm or protection level changed, a *KeyVersionChangedError.
+func (s *signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signWithContext(s.ctx, digest, opts)
+}
+
+// signWithContext is like Sign, but the requests are bound to ctx instead of
+// the signer's context.
+func (s *signer) signWithContext(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	ctx, end, err := s.closer.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The digest is resent after a refresh, and keys the signature cache, so
+	// it is copied in case the caller modifies it during the call.
+	signature, err := s.signWithCache(ctx, clone(digest), opts)
+	return signature, end(err)
+}
+
+// signWithCache signs digest, or returns the cached signature if signatures
+// are cached.
+func (s *signer) signWithCache(ctx context.Context, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	pub := s.publicKey()
+	if s.cache == nil {
+		return s.signOrRefresh(ctx, pub, digest, opts)
+	}
+	if err := checkSignArgs(pub, digest, opts); err != nil {
+		return nil, err
+	}
+	if signature := s.cache.get(pub.version, digest); signature != nil {
+		return signature, nil
+	}
+	signature, err := s.signOrRefresh(ctx, pub, digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.cache.put(pub.version, digest, signature)
+	return signature, nil
+}
+
+// signOrRefresh signs digest with the key version described by pub, and
+// refreshes the public key and retries if the version is not usable.
+func (s *signer) signOrRefresh(ctx context.Context, pub *publicKey, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	signature, err := s.sign(ctx, pub, digest, opts)
+	if err == nil || !isFailedPrecondition(err) {
+		return signature, err
+	}
+	refreshed, refreshErr := s.refresh(ctx, pub)
+	if refreshErr != nil {
+		return nil, refreshErr
+	}
+	if refreshed == nil {
+		// The public key was refreshed recently.
+		return nil, keyVersionStateError(ctx, s.kms, err)
+	}
+	if refreshed.algorithm != pub.algorithm || refreshed.protectionLevel != pub.protectionLevel {
+		return nil, &KeyVersionChangedError{
+			Version:            pub.version,
+			OldAlgorithm:       pub.algorithm,
+			NewAlgorithm:       refreshed.algorithm,
+			OldProtectionLevel: pub.protectionLevel,
+			NewProtectionLevel: refreshed.protectionLevel,
+			Err:                err,
+		}
+	}
+	return s.sign(ctx, refreshed, digest, opts)
+}
+
+// refresh fetches the public key again, unless the last refresh happened less
+// than refreshInterval ago, in which case it returns nil and no error. If the
+// public key is shared, the stale key is invalidated, and a key refreshed by
+// another signer in the meantime is used without fetching it. Errors are
+// returned as *KeyVersionStateError if the version is not enabled.
+func (s *signer) refresh(ctx context.Context, stale *publicKey) (*publicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pub != stale {
+		// Another call refreshed the key in the meantime.
+		return s.pub, nil
+	}
+	now := s.invoker.now()
+	if now.Sub(s.lastRefresh) < s.refreshInterval {
+		return nil, nil
+	}
+	s.lastRefresh = now
+	s.pubKeys.invalidate(stale)
+	pub, err := s.pubKeys.get(ctx, s.kms, s.invoker, &s.timeouts, s.integrity, stale.version, stale.protectionLevel)
+	if err != nil {
+		return nil, keyVersionStateError(ctx, s.kms, err)
+	}
+	s.pub = pub
+	return pub, nil
+}
+
+// checkSignArgs returns an error if digest cannot be signed with opts by the
+// key version described by pub.
+func checkSignArgs(pub *publicKey, digest []byte, opts crypto.SignerOpts) error {
+	alg := pub.alg
+	if opts.HashFunc() != alg.hash {
+		return fmt.Errorf("hash function %v does not match algorithm %s", opts.HashFunc(), pub.algorithm)
+	}
+	pssOpts, isPSS := opts.(*rsa.PSSOptions)
+	if isPSS != alg.pss {
+		return fmt.Errorf("signature scheme does not match algorithm %s", pub.algorithm)
+	}
+	if isPSS && pssOpts.SaltLength != rsa.PSSSaltLengthEqualsHash && pssOpts.SaltLength != alg.hash.Size() {
+		return fmt.Errorf("PSS salt length %d is not supported, Cloud KMS uses the hash length", pssOpts.SaltLength)
+	}
+	if alg.ed25519 {
+		// The message itself is signed, so any length is accepted.
+		if edOpts, ok := opts.(*ed25519.Options); ok && edOpts.Context != "" {
+			return errors.New("Ed25519 signatures with a context are not supported by Cloud KMS")
+		}
+		return nil
+	}
+	if len(digest) != alg.hash.Size() {
+		return fmt.Errorf("digest has %d bytes, want %d", len(digest), alg.hash.Size())
+	}
+	return nil
+}
+
+// signRequest returns the AsymmetricSign request for digest, with its
+// checksum. Ed25519 keys sign the data itself, which digest holds for them.
+func signRequest(alg signAlgorithm, digest []byte) *cloudkms.AsymmetricSignRequest {
+	encoded := base64.StdEncoding.EncodeToString(digest)
+	if alg.ed25519 {
+		req := &cloudkms.AsymmetricSignRequest{Data: encoded}
+		SetAsymmetricSignRequestDataChecksum(req, digest)
+		return req
+	}
+	d := &cloudkms.Digest{}
+	switch alg.hash {
+	case crypto.SHA256:
+		d.Sha256 = encoded
+	case crypto.SHA384:
+		d.Sha384 = encoded
+	case crypto.SHA512:
+		d.Sha512 = encoded
+	}
+	req := &cloudkms.AsymmetricSignRequest{Digest: d}
+	SetAsymmetricSignRequestChecksum(req, digest)
+	return req
+}
+
+// sign signs digest with the key version described by pub.
+func (s *signer) sign(ctx context.Context, pub *publicKey, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if err := checkSignArgs(pub, digest, opts); err != nil {
+		return nil, err
+	}
+	req := signRequest(pub.alg, digest)
+	ctx, cancel := s.timeouts.withTimeout(ctx, MethodSign, pub.protectionLevel)
+	defer cancel()
+	var resp *cloudkms.AsymmetricSignResponse
+	err := s.invoker.do(ctx, MethodSign, func(ctx context.Context) error {
+		var err error
+		resp, err = s.kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.AsymmetricSign(pub.version, req).Context(ctx).Do()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pub.alg.ed25519 && !resp.VerifiedDataCrc32c {
+		return nil, errors.New("sign request corrupted in transit: data checksum not verified")
+	}
+	if !pub.alg.ed25519 && !resp.VerifiedDigestCrc32c {
+		return nil, errors.New("sign request corrupted in transit: digest checksum not verified")
+	}
+	if resp.Name != pub.version {
+		return nil, fmt.Errorf("sign response is for %s, want %s", resp.Name, pub.version)
+	}
+	signature, err := decodeBase64(resp.Signature)
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifyCRC32C(signature, wrapperspb.Int64(resp.SignatureCrc32c)); err != nil {
+		return nil, fmt.Errorf("sign response corrupted in transit: signature: %w", err)
+	}
+	return signature, nil
+}
@@ -0,0 +1,568 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const (
+	testSigningKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/signing"
+	testSigningVersion = testSigningKeyName + "/cryptoKeyVersions/1"
+)
+
+// afterSignTransport calls afterSign once, after the first AsymmetricSign
+// request, so that tests can change the key version while a Sign call is in
+// progress.
+type afterSignTransport struct {
+	base      http.RoundTripper
+	once      sync.Once
+	afterSign func()
+}
+
+func (t *afterSignTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if strings.HasSuffix(req.URL.Path, ":asymmetricSign") {
+		t.once.Do(t.afterSign)
+	}
+	return resp, err
+}
+
+// newTestSigner returns a signer for version 1 of a fake EC_SIGN_P256_SHA256
+// key, whose first AsymmetricSign request is followed by a call to afterSign.
+func newTestSigner(t *testing.T, afterSign func(srv *fakekms.Server)) (*fakekms.Server, *signer) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateSigningKey(testSigningKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	trans := &afterSignTransport{base: http.DefaultTransport, afterSign: func() { afterSign(srv) }}
+	kms, err := cloudkms.NewService(context.Background(), option.WithEndpoint(srv.URL()+"/"),
+		option.WithHTTPClient(&http.Client{Transport: trans}))
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+	}
+	s, err := newSigner(context.Background(), testSigningVersion, kms, nil, callTimeouts{}, nil, nil)
+	if err != nil {
+		t.Fatalf("newSigner() err = %v, want nil", err)
+	}
+	if err := srv.SetVersionState(testSigningKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	return srv, s
+}
+
+func setVersionState(t *testing.T, srv *fakekms.Server, state string) {
+	t.Helper()
+	if err := srv.SetVersionState(testSigningKeyName, 1, state, ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+}
+
+func TestSignerRecoversWhenVersionIsEnabledAgain(t *testing.T) {
+	srv, s := newTestSigner(t, func(srv *fakekms.Server) { setVersionState(t, srv, "ENABLED") })
+	digest := sha256.Sum256([]byte("data"))
+	signature, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+	if !ecdsa.VerifyASN1(s.Public().(*ecdsa.PublicKey), digest[:], signature) {
+		t.Error("ecdsa.VerifyASN1() = false, want true")
+	}
+	if got := srv.CallCount("AsymmetricSign"); got != 2 {
+		t.Errorf("AsymmetricSign called %d times, want 2", got)
+	}
+	if got := srv.CallCount("GetPublicKey"); got != 2 {
+		t.Errorf("GetPublicKey called %d times, want 2", got)
+	}
+}
+
+func TestSignerReportsChangedAlgorithm(t *testing.T) {
+	_, s := newTestSigner(t, func(srv *fakekms.Server) {
+		if err := srv.SetSigningAlgorithm(testSigningKeyName, "EC_SIGN_P384_SHA384"); err != nil {
+			t.Errorf("srv.SetSigningAlgorithm() err = %v, want nil", err)
+		}
+		setVersionState(t, srv, "ENABLED")
+	})
+	digest := sha256.Sum256([]byte("data"))
+	_, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	var changedErr *KeyVersionChangedError
+	if !errors.As(err, &changedErr) {
+		t.Fatalf("s.Sign() err = %v, want a *KeyVersionChangedError", err)
+	}
+	if changedErr.Version != testSigningVersion || changedErr.OldAlgorithm != "EC_SIGN_P256_SHA256" || changedErr.NewAlgorithm != "EC_SIGN_P384_SHA384" {
+		t.Errorf("s.Sign() err = %+v, want %s changed from EC_SIGN_P256_SHA256 to EC_SIGN_P384_SHA384", changedErr, testSigningVersion)
+	}
+	if got := s.Public().(*ecdsa.PublicKey).Curve.Params().Name; got != "P-384" {
+		t.Errorf("s.Public() is on curve %s, want P-384", got)
+	}
+}
+
+func TestSignerRateLimitsRefreshes(t *testing.T) {
+	srv, s := newTestSigner(t, func(*fakekms.Server) {})
+	digest := sha256.Sum256([]byte("data"))
+	for n := 0; n < 3; n++ {
+		_, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+		var stateErr *KeyVersionStateError
+		if !errors.As(err, &stateErr) || !errors.Is(err, ErrKeyVersionDisabled) {
+			t.Fatalf("s.Sign() err = %v, want %v", err, ErrKeyVersionDisabled)
+		}
+	}
+	// One call from newSigner and one refresh.
+	if got := srv.CallCount("GetPublicKey"); got != 2 {
+		t.Errorf("GetPublicKey called %d times, want 2", got)
+	}
+
+	s.refreshInterval = 0
+	setVersionState(t, srv, "ENABLED")
+	if _, err := s.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+}
+
+func TestSignerRefreshesConcurrently(t *testing.T) {
+	srv, s := newTestSigner(t, func(srv *fakekms.Server) { setVersionState(t, srv, "ENABLED") })
+	digest := sha256.Sum256([]byte("data"))
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.Sign(rand.Reader, digest[:], crypto.SHA256)
+		}()
+	}
+	wg.Wait()
+	if _, err := s.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("GetPublicKey"); got != 2 {
+		t.Errorf("GetPublicKey called %d times, want 2", got)
+	}
+}
+
+func TestSignerMethodTimeout(t *testing.T) {
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateSigningKey(testSigningKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	kms, err := cloudkms.NewService(context.Background(), srv.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+	}
+	srv.SetLatency(func(string) time.Duration { return 200 * time.Millisecond })
+
+	if _, err := NewSigner(context.Background(), testSigningVersion, kms,
+		WithMethodTimeout(MethodGetPublicKey, 50*time.Millisecond)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("NewSigner() with a short GetPublicKey timeout err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	s, err := NewSigner(context.Background(), testSigningVersion, kms,
+		WithMethodTimeout(MethodGetPublicKey, 5*time.Second),
+		WithMethodTimeout(MethodSign, 50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("NewSigner() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	if _, err := s.Sign(rand.Reader, digest[:], crypto.SHA256); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("s.Sign() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestNewSignerCanonicalizesName(t *testing.T) {
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateSigningKey(testSigningKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	kms, err := cloudkms.NewService(context.Background(), srv.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+	}
+	for _, name := range []string{testSigningVersion + "/", testSigningVersion + "//"} {
+		s, err := NewSigner(context.Background(), name, kms)
+		if err != nil {
+			t.Fatalf("NewSigner(%q) err = %v, want nil", name, err)
+		}
+		if got := s.s.publicKey().version; got != testSigningVersion {
+			t.Errorf("NewSigner(%q) signs with %q, want %q", name, got, testSigningVersion)
+		}
+	}
+	for _, name := range []string{
+		strings.Replace(testSigningVersion, "/cryptoKeyVersions/", "%2FcryptoKeyVersions/", 1),
+		testSigningVersion + " ",
+		" " + testSigningVersion,
+		strings.Replace(testSigningVersion, "/keyRings/", "//keyRings/", 1),
+	} {
+		if _, err := NewSigner(context.Background(), name, kms); err == nil {
+			t.Errorf("NewSigner(%q) err = nil, want error", name)
+		}
+	}
+}
+
+func TestNewSigner(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		pss       bool
+		// ed25519 is set if the message is signed rather than its digest.
+		ed25519 bool
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256"},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", pss: true},
+		{algorithm: "EC_SIGN_ED25519", ed25519: true},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			srv := fakekms.NewServer()
+			t.Cleanup(srv.Close)
+			if err := srv.CreateSigningKey(testSigningKeyName, tc.algorithm); err != nil {
+				t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+			}
+			kms, err := cloudkms.NewService(context.Background(), srv.ClientOptions()...)
+			if err != nil {
+				t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+			}
+			s, err := NewSigner(context.Background(), testSigningVersion, kms)
+			if err != nil {
+				t.Fatalf("NewSigner() err = %v, want nil", err)
+			}
+			opts := s.SignerOpts()
+			if _, isPSS := opts.(*rsa.PSSOptions); isPSS != tc.pss {
+				t.Errorf("s.SignerOpts() = %v, want PSS options: %v", opts, tc.pss)
+			}
+			if got := opts.HashFunc() == 0; got != tc.ed25519 {
+				t.Errorf("s.SignerOpts().HashFunc() = %v, want zero: %v", opts.HashFunc(), tc.ed25519)
+			}
+			digest := sha256.Sum256([]byte("data"))
+			toSign := digest[:]
+			if tc.ed25519 {
+				toSign = []byte("data")
+			}
+			sig, err := s.Sign(rand.Reader, toSign, opts)
+			if err != nil {
+				t.Fatalf("s.Sign() err = %v, want nil", err)
+			}
+			if err := s.s.publicKey().verify(sig, []byte("data")); err != nil {
+				t.Errorf("verifying signature failed: %v", err)
+			}
+			if tc.ed25519 {
+				if _, err := s.Sign(rand.Reader, toSign, &ed25519.Options{Context: "context"}); err == nil {
+					t.Error("s.Sign() with an Ed25519 context err = nil, want error")
+				}
+			}
+		})
+	}
+}
+
+// newTestSigningClient returns a Client configured with opts for a fake
+// server holding an EC_SIGN_P256_SHA256 key.
+func newTestSigningClient(t *testing.T, opts ...Option) (*fakekms.Server, *Client) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateSigningKey(testSigningKeyName, "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	opts = append([]Option{WithGoogleAPIClientOptions(srv.ClientOptions()...), WithInsecureTransport()}, opts...)
+	client, err := NewClient(context.Background(), gcpPrefix, opts...)
+	if err != nil {
+		t.Fatalf("NewClient() err = %v, want nil", err)
+	}
+	return srv, client
+}
+
+func TestClientGetSignerSharesPublicKey(t *testing.T) {
+	srv, client := newTestSigningClient(t)
+	srv.SetLatency(func(rpc string) time.Duration {
+		if rpc == "GetPublicKey" {
+			return 50 * time.Millisecond
+		}
+		return 0
+	})
+	const n = 10
+	signers := make([]*Signer, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			signers[i], errs[i] = client.GetSigner(context.Background(), gcpPrefix+testSigningVersion)
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Fatalf("client.GetSigner() %d err = %v, want nil", i, err)
+		}
+	}
+	if got := srv.CallCount("GetPublicKey"); got != 1 {
+		t.Errorf("GetPublicKey called %d times, want 1", got)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	for _, s := range signers {
+		signature, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatalf("s.Sign() err = %v, want nil", err)
+		}
+		if !ecdsa.VerifyASN1(s.Public().(*ecdsa.PublicKey), digest[:], signature) {
+			t.Error("ecdsa.VerifyASN1() = false, want true")
+		}
+	}
+}
+
+func TestClientGetSignerRefreshInvalidatesPublicKey(t *testing.T) {
+	srv, client := newTestSigningClient(t)
+	s, err := client.GetSigner(context.Background(), gcpPrefix+testSigningVersion)
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	setVersionState(t, srv, "DISABLED")
+	digest := sha256.Sum256([]byte("data"))
+	var stateErr *KeyVersionStateError
+	if _, err := s.Sign(rand.Reader, digest[:], crypto.SHA256); !errors.As(err, &stateErr) {
+		t.Fatalf("s.Sign() err = %v, want *KeyVersionStateError", err)
+	}
+	if err := srv.SetSigningAlgorithm(testSigningKeyName, "EC_SIGN_P384_SHA384"); err != nil {
+		t.Fatalf("srv.SetSigningAlgorithm() err = %v, want nil", err)
+	}
+	setVersionState(t, srv, "ENABLED")
+	s, err = client.GetSigner(context.Background(), gcpPrefix+testSigningVersion)
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	if got, want := s.SignerOpts().HashFunc(), crypto.SHA384; got != want {
+		t.Errorf("s.SignerOpts().HashFunc() = %v, want %v", got, want)
+	}
+	if got := srv.CallCount("GetPublicKey"); got != 3 {
+		t.Errorf("GetPublicKey called %d times, want 3", got)
+	}
+}
+
+func TestClientGetSignerRejectsInvalidURIs(t *testing.T) {
+	_, client := newTestSigningClient(t)
+	for _, keyURI := range []string{
+		testSigningVersion,
+		gcpPrefix + testSigningKeyName,
+		"aws-kms://" + testSigningVersion,
+	} {
+		if _, err := client.GetSigner(context.Background(), keyURI); err == nil {
+			t.Errorf("client.GetSigner(%q) err = nil, want error", keyURI)
+		}
+	}
+	client.Close()
+	if _, err := client.GetSigner(context.Background(), gcpPrefix+testSigningVersion); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("client.GetSigner() after Close err = %v, want %v", err, ErrClientClosed)
+	}
+}
+
+// unavailableTransport fails the requests whose path ends with suffix with
+// UNAVAILABLE, and counts them.
+type unavailableTransport struct {
+	suffix   string
+	requests atomic.Int64
+}
+
+func (t *unavailableTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !strings.HasSuffix(req.URL.Path, t.suffix) {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	t.requests.Add(1)
+	return &http.Response{
+		StatusCode: http.StatusServiceUnavailable,
+		Header:     make(http.Header),
+		Body:       io.NopCloser(strings.NewReader(`{"error": {"code": 503, "status": "UNAVAILABLE"}}`)),
+		Request:    req,
+	}, nil
+}
+
+func TestClientSignerRetriesWithinRetryBudget(t *testing.T) {
+	trans := &unavailableTransport{suffix: ":asymmetricSign"}
+	_, client := newTestSigningClient(t, withBaseTransport(trans), WithRetryBudget(0, 2), WithTransientErrorRetries(10), withClock(newFakeClock()))
+	s, err := client.GetSigner(context.Background(), gcpPrefix+testSigningVersion)
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	_, err = s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err == nil || !strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Errorf("s.Sign() err = %v, want retry budget exhausted", err)
+	}
+	var kmsErr *KMSError
+	if !errors.As(err, &kmsErr) {
+		t.Errorf("s.Sign() err = %v, want a *KMSError", err)
+	}
+	// The first attempt and one retry per token.
+	if got := trans.requests.Load(); got != 3 {
+		t.Errorf("AsymmetricSign requests = %d, want 3", got)
+	}
+}
+
+// peakTransport records the maximum number of concurrent requests.
+type peakTransport struct {
+	delay         time.Duration
+	inFlight, max atomic.Int32
+}
+
+func (t *peakTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := t.inFlight.Add(1)
+	defer t.inFlight.Add(-1)
+	for {
+		max := t.max.Load()
+		if n <= max || t.max.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	time.Sleep(t.delay)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientSignerRespectsMaxConcurrentCalls(t *testing.T) {
+	const limit = 2
+	trans := &peakTransport{delay: 10 * time.Millisecond}
+	_, client := newTestSigningClient(t, withBaseTransport(trans), WithMaxConcurrentCalls(limit))
+	s, err := client.GetSigner(context.Background(), gcpPrefix+testSigningVersion)
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := s.Sign(rand.Reader, digest[:], crypto.SHA256); err != nil {
+				t.Errorf("s.Sign() err = %v, want nil", err)
+			}
+			if got := client.InFlightCalls(); got > limit {
+				t.Errorf("client.InFlightCalls() = %d, want at most %d", got, limit)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := trans.max.Load(); got != limit {
+		t.Errorf("max concurrent requests = %d, want %d", got, limit)
+	}
+}
+
+// blockingTransport blocks the requests whose path ends with suffix until
+// release is closed.
+type blockingTransport struct {
+	suffix  string
+	release chan struct{}
+}
+
+func (t *blockingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, t.suffix) {
+		<-t.release
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientMultiVersionVerifierRespectsMaxConcurrentCalls(t *testing.T) {
+	trans := &blockingTransport{suffix: ":asymmetricSign", release: make(chan struct{})}
+	srv, client := newTestSigningClient(t, withBaseTransport(trans), WithMaxConcurrentCalls(1))
+	s, err := client.GetSigner(context.Background(), gcpPrefix+testSigningVersion)
+	if err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	signed := make(chan error, 1)
+	go func() {
+		digest := sha256.Sum256([]byte("data"))
+		_, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+		signed <- err
+	}()
+	for client.InFlightCalls() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// The blocked Sign holds the only slot, so the verifier cannot list the
+	// key versions before its context expires.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetMultiVersionVerifier(ctx, gcpPrefix+testSigningKeyName); err == nil {
+		t.Error("client.GetMultiVersionVerifier() err = nil, want error")
+	}
+	if got := srv.CallCount("ListCryptoKeyVersions"); got != 0 {
+		t.Errorf("ListCryptoKeyVersions calls = %d, want 0", got)
+	}
+
+	close(trans.release)
+	if err := <-signed; err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+	v, err := client.GetMultiVersionVerifier(context.Background(), gcpPrefix+testSigningKeyName)
+	if err != nil {
+		t.Fatalf("client.GetMultiVersionVerifier() err = %v, want nil", err)
+	}
+	digest := sha256.Sum256([]byte("data"))
+	sig, err := s.Sign(rand.Reader, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatalf("s.Sign() err = %v, want nil", err)
+	}
+	if err := v.Verify(sig, []byte("data")); err != nil {
+		t.Errorf("v.Verify() err = %v, want nil", err)
+	}
+}
+
+// stallFirstTransport stalls the first request whose path ends with suffix
+// until it is canceled, and counts the requests with that suffix.
+type stallFirstTransport struct {
+	suffix   string
+	requests atomic.Int64
+}
+
+func (t *stallFirstTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if strings.HasSuffix(req.URL.Path, t.suffix) && t.requests.Add(1) == 1 {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestClientSignerHedgesGetPublicKey(t *testing.T) {
+	trans := &stallFirstTransport{suffix: "/publicKey"}
+	_, client := newTestSigningClient(t, withBaseTransport(trans), WithHedging(10*time.Millisecond, 2))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := client.GetSigner(ctx, gcpPrefix+testSigningVersion); err != nil {
+		t.Fatalf("client.GetSigner() err = %v, want nil", err)
+	}
+	if got := trans.requests.Load(); got != 2 {
+		t.Errorf("GetPublicKey requests = %d, want 2", got)
+	}
+	if got := client.HedgedRequests(); got != 1 {
+		t.Errorf("client.HedgedRequests() = %d, want 1", got)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// Verifier verifies signatures of a Cloud KMS asymmetric signing key version
+// locally with its public key. It is safe for concurrent use.
+type Verifier struct {
+	pub *publicKey
+}
+
+var _ tink.Verifier = (*Verifier)(nil)
+
+// Verify returns nil if signature is a valid signature of data by the key
+// version. ECDSA signatures must be ASN.1 DER encoded, as returned by Signer.
+func (v *Verifier) Verify(signature, data []byte) error {
+	return v.pub.verify(signature, data)
+}
+
+// Public returns the public key of the key version.
+func (v *Verifier) Public() crypto.PublicKey {
+	return v.pub.key
+}
+
+// NewSignerVerifierPair returns a signer for the key version with URI keyURI,
+// e.g. 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1',
+// and a verifier of its signatures, for services that both sign and verify
+// with the same key. Both share one Client configured with opts, and the
+// public key of the version, which is fetched with a single checksum-verified
+// GetPublicKey request. Options that also configure signers, such as
+// WithMethodTimeout, apply to the signer too.
+//
+// Signing requests made by Sign are bound to ctx, and signatures are verified
+// locally. Close of the signer closes the client; the verifier remains usable.
+func NewSignerVerifierPair(ctx context.Context, keyURI string, opts ...Option) (*Signer, *Verifier, error) {
+	client, err := NewClient(ctx, keyURI, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	var signerOpts []MultiSignerOption
+	for _, opt := range opts {
+		if o, ok := opt.(MultiSignerOption); ok {
+			signerOpts = append(signerOpts, o)
+		}
+	}
+	s, err := client.GetSigner(ctx, keyURI, signerOpts...)
+	if err != nil {
+		client.Close()
+		return nil, nil, err
+	}
+	s.client = client
+	return s, &Verifier{pub: s.s.publicKey()}, nil
+}
+
+// Close closes the Client created by NewSignerVerifierPair for the signer,
+// and does nothing for other signers.
+func (s *Signer) Close() error {
+	if s.client == nil {
+		return nil
+	}
+	return s.client.Close()
+}
@@ -0,0 +1,70 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+func TestNewSignerVerifierPair(t *testing.T) {
+	for _, algorithm := range []string{"EC_SIGN_P256_SHA256", "RSA_SIGN_PSS_2048_SHA256", "RSA_SIGN_PKCS1_2048_SHA256"} {
+		t.Run(algorithm, func(t *testing.T) {
+			srv, _ := newFakeSigningKey(t, algorithm)
+			keyURI := "gcp-kms://" + fakeSigningKeyName + "/cryptoKeyVersions/1"
+			s, v, err := gcpkms.NewSignerVerifierPair(context.Background(), keyURI,
+				gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+			if err != nil {
+				t.Fatalf("gcpkms.NewSignerVerifierPair() err = %v, want nil", err)
+			}
+			defer s.Close()
+			data := []byte("data")
+			digest := sha256.Sum256(data)
+			signature, err := s.Sign(rand.Reader, digest[:], s.SignerOpts())
+			if err != nil {
+				t.Fatalf("s.Sign() err = %v, want nil", err)
+			}
+			if err := v.Verify(signature, data); err != nil {
+				t.Errorf("v.Verify() err = %v, want nil", err)
+			}
+			if err := v.Verify(signature, []byte("other data")); err == nil {
+				t.Error("v.Verify() err = nil for other data, want error")
+			}
+			if got := srv.CallCount("GetPublicKey"); got != 1 {
+				t.Errorf("GetPublicKey called %d times, want 1", got)
+			}
+			if err := s.Close(); err != nil {
+				t.Errorf("s.Close() err = %v, want nil", err)
+			}
+			if err := v.Verify(signature, data); err != nil {
+				t.Errorf("v.Verify() after s.Close() err = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestNewSignerVerifierPairRejectsCryptoKeys(t *testing.T) {
+	srv, _ := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	if _, _, err := gcpkms.NewSignerVerifierPair(context.Background(), "gcp-kms://"+fakeSigningKeyName,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport()); err == nil {
+		t.Error("gcpkms.NewSignerVerifierPair() err = nil, want error")
+	}
+}
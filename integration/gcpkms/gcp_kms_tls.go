@@ -0,0 +1,104 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// tlsSignatureScheme returns the TLS signature scheme of the algorithm, and
+// false if keys of the algorithm cannot be used in TLS.
+func (a signAlgorithm) tlsSignatureScheme() (tls.SignatureScheme, bool) {
+	switch {
+	case a.curve == elliptic.P256() && a.hash == crypto.SHA256:
+		return tls.ECDSAWithP256AndSHA256, true
+	case a.curve == elliptic.P384() && a.hash == crypto.SHA384:
+		return tls.ECDSAWithP384AndSHA384, true
+	case a.curve != nil:
+		return 0, false
+	case a.pss && a.hash == crypto.SHA256:
+		return tls.PSSWithSHA256, true
+	case a.pss && a.hash == crypto.SHA384:
+		return tls.PSSWithSHA384, true
+	case a.pss && a.hash == crypto.SHA512:
+		return tls.PSSWithSHA512, true
+	case !a.pss && a.hash == crypto.SHA256:
+		return tls.PKCS1WithSHA256, true
+	case !a.pss && a.hash == crypto.SHA384:
+		return tls.PKCS1WithSHA384, true
+	case !a.pss && a.hash == crypto.SHA512:
+		return tls.PKCS1WithSHA512, true
+	default:
+		return 0, false
+	}
+}
+
+// NewTLSCertificate returns a certificate for tls.Config whose private key is
+// the Cloud KMS asymmetric signing key version with the given resource name,
+// e.g. "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+//
+// certPEM holds the PEM encoded certificate chain, leaf first. The leaf must
+// certify the public key of the key version. The certificate only supports
+// the signature scheme of the key's algorithm; since TLS 1.3 does not allow
+// RSA PKCS #1 v1.5 signatures, RSA_SIGN_PKCS1_* keys can only be used with
+// TLS 1.2. Signing requests made during handshakes are bound to ctx.
+func NewTLSCertificate(ctx context.Context, certPEM []byte, keyName string, kms *cloudkms.Service) (tls.Certificate, error) {
+	var chain [][]byte
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type == "CERTIFICATE" {
+			chain = append(chain, block.Bytes)
+		}
+	}
+	if len(chain) == 0 {
+		return tls.Certificate{}, errors.New("certPEM holds no PEM encoded CERTIFICATE")
+	}
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("parsing certificate failed: %v", err)
+	}
+	s, err := newSigner(ctx, keyName, kms, nil, callTimeouts{}, nil, nil)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if pub, ok := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(s.Public()) {
+		return tls.Certificate{}, fmt.Errorf("certificate does not certify the public key of %s", keyName)
+	}
+	scheme, ok := s.publicKey().alg.tlsSignatureScheme()
+	if !ok {
+		return tls.Certificate{}, fmt.Errorf("algorithm %s cannot be used in TLS", s.publicKey().algorithm)
+	}
+	return tls.Certificate{
+		Certificate:                  chain,
+		PrivateKey:                   s,
+		SupportedSignatureAlgorithms: []tls.SignatureScheme{scheme},
+		Leaf:                         leaf,
+	}, nil
+}
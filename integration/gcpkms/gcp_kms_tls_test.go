@@ -0,0 +1,134 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+const tlsServerName = "kms.example.com"
+
+// handshake runs a TLS handshake between a server with cert and a client
+// trusting ca, and returns the error of the client.
+func handshake(t *testing.T, cert tls.Certificate, ca *x509.Certificate, maxVersion uint16) error {
+	t.Helper()
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+
+	server := tls.Server(serverConn, &tls.Config{Certificates: []tls.Certificate{cert}, MaxVersion: maxVersion})
+	serverErr := make(chan error, 1)
+	go func() {
+		err := server.Handshake()
+		// Unblock the client if the server fails.
+		serverConn.Close()
+		serverErr <- err
+	}()
+	client := tls.Client(clientConn, &tls.Config{RootCAs: roots, ServerName: tlsServerName})
+	err := client.Handshake()
+	clientConn.Close()
+	if sErr := <-serverErr; err == nil && sErr != nil {
+		t.Errorf("server.Handshake() err = %v, want nil", sErr)
+	}
+	return err
+}
+
+func newTLSCertificatePEM(t *testing.T, leaf, ca *x509.Certificate) []byte {
+	t.Helper()
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})
+	return append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+}
+
+func TestNewTLSCertificateHandshake(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm  string
+		maxVersion uint16
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256"},
+		{algorithm: "EC_SIGN_P384_SHA384"},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256"},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", maxVersion: tls.VersionTLS12},
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", maxVersion: tls.VersionTLS12},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			srv, kms := newFakeSigningKey(t, tc.algorithm)
+			ca, leaf := newCertificates(t, kmsPublicKey(t, kms, versionName(1)), x509.ExtKeyUsageServerAuth, tlsServerName)
+			cert, err := gcpkms.NewTLSCertificate(context.Background(), newTLSCertificatePEM(t, leaf, ca), versionName(1), kms)
+			if err != nil {
+				t.Fatalf("gcpkms.NewTLSCertificate() err = %v, want nil", err)
+			}
+			if len(cert.Certificate) != 2 {
+				t.Errorf("len(cert.Certificate) = %d, want 2", len(cert.Certificate))
+			}
+			if err := handshake(t, cert, ca, tc.maxVersion); err != nil {
+				t.Errorf("handshake() err = %v, want nil", err)
+			}
+			if got := srv.CallCount("AsymmetricSign"); got != 1 {
+				t.Errorf("AsymmetricSign calls = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestNewTLSCertificateWithPKCS1KeyFailsTLS13(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "RSA_SIGN_PKCS1_2048_SHA256")
+	ca, leaf := newCertificates(t, kmsPublicKey(t, kms, versionName(1)), x509.ExtKeyUsageServerAuth, tlsServerName)
+	cert, err := gcpkms.NewTLSCertificate(context.Background(), newTLSCertificatePEM(t, leaf, ca), versionName(1), kms)
+	if err != nil {
+		t.Fatalf("gcpkms.NewTLSCertificate() err = %v, want nil", err)
+	}
+	if err := handshake(t, cert, ca, tls.VersionTLS13); err == nil {
+		t.Error("handshake() with TLS 1.3 err = nil, want error")
+	}
+}
+
+func TestNewTLSCertificateRejectsInvalidInput(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	ca, leaf := newCertificates(t, kmsPublicKey(t, kms, versionName(1)), x509.ExtKeyUsageServerAuth, tlsServerName)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("ecdsa.GenerateKey() err = %v, want nil", err)
+	}
+	_, otherLeaf := newCertificates(t, otherKey.Public(), x509.ExtKeyUsageServerAuth, tlsServerName)
+	for _, tc := range []struct {
+		name    string
+		certPEM []byte
+		keyName string
+	}{
+		{name: "no certificate", certPEM: []byte("not PEM"), keyName: versionName(1)},
+		{name: "certificate of another key", certPEM: newTLSCertificatePEM(t, otherLeaf, ca), keyName: versionName(1)},
+		{name: "crypto key name", certPEM: newTLSCertificatePEM(t, leaf, ca), keyName: fakeSigningKeyName},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewTLSCertificate(context.Background(), tc.certPEM, tc.keyName, kms); err == nil {
+				t.Error("gcpkms.NewTLSCertificate() err = nil, want error")
+			}
+		})
+	}
+}
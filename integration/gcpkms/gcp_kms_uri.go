@@ -0,0 +1,80 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// canonicalKeyURI returns the canonical spelling of keyURI, a key URI or a
+// URI prefix: its scheme in lowercase and its path without trailing slashes.
+// Equivalent spellings of a URI thus select the same key, and share the
+// primitives cached by a Client.
+//
+// It fails if keyURI does not start with gcpPrefix, in any case, or if its
+// path is malformed, see canonicalResourceName.
+func canonicalKeyURI(keyURI string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(keyURI), gcpPrefix) {
+		return "", fmt.Errorf("keyURI must start with %s", gcpPrefix)
+	}
+	name, err := canonicalResourceName(keyURI[len(gcpPrefix):])
+	if err != nil {
+		return "", fmt.Errorf("malformed keyURI %q: %v", keyURI, err)
+	}
+	return gcpPrefix + name, nil
+}
+
+// canonicalResourceName returns the Cloud KMS resource name, or resource name
+// prefix, name without trailing slashes.
+//
+// Resource names never need escaping, so names with percent-encoded
+// characters, whitespace or other non-printable characters, or with empty
+// segments, are rejected rather than decoded or trimmed: Cloud KMS would
+// otherwise use a different resource than the one they appear to name.
+func canonicalResourceName(name string) (string, error) {
+	name = strings.TrimRight(name, "/")
+	if name == "" {
+		return "", nil
+	}
+	for i, r := range name {
+		switch {
+		case r == '%':
+			return "", fmt.Errorf("percent-encoded character at offset %d", i)
+		case unicode.IsSpace(r) || !unicode.IsPrint(r):
+			return "", fmt.Errorf("whitespace or non-printable character %q at offset %d", r, i)
+		}
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if segment == "" {
+			return "", errors.New("empty path segment")
+		}
+	}
+	return name, nil
+}
+
+// hasKeyURIPrefix reports whether the canonical key URI keyURI is, or is
+// under, the canonical URI prefix prefix. Whole path segments are compared,
+// so that 'gcp-kms://projects/b' does not match keys of project "bb".
+func hasKeyURIPrefix(keyURI, prefix string) bool {
+	if prefix == gcpPrefix || keyURI == prefix {
+		return true
+	}
+	return strings.HasPrefix(keyURI, prefix+"/")
+}
@@ -0,0 +1,281 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// ErrValidationDivergence is returned by the methods of a ValidatingAEAD in
+// ValidationStrict mode when the secondary AEAD disagrees with the primary.
+var ErrValidationDivergence = errors.New("gcpkms: secondary AEAD diverged from primary")
+
+// maxShadowValidations is the maximum number of validations that a
+// ValidatingAEAD in ValidationShadow mode runs in the background at once.
+// Further calls are not validated until one of them finishes, so that a slow
+// secondary AEAD cannot pile up goroutines.
+const maxShadowValidations = 64
+
+// ValidationMode sets whether the secondary AEAD of a ValidatingAEAD affects
+// the results returned to callers.
+type ValidationMode int
+
+const (
+	// ValidationShadow validates in the background: callers get the results
+	// of the primary AEAD as soon as it returns, and the secondary AEAD never
+	// affects them, even if it fails.
+	ValidationShadow ValidationMode = iota + 1
+	// ValidationStrict validates before returning: callers wait for both
+	// AEADs, and get ErrValidationDivergence if they disagree.
+	ValidationStrict
+)
+
+// Divergence describes a disagreement between the primary and secondary
+// AEADs of a ValidatingAEAD. It holds neither plaintexts nor ciphertexts.
+type Divergence struct {
+	// Method is MethodEncrypt if the secondary AEAD could not decrypt a
+	// ciphertext of the primary AEAD to its plaintext, and MethodDecrypt if
+	// both AEADs decrypted a ciphertext with different results.
+	Method Method
+	// PrimaryErr is the error of the primary AEAD, which is nil for
+	// MethodEncrypt.
+	PrimaryErr error
+	// SecondaryErr is the error of the secondary AEAD.
+	SecondaryErr error
+	// PlaintextMismatch is true if both AEADs succeeded but their plaintexts
+	// differ.
+	PlaintextMismatch bool
+}
+
+func (d Divergence) String() string {
+	if d.PlaintextMismatch {
+		return fmt.Sprintf("%v: plaintexts differ", d.Method)
+	}
+	return fmt.Sprintf("%v: primary error: %v, secondary error: %v", d.Method, d.PrimaryErr, d.SecondaryErr)
+}
+
+// ValidatingAEADOption configures an AEAD created with NewValidatingAEAD.
+type ValidatingAEADOption interface {
+	applyValidating(cfg *validatingConfig) error
+}
+
+type validatingOptionFunc func(*validatingConfig) error
+
+func (o validatingOptionFunc) applyValidating(cfg *validatingConfig) error { return o(cfg) }
+
+type validatingConfig struct {
+	sampleRate float64
+}
+
+// WithValidationSampleRate validates only the given fraction of calls, chosen
+// at random, to bound the cost of the secondary AEAD. rate must be between 0
+// and 1. By default, every call is validated.
+func WithValidationSampleRate(rate float64) ValidatingAEADOption {
+	return validatingOptionFunc(func(cfg *validatingConfig) error {
+		if !(rate >= 0 && rate <= 1) {
+			return fmt.Errorf("sample rate %v is not between 0 and 1", rate)
+		}
+		cfg.sampleRate = rate
+		return nil
+	})
+}
+
+// ValidatingAEAD is an AEAD that checks a secondary AEAD against a primary
+// one, e.g. while migrating to another transport or client for the same Cloud
+// KMS key: Decrypt decrypts with both AEADs and compares the results, and
+// Encrypt encrypts with the primary AEAD and decrypts the ciphertext with the
+// secondary one. Callers always get the ciphertexts and plaintexts of the
+// primary AEAD.
+type ValidatingAEAD struct {
+	primary, secondary tink.AEAD
+	mode               ValidationMode
+	report             func(Divergence)
+	sampleRate         float64
+
+	// inFlight limits the validations running in the background.
+	inFlight chan struct{}
+	wg       sync.WaitGroup
+}
+
+var _ tink.AEAD = (*ValidatingAEAD)(nil)
+
+// NewValidatingAEAD returns an AEAD that returns the results of primary, the
+// AEAD that callers rely on today, and validates secondary, the AEAD that is
+// to replace it, against them. report is called with every divergence that
+// is found, possibly concurrently and, in ValidationShadow mode, from
+// background goroutines.
+//
+// Two failed decryptions agree, whatever their errors. In ValidationShadow
+// mode, calls are not validated while maxShadowValidations validations are
+// still running; use Wait before exiting to let running validations finish.
+func NewValidatingAEAD(primary, secondary tink.AEAD, mode ValidationMode, report func(Divergence), opts ...ValidatingAEADOption) (*ValidatingAEAD, error) {
+	if primary == nil || secondary == nil {
+		return nil, errors.New("both AEADs are required")
+	}
+	if mode != ValidationShadow && mode != ValidationStrict {
+		return nil, fmt.Errorf("unknown validation mode %d", mode)
+	}
+	if report == nil {
+		return nil, errors.New("report must not be nil")
+	}
+	cfg := &validatingConfig{sampleRate: 1}
+	for _, opt := range opts {
+		if err := opt.applyValidating(cfg); err != nil {
+			return nil, err
+		}
+	}
+	return &ValidatingAEAD{
+		primary:    primary,
+		secondary:  secondary,
+		mode:       mode,
+		report:     report,
+		sampleRate: cfg.sampleRate,
+		inFlight:   make(chan struct{}, maxShadowValidations),
+	}, nil
+}
+
+// Encrypt encrypts plaintext with associatedData with the primary AEAD. If
+// the call is validated, the ciphertext is decrypted with the secondary AEAD,
+// which must return plaintext.
+func (v *ValidatingAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	ciphertext, err := v.primary.Encrypt(plaintext, associatedData)
+	if err != nil || !v.sampled() {
+		return ciphertext, err
+	}
+	check := func(plaintext, associatedData, ciphertext []byte) *Divergence {
+		got, err := v.secondary.Decrypt(ciphertext, associatedData)
+		if err != nil {
+			return &Divergence{Method: MethodEncrypt, SecondaryErr: err}
+		}
+		if !bytes.Equal(got, plaintext) {
+			return &Divergence{Method: MethodEncrypt, PlaintextMismatch: true}
+		}
+		return nil
+	}
+	if v.mode == ValidationShadow {
+		// The caller may reuse its buffers once Encrypt returns.
+		plaintext, associatedData, ct := clone(plaintext), clone(associatedData), clone(ciphertext)
+		v.inBackground(func() { v.reportIfDiverged(check(plaintext, associatedData, ct)) })
+		return ciphertext, nil
+	}
+	if d := check(plaintext, associatedData, ciphertext); d != nil {
+		v.report(*d)
+		return nil, ErrValidationDivergence
+	}
+	return ciphertext, nil
+}
+
+// Decrypt decrypts ciphertext with associatedData with the primary AEAD. If
+// the call is validated, it is also decrypted with the secondary AEAD, which
+// must agree: both must fail, or return the same plaintext. In
+// ValidationStrict mode, both AEADs decrypt concurrently.
+func (v *ValidatingAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	if !v.sampled() {
+		return v.primary.Decrypt(ciphertext, associatedData)
+	}
+	if v.mode == ValidationShadow {
+		plaintext, err := v.primary.Decrypt(ciphertext, associatedData)
+		ct, ad := clone(ciphertext), clone(associatedData)
+		want := clone(plaintext)
+		v.inBackground(func() {
+			got, secondaryErr := v.secondary.Decrypt(ct, ad)
+			v.reportIfDiverged(compareDecryptions(want, err, got, secondaryErr))
+		})
+		return plaintext, err
+	}
+	var (
+		got          []byte
+		secondaryErr error
+		done         = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		got, secondaryErr = v.secondary.Decrypt(ciphertext, associatedData)
+	}()
+	plaintext, err := v.primary.Decrypt(ciphertext, associatedData)
+	<-done
+	if d := compareDecryptions(plaintext, err, got, secondaryErr); d != nil {
+		v.report(*d)
+		return nil, ErrValidationDivergence
+	}
+	return plaintext, err
+}
+
+// Wait blocks until the validations running in the background have finished
+// and reported their divergences.
+func (v *ValidatingAEAD) Wait() {
+	v.wg.Wait()
+}
+
+// sampled returns true if the current call is to be validated.
+func (v *ValidatingAEAD) sampled() bool {
+	return v.sampleRate >= 1 || v.sampleRate > 0 && rand.Float64() < v.sampleRate
+}
+
+// inBackground runs f in a new goroutine, unless maxShadowValidations
+// validations are still running.
+func (v *ValidatingAEAD) inBackground(f func()) {
+	select {
+	case v.inFlight <- struct{}{}:
+	default:
+		return
+	}
+	v.wg.Add(1)
+	go func() {
+		defer func() {
+			<-v.inFlight
+			v.wg.Done()
+		}()
+		f()
+	}()
+}
+
+func (v *ValidatingAEAD) reportIfDiverged(d *Divergence) {
+	if d != nil {
+		v.report(*d)
+	}
+}
+
+// compareDecryptions returns the divergence between the results of the
+// primary and secondary AEADs' decryptions of the same ciphertext, or nil if
+// they agree.
+func compareDecryptions(primary []byte, primaryErr error, secondary []byte, secondaryErr error) *Divergence {
+	switch {
+	case primaryErr != nil && secondaryErr != nil:
+		return nil
+	case primaryErr != nil || secondaryErr != nil:
+		return &Divergence{Method: MethodDecrypt, PrimaryErr: primaryErr, SecondaryErr: secondaryErr}
+	case !bytes.Equal(primary, secondary):
+		return &Divergence{Method: MethodDecrypt, PlaintextMismatch: true}
+	default:
+		return nil
+	}
+}
+
+// clone returns a copy of b, which is nil if b is nil.
+func clone(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
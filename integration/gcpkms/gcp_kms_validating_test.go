@@ -0,0 +1,296 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+// secondaryAEAD wraps the AEAD under validation. Decrypt blocks until
+// release is closed, if set, and then fails with err, if set, or returns the
+// plaintext with its first byte flipped if flip is set.
+type secondaryAEAD struct {
+	tink.AEAD
+	release chan struct{}
+	err     error
+	flip    bool
+	calls   atomic.Int32
+}
+
+func (a *secondaryAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	a.calls.Add(1)
+	if a.release != nil {
+		<-a.release
+	}
+	if a.err != nil {
+		return nil, a.err
+	}
+	plaintext, err := a.AEAD.Decrypt(ciphertext, associatedData)
+	if err == nil && a.flip && len(plaintext) > 0 {
+		plaintext[0] ^= 1
+	}
+	return plaintext, err
+}
+
+// divergences records the divergences reported by a ValidatingAEAD.
+type divergences struct {
+	mu   sync.Mutex
+	list []gcpkms.Divergence
+}
+
+func (d *divergences) report(div gcpkms.Divergence) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.list = append(d.list, div)
+}
+
+func (d *divergences) get() []gcpkms.Divergence {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]gcpkms.Divergence(nil), d.list...)
+}
+
+func newValidatingAEAD(t *testing.T, primary, secondary tink.AEAD, mode gcpkms.ValidationMode, opts ...gcpkms.ValidatingAEADOption) (*gcpkms.ValidatingAEAD, *divergences) {
+	t.Helper()
+	d := &divergences{}
+	v, err := gcpkms.NewValidatingAEAD(primary, secondary, mode, d.report, opts...)
+	if err != nil {
+		t.Fatalf("gcpkms.NewValidatingAEAD() err = %v, want nil", err)
+	}
+	return v, d
+}
+
+var validationModes = map[string]gcpkms.ValidationMode{"shadow": gcpkms.ValidationShadow, "strict": gcpkms.ValidationStrict}
+
+func TestValidatingAEADAgreement(t *testing.T) {
+	for name, mode := range validationModes {
+		t.Run(name, func(t *testing.T) {
+			srv := newFakeServer(t)
+			// Two clients of the same key stand for the two transports.
+			secondary := &secondaryAEAD{AEAD: newFakeAEAD(t, srv)}
+			v, d := newValidatingAEAD(t, newFakeAEAD(t, srv), secondary, mode)
+			plaintext, associatedData := []byte("plaintext"), []byte("associated data")
+			ciphertext, err := v.Encrypt(plaintext, associatedData)
+			if err != nil {
+				t.Fatalf("v.Encrypt() err = %v, want nil", err)
+			}
+			got, err := v.Decrypt(ciphertext, associatedData)
+			if err != nil {
+				t.Fatalf("v.Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, plaintext) {
+				t.Errorf("v.Decrypt() = %q, want %q", got, plaintext)
+			}
+			// Ciphertexts that neither AEAD decrypts agree too.
+			if _, err := v.Decrypt([]byte("invalid ciphertext"), associatedData); err == nil {
+				t.Error("v.Decrypt() of an invalid ciphertext err = nil, want error")
+			}
+			v.Wait()
+			if got := d.get(); len(got) != 0 {
+				t.Errorf("divergences = %v, want none", got)
+			}
+			if got, want := secondary.calls.Load(), int32(3); got != want {
+				t.Errorf("secondary Decrypt calls = %d, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestValidatingAEADDetectsDivergence(t *testing.T) {
+	errSecondary := errors.New("secondary failed")
+	for _, tc := range []struct {
+		name      string
+		secondary func(a *secondaryAEAD)
+		want      []gcpkms.Divergence
+	}{
+		{
+			name:      "secondary fails",
+			secondary: func(a *secondaryAEAD) { a.err = errSecondary },
+			want: []gcpkms.Divergence{
+				{Method: gcpkms.MethodEncrypt, SecondaryErr: errSecondary},
+				{Method: gcpkms.MethodDecrypt, SecondaryErr: errSecondary},
+			},
+		},
+		{
+			name:      "plaintexts differ",
+			secondary: func(a *secondaryAEAD) { a.flip = true },
+			want: []gcpkms.Divergence{
+				{Method: gcpkms.MethodEncrypt, PlaintextMismatch: true},
+				{Method: gcpkms.MethodDecrypt, PlaintextMismatch: true},
+			},
+		},
+	} {
+		for name, mode := range validationModes {
+			t.Run(tc.name+"/"+name, func(t *testing.T) {
+				srv := newFakeServer(t)
+				primary := newFakeAEAD(t, srv)
+				ciphertext, err := primary.Encrypt([]byte("plaintext"), nil)
+				if err != nil {
+					t.Fatalf("primary.Encrypt() err = %v, want nil", err)
+				}
+				secondary := &secondaryAEAD{AEAD: newFakeAEAD(t, srv)}
+				tc.secondary(secondary)
+				v, d := newValidatingAEAD(t, primary, secondary, mode)
+
+				_, encryptErr := v.Encrypt([]byte("plaintext"), nil)
+				v.Wait()
+				_, decryptErr := v.Decrypt(ciphertext, nil)
+				v.Wait()
+				for _, err := range []error{encryptErr, decryptErr} {
+					if mode == gcpkms.ValidationStrict && !errors.Is(err, gcpkms.ErrValidationDivergence) {
+						t.Errorf("err = %v, want ErrValidationDivergence", err)
+					}
+					if mode == gcpkms.ValidationShadow && err != nil {
+						t.Errorf("err = %v, want nil", err)
+					}
+				}
+				got := d.get()
+				if len(got) != len(tc.want) {
+					t.Fatalf("divergences = %v, want %v", got, tc.want)
+				}
+				for i := range got {
+					if got[i] != tc.want[i] {
+						t.Errorf("divergence %d = %v, want %v", i, got[i], tc.want[i])
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestValidatingAEADDetectsPrimaryOnlyFailure(t *testing.T) {
+	// The secondary AEAD decrypts ciphertexts of a key the primary cannot.
+	primary := newFakeAEAD(t, newFakeServer(t))
+	srv := newFakeServer(t)
+	secondary := newFakeAEAD(t, srv)
+	ciphertext, err := secondary.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("secondary.Encrypt() err = %v, want nil", err)
+	}
+	v, d := newValidatingAEAD(t, primary, secondary, gcpkms.ValidationShadow)
+	if _, err := v.Decrypt(ciphertext, nil); err == nil {
+		t.Error("v.Decrypt() err = nil, want the error of the primary AEAD")
+	}
+	v.Wait()
+	got := d.get()
+	if len(got) != 1 || got[0].Method != gcpkms.MethodDecrypt || got[0].PrimaryErr == nil || got[0].SecondaryErr != nil {
+		t.Errorf("divergences = %v, want one with only a primary error", got)
+	}
+}
+
+func TestValidatingAEADShadowDoesNotWaitForSecondary(t *testing.T) {
+	srv := newFakeServer(t)
+	secondary := &secondaryAEAD{AEAD: newFakeAEAD(t, srv), release: make(chan struct{})}
+	v, d := newValidatingAEAD(t, newFakeAEAD(t, srv), secondary, gcpkms.ValidationShadow)
+	plaintext, associatedData := []byte("plaintext"), []byte("associated data")
+	ciphertext, err := v.Encrypt(plaintext, associatedData)
+	if err != nil {
+		t.Fatalf("v.Encrypt() err = %v, want nil", err)
+	}
+	got, err := v.Decrypt(ciphertext, associatedData)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Fatalf("v.Decrypt() = %q, %v, want %q, nil", got, err, plaintext)
+	}
+	// The caller may reuse its buffers while validations are running.
+	for _, b := range [][]byte{plaintext, associatedData, ciphertext, got} {
+		for i := range b {
+			b[i] = 0
+		}
+	}
+	close(secondary.release)
+	v.Wait()
+	if got := d.get(); len(got) != 0 {
+		t.Errorf("divergences = %v, want none", got)
+	}
+}
+
+func TestValidatingAEADSampling(t *testing.T) {
+	// Both AEADs are in memory, so that many calls are cheap.
+	const calls = 1000
+	ciphertext := []byte("ciphertext")
+	for _, tc := range []struct {
+		rate     float64
+		min, max int32
+	}{
+		{rate: 0, min: 0, max: 0},
+		{rate: 0.5, min: 350, max: 650},
+		{rate: 1, min: calls, max: calls},
+	} {
+		memory := &memoryAEAD{plaintext: []byte("plaintext")}
+		secondary := &secondaryAEAD{AEAD: memory}
+		v, d := newValidatingAEAD(t, memory, secondary, gcpkms.ValidationStrict, gcpkms.WithValidationSampleRate(tc.rate))
+		for i := 0; i < calls; i++ {
+			if _, err := v.Decrypt(ciphertext, nil); err != nil {
+				t.Fatalf("v.Decrypt() err = %v, want nil", err)
+			}
+		}
+		if got := secondary.calls.Load(); got < tc.min || got > tc.max {
+			t.Errorf("rate %v: secondary Decrypt calls = %d, want between %d and %d", tc.rate, got, tc.min, tc.max)
+		}
+		if got := d.get(); len(got) != 0 {
+			t.Errorf("rate %v: divergences = %v, want none", tc.rate, got)
+		}
+	}
+}
+
+// memoryAEAD decrypts every ciphertext to plaintext.
+type memoryAEAD struct {
+	plaintext []byte
+}
+
+func (a *memoryAEAD) Encrypt(plaintext, associatedData []byte) ([]byte, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (a *memoryAEAD) Decrypt(ciphertext, associatedData []byte) ([]byte, error) {
+	return append([]byte(nil), a.plaintext...), nil
+}
+
+func TestNewValidatingAEADRejectsInvalidArguments(t *testing.T) {
+	aead := newFakeAEAD(t, newFakeServer(t))
+	report := func(gcpkms.Divergence) {}
+	for _, tc := range []struct {
+		name               string
+		primary, secondary tink.AEAD
+		mode               gcpkms.ValidationMode
+		report             func(gcpkms.Divergence)
+		opts               []gcpkms.ValidatingAEADOption
+	}{
+		{name: "nil primary", secondary: aead, mode: gcpkms.ValidationShadow, report: report},
+		{name: "nil secondary", primary: aead, mode: gcpkms.ValidationShadow, report: report},
+		{name: "no mode", primary: aead, secondary: aead, report: report},
+		{name: "unknown mode", primary: aead, secondary: aead, mode: 3, report: report},
+		{name: "nil report", primary: aead, secondary: aead, mode: gcpkms.ValidationShadow},
+		{name: "negative rate", primary: aead, secondary: aead, mode: gcpkms.ValidationShadow, report: report, opts: []gcpkms.ValidatingAEADOption{gcpkms.WithValidationSampleRate(-0.1)}},
+		{name: "rate above 1", primary: aead, secondary: aead, mode: gcpkms.ValidationShadow, report: report, opts: []gcpkms.ValidatingAEADOption{gcpkms.WithValidationSampleRate(1.5)}},
+		{name: "NaN rate", primary: aead, secondary: aead, mode: gcpkms.ValidationShadow, report: report, opts: []gcpkms.ValidatingAEADOption{gcpkms.WithValidationSampleRate(math.NaN())}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewValidatingAEAD(tc.primary, tc.secondary, tc.mode, tc.report, tc.opts...); err == nil {
+				t.Error("gcpkms.NewValidatingAEAD() err = nil, want error")
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// Signature encodings of VerificationBundle.
+const (
+	// SignatureEncodingECDSA is the ASN.1 DER encoding of ECDSA signatures.
+	SignatureEncodingECDSA = "ECDSA_ASN1_DER"
+	// SignatureEncodingPKCS1v15 is the encoding of RSASSA-PKCS1-v1_5
+	// signatures.
+	SignatureEncodingPKCS1v15 = "RSASSA_PKCS1_V1_5"
+	// SignatureEncodingPSS is the encoding of RSASSA-PSS signatures with
+	// MGF1 and salts as long as the hash, which Cloud KMS uses.
+	SignatureEncodingPSS = "RSASSA_PSS"
+)
+
+// VerificationBundle holds everything required to verify the signatures of a
+// Cloud KMS key version without access to Cloud KMS, e.g. on an air-gapped
+// machine. It is marshaled to JSON with stable field names, and verified
+// with VerifyWithBundle.
+type VerificationBundle struct {
+	// KeyVersion is the resource name of the key version.
+	KeyVersion string `json:"key_version"`
+	// Algorithm is the Cloud KMS algorithm of the key version, e.g.
+	// "EC_SIGN_P256_SHA256".
+	Algorithm string `json:"algorithm"`
+	// Hash is the hash function that data is hashed with before it is
+	// signed, e.g. "SHA-256".
+	Hash string `json:"hash"`
+	// SignatureEncoding is the encoding of the signatures, e.g.
+	// SignatureEncodingECDSA.
+	SignatureEncoding string `json:"signature_encoding"`
+	// PublicKeyPEM is the PEM encoding of PublicKeyDER.
+	PublicKeyPEM string `json:"public_key_pem"`
+	// PublicKeyDER is the DER encoded SubjectPublicKeyInfo of the public
+	// key.
+	PublicKeyDER []byte `json:"public_key_der"`
+	// ExportTime is the time at which the bundle was exported.
+	ExportTime time.Time `json:"export_time"`
+}
+
+// signatureEncoding returns the signature encoding of alg.
+func (a signAlgorithm) signatureEncoding() string {
+	switch {
+	case a.curve != nil:
+		return SignatureEncodingECDSA
+	case a.pss:
+		return SignatureEncodingPSS
+	default:
+		return SignatureEncodingPKCS1v15
+	}
+}
+
+// ExportVerificationBundle fetches the public key of the key version with the
+// given resource name, e.g.
+// "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1", and
+// returns a bundle to verify its signatures offline. The request is bound to
+// ctx, and the integrity of the response is checked as by NewSigner.
+// EC_SIGN_ED25519 keys are rejected, since bundles name the hash function
+// that data is hashed with before it is signed, and Ed25519 signs the data
+// itself.
+func ExportVerificationBundle(ctx context.Context, keyVersionName string, kms *cloudkms.Service) (*VerificationBundle, error) {
+	canonical, err := canonicalResourceName(keyVersionName)
+	if err != nil {
+		return nil, fmt.Errorf("malformed key version name %q: %v", keyVersionName, err)
+	}
+	if !cryptoKeyVersionRegex.MatchString(canonical) {
+		return nil, fmt.Errorf("invalid key version name %q, want projects/*/locations/*/keyRings/*/cryptoKeys/*/cryptoKeyVersions/*", keyVersionName)
+	}
+	if kms == nil {
+		return nil, errors.New("kms must not be nil")
+	}
+	pub, err := getPublicKey(ctx, kms, nil, &callTimeouts{}, nil, canonical, "")
+	if err != nil {
+		return nil, fmt.Errorf("getting public key of %s failed: %w", canonical, err)
+	}
+	if pub.alg.ed25519 {
+		return nil, fmt.Errorf("algorithm %s of %s is not supported in verification bundles", pub.algorithm, canonical)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub.key)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationBundle{
+		KeyVersion:        canonical,
+		Algorithm:         pub.algorithm,
+		Hash:              pub.alg.hash.String(),
+		SignatureEncoding: pub.alg.signatureEncoding(),
+		PublicKeyPEM:      string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+		PublicKeyDER:      der,
+		ExportTime:        time.Now().UTC(),
+	}, nil
+}
+
+// VerifyWithBundle returns nil if signature is a valid signature of data by
+// the key version of bundle. It does not contact Cloud KMS. It fails if the
+// fields of bundle are inconsistent, e.g. if the hash does not match the
+// algorithm or the PEM and DER encoded keys differ.
+func VerifyWithBundle(bundle *VerificationBundle, signature, data []byte) error {
+	if bundle == nil {
+		return errors.New("bundle must not be nil")
+	}
+	pub, err := parsePublicKey(bundle.KeyVersion, &cloudkms.PublicKey{
+		Algorithm: bundle.Algorithm,
+		Pem:       bundle.PublicKeyPEM,
+		PemCrc32c: ComputeCRC32C([]byte(bundle.PublicKeyPEM)),
+	})
+	if err != nil {
+		return fmt.Errorf("invalid verification bundle: %v", err)
+	}
+	if pub.alg.ed25519 {
+		return fmt.Errorf("invalid verification bundle: algorithm %s is not supported", bundle.Algorithm)
+	}
+	if block, _ := pem.Decode([]byte(bundle.PublicKeyPEM)); !bytes.Equal(block.Bytes, bundle.PublicKeyDER) {
+		return errors.New("invalid verification bundle: PEM and DER encoded public keys differ")
+	}
+	if bundle.Hash != pub.alg.hash.String() {
+		return fmt.Errorf("invalid verification bundle: hash %q does not match algorithm %s", bundle.Hash, bundle.Algorithm)
+	}
+	if bundle.SignatureEncoding != pub.alg.signatureEncoding() {
+		return fmt.Errorf("invalid verification bundle: signature encoding %q does not match algorithm %s", bundle.SignatureEncoding, bundle.Algorithm)
+	}
+	return pub.verify(signature, data)
+}
@@ -0,0 +1,143 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+func TestVerificationBundleRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		hash      crypto.Hash
+		encoding  string
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256", hash: crypto.SHA256, encoding: gcpkms.SignatureEncodingECDSA},
+		{algorithm: "EC_SIGN_P384_SHA384", hash: crypto.SHA384, encoding: gcpkms.SignatureEncodingECDSA},
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", hash: crypto.SHA256, encoding: gcpkms.SignatureEncodingPKCS1v15},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", hash: crypto.SHA256, encoding: gcpkms.SignatureEncodingPSS},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			_, kms := newFakeSigningKey(t, tc.algorithm)
+			version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+			before := time.Now()
+			bundle, err := gcpkms.ExportVerificationBundle(context.Background(), version, kms)
+			if err != nil {
+				t.Fatalf("gcpkms.ExportVerificationBundle() err = %v, want nil", err)
+			}
+			if bundle.KeyVersion != version || bundle.Algorithm != tc.algorithm || bundle.Hash != tc.hash.String() || bundle.SignatureEncoding != tc.encoding {
+				t.Errorf("bundle = %+v, want version %s, algorithm %s, hash %v and encoding %s", bundle, version, tc.algorithm, tc.hash, tc.encoding)
+			}
+			if bundle.ExportTime.Before(before.Add(-time.Second)) || bundle.ExportTime.After(time.Now()) {
+				t.Errorf("bundle.ExportTime = %v, want about %v", bundle.ExportTime, before)
+			}
+
+			data, err := json.Marshal(bundle)
+			if err != nil {
+				t.Fatalf("json.Marshal() err = %v, want nil", err)
+			}
+			var fields map[string]any
+			if err := json.Unmarshal(data, &fields); err != nil {
+				t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+			}
+			var names []string
+			for name := range fields {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			wantNames := []string{"algorithm", "export_time", "hash", "key_version", "public_key_der", "public_key_pem", "signature_encoding"}
+			if !reflect.DeepEqual(names, wantNames) {
+				t.Errorf("JSON fields = %v, want %v", names, wantNames)
+			}
+			var offline gcpkms.VerificationBundle
+			if err := json.Unmarshal(data, &offline); err != nil {
+				t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+			}
+
+			signature := sign(t, kms, version, tc.hash, []byte("data"))
+			if err := gcpkms.VerifyWithBundle(&offline, signature, []byte("data")); err != nil {
+				t.Errorf("gcpkms.VerifyWithBundle() err = %v, want nil", err)
+			}
+			if err := gcpkms.VerifyWithBundle(&offline, signature, []byte("other data")); err == nil {
+				t.Error("gcpkms.VerifyWithBundle() with other data err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyWithBundleRejectsInconsistentBundles(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	version := fakeSigningKeyName + "/cryptoKeyVersions/1"
+	bundle, err := gcpkms.ExportVerificationBundle(context.Background(), version, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.ExportVerificationBundle() err = %v, want nil", err)
+	}
+	signature := sign(t, kms, version, crypto.SHA256, []byte("data"))
+	_, otherKMS := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	other, err := gcpkms.ExportVerificationBundle(context.Background(), version, otherKMS)
+	if err != nil {
+		t.Fatalf("gcpkms.ExportVerificationBundle() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name   string
+		modify func(b *gcpkms.VerificationBundle)
+	}{
+		{name: "other algorithm", modify: func(b *gcpkms.VerificationBundle) { b.Algorithm = "EC_SIGN_P384_SHA384" }},
+		{name: "unsupported algorithm", modify: func(b *gcpkms.VerificationBundle) { b.Algorithm = "EC_SIGN_ED25519" }},
+		{name: "other hash", modify: func(b *gcpkms.VerificationBundle) { b.Hash = crypto.SHA384.String() }},
+		{name: "other encoding", modify: func(b *gcpkms.VerificationBundle) { b.SignatureEncoding = gcpkms.SignatureEncodingPSS }},
+		{name: "other DER key", modify: func(b *gcpkms.VerificationBundle) { b.PublicKeyDER = other.PublicKeyDER }},
+		{name: "other PEM key", modify: func(b *gcpkms.VerificationBundle) { b.PublicKeyPEM = other.PublicKeyPEM }},
+		{name: "other keys", modify: func(b *gcpkms.VerificationBundle) { b.PublicKeyPEM, b.PublicKeyDER = other.PublicKeyPEM, other.PublicKeyDER }},
+		{name: "malformed PEM", modify: func(b *gcpkms.VerificationBundle) { b.PublicKeyPEM = "key" }},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := *bundle
+			tc.modify(&b)
+			if err := gcpkms.VerifyWithBundle(&b, signature, []byte("data")); err == nil {
+				t.Error("gcpkms.VerifyWithBundle() err = nil, want error")
+			}
+		})
+	}
+	if err := gcpkms.VerifyWithBundle(nil, signature, []byte("data")); err == nil {
+		t.Error("gcpkms.VerifyWithBundle(nil) err = nil, want error")
+	}
+}
+
+func TestExportVerificationBundleRejectsEd25519(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_ED25519")
+	if _, err := gcpkms.ExportVerificationBundle(context.Background(), fakeSigningKeyName+"/cryptoKeyVersions/1", kms); err == nil {
+		t.Error("gcpkms.ExportVerificationBundle() err = nil, want error")
+	}
+}
+
+func TestExportVerificationBundleRejectsInvalidNames(t *testing.T) {
+	_, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	for _, name := range []string{"", fakeSigningKeyName, fakeSigningKeyName + "/cryptoKeyVersions/%31"} {
+		if _, err := gcpkms.ExportVerificationBundle(context.Background(), name, kms); err == nil {
+			t.Errorf("gcpkms.ExportVerificationBundle(%q) err = nil, want error", name)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+
+	"github.com/tink-crypto/tink-go/v2/tink"
+)
+
+const defaultVersionRefreshInterval = 10 * time.Minute
+
+var cryptoKeyRegex = regexp.MustCompile(`^projects/[^/]+/locations/[^/]+/keyRings/[^/]+/cryptoKeys/[^/]+$`)
+
+// VerifierOption configures a verifier created with NewMultiVersionVerifier.
+type VerifierOption interface {
+	applyVerifier(cfg *verifierConfig) error
+}
+
+type verifierOptionFunc func(*verifierConfig) error
+
+func (o verifierOptionFunc) applyVerifier(cfg *verifierConfig) error { return o(cfg) }
+
+type verifierConfig struct {
+	refreshInterval time.Duration
+	timeouts        callTimeouts
+	integrity       *integrityRetry
+}
+
+// WithVersionRefreshInterval sets how often the verifier refreshes the list
+// of enabled key versions. The default is 10 minutes.
+func WithVersionRefreshInterval(d time.Duration) VerifierOption {
+	return verifierOptionFunc(func(cfg *verifierConfig) error {
+		if d <= 0 {
+			return fmt.Errorf("version refresh interval must be positive, got %v", d)
+		}
+		cfg.refreshInterval = d
+		return nil
+	})
+}
+
+// MultiVersionVerifier verifies signatures created by any enabled version of
+// a Cloud KMS asymmetric signing key, so that signatures keep verifying after
+// the key is rotated. Signatures are verified locally with the public keys of
+// the versions, which are fetched once and cached.
+//
+// MultiVersionVerifier is safe for concurrent use.
+type MultiVersionVerifier struct {
+	ctx             context.Context
+	cryptoKeyName   string
+	kms             *cloudkms.Service
+	refreshInterval time.Duration
+	timeouts        callTimeouts
+	// integrity is nil if the default integrity retries are used.
+	integrity *integrityRetry
+	// invoker is nil unless the verifier was returned by
+	// Client.GetMultiVersionVerifier.
+	invoker *invoker
+
+	mu sync.Mutex
+	// keys holds the public keys of the enabled versions, newest first.
+	keys        []*publicKey
+	lastRefresh time.Time
+}
+
+var _ tink.Verifier = (*MultiVersionVerifier)(nil)
+
+// NewMultiVersionVerifier returns a verifier for signatures created by the
+// enabled versions of the crypto key with the given resource name, e.g.
+// "projects/p/locations/l/keyRings/r/cryptoKeys/k". The list of enabled
+// versions is refreshed periodically, and all requests are bound to ctx.
+func NewMultiVersionVerifier(ctx context.Context, cryptoKeyName string, kms *cloudkms.Service, opts ...VerifierOption) (*MultiVersionVerifier, error) {
+	return newMultiVersionVerifier(ctx, cryptoKeyName, kms, nil, opts)
+}
+
+// GetMultiVersionVerifier returns a MultiVersionVerifier for the crypto key
+// with URI keyURI, e.g. 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k'.
+// Requests are bound to ctx, and opts configure the verifier like those of
+// NewMultiVersionVerifier.
+//
+// The ListCryptoKeyVersions and GetPublicKey requests of the verifier are
+// issued like those of the primitives returned by GetAEAD: they are retried
+// on transient errors within the retry budget of the client, and count
+// against WithMaxConcurrentCalls.
+func (c *Client) GetMultiVersionVerifier(ctx context.Context, keyURI string, opts ...VerifierOption) (*MultiVersionVerifier, error) {
+	canonical, err := canonicalKeyURI(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Supported(keyURI) {
+		return nil, errors.New("unsupported keyURI")
+	}
+	c.mu.Lock()
+	closed := c.closed
+	c.mu.Unlock()
+	if closed {
+		return nil, ErrClientClosed
+	}
+	name := canonical[len(gcpPrefix):]
+	if err := c.bindLocation(name); err != nil {
+		return nil, err
+	}
+	return newMultiVersionVerifier(ctx, name, c.kms, c.invoker, opts)
+}
+
+// newMultiVersionVerifier implements NewMultiVersionVerifier, with requests
+// issued by invoker, which may be nil.
+func newMultiVersionVerifier(ctx context.Context, cryptoKeyName string, kms *cloudkms.Service, invoker *invoker, opts []VerifierOption) (*MultiVersionVerifier, error) {
+	if !cryptoKeyRegex.MatchString(cryptoKeyName) {
+		return nil, fmt.Errorf("invalid crypto key name %q, want projects/*/locations/*/keyRings/*/cryptoKeys/*", cryptoKeyName)
+	}
+	if kms == nil {
+		return nil, errors.New("kms must not be nil")
+	}
+	cfg := &verifierConfig{refreshInterval: defaultVersionRefreshInterval}
+	for _, opt := range opts {
+		if err := opt.applyVerifier(cfg); err != nil {
+			return nil, err
+		}
+	}
+	v := &MultiVersionVerifier{
+		ctx:             ctx,
+		cryptoKeyName:   cryptoKeyName,
+		kms:             kms,
+		refreshInterval: cfg.refreshInterval,
+		timeouts:        cfg.timeouts,
+		integrity:       cfg.integrity,
+		invoker:         invoker,
+	}
+	if invoker != nil {
+		v.integrity = v.integrity.forClient(invoker.budget, invoker.retryPredicate, invoker.clock)
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if err := v.refresh(); err != nil {
+		return nil, err
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("%s has no enabled versions", cryptoKeyName)
+	}
+	return v, nil
+}
+
+// Verify returns nil if signature is a valid signature of data under any
+// enabled version of the key.
+func (v *MultiVersionVerifier) Verify(signature, data []byte) error {
+	return v.VerifyWithHint(signature, data, "")
+}
+
+// VerifyWithHint is like Verify, but tries the key version with the resource
+// name versionHint first. If the version is not known yet, the list of
+// enabled versions is refreshed first.
+func (v *MultiVersionVerifier) VerifyWithHint(signature, data []byte, versionHint string) error {
+	v.mu.Lock()
+	if v.invoker.now().Sub(v.lastRefresh) >= v.refreshInterval || (versionHint != "" && v.find(versionHint) == nil) {
+		// On failure, the previous versions are kept until the next refresh.
+		v.refresh()
+	}
+	keys := v.keys
+	if hinted := v.find(versionHint); hinted != nil {
+		keys = []*publicKey{hinted}
+		for _, k := range v.keys {
+			if k != hinted {
+				keys = append(keys, k)
+			}
+		}
+	}
+	v.mu.Unlock()
+
+	for _, k := range keys {
+		if k.verify(signature, data) == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("signature does not verify with any enabled version of %s", v.cryptoKeyName)
+}
+
+// find returns the public key of the version with the given name, or nil.
+// v.mu must be held.
+func (v *MultiVersionVerifier) find(version string) *publicKey {
+	for _, k := range v.keys {
+		if k.version == version {
+			return k
+		}
+	}
+	return nil
+}
+
+// refresh replaces the public keys with those of the currently enabled
+// versions, fetching the ones that are not cached yet. Versions that are
+// disabled or destroyed in the meantime are skipped. v.mu must be held.
+func (v *MultiVersionVerifier) refresh() error {
+	v.lastRefresh = v.invoker.now()
+	var versions []*cloudkms.CryptoKeyVersion
+	err := v.invoker.do(v.ctx, MethodListCryptoKeyVersions, func(ctx context.Context) error {
+		versions = nil
+		return v.kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.List(v.cryptoKeyName).Filter("state=ENABLED").Pages(ctx, func(resp *cloudkms.ListCryptoKeyVersionsResponse) error {
+			versions = append(versions, resp.CryptoKeyVersions...)
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("listing versions of %s failed: %v", v.cryptoKeyName, err)
+	}
+	var keys []*publicKey
+	for _, version := range versions {
+		if version.State != "ENABLED" {
+			continue
+		}
+		if k := v.find(version.Name); k != nil {
+			keys = append(keys, k)
+			continue
+		}
+		k, err := getPublicKey(v.ctx, v.kms, v.invoker, &v.timeouts, v.integrity, version.Name, version.ProtectionLevel)
+		if _, _, ok := versionNotEnabled(err); ok {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("getting public key of %s failed: %v", version.Name, err)
+		}
+		keys = append(keys, k)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return versionNumber(keys[i].version) > versionNumber(keys[j].version)
+	})
+	v.keys = keys
+	return nil
+}
+
+// versionNumber returns the number of the key version with the given
+// resource name, or 0 if it cannot be parsed.
+func versionNumber(version string) int {
+	n, err := strconv.Atoi(version[strings.LastIndex(version, "/")+1:])
+	if err != nil {
+		return 0
+	}
+	return n
+}
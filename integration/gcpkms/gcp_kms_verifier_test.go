@@ -0,0 +1,250 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const fakeSigningKeyName = "projects/p/locations/global/keyRings/r/cryptoKeys/signing"
+
+func newFakeSigningKey(t testing.TB, algorithm string) (*fakekms.Server, *cloudkms.Service) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateSigningKey(fakeSigningKeyName, algorithm); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	return srv, newKMSService(t, srv.ClientOptions()...)
+}
+
+// sign signs data with the given key version through the Cloud KMS API.
+func sign(t *testing.T, kms *cloudkms.Service, version string, hash crypto.Hash, data []byte) []byte {
+	t.Helper()
+	h := hash.New()
+	h.Write(data)
+	encoded := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	digest := &cloudkms.Digest{}
+	switch hash {
+	case crypto.SHA256:
+		digest.Sha256 = encoded
+	case crypto.SHA384:
+		digest.Sha384 = encoded
+	case crypto.SHA512:
+		digest.Sha512 = encoded
+	}
+	resp, err := kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.AsymmetricSign(version, &cloudkms.AsymmetricSignRequest{Digest: digest}).Do()
+	if err != nil {
+		t.Fatalf("AsymmetricSign() err = %v, want nil", err)
+	}
+	signature, err := base64.StdEncoding.DecodeString(resp.Signature)
+	if err != nil {
+		t.Fatalf("base64.StdEncoding.DecodeString() err = %v, want nil", err)
+	}
+	return signature
+}
+
+func versionName(version int) string {
+	return fmt.Sprintf("%s/cryptoKeyVersions/%d", fakeSigningKeyName, version)
+}
+
+func TestMultiVersionVerifierAlgorithms(t *testing.T) {
+	for _, tc := range []struct {
+		algorithm string
+		hash      crypto.Hash
+	}{
+		{"EC_SIGN_P256_SHA256", crypto.SHA256},
+		{"EC_SIGN_P384_SHA384", crypto.SHA384},
+		{"RSA_SIGN_PKCS1_2048_SHA256", crypto.SHA256},
+		{"RSA_SIGN_PSS_2048_SHA256", crypto.SHA256},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			_, kms := newFakeSigningKey(t, tc.algorithm)
+			v, err := gcpkms.NewMultiVersionVerifier(context.Background(), fakeSigningKeyName, kms)
+			if err != nil {
+				t.Fatalf("gcpkms.NewMultiVersionVerifier() err = %v, want nil", err)
+			}
+			data := []byte("data")
+			signature := sign(t, kms, versionName(1), tc.hash, data)
+			if err := v.Verify(signature, data); err != nil {
+				t.Errorf("v.Verify() err = %v, want nil", err)
+			}
+			if err := v.Verify(signature, []byte("other data")); err == nil {
+				t.Error("v.Verify() with other data err = nil, want error")
+			}
+			signature[len(signature)-1] ^= 1
+			if err := v.Verify(signature, data); err == nil {
+				t.Error("v.Verify() with modified signature err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestMultiVersionVerifierAfterRotation(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	v, err := gcpkms.NewMultiVersionVerifier(context.Background(), fakeSigningKeyName, kms)
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiVersionVerifier() err = %v, want nil", err)
+	}
+	data := []byte("data")
+	sig1 := sign(t, kms, versionName(1), crypto.SHA256, data)
+
+	if _, err := srv.AddVersion(fakeSigningKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	sig2 := sign(t, kms, versionName(2), crypto.SHA256, data)
+	// The new version is only known after the next refresh, unless hinted.
+	if err := v.Verify(sig2, data); err == nil {
+		t.Error("v.Verify() with signature of new version before refresh err = nil, want error")
+	}
+	if err := v.VerifyWithHint(sig2, data, versionName(2)); err != nil {
+		t.Errorf("v.VerifyWithHint() err = %v, want nil", err)
+	}
+	for _, sig := range [][]byte{sig1, sig2} {
+		if err := v.Verify(sig, data); err != nil {
+			t.Errorf("v.Verify() err = %v, want nil", err)
+		}
+	}
+	if err := v.VerifyWithHint(sig1, data, versionName(2)); err != nil {
+		t.Errorf("v.VerifyWithHint() with hint of other version err = %v, want nil", err)
+	}
+	if got := srv.CallCount("GetPublicKey"); got != 2 {
+		t.Errorf("GetPublicKey called %d times, want 2", got)
+	}
+}
+
+func TestMultiVersionVerifierDropsDestroyedVersions(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	if _, err := srv.AddVersion(fakeSigningKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	v, err := gcpkms.NewMultiVersionVerifier(context.Background(), fakeSigningKeyName, kms,
+		gcpkms.WithVersionRefreshInterval(time.Nanosecond))
+	if err != nil {
+		t.Fatalf("gcpkms.NewMultiVersionVerifier() err = %v, want nil", err)
+	}
+	data := []byte("data")
+	sig1 := sign(t, kms, versionName(1), crypto.SHA256, data)
+	sig2 := sign(t, kms, versionName(2), crypto.SHA256, data)
+	if err := v.Verify(sig1, data); err != nil {
+		t.Errorf("v.Verify() err = %v, want nil", err)
+	}
+
+	if err := srv.SetVersionState(fakeSigningKeyName, 1, "DESTROYED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	if err := v.Verify(sig1, data); err == nil {
+		t.Error("v.Verify() with signature of destroyed version err = nil, want error")
+	}
+	if err := v.Verify(sig2, data); err != nil {
+		t.Errorf("v.Verify() err = %v, want nil", err)
+	}
+
+	if err := srv.SetVersionState(fakeSigningKeyName, 2, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	if err := v.Verify(sig2, data); err == nil {
+		t.Error("v.Verify() with signature of disabled version err = nil, want error")
+	}
+}
+
+func TestMultiVersionVerifierMethodTimeout(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	srv.SetLatency(func(rpc string) time.Duration {
+		if rpc == "GetPublicKey" {
+			return 200 * time.Millisecond
+		}
+		return 0
+	})
+	_, err := gcpkms.NewMultiVersionVerifier(context.Background(), fakeSigningKeyName, kms,
+		gcpkms.WithMethodTimeout(gcpkms.MethodGetPublicKey, 50*time.Millisecond))
+	if err == nil || !strings.Contains(err.Error(), context.DeadlineExceeded.Error()) {
+		t.Errorf("gcpkms.NewMultiVersionVerifier() err = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := gcpkms.NewMultiVersionVerifier(context.Background(), fakeSigningKeyName, kms,
+		gcpkms.WithMethodTimeout(gcpkms.MethodGetPublicKey, 5*time.Second)); err != nil {
+		t.Errorf("gcpkms.NewMultiVersionVerifier() err = %v, want nil", err)
+	}
+}
+
+func TestNewMultiVersionVerifierRejectsCorruptedPublicKey(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/publicKey") {
+			json.NewEncoder(w).Encode(&cloudkms.PublicKey{
+				Name:      versionName(1),
+				Pem:       "-----BEGIN PUBLIC KEY-----\n-----END PUBLIC KEY-----\n",
+				PemCrc32c: 0x1234,
+				Algorithm: "EC_SIGN_P256_SHA256",
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(&cloudkms.ListCryptoKeyVersionsResponse{
+			CryptoKeyVersions: []*cloudkms.CryptoKeyVersion{{Name: versionName(1), State: "ENABLED"}},
+		})
+	}))
+	defer srv.Close()
+	kms := newKMSService(t, option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if _, err := gcpkms.NewMultiVersionVerifier(context.Background(), fakeSigningKeyName, kms); err == nil {
+		t.Error("gcpkms.NewMultiVersionVerifier() err = nil, want error")
+	}
+}
+
+func TestNewMultiVersionVerifierWithInvalidArguments(t *testing.T) {
+	srv, kms := newFakeSigningKey(t, "EC_SIGN_P256_SHA256")
+	if err := srv.CreateKey(fakeKeyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name          string
+		cryptoKeyName string
+		kms           *cloudkms.Service
+		opts          []gcpkms.VerifierOption
+	}{
+		{name: "invalid key name", cryptoKeyName: "projects/p/locations/global/keyRings/r", kms: kms},
+		{name: "nil kms", cryptoKeyName: fakeSigningKeyName},
+		{name: "unknown key", cryptoKeyName: fakeSigningKeyName + "2", kms: kms},
+		{name: "symmetric key", cryptoKeyName: fakeKeyName, kms: kms},
+		{name: "invalid refresh interval", cryptoKeyName: fakeSigningKeyName, kms: kms, opts: []gcpkms.VerifierOption{gcpkms.WithVersionRefreshInterval(0)}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := gcpkms.NewMultiVersionVerifier(context.Background(), tc.cryptoKeyName, tc.kms, tc.opts...); err == nil {
+				t.Error("gcpkms.NewMultiVersionVerifier() err = nil, want error")
+			}
+		})
+	}
+
+	if err := srv.SetVersionState(fakeSigningKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	if _, err := gcpkms.NewMultiVersionVerifier(context.Background(), fakeSigningKeyName, kms); err == nil {
+		t.Error("gcpkms.NewMultiVersionVerifier() without enabled versions err = nil, want error")
+	}
+}
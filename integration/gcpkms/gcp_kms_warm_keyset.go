@@ -0,0 +1,194 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	kmsenvpb "github.com/tink-crypto/tink-go/v2/proto/kms_envelope_go_proto"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+const (
+	kmsAEADKeyTypeURL         = "type.googleapis.com/google.crypto.tink.KmsAeadKey"
+	kmsEnvelopeAEADKeyTypeURL = "type.googleapis.com/google.crypto.tink.KmsEnvelopeAeadKey"
+)
+
+// KeyWarmup is the outcome of warming up the KEK with the given URI.
+type KeyWarmup struct {
+	// KeyURI is the URI of the KEK, as stored in the keyset.
+	KeyURI string
+	// Client is the client whose primitive cache holds the KEK. It is the
+	// registered KMS client for KeyURI if that is a *Client, and
+	// WarmupReport.Client otherwise.
+	Client *Client
+	// Validated is true if the crypto key was fetched from Cloud KMS and is
+	// an ENCRYPT_DECRYPT key, which is only checked with WithEagerValidation.
+	Validated bool
+	// Err is nil if the KEK is ready to be used.
+	Err error
+}
+
+// WarmupReport summarizes the warm-up of the KEKs of a keyset.
+type WarmupReport struct {
+	// Keys holds the outcome for every distinct gcp-kms KEK URI of the
+	// enabled keys of the keyset, in keyset order.
+	Keys []KeyWarmup
+	// Client is the client created for the KEKs whose URI is not supported by
+	// a registered *Client, or nil if there were none. It should be
+	// registered with registry.RegisterKMSClient, so that the primitives of
+	// the keyset use it.
+	Client *Client
+}
+
+// WarmForKeyset prepares the clients for all KEKs of the KmsAeadKey and
+// KmsEnvelopeAeadKey keys of handle whose URI starts with gcp-kms://, so that
+// the first use of the keyset does not pay for creating them. URIs of other
+// KMS are ignored, and so are disabled keys.
+//
+// A registered KMS client that supports a URI, as returned by
+// registry.GetKMSClient, is reused if it is a *Client. The other URIs share
+// a single new client configured with opts, and thus one connection. The
+// primitive of every KEK is created in the cache of its client. With
+// WithEagerValidation, the crypto keys are also fetched from Cloud KMS to
+// check that they exist, are ENCRYPT_DECRYPT keys and can be accessed with
+// the credentials of the client.
+//
+// The outcome of every KEK is reported, and the error joins the errors of
+// the KEKs that are not ready. WarmForKeyset also returns an error if the
+// keys of handle cannot be read, or the client cannot be created.
+func WarmForKeyset(ctx context.Context, handle *keyset.Handle, opts ...Option) (WarmupReport, error) {
+	cfg, err := newConfig(opts...)
+	if err != nil {
+		return WarmupReport{}, err
+	}
+	uris, err := keysetKEKURIs(handle)
+	if err != nil {
+		return WarmupReport{}, err
+	}
+	var report WarmupReport
+	for _, uri := range uris {
+		w := KeyWarmup{KeyURI: uri}
+		if kc, err := registry.GetKMSClient(uri); err == nil {
+			w.Client, _ = kc.(*Client)
+		}
+		if w.Client == nil {
+			if report.Client == nil {
+				if report.Client, err = NewClient(ctx, gcpPrefix, opts...); err != nil {
+					return WarmupReport{}, err
+				}
+			}
+			w.Client = report.Client
+		}
+		report.Keys = append(report.Keys, w)
+	}
+
+	keys := report.Keys
+	aeads := make([]*AEAD, len(keys))
+	for i := range keys {
+		a, err := keys[i].Client.GetAEAD(keys[i].KeyURI)
+		if err != nil {
+			keys[i].Err = err
+			continue
+		}
+		aeads[i] = a.(*AEAD)
+	}
+	if cfg.eagerValidationConcurrency > 0 {
+		forEach(len(keys), cfg.eagerValidationConcurrency, func(i int) {
+			if aeads[i] == nil {
+				return
+			}
+			if err := keys[i].Client.validateKey(ctx, aeads[i].keyURI); err != nil {
+				keys[i].Err = err
+				return
+			}
+			keys[i].Validated = true
+		})
+	}
+	var errs []error
+	for _, w := range keys {
+		if w.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.KeyURI, w.Err))
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// keysetKEKURIs returns the distinct KEK URIs of the enabled KmsAeadKey and
+// KmsEnvelopeAeadKey keys of handle that start with gcp-kms://, in keyset
+// order.
+func keysetKEKURIs(handle *keyset.Handle) ([]string, error) {
+	km := &kekURIRecorder{}
+	if _, err := handle.PrimitivesWithKeyManager(km); err != nil {
+		return nil, fmt.Errorf("reading the keys of the keyset failed: %v", err)
+	}
+	var uris []string
+	seen := make(map[string]bool)
+	for _, uri := range km.uris {
+		if seen[uri] || !strings.HasPrefix(strings.ToLower(uri), gcpPrefix) {
+			continue
+		}
+		seen[uri] = true
+		uris = append(uris, uri)
+	}
+	return uris, nil
+}
+
+// kekURIRecorder is a key manager for KmsAeadKey and KmsEnvelopeAeadKey keys
+// that records their KEK URIs instead of creating primitives, so that reading
+// the URIs neither looks up KMS clients nor contacts a KMS.
+type kekURIRecorder struct {
+	uris []string
+}
+
+var _ registry.KeyManager = (*kekURIRecorder)(nil)
+
+// Primitive records the KEK URI of serializedKey and returns it as a
+// placeholder primitive. KmsAeadKey and KmsEnvelopeAeadKey have the same
+// wire format up to the KEK URI, so both are parsed as KmsEnvelopeAeadKey.
+func (r *kekURIRecorder) Primitive(serializedKey []byte) (any, error) {
+	key := new(kmsenvpb.KmsEnvelopeAeadKey)
+	if err := proto.Unmarshal(serializedKey, key); err != nil {
+		return nil, err
+	}
+	uri := key.GetParams().GetKekUri()
+	if uri == "" {
+		return nil, errors.New("KMS key without KEK URI")
+	}
+	r.uris = append(r.uris, uri)
+	return uri, nil
+}
+
+func (r *kekURIRecorder) DoesSupport(typeURL string) bool {
+	return typeURL == kmsAEADKeyTypeURL || typeURL == kmsEnvelopeAEADKeyTypeURL
+}
+
+func (r *kekURIRecorder) TypeURL() string { return kmsEnvelopeAEADKeyTypeURL }
+
+func (r *kekURIRecorder) NewKey([]byte) (proto.Message, error) {
+	return nil, errors.New("kekURIRecorder does not create keys")
+}
+
+func (r *kekURIRecorder) NewKeyData([]byte) (*tinkpb.KeyData, error) {
+	return nil, errors.New("kekURIRecorder does not create keys")
+}
@@ -0,0 +1,181 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/core/registry"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+// newKMSEnvelopeKeyset returns a keyset with a KMS envelope key for each of
+// keyURIs, the first of which is primary, followed by an AES-GCM key.
+func newKMSEnvelopeKeyset(t *testing.T, keyURIs ...string) *keyset.Handle {
+	t.Helper()
+	manager := keyset.NewManager()
+	var templates []*tinkpb.KeyTemplate
+	for _, keyURI := range keyURIs {
+		template, err := aead.CreateKMSEnvelopeAEADKeyTemplate(keyURI, aead.AES256GCMKeyTemplate())
+		if err != nil {
+			t.Fatalf("aead.CreateKMSEnvelopeAEADKeyTemplate() err = %v, want nil", err)
+		}
+		templates = append(templates, template)
+	}
+	templates = append(templates, aead.AES128GCMKeyTemplate())
+	for i, template := range templates {
+		id, err := manager.Add(template)
+		if err != nil {
+			t.Fatalf("manager.Add() err = %v, want nil", err)
+		}
+		if i == 0 {
+			if err := manager.SetPrimary(id); err != nil {
+				t.Fatalf("manager.SetPrimary() err = %v, want nil", err)
+			}
+		}
+	}
+	handle, err := manager.Handle()
+	if err != nil {
+		t.Fatalf("manager.Handle() err = %v, want nil", err)
+	}
+	return handle
+}
+
+func TestWarmForKeyset(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 2)
+	t.Cleanup(registry.ClearKMSClients)
+	// Each URI is warmed once.
+	handle := newKMSEnvelopeKeyset(t, keyURIs[0], keyURIs[1], keyURIs[0])
+
+	report, err := gcpkms.WarmForKeyset(context.Background(), handle,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithEagerValidation(1))
+	if err != nil {
+		t.Fatalf("gcpkms.WarmForKeyset() err = %v, want nil", err)
+	}
+	if report.Client == nil {
+		t.Fatal("report.Client = nil, want the client created for the keyset")
+	}
+	if len(report.Keys) != len(keyURIs) {
+		t.Fatalf("len(report.Keys) = %d, want %d", len(report.Keys), len(keyURIs))
+	}
+	for i, w := range report.Keys {
+		if w.KeyURI != keyURIs[i] || w.Client != report.Client || !w.Validated || w.Err != nil {
+			t.Errorf("report.Keys[%d] = %+v, want %s validated with report.Client", i, w, keyURIs[i])
+		}
+	}
+	if got := srv.CallCount("GetCryptoKey"); got != len(keyURIs) {
+		t.Errorf("GetCryptoKey calls = %d, want %d", got, len(keyURIs))
+	}
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("srv.Connections() = %d, want 1", got)
+	}
+
+	// The keyset uses the warmed client and its connection.
+	registry.RegisterKMSClient(report.Client)
+	a, err := aead.New(handle)
+	if err != nil {
+		t.Fatalf("aead.New() err = %v, want nil", err)
+	}
+	plaintext := []byte("plaintext")
+	ciphertext, err := a.Encrypt(plaintext, nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	if got, err := a.Decrypt(ciphertext, nil); err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("a.Decrypt() = %q, %v, want %q, nil", got, err, plaintext)
+	}
+	if got := srv.Connections(); got != 1 {
+		t.Errorf("srv.Connections() = %d, want 1", got)
+	}
+}
+
+func TestWarmForKeysetReusesRegisteredClients(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 2)
+	t.Cleanup(registry.ClearKMSClients)
+	registered, err := gcpkms.NewClient(context.Background(), keyURIs[0],
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	registry.RegisterKMSClient(registered)
+	handle := newKMSEnvelopeKeyset(t, keyURIs...)
+
+	report, err := gcpkms.WarmForKeyset(context.Background(), handle,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.WarmForKeyset() err = %v, want nil", err)
+	}
+	if len(report.Keys) != 2 {
+		t.Fatalf("len(report.Keys) = %d, want 2", len(report.Keys))
+	}
+	if report.Keys[0].Client != registered {
+		t.Error("report.Keys[0].Client is not the registered client")
+	}
+	if report.Keys[1].Client == nil || report.Keys[1].Client != report.Client || report.Client == registered {
+		t.Error("report.Keys[1].Client is not the client created for the keyset")
+	}
+	for i, w := range report.Keys {
+		if w.Validated {
+			t.Errorf("report.Keys[%d].Validated = true without WithEagerValidation", i)
+		}
+	}
+	if got := srv.CallCount("GetCryptoKey"); got != 0 {
+		t.Errorf("GetCryptoKey calls = %d, want 0", got)
+	}
+}
+
+func TestWarmForKeysetIgnoresOtherKMS(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 1)
+	t.Cleanup(registry.ClearKMSClients)
+	handle := newKMSEnvelopeKeyset(t, "aws-kms://arn:aws:kms:us-east-1:123456789012:key/k", keyURIs[0])
+	report, err := gcpkms.WarmForKeyset(context.Background(), handle,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.WarmForKeyset() err = %v, want nil", err)
+	}
+	if len(report.Keys) != 1 || report.Keys[0].KeyURI != keyURIs[0] {
+		t.Errorf("report.Keys = %+v, want only %s", report.Keys, keyURIs[0])
+	}
+}
+
+func TestWarmForKeysetReportsUnusableKeys(t *testing.T) {
+	srv, keyURIs := newBatchServer(t, 1)
+	t.Cleanup(registry.ClearKMSClients)
+	missing := "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/missing"
+	handle := newKMSEnvelopeKeyset(t, missing, keyURIs[0])
+
+	report, err := gcpkms.WarmForKeyset(context.Background(), handle,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport(), gcpkms.WithEagerValidation(1))
+	if err == nil || !strings.Contains(err.Error(), missing) {
+		t.Fatalf("gcpkms.WarmForKeyset() err = %v, want error mentioning %q", err, missing)
+	}
+	if len(report.Keys) != 2 {
+		t.Fatalf("len(report.Keys) = %d, want 2", len(report.Keys))
+	}
+	if w := report.Keys[0]; w.Err == nil || w.Validated {
+		t.Errorf("report.Keys[0] = %+v, want an error", w)
+	}
+	if w := report.Keys[1]; w.Err != nil || !w.Validated {
+		t.Errorf("report.Keys[1] = %+v, want it validated", w)
+	}
+}
@@ -0,0 +1,250 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// maxKeyWatchBackoff is the longest time between two polls of WatchKey after
+// polling failed, unless the interval is longer.
+const maxKeyWatchBackoff = 5 * time.Minute
+
+// KeyEventType is the kind of change reported by WatchKey.
+type KeyEventType int
+
+const (
+	// KeyPrimaryChanged reports that the primary version of the key changed,
+	// e.g. because the key was rotated.
+	KeyPrimaryChanged KeyEventType = iota + 1
+	// KeyVersionStateChanged reports that a version of the key changed
+	// state, e.g. to "DISABLED" or "DESTROY_SCHEDULED", or was created.
+	KeyVersionStateChanged
+	// KeyWatchFailed reports that polling the key failed. WatchKey keeps
+	// polling, with backoff.
+	KeyWatchFailed
+)
+
+func (t KeyEventType) String() string {
+	switch t {
+	case KeyPrimaryChanged:
+		return "KeyPrimaryChanged"
+	case KeyVersionStateChanged:
+		return "KeyVersionStateChanged"
+	case KeyWatchFailed:
+		return "KeyWatchFailed"
+	default:
+		return "KeyEventType(" + strconv.Itoa(int(t)) + ")"
+	}
+}
+
+// KeyEvent is a change of a crypto key reported by WatchKey.
+type KeyEvent struct {
+	Type KeyEventType
+	// Version is the resource name of the version that changed state, or of
+	// the new primary version, e.g.
+	// "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/2".
+	// It is empty for KeyWatchFailed, and for KeyPrimaryChanged if the key
+	// has no primary version anymore.
+	Version string
+	// OldVersion is the resource name of the previous primary version for
+	// KeyPrimaryChanged, and empty if the key had none.
+	OldVersion string
+	// OldState and State are the states of the version before and after a
+	// KeyVersionStateChanged, e.g. "ENABLED" and "DISABLED". OldState is
+	// empty if the version was created.
+	OldState string
+	State    string
+	// DestroyTime is the time at which the version was or will be destroyed,
+	// for versions that are destroyed or scheduled for destruction.
+	DestroyTime time.Time
+	// Err is the error that polling failed with, for KeyWatchFailed.
+	Err error
+}
+
+// keySnapshot is the state of a crypto key polled by WatchKey.
+type keySnapshot struct {
+	// primary is the name of the primary version, or empty if the key has
+	// none, e.g. because it is an asymmetric key.
+	primary string
+	// versions holds the versions of the key by name.
+	versions map[string]*cloudkms.CryptoKeyVersion
+}
+
+// WatchKey polls the crypto key with URI keyURI every interval and calls fn
+// with the changes of its primary version and of the states of its versions,
+// so that rotations, disabled versions and versions scheduled for destruction
+// are noticed before requests fail. keyURI may also name an Autokey key
+// handle.
+//
+// The key is fetched once before WatchKey returns, and its state at that time
+// is not reported. The changes found by a later poll are reported in order:
+// the state changes first, by version number, and then the change of the
+// primary version. If polling fails, fn is called with a KeyWatchFailed
+// event, and the interval doubles with each consecutive failure, up to five
+// minutes.
+//
+// With WithDEKCache, a change of the primary version also discards the
+// cached DEK of the key.
+//
+// fn is called from a single goroutine, which stops when stop is called, ctx
+// is done or the client is closed. stop waits for a call of fn in progress to
+// return, so it must not be called from fn, and may be called more than once.
+func (c *Client) WatchKey(ctx context.Context, keyURI string, interval time.Duration, fn func(KeyEvent)) (stop func(), err error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("key watch interval must be positive, got %v", interval)
+	}
+	if fn == nil {
+		return nil, errors.New("fn must not be nil")
+	}
+	name, err := keyNameFromURI(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	if !c.Supported(keyURI) {
+		return nil, errors.New("unsupported keyURI")
+	}
+	if err := c.bindLocation(name); err != nil {
+		return nil, err
+	}
+	if isKeyHandle(name) {
+		if name, err = c.resolveKeyHandle(ctx, name); err != nil {
+			return nil, err
+		}
+	}
+	snap, err := c.keySnapshot(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("gcpkms: watching %s failed: %w", name, err)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go c.watchKey(ctx, name, interval, snap, fn, done)
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// watchKey polls the crypto key with the given name until ctx is done or the
+// client is closed, and reports the changes since the snapshot prev to fn.
+func (c *Client) watchKey(ctx context.Context, name string, interval time.Duration, prev *keySnapshot, fn func(KeyEvent), done chan struct{}) {
+	defer close(done)
+	maxBackoff := maxKeyWatchBackoff
+	if maxBackoff < interval {
+		maxBackoff = interval
+	}
+	delay := interval
+	timer := c.invoker.clock.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.invoker.closer.root.Done():
+			return
+		case <-timer.C():
+		}
+		snap, err := c.keySnapshot(ctx, name)
+		switch {
+		case err == nil:
+			for _, event := range keyEvents(prev, snap) {
+				if event.Type == KeyPrimaryChanged && c.dekCache != nil {
+					c.dekCache.observePrimary(name, event.Version)
+				}
+				fn(event)
+			}
+			prev = snap
+			delay = interval
+		case ctx.Err() != nil || errors.Is(err, ErrClientClosed):
+			return
+		default:
+			fn(KeyEvent{Type: KeyWatchFailed, Err: fmt.Errorf("gcpkms: watching %s failed: %w", name, err)})
+			if delay *= 2; delay > maxBackoff {
+				delay = maxBackoff
+			}
+		}
+		timer.Reset(delay)
+	}
+}
+
+// keySnapshot fetches the primary version and the versions of the crypto key
+// with the given name.
+func (c *Client) keySnapshot(ctx context.Context, name string) (*keySnapshot, error) {
+	snap := &keySnapshot{}
+	err := c.invoker.call(ctx, MethodGetCryptoKey, func(ctx context.Context) error {
+		key, err := c.kms.Projects.Locations.KeyRings.CryptoKeys.Get(name).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		if key.Primary != nil {
+			snap.primary = key.Primary.Name
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = c.invoker.call(ctx, MethodListCryptoKeyVersions, func(ctx context.Context) error {
+		snap.versions = make(map[string]*cloudkms.CryptoKeyVersion)
+		return c.kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.List(name).Pages(ctx, func(resp *cloudkms.ListCryptoKeyVersionsResponse) error {
+			for _, v := range resp.CryptoKeyVersions {
+				snap.versions[v.Name] = v
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// keyEvents returns the changes from prev to next, in the order documented
+// by WatchKey. Versions that disappeared are not reported.
+func keyEvents(prev, next *keySnapshot) []KeyEvent {
+	var events []KeyEvent
+	for _, v := range next.versions {
+		var oldState string
+		if old, ok := prev.versions[v.Name]; ok {
+			oldState = old.State
+		}
+		if v.State == oldState {
+			continue
+		}
+		event := KeyEvent{Type: KeyVersionStateChanged, Version: v.Name, OldState: oldState, State: v.State}
+		if v.State == "DESTROYED" || v.State == "DESTROY_SCHEDULED" {
+			if t, err := time.Parse(time.RFC3339Nano, v.DestroyTime); err == nil {
+				event.DestroyTime = t
+			}
+		}
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return versionNumber(events[i].Version) < versionNumber(events[j].Version)
+	})
+	if next.primary != prev.primary {
+		events = append(events, KeyEvent{Type: KeyPrimaryChanged, Version: next.primary, OldVersion: prev.primary})
+	}
+	return events
+}
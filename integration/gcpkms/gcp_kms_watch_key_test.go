@@ -0,0 +1,224 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+const watchInterval = 10 * time.Millisecond
+
+// watchKey watches fakeKeyURI with client and returns the channel that the
+// events are sent to. The client must tell the time with a fake clock, which
+// pollKey advances.
+func watchKey(t *testing.T, client *gcpkms.Client) (<-chan gcpkms.KeyEvent, func()) {
+	t.Helper()
+	events := make(chan gcpkms.KeyEvent, 100)
+	stop, err := client.WatchKey(context.Background(), fakeKeyURI, watchInterval, func(e gcpkms.KeyEvent) { events <- e })
+	if err != nil {
+		t.Fatalf("client.WatchKey() err = %v, want nil", err)
+	}
+	t.Cleanup(stop)
+	return events, stop
+}
+
+// pollKey advances clock until the watch polls the key once more. The poll
+// happens in the background.
+func pollKey(clock *gcpkms.FakeClock) {
+	clock.BlockUntil(1)
+	// Longer than any backoff of the watch.
+	clock.Advance(time.Hour)
+}
+
+// nextEvents polls the key until n more events have been reported, and
+// returns them.
+func nextEvents(t *testing.T, clock *gcpkms.FakeClock, events <-chan gcpkms.KeyEvent, n int) []gcpkms.KeyEvent {
+	t.Helper()
+	var got []gcpkms.KeyEvent
+	for len(got) < n {
+		select {
+		case e := <-events:
+			got = append(got, e)
+			continue
+		default:
+		}
+		pollKey(clock)
+		select {
+		case e := <-events:
+			got = append(got, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got events %+v, want %d events", got, n)
+		}
+	}
+	return got
+}
+
+func watchVersionName(version int) string {
+	return fmt.Sprintf("%s/cryptoKeyVersions/%d", fakeKeyName, version)
+}
+
+func TestWatchKeyReportsRotationAndStateChanges(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	client := newStressClient(t, srv, gcpkms.WithClock(clock))
+	events, stop := watchKey(t, client)
+
+	if _, err := srv.AddVersion(fakeKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	want := []gcpkms.KeyEvent{
+		{Type: gcpkms.KeyVersionStateChanged, Version: watchVersionName(2), State: "ENABLED"},
+		{Type: gcpkms.KeyPrimaryChanged, Version: watchVersionName(2), OldVersion: watchVersionName(1)},
+	}
+	if got := nextEvents(t, clock, events, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("events after rotation = %+v, want %+v", got, want)
+	}
+
+	if err := srv.SetVersionState(fakeKeyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	want = []gcpkms.KeyEvent{{Type: gcpkms.KeyVersionStateChanged, Version: watchVersionName(1), OldState: "ENABLED", State: "DISABLED"}}
+	if got := nextEvents(t, clock, events, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("events after disable = %+v, want %+v", got, want)
+	}
+
+	destroyTime := time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)
+	if err := srv.SetVersionState(fakeKeyName, 1, "DESTROY_SCHEDULED", destroyTime.Format(time.RFC3339)); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	want = []gcpkms.KeyEvent{{Type: gcpkms.KeyVersionStateChanged, Version: watchVersionName(1), OldState: "DISABLED", State: "DESTROY_SCHEDULED", DestroyTime: destroyTime}}
+	if got := nextEvents(t, clock, events, len(want)); !reflect.DeepEqual(got, want) {
+		t.Errorf("events after scheduling destruction = %+v, want %+v", got, want)
+	}
+
+	stop()
+	polls := srv.CallCount("GetCryptoKey")
+	if err := srv.SetVersionState(fakeKeyName, 2, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	clock.Advance(time.Hour)
+	select {
+	case e := <-events:
+		t.Errorf("got event %+v after stop, want none", e)
+	default:
+	}
+	if got := srv.CallCount("GetCryptoKey"); got != polls {
+		t.Errorf("GetCryptoKey called %d times after stop, want 0", got-polls)
+	}
+	// Calling stop again does nothing.
+	stop()
+}
+
+func TestWatchKeyReportsPollingErrors(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	client := newStressClient(t, srv, gcpkms.WithTransientErrorRetries(0), gcpkms.WithClock(clock))
+	events, _ := watchKey(t, client)
+	err := srv.Restart(func() {
+		e := nextEvents(t, clock, events, 1)[0]
+		if e.Type != gcpkms.KeyWatchFailed || e.Err == nil {
+			t.Errorf("event while the server is down = %+v, want a KeyWatchFailed event with an error", e)
+		}
+	})
+	if err != nil {
+		t.Fatalf("srv.Restart() err = %v, want nil", err)
+	}
+	// The watch continues once the server is back.
+	if _, err := srv.AddVersion(fakeKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	for {
+		e := nextEvents(t, clock, events, 1)[0]
+		if e.Type == gcpkms.KeyWatchFailed {
+			continue
+		}
+		if e.Type != gcpkms.KeyVersionStateChanged || e.Version != watchVersionName(2) {
+			t.Errorf("event after restart = %+v, want the creation of version 2", e)
+		}
+		break
+	}
+}
+
+func TestWatchKeyStopsWhenClientIsClosed(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	client := newStressClient(t, srv, gcpkms.WithClock(clock))
+	events, stop := watchKey(t, client)
+	client.Close()
+	// stop returns once the watch has stopped.
+	stop()
+	if _, err := srv.AddVersion(fakeKeyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	clock.Advance(time.Hour)
+	select {
+	case e := <-events:
+		t.Errorf("got event %+v after Close, want none", e)
+	default:
+	}
+	if _, err := client.WatchKey(context.Background(), fakeKeyURI, watchInterval, func(gcpkms.KeyEvent) {}); !errors.Is(err, gcpkms.ErrClientClosed) {
+		t.Errorf("client.WatchKey() after Close err = %v, want %v", err, gcpkms.ErrClientClosed)
+	}
+}
+
+func TestWatchKeyStopsWhenContextIsDone(t *testing.T) {
+	srv := newFakeServer(t)
+	clock := gcpkms.NewFakeClock()
+	client := newStressClient(t, srv, gcpkms.WithClock(clock))
+	ctx, cancel := context.WithCancel(context.Background())
+	events := make(chan gcpkms.KeyEvent, 100)
+	if _, err := client.WatchKey(ctx, fakeKeyURI, watchInterval, func(e gcpkms.KeyEvent) { events <- e }); err != nil {
+		t.Fatalf("client.WatchKey() err = %v, want nil", err)
+	}
+	cancel()
+	polls := srv.CallCount("GetCryptoKey")
+	clock.Advance(time.Hour)
+	if got := srv.CallCount("GetCryptoKey"); got > polls+1 {
+		t.Errorf("GetCryptoKey called %d times after the context was canceled, want at most 1", got-polls)
+	}
+}
+
+func TestWatchKeyRejectsInvalidArguments(t *testing.T) {
+	srv := newFakeServer(t)
+	client := newStressClient(t, srv)
+	fn := func(gcpkms.KeyEvent) {}
+	for _, tc := range []struct {
+		name     string
+		keyURI   string
+		interval time.Duration
+		fn       func(gcpkms.KeyEvent)
+	}{
+		{name: "zero interval", keyURI: fakeKeyURI, fn: fn},
+		{name: "nil fn", keyURI: fakeKeyURI, interval: time.Second},
+		{name: "key version URI", keyURI: fakeKeyURI + "/cryptoKeyVersions/1", interval: time.Second, fn: fn},
+		{name: "other KMS", keyURI: "aws-kms://arn:aws:kms:us-east-1:123:key/k", interval: time.Second, fn: fn},
+		{name: "missing key", keyURI: fakeKeyURI + "2", interval: time.Second, fn: fn},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := client.WatchKey(context.Background(), tc.keyURI, tc.interval, tc.fn); err == nil {
+				t.Error("client.WatchKey() err = nil, want error")
+			}
+		})
+	}
+}
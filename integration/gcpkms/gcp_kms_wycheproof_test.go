@@ -0,0 +1,265 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package gcpkms
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"path"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+//go:embed testdata/wycheproof/*.json
+var wycheproofVectors embed.FS
+
+// wycheproofAcceptableFlags tells whether public keys must accept the
+// signatures of Wycheproof test cases whose result is "acceptable", by flag.
+// Cases with flags missing here fail the test.
+var wycheproofAcceptableFlags = map[string]bool{
+	// DER encodings of ECDSA signatures whose integers lack a leading zero
+	// are not DER, so they are rejected.
+	"MissingZero": false,
+	// PKCS #1 v1.5 DigestInfos must encode the NULL parameters.
+	"MissingNull": false,
+	// Cloud KMS offers 2048-bit RSA keys.
+	"SmallPublicKey": true,
+}
+
+type wycheproofSignatureFile struct {
+	Algorithm  string `json:"algorithm"`
+	TestGroups []struct {
+		KeyPEM string `json:"keyPem"`
+		SLen   int    `json:"sLen"`
+		Tests  []struct {
+			TcID    int      `json:"tcId"`
+			Comment string   `json:"comment"`
+			Msg     string   `json:"msg"`
+			Sig     string   `json:"sig"`
+			Result  string   `json:"result"`
+			Flags   []string `json:"flags"`
+		} `json:"tests"`
+	} `json:"testGroups"`
+}
+
+func TestPublicKeyVerifyWithWycheproofVectors(t *testing.T) {
+	for _, tc := range []struct {
+		file      string
+		algorithm string
+	}{
+		{file: "ecdsa_secp256r1_sha256_test.json", algorithm: "EC_SIGN_P256_SHA256"},
+		{file: "ecdsa_secp384r1_sha384_test.json", algorithm: "EC_SIGN_P384_SHA384"},
+		{file: "rsa_signature_2048_sha256_test.json", algorithm: "RSA_SIGN_PKCS1_2048_SHA256"},
+		{file: "rsa_signature_3072_sha256_test.json", algorithm: "RSA_SIGN_PKCS1_3072_SHA256"},
+		{file: "rsa_signature_4096_sha512_test.json", algorithm: "RSA_SIGN_PKCS1_4096_SHA512"},
+		{file: "rsa_pss_2048_sha256_mgf1_32_test.json", algorithm: "RSA_SIGN_PSS_2048_SHA256"},
+		{file: "rsa_pss_3072_sha256_mgf1_32_test.json", algorithm: "RSA_SIGN_PSS_3072_SHA256"},
+		{file: "rsa_pss_4096_sha256_mgf1_32_test.json", algorithm: "RSA_SIGN_PSS_4096_SHA256"},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			data, err := wycheproofVectors.ReadFile(path.Join("testdata/wycheproof", tc.file))
+			if err != nil {
+				t.Fatalf("ReadFile() err = %v, want nil", err)
+			}
+			var f wycheproofSignatureFile
+			if err := json.Unmarshal(data, &f); err != nil {
+				t.Fatalf("json.Unmarshal() err = %v, want nil", err)
+			}
+			cases := 0
+			for _, g := range f.TestGroups {
+				// Cloud KMS uses salts as long as the hash.
+				if g.SLen != 0 && g.SLen != signAlgorithms[tc.algorithm].hash.Size() {
+					continue
+				}
+				pub, parseErr := parsePublicKey("", &cloudkms.PublicKey{
+					Algorithm: tc.algorithm,
+					Pem:       g.KeyPEM,
+					PemCrc32c: ComputeCRC32C([]byte(g.KeyPEM)),
+				})
+				for _, test := range g.Tests {
+					cases++
+					wantValid := test.Result == "valid"
+					if test.Result == "acceptable" {
+						wantValid = true
+						for _, flag := range test.Flags {
+							valid, ok := wycheproofAcceptableFlags[flag]
+							if !ok {
+								t.Errorf("tcId %d: unhandled flag %q of acceptable test case", test.TcID, flag)
+							}
+							wantValid = wantValid && valid
+						}
+					}
+					if parseErr != nil {
+						if wantValid {
+							t.Errorf("tcId %d (%s): parsePublicKey() err = %v, want nil", test.TcID, test.Comment, parseErr)
+						}
+						continue
+					}
+					msg, err := hex.DecodeString(test.Msg)
+					if err != nil {
+						t.Fatalf("tcId %d: hex.DecodeString(msg) err = %v, want nil", test.TcID, err)
+					}
+					sig, err := hex.DecodeString(test.Sig)
+					if err != nil {
+						t.Fatalf("tcId %d: hex.DecodeString(sig) err = %v, want nil", test.TcID, err)
+					}
+					err = pub.verify(sig, msg)
+					if wantValid && err != nil {
+						t.Errorf("tcId %d (%s, flags %v): verify() err = %v, want nil", test.TcID, test.Comment, test.Flags, err)
+					}
+					if !wantValid && err == nil {
+						t.Errorf("tcId %d (%s, flags %v): verify() err = nil, want error", test.TcID, test.Comment, test.Flags)
+					}
+				}
+			}
+			if cases == 0 {
+				t.Errorf("no applicable test cases in %s", tc.file)
+			}
+		})
+	}
+}
+
+// TestPublicKeyVerifyWithoutWycheproofVectors covers the RSA algorithms
+// whose Wycheproof vectors are not in testdata/wycheproof with signatures of
+// a locally generated key and mutations of them.
+func TestPublicKeyVerifyWithoutWycheproofVectors(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 4096)
+	if err != nil {
+		t.Fatalf("rsa.GenerateKey() err = %v, want nil", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKIXPublicKey() err = %v, want nil", err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	msg := []byte("message")
+	for _, algorithm := range []string{"RSA_SIGN_PKCS1_4096_SHA256", "RSA_SIGN_PSS_4096_SHA512"} {
+		t.Run(algorithm, func(t *testing.T) {
+			alg := signAlgorithms[algorithm]
+			pub, err := parsePublicKey("", &cloudkms.PublicKey{
+				Algorithm: algorithm,
+				Pem:       keyPEM,
+				PemCrc32c: ComputeCRC32C([]byte(keyPEM)),
+			})
+			if err != nil {
+				t.Fatalf("parsePublicKey() err = %v, want nil", err)
+			}
+			sign := func(hash crypto.Hash, saltLength int) []byte {
+				h := hash.New()
+				h.Write(msg)
+				var sig []byte
+				var err error
+				if alg.pss {
+					sig, err = rsa.SignPSS(rand.Reader, priv, hash, h.Sum(nil), &rsa.PSSOptions{SaltLength: saltLength})
+				} else {
+					sig, err = rsa.SignPKCS1v15(rand.Reader, priv, hash, h.Sum(nil))
+				}
+				if err != nil {
+					t.Fatalf("signing failed: %v", err)
+				}
+				return sig
+			}
+			valid := sign(alg.hash, rsa.PSSSaltLengthEqualsHash)
+			if err := pub.verify(valid, msg); err != nil {
+				t.Fatalf("verify() err = %v, want nil", err)
+			}
+			flipped := append([]byte(nil), valid...)
+			flipped[len(flipped)-1] ^= 1
+			otherHash := crypto.SHA512
+			if alg.hash == crypto.SHA512 {
+				otherHash = crypto.SHA256
+			}
+			for _, tc := range []struct {
+				name string
+				sig  []byte
+				msg  []byte
+			}{
+				{name: "other message", sig: valid, msg: []byte("other message")},
+				{name: "modified signature", sig: flipped, msg: msg},
+				{name: "truncated signature", sig: valid[1:], msg: msg},
+				{name: "signature with leading zero", sig: append([]byte{0}, valid...), msg: msg},
+				{name: "zero signature", sig: make([]byte, len(valid)), msg: msg},
+				{name: "modulus as signature", sig: priv.N.Bytes(), msg: msg},
+				{name: "other hash", sig: sign(otherHash, rsa.PSSSaltLengthEqualsHash), msg: msg},
+				{name: "empty signature", sig: nil, msg: msg},
+			} {
+				if err := pub.verify(tc.sig, tc.msg); err == nil {
+					t.Errorf("%s: verify() err = nil, want error", tc.name)
+				}
+			}
+			if alg.pss {
+				// Cloud KMS uses salts as long as the hash.
+				if err := pub.verify(sign(alg.hash, 32), msg); err == nil {
+					t.Error("verify() of signature with 32-byte salt err = nil, want error")
+				}
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("ed25519.GenerateKey() err = %v, want nil", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("x509.MarshalPKIXPublicKey() err = %v, want nil", err)
+	}
+	keyPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	parsed, err := parsePublicKey("", &cloudkms.PublicKey{
+		Algorithm: "EC_SIGN_ED25519",
+		Pem:       keyPEM,
+		PemCrc32c: ComputeCRC32C([]byte(keyPEM)),
+	})
+	if err != nil {
+		t.Fatalf("parsePublicKey() err = %v, want nil", err)
+	}
+	msg := []byte("message")
+	if err := parsed.verify(ed25519.Sign(priv, msg), msg); err != nil {
+		t.Errorf("verify() err = %v, want nil", err)
+	}
+	if err := parsed.verify(ed25519.Sign(priv, msg), []byte("other message")); err == nil {
+		t.Error("verify() of another message err = nil, want error")
+	}
+
+	for _, tc := range []struct {
+		algorithm string
+		want      string
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256", want: "does not match algorithm"},
+		{algorithm: "EC_SIGN_SECP256K1_SHA256", want: "unsupported signing algorithm"},
+	} {
+		_, err := parsePublicKey("", &cloudkms.PublicKey{
+			Algorithm: tc.algorithm,
+			Pem:       keyPEM,
+			PemCrc32c: ComputeCRC32C([]byte(keyPEM)),
+		})
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("parsePublicKey() with algorithm %s err = %v, want %s", tc.algorithm, err, tc.want)
+		}
+	}
+}
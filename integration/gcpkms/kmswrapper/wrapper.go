@@ -0,0 +1,181 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Package kmswrapper adapts Cloud KMS keys to the go-kms-wrapping Wrapper
+// API, e.g. for HashiCorp Vault and Boundary components.
+//
+// It is a separate package so that users of package gcpkms do not depend on
+// go-kms-wrapping.
+package kmswrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// The key mechanisms of the blobs, which are those of the gcpckms wrapper of
+// go-kms-wrapping.
+const (
+	// mechanismDirect blobs hold a ciphertext of Cloud KMS. They are only
+	// decrypted, for compatibility.
+	mechanismDirect uint64 = iota
+	// mechanismEnvelopeAESGCM blobs hold an AES-256-GCM ciphertext whose key
+	// is wrapped by Cloud KMS.
+	mechanismEnvelopeAESGCM
+)
+
+// Wrapper is a wrapping.Wrapper that envelope encrypts data: each blob is
+// encrypted locally with a new AES-256-GCM key, which is wrapped by a Cloud
+// KMS key through a gcpkms.AEAD, so that the requests are retried and their
+// CRC32C checksums verified as configured by the gcpkms options. The key ID
+// of a blob is the resource name of the key version that wrapped its key.
+//
+// Wrapper is safe for concurrent use.
+type Wrapper struct {
+	keyURI string
+	client *gcpkms.Client
+	aead   *gcpkms.AEAD
+
+	mu sync.Mutex
+	// keyID is the key version used by the last encryption.
+	keyID string
+}
+
+var (
+	_ wrapping.Wrapper       = (*Wrapper)(nil)
+	_ wrapping.InitFinalizer = (*Wrapper)(nil)
+)
+
+// New returns a wrapper for the Cloud KMS key with URI keyURI, e.g.
+// 'gcp-kms://projects/p/locations/l/keyRings/r/cryptoKeys/k'. opts configure
+// the underlying gcpkms.Client.
+func New(ctx context.Context, keyURI string, opts ...gcpkms.Option) (*Wrapper, error) {
+	client, err := gcpkms.NewClient(ctx, keyURI, opts...)
+	if err != nil {
+		return nil, err
+	}
+	a, err := client.GetAEAD(keyURI)
+	if err != nil {
+		return nil, err
+	}
+	return &Wrapper{keyURI: keyURI, client: client, aead: a.(*gcpkms.AEAD)}, nil
+}
+
+// Type returns wrapping.WrapperTypeGcpCkms.
+func (w *Wrapper) Type(context.Context) (wrapping.WrapperType, error) {
+	return wrapping.WrapperTypeGcpCkms, nil
+}
+
+// KeyId returns the resource name of the key version used by the last
+// encryption, or the empty string before the first one.
+func (w *Wrapper) KeyId(context.Context) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.keyID, nil
+}
+
+// SetConfig returns the configuration of the wrapper, whose metadata holds
+// the key URI under "key_uri". The wrapper is configured by New, with
+// gcpkms options; a config map passed with wrapping.WithConfigMap may only
+// repeat the key URI.
+func (w *Wrapper) SetConfig(_ context.Context, options ...wrapping.Option) (*wrapping.WrapperConfig, error) {
+	opts, err := wrapping.GetOpts(options...)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range opts.WithConfigMap {
+		if k != "key_uri" || v != w.keyURI {
+			return nil, fmt.Errorf("unsupported config %s=%q, the wrapper is configured by New", k, v)
+		}
+	}
+	return &wrapping.WrapperConfig{Metadata: map[string]string{"key_uri": w.keyURI}}, nil
+}
+
+// Init does nothing, since New fully initializes the wrapper.
+func (w *Wrapper) Init(context.Context, ...wrapping.Option) error {
+	return nil
+}
+
+// Finalize closes the underlying gcpkms.Client.
+func (w *Wrapper) Finalize(context.Context, ...wrapping.Option) error {
+	return w.client.Close()
+}
+
+// Encrypt envelope encrypts plaintext. The associated data passed with
+// wrapping.WithAad is authenticated by the local encryption. The request to
+// Cloud KMS is bound to ctx.
+func (w *Wrapper) Encrypt(ctx context.Context, plaintext []byte, options ...wrapping.Option) (*wrapping.BlobInfo, error) {
+	env, err := wrapping.EnvelopeEncrypt(plaintext, options...)
+	if err != nil {
+		return nil, fmt.Errorf("envelope encryption failed: %w", err)
+	}
+	res, err := w.aead.EncryptWithMetadata(ctx, env.Key, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.mu.Lock()
+	w.keyID = res.KeyVersion
+	w.mu.Unlock()
+	return &wrapping.BlobInfo{
+		Ciphertext: env.Ciphertext,
+		Iv:         env.Iv,
+		KeyInfo: &wrapping.KeyInfo{
+			Mechanism:  mechanismEnvelopeAESGCM,
+			KeyId:      res.KeyVersion,
+			WrappedKey: res.Ciphertext,
+		},
+	}, nil
+}
+
+// Decrypt decrypts a blob returned by Encrypt, with the associated data
+// passed with wrapping.WithAad. The request to Cloud KMS is bound to ctx.
+func (w *Wrapper) Decrypt(ctx context.Context, in *wrapping.BlobInfo, options ...wrapping.Option) ([]byte, error) {
+	if in == nil {
+		return nil, errors.New("given input for decryption is nil")
+	}
+	if in.KeyInfo == nil {
+		return nil, errors.New("key info is nil")
+	}
+	switch in.KeyInfo.Mechanism {
+	case mechanismDirect:
+		res, err := w.aead.DecryptWithMetadata(ctx, in.Ciphertext, nil)
+		if err != nil {
+			return nil, err
+		}
+		return res.Plaintext, nil
+	case mechanismEnvelopeAESGCM:
+		res, err := w.aead.DecryptWithMetadata(ctx, in.KeyInfo.WrappedKey, nil)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := wrapping.EnvelopeDecrypt(&wrapping.EnvelopeInfo{
+			Key:        res.Plaintext,
+			Iv:         in.Iv,
+			Ciphertext: in.Ciphertext,
+		}, options...)
+		if err != nil {
+			return nil, fmt.Errorf("envelope decryption failed: %w", err)
+		}
+		return plaintext, nil
+	default:
+		return nil, fmt.Errorf("invalid key mechanism %d", in.KeyInfo.Mechanism)
+	}
+}
@@ -0,0 +1,256 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package kmswrapper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	wrapping "github.com/hashicorp/go-kms-wrapping/v2"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const (
+	keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	keyURI  = "gcp-kms://" + keyName
+)
+
+func newTestWrapper(t *testing.T) (*fakekms.Server, *Wrapper) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateKey(keyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	w, err := New(context.Background(), keyURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("New() err = %v, want nil", err)
+	}
+	t.Cleanup(func() { w.Finalize(context.Background()) })
+	return srv, w
+}
+
+func TestRoundTrip(t *testing.T) {
+	_, w := newTestWrapper(t)
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name      string
+		plaintext []byte
+		aad       []byte
+	}{
+		{name: "empty", plaintext: []byte{}},
+		{name: "one byte", plaintext: []byte{0x42}},
+		{name: "text", plaintext: []byte("plaintext")},
+		{name: "large", plaintext: bytes.Repeat([]byte{0xaa}, 1<<16)},
+		{name: "with associated data", plaintext: []byte("plaintext"), aad: []byte("aad")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			blob, err := w.Encrypt(ctx, tc.plaintext, wrapping.WithAad(tc.aad))
+			if err != nil {
+				t.Fatalf("w.Encrypt() err = %v, want nil", err)
+			}
+			// Short plaintexts may occur in random ciphertexts by chance.
+			if len(tc.plaintext) >= 8 && bytes.Contains(blob.Ciphertext, tc.plaintext) {
+				t.Errorf("blob.Ciphertext contains the plaintext")
+			}
+			got, err := w.Decrypt(ctx, blob, wrapping.WithAad(tc.aad))
+			if err != nil {
+				t.Fatalf("w.Decrypt() err = %v, want nil", err)
+			}
+			if !bytes.Equal(got, tc.plaintext) {
+				t.Errorf("w.Decrypt() = %x, want %x", got, tc.plaintext)
+			}
+		})
+	}
+}
+
+func TestEncryptIsRandomized(t *testing.T) {
+	_, w := newTestWrapper(t)
+	ctx := context.Background()
+	a, err := w.Encrypt(ctx, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("w.Encrypt() err = %v, want nil", err)
+	}
+	b, err := w.Encrypt(ctx, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("w.Encrypt() err = %v, want nil", err)
+	}
+	if bytes.Equal(a.Ciphertext, b.Ciphertext) || bytes.Equal(a.KeyInfo.WrappedKey, b.KeyInfo.WrappedKey) {
+		t.Error("w.Encrypt() returned the same blob twice")
+	}
+}
+
+func TestKeyIdTracksKeyVersion(t *testing.T) {
+	srv, w := newTestWrapper(t)
+	ctx := context.Background()
+	if id, err := w.KeyId(ctx); err != nil || id != "" {
+		t.Errorf("w.KeyId() before encryption = %q, %v, want \"\", nil", id, err)
+	}
+	old, err := w.Encrypt(ctx, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("w.Encrypt() err = %v, want nil", err)
+	}
+	if want := keyName + "/cryptoKeyVersions/1"; old.KeyInfo.KeyId != want {
+		t.Errorf("blob.KeyInfo.KeyId = %q, want %q", old.KeyInfo.KeyId, want)
+	}
+	if id, err := w.KeyId(ctx); err != nil || id != old.KeyInfo.KeyId {
+		t.Errorf("w.KeyId() = %q, %v, want %q, nil", id, err, old.KeyInfo.KeyId)
+	}
+
+	if _, err := srv.AddVersion(keyName); err != nil {
+		t.Fatalf("srv.AddVersion() err = %v, want nil", err)
+	}
+	blob, err := w.Encrypt(ctx, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("w.Encrypt() err = %v, want nil", err)
+	}
+	if want := keyName + "/cryptoKeyVersions/2"; blob.KeyInfo.KeyId != want {
+		t.Errorf("blob.KeyInfo.KeyId after rotation = %q, want %q", blob.KeyInfo.KeyId, want)
+	}
+	if id, err := w.KeyId(ctx); err != nil || id != blob.KeyInfo.KeyId {
+		t.Errorf("w.KeyId() after rotation = %q, %v, want %q, nil", id, err, blob.KeyInfo.KeyId)
+	}
+	if got, err := w.Decrypt(ctx, old); err != nil || string(got) != "plaintext" {
+		t.Errorf("w.Decrypt() of blob from before rotation = %q, %v, want %q, nil", got, err, "plaintext")
+	}
+}
+
+// modified returns a function returning a copy of blob modified by f.
+func modified(blob *wrapping.BlobInfo, f func(b *wrapping.BlobInfo)) func() *wrapping.BlobInfo {
+	return func() *wrapping.BlobInfo {
+		b := proto.Clone(blob).(*wrapping.BlobInfo)
+		f(b)
+		return b
+	}
+}
+
+func TestDecryptRejectsInvalidBlobs(t *testing.T) {
+	_, w := newTestWrapper(t)
+	ctx := context.Background()
+	blob, err := w.Encrypt(ctx, []byte("plaintext"), wrapping.WithAad([]byte("aad")))
+	if err != nil {
+		t.Fatalf("w.Encrypt() err = %v, want nil", err)
+	}
+	for _, tc := range []struct {
+		name string
+		blob func() *wrapping.BlobInfo
+		opts []wrapping.Option
+	}{
+		{name: "nil blob", blob: func() *wrapping.BlobInfo { return nil }},
+		{name: "nil key info", blob: func() *wrapping.BlobInfo { return &wrapping.BlobInfo{Ciphertext: blob.Ciphertext, Iv: blob.Iv} }},
+		{name: "wrong associated data", blob: func() *wrapping.BlobInfo { return blob }, opts: []wrapping.Option{wrapping.WithAad([]byte("other"))}},
+		{name: "missing associated data", blob: func() *wrapping.BlobInfo { return blob }},
+		{
+			name: "modified ciphertext",
+			blob: modified(blob, func(b *wrapping.BlobInfo) { b.Ciphertext[0] ^= 1 }),
+			opts: []wrapping.Option{wrapping.WithAad([]byte("aad"))},
+		},
+		{
+			name: "modified IV",
+			blob: modified(blob, func(b *wrapping.BlobInfo) { b.Iv[0] ^= 1 }),
+			opts: []wrapping.Option{wrapping.WithAad([]byte("aad"))},
+		},
+		{
+			name: "modified wrapped key",
+			blob: modified(blob, func(b *wrapping.BlobInfo) { b.KeyInfo.WrappedKey[len(b.KeyInfo.WrappedKey)-1] ^= 1 }),
+			opts: []wrapping.Option{wrapping.WithAad([]byte("aad"))},
+		},
+		{
+			name: "unknown mechanism",
+			blob: modified(blob, func(b *wrapping.BlobInfo) { b.KeyInfo.Mechanism = 42 }),
+			opts: []wrapping.Option{wrapping.WithAad([]byte("aad"))},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got, err := w.Decrypt(ctx, tc.blob(), tc.opts...); err == nil {
+				t.Errorf("w.Decrypt() = %q, nil, want error", got)
+			}
+		})
+	}
+}
+
+func TestDecryptDirectMechanism(t *testing.T) {
+	srv, w := newTestWrapper(t)
+	client, err := gcpkms.NewClient(context.Background(), keyURI, gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	a, err := client.GetAEAD(keyURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	ciphertext, err := a.Encrypt([]byte("plaintext"), nil)
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+	blob := &wrapping.BlobInfo{
+		Ciphertext: ciphertext,
+		KeyInfo:    &wrapping.KeyInfo{Mechanism: mechanismDirect, KeyId: keyName + "/cryptoKeyVersions/1"},
+	}
+	if got, err := w.Decrypt(context.Background(), blob); err != nil || string(got) != "plaintext" {
+		t.Errorf("w.Decrypt() = %q, %v, want %q, nil", got, err, "plaintext")
+	}
+}
+
+func TestDecryptExposesKeyVersionStateErrors(t *testing.T) {
+	srv, w := newTestWrapper(t)
+	ctx := context.Background()
+	blob, err := w.Encrypt(ctx, []byte("plaintext"))
+	if err != nil {
+		t.Fatalf("w.Encrypt() err = %v, want nil", err)
+	}
+	if err := srv.SetVersionState(keyName, 1, "DISABLED", ""); err != nil {
+		t.Fatalf("srv.SetVersionState() err = %v, want nil", err)
+	}
+	var stateErr *gcpkms.KeyVersionStateError
+	if _, err := w.Decrypt(ctx, blob); !errors.As(err, &stateErr) {
+		t.Errorf("w.Decrypt() err = %v, want *gcpkms.KeyVersionStateError", err)
+	}
+}
+
+func TestTypeAndSetConfig(t *testing.T) {
+	_, w := newTestWrapper(t)
+	ctx := context.Background()
+	if got, err := w.Type(ctx); err != nil || got != wrapping.WrapperTypeGcpCkms {
+		t.Errorf("w.Type() = %v, %v, want %v, nil", got, err, wrapping.WrapperTypeGcpCkms)
+	}
+	cfg, err := w.SetConfig(ctx, wrapping.WithConfigMap(map[string]string{"key_uri": keyURI}))
+	if err != nil {
+		t.Fatalf("w.SetConfig() err = %v, want nil", err)
+	}
+	if got := cfg.Metadata["key_uri"]; got != keyURI {
+		t.Errorf("cfg.Metadata[\"key_uri\"] = %q, want %q", got, keyURI)
+	}
+	if _, err := w.SetConfig(ctx, wrapping.WithConfigMap(map[string]string{"key_uri": keyURI + "2"})); err == nil {
+		t.Error("w.SetConfig() with other key URI err = nil, want error")
+	}
+	if _, err := w.SetConfig(ctx, wrapping.WithConfigMap(map[string]string{"project": "p"})); err == nil {
+		t.Error("w.SetConfig() with unsupported config err = nil, want error")
+	}
+}
+
+func TestNewRejectsInvalidKeyURIs(t *testing.T) {
+	for _, uri := range []string{"aws-kms://" + keyName, "gcp-kms://projects/p"} {
+		if _, err := New(context.Background(), uri); err == nil {
+			t.Errorf("New(%q) err = nil, want error", uri)
+		}
+	}
+}
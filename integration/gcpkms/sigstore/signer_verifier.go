@@ -0,0 +1,157 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Package sigstore adapts Cloud KMS asymmetric signing keys to the sigstore
+// signature.SignerVerifier API, e.g. for signing container images and
+// attestations with cosign.
+//
+// It is a separate package so that users of package gcpkms do not depend on
+// sigstore.
+package sigstore
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"path"
+
+	"google.golang.org/api/cloudkms/v1"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/options"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+)
+
+// SignerVerifier is a signature.SignerVerifier whose private key is a Cloud
+// KMS asymmetric signing key version. Messages are hashed locally and their
+// digests signed by Cloud KMS, and signatures are verified locally with the
+// public key of the version.
+//
+// Only the hash function of the key's algorithm is supported. ECDSA
+// signatures are ASN.1 DER encoded, as sigstore expects, and RSA-PSS
+// signatures use a salt as long as the hash.
+//
+// SignerVerifier is safe for concurrent use.
+type SignerVerifier struct {
+	ctx      context.Context
+	version  string
+	signer   *gcpkms.Signer
+	opts     crypto.SignerOpts
+	verifier signature.Verifier
+}
+
+var _ signature.SignerVerifier = (*SignerVerifier)(nil)
+
+// NewSignerVerifier returns a SignerVerifier for the key version with the
+// given resource name, e.g.
+// "projects/p/locations/l/keyRings/r/cryptoKeys/k/cryptoKeyVersions/1".
+// Requests are bound to ctx, unless a call passes options.WithContext.
+func NewSignerVerifier(ctx context.Context, keyVersionName string, kms *cloudkms.Service) (*SignerVerifier, error) {
+	s, err := gcpkms.NewSigner(ctx, keyVersionName, kms)
+	if err != nil {
+		return nil, err
+	}
+	opts := s.SignerOpts()
+	var v signature.Verifier
+	switch pub := s.Public().(type) {
+	case *ecdsa.PublicKey:
+		v, err = signature.LoadECDSAVerifier(pub, opts.HashFunc())
+	case *rsa.PublicKey:
+		if pssOpts, ok := opts.(*rsa.PSSOptions); ok {
+			v, err = signature.LoadRSAPSSVerifier(pub, opts.HashFunc(), pssOpts)
+		} else {
+			v, err = signature.LoadRSAPKCS1v15Verifier(pub, opts.HashFunc())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T", pub)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &SignerVerifier{ctx: ctx, version: keyVersionName, signer: s, opts: opts, verifier: v}, nil
+}
+
+// PublicKey returns the public key of the key version. opts are ignored.
+func (sv *SignerVerifier) PublicKey(_ ...signature.PublicKeyOption) (crypto.PublicKey, error) {
+	return sv.signer.Public(), nil
+}
+
+// SignMessage signs message with the key version. It recognizes the following
+// options:
+//
+//   - options.WithDigest, to sign a digest instead of hashing message.
+//   - options.WithCryptoSignerOpts, whose hash function must be that of the
+//     key's algorithm.
+//   - options.WithContext, to bind the request to another context.
+//   - options.WithKeyVersion, which must be the key version's name.
+//   - options.ReturnKeyVersionUsed, which is set to the key version's name.
+//
+// All other options are ignored.
+func (sv *SignerVerifier) SignMessage(message io.Reader, opts ...signature.SignOption) ([]byte, error) {
+	ctx := sv.ctx
+	var keyVersion string
+	var keyVersionUsed *string
+	for _, opt := range opts {
+		opt.ApplyContext(&ctx)
+		opt.ApplyKeyVersion(&keyVersion)
+		opt.ApplyKeyVersionUsed(&keyVersionUsed)
+	}
+	if err := sv.checkKeyVersion(keyVersion); err != nil {
+		return nil, err
+	}
+	digest, _, err := signature.ComputeDigestForSigning(message, sv.opts.HashFunc(), []crypto.Hash{sv.opts.HashFunc()}, opts...)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := sv.signer.SignWithContext(ctx, digest, sv.opts)
+	if err != nil {
+		return nil, err
+	}
+	if keyVersionUsed != nil {
+		*keyVersionUsed = sv.version
+	}
+	return sig, nil
+}
+
+// VerifySignature returns nil if signature is a valid signature of message
+// under the key version. It recognizes options.WithDigest,
+// options.WithCryptoSignerOpts and options.WithKeyVersion like SignMessage,
+// and ignores all other options. Signatures are always verified locally.
+func (sv *SignerVerifier) VerifySignature(sig, message io.Reader, opts ...signature.VerifyOption) error {
+	var keyVersion string
+	for _, opt := range opts {
+		opt.ApplyKeyVersion(&keyVersion)
+	}
+	if err := sv.checkKeyVersion(keyVersion); err != nil {
+		return err
+	}
+	digest, _, err := signature.ComputeDigestForVerifying(message, sv.opts.HashFunc(), []crypto.Hash{sv.opts.HashFunc()}, opts...)
+	if err != nil {
+		return err
+	}
+	return sv.verifier.VerifySignature(sig, nil, options.WithDigest(digest))
+}
+
+// checkKeyVersion returns an error if keyVersion, which is empty if no
+// version was requested, is neither the name nor the ID of sv's key version.
+func (sv *SignerVerifier) checkKeyVersion(keyVersion string) error {
+	if keyVersion == "" || keyVersion == sv.version || keyVersion == path.Base(sv.version) {
+		return nil
+	}
+	return fmt.Errorf("key version %q requested, want %s", keyVersion, sv.version)
+}
@@ -0,0 +1,189 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package sigstore
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"github.com/sigstore/sigstore/pkg/signature"
+	"github.com/sigstore/sigstore/pkg/signature/options"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+)
+
+const (
+	keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	version = keyName + "/cryptoKeyVersions/1"
+)
+
+func newTestSignerVerifier(t *testing.T, algorithm string) (*fakekms.Server, *SignerVerifier) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateSigningKey(keyName, algorithm); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	kms, err := cloudkms.NewService(context.Background(), srv.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+	}
+	sv, err := NewSignerVerifier(context.Background(), version, kms)
+	if err != nil {
+		t.Fatalf("NewSignerVerifier() err = %v, want nil", err)
+	}
+	return srv, sv
+}
+
+// sigstoreVerifier returns the verifier that sigstore itself would use for
+// the public key of sv.
+func sigstoreVerifier(t *testing.T, sv *SignerVerifier, hash crypto.Hash, pss bool) signature.Verifier {
+	t.Helper()
+	pub, err := sv.PublicKey()
+	if err != nil {
+		t.Fatalf("sv.PublicKey() err = %v, want nil", err)
+	}
+	var v signature.Verifier
+	if pss {
+		v, err = signature.LoadRSAPSSVerifier(pub.(*rsa.PublicKey), hash, nil)
+	} else {
+		v, err = signature.LoadVerifier(pub, hash)
+	}
+	if err != nil {
+		t.Fatalf("loading sigstore verifier failed: %v", err)
+	}
+	return v
+}
+
+func TestRoundTrip(t *testing.T) {
+	message := []byte("container image digest")
+	for _, tc := range []struct {
+		algorithm string
+		hash      crypto.Hash
+		pss       bool
+	}{
+		{algorithm: "EC_SIGN_P256_SHA256", hash: crypto.SHA256},
+		{algorithm: "EC_SIGN_P384_SHA384", hash: crypto.SHA384},
+		{algorithm: "RSA_SIGN_PKCS1_2048_SHA256", hash: crypto.SHA256},
+		{algorithm: "RSA_SIGN_PSS_2048_SHA256", hash: crypto.SHA256, pss: true},
+	} {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			_, sv := newTestSignerVerifier(t, tc.algorithm)
+			sig, err := sv.SignMessage(bytes.NewReader(message))
+			if err != nil {
+				t.Fatalf("sv.SignMessage() err = %v, want nil", err)
+			}
+			if err := sv.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message)); err != nil {
+				t.Errorf("sv.VerifySignature() err = %v, want nil", err)
+			}
+			v := sigstoreVerifier(t, sv, tc.hash, tc.pss)
+			if err := v.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message)); err != nil {
+				t.Errorf("sigstore VerifySignature() err = %v, want nil", err)
+			}
+			if err := sv.VerifySignature(bytes.NewReader(sig), bytes.NewReader([]byte("other message"))); err == nil {
+				t.Errorf("sv.VerifySignature() of another message err = nil, want error")
+			}
+		})
+	}
+}
+
+func TestSignMessageWithDigest(t *testing.T) {
+	_, sv := newTestSignerVerifier(t, "EC_SIGN_P256_SHA256")
+	message := []byte("message")
+	digest := sha256.Sum256(message)
+	// The message is ignored if a digest is given.
+	sig, err := sv.SignMessage(nil, options.WithDigest(digest[:]), options.WithCryptoSignerOpts(crypto.SHA256))
+	if err != nil {
+		t.Fatalf("sv.SignMessage() err = %v, want nil", err)
+	}
+	if err := sv.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message)); err != nil {
+		t.Errorf("sv.VerifySignature() err = %v, want nil", err)
+	}
+	if err := sv.VerifySignature(bytes.NewReader(sig), nil, options.WithDigest(digest[:])); err != nil {
+		t.Errorf("sv.VerifySignature(WithDigest) err = %v, want nil", err)
+	}
+	if _, err := sv.SignMessage(nil, options.WithDigest(digest[:16])); err == nil {
+		t.Errorf("sv.SignMessage() with truncated digest err = nil, want error")
+	}
+}
+
+func TestOtherHashFunctionFails(t *testing.T) {
+	_, sv := newTestSignerVerifier(t, "EC_SIGN_P256_SHA256")
+	message := []byte("message")
+	if _, err := sv.SignMessage(bytes.NewReader(message), options.WithCryptoSignerOpts(crypto.SHA512)); err == nil {
+		t.Errorf("sv.SignMessage(WithCryptoSignerOpts(SHA512)) err = nil, want error")
+	}
+	sig, err := sv.SignMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("sv.SignMessage() err = %v, want nil", err)
+	}
+	if err := sv.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message), options.WithCryptoSignerOpts(crypto.SHA384)); err == nil {
+		t.Errorf("sv.VerifySignature(WithCryptoSignerOpts(SHA384)) err = nil, want error")
+	}
+}
+
+func TestKeyVersion(t *testing.T) {
+	_, sv := newTestSignerVerifier(t, "EC_SIGN_P256_SHA256")
+	message := []byte("message")
+	var used string
+	sig, err := sv.SignMessage(bytes.NewReader(message), options.WithKeyVersion("1"), options.ReturnKeyVersionUsed(&used))
+	if err != nil {
+		t.Fatalf("sv.SignMessage() err = %v, want nil", err)
+	}
+	if used != version {
+		t.Errorf("key version used = %q, want %q", used, version)
+	}
+	if err := sv.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message), options.WithKeyVersion(version)); err != nil {
+		t.Errorf("sv.VerifySignature(WithKeyVersion(%q)) err = %v, want nil", version, err)
+	}
+	if _, err := sv.SignMessage(bytes.NewReader(message), options.WithKeyVersion("2")); err == nil {
+		t.Errorf("sv.SignMessage(WithKeyVersion(\"2\")) err = nil, want error")
+	}
+	if err := sv.VerifySignature(bytes.NewReader(sig), bytes.NewReader(message), options.WithKeyVersion("2")); err == nil {
+		t.Errorf("sv.VerifySignature(WithKeyVersion(\"2\")) err = nil, want error")
+	}
+}
+
+func TestSignMessageWithContext(t *testing.T) {
+	srv, sv := newTestSignerVerifier(t, "EC_SIGN_P256_SHA256")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := sv.SignMessage(bytes.NewReader([]byte("message")), options.WithContext(ctx))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("sv.SignMessage() err = %v, want %v", err, context.Canceled)
+	}
+	if got := srv.CallCount("AsymmetricSign"); got != 0 {
+		t.Errorf("srv.CallCount(\"AsymmetricSign\") = %d, want 0", got)
+	}
+}
+
+func TestNewSignerVerifierInvalidName(t *testing.T) {
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	kms, err := cloudkms.NewService(context.Background(), srv.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+	}
+	if _, err := NewSignerVerifier(context.Background(), keyName, kms); err == nil {
+		t.Errorf("NewSignerVerifier(%q) err = nil, want error", keyName)
+	}
+}
@@ -0,0 +1,232 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Package benchdiff implements the gcpkms-benchdiff command, which compares
+// two runs of Go benchmarks, e.g. before and after a change.
+package benchdiff
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// ErrRegression is returned by Command.Run if a metric regressed by more
+// than the threshold.
+var ErrRegression = errors.New("benchmarks regressed")
+
+// procsSuffix matches the GOMAXPROCS suffix of benchmark names, so that runs
+// on machines with different numbers of CPUs can be compared.
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// Benchmark holds the means of the metrics of a benchmark over all its runs.
+type Benchmark struct {
+	Name string
+	// Metrics maps units, e.g. "ns/op" or "allocs/op", to means.
+	Metrics map[string]float64
+}
+
+// Parse parses the output of 'go test -bench'. Benchmarks that were run
+// several times, e.g. with -count, are averaged. Lines that are not benchmark
+// results are ignored.
+func Parse(r io.Reader) ([]*Benchmark, error) {
+	var benchmarks []*Benchmark
+	byName := make(map[string]*Benchmark)
+	counts := make(map[string]map[string]int)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") || len(fields)%2 != 0 {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+		name := procsSuffix.ReplaceAllString(fields[0], "")
+		b, ok := byName[name]
+		if !ok {
+			b = &Benchmark{Name: name, Metrics: make(map[string]float64)}
+			byName[name] = b
+			counts[name] = make(map[string]int)
+			benchmarks = append(benchmarks, b)
+		}
+		for i := 2; i < len(fields); i += 2 {
+			v, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q of benchmark %s", fields[i], fields[0])
+			}
+			unit := fields[i+1]
+			n := counts[name][unit]
+			b.Metrics[unit] = (b.Metrics[unit]*float64(n) + v) / float64(n+1)
+			counts[name][unit] = n + 1
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return benchmarks, nil
+}
+
+// Delta is the change of a metric of a benchmark between two runs.
+type Delta struct {
+	Name string
+	Unit string
+	Old  float64
+	New  float64
+}
+
+// Change returns the relative change from Old to New, e.g. 0.1 for an
+// increase by 10%.
+func (d Delta) Change() float64 {
+	if d.Old == 0 {
+		if d.New == 0 {
+			return 0
+		}
+		return 1
+	}
+	return (d.New - d.Old) / d.Old
+}
+
+// Regressed reports whether the metric got worse by more than threshold, a
+// relative change. Throughputs, measured in units per second, get worse when
+// they decrease; all other metrics get worse when they increase.
+func (d Delta) Regressed(threshold float64) bool {
+	if strings.HasSuffix(d.Unit, "/s") {
+		return -d.Change() > threshold
+	}
+	return d.Change() > threshold
+}
+
+// Compare returns the deltas of the metrics that were measured in both old
+// and new, in the order of new.
+func Compare(old, new []*Benchmark) []Delta {
+	byName := make(map[string]*Benchmark)
+	for _, b := range old {
+		byName[b.Name] = b
+	}
+	var deltas []Delta
+	for _, b := range new {
+		o, ok := byName[b.Name]
+		if !ok {
+			continue
+		}
+		for _, unit := range units(b) {
+			if v, ok := o.Metrics[unit]; ok {
+				deltas = append(deltas, Delta{Name: b.Name, Unit: unit, Old: v, New: b.Metrics[unit]})
+			}
+		}
+	}
+	return deltas
+}
+
+// units returns the units of the metrics of b, with the standard units of
+// 'go test -bench' first.
+func units(b *Benchmark) []string {
+	var units []string
+	for _, u := range []string{"ns/op", "MB/s", "B/op", "allocs/op"} {
+		if _, ok := b.Metrics[u]; ok {
+			units = append(units, u)
+		}
+	}
+	var custom []string
+	for u := range b.Metrics {
+		switch u {
+		case "ns/op", "MB/s", "B/op", "allocs/op":
+		default:
+			custom = append(custom, u)
+		}
+	}
+	sort.Strings(custom)
+	return append(units, custom...)
+}
+
+// Command holds the environment the gcpkms-benchdiff command runs in.
+type Command struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Run parses args, which must not include the program name, and prints the
+// deltas between the benchmark results in the two files given in args. It
+// returns ErrRegression if -threshold is set and a metric regressed by more
+// than it.
+func (c *Command) Run(args []string) error {
+	fs := flag.NewFlagSet("gcpkms-benchdiff", flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	threshold := fs.Float64("threshold", 0, "fail if a metric regressed by more than this many percent; 0 disables the check")
+	fs.Usage = func() {
+		fmt.Fprintln(c.Stderr, "Usage: gcpkms-benchdiff [flags] old.txt new.txt")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return fmt.Errorf("want 2 files, got %d", fs.NArg())
+	}
+	if *threshold < 0 {
+		return fmt.Errorf("threshold must not be negative, got %v", *threshold)
+	}
+	old, err := parseFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	new, err := parseFile(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	deltas := Compare(old, new)
+	w := tabwriter.NewWriter(c.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "name\tunit\told\tnew\tdelta")
+	var regressed int
+	for _, d := range deltas {
+		mark := ""
+		if *threshold > 0 && d.Regressed(*threshold/100) {
+			mark = " !"
+			regressed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%.4g\t%.4g\t%+.2f%%%s\n", d.Name, d.Unit, d.Old, d.New, 100*d.Change(), mark)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if regressed > 0 {
+		return fmt.Errorf("%w: %d metrics by more than %v%%", ErrRegression, regressed, *threshold)
+	}
+	return nil
+}
+
+func parseFile(name string) ([]*Benchmark, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	benchmarks, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", name, err)
+	}
+	return benchmarks, nil
+}
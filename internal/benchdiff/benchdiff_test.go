@@ -0,0 +1,174 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package benchdiff_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/benchdiff"
+)
+
+const oldRun = `goos: linux
+goarch: amd64
+pkg: github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms
+BenchmarkAEADEncrypt/1KiB-8   	   10000	    100000 ns/op	  10.00 MB/s	   40000 B/op	     250 allocs/op
+BenchmarkAEADEncrypt/1KiB-8   	   10000	    120000 ns/op	  12.00 MB/s	   40000 B/op	     250 allocs/op
+BenchmarkAEADDecrypt/1KiB-8   	   10000	     80000 ns/op	   40000 B/op	     260 allocs/op
+BenchmarkRemoved-8            	   10000	     80000 ns/op
+PASS
+ok  	github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms	3.000s
+`
+
+const newRun = `BenchmarkAEADEncrypt/1KiB-4   	   10000	    110000 ns/op	  11.00 MB/s	   40000 B/op	     200 allocs/op
+BenchmarkAEADDecrypt/1KiB-4   	   10000	    100000 ns/op	   40000 B/op	     260 allocs/op
+BenchmarkAdded-4              	   10000	     80000 ns/op
+`
+
+func TestParse(t *testing.T) {
+	benchmarks, err := benchdiff.Parse(strings.NewReader(oldRun))
+	if err != nil {
+		t.Fatalf("benchdiff.Parse() err = %v, want nil", err)
+	}
+	if len(benchmarks) != 3 {
+		t.Fatalf("len(benchdiff.Parse()) = %d, want 3", len(benchmarks))
+	}
+	b := benchmarks[0]
+	if b.Name != "BenchmarkAEADEncrypt/1KiB" {
+		t.Errorf("Name = %q, want %q", b.Name, "BenchmarkAEADEncrypt/1KiB")
+	}
+	want := map[string]float64{"ns/op": 110000, "MB/s": 11, "B/op": 40000, "allocs/op": 250}
+	for unit, v := range want {
+		if got := b.Metrics[unit]; got != v {
+			t.Errorf("Metrics[%q] = %v, want %v", unit, got, v)
+		}
+	}
+}
+
+func TestParseRejectsInvalidValues(t *testing.T) {
+	if _, err := benchdiff.Parse(strings.NewReader("BenchmarkX-8 100 fast ns/op\n")); err == nil {
+		t.Error("benchdiff.Parse() err = nil, want error")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	old, err := benchdiff.Parse(strings.NewReader(oldRun))
+	if err != nil {
+		t.Fatalf("benchdiff.Parse() err = %v, want nil", err)
+	}
+	new, err := benchdiff.Parse(strings.NewReader(newRun))
+	if err != nil {
+		t.Fatalf("benchdiff.Parse() err = %v, want nil", err)
+	}
+	want := []benchdiff.Delta{
+		{Name: "BenchmarkAEADEncrypt/1KiB", Unit: "ns/op", Old: 110000, New: 110000},
+		{Name: "BenchmarkAEADEncrypt/1KiB", Unit: "MB/s", Old: 11, New: 11},
+		{Name: "BenchmarkAEADEncrypt/1KiB", Unit: "B/op", Old: 40000, New: 40000},
+		{Name: "BenchmarkAEADEncrypt/1KiB", Unit: "allocs/op", Old: 250, New: 200},
+		{Name: "BenchmarkAEADDecrypt/1KiB", Unit: "ns/op", Old: 80000, New: 100000},
+		{Name: "BenchmarkAEADDecrypt/1KiB", Unit: "B/op", Old: 40000, New: 40000},
+		{Name: "BenchmarkAEADDecrypt/1KiB", Unit: "allocs/op", Old: 260, New: 260},
+	}
+	got := benchdiff.Compare(old, new)
+	if len(got) != len(want) {
+		t.Fatalf("benchdiff.Compare() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("benchdiff.Compare()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDeltaRegressed(t *testing.T) {
+	for _, tc := range []struct {
+		delta benchdiff.Delta
+		want  bool
+	}{
+		{delta: benchdiff.Delta{Unit: "ns/op", Old: 100, New: 111}, want: true},
+		{delta: benchdiff.Delta{Unit: "ns/op", Old: 100, New: 109}, want: false},
+		{delta: benchdiff.Delta{Unit: "ns/op", Old: 100, New: 50}, want: false},
+		{delta: benchdiff.Delta{Unit: "allocs/op", Old: 0, New: 1}, want: true},
+		{delta: benchdiff.Delta{Unit: "MB/s", Old: 100, New: 89}, want: true},
+		{delta: benchdiff.Delta{Unit: "MB/s", Old: 100, New: 200}, want: false},
+	} {
+		if got := tc.delta.Regressed(0.1); got != tc.want {
+			t.Errorf("%v.Regressed(0.1) = %v, want %v", tc.delta, got, tc.want)
+		}
+	}
+}
+
+func writeRuns(t *testing.T) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	oldFile := filepath.Join(dir, "old.txt")
+	newFile := filepath.Join(dir, "new.txt")
+	if err := os.WriteFile(oldFile, []byte(oldRun), 0600); err != nil {
+		t.Fatalf("os.WriteFile() err = %v, want nil", err)
+	}
+	if err := os.WriteFile(newFile, []byte(newRun), 0600); err != nil {
+		t.Fatalf("os.WriteFile() err = %v, want nil", err)
+	}
+	return oldFile, newFile
+}
+
+func TestRun(t *testing.T) {
+	oldFile, newFile := writeRuns(t)
+	stdout := &bytes.Buffer{}
+	c := &benchdiff.Command{Stdout: stdout, Stderr: &bytes.Buffer{}}
+	if err := c.Run([]string{oldFile, newFile}); err != nil {
+		t.Fatalf("Run() err = %v, want nil", err)
+	}
+	for _, want := range []string{"BenchmarkAEADDecrypt/1KiB", "+25.00%", "-20.00%"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("Run() output = %q, want it to contain %q", stdout, want)
+		}
+	}
+
+	err := c.Run([]string{"-threshold", "10", oldFile, newFile})
+	if !errors.Is(err, benchdiff.ErrRegression) {
+		t.Errorf("Run() with -threshold 10 err = %v, want %v", err, benchdiff.ErrRegression)
+	}
+	if err := c.Run([]string{"-threshold", "30", oldFile, newFile}); err != nil {
+		t.Errorf("Run() with -threshold 30 err = %v, want nil", err)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	oldFile, newFile := writeRuns(t)
+	for _, tc := range []struct {
+		name string
+		args []string
+	}{
+		{name: "no files", args: nil},
+		{name: "one file", args: []string{oldFile}},
+		{name: "missing file", args: []string{oldFile, newFile + ".missing"}},
+		{name: "negative threshold", args: []string{"-threshold", "-1", oldFile, newFile}},
+		{name: "unknown flag", args: []string{"-unknown", oldFile, newFile}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &benchdiff.Command{Stdout: &bytes.Buffer{}, Stderr: &bytes.Buffer{}}
+			if err := c.Run(tc.args); err == nil {
+				t.Errorf("Run(%q) err = nil, want error", tc.args)
+			}
+		})
+	}
+}
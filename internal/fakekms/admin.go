@@ -0,0 +1,234 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package fakekms
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// destroyScheduledDuration is how long Cloud KMS waits by default before
+// destroying a key version scheduled for destruction.
+const destroyScheduledDuration = 30 * 24 * time.Hour
+
+// newKeyVersion returns a new enabled version of a key with the given purpose
+// and algorithm.
+func newKeyVersion(purpose, algorithm string) (*keyVersion, error) {
+	v := &keyVersion{state: "ENABLED", createTime: now()}
+	var err error
+	switch purpose {
+	case "ENCRYPT_DECRYPT":
+		if algorithm != "GOOGLE_SYMMETRIC_ENCRYPTION" {
+			return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+		}
+		v.aead, err = newVersion()
+	case "ASYMMETRIC_SIGN":
+		v.signer, err = newSigner(algorithm)
+	case "MAC":
+		v.macKey, err = newMACKey(algorithm)
+	default:
+		return nil, fmt.Errorf("unsupported purpose %q", purpose)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// cryptoKeyResource returns the CryptoKey resource of the key with the given
+// name. s.mu must be held.
+func (s *Server) cryptoKeyResource(name string, k *cryptoKey) *cloudkms.CryptoKey {
+	resp := &cloudkms.CryptoKey{
+		Name:           name,
+		Purpose:        k.purpose,
+		RotationPeriod: k.rotationPeriod,
+		Labels:         k.labels,
+		VersionTemplate: &cloudkms.CryptoKeyVersionTemplate{
+			Algorithm:       k.algorithm,
+			ProtectionLevel: k.protectionLevel,
+		},
+	}
+	if k.purpose == "ENCRYPT_DECRYPT" {
+		resp.Primary = s.versionResource(name, k, len(k.versions))
+	}
+	return resp
+}
+
+// create serves the CreateKeyRing, CreateCryptoKey and
+// CreateCryptoKeyVersion RPCs, whose paths have no verb.
+func (s *Server) create(w *responseWriter, r *http.Request, path string) {
+	segments := strings.Split(path, "/")
+	switch {
+	case len(segments) == 5 && segments[4] == "keyRings":
+		if s.recordCall(w, r, "CreateKeyRing", path) {
+			s.createKeyRing(w, path+"/"+r.URL.Query().Get("keyRingId"))
+		}
+	case len(segments) == 7 && segments[6] == "cryptoKeys":
+		if s.recordCall(w, r, "CreateCryptoKey", path) {
+			s.createCryptoKey(w, r, strings.Join(segments[:6], "/"), r.URL.Query().Get("cryptoKeyId"))
+		}
+	case len(segments) == 9 && segments[8] == "cryptoKeyVersions":
+		if s.recordCall(w, r, "CreateCryptoKeyVersion", path) {
+			s.createVersion(w, strings.Join(segments[:8], "/"))
+		}
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown path "+r.URL.Path)
+	}
+}
+
+func (s *Server) createKeyRing(w http.ResponseWriter, name string) {
+	if strings.HasSuffix(name, "/") {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "keyRingId is required")
+		return
+	}
+	if s.exists(name) {
+		writeError(w, http.StatusConflict, "ALREADY_EXISTS", fmt.Sprintf("KeyRing %s already exists.", name))
+		return
+	}
+	s.mu.Lock()
+	s.keyRings[name] = true
+	s.mu.Unlock()
+	writeJSON(w, &cloudkms.KeyRing{Name: name, CreateTime: now()})
+}
+
+// createCryptoKey creates a key with one enabled version, with the purpose,
+// algorithm and labels of the request. Only the SOFTWARE protection level is
+// supported.
+func (s *Server) createCryptoKey(w http.ResponseWriter, r *http.Request, keyRing, id string) {
+	req := new(cloudkms.CryptoKey)
+	if _, err := decodeRequest(r, req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	if id == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "cryptoKeyId is required")
+		return
+	}
+	var algorithm string
+	if t := req.VersionTemplate; t != nil {
+		if t.ProtectionLevel != "" && t.ProtectionLevel != "SOFTWARE" {
+			writeError(w, http.StatusNotImplemented, "UNIMPLEMENTED", "unsupported protection level "+t.ProtectionLevel)
+			return
+		}
+		algorithm = t.Algorithm
+	}
+	if req.Purpose == "ENCRYPT_DECRYPT" && algorithm == "" {
+		algorithm = "GOOGLE_SYMMETRIC_ENCRYPTION"
+	}
+	v, err := newKeyVersion(req.Purpose, algorithm)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	if !s.exists(keyRing) {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("KeyRing %s not found.", keyRing))
+		return
+	}
+	name := keyRing + "/cryptoKeys/" + id
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[name]; ok {
+		writeError(w, http.StatusConflict, "ALREADY_EXISTS", fmt.Sprintf("CryptoKey %s already exists.", name))
+		return
+	}
+	k := &cryptoKey{
+		purpose:         req.Purpose,
+		algorithm:       algorithm,
+		versions:        []*keyVersion{v},
+		protectionLevel: "SOFTWARE",
+		rotationPeriod:  req.RotationPeriod,
+		labels:          req.Labels,
+	}
+	s.keys[name] = k
+	writeJSON(w, s.cryptoKeyResource(name, k))
+}
+
+// createVersion adds an enabled version to the key with the given name, like
+// AddVersion.
+func (s *Server) createVersion(w http.ResponseWriter, keyName string) {
+	k, ok := s.lookup(keyName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKey %s not found.", keyName))
+		return
+	}
+	v, err := newKeyVersion(k.purpose, k.algorithm)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k.versions = append(k.versions, v)
+	writeJSON(w, s.versionResource(keyName, k, len(k.versions)))
+}
+
+// destroyVersion serves the DestroyCryptoKeyVersion RPC, which schedules the
+// destruction of the key version with the given name. The key material is
+// kept, as the fake never destroys it.
+func (s *Server) destroyVersion(w http.ResponseWriter, name string) {
+	k, version, ok := s.lookupVersion(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKeyVersion %s not found.", name))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := k.versions[version-1]
+	if v.state != "ENABLED" && v.state != "DISABLED" {
+		writeError(w, http.StatusBadRequest, "FAILED_PRECONDITION", fmt.Sprintf("CryptoKeyVersion %s is not in state ENABLED or DISABLED, current state is %s.", name, v.state))
+		return
+	}
+	v.state = "DESTROY_SCHEDULED"
+	v.destroyTime = time.Now().Add(destroyScheduledDuration).UTC().Format(time.RFC3339Nano)
+	writeJSON(w, s.versionResource(name[:strings.LastIndex(name, "/cryptoKeyVersions/")], k, version))
+}
+
+// updatePrimaryVersion serves the UpdateCryptoKeyPrimaryVersion RPC. As the
+// primary version of a symmetric key of the fake is always its newest
+// version, only that version can be made the primary version.
+func (s *Server) updatePrimaryVersion(w http.ResponseWriter, r *http.Request, name string) {
+	req := new(cloudkms.UpdateCryptoKeyPrimaryVersionRequest)
+	if _, err := decodeRequest(r, req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	k, ok := s.lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKey %s not found.", name))
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if k.purpose != "ENCRYPT_DECRYPT" {
+		writeError(w, http.StatusBadRequest, "FAILED_PRECONDITION", fmt.Sprintf("CryptoKey %s has purpose %s, only ENCRYPT_DECRYPT keys have a primary version.", name, k.purpose))
+		return
+	}
+	newest := len(k.versions)
+	if req.CryptoKeyVersionId != fmt.Sprint(newest) {
+		writeError(w, http.StatusNotImplemented, "UNIMPLEMENTED", fmt.Sprintf("the fake only supports making the newest version %d primary, got %q", newest, req.CryptoKeyVersionId))
+		return
+	}
+	if state := k.versions[newest-1].state; state != "ENABLED" {
+		writeError(w, http.StatusBadRequest, "FAILED_PRECONDITION", fmt.Sprintf("CryptoKeyVersion %s/cryptoKeyVersions/%d is not in state ENABLED, current state is %s.", name, newest, state))
+		return
+	}
+	writeJSON(w, s.cryptoKeyResource(name, k))
+}
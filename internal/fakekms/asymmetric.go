@@ -0,0 +1,296 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package fakekms
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/cloudkms/v1"
+)
+
+// signAlgorithm describes a Cloud KMS signing algorithm.
+type signAlgorithm struct {
+	// hash is zero for EC_SIGN_ED25519, whose keys sign the data rather
+	// than a digest of it.
+	hash   crypto.Hash
+	pss    bool
+	newKey func() (crypto.Signer, error)
+}
+
+func ecKey(c elliptic.Curve) func() (crypto.Signer, error) {
+	return func() (crypto.Signer, error) { return ecdsa.GenerateKey(c, rand.Reader) }
+}
+
+func rsaKey(bits int) func() (crypto.Signer, error) {
+	return func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, bits) }
+}
+
+func ed25519Key() (crypto.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	return key, err
+}
+
+var signAlgorithms = map[string]signAlgorithm{
+	"EC_SIGN_ED25519":            {newKey: ed25519Key},
+	"EC_SIGN_P256_SHA256":        {hash: crypto.SHA256, newKey: ecKey(elliptic.P256())},
+	"EC_SIGN_P384_SHA384":        {hash: crypto.SHA384, newKey: ecKey(elliptic.P384())},
+	"RSA_SIGN_PKCS1_2048_SHA256": {hash: crypto.SHA256, newKey: rsaKey(2048)},
+	"RSA_SIGN_PKCS1_3072_SHA256": {hash: crypto.SHA256, newKey: rsaKey(3072)},
+	"RSA_SIGN_PKCS1_4096_SHA256": {hash: crypto.SHA256, newKey: rsaKey(4096)},
+	"RSA_SIGN_PKCS1_4096_SHA512": {hash: crypto.SHA512, newKey: rsaKey(4096)},
+	"RSA_SIGN_PSS_2048_SHA256":   {hash: crypto.SHA256, pss: true, newKey: rsaKey(2048)},
+	"RSA_SIGN_PSS_3072_SHA256":   {hash: crypto.SHA256, pss: true, newKey: rsaKey(3072)},
+	"RSA_SIGN_PSS_4096_SHA256":   {hash: crypto.SHA256, pss: true, newKey: rsaKey(4096)},
+	"RSA_SIGN_PSS_4096_SHA512":   {hash: crypto.SHA512, pss: true, newKey: rsaKey(4096)},
+}
+
+func newSigner(algorithm string) (crypto.Signer, error) {
+	alg, ok := signAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	return alg.newKey()
+}
+
+// CreateSigningKey creates an asymmetric signing key with one version under
+// the given resource name, using the given Cloud KMS algorithm, e.g.
+// "EC_SIGN_P256_SHA256" or "RSA_SIGN_PSS_2048_SHA256".
+func (s *Server) CreateSigningKey(name, algorithm string) error {
+	signer, err := newSigner(algorithm)
+	if err != nil {
+		return err
+	}
+	return s.addSigningKey(name, algorithm, signer)
+}
+
+// CreateSigningKeyWithMaterial is like CreateSigningKey, but the version of
+// the key uses the given private key, e.g. a published test key, so that its
+// signatures can be compared with test vectors. key must be a key of the
+// algorithm, which is not checked.
+func (s *Server) CreateSigningKeyWithMaterial(name, algorithm string, key crypto.Signer) error {
+	if _, ok := signAlgorithms[algorithm]; !ok {
+		return fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	return s.addSigningKey(name, algorithm, key)
+}
+
+// addSigningKey adds a signing key with one version, whose private key is
+// signer, under the given resource name.
+func (s *Server) addSigningKey(name, algorithm string, signer crypto.Signer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[name]; ok {
+		return fmt.Errorf("key %q already exists", name)
+	}
+	s.keys[name] = &cryptoKey{
+		purpose:         "ASYMMETRIC_SIGN",
+		algorithm:       algorithm,
+		versions:        []*keyVersion{{signer: signer, state: "ENABLED", createTime: now()}},
+		protectionLevel: "SOFTWARE",
+	}
+	return nil
+}
+
+// SetSigningAlgorithm changes the algorithm of the signing key with the given
+// resource name and replaces the key material of all its versions, as if the
+// key had been re-created.
+func (s *Server) SetSigningAlgorithm(name, algorithm string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok || k.purpose != "ASYMMETRIC_SIGN" {
+		return fmt.Errorf("signing key %q not found", name)
+	}
+	for _, v := range k.versions {
+		signer, err := newSigner(algorithm)
+		if err != nil {
+			return err
+		}
+		v.signer = signer
+	}
+	k.algorithm = algorithm
+	return nil
+}
+
+// listVersions serves the ListCryptoKeyVersions RPC. Only filters of the form
+// "state=<STATE>" are supported, and all versions are returned in one page.
+func (s *Server) listVersions(w http.ResponseWriter, keyName, filter string) {
+	k, ok := s.lookup(keyName)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKey %s not found.", keyName))
+		return
+	}
+	var state string
+	if filter != "" {
+		f := strings.ReplaceAll(filter, " ", "")
+		if !strings.HasPrefix(f, "state=") {
+			writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "unsupported filter "+filter)
+			return
+		}
+		state = strings.TrimPrefix(f, "state=")
+	}
+	s.mu.Lock()
+	resp := &cloudkms.ListCryptoKeyVersionsResponse{}
+	for i, v := range k.versions {
+		if state == "" || v.state == state {
+			resp.CryptoKeyVersions = append(resp.CryptoKeyVersions, s.versionResource(keyName, k, i+1))
+		}
+	}
+	s.mu.Unlock()
+	resp.TotalSize = int64(len(resp.CryptoKeyVersions))
+	writeJSON(w, resp)
+}
+
+// lookupSigningVersion returns the key and algorithm of the enabled signing
+// key version with the given name and its signer, or writes the error Cloud
+// KMS would return.
+func (s *Server) lookupSigningVersion(w http.ResponseWriter, name string) (*cryptoKey, string, crypto.Signer, bool) {
+	k, version, ok := s.lookupVersion(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKeyVersion %s not found.", name))
+		return nil, "", nil, false
+	}
+	keyName := name[:strings.LastIndex(name, "/cryptoKeyVersions/")]
+	if k.purpose != "ASYMMETRIC_SIGN" {
+		writeWrongPurpose(w, keyName, k.purpose, "ASYMMETRIC_SIGN")
+		return nil, "", nil, false
+	}
+	s.mu.Lock()
+	v := k.versions[version-1]
+	state, algorithm, signer := v.state, k.algorithm, v.signer
+	s.mu.Unlock()
+	if state != "ENABLED" {
+		writeVersionNotEnabled(w, keyName, version, state)
+		return nil, "", nil, false
+	}
+	return k, algorithm, signer, true
+}
+
+func (s *Server) getPublicKey(w http.ResponseWriter, name string) {
+	k, algorithm, signer, ok := s.lookupSigningVersion(w, name)
+	if !ok {
+		return
+	}
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	writeJSON(w, &cloudkms.PublicKey{
+		Name:            name,
+		Pem:             pemKey,
+		PemCrc32c:       checksum([]byte(pemKey)),
+		Algorithm:       algorithm,
+		ProtectionLevel: k.protectionLevel,
+	})
+}
+
+func (s *Server) asymmetricSign(w http.ResponseWriter, r *http.Request, name string) {
+	req := new(cloudkms.AsymmetricSignRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	k, algorithm, signer, ok := s.lookupSigningVersion(w, name)
+	if !ok {
+		return
+	}
+	alg := signAlgorithms[algorithm]
+	if alg.hash == 0 {
+		s.signData(w, req, name, k, signer)
+		return
+	}
+	var encoded string
+	if req.Digest != nil {
+		switch alg.hash {
+		case crypto.SHA256:
+			encoded = req.Digest.Sha256
+		case crypto.SHA384:
+			encoded = req.Digest.Sha384
+		case crypto.SHA512:
+			encoded = req.Digest.Sha512
+		}
+	}
+	digest, err := decodeBytes(encoded)
+	if err != nil || len(digest) != alg.hash.Size() {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", fmt.Sprintf("The request must contain a %v digest of %d bytes.", alg.hash, alg.hash.Size()))
+		return
+	}
+	if req.DigestCrc32c != 0 && req.DigestCrc32c != checksum(digest) {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The checksum in field digest_crc32c did not match the data in field digest.")
+		return
+	}
+	var opts crypto.SignerOpts = alg.hash
+	if alg.pss {
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: alg.hash}
+	}
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	writeJSON(w, &cloudkms.AsymmetricSignResponse{
+		Name:                 name,
+		Signature:            base64.StdEncoding.EncodeToString(signature),
+		SignatureCrc32c:      checksum(signature),
+		VerifiedDigestCrc32c: req.DigestCrc32c != 0,
+		ProtectionLevel:      k.protectionLevel,
+	})
+}
+
+// signData serves AsymmetricSign requests for keys that sign the data rather
+// than a digest of it, i.e. EC_SIGN_ED25519 keys, which reject digests.
+func (s *Server) signData(w http.ResponseWriter, req *cloudkms.AsymmetricSignRequest, name string, k *cryptoKey, signer crypto.Signer) {
+	if req.Digest != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The algorithm of the key does not support signing digests, the request must contain data.")
+		return
+	}
+	data, err := decodeBytes(req.Data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	if req.DataCrc32c != 0 && req.DataCrc32c != checksum(data) {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The checksum in field data_crc32c did not match the data in field data.")
+		return
+	}
+	signature, err := signer.Sign(rand.Reader, data, crypto.Hash(0))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	writeJSON(w, &cloudkms.AsymmetricSignResponse{
+		Name:               name,
+		Signature:          base64.StdEncoding.EncodeToString(signature),
+		SignatureCrc32c:    checksum(signature),
+		VerifiedDataCrc32c: req.DataCrc32c != 0,
+		ProtectionLevel:    k.protectionLevel,
+	})
+}
@@ -0,0 +1,928 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Package fakekms provides an in-process fake of the Cloud KMS REST API.
+//
+// It is intended for hermetic tests only. Keys are held in memory and
+// ciphertexts are not compatible with the real service.
+package fakekms
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/option"
+)
+
+const versionPrefixSize = 4
+
+// maxPlaintextSize is the size of the largest plaintext that Cloud KMS
+// encrypts.
+const maxPlaintextSize = 64 * 1024
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Server is a fake Cloud KMS server listening on a local address.
+type Server struct {
+	srv *httptest.Server
+	// tlsConfig is the TLS configuration of servers created with
+	// NewTLSServer, and nil otherwise.
+	tlsConfig *tls.Config
+
+	mu         sync.Mutex
+	keys       map[string]*cryptoKey
+	keyHandles map[string]string
+	calls      map[string]int
+	// keyRings holds the key rings created with the CreateKeyRing RPC. Key
+	// rings that contain a key exist implicitly.
+	keyRings map[string]bool
+	// headers are set on every response.
+	headers http.Header
+	// connections counts the connections accepted by the server.
+	connections int
+	// latency returns how long to wait before handling a call of an RPC.
+	latency func(rpc string) time.Duration
+	// faults is nil unless SetFaultInjector is used.
+	faults *FaultInjector
+}
+
+type cryptoKey struct {
+	purpose         string
+	algorithm       string
+	versions        []*keyVersion
+	protectionLevel string
+	// rotationPeriod is the rotation period in the format of the API, e.g.
+	// "7776000s", or empty if the key is not rotated automatically.
+	rotationPeriod string
+	labels         map[string]string
+	// denied holds the IAM permissions on the key that the caller lacks.
+	denied map[string]bool
+}
+
+// keyVersion holds the key material of a key version: aead for
+// ENCRYPT_DECRYPT keys, signer for ASYMMETRIC_SIGN keys and macKey for MAC
+// keys.
+type keyVersion struct {
+	aead        cipher.AEAD
+	signer      crypto.Signer
+	macKey      []byte
+	state       string
+	destroyTime string
+	// createTime is reported as the create time of the version, in RFC 3339
+	// format.
+	createTime string
+}
+
+// NewServer starts a new fake Cloud KMS server. The caller must call Close
+// when done.
+func NewServer() *Server {
+	s := &Server{
+		keys:       make(map[string]*cryptoKey),
+		keyHandles: make(map[string]string),
+		keyRings:   make(map[string]bool),
+		calls:      make(map[string]int),
+		headers:    make(http.Header),
+	}
+	s.start(nil)
+	return s
+}
+
+// NewTLSServer is like NewServer, but the server serves HTTPS with config,
+// e.g. to require client certificates, and a certificate that clients trust
+// through Certificate.
+func NewTLSServer(config *tls.Config) *Server {
+	s := &Server{
+		keys:       make(map[string]*cryptoKey),
+		keyHandles: make(map[string]string),
+		keyRings:   make(map[string]bool),
+		calls:      make(map[string]int),
+		headers:    make(http.Header),
+		tlsConfig:  config,
+	}
+	s.start(nil)
+	return s
+}
+
+// Certificate returns the certificate of a server created with NewTLSServer.
+func (s *Server) Certificate() *x509.Certificate {
+	return s.srv.Certificate()
+}
+
+// start starts serving on l, or on a new local address if l is nil.
+func (s *Server) start(l net.Listener) {
+	s.srv = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	if l != nil {
+		s.srv.Listener.Close()
+		s.srv.Listener = l
+	}
+	s.srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.mu.Lock()
+			s.connections++
+			s.mu.Unlock()
+		}
+	}
+	if s.tlsConfig != nil {
+		s.srv.TLS = s.tlsConfig.Clone()
+		s.srv.StartTLS()
+		return
+	}
+	s.srv.Start()
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Restart simulates a restart of the server: it closes all connections and
+// stops listening, calls down, e.g. to observe clients failing to connect,
+// and listens on the same address again. The keys are kept. It must not be
+// called concurrently with URL or ClientOptions.
+func (s *Server) Restart(down func()) error {
+	addr := s.srv.Listener.Addr().String()
+	s.srv.Close()
+	down()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s.start(l)
+	return nil
+}
+
+// URL returns the base URL of the server.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// ClientOptions returns the options required to point a Cloud KMS client at
+// the server.
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.srv.URL + "/"),
+		option.WithoutAuthentication(),
+	}
+}
+
+// CreateKey creates a symmetric key with one version under the given
+// resource name, e.g.
+// "projects/p/locations/global/keyRings/r/cryptoKeys/k".
+func (s *Server) CreateKey(name string) error {
+	a, err := newVersion()
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[name]; ok {
+		return fmt.Errorf("key %q already exists", name)
+	}
+	s.keys[name] = &cryptoKey{
+		purpose:         "ENCRYPT_DECRYPT",
+		algorithm:       "GOOGLE_SYMMETRIC_ENCRYPTION",
+		versions:        []*keyVersion{{aead: a, state: "ENABLED", createTime: now()}},
+		protectionLevel: "SOFTWARE",
+	}
+	return nil
+}
+
+// CreateKeyWithMaterial is like CreateKey, but the version of the key uses
+// the given 32-byte AES key, so that its ciphertexts can be checked in as
+// fixtures and decrypted by later test runs.
+func (s *Server) CreateKeyWithMaterial(name string, key []byte) error {
+	if len(key) != 32 {
+		return fmt.Errorf("key material must be 32 bytes, got %d", len(key))
+	}
+	a, err := newVersionFromKey(key)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[name]; ok {
+		return fmt.Errorf("key %q already exists", name)
+	}
+	s.keys[name] = &cryptoKey{
+		purpose:         "ENCRYPT_DECRYPT",
+		algorithm:       "GOOGLE_SYMMETRIC_ENCRYPTION",
+		versions:        []*keyVersion{{aead: a, state: "ENABLED", createTime: now()}},
+		protectionLevel: "SOFTWARE",
+	}
+	return nil
+}
+
+// AddVersion adds a new enabled version to the key and returns its number.
+// For symmetric keys, the new version becomes the primary version.
+func (s *Server) AddVersion(name string) (int, error) {
+	s.mu.Lock()
+	k, ok := s.keys[name]
+	s.mu.Unlock()
+	if !ok {
+		return 0, fmt.Errorf("key %q not found", name)
+	}
+	v, err := newKeyVersion(k.purpose, k.algorithm)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k.versions = append(k.versions, v)
+	return len(k.versions), nil
+}
+
+// SetProtectionLevel sets the protection level reported for the key, e.g.
+// "HSM" or "EXTERNAL". New keys have protection level "SOFTWARE".
+func (s *Server) SetProtectionLevel(name, level string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok {
+		return fmt.Errorf("key %q not found", name)
+	}
+	k.protectionLevel = level
+	return nil
+}
+
+// SetRotationPeriod sets the rotation period reported for the key, in the
+// format of the API, e.g. "7776000s". New keys have no rotation period.
+func (s *Server) SetRotationPeriod(name, period string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok {
+		return fmt.Errorf("key %q not found", name)
+	}
+	k.rotationPeriod = period
+	return nil
+}
+
+// SetLabels sets the labels reported for the key. New keys have no labels.
+func (s *Server) SetLabels(name string, labels map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok {
+		return fmt.Errorf("key %q not found", name)
+	}
+	k.labels = labels
+	return nil
+}
+
+// DenyPermissions makes the server treat the caller as lacking the given IAM
+// permissions on the key, e.g. "cloudkms.cryptoKeyVersions.useToEncrypt".
+// Requests that need "cloudkms.cryptoKeys.get",
+// "cloudkms.cryptoKeyVersions.useToEncrypt" or
+// "cloudkms.cryptoKeyVersions.useToDecrypt" fail with PERMISSION_DENIED, and
+// TestIamPermissions does not return them.
+func (s *Server) DenyPermissions(name string, permissions ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok {
+		return fmt.Errorf("key %q not found", name)
+	}
+	if k.denied == nil {
+		k.denied = make(map[string]bool)
+	}
+	for _, p := range permissions {
+		k.denied[p] = true
+	}
+	return nil
+}
+
+// checkPermission writes the error that Cloud KMS returns when the caller
+// lacks permission on the key with the given name, and reports whether it
+// did.
+func (s *Server) checkPermission(w http.ResponseWriter, name string, k *cryptoKey, permission string) bool {
+	s.mu.Lock()
+	denied := k.denied[permission]
+	s.mu.Unlock()
+	if denied {
+		writeError(w, http.StatusForbidden, "PERMISSION_DENIED",
+			fmt.Sprintf("Permission '%s' denied on resource '%s' (or it may not exist).", permission, name))
+	}
+	return !denied
+}
+
+// SetVersionState sets the state of the given version of the key, e.g.
+// "DISABLED", "DESTROYED" or "DESTROY_SCHEDULED". destroyTime is reported as
+// the destroy time of the version, in RFC 3339 format, and may be empty.
+// Versions that are not "ENABLED" cannot be used.
+func (s *Server) SetVersionState(name string, version int, state, destroyTime string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok {
+		return fmt.Errorf("key %q not found", name)
+	}
+	if version < 1 || version > len(k.versions) {
+		return fmt.Errorf("key %q has no version %d", name, version)
+	}
+	k.versions[version-1].state = state
+	k.versions[version-1].destroyTime = destroyTime
+	return nil
+}
+
+// SetVersionCreateTime sets the create time of the given version of the key,
+// which is the time the version was added by default.
+func (s *Server) SetVersionCreateTime(name string, version int, createTime time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok {
+		return fmt.Errorf("key %q not found", name)
+	}
+	if version < 1 || version > len(k.versions) {
+		return fmt.Errorf("key %q has no version %d", name, version)
+	}
+	k.versions[version-1].createTime = createTime.UTC().Format(time.RFC3339Nano)
+	return nil
+}
+
+// now returns the current time in the format of create times.
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339Nano)
+}
+
+// CreateKeyHandle creates an Autokey key handle with the given resource name,
+// e.g. "projects/p/locations/global/keyHandles/h", that resolves to the
+// crypto key kmsKey. An empty kmsKey models a key handle whose key is still
+// being provisioned.
+func (s *Server) CreateKeyHandle(name, kmsKey string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keyHandles[name] = kmsKey
+}
+
+// CallCount returns how many times the RPC with the given name, e.g.
+// "Encrypt" or "GetCryptoKey", has been called.
+func (s *Server) CallCount(rpc string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[rpc]
+}
+
+// Connections returns the number of connections the server has accepted.
+func (s *Server) Connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connections
+}
+
+// SetResponseHeader sets the header with the given name to value on all
+// subsequent responses, e.g. to simulate the request IDs of Cloud KMS.
+func (s *Server) SetResponseHeader(name, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.headers.Set(name, value)
+}
+
+// SetLatency makes the server wait latency(rpc) before handling each
+// subsequent call of the RPC with the given name, e.g. to benchmark hedging
+// or timeouts. latency is called concurrently and may be nil to remove the
+// latency.
+func (s *Server) SetLatency(latency func(rpc string) time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// recordCall counts a call of rpc on the resource name, waits for the latency
+// configured with SetLatency and applies the next fault of the call. It
+// returns false if the call must not be handled.
+func (s *Server) recordCall(w *responseWriter, r *http.Request, rpc, name string) bool {
+	s.mu.Lock()
+	s.calls[rpc]++
+	latency := s.latency
+	s.mu.Unlock()
+	if latency != nil {
+		time.Sleep(latency(rpc))
+	}
+	return s.injectFault(w, r, rpc, name)
+}
+
+func newVersion() (cipher.AEAD, error) {
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		return nil, err
+	}
+	return newVersionFromKey(k)
+}
+
+func newVersionFromKey(k []byte) (cipher.AEAD, error) {
+	b, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(b)
+}
+
+func (s *Server) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	w := &responseWriter{ResponseWriter: rw}
+	defer w.flush()
+	s.mu.Lock()
+	for name, values := range s.headers {
+		w.Header()[name] = append([]string(nil), values...)
+	}
+	s.mu.Unlock()
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	if r.Method == http.MethodGet {
+		s.get(w, r, path, r.URL.Query().Get("filter"))
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusNotImplemented, "UNIMPLEMENTED", "unsupported method "+r.Method)
+		return
+	}
+	i := strings.LastIndex(path, ":")
+	if i < 0 {
+		s.create(w, r, path)
+		return
+	}
+	name, verb := path[:i], path[i+1:]
+	switch verb {
+	case "encrypt":
+		if s.recordCall(w, r, "Encrypt", name) {
+			s.encrypt(w, r, name)
+		}
+	case "decrypt":
+		if s.recordCall(w, r, "Decrypt", name) {
+			s.decrypt(w, r, name)
+		}
+	case "asymmetricSign":
+		if s.recordCall(w, r, "AsymmetricSign", name) {
+			s.asymmetricSign(w, r, name)
+		}
+	case "macSign":
+		if s.recordCall(w, r, "MacSign", name) {
+			s.macSign(w, r, name)
+		}
+	case "generateRandomBytes":
+		if s.recordCall(w, r, "GenerateRandomBytes", name) {
+			s.generateRandomBytes(w, r, name)
+		}
+	case "testIamPermissions":
+		if s.recordCall(w, r, "TestIamPermissions", name) {
+			s.testIAMPermissions(w, r, name)
+		}
+	case "destroy":
+		if s.recordCall(w, r, "DestroyCryptoKeyVersion", name) {
+			s.destroyVersion(w, name)
+		}
+	case "updatePrimaryVersion":
+		if s.recordCall(w, r, "UpdateCryptoKeyPrimaryVersion", name) {
+			s.updatePrimaryVersion(w, r, name)
+		}
+	default:
+		writeError(w, http.StatusNotImplemented, "UNIMPLEMENTED", "unsupported verb "+verb)
+	}
+}
+
+// get serves the Get RPCs of locations, key rings, crypto keys, key versions
+// and public keys, and the ListCryptoKeyVersions RPC. Key rings and locations
+// exist implicitly if they contain at least one key, and key rings also exist
+// once created with the CreateKeyRing RPC.
+func (s *Server) get(w *responseWriter, r *http.Request, name, filter string) {
+	segments := strings.Split(name, "/")
+	switch len(segments) {
+	case 4:
+		if !s.recordCall(w, r, "GetLocation", name) {
+			return
+		}
+		if !s.exists(name) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("Location %s not found.", name))
+			return
+		}
+		writeJSON(w, &cloudkms.Location{Name: name, LocationId: segments[3]})
+	case 6:
+		if segments[4] == "keyHandles" {
+			if !s.recordCall(w, r, "GetKeyHandle", name) {
+				return
+			}
+			s.mu.Lock()
+			kmsKey, ok := s.keyHandles[name]
+			s.mu.Unlock()
+			if !ok {
+				writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("KeyHandle %s not found.", name))
+				return
+			}
+			writeJSON(w, map[string]string{"name": name, "kmsKey": kmsKey})
+			return
+		}
+		if !s.recordCall(w, r, "GetKeyRing", name) {
+			return
+		}
+		if !s.exists(name) {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("KeyRing %s not found.", name))
+			return
+		}
+		writeJSON(w, &cloudkms.KeyRing{Name: name})
+	case 8:
+		if !s.recordCall(w, r, "GetCryptoKey", name) {
+			return
+		}
+		k, ok := s.lookup(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKey %s not found.", name))
+			return
+		}
+		if !s.checkPermission(w, name, k, "cloudkms.cryptoKeys.get") {
+			return
+		}
+		s.mu.Lock()
+		resp := s.cryptoKeyResource(name, k)
+		s.mu.Unlock()
+		writeJSON(w, resp)
+	case 9:
+		if !s.recordCall(w, r, "ListCryptoKeyVersions", name) {
+			return
+		}
+		s.listVersions(w, strings.Join(segments[:8], "/"), filter)
+	case 10:
+		if !s.recordCall(w, r, "GetCryptoKeyVersion", name) {
+			return
+		}
+		k, version, ok := s.lookupVersion(name)
+		if !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKeyVersion %s not found.", name))
+			return
+		}
+		s.mu.Lock()
+		resp := s.versionResource(strings.Join(segments[:8], "/"), k, version)
+		s.mu.Unlock()
+		writeJSON(w, resp)
+	case 11:
+		if !s.recordCall(w, r, "GetPublicKey", name) {
+			return
+		}
+		s.getPublicKey(w, strings.Join(segments[:10], "/"))
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "unknown resource "+name)
+	}
+}
+
+// testIAMPermissions serves the TestIamPermissions RPC of crypto keys. It
+// returns the requested permissions that were not denied with
+// DenyPermissions.
+func (s *Server) testIAMPermissions(w http.ResponseWriter, r *http.Request, name string) {
+	req := new(cloudkms.TestIamPermissionsRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	k, ok := s.lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKey %s not found.", name))
+		return
+	}
+	resp := &cloudkms.TestIamPermissionsResponse{}
+	s.mu.Lock()
+	for _, p := range req.Permissions {
+		if !k.denied[p] {
+			resp.Permissions = append(resp.Permissions, p)
+		}
+	}
+	s.mu.Unlock()
+	writeJSON(w, resp)
+}
+
+// exists returns whether the location or key ring with the given name
+// exists, i.e. contains a key or a key ring created with CreateKeyRing.
+func (s *Server) exists(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.keyRings[name] {
+		return true
+	}
+	for n := range s.keyRings {
+		if strings.HasPrefix(n, name+"/") {
+			return true
+		}
+	}
+	for n := range s.keys {
+		if strings.HasPrefix(n, name+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) lookup(name string) (*cryptoKey, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	return k, ok
+}
+
+// lookupVersion returns the key and version number of the key version with
+// the given resource name.
+func (s *Server) lookupVersion(name string) (*cryptoKey, int, bool) {
+	i := strings.LastIndex(name, "/cryptoKeyVersions/")
+	if i < 0 {
+		return nil, 0, false
+	}
+	k, ok := s.lookup(name[:i])
+	if !ok {
+		return nil, 0, false
+	}
+	version, err := strconv.Atoi(name[i+len("/cryptoKeyVersions/"):])
+	if err != nil {
+		return nil, 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if version < 1 || version > len(k.versions) {
+		return nil, 0, false
+	}
+	return k, version, true
+}
+
+// versionResource returns the CryptoKeyVersion resource of the given version
+// of the key with the given name. s.mu must be held.
+func (s *Server) versionResource(keyName string, k *cryptoKey, version int) *cloudkms.CryptoKeyVersion {
+	v := k.versions[version-1]
+	return &cloudkms.CryptoKeyVersion{
+		Name:            fmt.Sprintf("%s/cryptoKeyVersions/%d", keyName, version),
+		State:           v.state,
+		ProtectionLevel: k.protectionLevel,
+		Algorithm:       k.algorithm,
+		CreateTime:      v.createTime,
+		DestroyTime:     v.destroyTime,
+	}
+}
+
+func (s *Server) encrypt(w http.ResponseWriter, r *http.Request, name string) {
+	req := new(cloudkms.EncryptRequest)
+	fields, err := decodeRequest(r, req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	// Checksums are verified if they are sent, even if they are zero.
+	plaintextChecksum := fields["plaintextCrc32c"]
+	aadChecksum := fields["additionalAuthenticatedDataCrc32c"]
+	k, ok := s.lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKey %s not found.", name))
+		return
+	}
+	if !s.checkPermission(w, name, k, "cloudkms.cryptoKeyVersions.useToEncrypt") {
+		return
+	}
+	if k.purpose != "ENCRYPT_DECRYPT" {
+		writeWrongPurpose(w, name, k.purpose, "ENCRYPT_DECRYPT")
+		return
+	}
+	plaintext, err := decodeBytes(req.Plaintext)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "invalid plaintext: "+err.Error())
+		return
+	}
+	if len(plaintext) > maxPlaintextSize {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", fmt.Sprintf("The plaintext must be at most %d bytes.", maxPlaintextSize))
+		return
+	}
+	aad, err := decodeBytes(req.AdditionalAuthenticatedData)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "invalid additional authenticated data: "+err.Error())
+		return
+	}
+	if plaintextChecksum && req.PlaintextCrc32c != checksum(plaintext) {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The checksum in field plaintext_crc32c did not match the data in field plaintext.")
+		return
+	}
+	if aadChecksum && req.AdditionalAuthenticatedDataCrc32c != checksum(aad) {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The checksum in field additional_authenticated_data_crc32c did not match the data in field additional_authenticated_data.")
+		return
+	}
+	s.mu.Lock()
+	version := len(k.versions)
+	a := k.versions[version-1].aead
+	state := k.versions[version-1].state
+	protectionLevel := k.protectionLevel
+	s.mu.Unlock()
+	if state != "ENABLED" {
+		writeVersionNotEnabled(w, name, version, state)
+		return
+	}
+	nonce := make([]byte, a.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	ciphertext := binary.BigEndian.AppendUint32(nil, uint32(version))
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = a.Seal(ciphertext, nonce, plaintext, aad)
+	writeJSON(w, &cloudkms.EncryptResponse{
+		Name:                    fmt.Sprintf("%s/cryptoKeyVersions/%d", name, version),
+		Ciphertext:              base64.StdEncoding.EncodeToString(ciphertext),
+		CiphertextCrc32c:        checksum(ciphertext),
+		ProtectionLevel:         protectionLevel,
+		VerifiedPlaintextCrc32c: plaintextChecksum,
+		VerifiedAdditionalAuthenticatedDataCrc32c: aadChecksum,
+	})
+}
+
+func (s *Server) decrypt(w http.ResponseWriter, r *http.Request, name string) {
+	req := new(cloudkms.DecryptRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	k, ok := s.lookup(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKey %s not found.", name))
+		return
+	}
+	if !s.checkPermission(w, name, k, "cloudkms.cryptoKeyVersions.useToDecrypt") {
+		return
+	}
+	if k.purpose != "ENCRYPT_DECRYPT" {
+		writeWrongPurpose(w, name, k.purpose, "ENCRYPT_DECRYPT")
+		return
+	}
+	ciphertext, err := decodeBytes(req.Ciphertext)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "invalid ciphertext: "+err.Error())
+		return
+	}
+	aad, err := decodeBytes(req.AdditionalAuthenticatedData)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "invalid additional authenticated data: "+err.Error())
+		return
+	}
+	if req.CiphertextCrc32c != 0 && req.CiphertextCrc32c != checksum(ciphertext) {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The checksum in field ciphertext_crc32c did not match the data in field ciphertext.")
+		return
+	}
+	if req.AdditionalAuthenticatedDataCrc32c != 0 && req.AdditionalAuthenticatedDataCrc32c != checksum(aad) {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The checksum in field additional_authenticated_data_crc32c did not match the data in field additional_authenticated_data.")
+		return
+	}
+	if len(ciphertext) < versionPrefixSize {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Decryption failed: the ciphertext is invalid.")
+		return
+	}
+	version := int(binary.BigEndian.Uint32(ciphertext))
+	s.mu.Lock()
+	numVersions := len(k.versions)
+	protectionLevel := k.protectionLevel
+	var a cipher.AEAD
+	var state string
+	if version >= 1 && version <= numVersions {
+		a = k.versions[version-1].aead
+		state = k.versions[version-1].state
+	}
+	s.mu.Unlock()
+	if a == nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Decryption failed: the ciphertext is invalid.")
+		return
+	}
+	if state != "ENABLED" {
+		writeVersionNotEnabled(w, name, version, state)
+		return
+	}
+	ciphertext = ciphertext[versionPrefixSize:]
+	if len(ciphertext) < a.NonceSize() {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Decryption failed: the ciphertext is invalid.")
+		return
+	}
+	plaintext, err := a.Open(nil, ciphertext[:a.NonceSize()], ciphertext[a.NonceSize():], aad)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Decryption failed: the ciphertext is invalid.")
+		return
+	}
+	writeJSON(w, &cloudkms.DecryptResponse{
+		Plaintext:       base64.StdEncoding.EncodeToString(plaintext),
+		PlaintextCrc32c: checksum(plaintext),
+		ProtectionLevel: protectionLevel,
+		UsedPrimary:     version == numVersions,
+	})
+}
+
+func (s *Server) generateRandomBytes(w http.ResponseWriter, r *http.Request, location string) {
+	req := new(cloudkms.GenerateRandomBytesRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	if segments := strings.Split(location, "/"); len(segments) != 4 || segments[0] != "projects" || segments[2] != "locations" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", fmt.Sprintf("Invalid location %s.", location))
+		return
+	}
+	if req.LengthBytes < 8 || req.LengthBytes > 1024 {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "length_bytes must be between 8 and 1024.")
+		return
+	}
+	if req.ProtectionLevel != "HSM" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "protection_level must be HSM.")
+		return
+	}
+	data := make([]byte, req.LengthBytes)
+	if _, err := rand.Read(data); err != nil {
+		writeError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	writeJSON(w, &cloudkms.GenerateRandomBytesResponse{
+		Data:       base64.StdEncoding.EncodeToString(data),
+		DataCrc32c: checksum(data),
+	})
+}
+
+func checksum(data []byte) int64 {
+	return int64(crc32.Checksum(data, crc32cTable))
+}
+
+// decodeRequest decodes the JSON body of r into req, and returns the names of
+// the fields present in the body, since fields whose value is zero cannot be
+// told apart from missing fields in req.
+func decodeRequest(r *http.Request, req any) (map[string]bool, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(body, req); err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, err
+	}
+	fields := make(map[string]bool, len(raw))
+	for name := range raw {
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// decodeBytes decodes a proto3 JSON bytes field, which may use either the
+// standard or the URL-safe base64 alphabet.
+func decodeBytes(s string) ([]byte, error) {
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return b, nil
+	}
+	return base64.URLEncoding.DecodeString(s)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeWrongPurpose writes the error that Cloud KMS returns when a request
+// is not valid for the purpose of the key.
+func writeWrongPurpose(w http.ResponseWriter, name, purpose, want string) {
+	writeError(w, http.StatusBadRequest, "FAILED_PRECONDITION",
+		fmt.Sprintf("%s has purpose %s, but the request requires purpose %s.", name, purpose, want))
+}
+
+// writeVersionNotEnabled writes the error that Cloud KMS returns when a
+// request needs a key version that is not enabled.
+func writeVersionNotEnabled(w http.ResponseWriter, name string, version int, state string) {
+	writeError(w, http.StatusBadRequest, "FAILED_PRECONDITION",
+		fmt.Sprintf("%s/cryptoKeyVersions/%d is not enabled, current state is: %s.", name, version, state))
+}
+
+func writeError(w http.ResponseWriter, code int, status, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"status":  status,
+		},
+	})
+}
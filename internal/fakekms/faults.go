@@ -0,0 +1,310 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package fakekms
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fault is a scripted fault of one call of the server.
+type Fault struct {
+	// Delay is how long the call waits before it is handled, or until the
+	// client cancels it.
+	Delay time.Duration
+	// Code, if not 0, makes the call fail with this HTTP status code and the
+	// Cloud KMS status Status, e.g. http.StatusServiceUnavailable and
+	// "UNAVAILABLE", instead of being handled.
+	Code   int
+	Status string
+	// CorruptChecksums makes the CRC32C checksums of the response, e.g.
+	// ciphertextCrc32c, wrong.
+	CorruptChecksums bool
+	// FlipVerified sets the verified fields of the response that are true,
+	// e.g. verifiedPlaintextCrc32c, to false, as if the checksums of the
+	// request had been lost in transit.
+	FlipVerified bool
+}
+
+// FaultInjector scripts faults of the calls of a Server, per RPC and per
+// resource name. Faults are consumed in the order in which they were
+// injected, so that tests are deterministic. It is safe for concurrent use.
+type FaultInjector struct {
+	mu     sync.Mutex
+	queues []*faultQueue
+	delays []*faultDelay
+}
+
+// faultQueue holds the faults that remain to be consumed by the calls that
+// match rpc and name.
+type faultQueue struct {
+	rpc, name string
+	faults    []Fault
+}
+
+// faultDelay holds the delay distribution of the calls that match rpc and
+// name.
+type faultDelay struct {
+	rpc, name string
+	delay     func() time.Duration
+}
+
+// NewFaultInjector returns a FaultInjector without faults. Use
+// Server.SetFaultInjector to apply it.
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{}
+}
+
+// matches returns true if a call of rpc on the resource name matches a fault
+// scripted for rpcPattern and namePattern. An empty pattern matches all RPCs
+// or resources, and a resource matches the names of its parents, e.g. a key
+// version matches the name of its crypto key.
+func matches(rpcPattern, namePattern, rpc, name string) bool {
+	if rpcPattern != "" && rpcPattern != rpc {
+		return false
+	}
+	return namePattern == "" || name == namePattern || strings.HasPrefix(name, namePattern+"/")
+}
+
+// Inject appends faults to the faults of the calls of rpc, e.g. "Encrypt",
+// on the resource name, e.g. the name of a crypto key. Each matching call
+// consumes the next fault, and calls are handled normally once all faults
+// are consumed. If faults injected for different RPCs or names match a call,
+// the call consumes a fault of the RPC and name that were first injected.
+func (f *FaultInjector) Inject(rpc, name string, faults ...Fault) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, q := range f.queues {
+		if q.rpc == rpc && q.name == name {
+			q.faults = append(q.faults, faults...)
+			return
+		}
+	}
+	f.queues = append(f.queues, &faultQueue{rpc: rpc, name: name, faults: append([]Fault(nil), faults...)})
+}
+
+// FailNext makes the next n calls of rpc on the resource name fail with the
+// HTTP status code and the Cloud KMS status, like Inject.
+func (f *FaultInjector) FailNext(rpc, name string, n, code int, status string) {
+	faults := make([]Fault, n)
+	for i := range faults {
+		faults[i] = Fault{Code: code, Status: status}
+	}
+	f.Inject(rpc, name, faults...)
+}
+
+// SetDelay makes every call of rpc on the resource name wait delay() before
+// it is handled, in addition to the delay of its fault, e.g. to simulate the
+// latency distribution of Cloud KMS with UniformDelay. delay is called
+// concurrently and may be nil to remove the delay. If delays set for
+// different RPCs or names match a call, the delay that was set first is
+// used.
+func (f *FaultInjector) SetDelay(rpc, name string, delay func() time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, d := range f.delays {
+		if d.rpc == rpc && d.name == name {
+			if delay == nil {
+				f.delays = append(f.delays[:i], f.delays[i+1:]...)
+			} else {
+				d.delay = delay
+			}
+			return
+		}
+	}
+	if delay != nil {
+		f.delays = append(f.delays, &faultDelay{rpc: rpc, name: name, delay: delay})
+	}
+}
+
+// Pending returns the number of faults injected for rpc and name that have
+// not been consumed yet.
+func (f *FaultInjector) Pending(rpc, name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, q := range f.queues {
+		if q.rpc == rpc && q.name == name {
+			return len(q.faults)
+		}
+	}
+	return 0
+}
+
+// next consumes the fault of a call of rpc on the resource name, and adds the
+// delay set with SetDelay. It returns false if the call is not faulty.
+func (f *FaultInjector) next(rpc, name string) (Fault, bool) {
+	f.mu.Lock()
+	var fault Fault
+	found := false
+	for _, q := range f.queues {
+		if len(q.faults) > 0 && matches(q.rpc, q.name, rpc, name) {
+			fault, found = q.faults[0], true
+			q.faults = q.faults[1:]
+			break
+		}
+	}
+	var delay func() time.Duration
+	for _, d := range f.delays {
+		if matches(d.rpc, d.name, rpc, name) {
+			delay = d.delay
+			break
+		}
+	}
+	f.mu.Unlock()
+	if delay != nil {
+		fault.Delay += delay()
+		found = true
+	}
+	return fault, found
+}
+
+// UniformDelay returns a delay distribution for SetDelay that is uniform
+// between min and max, which must not be less than min. The sequence of
+// delays is determined by seed.
+func UniformDelay(min, max time.Duration, seed int64) func() time.Duration {
+	var mu sync.Mutex
+	r := rand.New(rand.NewSource(seed))
+	return func() time.Duration {
+		mu.Lock()
+		defer mu.Unlock()
+		return min + time.Duration(r.Int63n(int64(max-min)+1))
+	}
+}
+
+// SetFaultInjector applies the faults of f to all subsequent calls of the
+// server. f may be nil to stop injecting faults.
+func (s *Server) SetFaultInjector(f *FaultInjector) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults = f
+}
+
+// injectFault applies the next fault of a call of rpc on the resource name.
+// It returns false if the call must not be handled, because it failed or was
+// canceled while delayed.
+func (s *Server) injectFault(w *responseWriter, r *http.Request, rpc, name string) bool {
+	s.mu.Lock()
+	faults := s.faults
+	s.mu.Unlock()
+	if faults == nil {
+		return true
+	}
+	fault, ok := faults.next(rpc, name)
+	if !ok {
+		return true
+	}
+	if fault.Delay > 0 {
+		// The server only notices that the client canceled the call once the
+		// request body has been read, so it is read before waiting.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return false
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		t := time.NewTimer(fault.Delay)
+		defer t.Stop()
+		select {
+		case <-t.C:
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	if fault.Code != 0 {
+		writeError(w, fault.Code, fault.Status, "Injected fault.")
+		return false
+	}
+	if fault.CorruptChecksums || fault.FlipVerified {
+		w.rewrite = &fault
+	}
+	return true
+}
+
+// responseWriter buffers the response of a call if a fault rewrites it.
+type responseWriter struct {
+	http.ResponseWriter
+	// rewrite is nil unless the response is rewritten.
+	rewrite *Fault
+	code    int
+	body    bytes.Buffer
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.rewrite == nil {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.rewrite == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	return w.body.Write(b)
+}
+
+// flush writes the buffered response, rewritten as set by the fault if the
+// call succeeded.
+func (w *responseWriter) flush() {
+	if w.rewrite == nil {
+		return
+	}
+	body := w.body.Bytes()
+	if w.code == 0 || w.code == http.StatusOK {
+		body = rewriteResponse(body, *w.rewrite)
+	}
+	if w.code != 0 {
+		w.ResponseWriter.WriteHeader(w.code)
+	}
+	w.ResponseWriter.Write(body)
+}
+
+// rewriteResponse applies fault to the top-level fields of the JSON response
+// body. Bodies that are not JSON objects are returned unchanged.
+func rewriteResponse(body []byte, fault Fault) []byte {
+	var resp map[string]any
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return body
+	}
+	for name, value := range resp {
+		switch {
+		case fault.CorruptChecksums && strings.HasSuffix(name, "Crc32c"):
+			// int64 fields are encoded as strings.
+			if s, ok := value.(string); ok {
+				if crc, err := strconv.ParseInt(s, 10, 64); err == nil {
+					resp[name] = strconv.FormatInt(crc^1, 10)
+				}
+			}
+		case fault.FlipVerified && strings.HasPrefix(name, "verified"):
+			if value == true {
+				resp[name] = false
+			}
+		}
+	}
+	rewritten, err := json.Marshal(resp)
+	if err != nil {
+		return body
+	}
+	return append(rewritten, '\n')
+}
@@ -0,0 +1,137 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package fakekms
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/cloudkms/v1"
+
+	// Register the hash functions used by Cloud KMS HMAC algorithms.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// macAlgorithms maps the supported Cloud KMS HMAC algorithms to their hash
+// functions.
+var macAlgorithms = map[string]crypto.Hash{
+	"HMAC_SHA1":   crypto.SHA1,
+	"HMAC_SHA224": crypto.SHA224,
+	"HMAC_SHA256": crypto.SHA256,
+	"HMAC_SHA384": crypto.SHA384,
+	"HMAC_SHA512": crypto.SHA512,
+}
+
+func newMACKey(algorithm string) ([]byte, error) {
+	hash, ok := macAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("unsupported algorithm %q", algorithm)
+	}
+	k := make([]byte, hash.Size())
+	if _, err := rand.Read(k); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// CreateMACKey creates a MAC key with one version under the given resource
+// name, using the given Cloud KMS algorithm, e.g. "HMAC_SHA256".
+func (s *Server) CreateMACKey(name, algorithm string) error {
+	k, err := newMACKey(algorithm)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[name]; ok {
+		return fmt.Errorf("key %q already exists", name)
+	}
+	s.keys[name] = &cryptoKey{
+		purpose:         "MAC",
+		algorithm:       algorithm,
+		versions:        []*keyVersion{{macKey: k, state: "ENABLED", createTime: now()}},
+		protectionLevel: "SOFTWARE",
+	}
+	return nil
+}
+
+// MAC returns the MAC of data under the given version of the MAC key with
+// the given resource name, so that tests can check the output of MacSign.
+func (s *Server) MAC(name string, version int, data []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k, ok := s.keys[name]
+	if !ok || k.purpose != "MAC" || version < 1 || version > len(k.versions) {
+		return nil, fmt.Errorf("MAC key version %s/cryptoKeyVersions/%d not found", name, version)
+	}
+	mac := hmac.New(macAlgorithms[k.algorithm].New, k.versions[version-1].macKey)
+	mac.Write(data)
+	return mac.Sum(nil), nil
+}
+
+func (s *Server) macSign(w http.ResponseWriter, r *http.Request, name string) {
+	req := new(cloudkms.MacSignRequest)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	k, version, ok := s.lookupVersion(name)
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", fmt.Sprintf("CryptoKeyVersion %s not found.", name))
+		return
+	}
+	keyName := name[:strings.LastIndex(name, "/cryptoKeyVersions/")]
+	if k.purpose != "MAC" {
+		writeWrongPurpose(w, keyName, k.purpose, "MAC")
+		return
+	}
+	s.mu.Lock()
+	v := k.versions[version-1]
+	state, key, hash := v.state, v.macKey, macAlgorithms[k.algorithm]
+	s.mu.Unlock()
+	if state != "ENABLED" {
+		writeVersionNotEnabled(w, keyName, version, state)
+		return
+	}
+	data, err := decodeBytes(req.Data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	if req.DataCrc32c != 0 && req.DataCrc32c != checksum(data) {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The checksum in field data_crc32c did not match the data in field data.")
+		return
+	}
+	mac := hmac.New(hash.New, key)
+	mac.Write(data)
+	tag := mac.Sum(nil)
+	writeJSON(w, &cloudkms.MacSignResponse{
+		Name:               name,
+		Mac:                base64.StdEncoding.EncodeToString(tag),
+		MacCrc32c:          checksum(tag),
+		VerifiedDataCrc32c: req.DataCrc32c != 0,
+		ProtectionLevel:    k.protectionLevel,
+	})
+}
@@ -0,0 +1,327 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Package keysetcli implements the gcpkms-keyset command, which manages Tink
+// keysets encrypted with a GCP Cloud KMS key.
+package keysetcli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/protobuf/encoding/protojson"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/daead"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	"github.com/tink-crypto/tink-go/v2/mac"
+	"github.com/tink-crypto/tink-go/v2/tink"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+const (
+	formatJSON   = "json"
+	formatBinary = "binary"
+
+	defaultDEKTemplate = "AES256_GCM"
+)
+
+var dekTemplates = map[string]func() *tinkpb.KeyTemplate{
+	"AES128_GCM":             aead.AES128GCMKeyTemplate,
+	"AES256_GCM":             aead.AES256GCMKeyTemplate,
+	"AES256_GCM_RAW":         aead.AES256GCMNoPrefixKeyTemplate,
+	"AES128_GCM_SIV":         aead.AES128GCMSIVKeyTemplate,
+	"AES256_GCM_SIV":         aead.AES256GCMSIVKeyTemplate,
+	"AES128_CTR_HMAC_SHA256": aead.AES128CTRHMACSHA256KeyTemplate,
+	"AES256_CTR_HMAC_SHA256": aead.AES256CTRHMACSHA256KeyTemplate,
+	"CHACHA20_POLY1305":      aead.ChaCha20Poly1305KeyTemplate,
+	"XCHACHA20_POLY1305":     aead.XChaCha20Poly1305KeyTemplate,
+	"AES256_SIV":             daead.AESSIVKeyTemplate,
+	"HMAC_SHA256_256BITTAG":  mac.HMACSHA256Tag256KeyTemplate,
+}
+
+// Command holds the environment the gcpkms-keyset command runs in.
+type Command struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// ClientOptions are passed to the GCP KMS client in addition to the
+	// options derived from the command line flags.
+	ClientOptions []option.ClientOption
+	// Options configure the GCP KMS client, e.g. with
+	// gcpkms.WithInsecureTransport to talk to a fake server.
+	Options []gcpkms.Option
+}
+
+// Run parses args, which must not include the program name, and executes the
+// selected subcommand.
+func (c *Command) Run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		c.usage()
+		return errors.New("no subcommand given")
+	}
+	switch args[0] {
+	case "create-keyset":
+		return c.createKeyset(ctx, args[1:])
+	case "rotate":
+		return c.rotate(ctx, args[1:])
+	case "inspect":
+		return c.inspect(ctx, args[1:])
+	case "convert":
+		return c.convert(ctx, args[1:])
+	case "help", "-h", "-help", "--help":
+		c.usage()
+		return nil
+	default:
+		c.usage()
+		return fmt.Errorf("unknown subcommand %q", args[0])
+	}
+}
+
+func (c *Command) usage() {
+	names := make([]string, 0, len(dekTemplates))
+	for n := range dekTemplates {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(c.Stderr, `Usage: gcpkms-keyset <subcommand> [flags]
+
+Subcommands:
+  create-keyset  Create a new keyset encrypted with --kek-uri.
+  rotate         Add a new primary key to an encrypted keyset.
+  inspect        Print the keyset info of an encrypted keyset.
+  convert        Re-encode an encrypted keyset in a different format.
+
+Supported --dek-template values:
+  %s
+`, strings.Join(names, "\n  "))
+}
+
+// commonFlags are the flags shared by all subcommands.
+type commonFlags struct {
+	kekURI      string
+	credentials string
+	inPath      string
+	inFormat    string
+	outPath     string
+	outFormat   string
+}
+
+func (c *Command) newFlagSet(name string, f *commonFlags, withIn, withOut bool) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.Stderr)
+	fs.StringVar(&f.kekURI, "kek-uri", "", "URI of the GCP KMS key encrypting the keyset, e.g. gcp-kms://projects/*/locations/*/keyRings/*/cryptoKeys/*")
+	fs.StringVar(&f.credentials, "credentials", "", "path to a GCP credentials JSON file; application default credentials are used if empty")
+	if withIn {
+		fs.StringVar(&f.inPath, "in", "-", "input keyset file, or - for stdin")
+		fs.StringVar(&f.inFormat, "in-format", formatJSON, "input keyset encoding: json or binary")
+	}
+	if withOut {
+		fs.StringVar(&f.outPath, "out", "-", "output keyset file, or - for stdout")
+		fs.StringVar(&f.outFormat, "out-format", formatJSON, "output keyset encoding: json or binary")
+	}
+	return fs
+}
+
+func (c *Command) parse(fs *flag.FlagSet, f *commonFlags, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments: %v", fs.Args())
+	}
+	if f.kekURI == "" {
+		return errors.New("--kek-uri is required")
+	}
+	for _, format := range []string{f.inFormat, f.outFormat} {
+		if format != "" && format != formatJSON && format != formatBinary {
+			return fmt.Errorf("unknown keyset format %q", format)
+		}
+	}
+	return nil
+}
+
+func (c *Command) createKeyset(ctx context.Context, args []string) error {
+	f := &commonFlags{}
+	fs := c.newFlagSet("create-keyset", f, false, true)
+	dekTemplate := fs.String("dek-template", defaultDEKTemplate, "template of the key to generate")
+	if err := c.parse(fs, f, args); err != nil {
+		return err
+	}
+	template, err := lookupTemplate(*dekTemplate)
+	if err != nil {
+		return err
+	}
+	kek, err := c.kekAEAD(ctx, f)
+	if err != nil {
+		return err
+	}
+	handle, err := keyset.NewHandle(template)
+	if err != nil {
+		return fmt.Errorf("keyset.NewHandle() failed: %v", err)
+	}
+	return c.writeKeyset(handle, kek, f)
+}
+
+func (c *Command) rotate(ctx context.Context, args []string) error {
+	f := &commonFlags{}
+	fs := c.newFlagSet("rotate", f, true, true)
+	dekTemplate := fs.String("dek-template", defaultDEKTemplate, "template of the new primary key")
+	if err := c.parse(fs, f, args); err != nil {
+		return err
+	}
+	template, err := lookupTemplate(*dekTemplate)
+	if err != nil {
+		return err
+	}
+	kek, err := c.kekAEAD(ctx, f)
+	if err != nil {
+		return err
+	}
+	handle, err := c.readKeyset(kek, f)
+	if err != nil {
+		return err
+	}
+	m := keyset.NewManagerFromHandle(handle)
+	id, err := m.Add(template)
+	if err != nil {
+		return fmt.Errorf("adding key failed: %v", err)
+	}
+	if err := m.SetPrimary(id); err != nil {
+		return fmt.Errorf("setting primary key failed: %v", err)
+	}
+	rotated, err := m.Handle()
+	if err != nil {
+		return err
+	}
+	return c.writeKeyset(rotated, kek, f)
+}
+
+func (c *Command) inspect(ctx context.Context, args []string) error {
+	f := &commonFlags{}
+	fs := c.newFlagSet("inspect", f, true, false)
+	if err := c.parse(fs, f, args); err != nil {
+		return err
+	}
+	kek, err := c.kekAEAD(ctx, f)
+	if err != nil {
+		return err
+	}
+	handle, err := c.readKeyset(kek, f)
+	if err != nil {
+		return err
+	}
+	b, err := protojson.MarshalOptions{Multiline: true}.Marshal(handle.KeysetInfo())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(c.Stdout, string(b))
+	return err
+}
+
+func (c *Command) convert(ctx context.Context, args []string) error {
+	f := &commonFlags{}
+	fs := c.newFlagSet("convert", f, true, true)
+	if err := c.parse(fs, f, args); err != nil {
+		return err
+	}
+	kek, err := c.kekAEAD(ctx, f)
+	if err != nil {
+		return err
+	}
+	handle, err := c.readKeyset(kek, f)
+	if err != nil {
+		return err
+	}
+	return c.writeKeyset(handle, kek, f)
+}
+
+func lookupTemplate(name string) (*tinkpb.KeyTemplate, error) {
+	t, ok := dekTemplates[strings.ToUpper(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown --dek-template %q", name)
+	}
+	return t(), nil
+}
+
+func (c *Command) kekAEAD(ctx context.Context, f *commonFlags) (tink.AEAD, error) {
+	opts := append([]option.ClientOption(nil), c.ClientOptions...)
+	if f.credentials != "" {
+		opts = append(opts, option.WithCredentialsFile(f.credentials))
+	}
+	client, err := gcpkms.NewClient(ctx, f.kekURI, append([]gcpkms.Option{gcpkms.WithGoogleAPIClientOptions(opts...)}, c.Options...)...)
+	if err != nil {
+		return nil, fmt.Errorf("creating GCP KMS client failed: %v", err)
+	}
+	return client.GetAEAD(f.kekURI)
+}
+
+func (c *Command) readKeyset(kek tink.AEAD, f *commonFlags) (*keyset.Handle, error) {
+	var r io.Reader = c.Stdin
+	if f.inPath != "-" {
+		file, err := os.Open(f.inPath)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+	var reader keyset.Reader
+	if f.inFormat == formatBinary {
+		reader = keyset.NewBinaryReader(r)
+	} else {
+		reader = keyset.NewJSONReader(r)
+	}
+	handle, err := keyset.Read(reader, kek)
+	if err != nil {
+		return nil, fmt.Errorf("reading keyset failed: %v", err)
+	}
+	return handle, nil
+}
+
+func (c *Command) writeKeyset(handle *keyset.Handle, kek tink.AEAD, f *commonFlags) (err error) {
+	w := c.Stdout
+	if f.outPath != "-" {
+		file, err := os.OpenFile(f.outPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if cerr := file.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = file
+	}
+	var writer keyset.Writer
+	if f.outFormat == formatBinary {
+		writer = keyset.NewBinaryWriter(w)
+	} else {
+		writer = keyset.NewJSONWriter(w)
+	}
+	if err := handle.Write(writer, kek); err != nil {
+		return fmt.Errorf("writing keyset failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package keysetcli_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/integration/gcpkms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/keysetcli"
+	"github.com/tink-crypto/tink-go/v2/aead"
+	"github.com/tink-crypto/tink-go/v2/keyset"
+	tinkpb "github.com/tink-crypto/tink-go/v2/proto/tink_go_proto"
+)
+
+const (
+	keyName = "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	kekURI  = "gcp-kms://" + keyName
+)
+
+func newCommand(t *testing.T, srv *fakekms.Server, stdin []byte) (*keysetcli.Command, *bytes.Buffer) {
+	t.Helper()
+	stdout := &bytes.Buffer{}
+	return &keysetcli.Command{
+		Stdin:         bytes.NewReader(stdin),
+		Stdout:        stdout,
+		Stderr:        &bytes.Buffer{},
+		ClientOptions: srv.ClientOptions(),
+		Options:       []gcpkms.Option{gcpkms.WithInsecureTransport()},
+	}, stdout
+}
+
+func newServer(t *testing.T) *fakekms.Server {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	if err := srv.CreateKey(keyName); err != nil {
+		t.Fatalf("srv.CreateKey() err = %v, want nil", err)
+	}
+	return srv
+}
+
+func readKeyset(t *testing.T, srv *fakekms.Server, b []byte, binary bool) *keyset.Handle {
+	t.Helper()
+	client, err := gcpkms.NewClient(context.Background(), kekURI,
+		gcpkms.WithGoogleAPIClientOptions(srv.ClientOptions()...), gcpkms.WithInsecureTransport())
+	if err != nil {
+		t.Fatalf("gcpkms.NewClient() err = %v, want nil", err)
+	}
+	kek, err := client.GetAEAD(kekURI)
+	if err != nil {
+		t.Fatalf("client.GetAEAD() err = %v, want nil", err)
+	}
+	var r keyset.Reader = keyset.NewJSONReader(bytes.NewReader(b))
+	if binary {
+		r = keyset.NewBinaryReader(bytes.NewReader(b))
+	}
+	h, err := keyset.Read(r, kek)
+	if err != nil {
+		t.Fatalf("keyset.Read() err = %v, want nil", err)
+	}
+	return h
+}
+
+func TestCreateRotateInspect(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t)
+
+	c, stdout := newCommand(t, srv, nil)
+	if err := c.Run(ctx, []string{"create-keyset", "--kek-uri", kekURI, "--dek-template", "AES128_GCM"}); err != nil {
+		t.Fatalf("create-keyset err = %v, want nil", err)
+	}
+	created := stdout.Bytes()
+	h := readKeyset(t, srv, created, false)
+	if got := len(h.KeysetInfo().GetKeyInfo()); got != 1 {
+		t.Errorf("len(KeyInfo) = %d, want 1", got)
+	}
+	a, err := aead.New(h)
+	if err != nil {
+		t.Fatalf("aead.New() err = %v, want nil", err)
+	}
+	ciphertext, err := a.Encrypt([]byte("plaintext"), []byte("ad"))
+	if err != nil {
+		t.Fatalf("a.Encrypt() err = %v, want nil", err)
+	}
+
+	c, stdout = newCommand(t, srv, created)
+	if err := c.Run(ctx, []string{"rotate", "--kek-uri", kekURI, "--dek-template", "AES256_GCM"}); err != nil {
+		t.Fatalf("rotate err = %v, want nil", err)
+	}
+	rotated := stdout.Bytes()
+	rh := readKeyset(t, srv, rotated, false)
+	info := rh.KeysetInfo()
+	if got := len(info.GetKeyInfo()); got != 2 {
+		t.Fatalf("len(KeyInfo) = %d, want 2", got)
+	}
+	if info.GetPrimaryKeyId() == h.KeysetInfo().GetPrimaryKeyId() {
+		t.Errorf("primary key ID did not change after rotation")
+	}
+	ra, err := aead.New(rh)
+	if err != nil {
+		t.Fatalf("aead.New() err = %v, want nil", err)
+	}
+	if _, err := ra.Decrypt(ciphertext, []byte("ad")); err != nil {
+		t.Errorf("ra.Decrypt() of ciphertext from the old primary err = %v, want nil", err)
+	}
+
+	c, stdout = newCommand(t, srv, rotated)
+	if err := c.Run(ctx, []string{"inspect", "--kek-uri", kekURI}); err != nil {
+		t.Fatalf("inspect err = %v, want nil", err)
+	}
+	got := &tinkpb.KeysetInfo{}
+	if err := protojson.Unmarshal(stdout.Bytes(), got); err != nil {
+		t.Fatalf("protojson.Unmarshal() err = %v, want nil", err)
+	}
+	if got.GetPrimaryKeyId() != info.GetPrimaryKeyId() || len(got.GetKeyInfo()) != 2 {
+		t.Errorf("inspect = %v, want %v", got, info)
+	}
+	if strings.Contains(stdout.String(), "keyMaterial") {
+		t.Errorf("inspect output contains key material: %s", stdout)
+	}
+}
+
+func TestConvertBetweenFormats(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t)
+	dir := t.TempDir()
+	binPath := filepath.Join(dir, "keyset.bin")
+	jsonPath := filepath.Join(dir, "keyset.json")
+
+	c, _ := newCommand(t, srv, nil)
+	if err := c.Run(ctx, []string{"create-keyset", "--kek-uri", kekURI, "--out", binPath, "--out-format", "binary"}); err != nil {
+		t.Fatalf("create-keyset err = %v, want nil", err)
+	}
+	c, _ = newCommand(t, srv, nil)
+	if err := c.Run(ctx, []string{"convert", "--kek-uri", kekURI, "--in", binPath, "--in-format", "binary", "--out", jsonPath}); err != nil {
+		t.Fatalf("convert err = %v, want nil", err)
+	}
+	c, stdout := newCommand(t, srv, nil)
+	if err := c.Run(ctx, []string{"convert", "--kek-uri", kekURI, "--in", jsonPath, "--out-format", "binary"}); err != nil {
+		t.Fatalf("convert err = %v, want nil", err)
+	}
+	h := readKeyset(t, srv, stdout.Bytes(), true)
+	if got := len(h.KeysetInfo().GetKeyInfo()); got != 1 {
+		t.Errorf("len(KeyInfo) = %d, want 1", got)
+	}
+}
+
+func TestRunFailures(t *testing.T) {
+	ctx := context.Background()
+	srv := newServer(t)
+	for _, tc := range []struct {
+		name  string
+		args  []string
+		stdin []byte
+	}{
+		{name: "no subcommand", args: nil},
+		{name: "unknown subcommand", args: []string{"delete"}},
+		{name: "missing kek uri", args: []string{"create-keyset"}},
+		{name: "unknown template", args: []string{"create-keyset", "--kek-uri", kekURI, "--dek-template", "AES42"}},
+		{name: "unknown format", args: []string{"create-keyset", "--kek-uri", kekURI, "--out-format", "xml"}},
+		{name: "invalid kek uri", args: []string{"create-keyset", "--kek-uri", "aws-kms://key"}},
+		{name: "unknown key", args: []string{"create-keyset", "--kek-uri", kekURI + "2"}},
+		{name: "invalid keyset", args: []string{"inspect", "--kek-uri", kekURI}, stdin: []byte("{}")},
+		{name: "extra arguments", args: []string{"inspect", "--kek-uri", kekURI, "extra"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := newCommand(t, srv, tc.stdin)
+			if err := c.Run(ctx, tc.args); err == nil {
+				t.Errorf("Run(%q) err = nil, want error", tc.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,350 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+// Package kmstest provisions the Cloud KMS keys that the integration tests
+// need, so that they can run against any project.
+//
+// Cloud KMS never deletes key rings and keys, so Provision reuses the keys of
+// a dedicated key ring across runs, and only creates the key versions that
+// are missing. Keys.Cleanup schedules the destruction of the versions that
+// Provision created, which are the only resources that are billed.
+package kmstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/cloudkms/v1"
+	"google.golang.org/api/googleapi"
+)
+
+// DefaultKeyRing is the ID of the key ring that Provision uses if
+// Options.KeyRing is empty.
+const DefaultKeyRing = "tink-go-gcpkms-integration"
+
+// pollInterval is how often Provision checks whether a key version that is
+// being generated is enabled.
+const pollInterval = time.Second
+
+// KeySpec describes a crypto key of the key ring.
+type KeySpec struct {
+	// ID is the crypto key ID, e.g. "aead".
+	ID string
+	// Purpose is the purpose of the key, e.g. "ENCRYPT_DECRYPT".
+	Purpose string
+	// Algorithm is the algorithm of the versions of the key, e.g.
+	// "EC_SIGN_P256_SHA256".
+	Algorithm string
+}
+
+// signAlgorithms are the Cloud KMS signing algorithms that gcpkms.Signer
+// supports.
+var signAlgorithms = []string{
+	"EC_SIGN_P256_SHA256",
+	"EC_SIGN_P384_SHA384",
+	"RSA_SIGN_PKCS1_2048_SHA256",
+	"RSA_SIGN_PKCS1_3072_SHA256",
+	"RSA_SIGN_PKCS1_4096_SHA256",
+	"RSA_SIGN_PKCS1_4096_SHA512",
+	"RSA_SIGN_PSS_2048_SHA256",
+	"RSA_SIGN_PSS_3072_SHA256",
+	"RSA_SIGN_PSS_4096_SHA256",
+	"RSA_SIGN_PSS_4096_SHA512",
+}
+
+// Matrix returns the keys that the integration tests need: the symmetric
+// encryption key "aead", a signing key for each supported algorithm, whose
+// ID is the lowercase algorithm with dashes, e.g. "ec-sign-p256-sha256", and
+// the MAC key "hmac-sha256".
+func Matrix() []KeySpec {
+	keys := []KeySpec{{ID: "aead", Purpose: "ENCRYPT_DECRYPT", Algorithm: "GOOGLE_SYMMETRIC_ENCRYPTION"}}
+	for _, alg := range signAlgorithms {
+		keys = append(keys, KeySpec{ID: SigningKeyID(alg), Purpose: "ASYMMETRIC_SIGN", Algorithm: alg})
+	}
+	return append(keys, KeySpec{ID: "hmac-sha256", Purpose: "MAC", Algorithm: "HMAC_SHA256"})
+}
+
+// SigningKeyID returns the ID of the signing key of Matrix with the given
+// algorithm.
+func SigningKeyID(algorithm string) string {
+	return strings.ToLower(strings.ReplaceAll(algorithm, "_", "-"))
+}
+
+// Options configures Provision.
+type Options struct {
+	// Project is the ID of the Google Cloud project. It is required.
+	Project string
+	// Location is the location of the key ring, "global" if empty.
+	Location string
+	// KeyRing is the ID of the key ring, DefaultKeyRing if empty.
+	KeyRing string
+	// Keys are the keys to provision, Matrix() if nil.
+	Keys []KeySpec
+	// DryRun only logs what would be created. The returned Keys hold the URIs
+	// that the keys would have, and the versions that already exist.
+	DryRun bool
+	// Logf logs the resources that are created, or would be created with
+	// DryRun. It defaults to discarding the messages.
+	Logf func(format string, args ...any)
+}
+
+// Keys are the provisioned keys.
+type Keys struct {
+	// KeyRing is the resource name of the key ring.
+	KeyRing string
+	// URIs maps the ID of each key to its URI, e.g.
+	// "gcp-kms://projects/p/locations/global/keyRings/r/cryptoKeys/aead".
+	URIs map[string]string
+	// Versions maps the ID of each key to the resource name of an enabled
+	// version: the primary version of symmetric keys, and the newest enabled
+	// version of other keys.
+	Versions map[string]string
+	// Created holds the resource names of the key versions that Provision
+	// created, and that Cleanup destroys.
+	Created []string
+
+	logf func(format string, args ...any)
+}
+
+// Provision idempotently creates the key ring and keys of opts, and an
+// enabled version of each key that has none. Keys that already exist must
+// have the purpose and algorithm of their KeySpec.
+//
+// On error, the returned Keys hold the versions created so far, so that the
+// caller can still destroy them with Cleanup.
+func Provision(ctx context.Context, kms *cloudkms.Service, opts Options) (*Keys, error) {
+	if opts.Project == "" {
+		return nil, errors.New("kmstest: Project is required")
+	}
+	location, keyRingID, specs := opts.Location, opts.KeyRing, opts.Keys
+	if location == "" {
+		location = "global"
+	}
+	if keyRingID == "" {
+		keyRingID = DefaultKeyRing
+	}
+	if specs == nil {
+		specs = Matrix()
+	}
+	logf := opts.Logf
+	if logf == nil {
+		logf = func(string, ...any) {}
+	}
+	parent := fmt.Sprintf("projects/%s/locations/%s", opts.Project, location)
+	keys := &Keys{
+		KeyRing:  parent + "/keyRings/" + keyRingID,
+		URIs:     make(map[string]string, len(specs)),
+		Versions: make(map[string]string, len(specs)),
+		logf:     logf,
+	}
+	p := &provisioner{kms: kms, dryRun: opts.DryRun, logf: logf, keys: keys}
+	keyRingExists, err := p.keyRing(ctx, parent, keyRingID)
+	if err != nil {
+		return keys, err
+	}
+	for _, spec := range specs {
+		name := keys.KeyRing + "/cryptoKeys/" + spec.ID
+		keys.URIs[spec.ID] = "gcp-kms://" + name
+		if !keyRingExists {
+			logf("kmstest: would create key %s (%s, %s)", name, spec.Purpose, spec.Algorithm)
+			continue
+		}
+		version, err := p.key(ctx, name, spec)
+		if err != nil {
+			return keys, fmt.Errorf("kmstest: provisioning key %s failed: %w", name, err)
+		}
+		if version != "" {
+			keys.Versions[spec.ID] = version
+		}
+	}
+	return keys, nil
+}
+
+// provisioner holds the state of a call of Provision.
+type provisioner struct {
+	kms    *cloudkms.Service
+	dryRun bool
+	logf   func(format string, args ...any)
+	keys   *Keys
+}
+
+// keyRing creates the key ring with the given ID if it does not exist, and
+// returns whether it exists, which is only false with DryRun.
+func (p *provisioner) keyRing(ctx context.Context, parent, id string) (bool, error) {
+	name := parent + "/keyRings/" + id
+	_, err := p.kms.Projects.Locations.KeyRings.Get(name).Context(ctx).Do()
+	if err == nil {
+		return true, nil
+	}
+	if !hasCode(err, http.StatusNotFound) {
+		return false, fmt.Errorf("kmstest: getting key ring %s failed: %w", name, err)
+	}
+	if p.dryRun {
+		p.logf("kmstest: would create key ring %s", name)
+		return false, nil
+	}
+	p.logf("kmstest: creating key ring %s", name)
+	_, err = p.kms.Projects.Locations.KeyRings.Create(parent, &cloudkms.KeyRing{}).KeyRingId(id).Context(ctx).Do()
+	// The key ring may have been created concurrently, e.g. by the tests of
+	// another package.
+	if err != nil && !hasCode(err, http.StatusConflict) {
+		return false, fmt.Errorf("kmstest: creating key ring %s failed: %w", name, err)
+	}
+	return true, nil
+}
+
+// key creates the key with the given name if it does not exist, and a version
+// if it has no enabled version. It returns the name of an enabled version,
+// which is only empty with DryRun.
+func (p *provisioner) key(ctx context.Context, name string, spec KeySpec) (string, error) {
+	keys := p.kms.Projects.Locations.KeyRings.CryptoKeys
+	key, err := keys.Get(name).Context(ctx).Do()
+	if hasCode(err, http.StatusNotFound) {
+		if p.dryRun {
+			p.logf("kmstest: would create key %s (%s, %s)", name, spec.Purpose, spec.Algorithm)
+			return "", nil
+		}
+		p.logf("kmstest: creating key %s (%s, %s)", name, spec.Purpose, spec.Algorithm)
+		i := strings.LastIndex(name, "/cryptoKeys/")
+		key, err = keys.Create(name[:i], &cloudkms.CryptoKey{
+			Purpose: spec.Purpose,
+			VersionTemplate: &cloudkms.CryptoKeyVersionTemplate{
+				Algorithm:       spec.Algorithm,
+				ProtectionLevel: "SOFTWARE",
+			},
+		}).CryptoKeyId(spec.ID).Context(ctx).Do()
+		if hasCode(err, http.StatusConflict) {
+			key, err = keys.Get(name).Context(ctx).Do()
+		} else if err == nil {
+			version := name + "/cryptoKeyVersions/1"
+			p.keys.Created = append(p.keys.Created, version)
+			return version, p.waitEnabled(ctx, version)
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	var algorithm string
+	if key.VersionTemplate != nil {
+		algorithm = key.VersionTemplate.Algorithm
+	}
+	if key.Purpose != spec.Purpose || algorithm != spec.Algorithm {
+		return "", fmt.Errorf("key has purpose %s and algorithm %s, want %s and %s; use another key ring", key.Purpose, algorithm, spec.Purpose, spec.Algorithm)
+	}
+
+	version, err := p.enabledVersion(ctx, key)
+	if err != nil || version != "" {
+		return version, err
+	}
+	if p.dryRun {
+		p.logf("kmstest: would create a version of key %s", name)
+		return "", nil
+	}
+	p.logf("kmstest: creating a version of key %s", name)
+	v, err := keys.CryptoKeyVersions.Create(name, &cloudkms.CryptoKeyVersion{}).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	p.keys.Created = append(p.keys.Created, v.Name)
+	if err := p.waitEnabled(ctx, v.Name); err != nil {
+		return "", err
+	}
+	if spec.Purpose == "ENCRYPT_DECRYPT" {
+		id := v.Name[strings.LastIndex(v.Name, "/")+1:]
+		if _, err := keys.UpdatePrimaryVersion(name, &cloudkms.UpdateCryptoKeyPrimaryVersionRequest{CryptoKeyVersionId: id}).Context(ctx).Do(); err != nil {
+			return "", err
+		}
+	}
+	return v.Name, nil
+}
+
+// enabledVersion returns the name of the enabled primary version of a
+// symmetric key, or of the newest enabled version of other keys, or "" if
+// there is none.
+func (p *provisioner) enabledVersion(ctx context.Context, key *cloudkms.CryptoKey) (string, error) {
+	if key.Purpose == "ENCRYPT_DECRYPT" {
+		if key.Primary != nil && key.Primary.State == "ENABLED" {
+			return key.Primary.Name, nil
+		}
+		return "", nil
+	}
+	var newest *cloudkms.CryptoKeyVersion
+	err := p.kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.List(key.Name).Filter("state=ENABLED").Pages(ctx, func(resp *cloudkms.ListCryptoKeyVersionsResponse) error {
+		for _, v := range resp.CryptoKeyVersions {
+			if newest == nil || v.CreateTime > newest.CreateTime {
+				newest = v
+			}
+		}
+		return nil
+	})
+	if err != nil || newest == nil {
+		return "", err
+	}
+	return newest.Name, nil
+}
+
+// waitEnabled waits until the key version with the given name is enabled.
+// Versions of asymmetric keys are generated asynchronously.
+func (p *provisioner) waitEnabled(ctx context.Context, name string) error {
+	for {
+		v, err := p.kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.Get(name).Context(ctx).Do()
+		if err != nil {
+			return err
+		}
+		switch v.State {
+		case "ENABLED":
+			return nil
+		case "PENDING_GENERATION":
+		default:
+			return fmt.Errorf("key version %s is in state %s, want ENABLED", name, v.State)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// Cleanup schedules the destruction of the key versions that Provision
+// created. Cloud KMS destroys them after the scheduled destruction duration
+// of their key, 30 days by default, and the key versions can be restored
+// until then.
+func (k *Keys) Cleanup(ctx context.Context, kms *cloudkms.Service) error {
+	var errs []error
+	for _, name := range k.Created {
+		if k.logf != nil {
+			k.logf("kmstest: destroying key version %s", name)
+		}
+		_, err := kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.Destroy(name, &cloudkms.DestroyCryptoKeyVersionRequest{}).Context(ctx).Do()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("kmstest: destroying key version %s failed: %w", name, err))
+		}
+	}
+	k.Created = nil
+	return errors.Join(errs...)
+}
+
+// hasCode returns whether err is a Cloud KMS error with the given HTTP status
+// code.
+func hasCode(err error, code int) bool {
+	var e *googleapi.Error
+	return errors.As(err, &e) && e.Code == code
+}
@@ -0,0 +1,233 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+////////////////////////////////////////////////////////////////////////////////
+
+package kmstest_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/cloudkms/v1"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/fakekms"
+	"github.com/tink-crypto/tink-go-gcpkms/v2/internal/kmstest"
+)
+
+const keyRing = "projects/p/locations/global/keyRings/" + kmstest.DefaultKeyRing
+
+// testKeys is a subset of kmstest.Matrix without the slow RSA keys.
+var testKeys = []kmstest.KeySpec{
+	{ID: "aead", Purpose: "ENCRYPT_DECRYPT", Algorithm: "GOOGLE_SYMMETRIC_ENCRYPTION"},
+	{ID: "ec-sign-p256-sha256", Purpose: "ASYMMETRIC_SIGN", Algorithm: "EC_SIGN_P256_SHA256"},
+	{ID: "hmac-sha256", Purpose: "MAC", Algorithm: "HMAC_SHA256"},
+}
+
+func newServer(t *testing.T) (*fakekms.Server, *cloudkms.Service) {
+	t.Helper()
+	srv := fakekms.NewServer()
+	t.Cleanup(srv.Close)
+	kms, err := cloudkms.NewService(context.Background(), srv.ClientOptions()...)
+	if err != nil {
+		t.Fatalf("cloudkms.NewService() err = %v, want nil", err)
+	}
+	return srv, kms
+}
+
+// versions returns the resource names of the given version of each of the
+// test keys.
+func versions(version int) map[string]string {
+	versions := make(map[string]string)
+	for _, k := range testKeys {
+		versions[k.ID] = fmt.Sprintf("%s/cryptoKeys/%s/cryptoKeyVersions/%d", keyRing, k.ID, version)
+	}
+	return versions
+}
+
+func checkVersions(t *testing.T, got, want map[string]string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Errorf("Versions = %v, want %v", got, want)
+	}
+	for id, v := range want {
+		if got[id] != v {
+			t.Errorf("Versions[%q] = %q, want %q", id, got[id], v)
+		}
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	ids := make(map[string]bool)
+	purposes := make(map[string]int)
+	for _, k := range kmstest.Matrix() {
+		if ids[k.ID] {
+			t.Errorf("Matrix() has key %q twice", k.ID)
+		}
+		ids[k.ID] = true
+		purposes[k.Purpose]++
+	}
+	if purposes["ENCRYPT_DECRYPT"] != 1 || purposes["ASYMMETRIC_SIGN"] != 10 || purposes["MAC"] != 1 {
+		t.Errorf("Matrix() has keys of purposes %v, want 1 ENCRYPT_DECRYPT, 10 ASYMMETRIC_SIGN and 1 MAC", purposes)
+	}
+	if id := kmstest.SigningKeyID("RSA_SIGN_PSS_4096_SHA512"); !ids[id] || id != "rsa-sign-pss-4096-sha512" {
+		t.Errorf("SigningKeyID() = %q, want rsa-sign-pss-4096-sha512 in Matrix()", id)
+	}
+}
+
+func TestProvision(t *testing.T) {
+	srv, kms := newServer(t)
+	ctx := context.Background()
+	keys, err := kmstest.Provision(ctx, kms, kmstest.Options{Project: "p", Keys: testKeys})
+	if err != nil {
+		t.Fatalf("kmstest.Provision() err = %v, want nil", err)
+	}
+	if keys.KeyRing != keyRing {
+		t.Errorf("KeyRing = %q, want %q", keys.KeyRing, keyRing)
+	}
+	for _, k := range testKeys {
+		if want := "gcp-kms://" + keyRing + "/cryptoKeys/" + k.ID; keys.URIs[k.ID] != want {
+			t.Errorf("URIs[%q] = %q, want %q", k.ID, keys.URIs[k.ID], want)
+		}
+	}
+	checkVersions(t, keys.Versions, versions(1))
+	if len(keys.Created) != len(testKeys) {
+		t.Errorf("Created = %v, want the first version of each key", keys.Created)
+	}
+	key, err := kms.Projects.Locations.KeyRings.CryptoKeys.Get(keyRing + "/cryptoKeys/ec-sign-p256-sha256").Do()
+	if err != nil {
+		t.Fatalf("getting the signing key failed: %v", err)
+	}
+	if key.Purpose != "ASYMMETRIC_SIGN" || key.VersionTemplate.Algorithm != "EC_SIGN_P256_SHA256" {
+		t.Errorf("signing key has purpose %s and algorithm %s, want ASYMMETRIC_SIGN and EC_SIGN_P256_SHA256", key.Purpose, key.VersionTemplate.Algorithm)
+	}
+
+	// Provisioning again reuses the keys.
+	again, err := kmstest.Provision(ctx, kms, kmstest.Options{Project: "p", Keys: testKeys})
+	if err != nil {
+		t.Fatalf("kmstest.Provision() err = %v, want nil", err)
+	}
+	checkVersions(t, again.Versions, versions(1))
+	if len(again.Created) != 0 {
+		t.Errorf("Created = %v, want none", again.Created)
+	}
+	if got := srv.CallCount("CreateKeyRing"); got != 1 {
+		t.Errorf("CreateKeyRing calls = %d, want 1", got)
+	}
+	if got := srv.CallCount("CreateCryptoKey"); got != len(testKeys) {
+		t.Errorf("CreateCryptoKey calls = %d, want %d", got, len(testKeys))
+	}
+}
+
+func TestProvisionAfterCleanup(t *testing.T) {
+	srv, kms := newServer(t)
+	ctx := context.Background()
+	keys, err := kmstest.Provision(ctx, kms, kmstest.Options{Project: "p", Keys: testKeys})
+	if err != nil {
+		t.Fatalf("kmstest.Provision() err = %v, want nil", err)
+	}
+	if err := keys.Cleanup(ctx, kms); err != nil {
+		t.Fatalf("keys.Cleanup() err = %v, want nil", err)
+	}
+	for _, name := range versions(1) {
+		v, err := kms.Projects.Locations.KeyRings.CryptoKeys.CryptoKeyVersions.Get(name).Do()
+		if err != nil {
+			t.Fatalf("getting %s failed: %v", name, err)
+		}
+		if v.State != "DESTROY_SCHEDULED" {
+			t.Errorf("%s has state %s, want DESTROY_SCHEDULED", name, v.State)
+		}
+	}
+
+	// The keys are reused, with a new version each.
+	keys, err = kmstest.Provision(ctx, kms, kmstest.Options{Project: "p", Keys: testKeys})
+	if err != nil {
+		t.Fatalf("kmstest.Provision() err = %v, want nil", err)
+	}
+	checkVersions(t, keys.Versions, versions(2))
+	if len(keys.Created) != len(testKeys) {
+		t.Errorf("Created = %v, want the second version of each key", keys.Created)
+	}
+	if got := srv.CallCount("UpdateCryptoKeyPrimaryVersion"); got != 1 {
+		t.Errorf("UpdateCryptoKeyPrimaryVersion calls = %d, want 1", got)
+	}
+	if err := keys.Cleanup(ctx, kms); err != nil {
+		t.Fatalf("keys.Cleanup() err = %v, want nil", err)
+	}
+	if got := srv.CallCount("DestroyCryptoKeyVersion"); got != 2*len(testKeys) {
+		t.Errorf("DestroyCryptoKeyVersion calls = %d, want %d", got, 2*len(testKeys))
+	}
+}
+
+func TestProvisionDryRun(t *testing.T) {
+	srv, kms := newServer(t)
+	ctx := context.Background()
+	var logs []string
+	logf := func(format string, args ...any) { logs = append(logs, fmt.Sprintf(format, args...)) }
+	keys, err := kmstest.Provision(ctx, kms, kmstest.Options{Project: "p", Keys: testKeys, DryRun: true, Logf: logf})
+	if err != nil {
+		t.Fatalf("kmstest.Provision() err = %v, want nil", err)
+	}
+	want := []string{
+		"kmstest: would create key ring " + keyRing,
+		"kmstest: would create key " + keyRing + "/cryptoKeys/aead (ENCRYPT_DECRYPT, GOOGLE_SYMMETRIC_ENCRYPTION)",
+		"kmstest: would create key " + keyRing + "/cryptoKeys/ec-sign-p256-sha256 (ASYMMETRIC_SIGN, EC_SIGN_P256_SHA256)",
+		"kmstest: would create key " + keyRing + "/cryptoKeys/hmac-sha256 (MAC, HMAC_SHA256)",
+	}
+	if got := strings.Join(logs, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("logs = %q, want %q", logs, want)
+	}
+	if len(keys.URIs) != len(testKeys) || len(keys.Versions) != 0 || len(keys.Created) != 0 {
+		t.Errorf("Provision() = %+v, want only URIs", keys)
+	}
+
+	// With the keys created and their versions destroyed, only versions are
+	// missing.
+	keys, err = kmstest.Provision(ctx, kms, kmstest.Options{Project: "p", Keys: testKeys})
+	if err != nil {
+		t.Fatalf("kmstest.Provision() err = %v, want nil", err)
+	}
+	if err := keys.Cleanup(ctx, kms); err != nil {
+		t.Fatalf("keys.Cleanup() err = %v, want nil", err)
+	}
+	logs = nil
+	if _, err := kmstest.Provision(ctx, kms, kmstest.Options{Project: "p", Keys: testKeys, DryRun: true, Logf: logf}); err != nil {
+		t.Fatalf("kmstest.Provision() err = %v, want nil", err)
+	}
+	if len(logs) != len(testKeys) || !strings.HasPrefix(logs[0], "kmstest: would create a version of key ") {
+		t.Errorf("logs = %q, want a version of each key", logs)
+	}
+	if got := srv.CallCount("CreateCryptoKeyVersion"); got != 0 {
+		t.Errorf("CreateCryptoKeyVersion calls = %d, want 0", got)
+	}
+}
+
+func TestProvisionRejectsMismatchedKey(t *testing.T) {
+	srv, kms := newServer(t)
+	if err := srv.CreateSigningKey(keyRing+"/cryptoKeys/aead", "EC_SIGN_P256_SHA256"); err != nil {
+		t.Fatalf("srv.CreateSigningKey() err = %v, want nil", err)
+	}
+	_, err := kmstest.Provision(context.Background(), kms, kmstest.Options{Project: "p", Keys: testKeys})
+	if err == nil || !strings.Contains(err.Error(), "purpose ASYMMETRIC_SIGN") {
+		t.Errorf("kmstest.Provision() err = %v, want an error about the purpose", err)
+	}
+}
+
+func TestProvisionRequiresProject(t *testing.T) {
+	_, kms := newServer(t)
+	if _, err := kmstest.Provision(context.Background(), kms, kmstest.Options{}); err == nil {
+		t.Error("kmstest.Provision() err = nil, want error")
+	}
+}